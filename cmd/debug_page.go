@@ -183,6 +183,7 @@ func newApiHandler(debugMux *debugMux) *gin.Engine {
 		registerGinRoute(v1, "GET", "List icons", "/icons", apiV1.Icons)
 		registerGinRoute(v1, "POST", "Config reload", "/reload", apiV1.Reload)
 		registerGinRoute(v1, "GET", "Route stats", "/stats", apiV1.Stats)
+		registerGinRoute(v1, "GET", "List security reports", "/security_reports", apiV1.SecurityReports)
 
 		route := v1.Group("/route")
 		{
@@ -190,6 +191,7 @@ func newApiHandler(debugMux *debugMux) *gin.Engine {
 			registerGinRoute(route, "GET", "Get route", "/:which", routeApi.Route)
 			registerGinRoute(route, "GET", "List providers", "/providers", routeApi.Providers)
 			registerGinRoute(route, "GET", "List routes by provider", "/by_provider", routeApi.ByProvider)
+			registerGinRoute(route, "GET", "List rule presets", "/rule_presets", routeApi.RulePresets)
 			registerGinRoute(route, "POST", "Playground", "/playground", routeApi.Playground)
 		}
 
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/yusing/godoxy/internal/importer"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// runImport runs "godoxy import", it converts a configuration of another reverse proxy to a route file.
+func runImport(args []string) int {
+	formats := make([]string, len(importer.Formats))
+	for i, f := range importer.Formats {
+		formats[i] = string(f)
+	}
+
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", "", "source format: "+strings.Join(formats, ", "))
+	output := fs.String("o", "", "output route file, default is stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: godoxy import -format <format> [-o <file>] <file|->")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *format == "" || fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	var result *importer.Result
+	var gerr gperr.Error
+	if fs.Arg(0) == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		result, gerr = importer.Import(importer.Format(*format), data)
+	} else {
+		result, gerr = importer.ImportFile(importer.Format(*format), fs.Arg(0))
+	}
+	if gerr != nil {
+		fmt.Fprintln(os.Stderr, gerr)
+		return 1
+	}
+	for _, issue := range result.Report {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", issue.Source, issue.Message)
+	}
+
+	out, err := result.YAML()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *output == "" {
+		_, err = os.Stdout.Write(out)
+	} else {
+		err = os.WriteFile(*output, out, 0o644)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "%d routes imported, %d issues\n", len(result.Routes), len(result.Report))
+	return 0
+}
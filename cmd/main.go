@@ -33,6 +33,15 @@ func parallel(fns ...func()) {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "import":
+			os.Exit(runImport(os.Args[2:]))
+		case "test-rules":
+			os.Exit(runTestRules(os.Args[2:]))
+		}
+	}
+
 	done := make(chan struct{}, 1)
 	go func() {
 		select {
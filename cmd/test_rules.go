@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/yusing/godoxy/internal/route/rules/ruletest"
+)
+
+// runTestRules runs "godoxy test-rules", it runs the cases of rule test files and fails if any case fails.
+func runTestRules(args []string) int {
+	fs := flag.NewFlagSet("test-rules", flag.ContinueOnError)
+	verbose := fs.Bool("v", false, "also print passed cases")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: godoxy test-rules [-v] <file.test.yml>...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	passed, failed := 0, 0
+	for _, path := range fs.Args() {
+		f, err := ruletest.Load(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			failed++
+			continue
+		}
+		for _, result := range f.Run() {
+			if result.Passed() {
+				passed++
+				if *verbose {
+					fmt.Printf("PASS %s: %s\n", path, result.Name)
+				}
+				continue
+			}
+			failed++
+			fmt.Printf("FAIL %s: %s\n", path, result.Name)
+			for _, failure := range result.Failures {
+				fmt.Printf("    %s\n", failure)
+			}
+		}
+	}
+	fmt.Printf("%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -18,6 +18,8 @@ import (
 	metricsApi "github.com/yusing/godoxy/internal/api/v1/metrics"
 	proxmoxApi "github.com/yusing/godoxy/internal/api/v1/proxmox"
 	routeApi "github.com/yusing/godoxy/internal/api/v1/route"
+	tokenApi "github.com/yusing/godoxy/internal/api/v1/token"
+	userApi "github.com/yusing/godoxy/internal/api/v1/user"
 	"github.com/yusing/godoxy/internal/auth"
 	"github.com/yusing/godoxy/internal/common"
 	apitypes "github.com/yusing/goutils/apitypes"
@@ -51,6 +53,8 @@ func NewHandler(requireAuth bool) *gin.Engine {
 	log.Debug().Msg("gin codec json.API: " + reflect.TypeOf(json.API).Name())
 
 	r.GET("/api/v1/version", apiV1.Version)
+	// authenticated by the webhook secret
+	r.POST("/api/v1/route/providers/git/:name/webhook", routeApi.GitWebhook)
 
 	if auth.IsEnabled() && requireAuth {
 		v1Auth := r.Group("/api/v1/auth")
@@ -61,23 +65,28 @@ func NewHandler(requireAuth bool) *gin.Engine {
 			v1Auth.POST("/callback", authApi.Callback)
 			v1Auth.POST("/logout", authApi.Logout)
 			v1Auth.GET("/logout", authApi.Logout)
+			v1Auth.POST("/webauthn/login/begin", authApi.WebAuthnLoginBegin)
+			v1Auth.POST("/webauthn/login/finish", authApi.WebAuthnLoginFinish)
 		}
 	}
 
 	v1 := r.Group("/api/v1")
 	if auth.IsEnabled() && requireAuth {
-		v1.Use(AuthMiddleware())
+		v1.Use(AuthMiddleware(), RequireScope())
 	}
 	if common.APISkipOriginCheck {
 		v1.Use(SkipOriginCheckMiddleware())
 	}
+	operator := RequireRole(auth.RoleOperator)
+	admin := RequireRole(auth.RoleAdmin)
 	{
 		// enable cache for favicon
 		v1.GET("/favicon", apiV1.FavIcon)
 		v1.GET("/health", apiV1.Health)
 		v1.GET("/icons", apiV1.Icons)
-		v1.POST("/reload", apiV1.Reload)
+		v1.POST("/reload", operator, apiV1.Reload)
 		v1.GET("/stats", apiV1.Stats)
+		v1.GET("/security_reports", operator, apiV1.SecurityReports)
 
 		route := v1.Group("/route")
 		{
@@ -85,46 +94,48 @@ func NewHandler(requireAuth bool) *gin.Engine {
 			route.GET("/:which", routeApi.Route)
 			route.GET("/providers", routeApi.Providers)
 			route.GET("/by_provider", routeApi.ByProvider)
+			route.GET("/rule_presets", routeApi.RulePresets)
 			route.POST("/playground", routeApi.Playground)
 			route.GET("/validate", routeApi.Validate) // websocket
 			route.POST("/validate", routeApi.Validate)
+			route.POST("/import", operator, routeApi.Import)
 		}
 
 		file := v1.Group("/file")
 		{
-			file.GET("/list", fileApi.List)
-			file.GET("/content", fileApi.Get)
-			file.PUT("/content", fileApi.Set)
-			file.POST("/content", fileApi.Set)
-			file.POST("/validate", fileApi.Validate)
+			file.GET("/list", operator, fileApi.List)
+			file.GET("/content", operator, fileApi.Get)
+			file.PUT("/content", admin, fileApi.Set)
+			file.POST("/content", admin, fileApi.Set)
+			file.POST("/validate", operator, fileApi.Validate)
 		}
 
 		homepage := v1.Group("/homepage")
 		{
 			homepage.GET("/categories", homepageApi.Categories)
 			homepage.GET("/items", homepageApi.Items)
-			homepage.POST("/set/item", homepageApi.SetItem)
-			homepage.POST("/set/items_batch", homepageApi.SetItemsBatch)
-			homepage.POST("/set/item_visible", homepageApi.SetItemVisible)
-			homepage.POST("/set/item_favorite", homepageApi.SetItemFavorite)
-			homepage.POST("/set/item_sort_order", homepageApi.SetItemSortOrder)
-			homepage.POST("/set/item_all_sort_order", homepageApi.SetItemAllSortOrder)
-			homepage.POST("/set/item_fav_sort_order", homepageApi.SetItemFavSortOrder)
-			homepage.POST("/set/category_order", homepageApi.SetCategoryOrder)
+			homepage.POST("/set/item", operator, homepageApi.SetItem)
+			homepage.POST("/set/items_batch", operator, homepageApi.SetItemsBatch)
+			homepage.POST("/set/item_visible", operator, homepageApi.SetItemVisible)
+			homepage.POST("/set/item_favorite", operator, homepageApi.SetItemFavorite)
+			homepage.POST("/set/item_sort_order", operator, homepageApi.SetItemSortOrder)
+			homepage.POST("/set/item_all_sort_order", operator, homepageApi.SetItemAllSortOrder)
+			homepage.POST("/set/item_fav_sort_order", operator, homepageApi.SetItemFavSortOrder)
+			homepage.POST("/set/category_order", operator, homepageApi.SetCategoryOrder)
 			homepage.POST("/item_click", homepageApi.ItemClick)
 		}
 
 		cert := v1.Group("/cert")
 		{
 			cert.GET("/info", certApi.Info)
-			cert.GET("/renew", certApi.Renew)
+			cert.GET("/renew", operator, certApi.Renew)
 		}
 
 		agent := v1.Group("/agent")
 		{
 			agent.GET("/list", agentApi.List)
-			agent.POST("/create", agentApi.Create)
-			agent.POST("/verify", agentApi.Verify)
+			agent.POST("/create", admin, agentApi.Create)
+			agent.POST("/verify", admin, agentApi.Verify)
 		}
 
 		metrics := v1.Group("/metrics")
@@ -140,9 +151,9 @@ func NewHandler(requireAuth bool) *gin.Engine {
 			docker.GET("/containers", dockerApi.Containers)
 			docker.GET("/info", dockerApi.Info)
 			docker.GET("/logs/:id", dockerApi.Logs)
-			docker.POST("/start", dockerApi.Start)
-			docker.POST("/stop", dockerApi.Stop)
-			docker.POST("/restart", dockerApi.Restart)
+			docker.POST("/start", operator, dockerApi.Start)
+			docker.POST("/stop", operator, dockerApi.Stop)
+			docker.POST("/restart", operator, dockerApi.Restart)
 			docker.GET("/stats/:id", dockerApi.Stats)
 		}
 
@@ -155,9 +166,33 @@ func NewHandler(requireAuth bool) *gin.Engine {
 			proxmox.GET("/journalctl/:node/:vmid/:service", proxmoxApi.Journalctl)
 			proxmox.GET("/stats/:node", proxmoxApi.NodeStats)
 			proxmox.GET("/stats/:node/:vmid", proxmoxApi.VMStats)
-			proxmox.POST("/lxc/:node/:vmid/start", proxmoxApi.Start)
-			proxmox.POST("/lxc/:node/:vmid/stop", proxmoxApi.Stop)
-			proxmox.POST("/lxc/:node/:vmid/restart", proxmoxApi.Restart)
+			proxmox.POST("/lxc/:node/:vmid/start", operator, proxmoxApi.Start)
+			proxmox.POST("/lxc/:node/:vmid/stop", operator, proxmoxApi.Stop)
+			proxmox.POST("/lxc/:node/:vmid/restart", operator, proxmoxApi.Restart)
+		}
+
+		user := v1.Group("/user")
+		{
+			user.GET("/me", userApi.Me)
+			user.POST("/change_password", userApi.ChangePassword)
+			user.POST("/totp/enroll", userApi.TOTPEnroll)
+			user.POST("/totp/confirm", userApi.TOTPConfirm)
+			user.POST("/totp/disable", userApi.TOTPDisable)
+			user.GET("/webauthn/list", userApi.WebAuthnList)
+			user.POST("/webauthn/register/begin", userApi.WebAuthnRegisterBegin)
+			user.POST("/webauthn/register/finish", userApi.WebAuthnRegisterFinish)
+			user.POST("/webauthn/delete", userApi.WebAuthnDelete)
+			user.GET("/list", admin, userApi.List)
+			user.POST("/create", admin, userApi.Create)
+			user.POST("/update", admin, userApi.Update)
+			user.POST("/delete", admin, userApi.Delete)
+		}
+
+		token := v1.Group("/token")
+		{
+			token.GET("/list", tokenApi.List)
+			token.POST("/create", tokenApi.Create)
+			token.POST("/revoke", tokenApi.Revoke)
 		}
 	}
 
@@ -178,12 +213,27 @@ func NoCache() gin.HandlerFunc {
 
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		err := auth.GetDefaultAuth().CheckToken(c.Request)
+		user, err := auth.CheckUser(c.Request)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, apitypes.Error("Unauthorized", err))
 			c.Abort()
 			return
 		}
+		c.Request = c.Request.WithContext(auth.WithUser(c.Request.Context(), user))
+		c.Next()
+	}
+}
+
+// RequireRole aborts with 403 if the authenticated user does not have the required role.
+//
+// Requests without an authenticated user (i.e. auth disabled) are allowed.
+func RequireRole(role auth.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if user, ok := auth.UserFromContext(c.Request.Context()); ok && !user.Role.Has(role) {
+			c.JSON(http.StatusForbidden, apitypes.Error("Forbidden: "+string(role)+" role required"))
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
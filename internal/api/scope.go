@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+// readOnlyPostEndpoints are POST endpoints that do not modify any state.
+var readOnlyPostEndpoints = map[string]struct{}{
+	"/api/v1/route/playground": {},
+	"/api/v1/route/validate":   {},
+	"/api/v1/file/validate":    {},
+}
+
+// requiredScope returns the API token scope required for the matched endpoint.
+//
+// The area is derived from the endpoint group, e.g. "/api/v1/docker/restart" requires "docker:write".
+// Users and tokens cannot be managed with API tokens since "user" and "token" are not grantable areas.
+func requiredScope(c *gin.Context) auth.Scope {
+	fullPath := c.FullPath()
+	area, _, _ := strings.Cut(strings.TrimPrefix(fullPath, "/api/v1/"), "/")
+	switch area {
+	case "route", "reload", "health", "stats", "icons", "favicon":
+		area = "routes"
+	}
+
+	access := auth.ScopeAccessWrite
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead:
+		access = auth.ScopeAccessRead
+	case http.MethodPost:
+		if _, ok := readOnlyPostEndpoints[fullPath]; ok {
+			access = auth.ScopeAccessRead
+		}
+	}
+	return auth.Scope(area + ":" + access)
+}
+
+// RequireScope aborts with 403 if the request is authenticated by an API token
+// that does not have the scope required by the endpoint.
+func RequireScope() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if user, ok := auth.UserFromContext(c.Request.Context()); ok {
+			if scope := requiredScope(c); !user.HasScope(scope) {
+				c.JSON(http.StatusForbidden, apitypes.Error("Forbidden: api token requires scope "+string(scope)))
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
@@ -17,6 +17,8 @@ import (
 // @Success		302	{string}	string	"OIDC: Redirects to home page"
 // @Failure		400	{string}	string	"OIDC: invalid request (missing state cookie or oauth state)"
 // @Failure		400	{string}	string	"Userpass: invalid request / credentials"
+// @Failure		401	{object}	auth.SecondFactorRequiredResponse	"Userpass: second factor required"
+// @Failure		429	{string}	string	"Userpass: too many second factor attempts"
 // @Failure		500	{string}	string	"Internal server error"
 // @Router			/auth/callback [post]
 func Callback(c *gin.Context) {
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+// @x-id				"webauthn-login-begin"
+// @Base			/api/v1
+// @Summary		Begin WebAuthn login
+// @Description	Returns the options for navigator.credentials.get(). Omit username for passkey login.
+// @Tags			auth
+// @Accept			json
+// @Produce		json
+// @Param			body	body	auth.WebAuthnLoginBeginRequest	false	"Request"
+// @Success		200	{object}	map[string]any
+// @Failure		400	{string}	string	"invalid request"
+// @Failure		404	{object}	apitypes.ErrorResponse "Not using username/password or LDAP authentication"
+// @Router			/auth/webauthn/login/begin [post]
+func WebAuthnLoginBegin(c *gin.Context) {
+	provider, ok := auth.GetDefaultAuth().(auth.MFAProvider)
+	if !ok {
+		c.JSON(http.StatusNotFound, apitypes.Error("webauthn requires username/password or LDAP authentication"))
+		return
+	}
+	provider.WebAuthnLoginBeginHandler(c.Writer, c.Request)
+}
+
+// @x-id				"webauthn-login-finish"
+// @Base			/api/v1
+// @Summary		Finish WebAuthn login
+// @Description	Verifies the WebAuthn assertion and sets the session cookie.
+// @Description	Without user verification (always with LDAP), the password must have been verified by /auth/callback first.
+// @Tags			auth
+// @Accept			json
+// @Produce		plain
+// @Param			body	body	object	true	"PublicKeyCredential"
+// @Success		200	{string}	string	"OK"
+// @Failure		400	{string}	string	"invalid request / credentials"
+// @Failure		401	{string}	string	"password required"
+// @Failure		404	{object}	apitypes.ErrorResponse "Not using username/password or LDAP authentication"
+// @Router			/auth/webauthn/login/finish [post]
+func WebAuthnLoginFinish(c *gin.Context) {
+	provider, ok := auth.GetDefaultAuth().(auth.MFAProvider)
+	if !ok {
+		c.JSON(http.StatusNotFound, apitypes.Error("webauthn requires username/password or LDAP authentication"))
+		return
+	}
+	provider.WebAuthnLoginFinishHandler(c.Writer, c.Request)
+}
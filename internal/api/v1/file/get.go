@@ -17,10 +17,11 @@ const (
 	FileTypeConfig     FileType = "config"     // @name FileTypeConfig
 	FileTypeProvider   FileType = "provider"   // @name FileTypeProvider
 	FileTypeMiddleware FileType = "middleware" // @name FileTypeMiddleware
+	FileTypeRuleTest   FileType = "rule_test"  // @name FileTypeRuleTest
 )
 
 type GetFileContentRequest struct {
-	FileType FileType `form:"type" binding:"required,oneof=config provider middleware"`
+	FileType FileType `form:"type" binding:"required,oneof=config provider middleware rule_test"`
 	Filename string   `form:"filename" binding:"required" format:"filename"`
 } //	@name	GetFileContentRequest
 
@@ -61,6 +62,8 @@ func GetFileType(file string) FileType {
 		return FileTypeConfig
 	case strings.HasPrefix(file, common.MiddlewareComposeBasePath):
 		return FileTypeMiddleware
+	case strings.HasSuffix(file, ".test.yml"), strings.HasSuffix(file, ".test.yaml"):
+		return FileTypeRuleTest
 	}
 	return FileTypeProvider
 }
@@ -14,6 +14,7 @@ type ListFilesResponse struct {
 	Config     []string `json:"config"`
 	Provider   []string `json:"provider"`
 	Middleware []string `json:"middleware"`
+	RuleTest   []string `json:"rule_test"`
 } // @name ListFilesResponse
 
 // @x-id				"list"
@@ -32,6 +33,7 @@ func List(c *gin.Context) {
 		FileTypeConfig:     make([]string, 0),
 		FileTypeProvider:   make([]string, 0),
 		FileTypeMiddleware: make([]string, 0),
+		FileTypeRuleTest:   make([]string, 0),
 	}
 
 	// config/
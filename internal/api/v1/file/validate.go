@@ -4,15 +4,17 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/common"
 	config "github.com/yusing/godoxy/internal/config/types"
 	"github.com/yusing/godoxy/internal/net/gphttp/middleware"
 	"github.com/yusing/godoxy/internal/route/provider"
+	"github.com/yusing/godoxy/internal/route/rules/ruletest"
 	apitypes "github.com/yusing/goutils/apitypes"
 	gperr "github.com/yusing/goutils/errs"
 )
 
 type ValidateFileRequest struct {
-	FileType FileType `form:"type" validate:"required,oneof=config provider middleware"`
+	FileType FileType `form:"type" validate:"required,oneof=config provider middleware rule_test"`
 } //	@name	ValidateFileRequest
 
 // @x-id				"validate"
@@ -59,6 +61,9 @@ func validateFile(fileType FileType, content []byte) gperr.Error {
 		errs := gperr.NewBuilder("middleware errors")
 		middleware.BuildMiddlewaresFromYAML("", content, &errs)
 		return errs.Error()
+	case FileTypeRuleTest:
+		// a relative rule_file is in the config directory, failed cases are errors
+		return ruletest.Validate(content, common.ConfigBasePath)
 	}
 	return provider.Validate(content)
 }
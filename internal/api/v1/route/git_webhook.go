@@ -0,0 +1,65 @@
+package routeApi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	config "github.com/yusing/godoxy/internal/config/types"
+	"github.com/yusing/godoxy/internal/route/provider"
+	providerTypes "github.com/yusing/godoxy/internal/route/provider/types"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+type GitWebhookRequest struct {
+	Name string `uri:"name" validate:"required"`
+} //	@name	GitWebhookRequest
+
+// maxWebhookBodySize is the max payload size of GitHub webhooks.
+const maxWebhookBodySize = 25 << 20
+
+// @x-id				"gitWebhook"
+// @BasePath		/api/v1
+// @Summary		Git provider webhook
+// @Description	Trigger a pull of a Git route provider, authenticated by the webhook secret instead of the API auth.
+// @Description	Supports GitHub, Gitea, Forgejo and Gogs signatures and the GitLab secret token.
+// @Tags			route
+// @Accept			json
+// @Produce		json
+// @Param			name	path		string	true	"Provider name"
+// @Success		200		{object}	apitypes.SuccessResponse
+// @Failure		400		{object}	apitypes.ErrorResponse
+// @Failure		401		{object}	apitypes.ErrorResponse
+// @Failure		404		{object}	apitypes.ErrorResponse
+// @Router			/route/providers/git/{name}/webhook [post]
+func GitWebhook(c *gin.Context) {
+	var request GitWebhookRequest
+	if err := c.ShouldBindUri(&request); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+
+	var gp *provider.GitProvider
+	for _, p := range config.ActiveState.Load().IterProviders() {
+		if p.GetType() == providerTypes.ProviderTypeGit && p.ShortName() == request.Name {
+			gp, _ = provider.GitProviderOf(p)
+			break
+		}
+	}
+	if gp == nil {
+		c.JSON(http.StatusNotFound, apitypes.Error("provider not found"))
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBodySize)
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("failed to read body", err))
+		return
+	}
+	if err := gp.Webhook(c.Request.Header, body); err != nil {
+		// do not tell whether the webhook is disabled or the signature is invalid
+		c.JSON(http.StatusUnauthorized, apitypes.Error("unauthorized"))
+		return
+	}
+	c.JSON(http.StatusOK, apitypes.Success("pull triggered"))
+}
@@ -0,0 +1,67 @@
+package routeApi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/importer"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+const maxImportBodySize = 32 << 20 // NPM databases with many hosts
+
+type ImportRequest struct {
+	Format importer.Format `form:"format" binding:"required"`
+}
+
+type ImportResponse struct {
+	YAML   string           `json:"yaml"` // route file with the report as a comment
+	Routes int              `json:"routes"`
+	Report []importer.Issue `json:"report"`
+} // @name ImportResponse
+
+// @x-id			"import"
+// @BasePath	/api/v1
+// @Summary		Import routes
+// @Description	Convert a Traefik dynamic configuration, a compose file with Traefik labels, a Caddyfile or a Nginx Proxy Manager database to a route file
+// @Tags			route
+// @Accept		octet-stream
+// @Produce		json
+// @Param			format	query		string	true	"Source format"	Enums(traefik, traefik-labels, caddy, npm)
+// @Param			file	body		string	true	"Source configuration file"
+// @Success		200		{object}	ImportResponse
+// @Failure		400		{object}	apitypes.ErrorResponse
+// @Failure		403		{object}	apitypes.ErrorResponse
+// @Failure		422		{object}	apitypes.ErrorResponse "Import failed"
+// @Failure		500		{object}	apitypes.ErrorResponse
+// @Router		/route/import [post]
+func Import(c *gin.Context) {
+	var request ImportRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBodySize)
+	data, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("failed to read body", err))
+		return
+	}
+
+	result, gerr := importer.Import(request.Format, data)
+	if gerr != nil {
+		c.JSON(http.StatusUnprocessableEntity, apitypes.Error("import failed", gerr))
+		return
+	}
+	out, err := result.YAML()
+	if err != nil {
+		c.Error(apitypes.InternalServerError(err, "failed to encode routes"))
+		return
+	}
+	c.JSON(http.StatusOK, ImportResponse{
+		YAML:   string(out),
+		Routes: len(result.Routes),
+		Report: result.Report,
+	})
+}
@@ -0,0 +1,24 @@
+package routeApi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	rulepresets "github.com/yusing/godoxy/internal/route/rules/presets"
+
+	_ "github.com/yusing/goutils/apitypes"
+)
+
+// @x-id				"rulePresets"
+// @BasePath		/api/v1
+// @Summary		List rule presets
+// @Description	List built-in and user rule presets with their params
+// @Tags			route
+// @Accept			json
+// @Produce		json
+// @Success		200	{array}		rulepresets.Preset
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Router			/route/rule_presets [get]
+func RulePresets(c *gin.Context) {
+	c.JSON(http.StatusOK, rulepresets.List())
+}
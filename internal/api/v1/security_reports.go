@@ -0,0 +1,25 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/net/gphttp/middleware"
+
+	_ "github.com/yusing/goutils/apitypes"
+)
+
+// @x-id				"securityReports"
+// @BasePath		/api/v1
+// @Summary		List security reports
+// @Description	List CSP violation and other reports collected by the secureheaders middleware, newest first
+// @Tags			v1
+// @Accept			json
+// @Produce		json
+// @Param			route	query		string	false	"Route name, all routes if empty"
+// @Success		200		{array}		middleware.SecurityReport
+// @Failure		403		{object}	apitypes.ErrorResponse
+// @Router			/security_reports [get]
+func SecurityReports(c *gin.Context) {
+	c.JSON(http.StatusOK, middleware.SecurityReports(c.Query("route")))
+}
@@ -0,0 +1,64 @@
+package tokenapi
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+type (
+	CreateTokenRequest struct {
+		Name      string       `json:"name" binding:"required"`
+		Scopes    []auth.Scope `json:"scopes" binding:"required" example:"routes:read,docker:write"`
+		ExpiresIn string       `json:"expires_in,omitempty" example:"720h"` // empty for no expiry
+	} // @name CreateTokenRequest
+	CreateTokenResponse struct {
+		Token  *auth.APIToken `json:"token"`
+		Secret string         `json:"secret"` // only returned once
+	} // @name CreateTokenResponse
+)
+
+// @x-id				"create"
+// @BasePath		/api/v1
+// @Summary		Create API token
+// @Description	Create an API token owned by the current user. Use it with the "Authorization: Bearer <secret>" header.
+// @Tags			token
+// @Accept			json
+// @Produce		json
+// @Param			request	body	CreateTokenRequest	true	"Request"
+// @Success		200	{object}	CreateTokenResponse
+// @Failure		400	{object}	apitypes.ErrorResponse
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Router			/token/create [post]
+func Create(c *gin.Context) {
+	var req CreateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+	user, ok := auth.UserFromContext(c.Request.Context())
+	if !ok || user.Username == "" {
+		c.JSON(http.StatusBadRequest, apitypes.Error("api tokens require an authenticated user"))
+		return
+	}
+
+	var ttl time.Duration
+	if req.ExpiresIn != "" {
+		var err error
+		ttl, err = time.ParseDuration(req.ExpiresIn)
+		if err != nil || ttl <= 0 {
+			c.JSON(http.StatusBadRequest, apitypes.Error("invalid expires_in", err))
+			return
+		}
+	}
+
+	token, secret, err := auth.CreateAPIToken(auth.GetDefaultAuth(), user, req.Name, req.Scopes, ttl)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("failed to create token", err))
+		return
+	}
+	c.JSON(http.StatusOK, CreateTokenResponse{Token: token, Secret: secret})
+}
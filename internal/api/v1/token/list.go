@@ -0,0 +1,32 @@
+package tokenapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+// @x-id				"list"
+// @BasePath		/api/v1
+// @Summary		List API tokens
+// @Description	List API tokens of the current user. Admins see tokens of all users.
+// @Tags			token
+// @Produce		json
+// @Success		200	{array}		auth.APIToken
+// @Failure		400	{object}	apitypes.ErrorResponse "Authentication disabled"
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Router			/token/list [get]
+func List(c *gin.Context) {
+	user, ok := auth.UserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusBadRequest, apitypes.Error("authentication is disabled"))
+		return
+	}
+	owner := user.Username
+	if user.Role.Has(auth.RoleAdmin) {
+		owner = ""
+	}
+	c.JSON(http.StatusOK, auth.ListAPITokens(owner))
+}
@@ -0,0 +1,49 @@
+package tokenapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+type RevokeTokenRequest struct {
+	ID string `json:"id" binding:"required"`
+} // @name RevokeTokenRequest
+
+// @x-id				"revoke"
+// @BasePath		/api/v1
+// @Summary		Revoke API token
+// @Description	Revoke an API token of the current user. Admins can revoke tokens of all users.
+// @Tags			token
+// @Accept			json
+// @Produce		json
+// @Param			request	body	RevokeTokenRequest	true	"Request"
+// @Success		200	{object}	apitypes.SuccessResponse
+// @Failure		400	{object}	apitypes.ErrorResponse
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Failure		404	{object}	apitypes.ErrorResponse "Token not found"
+// @Router			/token/revoke [post]
+func Revoke(c *gin.Context) {
+	var req RevokeTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+	user, ok := auth.UserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusBadRequest, apitypes.Error("authentication is disabled"))
+		return
+	}
+	token, ok := auth.GetAPIToken(req.ID)
+	if !ok || (token.Owner != user.Username && !user.Role.Has(auth.RoleAdmin)) {
+		c.JSON(http.StatusNotFound, apitypes.Error("token not found"))
+		return
+	}
+	if err := auth.RevokeAPIToken(req.ID); err != nil {
+		c.JSON(http.StatusNotFound, apitypes.Error("token not found", err))
+		return
+	}
+	c.JSON(http.StatusOK, apitypes.Success("token revoked"))
+}
@@ -0,0 +1,43 @@
+package userapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+} // @name ChangePasswordRequest
+
+// @x-id				"change-password"
+// @BasePath		/api/v1
+// @Summary		Change password
+// @Description	Change the password of the current user. All sessions of the user, including the current one, are signed out.
+// @Tags			user
+// @Accept			json
+// @Produce		json
+// @Param			request	body	ChangePasswordRequest	true	"Request"
+// @Success		200	{object}	apitypes.SuccessResponse
+// @Failure		400	{object}	apitypes.ErrorResponse
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Router			/user/change_password [post]
+func ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if err := auth.ChangePassword(user.Username, req.CurrentPassword, req.NewPassword); err != nil {
+		handleUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, apitypes.Success("password changed"))
+}
@@ -0,0 +1,24 @@
+package userapi
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+// handleUserError writes the response for errors returned by the auth user store.
+func handleUserError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, auth.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, apitypes.Error("user not found", err))
+	case errors.Is(err, auth.ErrUserExists):
+		c.JSON(http.StatusConflict, apitypes.Error("user already exists", err))
+	case errors.Is(err, auth.ErrBuiltinUser):
+		c.JSON(http.StatusForbidden, apitypes.Error("built-in user cannot be modified", err))
+	default:
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+	}
+}
@@ -0,0 +1,41 @@
+package userapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+type CreateUserRequest struct {
+	Username string    `json:"username" binding:"required"`
+	Password string    `json:"password" binding:"required"`
+	Role     auth.Role `json:"role" binding:"required" enums:"admin,operator,viewer"`
+} // @name CreateUserRequest
+
+// @x-id				"create"
+// @BasePath		/api/v1
+// @Summary		Create user
+// @Description	Create a new user with the given role
+// @Tags			user
+// @Accept			json
+// @Produce		json
+// @Param			request	body	CreateUserRequest	true	"Request"
+// @Success		200	{object}	apitypes.SuccessResponse
+// @Failure		400	{object}	apitypes.ErrorResponse
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Failure		409	{object}	apitypes.ErrorResponse "User already exists"
+// @Router			/user/create [post]
+func Create(c *gin.Context) {
+	var req CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+	if err := auth.CreateUser(req.Username, req.Password, req.Role); err != nil {
+		handleUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, apitypes.Success("user created"))
+}
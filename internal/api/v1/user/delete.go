@@ -0,0 +1,43 @@
+package userapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+type DeleteUserRequest struct {
+	Username string `json:"username" binding:"required"`
+} // @name DeleteUserRequest
+
+// @x-id				"delete"
+// @BasePath		/api/v1
+// @Summary		Delete user
+// @Description	Delete a user. Existing sessions of the user are rejected afterwards.
+// @Tags			user
+// @Accept			json
+// @Produce		json
+// @Param			request	body	DeleteUserRequest	true	"Request"
+// @Success		200	{object}	apitypes.SuccessResponse
+// @Failure		400	{object}	apitypes.ErrorResponse
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Failure		404	{object}	apitypes.ErrorResponse "User not found"
+// @Router			/user/delete [post]
+func Delete(c *gin.Context) {
+	var req DeleteUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+	if user, ok := auth.UserFromContext(c.Request.Context()); ok && user.Username == req.Username {
+		c.JSON(http.StatusBadRequest, apitypes.Error("cannot delete the current user"))
+		return
+	}
+	if err := auth.DeleteUser(req.Username); err != nil {
+		handleUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, apitypes.Success("user deleted"))
+}
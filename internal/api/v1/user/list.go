@@ -0,0 +1,23 @@
+package userapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+
+	_ "github.com/yusing/goutils/apitypes"
+)
+
+// @x-id				"list"
+// @BasePath		/api/v1
+// @Summary		List users
+// @Description	List users, including the built-in user from the environment
+// @Tags			user
+// @Produce		json
+// @Success		200	{array}		auth.UserInfo
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Router			/user/list [get]
+func List(c *gin.Context) {
+	c.JSON(http.StatusOK, auth.ListUsers())
+}
@@ -0,0 +1,28 @@
+package userapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+// @x-id				"me"
+// @BasePath		/api/v1
+// @Summary		Current user
+// @Description	Get the authenticated user and its role
+// @Tags			user
+// @Produce		json
+// @Success		200	{object}	auth.UserInfo
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Failure		404	{object}	apitypes.ErrorResponse "Authentication disabled"
+// @Router			/user/me [get]
+func Me(c *gin.Context) {
+	user, ok := auth.UserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusNotFound, apitypes.Error("authentication is disabled"))
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
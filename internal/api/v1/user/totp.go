@@ -0,0 +1,141 @@
+package userapi
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+type (
+	TOTPEnrollResponse struct {
+		Secret string `json:"secret"` // base32
+		URL    string `json:"url"`    // otpauth:// URL for QR codes
+	} // @name TOTPEnrollResponse
+	TOTPCodeRequest struct {
+		Code string `json:"code" binding:"required"`
+	} // @name TOTPCodeRequest
+	TOTPConfirmResponse struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	} // @name TOTPConfirmResponse
+)
+
+// currentUser writes an error response and returns false if there is no authenticated user.
+func currentUser(c *gin.Context) (*auth.UserInfo, bool) {
+	user, ok := auth.UserFromContext(c.Request.Context())
+	if !ok || user.Username == "" {
+		c.JSON(http.StatusBadRequest, apitypes.Error("no authenticated user"))
+		return nil, false
+	}
+	return user, true
+}
+
+// mfaEnrollmentUser is like currentUser, but also rejects providers that do not enforce second factors (OIDC),
+// so users cannot enroll a second factor that is never asked for.
+func mfaEnrollmentUser(c *gin.Context) (*auth.UserInfo, bool) {
+	if _, ok := auth.GetDefaultAuth().(auth.MFAProvider); !ok {
+		c.JSON(http.StatusNotFound, apitypes.Error("second factors require username/password or LDAP authentication"))
+		return nil, false
+	}
+	return currentUser(c)
+}
+
+// @x-id				"totp-enroll"
+// @BasePath		/api/v1
+// @Summary		Begin TOTP enrollment
+// @Description	Generate a TOTP secret for the current user. It is enabled after confirming a code.
+// @Tags			user
+// @Produce		json
+// @Success		200	{object}	TOTPEnrollResponse
+// @Failure		400	{object}	apitypes.ErrorResponse
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Failure		404	{object}	apitypes.ErrorResponse "Second factors are not supported by the authentication provider"
+// @Failure		409	{object}	apitypes.ErrorResponse "TOTP already enabled"
+// @Router			/user/totp/enroll [post]
+func TOTPEnroll(c *gin.Context) {
+	user, ok := mfaEnrollmentUser(c)
+	if !ok {
+		return
+	}
+	secret, url, err := auth.BeginTOTPEnrollment(user.Username)
+	if err != nil {
+		if errors.Is(err, auth.ErrTOTPAlreadyEnabled) {
+			c.JSON(http.StatusConflict, apitypes.Error("totp already enabled"))
+			return
+		}
+		c.Error(apitypes.InternalServerError(err, "failed to begin totp enrollment"))
+		return
+	}
+	c.JSON(http.StatusOK, TOTPEnrollResponse{Secret: secret, URL: url})
+}
+
+// @x-id				"totp-confirm"
+// @BasePath		/api/v1
+// @Summary		Confirm TOTP enrollment
+// @Description	Enable TOTP for the current user and return one-time recovery codes.
+// @Tags			user
+// @Accept			json
+// @Produce		json
+// @Param			request	body	TOTPCodeRequest	true	"Request"
+// @Success		200	{object}	TOTPConfirmResponse
+// @Failure		400	{object}	apitypes.ErrorResponse
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Failure		404	{object}	apitypes.ErrorResponse "Second factors are not supported by the authentication provider"
+// @Failure		429	{object}	apitypes.ErrorResponse "Too many failed attempts"
+// @Router			/user/totp/confirm [post]
+func TOTPConfirm(c *gin.Context) {
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+	user, ok := mfaEnrollmentUser(c)
+	if !ok {
+		return
+	}
+	codes, err := auth.ConfirmTOTPEnrollment(user.Username, req.Code)
+	if err != nil {
+		c.JSON(mfaErrorStatus(err), apitypes.Error("failed to enable totp", err))
+		return
+	}
+	c.JSON(http.StatusOK, TOTPConfirmResponse{RecoveryCodes: codes})
+}
+
+// @x-id				"totp-disable"
+// @BasePath		/api/v1
+// @Summary		Disable TOTP
+// @Description	Disable TOTP for the current user. Requires a TOTP or recovery code.
+// @Tags			user
+// @Accept			json
+// @Produce		json
+// @Param			request	body	TOTPCodeRequest	true	"Request"
+// @Success		200	{object}	apitypes.SuccessResponse
+// @Failure		400	{object}	apitypes.ErrorResponse
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Failure		429	{object}	apitypes.ErrorResponse "Too many failed attempts"
+// @Router			/user/totp/disable [post]
+func TOTPDisable(c *gin.Context) {
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if err := auth.DisableTOTP(user.Username, req.Code); err != nil {
+		c.JSON(mfaErrorStatus(err), apitypes.Error("failed to disable totp", err))
+		return
+	}
+	c.JSON(http.StatusOK, apitypes.Success("totp disabled"))
+}
+
+func mfaErrorStatus(err error) int {
+	if errors.Is(err, auth.ErrTooManyMFAAttempts) {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusBadRequest
+}
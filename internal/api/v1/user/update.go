@@ -0,0 +1,41 @@
+package userapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+type UpdateUserRequest struct {
+	Username string     `json:"username" binding:"required"`
+	Role     *auth.Role `json:"role,omitempty" enums:"admin,operator,viewer" extensions:"x-nullable"`
+	Password *string    `json:"password,omitempty" extensions:"x-nullable"`
+} // @name UpdateUserRequest
+
+// @x-id				"update"
+// @BasePath		/api/v1
+// @Summary		Update user
+// @Description	Change the role and/or reset the password of a user. Resetting the password signs the user out.
+// @Tags			user
+// @Accept			json
+// @Produce		json
+// @Param			request	body	UpdateUserRequest	true	"Request"
+// @Success		200	{object}	apitypes.SuccessResponse
+// @Failure		400	{object}	apitypes.ErrorResponse
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Failure		404	{object}	apitypes.ErrorResponse "User not found"
+// @Router			/user/update [post]
+func Update(c *gin.Context) {
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+	if err := auth.UpdateUser(req.Username, req.Role, req.Password); err != nil {
+		handleUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, apitypes.Success("user updated"))
+}
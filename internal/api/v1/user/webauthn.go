@@ -0,0 +1,128 @@
+package userapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/auth"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+type (
+	WebAuthnRegisterRequest struct {
+		Name       string          `json:"name"`
+		Credential json.RawMessage `json:"credential" binding:"required" swaggertype:"object"` // PublicKeyCredential
+	} // @name WebAuthnRegisterRequest
+	WebAuthnDeleteRequest struct {
+		ID string `json:"id" binding:"required"`
+	} // @name WebAuthnDeleteRequest
+)
+
+// @x-id				"webauthn-list"
+// @BasePath		/api/v1
+// @Summary		List WebAuthn credentials
+// @Description	List passkeys and security keys of the current user
+// @Tags			user
+// @Produce		json
+// @Success		200	{array}		auth.WebAuthnCredentialInfo
+// @Failure		400	{object}	apitypes.ErrorResponse
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Router			/user/webauthn/list [get]
+func WebAuthnList(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, auth.ListWebAuthnCredentials(user.Username))
+}
+
+// @x-id				"webauthn-register-begin"
+// @BasePath		/api/v1
+// @Summary		Begin WebAuthn registration
+// @Description	Returns the options for navigator.credentials.create()
+// @Tags			user
+// @Produce		json
+// @Success		200	{object}	map[string]any
+// @Failure		400	{object}	apitypes.ErrorResponse
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Failure		404	{object}	apitypes.ErrorResponse "WebAuthn is not configured or not supported by the authentication provider"
+// @Router			/user/webauthn/register/begin [post]
+func WebAuthnRegisterBegin(c *gin.Context) {
+	user, ok := mfaEnrollmentUser(c)
+	if !ok {
+		return
+	}
+	options, err := auth.BeginWebAuthnRegistration(user.Username)
+	if errors.Is(err, auth.ErrWebAuthnNotConfigured) {
+		c.JSON(http.StatusNotFound, apitypes.Error("webauthn is not configured", err))
+		return
+	}
+	if err != nil {
+		c.Error(apitypes.InternalServerError(err, "failed to begin webauthn registration"))
+		return
+	}
+	c.JSON(http.StatusOK, options)
+}
+
+// @x-id				"webauthn-register-finish"
+// @BasePath		/api/v1
+// @Summary		Finish WebAuthn registration
+// @Description	Verify the attestation response and register the credential for the current user
+// @Tags			user
+// @Accept			json
+// @Produce		json
+// @Param			request	body	WebAuthnRegisterRequest	true	"Request"
+// @Success		200	{object}	auth.WebAuthnCredentialInfo
+// @Failure		400	{object}	apitypes.ErrorResponse
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Failure		404	{object}	apitypes.ErrorResponse "Second factors are not supported by the authentication provider"
+// @Router			/user/webauthn/register/finish [post]
+func WebAuthnRegisterFinish(c *gin.Context) {
+	var req WebAuthnRegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+	user, ok := mfaEnrollmentUser(c)
+	if !ok {
+		return
+	}
+	info, err := auth.FinishWebAuthnRegistration(user.Username, req.Name, req.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("failed to register credential", err))
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// @x-id				"webauthn-delete"
+// @BasePath		/api/v1
+// @Summary		Delete WebAuthn credential
+// @Description	Delete a passkey or security key of the current user
+// @Tags			user
+// @Accept			json
+// @Produce		json
+// @Param			request	body	WebAuthnDeleteRequest	true	"Request"
+// @Success		200	{object}	apitypes.SuccessResponse
+// @Failure		400	{object}	apitypes.ErrorResponse
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Failure		404	{object}	apitypes.ErrorResponse "Credential not found"
+// @Router			/user/webauthn/delete [post]
+func WebAuthnDelete(c *gin.Context) {
+	var req WebAuthnDeleteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if err := auth.DeleteWebAuthnCredential(user.Username, req.ID); err != nil {
+		c.JSON(http.StatusNotFound, apitypes.Error("credential not found", err))
+		return
+	}
+	c.JSON(http.StatusOK, apitypes.Success("credential deleted"))
+}
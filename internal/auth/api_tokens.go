@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/jsonstore"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// Scope is an API token permission in the form "<area>:<access>", e.g. "docker:write".
+//
+// "write" implies "read" of the same area.
+type Scope string // @name Scope
+
+const (
+	ScopeAccessRead  = "read"
+	ScopeAccessWrite = "write"
+)
+
+// ScopeAreas are the areas that can be granted to API tokens.
+//
+// "proxy" grants access to routes protected by the provider, e.g. with require_auth rules.
+var ScopeAreas = []string{"routes", "file", "homepage", "cert", "agent", "metrics", "docker", "proxmox", "security_reports", "proxy"}
+
+var (
+	ErrInvalidScope    = gperr.New("invalid scope")
+	ErrAPITokenInvalid = gperr.New("invalid api token")
+	ErrAPITokenExpired = gperr.New("api token expired")
+	ErrAPITokenNoScope = gperr.New("api token requires at least one scope")
+	ErrAPITokenNoOwner = gperr.New("api tokens require an authenticated user")
+	ErrAPITokenScope   = gperr.New("api token requires scope")
+)
+
+const (
+	apiTokenPrefix = "gdx_"
+	// minimum interval between persisted last-used updates
+	apiTokenLastUsedResolution = time.Minute
+)
+
+type (
+	// APIToken is a long-lived bearer token for automation.
+	//
+	// Only the SHA-256 hash of the token is stored.
+	APIToken struct {
+		ID    string `json:"id"`
+		Name  string `json:"name"`
+		Owner string `json:"owner"`
+		// the provider that authenticated the owner, e.g. "ldap"
+		Provider string `json:"provider"`
+		// the role of the owner when the token was created
+		Role Role `json:"role" enums:"admin,operator,viewer"`
+		// the groups of the owner when the token was created, for providers with group restrictions
+		Groups     []string  `json:"groups,omitempty"`
+		Scopes     []Scope   `json:"scopes"`
+		TokenHash  string    `json:"token_hash" swaggerignore:"true"`
+		CreatedAt  time.Time `json:"created_at"`
+		ExpiresAt  time.Time `json:"expires_at,omitzero"`
+		LastUsedAt time.Time `json:"last_used_at,omitzero"`
+	} // @name APIToken
+)
+
+var apiTokens = jsonstore.Store[*APIToken](common.NamespaceAPITokens)
+
+func (s Scope) split() (area, access string) {
+	area, access, _ = strings.Cut(string(s), ":")
+	return area, access
+}
+
+func (s Scope) Validate() gperr.Error {
+	area, access := s.split()
+	if !slices.Contains(ScopeAreas, area) || (access != ScopeAccessRead && access != ScopeAccessWrite) {
+		return ErrInvalidScope.Subject(string(s))
+	}
+	return nil
+}
+
+// Grants reports whether s allows required.
+func (s Scope) Grants(required Scope) bool {
+	if s == required {
+		return true
+	}
+	area, access := s.split()
+	reqArea, reqAccess := required.split()
+	return area == reqArea && access == ScopeAccessWrite && reqAccess == ScopeAccessRead
+}
+
+// HasScope reports whether the user is allowed to use required.
+//
+// Session users (not authenticated by an API token) are not restricted by scopes.
+func (u *UserInfo) HasScope(required Scope) bool {
+	if u.TokenID == "" {
+		return true
+	}
+	for _, s := range u.Scopes {
+		if s.Grants(required) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *APIToken) Expired() bool {
+	return !t.ExpiresAt.IsZero() && time.Now().After(t.ExpiresAt)
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ProxyScope returns the scope required for r when it is authenticated by an API token
+// through Provider.CheckToken, i.e. on routes protected by the provider.
+func ProxyScope(r *http.Request) Scope {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return "proxy:" + ScopeAccessRead
+	default:
+		return "proxy:" + ScopeAccessWrite
+	}
+}
+
+// providerName returns the name of the provider recorded in API tokens.
+func providerName(p Provider) string {
+	switch p.(type) {
+	case *UserPassAuth:
+		return "userpass"
+	case *LDAPProvider:
+		return "ldap"
+	case *OIDCProvider:
+		return "oidc"
+	default:
+		return ""
+	}
+}
+
+// CreateAPIToken creates a token owned by the user authenticated by provider and returns the plaintext token.
+//
+// The plaintext token cannot be retrieved afterwards.
+func CreateAPIToken(provider Provider, owner *UserInfo, name string, scopes []Scope, ttl time.Duration) (*APIToken, string, error) {
+	if owner == nil || owner.Username == "" || providerName(provider) == "" {
+		return nil, "", ErrAPITokenNoOwner
+	}
+	if len(scopes) == 0 {
+		return nil, "", ErrAPITokenNoScope
+	}
+	for _, s := range scopes {
+		if err := s.Validate(); err != nil {
+			return nil, "", err
+		}
+	}
+
+	idBytes := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	id := hex.EncodeToString(idBytes)
+	plaintext := apiTokenPrefix + id + "_" + hex.EncodeToString(secret)
+
+	now := time.Now()
+	token := &APIToken{
+		ID:        id,
+		Name:      name,
+		Owner:     owner.Username,
+		Provider:  providerName(provider),
+		Role:      owner.Role,
+		Groups:    slices.Clone(owner.Groups),
+		Scopes:    slices.Clone(scopes),
+		TokenHash: hashAPIToken(plaintext),
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		token.ExpiresAt = now.Add(ttl)
+	}
+	apiTokens.Store(id, token)
+	return token, plaintext, nil
+}
+
+// ListAPITokens returns the tokens owned by owner, or all tokens if owner is empty.
+func ListAPITokens(owner string) []*APIToken {
+	list := make([]*APIToken, 0)
+	for _, t := range apiTokens.Range {
+		if owner == "" || t.Owner == owner {
+			list = append(list, t)
+		}
+	}
+	slices.SortFunc(list, func(a, b *APIToken) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return list
+}
+
+// GetAPIToken returns the token with the given id.
+func GetAPIToken(id string) (*APIToken, bool) {
+	return apiTokens.Load(id)
+}
+
+// RevokeAPIToken deletes the token with the given id.
+func RevokeAPIToken(id string) error {
+	if _, ok := apiTokens.LoadAndDelete(id); !ok {
+		return ErrAPITokenInvalid.Subject(id)
+	}
+	return nil
+}
+
+// bearerAPIToken returns the API token in the Authorization header, if any.
+func bearerAPIToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || !strings.HasPrefix(token, apiTokenPrefix) {
+		return "", false
+	}
+	return token, true
+}
+
+// checkAPIToken validates the plaintext token and returns the owner with the token scopes.
+//
+// The token never has more privileges than its owner had when it was created,
+// or currently has if the provider can look up users.
+func checkAPIToken(ctx context.Context, provider Provider, plaintext string) (*UserInfo, error) {
+	id, _, ok := strings.Cut(strings.TrimPrefix(plaintext, apiTokenPrefix), "_")
+	if !ok {
+		return nil, ErrAPITokenInvalid
+	}
+	token, ok := apiTokens.Load(id)
+	if !ok || subtle.ConstantTimeCompare([]byte(token.TokenHash), []byte(hashAPIToken(plaintext))) != 1 {
+		return nil, ErrAPITokenInvalid
+	}
+	if token.Expired() {
+		return nil, ErrAPITokenExpired.Subject(token.Name)
+	}
+	// the owner is only known to the provider that authenticated it
+	if token.Provider != providerName(provider) {
+		return nil, ErrUserNotAllowed.Subject(token.Owner).Withf("token was created with %s authentication", token.Provider)
+	}
+
+	role := token.Role
+	if lookup, ok := provider.(UserLookup); ok {
+		owner, err := lookup.LookupUser(ctx, token.Owner)
+		switch {
+		case errors.Is(err, ErrUserLookupUnsupported):
+		case err != nil:
+			return nil, ErrUserNotAllowed.Subject(token.Owner).With(err)
+		case !owner.Role.Has(role):
+			role = owner.Role
+		}
+	}
+	if err := role.Validate(); err != nil {
+		return nil, ErrUserNotAllowed.Subject(token.Owner).With(err)
+	}
+
+	if now := time.Now(); now.Sub(token.LastUsedAt) >= apiTokenLastUsedResolution {
+		updated := *token
+		updated.LastUsedAt = now
+		apiTokens.Store(id, &updated)
+	}
+
+	return &UserInfo{
+		Username: token.Owner,
+		Role:     role,
+		Groups:   token.Groups,
+		Scopes:   token.Scopes,
+		TokenID:  token.ID,
+	}, nil
+}
+
+// checkProxyAccess implements Provider.CheckToken for providers implementing UserProvider.
+//
+// CheckToken guards routes rather than the API, so API tokens need the "proxy" scope.
+func checkProxyAccess(provider UserProvider, r *http.Request) error {
+	user, err := provider.CheckUser(r)
+	if err != nil {
+		return err
+	}
+	if scope := ProxyScope(r); !user.HasScope(scope) {
+		return ErrAPITokenScope.Subject(string(scope))
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	expect "github.com/yusing/goutils/testing"
+)
+
+func TestScopeGrants(t *testing.T) {
+	expect.True(t, Scope("docker:write").Grants("docker:read"))
+	expect.True(t, Scope("docker:read").Grants("docker:read"))
+	expect.False(t, Scope("docker:read").Grants("docker:write"))
+	expect.False(t, Scope("docker:write").Grants("file:read"))
+	expect.NoError(t, Scope("file:write").Validate())
+	expect.HasError(t, Scope("user:write").Validate())
+	expect.HasError(t, Scope("docker:admin").Validate())
+}
+
+func TestAPITokens(t *testing.T) {
+	t.Cleanup(users.Clear)
+	t.Cleanup(apiTokens.Clear)
+
+	auth := newMockUserPassAuth()
+	expect.NoError(t, CreateUser("ci", "ci-password", RoleOperator))
+	owner := expect.Must(auth.LookupUser(t.Context(), "ci"))
+
+	_, _, err := CreateAPIToken(auth, owner, "no scopes", nil, 0)
+	expect.ErrorIs(t, ErrAPITokenNoScope, err)
+	_, _, err = CreateAPIToken(auth, owner, "bad scope", []Scope{"user:write"}, 0)
+	expect.ErrorIs(t, ErrInvalidScope, err)
+	_, _, err = CreateAPIToken(auth, &UserInfo{Role: RoleAdmin}, "no owner", []Scope{"routes:read"}, 0)
+	expect.ErrorIs(t, ErrAPITokenNoOwner, err)
+
+	token, secret, err := CreateAPIToken(auth, owner, "deploy", []Scope{"routes:write", "docker:write"}, time.Hour)
+	expect.NoError(t, err)
+	expect.Equal(t, token.Provider, "userpass")
+	expect.Equal(t, len(ListAPITokens("ci")), 1)
+	expect.Equal(t, len(ListAPITokens("someone-else")), 0)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+secret)
+	user, err := auth.CheckUser(req)
+	expect.NoError(t, err)
+	expect.Equal(t, user.Username, "ci")
+	expect.Equal(t, user.Role, RoleOperator)
+	expect.Equal(t, user.TokenID, token.ID)
+	expect.True(t, user.HasScope("docker:read"))
+	expect.True(t, user.HasScope("routes:write"))
+	expect.False(t, user.HasScope("file:write"))
+
+	plaintext, ok := bearerAPIToken(req)
+	expect.True(t, ok)
+	expect.Equal(t, plaintext, secret)
+
+	stored, _ := GetAPIToken(token.ID)
+	expect.False(t, stored.LastUsedAt.IsZero())
+
+	_, err = checkAPIToken(t.Context(), auth, secret+"0")
+	expect.ErrorIs(t, ErrAPITokenInvalid, err)
+
+	// the token follows role changes of the owner, but never exceeds the role at creation
+	role := RoleViewer
+	expect.NoError(t, UpdateUser("ci", &role, nil))
+	user, err = checkAPIToken(t.Context(), auth, secret)
+	expect.NoError(t, err)
+	expect.Equal(t, user.Role, RoleViewer)
+	role = RoleAdmin
+	expect.NoError(t, UpdateUser("ci", &role, nil))
+	user, err = checkAPIToken(t.Context(), auth, secret)
+	expect.NoError(t, err)
+	expect.Equal(t, user.Role, RoleOperator)
+
+	// token is rejected once the owner is deleted
+	expect.NoError(t, DeleteUser("ci"))
+	_, err = checkAPIToken(t.Context(), auth, secret)
+	expect.ErrorIs(t, ErrAPITokenInvalid, err)
+}
+
+func TestAPITokenExpired(t *testing.T) {
+	t.Cleanup(apiTokens.Clear)
+
+	auth := newMockUserPassAuth()
+	owner := expect.Must(auth.LookupUser(t.Context(), auth.username))
+	token, secret, err := CreateAPIToken(auth, owner, "expired", []Scope{"metrics:read"}, time.Hour)
+	expect.NoError(t, err)
+	expired := *token
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	apiTokens.Store(token.ID, &expired)
+
+	_, err = checkAPIToken(t.Context(), auth, secret)
+	expect.ErrorIs(t, ErrAPITokenExpired, err)
+
+	expect.NoError(t, RevokeAPIToken(token.ID))
+	expect.ErrorIs(t, ErrAPITokenInvalid, RevokeAPIToken(token.ID))
+}
+
+func TestAPITokenProxyScope(t *testing.T) {
+	t.Cleanup(apiTokens.Clear)
+
+	auth := newMockUserPassAuth()
+	owner := expect.Must(auth.LookupUser(t.Context(), auth.username))
+	_, apiOnly, err := CreateAPIToken(auth, owner, "api", []Scope{"routes:write"}, 0)
+	expect.NoError(t, err)
+	_, proxyRead, err := CreateAPIToken(auth, owner, "proxy", []Scope{"proxy:read"}, 0)
+	expect.NoError(t, err)
+
+	check := func(method, secret string) error {
+		req := httptest.NewRequest(method, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+secret)
+		return auth.CheckToken(req)
+	}
+	expect.ErrorIs(t, ErrAPITokenScope, check(http.MethodGet, apiOnly))
+	expect.NoError(t, check(http.MethodGet, proxyRead))
+	expect.ErrorIs(t, ErrAPITokenScope, check(http.MethodPost, proxyRead))
+	expect.ErrorIs(t, ErrAPITokenInvalid, check(http.MethodGet, proxyRead+"0"))
+}
+
+func TestAPITokenProviders(t *testing.T) {
+	t.Cleanup(apiTokens.Clear)
+
+	userpass := newMockUserPassAuth()
+	ldapAuth := expect.Must(NewLDAPProvider(LDAPConfig{
+		URL:            "ldap://localhost",
+		UserDNTemplate: "uid={username},ou=people,dc=example,dc=com",
+	}, []byte("abcdefghijklmnopqrstuvwxyz"), time.Hour))
+	oidcAuth := &OIDCProvider{allowedGroups: []string{"ci"}}
+
+	bearer := func(secret string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+secret)
+		return req
+	}
+
+	// without a service account, LDAP tokens keep the role of the owner at creation
+	_, ldapSecret, err := CreateAPIToken(ldapAuth, &UserInfo{Username: "bob", Role: RoleViewer}, "ldap", []Scope{"routes:read"}, 0)
+	expect.NoError(t, err)
+	user, err := ldapAuth.CheckUser(bearer(ldapSecret))
+	expect.NoError(t, err)
+	expect.Equal(t, user.Username, "bob")
+	expect.Equal(t, user.Role, RoleViewer)
+
+	// OIDC tokens are checked against the allowed users and groups
+	_, oidcSecret, err := CreateAPIToken(oidcAuth, &UserInfo{Username: "runner", Role: RoleAdmin, Groups: []string{"ci"}}, "oidc", []Scope{"docker:write"}, 0)
+	expect.NoError(t, err)
+	user, err = oidcAuth.CheckUser(bearer(oidcSecret))
+	expect.NoError(t, err)
+	expect.Equal(t, user.Username, "runner")
+	expect.Equal(t, user.Role, RoleAdmin)
+	restricted := &OIDCProvider{allowedUsers: []string{"someone-else"}}
+	_, err = restricted.CheckUser(bearer(oidcSecret))
+	expect.ErrorIs(t, ErrUserNotAllowed, err)
+
+	// tokens are only accepted by the provider of their owner
+	_, err = userpass.CheckUser(bearer(ldapSecret))
+	expect.ErrorIs(t, ErrUserNotAllowed, err)
+	_, err = ldapAuth.CheckUser(bearer(oidcSecret))
+	expect.ErrorIs(t, ErrUserNotAllowed, err)
+}
+
+func TestSessionUserHasAllScopes(t *testing.T) {
+	user := &UserInfo{Username: "admin", Role: RoleAdmin}
+	expect.True(t, user.HasScope("file:write"))
+}
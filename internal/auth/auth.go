@@ -15,10 +15,13 @@ func Initialize() error {
 	}
 
 	var err error
-	// Initialize OIDC if configured.
-	if common.OIDCIssuerURL != "" {
+	// OIDC takes precedence over LDAP, username/password is the fallback.
+	switch {
+	case common.OIDCIssuerURL != "":
 		defaultAuth, err = NewOIDCProviderFromEnv()
-	} else {
+	case IsLDAPEnabled():
+		defaultAuth, err = NewLDAPProviderFromEnv()
+	default:
 		defaultAuth, err = NewUserPassAuthFromEnv()
 	}
 
@@ -37,6 +40,10 @@ func IsOIDCEnabled() bool {
 	return common.OIDCIssuerURL != ""
 }
 
+func IsLDAPEnabled() bool {
+	return common.LDAPURL != ""
+}
+
 type nextHandler struct{}
 
 var nextHandlerContextKey = nextHandler{}
@@ -50,6 +57,21 @@ func ProceedNext(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// CheckUser validates the request with the default provider and returns the authenticated user.
+//
+// Requests with an API token in the Authorization header are authenticated by the token,
+// scopes are checked by the caller. Providers that do not implement UserProvider
+// grant RoleAdmin to every authenticated user.
+func CheckUser(r *http.Request) (*UserInfo, error) {
+	if up, ok := defaultAuth.(UserProvider); ok {
+		return up.CheckUser(r)
+	}
+	if err := defaultAuth.CheckToken(r); err != nil {
+		return nil, err
+	}
+	return &UserInfo{Role: RoleAdmin}, nil
+}
+
 func AuthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	if defaultAuth == nil {
 		w.WriteHeader(http.StatusServiceUnavailable)
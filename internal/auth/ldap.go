@@ -0,0 +1,482 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yusing/godoxy/internal/common"
+	gperr "github.com/yusing/goutils/errs"
+	httputils "github.com/yusing/goutils/http"
+)
+
+const ldapUsernamePlaceholder = "{username}"
+
+type (
+	// LDAPConfig configures the LDAP provider.
+	//
+	// With BindDN set, the user is looked up with UserFilter under BaseDN using the service account
+	// and then authenticated by binding as the found entry (search-then-bind).
+	// Otherwise UserDNTemplate is used to bind as the user directly.
+	LDAPConfig struct {
+		URL           string
+		StartTLS      bool
+		SkipTLSVerify bool
+		BindDN        string
+		BindPassword  string
+		BaseDN        string
+		UserFilter    string
+		// UserDNTemplate is the DN to bind with when BindDN is empty, e.g. uid={username},ou=people,dc=example,dc=com
+		UserDNTemplate string
+		// RoleFilters map roles to filters evaluated against the user entry, e.g. (memberOf=cn=admins,dc=example,dc=com).
+		// The highest matching role is granted, users matching none are rejected.
+		// If empty, every user matching UserFilter is an admin.
+		RoleFilters map[Role]string
+		PoolSize    int
+		Timeout     time.Duration
+	}
+
+	LDAPProvider struct {
+		cfg      LDAPConfig
+		dial     func() (ldap.Client, error) // replaced in tests
+		idle     chan ldap.Client
+		secret   []byte
+		tokenTTL time.Duration
+	}
+
+	LDAPClaims struct {
+		Username string `json:"username"`
+		Role     Role   `json:"role"`
+		jwt.RegisteredClaims
+	}
+)
+
+var (
+	_ UserProvider = (*LDAPProvider)(nil)
+	_ MFAProvider  = (*LDAPProvider)(nil)
+)
+
+var (
+	ErrLDAPMissingSecret = gperr.New("API_JWT_SECRET is required for LDAP authentication")
+	ErrLDAPInvalidConfig = gperr.New("invalid LDAP configuration")
+)
+
+// roles in the order they are checked
+var ldapRoleOrder = []Role{RoleAdmin, RoleOperator, RoleViewer}
+
+func NewLDAPProvider(cfg LDAPConfig, secret []byte, tokenTTL time.Duration) (*LDAPProvider, error) {
+	if len(secret) == 0 {
+		return nil, ErrLDAPMissingSecret
+	}
+	switch {
+	case cfg.URL == "":
+		return nil, ErrLDAPInvalidConfig.Subject("LDAP_URL").Withf("required")
+	case cfg.BindDN != "" && cfg.BaseDN == "":
+		return nil, ErrLDAPInvalidConfig.Subject("LDAP_BASE_DN").Withf("required for search-then-bind")
+	case cfg.BindDN != "" && !strings.Contains(cfg.UserFilter, ldapUsernamePlaceholder):
+		return nil, ErrLDAPInvalidConfig.Subject("LDAP_USER_FILTER").Withf("must contain %s", ldapUsernamePlaceholder)
+	case cfg.BindDN == "" && !strings.Contains(cfg.UserDNTemplate, ldapUsernamePlaceholder):
+		return nil, ErrLDAPInvalidConfig.Subject("LDAP_USER_DN_TEMPLATE").Withf("must contain %s when LDAP_BIND_DN is not set", ldapUsernamePlaceholder)
+	}
+	if cfg.UserFilter != "" {
+		if _, err := ldap.CompileFilter(strings.ReplaceAll(cfg.UserFilter, ldapUsernamePlaceholder, "x")); err != nil {
+			return nil, ErrLDAPInvalidConfig.Subject("LDAP_USER_FILTER").With(err)
+		}
+	}
+	for role, filter := range cfg.RoleFilters {
+		if _, err := ldap.CompileFilter(filter); err != nil {
+			return nil, ErrLDAPInvalidConfig.Subjectf("LDAP_%s_FILTER", strings.ToUpper(string(role))).With(err)
+		}
+	}
+
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, ErrLDAPInvalidConfig.Subject("LDAP_URL").With(err)
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         u.Hostname(),      // not set by StartTLS
+		InsecureSkipVerify: cfg.SkipTLSVerify, //nolint:gosec
+	}
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = 1
+	}
+	return &LDAPProvider{
+		cfg: cfg,
+		dial: func() (ldap.Client, error) {
+			return dialLDAP(&cfg, tlsConfig)
+		},
+		idle:     make(chan ldap.Client, cfg.PoolSize),
+		secret:   secret,
+		tokenTTL: tokenTTL,
+	}, nil
+}
+
+func dialLDAP(cfg *LDAPConfig, tlsConfig *tls.Config) (ldap.Client, error) {
+	conn, err := ldap.DialURL(cfg.URL,
+		ldap.DialWithTLSConfig(tlsConfig),
+		ldap.DialWithDialer(&net.Dialer{Timeout: cfg.Timeout}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Timeout > 0 {
+		conn.SetTimeout(cfg.Timeout)
+	}
+	if cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("starttls: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// getConn returns an idle connection or dials a new one.
+//
+// The bind state of an idle connection is whatever it was when it was returned, callers bind before use.
+func (auth *LDAPProvider) getConn() (ldap.Client, error) {
+	for {
+		select {
+		case conn := <-auth.idle:
+			if conn.IsClosing() {
+				conn.Close()
+				continue
+			}
+			return conn, nil
+		default:
+			return auth.dial()
+		}
+	}
+}
+
+// putConn returns the connection to the idle pool, closed connections and connections exceeding the pool size are closed.
+func (auth *LDAPProvider) putConn(conn ldap.Client) {
+	if conn.IsClosing() {
+		conn.Close()
+		return
+	}
+	select {
+	case auth.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// NewLDAPProviderFromEnv creates a new LDAPProvider from environment variables.
+func NewLDAPProviderFromEnv() (*LDAPProvider, error) {
+	roleFilters := make(map[Role]string)
+	for role, filter := range map[Role]string{
+		RoleAdmin:    common.LDAPAdminFilter,
+		RoleOperator: common.LDAPOperatorFilter,
+		RoleViewer:   common.LDAPViewerFilter,
+	} {
+		if filter != "" {
+			roleFilters[role] = filter
+		}
+	}
+	return NewLDAPProvider(LDAPConfig{
+		URL:            common.LDAPURL,
+		StartTLS:       common.LDAPStartTLS,
+		SkipTLSVerify:  common.LDAPSkipTLSVerify,
+		BindDN:         common.LDAPBindDN,
+		BindPassword:   common.LDAPBindPassword,
+		BaseDN:         common.LDAPBaseDN,
+		UserFilter:     common.LDAPUserFilter,
+		UserDNTemplate: common.LDAPUserDNTemplate,
+		RoleFilters:    roleFilters,
+		PoolSize:       common.LDAPPoolSize,
+		Timeout:        common.LDAPTimeout,
+	}, common.APIJWTSecret, common.APIJWTTokenTTL)
+}
+
+func (auth *LDAPProvider) TokenCookieName() string {
+	return "godoxy_token"
+}
+
+// Authenticate verifies the credentials against the directory and returns the user with the mapped role.
+func (auth *LDAPProvider) Authenticate(_ context.Context, username, password string) (*UserInfo, error) {
+	if username == "" || strings.TrimSpace(username) != username {
+		return nil, ErrInvalidUsername.Subject(username)
+	}
+	if password == "" {
+		// an empty password would be an unauthenticated bind, which always succeeds
+		return nil, ErrInvalidPassword
+	}
+
+	conn, err := auth.getConn()
+	if err != nil {
+		return nil, err
+	}
+	defer auth.putConn(conn)
+
+	var userDN string
+	if auth.cfg.BindDN != "" {
+		if err := conn.Bind(auth.cfg.BindDN, auth.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("service account bind: %w", err)
+		}
+		userDN, err = auth.findUser(conn, username)
+		if err != nil {
+			return nil, err
+		}
+		if err := conn.Bind(userDN, password); err != nil {
+			return nil, ldapBindError(username, err)
+		}
+		// evaluate role filters with the service account, users may not be allowed to read their groups
+		if err := conn.Bind(auth.cfg.BindDN, auth.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("service account bind: %w", err)
+		}
+	} else {
+		userDN = strings.ReplaceAll(auth.cfg.UserDNTemplate, ldapUsernamePlaceholder, ldap.EscapeDN(username))
+		if err := conn.Bind(userDN, password); err != nil {
+			return nil, ldapBindError(username, err)
+		}
+		if auth.cfg.UserFilter != "" {
+			ok, err := auth.matchEntry(conn, userDN, auth.userFilter(username))
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, ErrUserNotAllowed.Subject(username)
+			}
+		}
+	}
+
+	role, err := auth.mapRole(conn, userDN)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, ErrUserNotAllowed.Subject(username)
+	}
+	return &UserInfo{Username: username, Role: role}, nil
+}
+
+// LookupUser implements UserLookup with the service account.
+//
+// Without LDAP_BIND_DN, users cannot be looked up and API tokens keep the role of the owner at creation.
+func (auth *LDAPProvider) LookupUser(_ context.Context, username string) (*UserInfo, error) {
+	if auth.cfg.BindDN == "" {
+		return nil, ErrUserLookupUnsupported
+	}
+
+	conn, err := auth.getConn()
+	if err != nil {
+		return nil, err
+	}
+	defer auth.putConn(conn)
+
+	if err := conn.Bind(auth.cfg.BindDN, auth.cfg.BindPassword); err != nil {
+		return nil, fmt.Errorf("service account bind: %w", err)
+	}
+	userDN, err := auth.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+	role, err := auth.mapRole(conn, userDN)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, ErrUserNotAllowed.Subject(username)
+	}
+	return &UserInfo{Username: username, Role: role}, nil
+}
+
+func (auth *LDAPProvider) userFilter(username string) string {
+	return strings.ReplaceAll(auth.cfg.UserFilter, ldapUsernamePlaceholder, ldap.EscapeFilter(username))
+}
+
+func (auth *LDAPProvider) findUser(conn ldap.Client, username string) (string, error) {
+	res, err := conn.Search(ldap.NewSearchRequest(
+		auth.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, 0, false, // size limit, time limit, types only
+		auth.userFilter(username),
+		[]string{"1.1"}, // no attributes
+		nil,
+	))
+	switch {
+	case ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded), err == nil && len(res.Entries) > 1:
+		return "", ErrInvalidUsername.Subject(username).Withf("matches multiple entries")
+	case err != nil:
+		return "", err
+	case len(res.Entries) == 0:
+		return "", ErrInvalidUsername.Subject(username)
+	}
+	return res.Entries[0].DN, nil
+}
+
+// matchEntry reports whether the entry at dn matches filter.
+func (auth *LDAPProvider) matchEntry(conn ldap.Client, dn, filter string) (bool, error) {
+	res, err := conn.Search(ldap.NewSearchRequest(
+		dn, ldap.ScopeBaseObject, ldap.NeverDerefAliases,
+		0, 0, false,
+		filter,
+		[]string{"1.1"},
+		nil,
+	))
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return len(res.Entries) > 0, nil
+}
+
+// mapRole returns the highest role whose filter matches the user entry,
+// or an empty role if none does.
+func (auth *LDAPProvider) mapRole(conn ldap.Client, userDN string) (Role, error) {
+	if len(auth.cfg.RoleFilters) == 0 {
+		return RoleAdmin, nil
+	}
+	for _, role := range ldapRoleOrder {
+		filter, ok := auth.cfg.RoleFilters[role]
+		if !ok {
+			continue
+		}
+		matched, err := auth.matchEntry(conn, userDN, filter)
+		if err != nil {
+			return "", err
+		}
+		if matched {
+			return role, nil
+		}
+	}
+	return "", nil
+}
+
+func isCredentialError(err error) bool {
+	return errors.Is(err, ErrInvalidUsername) || errors.Is(err, ErrInvalidPassword) || errors.Is(err, ErrUserNotAllowed)
+}
+
+func ldapBindError(username string, err error) error {
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return ErrInvalidPassword.Subject(username)
+	}
+	return err
+}
+
+func (auth *LDAPProvider) NewToken(user *UserInfo) (token string, err error) {
+	now := time.Now()
+	claims := &LDAPClaims{
+		Username: user.Username,
+		Role:     user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(auth.tokenTTL)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString(auth.secret)
+}
+
+func (auth *LDAPProvider) CheckToken(r *http.Request) error {
+	return checkProxyAccess(auth, r)
+}
+
+// CheckUser implements UserProvider.
+//
+// The role is taken from the session, group changes in the directory apply on the next login.
+func (auth *LDAPProvider) CheckUser(r *http.Request) (*UserInfo, error) {
+	if token, ok := bearerAPIToken(r); ok {
+		return checkAPIToken(r.Context(), auth, token)
+	}
+	jwtCookie, err := r.Cookie(auth.TokenCookieName())
+	if err != nil {
+		return nil, ErrMissingSessionToken
+	}
+	var claims LDAPClaims
+	token, err := jwt.ParseWithClaims(jwtCookie.Value, &claims, func(t *jwt.Token) (any, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return auth.secret, nil
+	}, jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid || claims.Username == "" || slices.Contains(claims.Audience, mfaPendingAudience) {
+		return nil, ErrInvalidSessionToken
+	}
+	if err := claims.Role.Validate(); err != nil {
+		return nil, ErrInvalidSessionToken.With(err)
+	}
+	return &UserInfo{Username: claims.Username, Role: claims.Role}, nil
+}
+
+// PostAuthCallbackHandler accepts the same request as the username/password provider,
+// so the built-in login page works unchanged.
+func (auth *LDAPProvider) PostAuthCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	var creds UserPassAuthCallbackRequest
+	if err := sonic.ConfigDefault.NewDecoder(r.Body).Decode(&creds); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	user, err := auth.Authenticate(r.Context(), creds.User, creds.Pass)
+	if err != nil {
+		if !isCredentialError(err) {
+			// directory unreachable or misconfigured
+			httputils.LogError(r).Msg(fmt.Sprintf("ldap authentication failed: %v", err))
+		}
+		// NOTE: do not include the actual error here
+		http.Error(w, "invalid credentials", http.StatusBadRequest)
+		return
+	}
+	if !verifySecondFactor(w, r, auth.secret, user, creds.TOTP) {
+		return
+	}
+	auth.completeLogin(w, r, user)
+}
+
+func (auth *LDAPProvider) completeLogin(w http.ResponseWriter, r *http.Request, user *UserInfo) {
+	token, err := auth.NewToken(user)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		httputils.LogError(r).Msg(fmt.Sprintf("failed to generate token: %v", err))
+		return
+	}
+	clearPendingLogin(w, r)
+	SetTokenCookie(w, r, auth.TokenCookieName(), token, auth.tokenTTL)
+	w.WriteHeader(http.StatusOK)
+}
+
+// WebAuthnLoginBeginHandler implements MFAProvider.
+func (auth *LDAPProvider) WebAuthnLoginBeginHandler(w http.ResponseWriter, r *http.Request) {
+	webauthnLoginBegin(w, r)
+}
+
+// WebAuthnLoginFinishHandler implements MFAProvider.
+//
+// WebAuthn is a second factor only: the password must have been verified by PostAuthCallbackHandler first,
+// so accounts disabled in the directory cannot log in with a passkey.
+func (auth *LDAPProvider) WebAuthnLoginFinishHandler(w http.ResponseWriter, r *http.Request) {
+	username, _, ok := webauthnLoginFinish(w, r)
+	if !ok {
+		return
+	}
+	pending, ok := passwordVerifiedUser(r, auth.secret)
+	if !ok || pending.Username != username {
+		http.Error(w, "password required", http.StatusUnauthorized)
+		return
+	}
+	auth.completeLogin(w, r, pending)
+}
+
+func (auth *LDAPProvider) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/login", http.StatusFound)
+}
+
+func (auth *LDAPProvider) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	ClearTokenCookie(w, r, auth.TokenCookieName())
+	http.Redirect(w, r, "/", http.StatusFound)
+}
@@ -0,0 +1,391 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	expect "github.com/yusing/goutils/testing"
+)
+
+// fakeLDAP is an in-memory directory, its connections return the errors go-ldap returns for the results of a server.
+type fakeLDAP struct {
+	entries   []*ldap.Entry
+	passwords map[string]string // by dn
+	dials     int
+}
+
+type fakeLDAPConn struct {
+	ldap.Client // methods not used by the provider panic
+	dir         *fakeLDAP
+	closing     bool
+}
+
+func newFakeLDAP() *fakeLDAP {
+	dir := &fakeLDAP{passwords: make(map[string]string)}
+	add := func(dn, password string, attrs map[string][]string) {
+		dir.entries = append(dir.entries, ldap.NewEntry(dn, attrs))
+		dir.passwords[dn] = password
+	}
+	add("uid=godoxy,ou=services,dc=example,dc=com", "service-password", map[string][]string{
+		"objectClass": {"account"},
+		"uid":         {"godoxy"},
+	})
+	add("uid=alice,ou=people,dc=example,dc=com", "alice-password", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"alice"},
+		"memberOf":    {"cn=godoxy-admins,ou=groups,dc=example,dc=com"},
+	})
+	add("uid=bob,ou=people,dc=example,dc=com", "bob-password", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"bob"},
+		"memberOf":    {"cn=godoxy-viewers,ou=groups,dc=example,dc=com"},
+	})
+	add("uid=carol,ou=people,dc=example,dc=com", "carol-password", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"carol"},
+	})
+	return dir
+}
+
+func (dir *fakeLDAP) dial() (ldap.Client, error) {
+	dir.dials++
+	return &fakeLDAPConn{dir: dir}, nil
+}
+
+func (c *fakeLDAPConn) IsClosing() bool { return c.closing }
+
+func (c *fakeLDAPConn) Close() error {
+	c.closing = true
+	return nil
+}
+
+func (c *fakeLDAPConn) Bind(dn, password string) error {
+	if password == "" {
+		return ldap.NewError(ldap.ErrorEmptyPassword, errors.New("ldap: empty password not allowed by the client"))
+	}
+	if pw, ok := c.dir.passwords[dn]; !ok || pw != password {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+	}
+	return nil
+}
+
+func (c *fakeLDAPConn) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	filter, err := ldap.CompileFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	res := &ldap.SearchResult{}
+	found := false
+	for _, entry := range c.dir.entries {
+		switch req.Scope {
+		case ldap.ScopeBaseObject:
+			if !strings.EqualFold(entry.DN, req.BaseDN) {
+				continue
+			}
+			found = true
+		case ldap.ScopeWholeSubtree:
+			if !strings.EqualFold(entry.DN, req.BaseDN) && !strings.HasSuffix(strings.ToLower(entry.DN), ","+strings.ToLower(req.BaseDN)) {
+				continue
+			}
+			found = true
+		}
+		if !matchFakeLDAPFilter(filter, entry) {
+			continue
+		}
+		if req.SizeLimit > 0 && len(res.Entries) == req.SizeLimit {
+			return res, ldap.NewError(ldap.LDAPResultSizeLimitExceeded, errors.New("size limit exceeded"))
+		}
+		res.Entries = append(res.Entries, ldap.NewEntry(entry.DN, nil))
+	}
+	if !found {
+		return nil, ldap.NewError(ldap.LDAPResultNoSuchObject, errors.New("no such object"))
+	}
+	return res, nil
+}
+
+// matchFakeLDAPFilter evaluates the and, or, not, equality and presence filters compiled by ldap.CompileFilter.
+func matchFakeLDAPFilter(filter *ber.Packet, entry *ldap.Entry) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matchFakeLDAPFilter(child, entry) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if matchFakeLDAPFilter(child, entry) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !matchFakeLDAPFilter(filter.Children[0], entry)
+	case ldap.FilterEqualityMatch:
+		attr := filter.Children[0].Data.String()
+		value := filter.Children[1].Data.String()
+		return slices.ContainsFunc(entry.GetAttributeValues(attr), func(v string) bool {
+			return strings.EqualFold(v, value)
+		})
+	case ldap.FilterPresent:
+		return len(entry.GetAttributeValues(filter.Data.String())) > 0
+	}
+	return false
+}
+
+var ldapTestRoleFilters = map[Role]string{
+	RoleAdmin:  "(memberOf=cn=godoxy-admins,ou=groups,dc=example,dc=com)",
+	RoleViewer: "(memberOf=cn=godoxy-viewers,ou=groups,dc=example,dc=com)",
+}
+
+func newTestLDAPProvider(t *testing.T, dir *fakeLDAP, cfg LDAPConfig) *LDAPProvider {
+	t.Helper()
+	cfg.URL = "ldap://ldap.example.com"
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(&(objectClass=person)(uid={username}))"
+	}
+	auth := expect.Must(NewLDAPProvider(cfg, []byte("abcdefghijklmnopqrstuvwxyz"), time.Hour))
+	auth.dial = dir.dial
+	return auth
+}
+
+func TestLDAPSearchThenBind(t *testing.T) {
+	dir := newFakeLDAP()
+	auth := newTestLDAPProvider(t, dir, LDAPConfig{
+		BindDN:       "uid=godoxy,ou=services,dc=example,dc=com",
+		BindPassword: "service-password",
+		BaseDN:       "dc=example,dc=com",
+		RoleFilters:  ldapTestRoleFilters,
+	})
+
+	user, err := auth.Authenticate(t.Context(), "alice", "alice-password")
+	expect.NoError(t, err)
+	expect.Equal(t, user.Username, "alice")
+	expect.Equal(t, user.Role, RoleAdmin)
+
+	user, err = auth.Authenticate(t.Context(), "bob", "bob-password")
+	expect.NoError(t, err)
+	expect.Equal(t, user.Role, RoleViewer)
+
+	_, err = auth.Authenticate(t.Context(), "carol", "carol-password")
+	expect.ErrorIs(t, ErrUserNotAllowed, err)
+
+	_, err = auth.Authenticate(t.Context(), "alice", "wrong-password")
+	expect.ErrorIs(t, ErrInvalidPassword, err)
+	_, err = auth.Authenticate(t.Context(), "alice", "")
+	expect.ErrorIs(t, ErrInvalidPassword, err)
+	_, err = auth.Authenticate(t.Context(), "mallory", "password")
+	expect.ErrorIs(t, ErrInvalidUsername, err)
+	// filter injection
+	_, err = auth.Authenticate(t.Context(), "*", "alice-password")
+	expect.ErrorIs(t, ErrInvalidUsername, err)
+	// the service account is not a person
+	_, err = auth.Authenticate(t.Context(), "godoxy", "service-password")
+	expect.ErrorIs(t, ErrInvalidUsername, err)
+
+	// connections are reused
+	expect.Equal(t, dir.dials, 1)
+}
+
+func TestLDAPClosedConnNotReused(t *testing.T) {
+	dir := newFakeLDAP()
+	auth := newTestLDAPProvider(t, dir, LDAPConfig{
+		UserDNTemplate: "uid={username},ou=people,dc=example,dc=com",
+	})
+
+	_, err := auth.Authenticate(t.Context(), "carol", "carol-password")
+	expect.NoError(t, err)
+	expect.Equal(t, dir.dials, 1)
+
+	// the server closed the idle connection
+	conn := <-auth.idle
+	conn.Close()
+	auth.idle <- conn
+
+	_, err = auth.Authenticate(t.Context(), "carol", "carol-password")
+	expect.NoError(t, err)
+	expect.Equal(t, dir.dials, 2)
+}
+
+func TestLDAPLookupUser(t *testing.T) {
+	t.Cleanup(apiTokens.Clear)
+
+	dir := newFakeLDAP()
+	auth := newTestLDAPProvider(t, dir, LDAPConfig{
+		BindDN:       "uid=godoxy,ou=services,dc=example,dc=com",
+		BindPassword: "service-password",
+		BaseDN:       "ou=people,dc=example,dc=com",
+		RoleFilters:  ldapTestRoleFilters,
+	})
+
+	user, err := auth.LookupUser(t.Context(), "alice")
+	expect.NoError(t, err)
+	expect.Equal(t, user.Role, RoleAdmin)
+	_, err = auth.LookupUser(t.Context(), "carol")
+	expect.ErrorIs(t, ErrUserNotAllowed, err)
+
+	// API tokens are limited to the current role of the owner
+	_, secret, err := CreateAPIToken(auth, &UserInfo{Username: "bob", Role: RoleOperator}, "bob", []Scope{"routes:read"}, 0)
+	expect.NoError(t, err)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+secret)
+	user, err = auth.CheckUser(req)
+	expect.NoError(t, err)
+	expect.Equal(t, user.Role, RoleViewer)
+
+	_, secret, err = CreateAPIToken(auth, &UserInfo{Username: "carol", Role: RoleAdmin}, "carol", []Scope{"routes:read"}, 0)
+	expect.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+secret)
+	_, err = auth.CheckUser(req)
+	expect.ErrorIs(t, ErrUserNotAllowed, err)
+}
+
+func TestLDAPDirectBind(t *testing.T) {
+	dir := newFakeLDAP()
+	auth := newTestLDAPProvider(t, dir, LDAPConfig{
+		UserDNTemplate: "uid={username},ou=people,dc=example,dc=com",
+	})
+
+	user, err := auth.Authenticate(t.Context(), "carol", "carol-password")
+	expect.NoError(t, err)
+	expect.Equal(t, user.Role, RoleAdmin) // no role filters
+
+	_, err = auth.Authenticate(t.Context(), "carol", "alice-password")
+	expect.ErrorIs(t, ErrInvalidPassword, err)
+	_, err = auth.Authenticate(t.Context(), "alice,ou=people", "alice-password")
+	expect.ErrorIs(t, ErrInvalidPassword, err)
+}
+
+func TestLDAPConfigValidation(t *testing.T) {
+	secret := []byte("abcdefghijklmnopqrstuvwxyz")
+	_, err := NewLDAPProvider(LDAPConfig{URL: "ldap://localhost"}, nil, time.Hour)
+	expect.ErrorIs(t, ErrLDAPMissingSecret, err)
+	_, err = NewLDAPProvider(LDAPConfig{URL: "ldap://localhost"}, secret, time.Hour)
+	expect.ErrorIs(t, ErrLDAPInvalidConfig, err)
+	_, err = NewLDAPProvider(LDAPConfig{URL: "ldap://localhost", BindDN: "cn=svc", BaseDN: "dc=example", UserFilter: "(uid=alice)"}, secret, time.Hour)
+	expect.ErrorIs(t, ErrLDAPInvalidConfig, err)
+	_, err = NewLDAPProvider(LDAPConfig{
+		URL:            "ldap://localhost",
+		UserDNTemplate: "uid={username},dc=example",
+		RoleFilters:    map[Role]string{RoleAdmin: "(memberOf=cn=admins"},
+	}, secret, time.Hour)
+	expect.ErrorIs(t, ErrLDAPInvalidConfig, err)
+}
+
+func TestLDAPLogin(t *testing.T) {
+	dir := newFakeLDAP()
+	auth := newTestLDAPProvider(t, dir, LDAPConfig{
+		BindDN:       "uid=godoxy,ou=services,dc=example,dc=com",
+		BindPassword: "service-password",
+		BaseDN:       "ou=people,dc=example,dc=com",
+		RoleFilters:  ldapTestRoleFilters,
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/callback", strings.NewReader(`{"username":"bob","password":"wrong"}`))
+	auth.PostAuthCallbackHandler(w, req)
+	expect.Equal(t, w.Code, http.StatusBadRequest)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/auth/callback", strings.NewReader(`{"username":"bob","password":"bob-password"}`))
+	auth.PostAuthCallbackHandler(w, req)
+	expect.Equal(t, w.Code, http.StatusOK)
+
+	cookie := expect.Must(http.ParseSetCookie(w.Header().Get("Set-Cookie")))
+	expect.Equal(t, cookie.Name, auth.TokenCookieName())
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	user, err := auth.CheckUser(req)
+	expect.NoError(t, err)
+	expect.Equal(t, user.Username, "bob")
+	expect.Equal(t, user.Role, RoleViewer)
+
+	// sessions signed with another secret are rejected
+	other := newTestLDAPProvider(t, dir, LDAPConfig{UserDNTemplate: "uid={username},ou=people,dc=example,dc=com"})
+	other.secret = []byte("another-secret")
+	expect.HasError(t, other.CheckToken(req))
+
+	w = httptest.NewRecorder()
+	auth.LoginHandler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	expect.Equal(t, w.Code, http.StatusFound)
+	expect.Equal(t, w.Header().Get("Location"), "/login")
+}
+
+func TestLDAPLoginRequiresSecondFactor(t *testing.T) {
+	t.Cleanup(mfaConfigs.Clear)
+	t.Cleanup(func() { clear(mfaAttempts) })
+
+	dir := newFakeLDAP()
+	auth := newTestLDAPProvider(t, dir, LDAPConfig{
+		BindDN:       "uid=godoxy,ou=services,dc=example,dc=com",
+		BindPassword: "service-password",
+		BaseDN:       "ou=people,dc=example,dc=com",
+		RoleFilters:  ldapTestRoleFilters,
+	})
+
+	secret, _, err := BeginTOTPEnrollment("bob")
+	expect.NoError(t, err)
+	now := time.Now().Unix() / totpPeriod
+	_, err = ConfirmTOTPEnrollment("bob", totpCodeAt(t, secret, now))
+	expect.NoError(t, err)
+
+	login := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		auth.PostAuthCallbackHandler(w, httptest.NewRequest(http.MethodPost, "/api/v1/auth/callback", strings.NewReader(body)))
+		return w
+	}
+
+	// the password alone does not issue a session
+	w := login(`{"username":"bob","password":"bob-password"}`)
+	expect.Equal(t, w.Code, http.StatusUnauthorized)
+	var resp SecondFactorRequiredResponse
+	expect.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	expect.Equal(t, resp.Methods, []string{MFAMethodTOTP})
+
+	// the pending cookie must not be accepted as a session
+	pending := expect.Must(http.ParseSetCookie(w.Header().Get("Set-Cookie")))
+	expect.Equal(t, pending.Name, mfaPendingCookieName)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: auth.TokenCookieName(), Value: pending.Value})
+	_, err = auth.CheckUser(req)
+	expect.HasError(t, err)
+
+	// the pending cookie alone does not complete the login
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/auth/webauthn/login/finish", strings.NewReader(`{}`))
+	req.AddCookie(pending)
+	auth.WebAuthnLoginFinishHandler(w, req)
+	expect.Equal(t, w.Code, http.StatusBadRequest)
+
+	w = login(`{"username":"bob","password":"bob-password","totp":"000000"}`)
+	if totpCodeAt(t, secret, now+1) != "000000" {
+		expect.Equal(t, w.Code, http.StatusBadRequest)
+	}
+
+	// a wrong password is rejected before the second factor
+	w = login(fmt.Sprintf(`{"username":"bob","password":"wrong","totp":%q}`, totpCodeAt(t, secret, now+1)))
+	expect.Equal(t, w.Code, http.StatusBadRequest)
+
+	w = login(fmt.Sprintf(`{"username":"bob","password":"bob-password","totp":%q}`, totpCodeAt(t, secret, now+1)))
+	expect.Equal(t, w.Code, http.StatusOK)
+	cookie := expect.Must(http.ParseSetCookie(w.Header().Get("Set-Cookie")))
+	expect.Equal(t, cookie.Name, auth.TokenCookieName())
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	user, err := auth.CheckUser(req)
+	expect.NoError(t, err)
+	expect.Equal(t, user.Username, "bob")
+	expect.Equal(t, user.Role, RoleViewer)
+}
@@ -0,0 +1,263 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/jsonstore"
+	gperr "github.com/yusing/goutils/errs"
+	"golang.org/x/time/rate"
+)
+
+const (
+	MFAMethodTOTP     = "totp"
+	MFAMethodWebAuthn = "webauthn"
+)
+
+const (
+	totpPeriod        = 30 // seconds
+	totpSecretSize    = 20 // bytes
+	totpSkew          = 1  // accepted steps before and after the current one
+	totpIssuer        = "GoDoxy"
+	recoveryCodeCount = 10
+
+	mfaMaxAttempts   = 5           // failed attempts allowed in a row
+	mfaAttemptPeriod = time.Minute // one failed attempt is regained per period
+)
+
+var totpOpts = hotp.ValidateOpts{
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+var (
+	ErrTOTPAlreadyEnabled = gperr.New("totp is already enabled")
+	ErrTOTPNotEnrolling   = gperr.New("totp enrollment not started")
+	ErrTOTPNotEnabled     = gperr.New("totp is not enabled")
+	ErrInvalidMFACode     = gperr.New("invalid second factor code")
+	ErrTooManyMFAAttempts = gperr.New("too many second factor attempts, try again later")
+)
+
+type (
+	// MFAConfig holds the second factors of a user.
+	MFAConfig struct {
+		TOTPSecret        string               `json:"totp_secret,omitempty"` // base32
+		PendingTOTPSecret string               `json:"pending_totp_secret,omitempty"`
+		LastTOTPStep      int64                `json:"last_totp_step,omitempty"` // prevents code reuse
+		RecoveryCodes     []string             `json:"recovery_codes,omitempty"` // sha256 hex of unused codes
+		WebAuthn          []WebAuthnCredential `json:"webauthn,omitempty"`
+	}
+)
+
+var (
+	mfaConfigs = jsonstore.Store[*MFAConfig](common.NamespaceMFA)
+	mfaMu      sync.Mutex
+
+	mfaAttempts = make(map[string]*rate.Limiter) // failed attempts per user, guarded by mfaMu
+)
+
+// MFAMethods returns the second factor methods enabled for the user.
+func MFAMethods(username string) []string {
+	cfg, ok := mfaConfigs.Load(username)
+	if !ok {
+		return nil
+	}
+	var methods []string
+	if cfg.TOTPSecret != "" {
+		methods = append(methods, MFAMethodTOTP)
+	}
+	if len(cfg.WebAuthn) > 0 {
+		methods = append(methods, MFAMethodWebAuthn)
+	}
+	return methods
+}
+
+// updateMFAConfig applies fn to a copy of the user's MFA config and stores it if fn succeeds.
+func updateMFAConfig(username string, fn func(cfg *MFAConfig) error) error {
+	mfaMu.Lock()
+	defer mfaMu.Unlock()
+
+	var cfg MFAConfig
+	if old, ok := mfaConfigs.Load(username); ok {
+		cfg = *old
+		cfg.RecoveryCodes = append([]string(nil), old.RecoveryCodes...)
+		cfg.WebAuthn = append([]WebAuthnCredential(nil), old.WebAuthn...)
+	}
+	if err := fn(&cfg); err != nil {
+		return err
+	}
+	if cfg.TOTPSecret == "" && cfg.PendingTOTPSecret == "" && len(cfg.WebAuthn) == 0 {
+		mfaConfigs.Delete(username)
+	} else {
+		mfaConfigs.Store(username, &cfg)
+	}
+	return nil
+}
+
+// BeginTOTPEnrollment generates a new TOTP secret for the user.
+//
+// The secret is activated by ConfirmTOTPEnrollment.
+func BeginTOTPEnrollment(username string) (secret, otpauthURL string, err error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: username,
+		Period:      totpPeriod,
+		SecretSize:  totpSecretSize,
+		Digits:      totpOpts.Digits,
+		Algorithm:   totpOpts.Algorithm,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	secret = key.Secret()
+	err = updateMFAConfig(username, func(cfg *MFAConfig) error {
+		if cfg.TOTPSecret != "" {
+			return ErrTOTPAlreadyEnabled
+		}
+		cfg.PendingTOTPSecret = secret
+		return nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return secret, key.URL(), nil
+}
+
+// ConfirmTOTPEnrollment activates the pending TOTP secret if code is valid and returns new recovery codes.
+func ConfirmTOTPEnrollment(username, code string) (recoveryCodes []string, err error) {
+	err = updateMFAConfig(username, func(cfg *MFAConfig) error {
+		if cfg.PendingTOTPSecret == "" {
+			return ErrTOTPNotEnrolling
+		}
+		if !mfaAttemptAllowed(username) {
+			return ErrTooManyMFAAttempts
+		}
+		step, ok := validateTOTP(cfg.PendingTOTPSecret, code, time.Now())
+		if !ok {
+			mfaAttemptFailed(username)
+			return ErrInvalidMFACode
+		}
+		codes, hashes, err := newRecoveryCodes()
+		if err != nil {
+			return err
+		}
+		cfg.TOTPSecret = cfg.PendingTOTPSecret
+		cfg.PendingTOTPSecret = ""
+		cfg.LastTOTPStep = step
+		cfg.RecoveryCodes = hashes
+		recoveryCodes = codes
+		return nil
+	})
+	return recoveryCodes, err
+}
+
+// DisableTOTP disables TOTP for the user after verifying a TOTP or recovery code.
+func DisableTOTP(username, code string) error {
+	if err := VerifyTOTP(username, code); err != nil {
+		return err
+	}
+	return updateMFAConfig(username, func(cfg *MFAConfig) error {
+		cfg.TOTPSecret = ""
+		cfg.PendingTOTPSecret = ""
+		cfg.LastTOTPStep = 0
+		cfg.RecoveryCodes = nil
+		return nil
+	})
+}
+
+// VerifyTOTP verifies a TOTP code or consumes a recovery code of the user.
+//
+// After mfaMaxAttempts failed attempts, ErrTooManyMFAAttempts is returned until
+// an attempt is regained.
+func VerifyTOTP(username, code string) error {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	return updateMFAConfig(username, func(cfg *MFAConfig) error {
+		if cfg.TOTPSecret == "" {
+			return ErrTOTPNotEnabled
+		}
+		if !mfaAttemptAllowed(username) {
+			return ErrTooManyMFAAttempts
+		}
+		if step, ok := validateTOTP(cfg.TOTPSecret, code, time.Now()); ok {
+			if step <= cfg.LastTOTPStep {
+				mfaAttemptFailed(username)
+				return ErrInvalidMFACode
+			}
+			cfg.LastTOTPStep = step
+			return nil
+		}
+		hash := hashRecoveryCode(code)
+		for i, h := range cfg.RecoveryCodes {
+			if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+				cfg.RecoveryCodes = append(cfg.RecoveryCodes[:i], cfg.RecoveryCodes[i+1:]...)
+				return nil
+			}
+		}
+		mfaAttemptFailed(username)
+		return ErrInvalidMFACode
+	})
+}
+
+// deleteMFAConfig removes all second factors of the user.
+func deleteMFAConfig(username string) {
+	mfaMu.Lock()
+	defer mfaMu.Unlock()
+	mfaConfigs.Delete(username)
+	delete(mfaAttempts, username)
+}
+
+// mfaAttemptAllowed reports whether the user has failed attempts left. mfaMu must be held.
+func mfaAttemptAllowed(username string) bool {
+	lim, ok := mfaAttempts[username]
+	return !ok || lim.Tokens() >= 1
+}
+
+// mfaAttemptFailed records a failed attempt of the user. mfaMu must be held.
+func mfaAttemptFailed(username string) {
+	lim, ok := mfaAttempts[username]
+	if !ok {
+		lim = rate.NewLimiter(rate.Every(mfaAttemptPeriod), mfaMaxAttempts)
+		mfaAttempts[username] = lim
+	}
+	lim.Allow()
+}
+
+// validateTOTP returns the matched time step if code is valid at t.
+func validateTOTP(secret, code string, t time.Time) (step int64, ok bool) {
+	current := t.Unix() / totpPeriod
+	for s := current - totpSkew; s <= current+totpSkew; s++ {
+		if ok, _ := hotp.ValidateCustom(code, uint64(s), secret, totpOpts); ok {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	codes = make([]string, recoveryCodeCount)
+	hashes = make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		s := hex.EncodeToString(b)
+		codes[i] = s[:5] + "-" + s[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ReplaceAll(strings.ToLower(code), "-", "")))
+	return hex.EncodeToString(sum[:])
+}
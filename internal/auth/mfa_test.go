@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/hotp"
+	expect "github.com/yusing/goutils/testing"
+)
+
+func totpCodeAt(t *testing.T, secret string, step int64) string {
+	t.Helper()
+	return expect.Must(hotp.GenerateCodeCustom(secret, uint64(step), totpOpts))
+}
+
+func TestValidateTOTP(t *testing.T) {
+	// RFC 6238 appendix B (SHA1), truncated to 6 digits
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	tests := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for ts, code := range tests {
+		step, ok := validateTOTP(secret, code, time.Unix(ts, 0))
+		expect.True(t, ok)
+		expect.Equal(t, step, ts/totpPeriod)
+	}
+	_, ok := validateTOTP(secret, "28708", time.Unix(59, 0))
+	expect.False(t, ok)
+}
+
+func TestTOTPEnrollment(t *testing.T) {
+	t.Cleanup(mfaConfigs.Clear)
+	t.Cleanup(func() { clear(mfaAttempts) })
+
+	secret, url, err := BeginTOTPEnrollment("alice")
+	expect.NoError(t, err)
+	expect.True(t, len(url) > 0)
+	expect.Equal(t, len(MFAMethods("alice")), 0)
+
+	now := time.Now().Unix() / totpPeriod
+
+	_, err = ConfirmTOTPEnrollment("alice", "000000")
+	if totpCodeAt(t, secret, now) != "000000" {
+		expect.ErrorIs(t, ErrInvalidMFACode, err)
+	}
+	codes, err := ConfirmTOTPEnrollment("alice", totpCodeAt(t, secret, now))
+	expect.NoError(t, err)
+	expect.Equal(t, len(codes), recoveryCodeCount)
+	expect.Equal(t, MFAMethods("alice"), []string{MFAMethodTOTP})
+
+	_, _, err = BeginTOTPEnrollment("alice")
+	expect.ErrorIs(t, ErrTOTPAlreadyEnabled, err)
+
+	// the code used for enrollment cannot be reused
+	expect.ErrorIs(t, ErrInvalidMFACode, VerifyTOTP("alice", totpCodeAt(t, secret, now)))
+	expect.NoError(t, VerifyTOTP("alice", totpCodeAt(t, secret, now+1)))
+
+	// recovery codes are single use
+	expect.NoError(t, VerifyTOTP("alice", codes[0]))
+	expect.ErrorIs(t, ErrInvalidMFACode, VerifyTOTP("alice", codes[0]))
+
+	expect.NoError(t, DisableTOTP("alice", codes[1]))
+	expect.Equal(t, len(MFAMethods("alice")), 0)
+	expect.ErrorIs(t, ErrTOTPNotEnabled, VerifyTOTP("alice", codes[2]))
+}
+
+func TestTOTPAttemptLimit(t *testing.T) {
+	t.Cleanup(mfaConfigs.Clear)
+	t.Cleanup(func() { clear(mfaAttempts) })
+
+	secret, _, err := BeginTOTPEnrollment("alice")
+	expect.NoError(t, err)
+	now := time.Now().Unix() / totpPeriod
+	codes, err := ConfirmTOTPEnrollment("alice", totpCodeAt(t, secret, now))
+	expect.NoError(t, err)
+
+	for range mfaMaxAttempts {
+		expect.ErrorIs(t, ErrInvalidMFACode, VerifyTOTP("alice", "invalid"))
+	}
+	// valid codes are rejected too until an attempt is regained
+	expect.ErrorIs(t, ErrTooManyMFAAttempts, VerifyTOTP("alice", totpCodeAt(t, secret, now+1)))
+	expect.ErrorIs(t, ErrTooManyMFAAttempts, VerifyTOTP("alice", codes[0]))
+
+	// other users are not affected
+	_, _, err = BeginTOTPEnrollment("bob")
+	expect.NoError(t, err)
+	_, err = ConfirmTOTPEnrollment("bob", "invalid")
+	expect.ErrorIs(t, ErrInvalidMFACode, err)
+}
+
+func TestDeleteUserClearsMFA(t *testing.T) {
+	t.Cleanup(users.Clear)
+	t.Cleanup(mfaConfigs.Clear)
+	t.Cleanup(func() { clear(mfaAttempts) })
+
+	expect.NoError(t, CreateUser("alice", "alice-password", RoleViewer))
+	secret, _, err := BeginTOTPEnrollment("alice")
+	expect.NoError(t, err)
+	_, err = ConfirmTOTPEnrollment("alice", totpCodeAt(t, secret, time.Now().Unix()/totpPeriod))
+	expect.NoError(t, err)
+	expect.ErrorIs(t, ErrInvalidMFACode, VerifyTOTP("alice", "invalid"))
+
+	expect.NoError(t, DeleteUser("alice"))
+	expect.NoError(t, CreateUser("alice", "alice-password", RoleViewer))
+	expect.Equal(t, len(MFAMethods("alice")), 0)
+	_, ok := mfaAttempts["alice"]
+	expect.False(t, ok)
+}
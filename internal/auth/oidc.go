@@ -43,7 +43,7 @@ type (
 	}
 )
 
-var _ Provider = (*OIDCProvider)(nil)
+var _ UserProvider = (*OIDCProvider)(nil)
 
 // Cookie names for OIDC authentication
 const (
@@ -294,25 +294,50 @@ func (auth *OIDCProvider) checkAllowed(user string, groups []string) bool {
 }
 
 func (auth *OIDCProvider) CheckToken(r *http.Request) error {
+	return checkProxyAccess(auth, r)
+}
+
+// CheckUser implements UserProvider, every allowed user is an admin.
+//
+// API tokens are checked against the allowed users and groups of the provider
+// with the groups of the owner when the token was created.
+func (auth *OIDCProvider) CheckUser(r *http.Request) (*UserInfo, error) {
+	if token, ok := bearerAPIToken(r); ok {
+		user, err := checkAPIToken(r.Context(), auth, token)
+		if err != nil {
+			return nil, err
+		}
+		if !auth.checkAllowed(user.Username, user.Groups) {
+			return nil, ErrUserNotAllowed.Subject(user.Username)
+		}
+		return user, nil
+	}
+
 	tokenCookie, err := r.Cookie(auth.getAppScopedCookieName(CookieOauthToken))
 	if err != nil {
-		return ErrMissingOAuthToken
+		return nil, ErrMissingOAuthToken
 	}
 
 	idToken, err := auth.oidcVerifier.Verify(r.Context(), tokenCookie.Value)
 	if err != nil {
-		return fmt.Errorf("%w: %w", ErrInvalidOAuthToken, err)
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOAuthToken, err)
 	}
 
 	claims, err := parseClaims(idToken)
 	if err != nil {
-		return fmt.Errorf("%w: %w", ErrInvalidOAuthToken, err)
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOAuthToken, err)
 	}
 
 	if !auth.checkAllowed(claims.Username, claims.Groups) {
-		return ErrUserNotAllowed
+		return nil, ErrUserNotAllowed
+	}
+
+	// the username is optional if groups are present
+	username := claims.Username
+	if username == "" {
+		username = idToken.Subject
 	}
-	return nil
+	return &UserInfo{Username: username, Role: RoleAdmin, Groups: claims.Groups}, nil
 }
 
 func (auth *OIDCProvider) PostAuthCallbackHandler(w http.ResponseWriter, r *http.Request) {
@@ -1,6 +1,11 @@
 package auth
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+
+	gperr "github.com/yusing/goutils/errs"
+)
 
 type Provider interface {
 	CheckToken(r *http.Request) error
@@ -8,3 +13,27 @@ type Provider interface {
 	PostAuthCallbackHandler(w http.ResponseWriter, r *http.Request)
 	LogoutHandler(w http.ResponseWriter, r *http.Request)
 }
+
+// UserProvider is implemented by providers that know the identity and role of the authenticated user.
+type UserProvider interface {
+	Provider
+	// CheckUser is like CheckToken but also returns the authenticated user.
+	CheckUser(r *http.Request) (*UserInfo, error)
+}
+
+// MFAProvider is implemented by providers that enforce the second factors enrolled by their users (TOTP / WebAuthn).
+// Users of other providers cannot enroll second factors.
+type MFAProvider interface {
+	Provider
+	WebAuthnLoginBeginHandler(w http.ResponseWriter, r *http.Request)
+	WebAuthnLoginFinishHandler(w http.ResponseWriter, r *http.Request)
+}
+
+// UserLookup is implemented by providers that can resolve the current role of a user without a session,
+// so API tokens are limited to the current role of their owners.
+type UserLookup interface {
+	// LookupUser returns ErrUserLookupUnsupported if the provider is not configured for lookups.
+	LookupUser(ctx context.Context, username string) (*UserInfo, error)
+}
+
+var ErrUserLookupUnsupported = gperr.New("user lookup is not supported")
@@ -1,8 +1,12 @@
 package auth
 
 import (
+	"context"
+	"crypto/rand"
 	"fmt"
 	"net/http"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/bytedance/sonic"
@@ -32,7 +36,10 @@ type (
 	}
 )
 
-var _ Provider = (*UserPassAuth)(nil)
+var (
+	_ UserProvider = (*UserPassAuth)(nil)
+	_ MFAProvider  = (*UserPassAuth)(nil)
+)
 
 func NewUserPassAuth(username, password string, secret []byte, tokenTTL time.Duration) (*UserPassAuth, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -60,11 +67,13 @@ func (auth *UserPassAuth) TokenCookieName() string {
 	return "godoxy_token"
 }
 
-func (auth *UserPassAuth) NewToken() (token string, err error) {
+func (auth *UserPassAuth) NewToken(username string) (token string, err error) {
+	now := time.Now()
 	claim := &UserPassClaims{
-		Username: auth.username,
+		Username: username,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(auth.tokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(auth.tokenTTL)),
 		},
 	}
 	tok := jwt.NewWithClaims(jwt.SigningMethodHS512, claim)
@@ -76,9 +85,17 @@ func (auth *UserPassAuth) NewToken() (token string, err error) {
 }
 
 func (auth *UserPassAuth) CheckToken(r *http.Request) error {
+	return checkProxyAccess(auth, r)
+}
+
+// CheckUser implements UserProvider.
+func (auth *UserPassAuth) CheckUser(r *http.Request) (*UserInfo, error) {
+	if token, ok := bearerAPIToken(r); ok {
+		return checkAPIToken(r.Context(), auth, token)
+	}
 	jwtCookie, err := r.Cookie(auth.TokenCookieName())
 	if err != nil {
-		return ErrMissingSessionToken
+		return nil, ErrMissingSessionToken
 	}
 	var claims UserPassClaims
 	token, err := jwt.ParseWithClaims(jwtCookie.Value, &claims, func(t *jwt.Token) (interface{}, error) {
@@ -88,23 +105,46 @@ func (auth *UserPassAuth) CheckToken(r *http.Request) error {
 		return auth.secret, nil
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 	switch {
-	case !token.Valid:
-		return ErrInvalidSessionToken
-	case claims.Username != auth.username:
-		return ErrUserNotAllowed.Subject(claims.Username)
+	case !token.Valid, slices.Contains(claims.Audience, mfaPendingAudience):
+		return nil, ErrInvalidSessionToken
 	case claims.ExpiresAt.Before(time.Now()):
-		return gperr.Errorf("token expired on %s", strutils.FormatTime(claims.ExpiresAt.Time))
+		return nil, gperr.Errorf("token expired on %s", strutils.FormatTime(claims.ExpiresAt.Time))
 	}
 
-	return nil
+	if claims.Username == auth.username {
+		return &UserInfo{Username: auth.username, Role: RoleAdmin, Builtin: true}, nil
+	}
+
+	user, ok := GetUser(claims.Username)
+	if !ok {
+		return nil, ErrUserNotAllowed.Subject(claims.Username)
+	}
+	// reject sessions issued before the last password change
+	if claims.IssuedAt == nil || claims.IssuedAt.Before(user.PasswordChangedAt.Truncate(time.Second)) {
+		return nil, ErrInvalidSessionToken.Subject(claims.Username)
+	}
+	return user.Info(), nil
+}
+
+// LookupUser implements UserLookup.
+func (auth *UserPassAuth) LookupUser(_ context.Context, username string) (*UserInfo, error) {
+	if username == auth.username {
+		return &UserInfo{Username: auth.username, Role: RoleAdmin, Builtin: true}, nil
+	}
+	user, ok := GetUser(username)
+	if !ok {
+		return nil, ErrUserNotAllowed.Subject(username)
+	}
+	return user.Info(), nil
 }
 
 type UserPassAuthCallbackRequest struct {
 	User string `json:"username"`
 	Pass string `json:"password"`
+	TOTP string `json:"totp,omitempty"` // TOTP or recovery code, required if TOTP is enabled
 }
 
 func (auth *UserPassAuth) PostAuthCallbackHandler(w http.ResponseWriter, r *http.Request) {
@@ -119,12 +159,20 @@ func (auth *UserPassAuth) PostAuthCallbackHandler(w http.ResponseWriter, r *http
 		http.Error(w, "invalid credentials", http.StatusBadRequest)
 		return
 	}
-	token, err := auth.NewToken()
+	if !verifySecondFactor(w, r, auth.secret, &UserInfo{Username: creds.User}, creds.TOTP) {
+		return
+	}
+	auth.completeLogin(w, r, creds.User)
+}
+
+func (auth *UserPassAuth) completeLogin(w http.ResponseWriter, r *http.Request, username string) {
+	token, err := auth.NewToken(username)
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		httputils.LogError(r).Msg(fmt.Sprintf("failed to generate token: %v", err))
 		return
 	}
+	clearPendingLogin(w, r)
 	SetTokenCookie(w, r, auth.TokenCookieName(), token, auth.tokenTTL)
 	w.WriteHeader(http.StatusOK)
 }
@@ -138,12 +186,25 @@ func (auth *UserPassAuth) LogoutHandler(w http.ResponseWriter, r *http.Request)
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
+// dummyPasswordHash is compared against for unknown users,
+// so the response time does not tell whether a username exists.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte(rand.Text()), bcrypt.DefaultCost)
+	return hash
+})
+
 func (auth *UserPassAuth) validatePassword(user, pass string) error {
+	pwdHash := auth.pwdHash
 	if user != auth.username {
-		return ErrInvalidUsername.Subject(user)
+		stored, ok := GetUser(user)
+		if !ok {
+			_ = bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(pass))
+			return ErrInvalidUsername.Subject(user)
+		}
+		pwdHash = stored.PasswordHash
 	}
-	if err := bcrypt.CompareHashAndPassword(auth.pwdHash, []byte(pass)); err != nil {
-		return ErrInvalidPassword.With(err).Subject(pass)
+	if err := bcrypt.CompareHashAndPassword(pwdHash, []byte(pass)); err != nil {
+		return ErrInvalidPassword.With(err).Subject(user)
 	}
 	return nil
 }
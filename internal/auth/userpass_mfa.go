@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/golang-jwt/jwt/v5"
+	httputils "github.com/yusing/goutils/http"
+)
+
+const (
+	mfaPendingCookieName = "godoxy_mfa"
+	mfaPendingAudience   = "godoxy-mfa"
+	mfaPendingTTL        = 5 * time.Minute
+
+	webauthnMaxResponseSize = 64 * 1024 // of the PublicKeyCredential JSON
+)
+
+type (
+	// SecondFactorRequiredResponse is returned with 401 when the password is valid
+	// but a second factor is required to complete the login.
+	SecondFactorRequiredResponse struct {
+		Error   string   `json:"error"`
+		Methods []string `json:"methods" enums:"totp,webauthn"`
+	} // @name SecondFactorRequiredResponse
+
+	WebAuthnLoginBeginRequest struct {
+		Username string `json:"username,omitempty"` // empty for passkey (usernameless) login
+	} // @name WebAuthnLoginBeginRequest
+)
+
+// mfaPendingClaims are the claims of the mfaPendingCookieName cookie.
+type mfaPendingClaims struct {
+	Username string `json:"username"`
+	Role     Role   `json:"role,omitempty"` // the role of LDAP users, looked up with the password
+	jwt.RegisteredClaims
+}
+
+// requireSecondFactor sets a short-lived cookie proving that the password of the user was verified
+// and responds with the available second factor methods.
+func requireSecondFactor(w http.ResponseWriter, r *http.Request, secret []byte, user *UserInfo, methods []string) {
+	now := time.Now()
+	claims := &mfaPendingClaims{
+		Username: user.Username,
+		Role:     user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{mfaPendingAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(mfaPendingTTL)),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString(secret)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		httputils.LogError(r).Msg(fmt.Sprintf("failed to generate token: %v", err))
+		return
+	}
+	SetTokenCookie(w, r, mfaPendingCookieName, token, mfaPendingTTL)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	_ = sonic.ConfigDefault.NewEncoder(w).Encode(SecondFactorRequiredResponse{
+		Error:   "second factor required",
+		Methods: methods,
+	})
+}
+
+// verifySecondFactor checks the TOTP or recovery code of the login request if TOTP is enabled,
+// otherwise it responds with requireSecondFactor. It returns true if the login can be completed.
+func verifySecondFactor(w http.ResponseWriter, r *http.Request, secret []byte, user *UserInfo, code string) bool {
+	methods := MFAMethods(user.Username)
+	if len(methods) == 0 {
+		return true
+	}
+	if code == "" || !slices.Contains(methods, MFAMethodTOTP) {
+		requireSecondFactor(w, r, secret, user, methods)
+		return false
+	}
+	if err := VerifyTOTP(user.Username, code); err != nil {
+		if errors.Is(err, ErrTooManyMFAAttempts) {
+			http.Error(w, "too many attempts", http.StatusTooManyRequests)
+			return false
+		}
+		http.Error(w, "invalid credentials", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// clearPendingLogin removes the cookie set by requireSecondFactor, if any.
+func clearPendingLogin(w http.ResponseWriter, r *http.Request) {
+	if _, err := r.Cookie(mfaPendingCookieName); err == nil {
+		ClearTokenCookie(w, r, mfaPendingCookieName)
+	}
+}
+
+// passwordVerifiedUser returns the user whose password was verified by the pending login, if any.
+func passwordVerifiedUser(r *http.Request, secret []byte) (*UserInfo, bool) {
+	cookie, err := r.Cookie(mfaPendingCookieName)
+	if err != nil {
+		return nil, false
+	}
+	var claims mfaPendingClaims
+	token, err := jwt.ParseWithClaims(cookie.Value, &claims, func(t *jwt.Token) (any, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return secret, nil
+	}, jwt.WithAudience(mfaPendingAudience), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return nil, false
+	}
+	return &UserInfo{Username: claims.Username, Role: claims.Role}, true
+}
+
+func (auth *UserPassAuth) userExists(username string) bool {
+	if username == auth.username {
+		return true
+	}
+	_, ok := GetUser(username)
+	return ok
+}
+
+// webauthnLoginBegin responds with the options for navigator.credentials.get().
+func webauthnLoginBegin(w http.ResponseWriter, r *http.Request) {
+	var req WebAuthnLoginBeginRequest
+	if r.ContentLength != 0 {
+		if err := sonic.ConfigDefault.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+	}
+	options, err := BeginWebAuthnLogin(req.Username)
+	if errors.Is(err, ErrWebAuthnNotConfigured) {
+		http.Error(w, "webauthn is not configured", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		httputils.LogError(r).Msg(fmt.Sprintf("failed to begin webauthn login: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = sonic.ConfigDefault.NewEncoder(w).Encode(options)
+}
+
+// webauthnLoginFinish verifies the WebAuthn assertion of the request.
+// It responds with an error and returns false if the assertion is invalid.
+func webauthnLoginFinish(w http.ResponseWriter, r *http.Request) (username string, userVerified bool, ok bool) {
+	credential, err := io.ReadAll(http.MaxBytesReader(w, r.Body, webauthnMaxResponseSize))
+	if err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return "", false, false
+	}
+	username, userVerified, err = FinishWebAuthnLogin(credential)
+	if err != nil {
+		// NOTE: do not include the actual error here
+		http.Error(w, "invalid credentials", http.StatusBadRequest)
+		return "", false, false
+	}
+	return username, userVerified, true
+}
+
+// WebAuthnLoginBeginHandler implements MFAProvider.
+func (auth *UserPassAuth) WebAuthnLoginBeginHandler(w http.ResponseWriter, r *http.Request) {
+	webauthnLoginBegin(w, r)
+}
+
+// WebAuthnLoginFinishHandler implements MFAProvider.
+//
+// Assertions with user verification (PIN / biometrics) log in without a password,
+// otherwise the password must have been verified by PostAuthCallbackHandler first.
+func (auth *UserPassAuth) WebAuthnLoginFinishHandler(w http.ResponseWriter, r *http.Request) {
+	username, userVerified, ok := webauthnLoginFinish(w, r)
+	if !ok {
+		return
+	}
+	if !auth.userExists(username) {
+		http.Error(w, "invalid credentials", http.StatusBadRequest)
+		return
+	}
+	if !userVerified {
+		if pending, ok := passwordVerifiedUser(r, auth.secret); !ok || pending.Username != username {
+			http.Error(w, "password required", http.StatusUnauthorized)
+			return
+		}
+	}
+	auth.completeLogin(w, r, username)
+}
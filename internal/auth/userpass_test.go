@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -28,13 +29,14 @@ func TestUserPassValidateCredentials(t *testing.T) {
 	expect.NoError(t, err)
 	err = auth.validatePassword("username", "wrong-password")
 	expect.ErrorIs(t, ErrInvalidPassword, err)
+	expect.False(t, strings.Contains(err.Error(), "wrong-password"), "the password should not be in the error")
 	err = auth.validatePassword("wrong-username", "password")
 	expect.ErrorIs(t, ErrInvalidUsername, err)
 }
 
 func TestUserPassCheckToken(t *testing.T) {
 	auth := newMockUserPassAuth()
-	token, err := auth.NewToken()
+	token, err := auth.NewToken("username")
 	expect.NoError(t, err)
 	tests := []struct {
 		token   string
@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/jsonstore"
+	gperr "github.com/yusing/goutils/errs"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Role string // @name Role
+
+const (
+	RoleViewer   Role = "viewer"   // read-only access to routes, metrics and logs
+	RoleOperator Role = "operator" // viewer + reload, start/stop/restart, homepage edits
+	RoleAdmin    Role = "admin"    // operator + config files, agents and user management
+)
+
+var (
+	ErrInvalidRole     = gperr.New("invalid role")
+	ErrUserExists      = gperr.New("user already exists")
+	ErrUserNotFound    = gperr.New("user not found")
+	ErrBuiltinUser     = gperr.New("the built-in user cannot be modified through the API")
+	ErrPasswordTooWeak = gperr.New("password must be at least 8 characters")
+)
+
+const minPasswordLength = 8
+
+type (
+	// User is a persisted user account for the username/password provider.
+	User struct {
+		Username          string    `json:"username"`
+		PasswordHash      []byte    `json:"password_hash"`
+		Role              Role      `json:"role"`
+		CreatedAt         time.Time `json:"created_at"`
+		PasswordChangedAt time.Time `json:"password_changed_at"`
+	}
+	// UserInfo is the public view of an authenticated or stored user.
+	UserInfo struct {
+		Username string    `json:"username"`
+		Role     Role      `json:"role" enums:"admin,operator,viewer"`
+		Builtin  bool      `json:"builtin,omitempty"`
+		Created  time.Time `json:"created,omitzero"`
+		// set by providers with groups, e.g. OIDC
+		Groups []string `json:"groups,omitempty"`
+		// set when authenticated by an API token
+		TokenID string  `json:"token_id,omitempty"`
+		Scopes  []Scope `json:"scopes,omitempty"`
+	} // @name UserInfo
+)
+
+var (
+	users   = jsonstore.Store[*User](common.NamespaceUsers)
+	usersMu sync.Mutex
+)
+
+func (r Role) level() int {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleOperator:
+		return 2
+	case RoleAdmin:
+		return 3
+	default:
+		return 0
+	}
+}
+
+func (r Role) Validate() gperr.Error {
+	if r.level() == 0 {
+		return ErrInvalidRole.Subject(string(r))
+	}
+	return nil
+}
+
+// Has reports whether r grants at least the permissions of required.
+func (r Role) Has(required Role) bool {
+	return r.level() >= required.level()
+}
+
+func (u *User) Info() *UserInfo {
+	return &UserInfo{
+		Username: u.Username,
+		Role:     u.Role,
+		Created:  u.CreatedAt,
+	}
+}
+
+type userContextKey struct{}
+
+// WithUser returns a copy of ctx carrying the authenticated user.
+func WithUser(ctx context.Context, user *UserInfo) context.Context {
+	return context.WithValue(ctx, userContextKey{}, user)
+}
+
+// UserFromContext returns the authenticated user stored by WithUser.
+func UserFromContext(ctx context.Context) (*UserInfo, bool) {
+	user, ok := ctx.Value(userContextKey{}).(*UserInfo)
+	return user, ok && user != nil
+}
+
+func isBuiltinUser(username string) bool {
+	return username == common.APIUser
+}
+
+func validateUsername(username string) gperr.Error {
+	if username == "" || strings.ContainsAny(username, ": \t\r\n") {
+		return ErrInvalidUsername.Subject(username)
+	}
+	return nil
+}
+
+func hashPassword(password string) ([]byte, error) {
+	if len(password) < minPasswordLength {
+		return nil, ErrPasswordTooWeak
+	}
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
+// ListUsers returns all users sorted by username, including the built-in user from the environment.
+func ListUsers() []*UserInfo {
+	list := make([]*UserInfo, 0, users.Size()+1)
+	if common.APIUser != "" {
+		list = append(list, &UserInfo{Username: common.APIUser, Role: RoleAdmin, Builtin: true})
+	}
+	for _, u := range users.Range {
+		list = append(list, u.Info())
+	}
+	slices.SortFunc(list, func(a, b *UserInfo) int {
+		return strings.Compare(a.Username, b.Username)
+	})
+	return list
+}
+
+// GetUser returns the stored user with the given username.
+func GetUser(username string) (*User, bool) {
+	return users.Load(username)
+}
+
+// CreateUser adds a new user to the store.
+func CreateUser(username, password string, role Role) error {
+	if err := validateUsername(username); err != nil {
+		return err
+	}
+	if err := role.Validate(); err != nil {
+		return err
+	}
+	if isBuiltinUser(username) {
+		return ErrUserExists.Subject(username)
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if _, loaded := users.LoadOrStore(username, &User{
+		Username:          username,
+		PasswordHash:      hash,
+		Role:              role,
+		CreatedAt:         now,
+		PasswordChangedAt: now,
+	}); loaded {
+		return ErrUserExists.Subject(username)
+	}
+	return nil
+}
+
+// UpdateUser changes the role and/or password of a stored user.
+//
+// Changing the password invalidates existing sessions of the user.
+func UpdateUser(username string, role *Role, password *string) error {
+	if isBuiltinUser(username) {
+		return ErrBuiltinUser.Subject(username)
+	}
+	if role != nil {
+		if err := role.Validate(); err != nil {
+			return err
+		}
+	}
+	var hash []byte
+	if password != nil {
+		var err error
+		hash, err = hashPassword(*password)
+		if err != nil {
+			return err
+		}
+	}
+
+	return modifyUser(username, func(user *User) error {
+		if role != nil {
+			user.Role = *role
+		}
+		if hash != nil {
+			user.PasswordHash = hash
+			user.PasswordChangedAt = time.Now()
+		}
+		return nil
+	})
+}
+
+// ChangePassword changes the password of a stored user after verifying the current one.
+func ChangePassword(username, currentPassword, newPassword string) error {
+	if isBuiltinUser(username) {
+		return ErrBuiltinUser.Subject(username)
+	}
+	hash, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	return modifyUser(username, func(user *User) error {
+		if err := bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(currentPassword)); err != nil {
+			return ErrInvalidPassword
+		}
+		user.PasswordHash = hash
+		user.PasswordChangedAt = time.Now()
+		return nil
+	})
+}
+
+// modifyUser applies modify to a copy of the stored user and stores the result.
+//
+// The read-modify-write is done under usersMu, so concurrent updates are not lost.
+func modifyUser(username string, modify func(user *User) error) error {
+	usersMu.Lock()
+	defer usersMu.Unlock()
+
+	old, ok := users.Load(username)
+	if !ok {
+		return ErrUserNotFound.Subject(username)
+	}
+	updated := *old
+	if err := modify(&updated); err != nil {
+		return err
+	}
+	users.Store(username, &updated)
+	return nil
+}
+
+// DeleteUser removes a stored user. Existing sessions of the user are rejected afterwards.
+func DeleteUser(username string) error {
+	if isBuiltinUser(username) {
+		return ErrBuiltinUser.Subject(username)
+	}
+
+	usersMu.Lock()
+	_, ok := users.LoadAndDelete(username)
+	usersMu.Unlock()
+	if !ok {
+		return ErrUserNotFound.Subject(username)
+	}
+	deleteMFAConfig(username)
+	for _, token := range ListAPITokens(username) {
+		_ = RevokeAPIToken(token.ID)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	expect "github.com/yusing/goutils/testing"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRoleHas(t *testing.T) {
+	expect.True(t, RoleAdmin.Has(RoleOperator))
+	expect.True(t, RoleOperator.Has(RoleViewer))
+	expect.True(t, RoleViewer.Has(RoleViewer))
+	expect.False(t, RoleViewer.Has(RoleOperator))
+	expect.False(t, Role("unknown").Has(RoleViewer))
+	expect.HasError(t, Role("root").Validate())
+}
+
+func TestUserStore(t *testing.T) {
+	t.Cleanup(users.Clear)
+
+	expect.NoError(t, CreateUser("alice", "alice-password", RoleViewer))
+	expect.ErrorIs(t, ErrUserExists, CreateUser("alice", "another-password", RoleAdmin))
+	expect.ErrorIs(t, ErrPasswordTooWeak, CreateUser("bob", "short", RoleViewer))
+	expect.ErrorIs(t, ErrInvalidRole, CreateUser("bob", "bob-password", Role("root")))
+	expect.ErrorIs(t, ErrInvalidUsername, CreateUser("bob:x", "bob-password", RoleViewer))
+
+	role := RoleOperator
+	expect.NoError(t, UpdateUser("alice", &role, nil))
+	user, ok := GetUser("alice")
+	expect.True(t, ok)
+	expect.Equal(t, user.Role, RoleOperator)
+
+	expect.ErrorIs(t, ErrInvalidPassword, ChangePassword("alice", "wrong-password", "new-password"))
+	expect.NoError(t, ChangePassword("alice", "alice-password", "new-password"))
+
+	expect.ErrorIs(t, ErrUserNotFound, DeleteUser("bob"))
+	expect.NoError(t, DeleteUser("alice"))
+	_, ok = GetUser("alice")
+	expect.False(t, ok)
+}
+
+func TestUserConcurrentUpdates(t *testing.T) {
+	t.Cleanup(users.Clear)
+
+	expect.NoError(t, CreateUser("alice", "alice-password", RoleViewer))
+
+	var wg sync.WaitGroup
+	role := RoleOperator
+	wg.Go(func() {
+		expect.NoError(t, ChangePassword("alice", "alice-password", "new-password"))
+	})
+	wg.Go(func() {
+		expect.NoError(t, UpdateUser("alice", &role, nil))
+	})
+	wg.Wait()
+
+	// neither update is lost
+	user, ok := GetUser("alice")
+	expect.True(t, ok)
+	expect.Equal(t, user.Role, RoleOperator)
+	expect.NoError(t, bcrypt.CompareHashAndPassword(user.PasswordHash, []byte("new-password")))
+}
+
+func TestUserPassMultiUser(t *testing.T) {
+	t.Cleanup(users.Clear)
+
+	auth := newMockUserPassAuth()
+	expect.NoError(t, CreateUser("viewer", "viewer-password", RoleViewer))
+
+	expect.NoError(t, auth.validatePassword("viewer", "viewer-password"))
+	expect.ErrorIs(t, ErrInvalidPassword, auth.validatePassword("viewer", "password"))
+
+	check := func(username string) (*UserInfo, error) {
+		token, err := auth.NewToken(username)
+		expect.NoError(t, err)
+		req := &http.Request{Header: http.Header{}}
+		req.Header.Set("Cookie", auth.TokenCookieName()+"="+token)
+		return auth.CheckUser(req)
+	}
+
+	user, err := check("username")
+	expect.NoError(t, err)
+	expect.Equal(t, user.Role, RoleAdmin)
+
+	user, err = check("viewer")
+	expect.NoError(t, err)
+	expect.Equal(t, user.Username, "viewer")
+	expect.Equal(t, user.Role, RoleViewer)
+
+	_, err = check("nobody")
+	expect.ErrorIs(t, ErrUserNotAllowed, err)
+
+	// sessions issued before a password change are rejected
+	stored, _ := GetUser("viewer")
+	changed := *stored
+	changed.PasswordChangedAt = time.Now().Add(time.Hour)
+	users.Store("viewer", &changed)
+	_, err = check("viewer")
+	expect.ErrorIs(t, ErrInvalidSessionToken, err)
+}
@@ -0,0 +1,328 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/base64"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/yusing/godoxy/internal/common"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// WebAuthn relying party backed by github.com/go-webauthn/webauthn.
+//
+// The relying party ID is configured by GODOXY_WEBAUTHN_RP_ID, WebAuthn is disabled without it.
+// Attestation statements are not required, which is sufficient for authenticating users of a self-hosted dashboard.
+
+const (
+	webauthnTimeout = 2 * time.Minute
+	webauthnRPName  = "GoDoxy"
+)
+
+var (
+	ErrWebAuthnNotConfigured = gperr.New("webauthn is not configured, set GODOXY_WEBAUTHN_RP_ID")
+	ErrWebAuthnChallenge     = gperr.New("webauthn challenge not found or expired")
+	ErrWebAuthnInvalid       = gperr.New("invalid webauthn response")
+	ErrWebAuthnNoCredential  = gperr.New("webauthn credential not found")
+)
+
+type (
+	// WebAuthnCredential is a registered passkey / security key.
+	WebAuthnCredential struct {
+		webauthn.Credential
+		Name      string    `json:"name"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	// WebAuthnCredentialInfo is the public view of a WebAuthnCredential.
+	WebAuthnCredentialInfo struct {
+		ID        string    `json:"id"` // base64url
+		Name      string    `json:"name"`
+		CreatedAt time.Time `json:"created_at"`
+	} // @name WebAuthnCredentialInfo
+
+	webauthnSession struct {
+		username string // empty for discoverable (usernameless) login
+		create   bool
+		data     *webauthn.SessionData
+	}
+
+	// webauthnUser is the webauthn.User of a username, the user handle is the username.
+	webauthnUser struct {
+		name        string
+		credentials []WebAuthnCredential
+	}
+)
+
+var (
+	webauthnSessions = xsync.NewMap[string, *webauthnSession]() // by challenge
+
+	// webauthnRP returns the relying party, replaced in tests.
+	webauthnRP = sync.OnceValues(func() (*webauthn.WebAuthn, error) {
+		return newWebAuthnRP(common.WebAuthnRPID, common.WebAuthnRPOrigins)
+	})
+)
+
+// newWebAuthnRP returns the relying party of rpID, origins default to https://<rpID>.
+func newWebAuthnRP(rpID string, origins []string) (*webauthn.WebAuthn, error) {
+	if rpID == "" {
+		return nil, ErrWebAuthnNotConfigured
+	}
+	if len(origins) == 0 {
+		origins = []string{"https://" + rpID}
+	}
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: webauthnTimeout, TimeoutUVD: webauthnTimeout}
+	rp, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: webauthnRPName,
+		RPOrigins:     origins,
+		Timeouts:      webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+	if err != nil {
+		return nil, gperr.Wrap(err, "invalid webauthn config")
+	}
+	return rp, nil
+}
+
+func (u *webauthnUser) WebAuthnID() []byte          { return []byte(u.name) }
+func (u *webauthnUser) WebAuthnName() string        { return u.name }
+func (u *webauthnUser) WebAuthnDisplayName() string { return u.name }
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	creds := make([]webauthn.Credential, len(u.credentials))
+	for i := range u.credentials {
+		creds[i] = u.credentials[i].Credential
+	}
+	return creds
+}
+
+func loadWebAuthnUser(username string) *webauthnUser {
+	user := &webauthnUser{name: username}
+	if cfg, ok := mfaConfigs.Load(username); ok {
+		user.credentials = cfg.WebAuthn
+	}
+	return user
+}
+
+func b64url(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeB64URL(s string) ([]byte, error) {
+	s = strings.TrimRight(s, "=")
+	s = strings.NewReplacer("+", "-", "/", "_").Replace(s)
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+func (c *WebAuthnCredential) Info() WebAuthnCredentialInfo {
+	return WebAuthnCredentialInfo{ID: b64url(c.ID), Name: c.Name, CreatedAt: c.CreatedAt}
+}
+
+// storeWebAuthnSession stores the session by its challenge and prunes the expired ones.
+func storeWebAuthnSession(s *webauthnSession) {
+	now := time.Now()
+	webauthnSessions.DeleteMatching(func(_ string, s *webauthnSession) (bool, bool) {
+		return now.After(s.data.Expires), false
+	})
+	webauthnSessions.Store(s.data.Challenge, s)
+}
+
+// loadWebAuthnSession consumes the session of the challenge.
+func loadWebAuthnSession(challenge string, create bool) (*webauthnSession, error) {
+	session, ok := webauthnSessions.LoadAndDelete(challenge)
+	if !ok || session.create != create || time.Now().After(session.data.Expires) {
+		return nil, ErrWebAuthnChallenge
+	}
+	return session, nil
+}
+
+// ListWebAuthnCredentials returns the WebAuthn credentials registered by the user.
+func ListWebAuthnCredentials(username string) []WebAuthnCredentialInfo {
+	cfg, ok := mfaConfigs.Load(username)
+	if !ok {
+		return []WebAuthnCredentialInfo{}
+	}
+	list := make([]WebAuthnCredentialInfo, len(cfg.WebAuthn))
+	for i := range cfg.WebAuthn {
+		list[i] = cfg.WebAuthn[i].Info()
+	}
+	return list
+}
+
+// DeleteWebAuthnCredential removes a WebAuthn credential of the user.
+func DeleteWebAuthnCredential(username, id string) error {
+	rawID, err := decodeB64URL(id)
+	if err != nil {
+		return ErrWebAuthnNoCredential.Subject(id)
+	}
+	return updateMFAConfig(username, func(cfg *MFAConfig) error {
+		i := slices.IndexFunc(cfg.WebAuthn, func(c WebAuthnCredential) bool {
+			return bytes.Equal(c.ID, rawID)
+		})
+		if i < 0 {
+			return ErrWebAuthnNoCredential.Subject(id)
+		}
+		cfg.WebAuthn = slices.Delete(cfg.WebAuthn, i, i+1)
+		return nil
+	})
+}
+
+// BeginWebAuthnRegistration returns the PublicKeyCredentialCreationOptions for navigator.credentials.create().
+func BeginWebAuthnRegistration(username string) (*protocol.CredentialCreation, error) {
+	rp, err := webauthnRP()
+	if err != nil {
+		return nil, err
+	}
+	user := loadWebAuthnUser(username)
+	options, data, err := rp.BeginRegistration(user,
+		webauthn.WithExclusions(webauthn.Credentials(user.WebAuthnCredentials()).CredentialDescriptors()),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		}),
+		webauthn.WithConveyancePreference(protocol.PreferNoAttestation),
+	)
+	if err != nil {
+		return nil, err
+	}
+	storeWebAuthnSession(&webauthnSession{username: username, create: true, data: data})
+	return options, nil
+}
+
+// FinishWebAuthnRegistration verifies the attestation response (the PublicKeyCredential JSON)
+// and stores the new credential.
+func FinishWebAuthnRegistration(username, name string, credential []byte) (*WebAuthnCredentialInfo, error) {
+	rp, err := webauthnRP()
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(credential)
+	if err != nil {
+		return nil, ErrWebAuthnInvalid.With(err)
+	}
+	session, err := loadWebAuthnSession(parsed.Response.CollectedClientData.Challenge, true)
+	if err != nil {
+		return nil, err
+	}
+	if session.username != username {
+		return nil, ErrWebAuthnChallenge
+	}
+
+	if name == "" {
+		name = "Passkey"
+	}
+	var cred WebAuthnCredential
+	err = updateMFAConfig(username, func(cfg *MFAConfig) error {
+		created, err := rp.CreateCredential(&webauthnUser{name: username, credentials: cfg.WebAuthn}, *session.data, parsed)
+		if err != nil {
+			return ErrWebAuthnInvalid.With(err)
+		}
+		for _, c := range cfg.WebAuthn {
+			if bytes.Equal(c.ID, created.ID) {
+				return ErrWebAuthnInvalid.Subject("credential already registered")
+			}
+		}
+		cred = WebAuthnCredential{Credential: *created, Name: name, CreatedAt: time.Now()}
+		cfg.WebAuthn = append(cfg.WebAuthn, cred)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	info := cred.Info()
+	return &info, nil
+}
+
+// BeginWebAuthnLogin returns the PublicKeyCredentialRequestOptions for navigator.credentials.get().
+//
+// If username is empty, any discoverable credential (passkey) is accepted.
+func BeginWebAuthnLogin(username string) (*protocol.CredentialAssertion, error) {
+	rp, err := webauthnRP()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		options *protocol.CredentialAssertion
+		data    *webauthn.SessionData
+	)
+	user := loadWebAuthnUser(username)
+	if username != "" && len(user.credentials) > 0 {
+		options, data, err = rp.BeginLogin(user, webauthn.WithUserVerification(protocol.VerificationPreferred))
+	} else {
+		// users without credentials get the same options as passkey logins,
+		// so the response does not tell whether the user exists.
+		options, data, err = rp.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationPreferred))
+	}
+	if err != nil {
+		return nil, err
+	}
+	storeWebAuthnSession(&webauthnSession{username: username, data: data})
+	return options, nil
+}
+
+// FinishWebAuthnLogin verifies the assertion response (the PublicKeyCredential JSON).
+//
+// It returns the authenticated username and whether the authenticator verified the user
+// (PIN / biometrics), which allows passwordless login.
+func FinishWebAuthnLogin(credential []byte) (username string, userVerified bool, err error) {
+	rp, err := webauthnRP()
+	if err != nil {
+		return "", false, err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(credential)
+	if err != nil {
+		return "", false, ErrWebAuthnInvalid.With(err)
+	}
+	session, err := loadWebAuthnSession(parsed.Response.CollectedClientData.Challenge, false)
+	if err != nil {
+		return "", false, err
+	}
+
+	username = session.username
+	if username == "" {
+		username = string(parsed.Response.UserHandle)
+		if username == "" {
+			return "", false, ErrWebAuthnInvalid.Subject("userHandle")
+		}
+	}
+
+	err = updateMFAConfig(username, func(cfg *MFAConfig) error {
+		user := &webauthnUser{name: username, credentials: cfg.WebAuthn}
+		var (
+			validated *webauthn.Credential
+			err       error
+		)
+		if len(session.data.UserID) == 0 {
+			_, validated, err = rp.ValidatePasskeyLogin(func(_, _ []byte) (webauthn.User, error) {
+				return user, nil
+			}, *session.data, parsed)
+		} else {
+			validated, err = rp.ValidateLogin(user, *session.data, parsed)
+		}
+		if err != nil {
+			return ErrWebAuthnInvalid.With(err)
+		}
+		// a non-increasing counter indicates a cloned authenticator
+		if validated.Authenticator.CloneWarning {
+			return ErrWebAuthnInvalid.Subject("signature counter did not increase")
+		}
+		i := slices.IndexFunc(cfg.WebAuthn, func(c WebAuthnCredential) bool {
+			return bytes.Equal(c.ID, validated.ID)
+		})
+		if i < 0 {
+			return ErrWebAuthnNoCredential
+		}
+		cfg.WebAuthn[i].Credential = *validated
+		return nil
+	})
+	if err != nil {
+		return "", false, err
+	}
+	return username, parsed.Response.AuthenticatorData.Flags.HasUserVerified(), nil
+}
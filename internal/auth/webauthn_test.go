@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	expect "github.com/yusing/goutils/testing"
+)
+
+const (
+	testRPID   = "app.example.com"
+	testOrigin = "https://app.example.com"
+)
+
+// useTestWebAuthnRP configures the relying party of testRPID for the test.
+func useTestWebAuthnRP(t *testing.T) {
+	t.Helper()
+	rp := expect.Must(newWebAuthnRP(testRPID, nil))
+	old := webauthnRP
+	webauthnRP = func() (*webauthn.WebAuthn, error) { return rp, nil }
+	t.Cleanup(func() { webauthnRP = old })
+}
+
+type fakeAuthenticator struct {
+	key       *ecdsa.PrivateKey
+	credID    []byte
+	signCount uint32
+}
+
+func newFakeAuthenticator(t *testing.T) *fakeAuthenticator {
+	t.Helper()
+	return &fakeAuthenticator{
+		key:    expect.Must(ecdsa.GenerateKey(elliptic.P256(), rand.Reader)),
+		credID: []byte("test-credential-id"),
+	}
+}
+
+func (a *fakeAuthenticator) coseKey(t *testing.T) []byte {
+	t.Helper()
+	return expect.Must(webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	}))
+}
+
+func (a *fakeAuthenticator) authData(t *testing.T, rpID string, flags protocol.AuthenticatorFlags, attested bool) []byte {
+	t.Helper()
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append([]byte{}, rpIDHash[:]...)
+	if attested {
+		flags |= protocol.FlagAttestedCredentialData
+	}
+	data = append(data, byte(flags))
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		data = append(data, make([]byte, 16)...) // aaguid
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credID)))
+		data = append(data, a.credID...)
+		data = append(data, a.coseKey(t)...)
+	}
+	return data
+}
+
+func clientDataJSON(typ string, challenge protocol.URLEncodedBase64, origin string) []byte {
+	return expect.Must(json.Marshal(map[string]string{"type": typ, "challenge": challenge.String(), "origin": origin}))
+}
+
+// publicKeyCredential returns the JSON serialization of a PublicKeyCredential, as sent by the browser.
+func (a *fakeAuthenticator) publicKeyCredential(response map[string][]byte) []byte {
+	resp := make(map[string]string, len(response))
+	for k, v := range response {
+		resp[k] = b64url(v)
+	}
+	return expect.Must(json.Marshal(map[string]any{
+		"id":       b64url(a.credID),
+		"rawId":    b64url(a.credID),
+		"type":     "public-key",
+		"response": resp,
+	}))
+}
+
+func (a *fakeAuthenticator) register(t *testing.T, options *protocol.CredentialCreation, origin string) []byte {
+	t.Helper()
+	attObj := expect.Must(webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authData(t, options.Response.RelyingParty.ID, protocol.FlagUserPresent|protocol.FlagUserVerified, true),
+	}))
+	return a.publicKeyCredential(map[string][]byte{
+		"clientDataJSON":    clientDataJSON("webauthn.create", options.Response.Challenge, origin),
+		"attestationObject": attObj,
+	})
+}
+
+func (a *fakeAuthenticator) login(t *testing.T, options *protocol.CredentialAssertion, origin, username string, flags protocol.AuthenticatorFlags) []byte {
+	t.Helper()
+	a.signCount++
+	authData := a.authData(t, options.Response.RelyingPartyID, flags, false)
+	cdj := clientDataJSON("webauthn.get", options.Response.Challenge, origin)
+	cdHash := sha256.Sum256(cdj)
+	digest := sha256.Sum256(append(authData, cdHash[:]...))
+	sig := expect.Must(ecdsa.SignASN1(rand.Reader, a.key, digest[:]))
+	return a.publicKeyCredential(map[string][]byte{
+		"clientDataJSON":    cdj,
+		"authenticatorData": authData,
+		"signature":         sig,
+		"userHandle":        []byte(username),
+	})
+}
+
+func TestWebAuthnNotConfigured(t *testing.T) {
+	_, err := newWebAuthnRP("", nil)
+	expect.ErrorIs(t, ErrWebAuthnNotConfigured, err)
+}
+
+func TestWebAuthnRegisterAndLogin(t *testing.T) {
+	t.Cleanup(mfaConfigs.Clear)
+	useTestWebAuthnRP(t)
+
+	authenticator := newFakeAuthenticator(t)
+
+	options := expect.Must(BeginWebAuthnRegistration("alice"))
+	expect.Equal(t, options.Response.RelyingParty.ID, testRPID)
+	info, err := FinishWebAuthnRegistration("alice", "yubikey", authenticator.register(t, options, testOrigin))
+	expect.NoError(t, err)
+	expect.Equal(t, info.Name, "yubikey")
+	expect.Equal(t, MFAMethods("alice"), []string{MFAMethodWebAuthn})
+
+	// challenges are single use
+	_, err = FinishWebAuthnRegistration("alice", "yubikey", authenticator.register(t, options, testOrigin))
+	expect.ErrorIs(t, ErrWebAuthnChallenge, err)
+
+	// the challenge of another user
+	options = expect.Must(BeginWebAuthnRegistration("bob"))
+	_, err = FinishWebAuthnRegistration("alice", "yubikey", authenticator.register(t, options, testOrigin))
+	expect.ErrorIs(t, ErrWebAuthnChallenge, err)
+
+	// passkey login with user verification
+	login := expect.Must(BeginWebAuthnLogin(""))
+	username, uv, err := FinishWebAuthnLogin(authenticator.login(t, login, testOrigin, "alice", protocol.FlagUserPresent|protocol.FlagUserVerified))
+	expect.NoError(t, err)
+	expect.Equal(t, username, "alice")
+	expect.True(t, uv)
+
+	// second factor without user verification
+	login = expect.Must(BeginWebAuthnLogin("alice"))
+	_, uv, err = FinishWebAuthnLogin(authenticator.login(t, login, testOrigin, "", protocol.FlagUserPresent))
+	expect.NoError(t, err)
+	expect.False(t, uv)
+
+	// wrong origin
+	login = expect.Must(BeginWebAuthnLogin("alice"))
+	_, _, err = FinishWebAuthnLogin(authenticator.login(t, login, "https://evil.example.com", "", protocol.FlagUserPresent))
+	expect.ErrorIs(t, ErrWebAuthnInvalid, err)
+
+	// replayed signature counter
+	login = expect.Must(BeginWebAuthnLogin("alice"))
+	authenticator.signCount = 0
+	_, _, err = FinishWebAuthnLogin(authenticator.login(t, login, testOrigin, "", protocol.FlagUserPresent))
+	expect.ErrorIs(t, ErrWebAuthnInvalid, err)
+
+	// signature from another key
+	login = expect.Must(BeginWebAuthnLogin("alice"))
+	impostor := newFakeAuthenticator(t)
+	impostor.signCount = 100
+	_, _, err = FinishWebAuthnLogin(impostor.login(t, login, testOrigin, "", protocol.FlagUserPresent))
+	expect.ErrorIs(t, ErrWebAuthnInvalid, err)
+
+	// users without credentials
+	login = expect.Must(BeginWebAuthnLogin("bob"))
+	_, _, err = FinishWebAuthnLogin(authenticator.login(t, login, testOrigin, "bob", protocol.FlagUserPresent|protocol.FlagUserVerified))
+	expect.ErrorIs(t, ErrWebAuthnInvalid, err)
+
+	expect.NoError(t, DeleteWebAuthnCredential("alice", info.ID))
+	expect.Equal(t, len(MFAMethods("alice")), 0)
+}
+
+func TestUserPassLoginRequiresSecondFactor(t *testing.T) {
+	t.Cleanup(mfaConfigs.Clear)
+
+	auth := newMockUserPassAuth()
+	_, _, err := BeginTOTPEnrollment("username")
+	expect.NoError(t, err)
+	cfg, _ := mfaConfigs.Load("username")
+	cfg.TOTPSecret = cfg.PendingTOTPSecret
+
+	w := httptest.NewRecorder()
+	body := `{"username":"username","password":"password"}`
+	req := httptest.NewRequest(http.MethodPost, "https://app.example.com/api/v1/auth/callback", strings.NewReader(body))
+	auth.PostAuthCallbackHandler(w, req)
+	expect.Equal(t, w.Code, http.StatusUnauthorized)
+
+	var resp SecondFactorRequiredResponse
+	expect.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	expect.Equal(t, resp.Methods, []string{MFAMethodTOTP})
+
+	// the pending cookie must not be accepted as a session
+	pending := expect.Must(http.ParseSetCookie(w.Header().Get("Set-Cookie")))
+	expect.Equal(t, pending.Name, mfaPendingCookieName)
+	sessionReq := &http.Request{Header: http.Header{}}
+	sessionReq.Header.Set("Cookie", auth.TokenCookieName()+"="+pending.Value)
+	expect.HasError(t, auth.CheckToken(sessionReq))
+
+	pendingReq := &http.Request{Header: http.Header{}}
+	pendingReq.AddCookie(pending)
+	user, ok := passwordVerifiedUser(pendingReq, auth.secret)
+	expect.True(t, ok)
+	expect.Equal(t, user.Username, "username")
+}
@@ -16,8 +16,15 @@ const (
 
 	NamespaceHomepageOverrides = ".homepage"
 	NamespaceIconCache         = ".icon_cache"
+	NamespaceUsers             = ".users"
+	NamespaceAPITokens         = ".api_tokens"
+	NamespaceMFA               = ".mfa"
+	NamespaceRulesKV           = ".rules_kv"
 
 	MiddlewareComposeBasePath = ConfigBasePath + "/middlewares"
+	RulePresetsBasePath       = ConfigBasePath + "/rule_presets"
+	IPListsBasePath           = ConfigBasePath + "/ip_lists"
+	WAFRulesBasePath          = ConfigBasePath + "/waf"
 
 	ComposeFileName        = "compose.yml"
 	ComposeExampleFileName = "compose.example.yml"
@@ -31,7 +38,10 @@ var RequiredDirectories = []string{
 	MiddlewareComposeBasePath,
 }
 
-const DockerHostFromEnv = "$DOCKER_HOST"
+const (
+	DockerHostFromEnv = "$DOCKER_HOST"
+	PodmanHostFromEnv = "$CONTAINER_HOST"
+)
 
 const (
 	WakeTimeoutDefault = "3m"
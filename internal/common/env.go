@@ -17,6 +17,9 @@ var (
 
 	ShortLinkPrefix = env.GetEnvString("SHORTLINK_PREFIX", "go")
 
+	// RulePresetDirs are searched for rule presets after RulePresetsBasePath.
+	RulePresetDirs = env.GetEnvCommaSep("RULE_PRESET_DIRS", "")
+
 	ProxyHTTPAddr,
 	ProxyHTTPHost,
 	ProxyHTTPPort,
@@ -57,6 +60,25 @@ var (
 	OIDCRateLimit       = env.GetEnvInt("OIDC_RATE_LIMIT", 10)
 	OIDCRateLimitPeriod = env.GetEnvDuation("OIDC_RATE_LIMIT_PERIOD", time.Second)
 
+	// LDAP Configuration.
+	LDAPURL            = env.GetEnvString("LDAP_URL", "")
+	LDAPStartTLS       = env.GetEnvBool("LDAP_START_TLS", false)
+	LDAPSkipTLSVerify  = env.GetEnvBool("LDAP_SKIP_TLS_VERIFY", false)
+	LDAPBindDN         = env.GetEnvString("LDAP_BIND_DN", "")
+	LDAPBindPassword   = env.GetEnvString("LDAP_BIND_PASSWORD", "")
+	LDAPBaseDN         = env.GetEnvString("LDAP_BASE_DN", "")
+	LDAPUserFilter     = env.GetEnvString("LDAP_USER_FILTER", "(&(objectClass=person)(uid={username}))")
+	LDAPUserDNTemplate = env.GetEnvString("LDAP_USER_DN_TEMPLATE", "")
+	LDAPAdminFilter    = env.GetEnvString("LDAP_ADMIN_FILTER", "")
+	LDAPOperatorFilter = env.GetEnvString("LDAP_OPERATOR_FILTER", "")
+	LDAPViewerFilter   = env.GetEnvString("LDAP_VIEWER_FILTER", "")
+	LDAPPoolSize       = env.GetEnvInt("LDAP_POOL_SIZE", 4)
+	LDAPTimeout        = env.GetEnvDuation("LDAP_TIMEOUT", 10*time.Second)
+
+	// WebAuthn Configuration, passkeys and security keys are disabled without a relying party ID.
+	WebAuthnRPID      = env.GetEnvString("WEBAUTHN_RP_ID", "")
+	WebAuthnRPOrigins = env.GetEnvCommaSep("WEBAUTHN_RP_ORIGINS", "") // defaults to https://<rp id>
+
 	// metrics configuration
 	MetricsDisableCPU     = env.GetEnvBool("METRICS_DISABLE_CPU", false)
 	MetricsDisableMemory  = env.GetEnvBool("METRICS_DISABLE_MEMORY", false)
@@ -8,6 +8,7 @@ import (
 type RouteProviderListResponse struct {
 	ShortName string `json:"short_name"`
 	FullName  string `json:"full_name"`
+	Revision  string `json:"revision,omitempty"` // applied commit id of Git providers
 } // @name RouteProvider
 
 func DumpRouteProviders() map[string]types.RouteProvider {
@@ -26,6 +27,7 @@ func RouteProviderList() []RouteProviderListResponse {
 		list = append(list, RouteProviderListResponse{
 			ShortName: p.ShortName(),
 			FullName:  p.String(),
+			Revision:  p.Revision(),
 		})
 	}
 	return list
@@ -22,12 +22,14 @@ import (
 	"github.com/yusing/godoxy/internal/agentpool"
 	"github.com/yusing/godoxy/internal/autocert"
 	config "github.com/yusing/godoxy/internal/config/types"
+	"github.com/yusing/godoxy/internal/discovery"
 	"github.com/yusing/godoxy/internal/entrypoint"
 	homepage "github.com/yusing/godoxy/internal/homepage/types"
 	"github.com/yusing/godoxy/internal/logging"
 	"github.com/yusing/godoxy/internal/maxmind"
 	"github.com/yusing/godoxy/internal/notif"
 	route "github.com/yusing/godoxy/internal/route/provider"
+	"github.com/yusing/godoxy/internal/route/rules"
 	"github.com/yusing/godoxy/internal/serialization"
 	"github.com/yusing/godoxy/internal/types"
 	gperr "github.com/yusing/goutils/errs"
@@ -103,6 +105,7 @@ func (state *state) InitFromFile(filename string) error {
 }
 
 func (state *state) Init(data []byte) error {
+	initIPListURLs(data)
 	err := serialization.UnmarshalValidate(data, &state.Config, yaml.Unmarshal)
 	if err != nil {
 		return err
@@ -122,6 +125,20 @@ func (state *state) Init(data []byte) error {
 	return errs.Error()
 }
 
+// initIPListURLs sets the ip list urls before the config is unmarshaled,
+// as rules are parsed with it, e.g. entrypoint not found rules.
+func initIPListURLs(data []byte) {
+	var cfg struct {
+		Entrypoint struct {
+			Rules struct {
+				IPListURLs []string `json:"ip_list_urls"`
+			} `json:"rules"`
+		} `json:"entrypoint"`
+	}
+	_ = yaml.Unmarshal(data, &cfg)
+	rules.InitIPListURLs(cfg.Entrypoint.Rules.IPListURLs)
+}
+
 func (state *state) Task() *task.Task {
 	return state.task
 }
@@ -361,6 +378,42 @@ func (state *state) loadRouteProviders() error {
 		registerProvider(route.NewDockerProvider(name, dockerCfg))
 	}
 
+	for name, kubeCfg := range providers.Kubernetes {
+		p, err := route.NewKubernetesProvider(name, kubeCfg)
+		if err != nil {
+			errs.Add(gperr.PrependSubject(name, err))
+			continue
+		}
+		registerProvider(p)
+	}
+
+	registerDiscoveryProvider := func(name string, source discovery.Source) {
+		p, err := route.NewDiscoveryProvider(name, source)
+		if err != nil {
+			errs.Add(gperr.PrependSubject(name, err))
+			return
+		}
+		registerProvider(p)
+	}
+	for name, cfg := range providers.Consul {
+		registerDiscoveryProvider(name, cfg)
+	}
+	for name, cfg := range providers.Etcd {
+		registerDiscoveryProvider(name, cfg)
+	}
+	for name, cfg := range providers.HTTP {
+		registerDiscoveryProvider(name, cfg)
+	}
+
+	for name, cfg := range providers.Git {
+		p, err := route.NewGitProvider(name, cfg)
+		if err != nil {
+			errs.Add(gperr.PrependSubject(name, err))
+			continue
+		}
+		registerProvider(p)
+	}
+
 	lenLongestName := 0
 	for k := range state.providers.Range {
 		if len(k) > lenLongestName {
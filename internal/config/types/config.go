@@ -8,8 +8,11 @@ import (
 	"github.com/yusing/godoxy/agent/pkg/agent"
 	"github.com/yusing/godoxy/internal/acl"
 	"github.com/yusing/godoxy/internal/autocert"
+	"github.com/yusing/godoxy/internal/discovery"
 	entrypoint "github.com/yusing/godoxy/internal/entrypoint/types"
+	"github.com/yusing/godoxy/internal/git"
 	homepage "github.com/yusing/godoxy/internal/homepage/types"
+	"github.com/yusing/godoxy/internal/kubernetes"
 	maxmind "github.com/yusing/godoxy/internal/maxmind/types"
 	"github.com/yusing/godoxy/internal/notif"
 	"github.com/yusing/godoxy/internal/proxmox"
@@ -38,6 +41,11 @@ type (
 		Agents       []*agent.AgentConfig                  `json:"agents" yaml:"agents,omitempty"`
 		Notification []*notif.NotificationConfig           `json:"notification" yaml:"notification,omitempty"`
 		Proxmox      []*proxmox.Config                     `json:"proxmox" yaml:"proxmox,omitempty"`
+		Kubernetes   map[string]*kubernetes.Config         `json:"kubernetes" yaml:"kubernetes,omitempty"`
+		Consul       map[string]*discovery.ConsulConfig    `json:"consul" yaml:"consul,omitempty"`
+		Etcd         map[string]*discovery.EtcdConfig      `json:"etcd" yaml:"etcd,omitempty"`
+		HTTP         map[string]*discovery.HTTPConfig      `json:"http" yaml:"http,omitempty"`
+		Git          map[string]*git.Config                `json:"git" yaml:"git,omitempty"`
 		MaxMind      *maxmind.Config                       `json:"maxmind" yaml:"maxmind,omitempty"`
 	}
 )
@@ -0,0 +1,255 @@
+// Package cron parses standard 5-field cron expressions and computes their activation times.
+package cron
+
+import (
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// when both day fields are restricted a time matches if either matches, like cron(8)
+	domStar, dowStar bool
+
+	loc  *time.Location
+	expr string
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	fieldMinute = field{name: "minute", min: 0, max: 59}
+	fieldHour   = field{name: "hour", min: 0, max: 23}
+	fieldDom    = field{name: "day of month", min: 1, max: 31}
+	fieldMonth  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is also sunday
+	fieldDow = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var ErrInvalidExpression = gperr.New("invalid cron expression")
+
+// searchLimit bounds Next for expressions that never match, e.g. "0 0 31 2 *".
+const searchLimit = 5 * 366 * 24 * time.Hour
+
+// Parse parses a cron expression with the fields minute, hour, day of month, month and day of week.
+//
+// Fields support "*", lists ("1,15"), ranges ("1-5"), steps ("*/15", "8-18/2")
+// and month and weekday names ("jan", "mon-fri").
+// The macros @yearly, @monthly, @weekly, @daily and @hourly are accepted.
+// A "TZ=Europe/Berlin " prefix evaluates the schedule in that time zone instead of loc.
+func Parse(expr string, loc *time.Location) (*Schedule, error) {
+	s := &Schedule{expr: expr, loc: loc}
+	if s.loc == nil {
+		s.loc = time.Local
+	}
+	spec := strings.TrimSpace(expr)
+	if rest, ok := strings.CutPrefix(spec, "TZ="); ok {
+		tz, rest, _ := strings.Cut(rest, " ")
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, ErrInvalidExpression.Subject(expr).With(err)
+		}
+		s.loc = l
+		spec = strings.TrimSpace(rest)
+	}
+	if m, ok := macros[strings.ToLower(spec)]; ok {
+		spec = m
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, ErrInvalidExpression.Subject(expr).Withf("expected 5 fields, got %d", len(fields))
+	}
+	var err error
+	if s.minute, err = parseField(fields[0], fieldMinute); err != nil {
+		return nil, ErrInvalidExpression.Subject(expr).With(err)
+	}
+	if s.hour, err = parseField(fields[1], fieldHour); err != nil {
+		return nil, ErrInvalidExpression.Subject(expr).With(err)
+	}
+	if s.dom, err = parseField(fields[2], fieldDom); err != nil {
+		return nil, ErrInvalidExpression.Subject(expr).With(err)
+	}
+	if s.month, err = parseField(fields[3], fieldMonth); err != nil {
+		return nil, ErrInvalidExpression.Subject(expr).With(err)
+	}
+	if s.dow, err = parseField(fields[4], fieldDow); err != nil {
+		return nil, ErrInvalidExpression.Subject(expr).With(err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+		s.dow &^= 1 << 7
+	}
+	s.domStar = strings.HasPrefix(fields[2], "*")
+	s.dowStar = strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+// MustParse is like Parse but panics on error.
+func MustParse(expr string, loc *time.Location) *Schedule {
+	s, err := Parse(expr, loc)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func parseField(s string, f field) (uint64, error) {
+	var set uint64
+	for part := range strings.SplitSeq(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step <= 0 {
+				return 0, gperr.Errorf("invalid step %q in %s", stepStr, f.name)
+			}
+		}
+
+		var lo, hi int
+		switch {
+		case rng == "*":
+			lo, hi = f.min, f.max
+			if f.name == fieldDow.name {
+				hi = 6
+			}
+		case strings.Contains(rng, "-"):
+			loStr, hiStr, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(loStr); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(hiStr); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, gperr.Errorf("invalid range %q in %s", rng, f.name)
+			}
+		default:
+			v, err := f.value(rng)
+			if err != nil {
+				return 0, err
+			}
+			lo, hi = v, v
+			if hasStep { // "5/15" means "5-max/15"
+				hi = f.max
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func (f field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, gperr.Errorf("invalid %s %q, expected %d-%d", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// String returns the expression the schedule was parsed from.
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// Location returns the time zone the schedule is evaluated in.
+func (s *Schedule) Location() *time.Location {
+	return s.loc
+}
+
+// Matches reports whether t (truncated to the minute) is an activation time.
+func (s *Schedule) Matches(t time.Time) bool {
+	t = t.In(s.loc)
+	return s.minute&(1<<t.Minute()) != 0 &&
+		s.hour&(1<<t.Hour()) != 0 &&
+		s.month&(1<<int(t.Month())) != 0 &&
+		s.dayMatches(t)
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<t.Day()) != 0
+	dowMatch := s.dow&(1<<int(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next returns the first activation time after t, or the zero time if there is none within 5 years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	origLoc := t.Location()
+	t = t.In(s.loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(searchLimit)
+
+	for t.Before(limit) {
+		if s.month&(1<<int(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc)
+			continue
+		}
+		if s.hour&(1<<t.Hour()) == 0 {
+			next := nextBit(s.hour, t.Hour())
+			if next < 0 {
+				t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc)
+			} else {
+				t = time.Date(t.Year(), t.Month(), t.Day(), next, 0, 0, 0, s.loc)
+			}
+			continue
+		}
+		if s.minute&(1<<t.Minute()) == 0 {
+			next := nextBit(s.minute, t.Minute())
+			if next < 0 {
+				// add instead of time.Date to step over DST transitions
+				t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+			} else {
+				t = t.Add(time.Duration(next-t.Minute()) * time.Minute)
+			}
+			continue
+		}
+		return t.In(origLoc)
+	}
+	return time.Time{}
+}
+
+// nextBit returns the lowest set bit greater than v, or -1.
+func nextBit(set uint64, v int) int {
+	rest := set >> (v + 1)
+	if rest == 0 {
+		return -1
+	}
+	return v + 1 + bits.TrailingZeros64(rest)
+}
@@ -0,0 +1,80 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	expect "github.com/yusing/goutils/testing"
+)
+
+func TestParseInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * foo *",
+		"TZ=Nowhere/Nothing * * * * *",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			_, err := Parse(expr, time.UTC)
+			expect.ErrorIs(t, ErrInvalidExpression, err)
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	// 2026-10-19 is a monday
+	from := time.Date(2026, 10, 19, 12, 34, 56, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 10, 19, 12, 35, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 10, 19, 12, 45, 0, 0, time.UTC)},
+		{"55 7 * * mon-fri", time.Date(2026, 10, 20, 7, 55, 0, 0, time.UTC)},
+		{"0 9 * * sat,sun", time.Date(2026, 10, 24, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2026, 10, 25, 9, 0, 0, 0, time.UTC)},
+		{"0 8-18/2 * * *", time.Date(2026, 10, 19, 14, 0, 0, 0, time.UTC)},
+		{"30 12 * * *", time.Date(2026, 10, 20, 12, 30, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// day of month or day of week when both are restricted
+		{"0 0 1 * fri", time.Date(2026, 10, 23, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			s := MustParse(tc.expr, time.UTC)
+			expect.Equal(t, s.Next(from), tc.want)
+			if !tc.want.IsZero() {
+				expect.True(t, s.Matches(tc.want))
+			}
+		})
+	}
+}
+
+func TestNextTimeZone(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+	s := MustParse("TZ=Europe/Berlin 0 9 * * *", time.UTC)
+	expect.Equal(t, s.Location(), berlin)
+	next := s.Next(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC))
+	expect.Equal(t, next.Location(), time.UTC)
+	expect.True(t, next.Equal(time.Date(2026, 10, 20, 9, 0, 0, 0, berlin)))
+
+	// 2:30 does not exist on the day clocks move forward
+	s = MustParse("30 * * * *", berlin)
+	next = s.Next(time.Date(2026, 3, 29, 1, 45, 0, 0, berlin))
+	expect.True(t, next.Equal(time.Date(2026, 3, 29, 3, 30, 0, 0, berlin)))
+}
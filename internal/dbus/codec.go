@@ -0,0 +1,384 @@
+package dbus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// nextType splits the first complete type off sig.
+// It returns an empty type if sig is empty or malformed.
+func nextType(sig string) (t, rest string) {
+	if sig == "" {
+		return "", ""
+	}
+	switch sig[0] {
+	case 'a':
+		elem, rest := nextType(sig[1:])
+		if elem == "" {
+			return "", ""
+		}
+		return "a" + elem, rest
+	case '(', '{':
+		closing := byte(')')
+		if sig[0] == '{' {
+			closing = '}'
+		}
+		inner := sig[1:]
+		n := 0
+		for inner != "" && inner[0] != closing {
+			var elem string
+			elem, inner = nextType(inner)
+			if elem == "" {
+				return "", ""
+			}
+			n += len(elem)
+		}
+		if inner == "" || n == 0 {
+			return "", ""
+		}
+		return sig[:n+2], inner[1:]
+	case 'y', 'b', 'n', 'q', 'i', 'u', 'x', 't', 'd', 's', 'o', 'g', 'v', 'h':
+		return sig[:1], sig[1:]
+	}
+	return "", ""
+}
+
+func alignment(t byte) int {
+	switch t {
+	case 'y', 'g', 'v':
+		return 1
+	case 'n', 'q':
+		return 2
+	case 'b', 'i', 'u', 's', 'o', 'a', 'h':
+		return 4
+	default: // x t d ( {
+		return 8
+	}
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) align(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) u32(v uint32) {
+	e.align(4)
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, v)
+}
+
+func (e *encoder) str(s string) {
+	e.u32(uint32(len(s)))
+	e.buf = append(e.buf, s...)
+	e.buf = append(e.buf, 0)
+}
+
+func (e *encoder) sig(s string) {
+	e.buf = append(e.buf, byte(len(s)))
+	e.buf = append(e.buf, s...)
+	e.buf = append(e.buf, 0)
+}
+
+func typeError(t string, v any) error {
+	return fmt.Errorf("%w: cannot encode %T as %q", ErrInvalidMessage, v, t)
+}
+
+func (e *encoder) value(t string, v any) error {
+	switch t[0] {
+	case 'y':
+		b, ok := v.(byte)
+		if !ok {
+			return typeError(t, v)
+		}
+		e.buf = append(e.buf, b)
+	case 'b':
+		b, ok := v.(bool)
+		if !ok {
+			return typeError(t, v)
+		}
+		if b {
+			e.u32(1)
+		} else {
+			e.u32(0)
+		}
+	case 'n', 'q':
+		var n uint16
+		switch v := v.(type) {
+		case int16:
+			n = uint16(v)
+		case uint16:
+			n = v
+		default:
+			return typeError(t, v)
+		}
+		e.align(2)
+		e.buf = binary.LittleEndian.AppendUint16(e.buf, n)
+	case 'i', 'u', 'h':
+		var n uint32
+		switch v := v.(type) {
+		case int32:
+			n = uint32(v)
+		case uint32:
+			n = v
+		default:
+			return typeError(t, v)
+		}
+		e.u32(n)
+	case 'x', 't', 'd':
+		var n uint64
+		switch v := v.(type) {
+		case int64:
+			n = uint64(v)
+		case uint64:
+			n = v
+		case float64:
+			n = math.Float64bits(v)
+		default:
+			return typeError(t, v)
+		}
+		e.align(8)
+		e.buf = binary.LittleEndian.AppendUint64(e.buf, n)
+	case 's':
+		s, ok := v.(string)
+		if !ok {
+			return typeError(t, v)
+		}
+		e.str(s)
+	case 'o':
+		s, ok := v.(ObjectPath)
+		if !ok {
+			return typeError(t, v)
+		}
+		e.str(string(s))
+	case 'g':
+		s, ok := v.(Signature)
+		if !ok {
+			return typeError(t, v)
+		}
+		e.sig(string(s))
+	case 'v':
+		variant, ok := v.(Variant)
+		if !ok {
+			return typeError(t, v)
+		}
+		inner, rest := nextType(string(variant.Sig))
+		if inner == "" || rest != "" {
+			return fmt.Errorf("%w: invalid variant signature %q", ErrInvalidMessage, variant.Sig)
+		}
+		e.sig(string(variant.Sig))
+		return e.value(inner, variant.Value)
+	case 'a':
+		elems, ok := v.([]any)
+		if !ok {
+			return typeError(t, v)
+		}
+		elemType := t[1:]
+		e.u32(0)
+		lenPos := len(e.buf) - 4
+		e.align(alignment(elemType[0]))
+		start := len(e.buf)
+		for _, elem := range elems {
+			if err := e.value(elemType, elem); err != nil {
+				return err
+			}
+		}
+		binary.LittleEndian.PutUint32(e.buf[lenPos:], uint32(len(e.buf)-start))
+	case '(', '{':
+		fields, ok := v.([]any)
+		if !ok {
+			return typeError(t, v)
+		}
+		e.align(8)
+		sig := t[1 : len(t)-1]
+		for _, f := range fields {
+			var ft string
+			ft, sig = nextType(sig)
+			if ft == "" {
+				return typeError(t, v)
+			}
+			if err := e.value(ft, f); err != nil {
+				return err
+			}
+		}
+		if sig != "" {
+			return typeError(t, v)
+		}
+	default:
+		return typeError(t, v)
+	}
+	return nil
+}
+
+type decoder struct {
+	buf   []byte
+	pos   int
+	order binary.ByteOrder
+}
+
+func (d *decoder) align(n int) error {
+	for d.pos%n != 0 {
+		d.pos++
+	}
+	if d.pos > len(d.buf) {
+		return fmt.Errorf("%w: truncated", ErrInvalidMessage)
+	}
+	return nil
+}
+
+func (d *decoder) read(n int) ([]byte, error) {
+	if d.pos+n > len(d.buf) || n < 0 {
+		return nil, fmt.Errorf("%w: truncated", ErrInvalidMessage)
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) u32() (uint32, error) {
+	if err := d.align(4); err != nil {
+		return 0, err
+	}
+	b, err := d.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return d.order.Uint32(b), nil
+}
+
+func (d *decoder) str() (string, error) {
+	n, err := d.u32()
+	if err != nil {
+		return "", err
+	}
+	b, err := d.read(int(n) + 1)
+	if err != nil {
+		return "", err
+	}
+	return string(b[:n]), nil
+}
+
+func (d *decoder) sig() (string, error) {
+	n, err := d.read(1)
+	if err != nil {
+		return "", err
+	}
+	b, err := d.read(int(n[0]) + 1)
+	if err != nil {
+		return "", err
+	}
+	return string(b[:n[0]]), nil
+}
+
+func (d *decoder) value(t string) (any, error) {
+	switch t[0] {
+	case 'y':
+		b, err := d.read(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0], nil
+	case 'b':
+		n, err := d.u32()
+		return n != 0, err
+	case 'n', 'q':
+		if err := d.align(2); err != nil {
+			return nil, err
+		}
+		b, err := d.read(2)
+		if err != nil {
+			return nil, err
+		}
+		if t[0] == 'n' {
+			return int16(d.order.Uint16(b)), nil
+		}
+		return d.order.Uint16(b), nil
+	case 'i', 'h':
+		n, err := d.u32()
+		return int32(n), err
+	case 'u':
+		return d.u32()
+	case 'x', 't', 'd':
+		if err := d.align(8); err != nil {
+			return nil, err
+		}
+		b, err := d.read(8)
+		if err != nil {
+			return nil, err
+		}
+		n := d.order.Uint64(b)
+		switch t[0] {
+		case 'x':
+			return int64(n), nil
+		case 't':
+			return n, nil
+		default:
+			return math.Float64frombits(n), nil
+		}
+	case 's':
+		return d.str()
+	case 'o':
+		s, err := d.str()
+		return ObjectPath(s), err
+	case 'g':
+		s, err := d.sig()
+		return Signature(s), err
+	case 'v':
+		s, err := d.sig()
+		if err != nil {
+			return nil, err
+		}
+		inner, rest := nextType(s)
+		if inner == "" || rest != "" {
+			return nil, fmt.Errorf("%w: invalid variant signature %q", ErrInvalidMessage, s)
+		}
+		v, err := d.value(inner)
+		if err != nil {
+			return nil, err
+		}
+		return Variant{Signature(s), v}, nil
+	case 'a':
+		n, err := d.u32()
+		if err != nil {
+			return nil, err
+		}
+		elemType := t[1:]
+		if err := d.align(alignment(elemType[0])); err != nil {
+			return nil, err
+		}
+		end := d.pos + int(n)
+		if end > len(d.buf) {
+			return nil, fmt.Errorf("%w: truncated", ErrInvalidMessage)
+		}
+		elems := []any{}
+		for d.pos < end {
+			v, err := d.value(elemType)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, v)
+		}
+		return elems, nil
+	case '(', '{':
+		if err := d.align(8); err != nil {
+			return nil, err
+		}
+		var fields []any
+		sig := t[1 : len(t)-1]
+		for sig != "" {
+			var ft string
+			ft, sig = nextType(sig)
+			v, err := d.value(ft)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, v)
+		}
+		return fields, nil
+	}
+	return nil, fmt.Errorf("%w: unsupported type %q", ErrInvalidMessage, t)
+}
@@ -0,0 +1,263 @@
+// Package dbus implements a minimal D-Bus client for calling methods on a message bus.
+//
+// Only unix socket transports and the EXTERNAL authentication mechanism are supported.
+package dbus
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSystemBusAddress = "unix:path=/run/dbus/system_bus_socket"
+	callTimeout             = 30 * time.Second
+)
+
+var ErrUnsupportedAddress = errors.New("dbus: unsupported bus address")
+
+// Error is an error reply.
+type Error struct {
+	Name    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return "dbus: " + e.Name
+	}
+	return fmt.Sprintf("dbus: %s: %s", e.Name, e.Message)
+}
+
+// Conn is an authenticated connection to a message bus.
+//
+// Calls are serialized, signals and other unrelated messages are discarded.
+type Conn struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	br     *bufio.Reader
+	serial uint32
+	closed bool
+
+	uniqueName string
+}
+
+// SystemBus connects to the system bus at $DBUS_SYSTEM_BUS_ADDRESS or the default socket.
+func SystemBus(ctx context.Context) (*Conn, error) {
+	addr := os.Getenv("DBUS_SYSTEM_BUS_ADDRESS")
+	if addr == "" {
+		addr = defaultSystemBusAddress
+	}
+	return Dial(ctx, addr)
+}
+
+// SessionBus connects to the session (user) bus at $DBUS_SESSION_BUS_ADDRESS or $XDG_RUNTIME_DIR/bus.
+func SessionBus(ctx context.Context) (*Conn, error) {
+	addr := os.Getenv("DBUS_SESSION_BUS_ADDRESS")
+	if addr == "" {
+		runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+		if runtimeDir == "" {
+			runtimeDir = "/run/user/" + strconv.Itoa(os.Getuid())
+		}
+		addr = "unix:path=" + runtimeDir + "/bus"
+	}
+	return Dial(ctx, addr)
+}
+
+// Dial connects to the bus at address (e.g. unix:path=/run/dbus/system_bus_socket),
+// authenticates and registers the connection on the bus.
+func Dial(ctx context.Context, address string) (*Conn, error) {
+	path, err := socketPath(address)
+	if err != nil {
+		return nil, err
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewConn(ctx, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// socketPath returns the socket path of the first supported unix address.
+func socketPath(address string) (string, error) {
+	for addr := range strings.SplitSeq(address, ";") {
+		transport, params, ok := strings.Cut(addr, ":")
+		if !ok || transport != "unix" {
+			continue
+		}
+		for kv := range strings.SplitSeq(params, ",") {
+			k, v, _ := strings.Cut(kv, "=")
+			switch k {
+			case "path":
+				return unescapeAddress(v), nil
+			case "abstract":
+				return "@" + unescapeAddress(v), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnsupportedAddress, address)
+}
+
+func unescapeAddress(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) {
+			if v, err := hex.DecodeString(s[i+1 : i+3]); err == nil {
+				b.WriteByte(v[0])
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// NewConn authenticates over an established connection and sends Hello.
+func NewConn(ctx context.Context, conn net.Conn) (*Conn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	} else {
+		_ = conn.SetDeadline(time.Now().Add(callTimeout))
+	}
+	c := &Conn{conn: conn, br: bufio.NewReader(conn)}
+	if err := c.auth(); err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	reply, err := c.Call(ctx, "org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "Hello", "")
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) == 1 {
+		c.uniqueName, _ = reply[0].(string)
+	}
+	return c, nil
+}
+
+func (c *Conn) auth() error {
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := c.conn.Write([]byte("\x00AUTH EXTERNAL " + uid + "\r\n")); err != nil {
+		return err
+	}
+	line, err := c.br.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("dbus: authentication rejected: %s", strings.TrimSpace(line))
+	}
+	_, err = c.conn.Write([]byte("BEGIN\r\n"))
+	return err
+}
+
+// UniqueName returns the unique bus name assigned to the connection.
+func (c *Conn) UniqueName() string {
+	return c.uniqueName
+}
+
+// Call invokes a method and returns the reply body.
+// Arguments are encoded according to sig, e.g. "ss" for two strings.
+func (c *Conn) Call(ctx context.Context, dest string, path ObjectPath, iface, method string, sig Signature, args ...any) ([]any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, net.ErrClosed
+	}
+
+	c.serial++
+	msg := &Message{
+		Type:        TypeMethodCall,
+		Serial:      c.serial,
+		Path:        path,
+		Interface:   iface,
+		Member:      method,
+		Destination: dest,
+		Signature:   sig,
+		Body:        args,
+	}
+	data, err := msg.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(callTimeout)
+	}
+	_ = c.conn.SetDeadline(deadline)
+	defer c.conn.SetDeadline(time.Time{})
+
+	if _, err := c.conn.Write(data); err != nil {
+		c.closeLocked()
+		return nil, err
+	}
+	for {
+		reply, err := ReadMessage(c.br)
+		if err != nil {
+			c.closeLocked()
+			return nil, err
+		}
+		if reply.ReplySerial != msg.Serial {
+			continue
+		}
+		switch reply.Type {
+		case TypeMethodReturn:
+			return reply.Body, nil
+		case TypeError:
+			e := &Error{Name: reply.ErrorName}
+			if len(reply.Body) > 0 {
+				e.Message, _ = reply.Body[0].(string)
+			}
+			return nil, e
+		}
+	}
+}
+
+// GetProperty returns the value of a property through org.freedesktop.DBus.Properties.
+func (c *Conn) GetProperty(ctx context.Context, dest string, path ObjectPath, iface, property string) (any, error) {
+	reply, err := c.Call(ctx, dest, path, "org.freedesktop.DBus.Properties", "Get", "ss", iface, property)
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) != 1 {
+		return nil, fmt.Errorf("%w: unexpected reply to Get", ErrInvalidMessage)
+	}
+	v, ok := reply[0].(Variant)
+	if !ok {
+		return nil, fmt.Errorf("%w: unexpected reply to Get", ErrInvalidMessage)
+	}
+	return v.Value, nil
+}
+
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeLocked()
+}
+
+func (c *Conn) closeLocked() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.conn.Close()
+}
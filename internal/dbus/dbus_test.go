@@ -0,0 +1,86 @@
+package dbus_test
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/yusing/godoxy/internal/dbus"
+	"github.com/yusing/godoxy/internal/dbus/dbustest"
+	expect "github.com/yusing/goutils/testing"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	msg := &dbus.Message{
+		Type:        dbus.TypeMethodCall,
+		Serial:      7,
+		Path:        "/org/freedesktop/systemd1",
+		Interface:   "org.freedesktop.systemd1.Manager",
+		Member:      "StartTransientUnit",
+		Destination: "org.freedesktop.systemd1",
+		Signature:   "ssa(sv)a(sa(sv))ybxtdv",
+		Body: []any{
+			"test.service",
+			"fail",
+			[]any{
+				[]any{"Description", dbus.Variant{Sig: "s", Value: "test"}},
+				[]any{"ExecStart", dbus.Variant{Sig: "as", Value: []any{"/bin/true", "--flag"}}},
+			},
+			[]any{},
+			byte(3),
+			true,
+			int64(-42),
+			uint64(1 << 40),
+			1.5,
+			dbus.Variant{Sig: "(io)", Value: []any{int32(-1), dbus.ObjectPath("/a/b")}},
+		},
+	}
+	data := expect.Must(msg.Encode())
+
+	got := expect.Must(dbus.ReadMessage(bufio.NewReader(bytes.NewReader(data))))
+	expect.Equal(t, got, msg)
+}
+
+func TestEncodeTypeMismatch(t *testing.T) {
+	_, err := (&dbus.Message{Type: dbus.TypeMethodCall, Signature: "s", Body: []any{int32(1)}}).Encode()
+	expect.ErrorIs(t, dbus.ErrInvalidMessage, err)
+	_, err = (&dbus.Message{Type: dbus.TypeMethodCall, Signature: "ss", Body: []any{"a"}}).Encode()
+	expect.ErrorIs(t, dbus.ErrInvalidMessage, err)
+}
+
+func TestCall(t *testing.T) {
+	srv := dbustest.NewServer(t, func(call *dbus.Message) (dbus.Signature, []any, *dbus.Error) {
+		switch call.Member {
+		case "Echo":
+			return call.Signature, call.Body, nil
+		case "Get":
+			return "v", []any{dbus.Variant{Sig: "s", Value: "active"}}, nil
+		}
+		return "", nil, &dbus.Error{Name: "org.freedesktop.DBus.Error.UnknownMethod", Message: "unknown method " + call.Member}
+	})
+
+	conn := expect.Must(dbus.Dial(t.Context(), srv.Address))
+	defer conn.Close()
+	expect.Equal(t, conn.UniqueName(), ":1.1")
+
+	reply, err := conn.Call(t.Context(), "com.example", "/com/example", "com.example.Test", "Echo", "sau", "hello", []any{uint32(1), uint32(2)})
+	expect.NoError(t, err)
+	expect.Equal(t, reply, []any{"hello", []any{uint32(1), uint32(2)}})
+
+	state, err := conn.GetProperty(t.Context(), "com.example", "/com/example", "com.example.Unit", "ActiveState")
+	expect.NoError(t, err)
+	expect.Equal(t, state, any("active"))
+
+	_, err = conn.Call(t.Context(), "com.example", "/com/example", "com.example.Test", "Missing", "")
+	var dbusErr *dbus.Error
+	expect.True(t, errors.As(err, &dbusErr))
+	expect.Equal(t, dbusErr.Name, "org.freedesktop.DBus.Error.UnknownMethod")
+
+	expect.Equal(t, srv.Calls(), []string{"com.example.Test.Echo", "org.freedesktop.DBus.Properties.Get", "com.example.Test.Missing"})
+}
+
+func TestDialUnsupportedAddress(t *testing.T) {
+	_, err := dbus.Dial(t.Context(), "tcp:host=localhost,port=1234")
+	expect.ErrorIs(t, dbus.ErrUnsupportedAddress, err)
+}
@@ -0,0 +1,132 @@
+// Package dbustest provides an in-process fake message bus for tests.
+package dbustest
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/yusing/godoxy/internal/dbus"
+)
+
+// Handler handles a method call and returns the reply signature and body, or an error reply.
+type Handler func(call *dbus.Message) (sig dbus.Signature, body []any, err *dbus.Error)
+
+type Server struct {
+	// Address is the bus address to pass to dbus.Dial.
+	Address string
+
+	handler Handler
+	ln      net.Listener
+	clients atomic.Int32
+	wg      sync.WaitGroup
+
+	mu    sync.Mutex
+	calls []string
+}
+
+// NewServer starts a fake bus on a unix socket in a temporary directory.
+//
+// Hello is answered by the server, every other method call is passed to handler.
+func NewServer(t testing.TB, handler Handler) *Server {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bus")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Address: "unix:path=" + path, handler: handler, ln: ln}
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Calls returns the called members in order, as "Interface.Member".
+func (s *Server) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+func (s *Server) Close() {
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	if b, err := br.ReadByte(); err != nil || b != 0 {
+		return
+	}
+	line, err := br.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "AUTH EXTERNAL ") {
+		_, _ = conn.Write([]byte("REJECTED EXTERNAL\r\n"))
+		return
+	}
+	_, _ = conn.Write([]byte("OK 0123456789abcdef0123456789abcdef\r\n"))
+	if line, err = br.ReadString('\n'); err != nil || line != "BEGIN\r\n" {
+		return
+	}
+
+	name := ":1." + strconv.Itoa(int(s.clients.Add(1)))
+	var serial uint32
+	send := func(m *dbus.Message) {
+		serial++
+		m.Serial = serial
+		data, err := m.Encode()
+		if err != nil {
+			panic(err)
+		}
+		_, _ = conn.Write(data)
+	}
+	for {
+		call, err := dbus.ReadMessage(br)
+		if err != nil {
+			return
+		}
+		if call.Type != dbus.TypeMethodCall {
+			continue
+		}
+		if call.Member == "Hello" && call.Interface == "org.freedesktop.DBus" {
+			send(&dbus.Message{Type: dbus.TypeMethodReturn, ReplySerial: call.Serial, Signature: "s", Body: []any{name}})
+			// like the real bus, follow up with a signal the client must skip
+			send(&dbus.Message{
+				Type: dbus.TypeSignal, Path: "/org/freedesktop/DBus", Interface: "org.freedesktop.DBus",
+				Member: "NameAcquired", Signature: "s", Body: []any{name},
+			})
+			continue
+		}
+
+		s.mu.Lock()
+		s.calls = append(s.calls, call.Interface+"."+call.Member)
+		s.mu.Unlock()
+
+		sig, body, dbusErr := s.handler(call)
+		if dbusErr != nil {
+			send(&dbus.Message{
+				Type: dbus.TypeError, ReplySerial: call.Serial, ErrorName: dbusErr.Name,
+				Signature: "s", Body: []any{dbusErr.Message},
+			})
+			continue
+		}
+		send(&dbus.Message{Type: dbus.TypeMethodReturn, ReplySerial: call.Serial, Signature: sig, Body: body})
+	}
+}
@@ -0,0 +1,210 @@
+package dbus
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+type MessageType byte
+
+const (
+	TypeMethodCall   MessageType = 1
+	TypeMethodReturn MessageType = 2
+	TypeError        MessageType = 3
+	TypeSignal       MessageType = 4
+)
+
+const (
+	FlagNoReplyExpected byte = 0x1
+	FlagNoAutoStart     byte = 0x2
+)
+
+// header field codes
+const (
+	fieldPath        byte = 1
+	fieldInterface   byte = 2
+	fieldMember      byte = 3
+	fieldErrorName   byte = 4
+	fieldReplySerial byte = 5
+	fieldDestination byte = 6
+	fieldSender      byte = 7
+	fieldSignature   byte = 8
+)
+
+const maxMessageSize = 128 << 20
+
+type (
+	ObjectPath string
+	Signature  string
+
+	// Variant is a value together with its signature.
+	Variant struct {
+		Sig   Signature
+		Value any
+	}
+
+	// Message is a D-Bus message. Body values are decoded according to Signature:
+	// basic types map to the matching Go types, arrays and structs to []any and variants to Variant.
+	Message struct {
+		Type        MessageType
+		Flags       byte
+		Serial      uint32
+		Path        ObjectPath
+		Interface   string
+		Member      string
+		ErrorName   string
+		ReplySerial uint32
+		Destination string
+		Sender      string
+		Signature   Signature
+		Body        []any
+	}
+)
+
+var ErrInvalidMessage = errors.New("dbus: invalid message")
+
+// Encode returns the little endian wire format of m.
+func (m *Message) Encode() ([]byte, error) {
+	var body encoder
+	sig := string(m.Signature)
+	for _, v := range m.Body {
+		var t string
+		t, sig = nextType(sig)
+		if t == "" {
+			return nil, fmt.Errorf("%w: body does not match signature %q", ErrInvalidMessage, m.Signature)
+		}
+		if err := body.value(t, v); err != nil {
+			return nil, err
+		}
+	}
+	if sig != "" {
+		return nil, fmt.Errorf("%w: body does not match signature %q", ErrInvalidMessage, m.Signature)
+	}
+
+	var e encoder
+	e.buf = append(e.buf, 'l', byte(m.Type), m.Flags, 1)
+	e.u32(uint32(len(body.buf)))
+	e.u32(m.Serial)
+
+	var fields []any
+	addField := func(code byte, sig Signature, v any) {
+		fields = append(fields, []any{code, Variant{sig, v}})
+	}
+	if m.Path != "" {
+		addField(fieldPath, "o", m.Path)
+	}
+	if m.Interface != "" {
+		addField(fieldInterface, "s", m.Interface)
+	}
+	if m.Member != "" {
+		addField(fieldMember, "s", m.Member)
+	}
+	if m.ErrorName != "" {
+		addField(fieldErrorName, "s", m.ErrorName)
+	}
+	if m.ReplySerial != 0 {
+		addField(fieldReplySerial, "u", m.ReplySerial)
+	}
+	if m.Destination != "" {
+		addField(fieldDestination, "s", m.Destination)
+	}
+	if m.Sender != "" {
+		addField(fieldSender, "s", m.Sender)
+	}
+	if m.Signature != "" {
+		addField(fieldSignature, "g", m.Signature)
+	}
+	if err := e.value("a(yv)", fields); err != nil {
+		return nil, err
+	}
+	e.align(8)
+	return append(e.buf, body.buf...), nil
+}
+
+// ReadMessage reads a single message from r.
+func ReadMessage(r *bufio.Reader) (*Message, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder
+	switch fixed[0] {
+	case 'l':
+		order = binary.LittleEndian
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("%w: bad endianness %q", ErrInvalidMessage, fixed[0])
+	}
+	bodyLen := order.Uint32(fixed[4:8])
+	fieldsLen := order.Uint32(fixed[12:16])
+	headerLen := 16 + int(fieldsLen)
+	headerLen += (8 - headerLen%8) % 8
+	total := headerLen + int(bodyLen)
+	if fieldsLen > maxMessageSize || bodyLen > maxMessageSize || total > maxMessageSize {
+		return nil, fmt.Errorf("%w: message too large", ErrInvalidMessage)
+	}
+	data := make([]byte, total)
+	copy(data, fixed)
+	if _, err := io.ReadFull(r, data[16:]); err != nil {
+		return nil, err
+	}
+
+	m := &Message{
+		Type:   MessageType(fixed[1]),
+		Flags:  fixed[2],
+		Serial: order.Uint32(fixed[8:12]),
+	}
+	d := &decoder{buf: data[:16+fieldsLen], pos: 12, order: order}
+	fields, err := d.value("a(yv)")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields.([]any) {
+		f := f.([]any)
+		code, v := f[0].(byte), f[1].(Variant).Value
+		var ok bool
+		switch code {
+		case fieldPath:
+			m.Path, ok = v.(ObjectPath)
+		case fieldInterface:
+			m.Interface, ok = v.(string)
+		case fieldMember:
+			m.Member, ok = v.(string)
+		case fieldErrorName:
+			m.ErrorName, ok = v.(string)
+		case fieldReplySerial:
+			m.ReplySerial, ok = v.(uint32)
+		case fieldDestination:
+			m.Destination, ok = v.(string)
+		case fieldSender:
+			m.Sender, ok = v.(string)
+		case fieldSignature:
+			m.Signature, ok = v.(Signature)
+		default:
+			ok = true // unknown fields are ignored
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: bad header field %d", ErrInvalidMessage, code)
+		}
+	}
+
+	d = &decoder{buf: data[headerLen:], order: order}
+	sig := string(m.Signature)
+	for sig != "" {
+		var t string
+		t, sig = nextType(sig)
+		if t == "" {
+			return nil, fmt.Errorf("%w: bad signature %q", ErrInvalidMessage, m.Signature)
+		}
+		v, err := d.value(t)
+		if err != nil {
+			return nil, err
+		}
+		m.Body = append(m.Body, v)
+	}
+	return m, nil
+}
@@ -0,0 +1,347 @@
+package discovery
+
+import (
+	"cmp"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/yusing/godoxy/internal/docker"
+	"github.com/yusing/godoxy/internal/types"
+	gperr "github.com/yusing/goutils/errs"
+	strutils "github.com/yusing/goutils/strings"
+)
+
+// ConsulConfig discovers routes from services in the Consul catalog.
+//
+// Services with the tag, or tags prefixed with "<tag>.", are routed to their passing instances.
+type ConsulConfig struct {
+	URL        string            `json:"url,omitempty" validate:"omitempty,url"` // default is http://127.0.0.1:8500
+	Token      strutils.Redacted `json:"token,omitempty"`
+	Datacenter string            `json:"datacenter,omitempty"` // default is the datacenter of the agent
+	Tag        string            `json:"tag,omitempty"`        // default is "godoxy"
+	TLSConfig
+
+	client *http.Client
+}
+
+type consulServiceEntry struct {
+	Node struct {
+		Node    string `json:"Node"`
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		ID      string   `json:"ID"`
+		Service string   `json:"Service"`
+		Tags    []string `json:"Tags"`
+		Address string   `json:"Address"`
+		Port    int      `json:"Port"`
+	} `json:"Service"`
+}
+
+const (
+	ConsulDefaultURL = "http://127.0.0.1:8500"
+	ConsulDefaultTag = "godoxy"
+
+	// consulWaitTime is the max duration of blocking queries.
+	consulWaitTime = 5 * time.Minute
+)
+
+// consulMinQueryInterval rate limits blocking queries of frequently changing indexes.
+var consulMinQueryInterval = time.Second
+
+// consulWatchPaths are watched with blocking queries, service registrations and health changes.
+var consulWatchPaths = []string{"/v1/catalog/services", "/v1/health/state/any"}
+
+var ErrInvalidConsulTag = gperr.New("invalid tag, expect <tag>.<field>=<value>")
+
+func (c *ConsulConfig) String() string {
+	return "consul"
+}
+
+// Init implements Source.
+func (c *ConsulConfig) Init() gperr.Error {
+	c.URL = strings.TrimSuffix(cmp.Or(c.URL, ConsulDefaultURL), "/")
+	c.Tag = cmp.Or(c.Tag, ConsulDefaultTag)
+	client, err := c.httpClient()
+	if err != nil {
+		return err
+	}
+	c.client = client
+	return nil
+}
+
+func (c *ConsulConfig) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	if c.Datacenter != "" {
+		query.Set("dc", c.Datacenter)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		req.Header.Set("X-Consul-Token", c.Token.String())
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, statusError(resp)
+	}
+	return resp, nil
+}
+
+func consulGet[T any](ctx context.Context, c *ConsulConfig, path string, query url.Values) (res T, err error) {
+	resp, err := c.get(ctx, path, query)
+	if err != nil {
+		return res, err
+	}
+	defer resp.Body.Close()
+	if err := sonic.ConfigDefault.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return res, gperr.Wrap(err, "failed to decode response").Subject(path)
+	}
+	return res, nil
+}
+
+// Load implements Source.
+//
+// A service with multiple instances has a route "<alias>.<node>.<service id>" for each instance,
+// load balanced under the alias.
+func (c *ConsulConfig) Load(ctx context.Context) (Entries, gperr.Error) {
+	services, err := consulGet[map[string][]string](ctx, c, "/v1/catalog/services", nil)
+	if err != nil {
+		return nil, gperr.Wrap(err)
+	}
+
+	entries := make(Entries)
+	owners := make(map[string]string) // alias -> service name
+	errs := gperr.NewBuilder("")
+	for name, tags := range services {
+		if !slices.ContainsFunc(tags, c.isRouteTag) {
+			continue
+		}
+		instances, err := consulGet[[]consulServiceEntry](ctx, c, "/v1/health/service/"+url.PathEscape(name), url.Values{"passing": {"1"}})
+		if err != nil {
+			errs.Add(gperr.PrependSubject(name, err))
+			continue
+		}
+		serviceEntries, err := c.serviceEntries(instances)
+		if err != nil {
+			errs.Add(gperr.PrependSubject(name, err))
+		}
+		for alias, entry := range serviceEntries {
+			if conflict, ok := owners[alias]; ok && conflict != name {
+				errs.Add(gperr.Multiline().
+					Addf("route with alias %s already exists", alias).
+					Addf("service %s", name).
+					Addf("conflicting service %s", conflict))
+				continue
+			}
+			entries[alias] = entry
+			owners[alias] = name
+		}
+	}
+	return entries, errs.Error()
+}
+
+func (c *ConsulConfig) isRouteTag(tag string) bool {
+	return tag == c.Tag || strings.HasPrefix(tag, c.Tag+".")
+}
+
+// serviceEntries returns the route entries of the instances of a service.
+func (c *ConsulConfig) serviceEntries(instances []consulServiceEntry) (Entries, gperr.Error) {
+	type instanceEntry struct {
+		key   string
+		entry types.LabelMap
+	}
+
+	errs := gperr.NewBuilder("")
+	byAlias := make(map[string][]instanceEntry)
+	for _, inst := range instances {
+		svc := inst.Service
+		if !slices.ContainsFunc(svc.Tags, c.isRouteTag) {
+			continue
+		}
+		labels, aliases, err := c.parseTags(svc.Tags)
+		if err != nil {
+			errs.Add(err.Subject(svc.ID))
+			continue
+		}
+		if len(aliases) == 0 {
+			aliases = []string{svc.Service}
+		}
+		for _, alias := range aliases {
+			// parsed for each alias, since entries are modified when load balanced
+			entry, err := docker.ParseLabels(labels)
+			if err != nil {
+				errs.Add(err.Subject(svc.ID))
+				break
+			}
+			for key, value := range consulGeneratedEntry(&inst) {
+				if _, ok := entry[key]; !ok {
+					entry[key] = value
+				}
+			}
+			byAlias[alias] = append(byAlias[alias], instanceEntry{inst.Node.Node + "." + svc.ID, entry})
+		}
+	}
+
+	entries := make(Entries, len(byAlias))
+	for alias, instEntries := range byAlias {
+		if len(instEntries) == 1 {
+			entries[alias] = instEntries[0].entry
+			continue
+		}
+		for _, e := range instEntries {
+			switch lb := e.entry["load_balance"].(type) {
+			case nil:
+				e.entry["load_balance"] = types.LabelMap{"link": alias}
+			case types.LabelMap:
+				if _, ok := lb["link"]; !ok {
+					lb["link"] = alias
+				}
+			}
+			entries[alias+"."+e.key] = e.entry
+		}
+	}
+	return entries, errs.Error()
+}
+
+// parseTags converts route tags to docker labels without alias, e.g. "godoxy.healthcheck.path=/ping" to "proxy.healthcheck.path".
+//
+// The aliases are from the tag "<tag>.aliases", comma separated.
+func (c *ConsulConfig) parseTags(tags []string) (labels map[string]string, aliases []string, err gperr.Error) {
+	labels = make(map[string]string)
+	for _, tag := range tags {
+		field, ok := strings.CutPrefix(tag, c.Tag+".")
+		if !ok {
+			continue
+		}
+		field, value, ok := strings.Cut(field, "=")
+		if !ok || field == "" {
+			return nil, nil, ErrInvalidConsulTag.Subject(tag)
+		}
+		if field == "aliases" {
+			for alias := range strings.SplitSeq(value, ",") {
+				if alias = strings.TrimSpace(alias); alias != "" {
+					aliases = append(aliases, alias)
+				}
+			}
+			continue
+		}
+		labels[docker.NSProxy+"."+field] = value
+	}
+	return labels, aliases, nil
+}
+
+func consulGeneratedEntry(inst *consulServiceEntry) types.LabelMap {
+	entry := types.LabelMap{
+		"scheme": "http",
+		"host":   cmp.Or(inst.Service.Address, inst.Node.Address),
+	}
+	if inst.Service.Port != 0 {
+		entry["port"] = strconv.Itoa(inst.Service.Port)
+		if inst.Service.Port == 443 {
+			entry["scheme"] = "https"
+		}
+	}
+	return entry
+}
+
+// Watch implements Source.
+//
+// Service registrations and health changes are watched with blocking queries.
+func (c *ConsulConfig) Watch(ctx context.Context, changed func()) error {
+	// changed must not be called after returning
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errCh := make(chan error, len(consulWatchPaths))
+	ready := make(chan struct{}, len(consulWatchPaths))
+	for _, path := range consulWatchPaths {
+		wg.Go(func() {
+			errCh <- c.watchIndex(ctx, path, ready, changed)
+		})
+	}
+	for range consulWatchPaths {
+		select {
+		case <-ready:
+		case err := <-errCh:
+			return err
+		}
+	}
+	changed()
+	return <-errCh
+}
+
+// watchIndex runs blocking queries on path until ctx is done or a query fails.
+func (c *ConsulConfig) watchIndex(ctx context.Context, path string, ready chan<- struct{}, changed func()) error {
+	var index uint64
+	for first := true; ; first = false {
+		newIndex, err := c.blockingQuery(ctx, path, index)
+		if err != nil {
+			return err
+		}
+		newIndex = max(newIndex, 1)
+		switch {
+		case first:
+			ready <- struct{}{}
+		case newIndex != index:
+			changed()
+		}
+		if newIndex < index {
+			// index went backwards, e.g. after a snapshot restore
+			index = 0
+			continue
+		}
+		if newIndex == index {
+			continue
+		}
+		index = newIndex
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(consulMinQueryInterval):
+		}
+	}
+}
+
+// blockingQuery waits until the index of path is greater than index, or the wait time is reached,
+// and returns the new index.
+func (c *ConsulConfig) blockingQuery(ctx context.Context, path string, index uint64) (uint64, error) {
+	// the wait time is exceeded by up to 1/16 for jitter
+	ctx, cancel := context.WithTimeout(ctx, consulWaitTime+consulWaitTime/16+10*time.Second)
+	defer cancel()
+
+	query := url.Values{"wait": {consulWaitTime.String()}}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+	}
+	resp, err := c.get(ctx, path, query)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	newIndex, err := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if err != nil {
+		return 0, gperr.Wrap(err, "invalid X-Consul-Index").Subject(path)
+	}
+	return newIndex, nil
+}
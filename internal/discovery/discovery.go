@@ -0,0 +1,74 @@
+package discovery
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/yusing/godoxy/internal/net/gphttp"
+	"github.com/yusing/godoxy/internal/types"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+type (
+	// Source is a service catalog routes are discovered from.
+	Source interface {
+		fmt.Stringer // kind of the source, e.g. "consul"
+
+		// Init sets defaults and creates the client.
+		Init() gperr.Error
+		// Load returns the route entries by alias.
+		Load(ctx context.Context) (Entries, gperr.Error)
+		// Watch blocks until ctx is done or the watch fails.
+		//
+		// changed is called once the watch is established, then on each change.
+		// It is not called after Watch returns.
+		Watch(ctx context.Context, changed func()) error
+	}
+	// Entries are route fields by alias, like route files.
+	Entries map[string]types.LabelMap
+
+	// TLSConfig is the TLS config of the client of a source.
+	TLSConfig struct {
+		CAFile      string `json:"ca_file,omitempty" validate:"omitempty,file"`
+		NoTLSVerify bool   `json:"no_tls_verify,omitempty" yaml:"no_tls_verify,omitempty"`
+	}
+)
+
+// maxResponseSize limits the size of responses read into memory.
+const maxResponseSize = 16 << 20
+
+func (c TLSConfig) httpClient() (*http.Client, gperr.Error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: c.NoTLSVerify, //nolint:gosec // user specified
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, gperr.Wrap(err, "failed to read certificate authority")
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, gperr.New("invalid certificate authority").Subject(c.CAFile)
+		}
+	}
+	return &http.Client{Transport: gphttp.NewTransportWithTLSConfig(tlsConfig)}, nil
+}
+
+func statusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	msg := strings.TrimSpace(string(body))
+	if msg == "" {
+		return gperr.New(resp.Status).Subject(resp.Request.URL.Path)
+	}
+	return gperr.Errorf("%s: %s", resp.Status, msg).Subject(resp.Request.URL.Path)
+}
+
+func readBody(resp *http.Response) ([]byte, error) {
+	return io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+}
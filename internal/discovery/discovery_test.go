@@ -0,0 +1,369 @@
+package discovery
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yusing/godoxy/internal/types"
+	expect "github.com/yusing/goutils/testing"
+)
+
+type testConsul struct {
+	mu        sync.Mutex
+	index     uint64
+	changedCh chan struct{}
+	services  map[string][]consulServiceEntry
+}
+
+func newTestConsul(t *testing.T) (*testConsul, *ConsulConfig) {
+	t.Helper()
+	c := &testConsul{index: 1, changedCh: make(chan struct{}), services: make(map[string][]consulServiceEntry)}
+	srv := httptest.NewServer(c)
+	t.Cleanup(srv.Close)
+	cfg := &ConsulConfig{URL: srv.URL}
+	expect.NoError(t, cfg.Init())
+	return c, cfg
+}
+
+func consulInstance(node, id, service string, port int, tags ...string) consulServiceEntry {
+	var e consulServiceEntry
+	e.Node.Node = node
+	e.Node.Address = "10.0.0." + strconv.Itoa(len(node))
+	e.Service.ID = id
+	e.Service.Service = service
+	e.Service.Port = port
+	e.Service.Tags = tags
+	return e
+}
+
+func (c *testConsul) register(instances ...consulServiceEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, inst := range instances {
+		c.services[inst.Service.Service] = append(c.services[inst.Service.Service], inst)
+	}
+	c.index++
+	close(c.changedCh)
+	c.changedCh = make(chan struct{})
+}
+
+func (c *testConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if index := r.URL.Query().Get("index"); index != "" {
+		c.mu.Lock()
+		blocking := index == strconv.FormatUint(c.index, 10)
+		changedCh := c.changedCh
+		c.mu.Unlock()
+		if blocking {
+			select {
+			case <-changedCh:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(c.index, 10))
+	switch {
+	case r.URL.Path == "/v1/catalog/services":
+		services := make(map[string][]string)
+		for name, instances := range c.services {
+			for _, inst := range instances {
+				services[name] = append(services[name], inst.Service.Tags...)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(services)
+	case r.URL.Path == "/v1/health/state/any":
+		_, _ = w.Write([]byte("[]"))
+	case strings.HasPrefix(r.URL.Path, "/v1/health/service/"):
+		_ = json.NewEncoder(w).Encode(c.services[strings.TrimPrefix(r.URL.Path, "/v1/health/service/")])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestConsulLoad(t *testing.T) {
+	consul, cfg := newTestConsul(t)
+	consul.register(
+		consulInstance("node1", "whoami", "whoami", 8080, "godoxy.aliases=who, whoami", "godoxy.healthcheck.path=/ping"),
+		consulInstance("node1", "api-1", "api", 443, "godoxy"),
+		consulInstance("node22", "api-2", "api", 443, "godoxy", "godoxy.load_balance.mode=iphash"),
+		consulInstance("node1", "db", "db", 5432, "unrelated"),
+	)
+
+	entries, err := cfg.Load(t.Context())
+	expect.NoError(t, err)
+	expect.Equal(t, len(entries), 4)
+
+	for _, alias := range []string{"who", "whoami"} {
+		expect.Equal(t, entries[alias]["host"], any("10.0.0.5"))
+		expect.Equal(t, entries[alias]["port"], any("8080"))
+		expect.Equal(t, entries[alias]["scheme"], any("http"))
+		expect.Equal(t, entries[alias]["healthcheck"], any(types.LabelMap{"path": "/ping"}))
+	}
+
+	api1 := entries["api.node1.api-1"]
+	expect.NotNil(t, api1)
+	expect.Equal(t, api1["scheme"], any("https"))
+	expect.Equal(t, api1["load_balance"], any(types.LabelMap{"link": "api"}))
+	api2 := entries["api.node22.api-2"]
+	expect.NotNil(t, api2)
+	expect.Equal(t, api2["host"], any("10.0.0.6"))
+	expect.Equal(t, api2["load_balance"], any(types.LabelMap{"link": "api", "mode": "iphash"}))
+}
+
+func TestConsulInvalidTag(t *testing.T) {
+	consul, cfg := newTestConsul(t)
+	consul.register(
+		consulInstance("node1", "app", "app", 80, "godoxy.scheme"),
+		consulInstance("node1", "web", "web", 80, "godoxy"),
+	)
+
+	entries, err := cfg.Load(t.Context())
+	expect.ErrorContains(t, err, ErrInvalidConsulTag.Error())
+	expect.Equal(t, len(entries), 1)
+	expect.NotNil(t, entries["web"])
+}
+
+func TestConsulWatch(t *testing.T) {
+	consulMinQueryInterval = time.Millisecond
+	t.Cleanup(func() { consulMinQueryInterval = time.Second })
+
+	consul, cfg := newTestConsul(t)
+	changed := make(chan struct{}, 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = cfg.Watch(t.Context(), func() { changed <- struct{}{} })
+	}()
+	t.Cleanup(func() { <-done })
+
+	waitChanged(t, changed) // established
+	consul.register(consulInstance("node1", "app", "app", 80, "godoxy"))
+	waitChanged(t, changed)
+}
+
+func waitChanged(t *testing.T, changed <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for change")
+	}
+}
+
+type testEtcd struct {
+	mu       sync.Mutex
+	kvs      map[string]string
+	token    string
+	eventsCh chan struct{}
+}
+
+func newTestEtcd(t *testing.T, username string) (*testEtcd, *EtcdConfig) {
+	t.Helper()
+	e := &testEtcd{kvs: make(map[string]string), eventsCh: make(chan struct{}, 1)}
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+	cfg := &EtcdConfig{Endpoints: []string{srv.URL + "/"}, Username: username, Password: "secret"}
+	expect.NoError(t, cfg.Init())
+	return e, cfg
+}
+
+func (e *testEtcd) put(key, value string) {
+	e.mu.Lock()
+	e.kvs[key] = value
+	e.mu.Unlock()
+	e.eventsCh <- struct{}{}
+}
+
+func (e *testEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name          string `json:"name"`
+		Password      string `json:"password"`
+		Key           []byte `json:"key"`
+		RangeEnd      []byte `json:"range_end"`
+		CreateRequest *struct {
+			Key      []byte `json:"key"`
+			RangeEnd []byte `json:"range_end"`
+		} `json:"create_request"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Path == "/v3/auth/authenticate" {
+		if req.Name != "godoxy" || req.Password != "secret" {
+			http.Error(w, "authentication failed", http.StatusBadRequest)
+			return
+		}
+		e.mu.Lock()
+		e.token = "token" + strconv.Itoa(len(e.token))
+		token := e.token
+		e.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": token})
+		return
+	}
+
+	e.mu.Lock()
+	token := e.token
+	e.mu.Unlock()
+	if token != "" && r.Header.Get("Authorization") != token {
+		http.Error(w, "invalid auth token", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		var kvs []etcdKeyValue
+		for k, v := range e.kvs {
+			if k >= string(req.Key) && k < string(req.RangeEnd) {
+				kvs = append(kvs, etcdKeyValue{Key: []byte(k), Value: []byte(v)})
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"kvs": kvs})
+	case "/v3/watch":
+		flusher := w.(http.Flusher)
+		_, _ = w.Write([]byte(`{"result":{"created":true}}` + "\n"))
+		flusher.Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-e.eventsCh:
+				_, _ = w.Write([]byte(`{"result":{"events":[{"kv":{}}]}}` + "\n"))
+				flusher.Flush()
+			}
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestEtcdLoad(t *testing.T) {
+	etcd, cfg := newTestEtcd(t, "godoxy")
+	// the token of the client expired
+	etcd.token, cfg.token = "token", "expired"
+	etcd.kvs = map[string]string{
+		"/godoxy/routes/app":     `{"host": "10.0.0.5", "port": "8080"}`,
+		"/godoxy/routes/db":      "scheme: tcp\nhost: 10.0.0.6\nport: 5432:5432",
+		"/godoxy/routes/sub/key": `{}`,
+		"/godoxy/other":          `{}`,
+	}
+
+	entries, err := cfg.Load(t.Context())
+	expect.ErrorContains(t, err, "/godoxy/routes/sub/key")
+	expect.Equal(t, len(entries), 2)
+	expect.Equal(t, entries["app"]["host"], any("10.0.0.5"))
+	expect.Equal(t, entries["db"]["port"], any("5432:5432"))
+}
+
+func TestEtcdWatch(t *testing.T) {
+	etcd, cfg := newTestEtcd(t, "")
+	changed := make(chan struct{}, 10)
+	go func() {
+		_ = cfg.Watch(t.Context(), func() { changed <- struct{}{} })
+	}()
+
+	waitChanged(t, changed) // established
+	etcd.put("/godoxy/routes/app", `{"host": "10.0.0.5"}`)
+	waitChanged(t, changed)
+}
+
+func TestPrefixRangeEnd(t *testing.T) {
+	expect.Equal(t, prefixRangeEnd([]byte("/godoxy/")), []byte("/godoxy0"))
+	expect.Equal(t, prefixRangeEnd([]byte{'a', 0xff}), []byte{'b'})
+	expect.Equal(t, prefixRangeEnd([]byte{0xff}), []byte{0})
+}
+
+type testHTTP struct {
+	mu           sync.Mutex
+	body         []byte
+	etag         string
+	notModified  int
+	requestCount int
+}
+
+func (h *testHTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.requestCount++
+	if r.Header.Get("Authorization") != "Bearer token" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if h.etag != "" {
+		if r.Header.Get("If-None-Match") == h.etag {
+			h.notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", h.etag)
+	}
+	_, _ = w.Write(h.body)
+}
+
+func (h *testHTTP) set(body, etag string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.body, h.etag = []byte(body), etag
+}
+
+func newTestHTTP(t *testing.T) (*testHTTP, *HTTPConfig) {
+	t.Helper()
+	h := new(testHTTP)
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	cfg := &HTTPConfig{URL: srv.URL, Interval: 10 * time.Millisecond, Headers: map[string]string{"Authorization": "Bearer token"}}
+	expect.NoError(t, cfg.Init())
+	return h, cfg
+}
+
+func TestHTTPLoad(t *testing.T) {
+	h, cfg := newTestHTTP(t)
+	h.set(`{"app": {"host": "10.0.0.5", "port": "8080"}, "x-common": "ignored", "bad": "value"}`, "")
+
+	entries, err := cfg.Load(t.Context())
+	expect.ErrorContains(t, err, "bad")
+	expect.Equal(t, len(entries), 1)
+	expect.Equal(t, entries["app"]["port"], any("8080"))
+
+	cfg.Headers = nil
+	_, err = cfg.Load(t.Context())
+	expect.ErrorContains(t, err, "401")
+}
+
+func TestHTTPWatch(t *testing.T) {
+	for _, etag := range []string{`"v1"`, ""} {
+		t.Run("etag="+etag, func(t *testing.T) {
+			h, cfg := newTestHTTP(t)
+			h.set(`{"app": {"host": "10.0.0.5"}}`, etag)
+
+			changed := make(chan struct{}, 10)
+			go func() {
+				_ = cfg.Watch(t.Context(), func() { changed <- struct{}{} })
+			}()
+			waitChanged(t, changed) // established
+
+			// unchanged responses are not changes
+			time.Sleep(50 * time.Millisecond)
+			expect.Equal(t, len(changed), 0)
+			h.mu.Lock()
+			expect.True(t, h.requestCount > 1)
+			expect.Equal(t, h.notModified > 0, etag != "")
+			h.mu.Unlock()
+
+			h.set(`{"app": {"host": "10.0.0.6"}}`, strings.ReplaceAll(etag, "v1", "v2"))
+			waitChanged(t, changed)
+		})
+	}
+}
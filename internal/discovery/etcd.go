@@ -0,0 +1,263 @@
+package discovery
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/bytedance/sonic"
+	"github.com/goccy/go-yaml"
+	"github.com/yusing/godoxy/internal/types"
+	gperr "github.com/yusing/goutils/errs"
+	strutils "github.com/yusing/goutils/strings"
+)
+
+// EtcdConfig discovers routes from keys under a prefix in etcd.
+//
+// Each key "<prefix><alias>" holds a route in YAML or JSON, like an entry of a route file.
+type EtcdConfig struct {
+	Endpoints []string          `json:"endpoints" validate:"required,min=1,dive,url"`
+	Prefix    string            `json:"prefix,omitempty"` // default is "/godoxy/routes/"
+	Username  string            `json:"username,omitempty"`
+	Password  strutils.Redacted `json:"password,omitempty"`
+	TLSConfig
+
+	client  *http.Client
+	tokenMu sync.Mutex
+	token   string
+}
+
+type (
+	etcdKeyValue struct {
+		Key   []byte `json:"key"` // base64 encoded in JSON
+		Value []byte `json:"value"`
+	}
+	etcdRangeResponse struct {
+		Kvs []etcdKeyValue `json:"kvs"`
+	}
+	etcdWatchResponse struct {
+		Result *struct {
+			Created         bool       `json:"created"`
+			Canceled        bool       `json:"canceled"`
+			CompactRevision string     `json:"compact_revision"`
+			CancelReason    string     `json:"cancel_reason"`
+			Events          []struct{} `json:"events"`
+		} `json:"result"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+)
+
+const EtcdDefaultPrefix = "/godoxy/routes/"
+
+var (
+	ErrEtcdUnauthenticated = gperr.New("unauthenticated")
+	ErrEtcdWatchCanceled   = gperr.New("watch canceled")
+	ErrEtcdWatchClosed     = gperr.New("watch closed by server")
+)
+
+func (c *EtcdConfig) String() string {
+	return "etcd"
+}
+
+// Init implements Source.
+func (c *EtcdConfig) Init() gperr.Error {
+	c.Prefix = cmp.Or(c.Prefix, EtcdDefaultPrefix)
+	for i, endpoint := range c.Endpoints {
+		c.Endpoints[i] = strings.TrimSuffix(endpoint, "/")
+	}
+	client, err := c.httpClient()
+	if err != nil {
+		return err
+	}
+	c.client = client
+	return nil
+}
+
+// post calls a method of the JSON gateway of the first reachable endpoint.
+//
+// With authentication enabled, a token is requested and renewed when it expires.
+func (c *EtcdConfig) post(ctx context.Context, path string, body any) (*http.Response, error) {
+	data, err := sonic.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, endpoint := range c.Endpoints {
+		resp, err := c.postEndpoint(ctx, endpoint, path, data)
+		if errors.Is(err, ErrEtcdUnauthenticated) && c.Username != "" {
+			c.setToken("")
+			resp, err = c.postEndpoint(ctx, endpoint, path, data)
+		}
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		errs = append(errs, gperr.PrependSubject(endpoint, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (c *EtcdConfig) postEndpoint(ctx context.Context, endpoint, path string, data []byte) (*http.Response, error) {
+	token, err := c.getToken(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp, nil
+	case http.StatusUnauthorized:
+		resp.Body.Close()
+		return nil, ErrEtcdUnauthenticated.Subject(path)
+	default:
+		defer resp.Body.Close()
+		return nil, statusError(resp)
+	}
+}
+
+func (c *EtcdConfig) getToken(ctx context.Context, endpoint string) (string, error) {
+	if c.Username == "" {
+		return "", nil
+	}
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	if c.token != "" {
+		return c.token, nil
+	}
+
+	data, err := sonic.Marshal(map[string]string{"name": c.Username, "password": c.Password.String()})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/v3/auth/authenticate", bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", gperr.Wrap(statusError(resp), "authentication failed")
+	}
+	var auth struct {
+		Token string `json:"token"`
+	}
+	if err := sonic.ConfigDefault.NewDecoder(resp.Body).Decode(&auth); err != nil {
+		return "", gperr.Wrap(err, "failed to decode authentication response")
+	}
+	c.token = auth.Token
+	return c.token, nil
+}
+
+func (c *EtcdConfig) setToken(token string) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	c.token = token
+}
+
+// keyRange returns the key range of the prefix.
+func (c *EtcdConfig) keyRange() map[string]any {
+	return map[string]any{
+		"key":       []byte(c.Prefix),
+		"range_end": prefixRangeEnd([]byte(c.Prefix)),
+	}
+}
+
+// prefixRangeEnd returns the end of the range of keys with prefix, i.e. the prefix with the last byte incremented.
+func prefixRangeEnd(prefix []byte) []byte {
+	end := bytes.Clone(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// all keys
+	return []byte{0}
+}
+
+// Load implements Source.
+func (c *EtcdConfig) Load(ctx context.Context) (Entries, gperr.Error) {
+	resp, err := c.post(ctx, "/v3/kv/range", c.keyRange())
+	if err != nil {
+		return nil, gperr.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	var kvs etcdRangeResponse
+	if err := sonic.ConfigDefault.NewDecoder(resp.Body).Decode(&kvs); err != nil {
+		return nil, gperr.Wrap(err, "failed to decode range response")
+	}
+
+	entries := make(Entries, len(kvs.Kvs))
+	errs := gperr.NewBuilder("")
+	for _, kv := range kvs.Kvs {
+		alias := strings.TrimPrefix(string(kv.Key), c.Prefix)
+		if alias == "" || strings.Contains(alias, "/") {
+			errs.Add(gperr.New("invalid key, expect <prefix><alias>").Subject(string(kv.Key)))
+			continue
+		}
+		entry := make(types.LabelMap)
+		if err := yaml.Unmarshal(kv.Value, &entry); err != nil {
+			errs.Add(gperr.Wrap(err).Subject(string(kv.Key)))
+			continue
+		}
+		entries[alias] = entry
+	}
+	return entries, errs.Error()
+}
+
+// Watch implements Source.
+func (c *EtcdConfig) Watch(ctx context.Context, changed func()) error {
+	resp, err := c.post(ctx, "/v3/watch", map[string]any{"create_request": c.keyRange()})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := sonic.ConfigDefault.NewDecoder(resp.Body)
+	for {
+		var msg etcdWatchResponse
+		if err := dec.Decode(&msg); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, io.EOF) {
+				return ErrEtcdWatchClosed
+			}
+			return gperr.Wrap(err, "failed to decode watch response")
+		}
+		switch {
+		case msg.Error != nil:
+			return gperr.New(msg.Error.Message)
+		case msg.Result == nil:
+		case msg.Result.Canceled:
+			return ErrEtcdWatchCanceled.Withf("%s", cmp.Or(msg.Result.CancelReason, "compacted at revision "+msg.Result.CompactRevision))
+		case msg.Result.Created, len(msg.Result.Events) > 0:
+			changed()
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package discovery
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/yusing/godoxy/internal/types"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// HTTPConfig discovers routes from an HTTP endpoint polled at an interval.
+//
+// The response is a mapping of aliases to routes in JSON or YAML, like a route file.
+type HTTPConfig struct {
+	URL      string            `json:"url" validate:"required,url"`
+	Interval time.Duration     `json:"interval,omitempty"` // default is 30s
+	Headers  map[string]string `json:"headers,omitempty"`  // e.g. Authorization
+	TLSConfig
+
+	client *http.Client
+}
+
+const HTTPDefaultInterval = 30 * time.Second
+
+func (c *HTTPConfig) String() string {
+	return "http"
+}
+
+// Init implements Source.
+func (c *HTTPConfig) Init() gperr.Error {
+	c.Interval = cmp.Or(c.Interval, HTTPDefaultInterval)
+	client, err := c.httpClient()
+	if err != nil {
+		return err
+	}
+	c.client = client
+	return nil
+}
+
+// get requests the route definitions, resp is nil if etag is not empty and the definitions are not modified.
+func (c *HTTPConfig) get(ctx context.Context, etag string) (resp *http.Response, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json, application/yaml;q=0.9")
+	for k, v := range c.Headers {
+		req.Header.Set(k, v)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err = c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return resp, nil
+	case resp.StatusCode == http.StatusNotModified && etag != "":
+		resp.Body.Close()
+		return nil, nil
+	default:
+		defer resp.Body.Close()
+		return nil, statusError(resp)
+	}
+}
+
+// Load implements Source.
+func (c *HTTPConfig) Load(ctx context.Context) (Entries, gperr.Error) {
+	resp, err := c.get(ctx, "")
+	if err != nil {
+		return nil, gperr.Wrap(err)
+	}
+	defer resp.Body.Close()
+	body, err := readBody(resp)
+	if err != nil {
+		return nil, gperr.Wrap(err)
+	}
+
+	var m map[string]any
+	if err := yaml.Unmarshal(body, &m); err != nil {
+		return nil, gperr.Wrap(err, "invalid route definitions")
+	}
+	entries := make(Entries, len(m))
+	errs := gperr.NewBuilder("")
+	for alias, v := range m {
+		// x- prefixed keys are for YAML anchors
+		if strings.HasPrefix(alias, "x-") {
+			continue
+		}
+		entry, ok := v.(map[string]any)
+		if !ok {
+			errs.Add(gperr.Errorf("expect mapping, got %T", v).Subject(alias))
+			continue
+		}
+		entries[alias] = types.LabelMap(entry)
+	}
+	return entries, errs.Error()
+}
+
+// Watch implements Source.
+//
+// The endpoint is polled with If-None-Match, responses without ETag are compared by checksum.
+func (c *HTTPConfig) Watch(ctx context.Context, changed func()) error {
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+
+	var etag string
+	var sum [sha256.Size]byte
+	for first := true; ; first = false {
+		resp, err := c.get(ctx, etag)
+		if err != nil {
+			return err
+		}
+		if resp != nil {
+			body, err := readBody(resp)
+			resp.Body.Close()
+			if err != nil {
+				return err
+			}
+			newSum := sha256.Sum256(body)
+			if first || newSum != sum {
+				changed()
+			}
+			etag, sum = resp.Header.Get("ETag"), newSum
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
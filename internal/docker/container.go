@@ -119,18 +119,35 @@ func UpdatePorts(ctx context.Context, c *types.Container) error {
 	return nil
 }
 
+// DockerComposeProject returns the compose project of the container,
+// podman-compose projects and swarm stacks are treated as compose projects.
 func DockerComposeProject(c *types.Container) string {
-	return c.Labels["com.docker.compose.project"]
+	if proj := c.Labels[labelComposeProject]; proj != "" {
+		return proj
+	}
+	if proj := c.Labels[labelPodmanComposeProject]; proj != "" {
+		return proj
+	}
+	return c.Labels[labelStackNamespace]
 }
 
 func DockerComposeService(c *types.Container) string {
-	return c.Labels["com.docker.compose.service"]
+	if svc := c.Labels[labelComposeService]; svc != "" {
+		return svc
+	}
+	return c.Labels[labelPodmanComposeService]
+}
+
+// IsSwarmTask returns whether the container is created by a swarm service.
+func IsSwarmTask(c *types.Container) bool {
+	_, ok := c.Labels[LabelSwarmServiceID]
+	return ok
 }
 
 func Dependencies(c *types.Container) []string {
 	deps := c.Labels[LabelDependsOn]
 	if deps == "" {
-		deps = c.Labels["com.docker.compose.depends_on"]
+		deps = c.Labels[labelComposeDependsOn]
 	}
 	return strings.Split(deps, ",")
 }
@@ -2,6 +2,7 @@ package docker
 
 import (
 	"testing"
+	"time"
 
 	"github.com/moby/moby/api/types/container"
 	"github.com/yusing/godoxy/internal/types"
@@ -116,3 +117,45 @@ func TestImageNameParsing(t *testing.T) {
 		})
 	}
 }
+
+func TestBlacklistedImage(t *testing.T) {
+	tests := []struct {
+		image       string
+		blacklisted bool
+	}{
+		{"localhost/podman-pause:5.0.2-1713312000", true},
+		{"registry.k8s.io/pause:3.9", true},
+		{"gcr.io/zenika-hub/alpine-chrome:latest", true},
+		{"postgres:16", true},
+		{"ghcr.io/someone/pause:latest", false},
+		{"nginx:latest", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			helper := containerHelper{&container.Summary{Image: tt.image}}
+			expect.Equal(t, IsBlacklistedImage(helper.parseImage()), tt.blacklisted)
+		})
+	}
+}
+
+func TestContainerIdlewatcherLabels(t *testing.T) {
+	c := FromDocker(&container.Summary{Names: []string{"test"}, State: "test", Labels: map[string]string{
+		LabelIdleTimeout: "10m",
+		LabelActivity:    "connections: true\ncpu: 20\n",
+		LabelSchedules:   "- start: \"0 8 * * mon-fri\"\n  duration: 10h\n  idle_timeout: 1h\n",
+	}}, types.DockerProviderConfig{})
+	expect.Nil(t, c.Errors)
+	cfg := c.IdlewatcherConfig
+	expect.NotNil(t, cfg)
+	expect.NotNil(t, cfg.Activity)
+	expect.True(t, cfg.Activity.Connections)
+	expect.Equal(t, cfg.Activity.CPU, 20)
+	expect.Equal(t, cfg.Activity.Interval, types.ActivityIntervalDefault)
+	expect.Equal(t, len(cfg.Schedules), 1)
+	expect.Equal(t, cfg.Schedules[0].Duration, 10*time.Hour)
+	expect.Equal(t, cfg.Schedules[0].IdleTimeout, time.Hour)
+
+	// idlewatcher labels are not route labels
+	_, ok := c.Labels[LabelActivity]
+	expect.False(t, ok)
+}
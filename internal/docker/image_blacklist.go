@@ -32,6 +32,11 @@ var imageBlacklistFullname = map[string]struct{}{
 	// image update watchers
 	"watchtower": {},
 	"getwud/wud": {},
+
+	// infra containers of podman pods
+	"localhost/podman-pause": {},
+	"k8s.gcr.io/pause":       {},
+	"registry.k8s.io/pause":  {},
 }
 
 var authorBlacklist = map[string]struct{}{
@@ -52,7 +57,7 @@ func IsBlacklistedImage(image *types.ContainerImage) bool {
 	if ok {
 		return true
 	}
-	_, ok = imageBlacklistFullname[image.Author+":"+image.Name]
+	_, ok = imageBlacklistFullname[image.Author+"/"+image.Name]
 	if ok {
 		return true
 	}
@@ -15,9 +15,24 @@ const (
 	LabelStartEndpoint = NSProxy + ".start_endpoint"
 	LabelDependsOn     = NSProxy + ".depends_on"
 	LabelNoLoadingPage = NSProxy + ".no_loading_page" // No loading page when using idlewatcher
+	LabelPendingConns  = NSProxy + ".pending_conns"
+	LabelPendingPkts   = NSProxy + ".pending_packets"
+	LabelActivity      = NSProxy + ".activity"  // yaml mapping
+	LabelSchedules     = NSProxy + ".schedules" // yaml list
 	LabelNetwork       = NSProxy + ".network"
 )
 
+const (
+	labelComposeProject       = "com.docker.compose.project"
+	labelComposeService       = "com.docker.compose.service"
+	labelComposeDependsOn     = "com.docker.compose.depends_on"
+	labelPodmanComposeProject = "io.podman.compose.project"
+	labelPodmanComposeService = "io.podman.compose.service"
+	labelStackNamespace       = "com.docker.stack.namespace"
+
+	LabelSwarmServiceID = "com.docker.swarm.service.id" // set by docker on containers of swarm tasks
+)
+
 // key: label, value: key in IdlewatcherConfig
 var idlewatcherLabels = map[string]string{
 	LabelIdleTimeout:   "idle_timeout",
@@ -28,4 +43,8 @@ var idlewatcherLabels = map[string]string{
 	LabelStartEndpoint: "start_endpoint",
 	LabelDependsOn:     "depends_on",
 	LabelNoLoadingPage: "no_loading_page",
+	LabelPendingConns:  "pending_conns",
+	LabelPendingPkts:   "pending_packets",
+	LabelActivity:      "activity",
+	LabelSchedules:     "schedules",
 }
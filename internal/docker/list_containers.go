@@ -2,6 +2,7 @@ package docker
 
 import (
 	"context"
+	"strings"
 
 	"github.com/moby/moby/api/types/container"
 	"github.com/moby/moby/client"
@@ -31,9 +32,44 @@ func ListContainers(ctx context.Context, dockerCfg types.DockerProviderConfig) (
 	if err != nil {
 		return nil, err
 	}
+	inheritNetworkSettings(containers.Items)
 	return containers.Items, nil
 }
 
+// inheritNetworkSettings copies the network settings and ports of the network container
+// to the containers joining its network namespace (network mode "container:<id or name>"),
+// e.g. members of a podman pod or containers with `network_mode: service:vpn`.
+func inheritNetworkSettings(containers []container.Summary) {
+	byRef := make(map[string]*container.Summary, len(containers))
+	for i := range containers {
+		c := &containers[i]
+		byRef[c.ID] = c
+		for _, name := range c.Names {
+			byRef[strings.TrimPrefix(name, "/")] = c
+		}
+	}
+	for i := range containers {
+		c := &containers[i]
+		ref, ok := strings.CutPrefix(c.HostConfig.NetworkMode, "container:")
+		if !ok {
+			continue
+		}
+		netContainer, ok := byRef[ref]
+		if !ok {
+			continue
+		}
+		if c.NetworkSettings == nil || len(c.NetworkSettings.Networks) == 0 {
+			c.NetworkSettings = netContainer.NetworkSettings
+		}
+		if len(c.Ports) == 0 {
+			c.Ports = netContainer.Ports
+		}
+		if netContainer.HostConfig.NetworkMode == "host" {
+			c.HostConfig.NetworkMode = "host"
+		}
+	}
+}
+
 func IsErrConnectionFailed(err error) bool {
 	return client.IsErrConnectionFailed(err)
 }
@@ -0,0 +1,139 @@
+package docker
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/api/types/network"
+	"github.com/moby/moby/api/types/swarm"
+	"github.com/moby/moby/client"
+	"github.com/yusing/godoxy/internal/types"
+)
+
+// SwarmService is a swarm service with its running tasks, sorted by slot.
+type SwarmService struct {
+	swarm.Service
+	Tasks []swarm.Task
+}
+
+var ErrSwarmIdlewatcher = errors.New("idlewatcher is not supported for swarm services")
+
+// ListSwarmServices lists the swarm services and their running tasks.
+//
+// The docker host must be a swarm manager.
+func ListSwarmServices(ctx context.Context, dockerCfg types.DockerProviderConfig) ([]SwarmService, error) {
+	dockerClient, err := NewClient(dockerCfg)
+	if err != nil {
+		return nil, err
+	}
+	defer dockerClient.Close()
+
+	services, err := dockerClient.ServiceList(ctx, client.ServiceListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := ListSwarmTasks(ctx, dockerClient)
+	if err != nil {
+		return nil, err
+	}
+
+	tasksByService := make(map[string][]swarm.Task, len(services.Items))
+	for _, task := range tasks {
+		tasksByService[task.ServiceID] = append(tasksByService[task.ServiceID], task)
+	}
+
+	res := make([]SwarmService, len(services.Items))
+	for i, svc := range services.Items {
+		tasks := tasksByService[svc.ID]
+		slices.SortFunc(tasks, func(a, b swarm.Task) int {
+			return cmp.Or(cmp.Compare(a.Slot, b.Slot), strings.Compare(a.NodeID, b.NodeID))
+		})
+		res[i] = SwarmService{Service: svc, Tasks: tasks}
+	}
+	return res, nil
+}
+
+// ListSwarmTasks lists the running tasks of all swarm services.
+func ListSwarmTasks(ctx context.Context, dockerClient *SharedClient) ([]swarm.Task, error) {
+	tasks, err := dockerClient.TaskList(ctx, client.TaskListOptions{
+		Filters: make(client.Filters).Add("desired-state", string(swarm.TaskStateRunning)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	running := tasks.Items[:0]
+	for _, task := range tasks.Items {
+		if task.Status.State == swarm.TaskStateRunning {
+			running = append(running, task)
+		}
+	}
+	return running, nil
+}
+
+// FromSwarmTask converts a running task of a swarm service to a container.
+//
+// Labels of the container spec are overridden by service labels (`deploy.labels`),
+// the private hostname is the task IP on the selected overlay network,
+// published ports of the routing mesh are used as public ports.
+func FromSwarmTask(svc *swarm.Service, task *swarm.Task, dockerCfg types.DockerProviderConfig) *types.Container {
+	labels := make(map[string]string)
+	var image string
+	if spec := svc.Spec.TaskTemplate.ContainerSpec; spec != nil {
+		maps.Copy(labels, spec.Labels)
+		image = spec.Image
+	}
+	maps.Copy(labels, svc.Spec.Labels)
+
+	image, digest, _ := strings.Cut(image, "@")
+	summary := container.Summary{
+		ID:      task.ID,
+		Names:   []string{svc.Spec.Name},
+		Image:   image,
+		ImageID: digest,
+		Labels:  labels,
+		State:   container.StateRunning,
+		NetworkSettings: &container.NetworkSettingsSummary{
+			Networks: make(map[string]*network.EndpointSettings, len(task.NetworksAttachments)),
+		},
+	}
+
+	for _, attachment := range task.NetworksAttachments {
+		// the ingress network is for the routing mesh only
+		if attachment.Network.Spec.Ingress || len(attachment.Addresses) == 0 {
+			continue
+		}
+		summary.NetworkSettings.Networks[attachment.Network.Spec.Name] = &network.EndpointSettings{
+			NetworkID: attachment.Network.ID,
+			IPAddress: attachment.Addresses[0].Addr(),
+		}
+	}
+
+	for _, port := range svc.Endpoint.Ports {
+		p := container.PortSummary{
+			PrivatePort: uint16(port.TargetPort), //nolint:gosec
+			Type:        string(port.Protocol),
+		}
+		// ports published in host mode are only reachable on the node running the task
+		if port.PublishMode == swarm.PortConfigPublishModeIngress {
+			p.PublicPort = uint16(port.PublishedPort) //nolint:gosec
+		}
+		summary.Ports = append(summary.Ports, p)
+	}
+
+	res := FromDocker(&summary, dockerCfg)
+	res.SwarmService = &types.SwarmService{
+		ID:       svc.ID,
+		Name:     svc.Spec.Name,
+		TaskSlot: task.Slot,
+	}
+	if res.IdlewatcherConfig != nil {
+		res.IdlewatcherConfig = nil
+		addError(res, ErrSwarmIdlewatcher)
+	}
+	return res
+}
@@ -0,0 +1,141 @@
+package docker
+
+import (
+	"net/netip"
+	"strconv"
+	"testing"
+
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/api/types/network"
+	"github.com/moby/moby/api/types/swarm"
+	"github.com/moby/moby/client"
+	"github.com/yusing/godoxy/internal/types"
+	expect "github.com/yusing/goutils/testing"
+)
+
+func testSwarmService() *swarm.Service {
+	return &swarm.Service{
+		ID: "svc1",
+		Spec: swarm.ServiceSpec{
+			Annotations: swarm.Annotations{
+				Name: "app_web",
+				Labels: map[string]string{
+					labelStackNamespace: "app",
+					"proxy.aliases":     "web",
+					"proxy.web.port":    "8080",
+				},
+			},
+			TaskTemplate: swarm.TaskSpec{
+				ContainerSpec: &swarm.ContainerSpec{
+					Image: "nginx:1.27@sha256:abcd",
+					Labels: map[string]string{
+						"proxy.aliases":    "container",
+						"proxy.web.scheme": "http",
+					},
+				},
+			},
+		},
+		Endpoint: swarm.Endpoint{
+			Ports: []swarm.PortConfig{
+				{Protocol: "tcp", TargetPort: 80, PublishedPort: 8000, PublishMode: swarm.PortConfigPublishModeIngress},
+				{Protocol: "tcp", TargetPort: 443, PublishedPort: 8443, PublishMode: swarm.PortConfigPublishModeHost},
+			},
+		},
+	}
+}
+
+func testSwarmTask(slot int, ip string) *swarm.Task {
+	return &swarm.Task{
+		ID:        "task" + strconv.Itoa(slot),
+		ServiceID: "svc1",
+		Slot:      slot,
+		NetworksAttachments: []swarm.NetworkAttachment{
+			{
+				Network:   swarm.Network{ID: "ingress", Spec: swarm.NetworkSpec{Annotations: swarm.Annotations{Name: "ingress"}, Ingress: true}},
+				Addresses: []netip.Prefix{netip.MustParsePrefix("10.0.0.5/24")},
+			},
+			{
+				Network:   swarm.Network{ID: "net1", Spec: swarm.NetworkSpec{Annotations: swarm.Annotations{Name: "app_frontend"}}},
+				Addresses: []netip.Prefix{netip.MustParsePrefix(ip + "/24")},
+			},
+		},
+	}
+}
+
+func TestFromSwarmTask(t *testing.T) {
+	svc := testSwarmService()
+	svc.Spec.Labels[LabelNetwork] = "frontend"
+	c := FromSwarmTask(svc, testSwarmTask(1, "10.0.1.5"), types.DockerProviderConfig{URL: client.DefaultDockerHost, Swarm: true})
+
+	expect.True(t, c.Errors == nil)
+	expect.Equal(t, c.ContainerName, "app_web")
+	expect.Equal(t, c.Aliases, []string{"web"}) // service labels take precedence
+	expect.Equal(t, c.Labels["proxy.web.scheme"], "http")
+	expect.Equal(t, c.Image.Name, "nginx")
+	expect.Equal(t, c.Image.Tag, "1.27")
+	expect.True(t, c.Running)
+	expect.Equal(t, c.Network, "app_frontend")
+	expect.Equal(t, c.PrivateHostname, "10.0.1.5")
+	expect.Equal(t, c.PublicPortMapping[8000].PrivatePort, 80)
+	_, ok := c.PublicPortMapping[8443]
+	expect.False(t, ok)
+	expect.Equal(t, c.PrivatePortMapping[443].PublicPort, 0)
+	expect.Equal(t, *c.SwarmService, types.SwarmService{ID: "svc1", Name: "app_web", TaskSlot: 1})
+	expect.Equal(t, DockerComposeProject(c), "app")
+}
+
+func TestFromSwarmTaskIdlewatcher(t *testing.T) {
+	svc := testSwarmService()
+	svc.Spec.Labels[LabelIdleTimeout] = "1h"
+	c := FromSwarmTask(svc, testSwarmTask(1, "10.0.1.5"), types.DockerProviderConfig{URL: client.DefaultDockerHost, Swarm: true})
+	expect.True(t, c.IdlewatcherConfig == nil)
+	expect.ErrorContains(t, c.Errors, ErrSwarmIdlewatcher.Error())
+}
+
+func TestInheritNetworkSettings(t *testing.T) {
+	podNetwork := &container.NetworkSettingsSummary{
+		Networks: map[string]*network.EndpointSettings{
+			"podman": {IPAddress: netip.MustParseAddr("10.88.0.2")},
+		},
+	}
+	containers := []container.Summary{
+		{
+			ID:              "infra",
+			Names:           []string{"/pod-infra"},
+			NetworkSettings: podNetwork,
+			Ports:           []container.PortSummary{{PrivatePort: 80, PublicPort: 8080, Type: "tcp"}},
+		},
+		{ID: "member1", Names: []string{"/app"}},
+		{ID: "member2", Names: []string{"/db"}},
+		{ID: "other", Names: []string{"/other"}},
+	}
+	containers[1].HostConfig.NetworkMode = "container:infra"
+	containers[2].HostConfig.NetworkMode = "container:pod-infra"
+	containers[3].HostConfig.NetworkMode = "container:missing"
+
+	inheritNetworkSettings(containers)
+
+	for _, c := range containers[1:3] {
+		expect.Equal(t, c.NetworkSettings, podNetwork)
+		expect.Equal(t, len(c.Ports), 1)
+	}
+	expect.True(t, containers[3].NetworkSettings == nil)
+}
+
+func TestDockerComposeProject(t *testing.T) {
+	tests := []struct {
+		labels  map[string]string
+		project string
+		service string
+	}{
+		{map[string]string{labelComposeProject: "proj", labelComposeService: "svc"}, "proj", "svc"},
+		{map[string]string{labelPodmanComposeProject: "proj", labelPodmanComposeService: "svc"}, "proj", "svc"},
+		{map[string]string{labelStackNamespace: "stack"}, "stack", ""},
+		{map[string]string{}, "", ""},
+	}
+	for _, tt := range tests {
+		c := &types.Container{Labels: tt.labels}
+		expect.Equal(t, DockerComposeProject(c), tt.project)
+		expect.Equal(t, DockerComposeService(c), tt.service)
+	}
+}
@@ -96,6 +96,7 @@ func (ep *Entrypoint) FindRoute(s string) types.HTTPRoute {
 }
 
 func (ep *Entrypoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = accesslog.WithAnnotations(r)
 	if ep.accessLogger != nil {
 		rec := accesslog.GetResponseRecorder(w)
 		w = rec
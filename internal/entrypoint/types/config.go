@@ -9,6 +9,8 @@ type Config struct {
 	SupportProxyProtocol bool `json:"support_proxy_protocol"`
 	Rules                struct {
 		NotFound rules.Rules `json:"not_found"`
+		// IPListURLs are the URLs allowed in `remote url(<url>)`.
+		IPListURLs []string `json:"ip_list_urls" validate:"dive,url"`
 	} `json:"rules"`
 	Middlewares []map[string]any               `json:"middlewares"`
 	AccessLog   *accesslog.RequestLoggerConfig `json:"access_log" validate:"omitempty"`
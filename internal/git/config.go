@@ -0,0 +1,94 @@
+package git
+
+import (
+	"cmp"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/yusing/godoxy/internal/net/gphttp"
+	gperr "github.com/yusing/goutils/errs"
+	strutils "github.com/yusing/goutils/strings"
+)
+
+// Config is a Git repository route files are loaded from.
+type Config struct {
+	URL           string            `json:"url" validate:"required,url"` // HTTP(S) clone URL
+	Ref           string            `json:"ref,omitempty"`               // branch, tag or commit, default is the default branch
+	Path          string            `json:"path,omitempty"`              // directory of the route files, default is the repository root
+	Username      string            `json:"username,omitempty"`          // default is "git"
+	Token         strutils.Redacted `json:"token,omitempty"`             // password or access token
+	Interval      time.Duration     `json:"interval,omitempty"`          // poll interval, default is 5m
+	WebhookSecret strutils.Redacted `json:"webhook_secret,omitempty"`    // webhook is disabled if empty
+	CAFile        string            `json:"ca_file,omitempty" validate:"omitempty,file"`
+	NoTLSVerify   bool              `json:"no_tls_verify,omitempty" yaml:"no_tls_verify,omitempty"`
+
+	remote *Remote
+}
+
+const (
+	DefaultInterval = 5 * time.Minute
+	DefaultUsername = "git"
+)
+
+var ErrUnsupportedURL = gperr.New("unsupported repository URL, only http and https are supported")
+
+// Init sets defaults and creates the client.
+func (c *Config) Init() gperr.Error {
+	c.Interval = cmp.Or(c.Interval, DefaultInterval)
+
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return gperr.Wrap(err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrUnsupportedURL.Subject(c.URL)
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: c.NoTLSVerify, //nolint:gosec // user specified
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return gperr.Wrap(err, "failed to read certificate authority")
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return gperr.New("invalid certificate authority").Subject(c.CAFile)
+		}
+	}
+
+	remote, err := newRemote(strings.TrimSuffix(c.URL, "/"), &http.Client{Transport: gphttp.NewTransportWithTLSConfig(tlsConfig)})
+	if err != nil {
+		return gperr.Wrap(err)
+	}
+	if c.Token != "" {
+		remote.auth = &githttp.BasicAuth{
+			Username: cmp.Or(c.Username, DefaultUsername),
+			Password: c.Token.String(),
+		}
+	}
+	c.remote = remote
+	return nil
+}
+
+// Remote returns the client of the repository, Init must be called first.
+func (c *Config) Remote() *Remote {
+	return c.remote
+}
+
+// String returns the repository URL without credentials.
+func (c *Config) String() string {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return c.URL
+	}
+	u.User = nil
+	return u.String()
+}
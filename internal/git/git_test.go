@@ -0,0 +1,126 @@
+package git_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/yusing/godoxy/internal/git"
+	"github.com/yusing/godoxy/internal/git/gittest"
+	expect "github.com/yusing/goutils/testing"
+)
+
+func newTestRemote(t *testing.T, srv *gittest.Server) (*git.Config, *git.Remote) {
+	t.Helper()
+	cfg := srv.Config()
+	cfg.Path = "/routes/"
+	expect.NoError(t, cfg.Init())
+	return cfg, cfg.Remote()
+}
+
+func TestResolveRef(t *testing.T) {
+	srv := gittest.NewServer(t)
+	commit := srv.Commit(map[string]string{"routes/app.yml": "app:\n  host: 10.0.0.5\n"})
+	tag := srv.Tag("v1")
+	_, remote := newTestRemote(t, srv)
+	ctx := t.Context()
+
+	got, err := remote.ResolveRef(ctx, "")
+	expect.NoError(t, err)
+	expect.Equal(t, got, commit)
+
+	got, err = remote.ResolveRef(ctx, "main")
+	expect.NoError(t, err)
+	expect.Equal(t, got, commit)
+
+	// annotated tags are peeled
+	got, err = remote.ResolveRef(ctx, "v1")
+	expect.NoError(t, err)
+	expect.Equal(t, got, commit)
+
+	refs, err := remote.LsRefs(ctx, "refs/tags/")
+	expect.NoError(t, err)
+	expect.Equal(t, refs, []git.Ref{{Name: "refs/tags/v1", ID: tag, Peeled: commit}})
+
+	pinned := strings.Repeat("a", 40)
+	got, err = remote.ResolveRef(ctx, pinned)
+	expect.NoError(t, err)
+	expect.Equal(t, got, pinned)
+
+	_, err = remote.ResolveRef(ctx, "missing")
+	expect.ErrorIs(t, git.ErrRefNotFound, err)
+}
+
+func TestFiles(t *testing.T) {
+	srv := gittest.NewServer(t)
+	srv.Commit(map[string]string{"routes/old.yml": "old:\n  host: 10.0.0.4\n"})
+	commit := srv.Commit(map[string]string{
+		"README.md":          "# routes\n",
+		"routes/app.yml":     "app:\n  host: 10.0.0.5\n",
+		"routes/db.yml":      "db:\n  host: 10.0.0.6\n",
+		"routes/nested/x.md": "not walked\n",
+	})
+	cfg, remote := newTestRemote(t, srv)
+
+	files, err := remote.Files(t.Context(), commit, cfg.Path)
+	expect.NoError(t, err)
+	expect.Equal(t, len(files), 2)
+	expect.Equal(t, string(files["app.yml"]), "app:\n  host: 10.0.0.5\n")
+	expect.Equal(t, string(files["db.yml"]), "db:\n  host: 10.0.0.6\n")
+	expect.Equal(t, srv.Depth(), 1)
+
+	_, err = remote.Files(t.Context(), commit, "missing")
+	expect.ErrorIs(t, git.ErrPathNotFound, err)
+
+	_, err = remote.Files(t.Context(), strings.Repeat("b", 40), "")
+	expect.True(t, err != nil)
+}
+
+func TestUnauthorized(t *testing.T) {
+	srv := gittest.NewServer(t)
+	srv.Token = "secret"
+	srv.Commit(map[string]string{"routes/app.yml": "app:\n  host: 10.0.0.5\n"})
+
+	_, remote := newTestRemote(t, srv)
+	_, err := remote.ResolveRef(t.Context(), "")
+	expect.NoError(t, err)
+
+	srv.Token = "other"
+	_, err = remote.ResolveRef(t.Context(), "")
+	expect.True(t, errors.Is(err, transport.ErrAuthenticationRequired))
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	body := []byte(`{"ref":"refs/heads/main"}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	sig := hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name   string
+		header http.Header
+		ok     bool
+	}{
+		{"github", http.Header{"X-Hub-Signature-256": {"sha256=" + sig}}, true},
+		{"github invalid", http.Header{"X-Hub-Signature-256": {"sha256=" + strings.Repeat("0", 64)}}, false},
+		{"gitea", http.Header{"X-Gitea-Signature": {sig}}, true},
+		{"gitlab", http.Header{"X-Gitlab-Token": {"s3cret"}}, true},
+		{"gitlab invalid", http.Header{"X-Gitlab-Token": {"wrong"}}, false},
+		{"missing", http.Header{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := git.VerifyWebhook("s3cret", tt.header, body)
+			if tt.ok {
+				expect.NoError(t, err)
+			} else {
+				expect.ErrorIs(t, git.ErrInvalidWebhookSignature, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+// Package gittest provides an in-process fake Git smart HTTP server for tests.
+//
+// It serves a repository with a single branch "main" and annotated tags,
+// supporting shallow fetches of single commits with side-band-64k.
+package gittest
+
+import (
+	"bytes"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/sideband"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/yusing/godoxy/internal/git"
+	strutils "github.com/yusing/goutils/strings"
+)
+
+type Server struct {
+	*httptest.Server
+
+	// Token is the password required by the server if not empty.
+	Token string
+
+	mu      sync.Mutex
+	storage *memory.Storage
+	head    plumbing.Hash            // commit id of main
+	tags    map[string]plumbing.Hash // tag name -> tag object id
+	peeled  map[string]plumbing.Hash // tag name -> commit id
+	fetches int
+	depth   int // depth of the last fetch
+}
+
+// NewServer starts a fake server of an empty repository, commits are added with Commit.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	s := &Server{
+		storage: memory.NewStorage(),
+		tags:    make(map[string]plumbing.Hash),
+		peeled:  make(map[string]plumbing.Hash),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Config returns a provider config connecting to the server.
+func (s *Server) Config() *git.Config {
+	return &git.Config{URL: s.URL + "/repo.git", Token: strutils.Redacted(s.Token)}
+}
+
+// Fetches returns the number of fetch requests served.
+func (s *Server) Fetches() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+// Depth returns the depth requested by the last fetch, 0 for the full history.
+func (s *Server) Depth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.depth
+}
+
+func (s *Server) store(typ plumbing.ObjectType, encode func(plumbing.EncodedObject) error) plumbing.Hash {
+	obj := s.storage.NewEncodedObject()
+	obj.SetType(typ)
+	if err := encode(obj); err != nil {
+		panic(err)
+	}
+	id, err := s.storage.SetEncodedObject(obj)
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+var signature = object.Signature{Name: "test", Email: "test@example.com", When: time.Unix(0, 0).UTC()}
+
+// Commit points main to a new commit with the files, paths are slash separated, and returns the commit id.
+func (s *Server) Commit(files map[string]string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	commit := &object.Commit{
+		Author:    signature,
+		Committer: signature,
+		Message:   "commit\n",
+		TreeHash:  s.buildTree(files, ""),
+	}
+	if !s.head.IsZero() {
+		commit.ParentHashes = []plumbing.Hash{s.head}
+	}
+	s.head = s.store(plumbing.CommitObject, commit.Encode)
+	return s.head.String()
+}
+
+// Tag adds an annotated tag of the commit of main and returns the id of the tag object.
+func (s *Server) Tag(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tag := &object.Tag{
+		Name:       name,
+		Tagger:     signature,
+		Message:    name + "\n",
+		TargetType: plumbing.CommitObject,
+		Target:     s.head,
+	}
+	id := s.store(plumbing.TagObject, tag.Encode)
+	s.tags[name] = id
+	s.peeled[name] = s.head
+	return id.String()
+}
+
+// buildTree stores the blobs and trees of the files under prefix and returns the tree id.
+func (s *Server) buildTree(files map[string]string, prefix string) plumbing.Hash {
+	var tree object.Tree
+	dirs := make(map[string]bool)
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		rest, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+		if dir, _, ok := strings.Cut(rest, "/"); ok {
+			if !dirs[dir] {
+				dirs[dir] = true
+				tree.Entries = append(tree.Entries, object.TreeEntry{
+					Name: dir,
+					Mode: filemode.Dir,
+					Hash: s.buildTree(files, prefix+dir+"/"),
+				})
+			}
+			continue
+		}
+		blob := s.store(plumbing.BlobObject, func(o plumbing.EncodedObject) error {
+			w, err := o.Writer()
+			if err != nil {
+				return err
+			}
+			defer w.Close()
+			_, err = w.Write([]byte(files[name]))
+			return err
+		})
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: rest, Mode: filemode.Regular, Hash: blob})
+	}
+	// entries of trees are sorted by name, with a slash appended to names of directories
+	slices.SortFunc(tree.Entries, func(a, b object.TreeEntry) int {
+		return strings.Compare(treeEntrySortName(a), treeEntrySortName(b))
+	})
+	return s.store(plumbing.TreeObject, tree.Encode)
+}
+
+func treeEntrySortName(e object.TreeEntry) string {
+	if e.Mode == filemode.Dir {
+		return e.Name + "/"
+	}
+	return e.Name
+}
+
+// objects returns the ids of the objects of a commit, without its history.
+func (s *Server) objects(commitID plumbing.Hash) ([]plumbing.Hash, error) {
+	commit, err := object.GetCommit(s.storage, commitID)
+	if err != nil {
+		return nil, err
+	}
+	ids := []plumbing.Hash{commitID}
+	var walk func(treeID plumbing.Hash) error
+	walk = func(treeID plumbing.Hash) error {
+		tree, err := object.GetTree(s.storage, treeID)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, treeID)
+		for _, e := range tree.Entries {
+			if e.Mode == filemode.Dir {
+				if err := walk(e.Hash); err != nil {
+					return err
+				}
+			} else {
+				ids = append(ids, e.Hash)
+			}
+		}
+		return nil
+	}
+	return ids, walk(commit.TreeHash)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Token != "" {
+		if _, pass, _ := r.BasicAuth(); pass != s.Token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/repo.git/info/refs":
+		adv := packp.NewAdvRefs()
+		adv.Prefix = [][]byte{[]byte("# service=git-upload-pack"), pktline.Flush}
+		for _, c := range []capability.Capability{capability.Shallow, capability.OFSDelta, capability.Sideband64k, capability.NoProgress} {
+			_ = adv.Capabilities.Set(c)
+		}
+		if !s.head.IsZero() {
+			_ = adv.Capabilities.Set(capability.SymRef, "HEAD:refs/heads/main")
+			adv.Head = &s.head
+			adv.References["refs/heads/main"] = s.head
+		}
+		for name, id := range s.tags {
+			adv.References["refs/tags/"+name] = id
+			adv.Peeled["refs/tags/"+name] = s.peeled[name]
+		}
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+		_ = adv.Encode(w)
+	case r.Method == http.MethodPost && r.URL.Path == "/repo.git/git-upload-pack":
+		req := packp.NewUploadRequest()
+		if err := req.Decode(r.Body); err != nil || len(req.Wants) != 1 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		s.fetches++
+		s.depth = 0
+		if depth, ok := req.Depth.(packp.DepthCommits); ok {
+			s.depth = int(depth)
+		}
+		ids, err := s.objects(req.Wants[0])
+		if err != nil {
+			http.Error(w, "not our ref", http.StatusBadRequest)
+			return
+		}
+
+		var b bytes.Buffer
+		if s.depth != 0 {
+			shallow := packp.ShallowUpdate{Shallows: req.Wants}
+			_ = shallow.Encode(&b)
+		}
+		_ = (&packp.ServerResponse{}).Encode(&b, false)
+		if req.Capabilities.Supports(capability.Sideband64k) {
+			_, _ = packfile.NewEncoder(sideband.NewMuxer(sideband.Sideband64k, &b), s.storage, false).Encode(ids, 10)
+			_ = pktline.NewEncoder(&b).Flush()
+		} else {
+			_, _ = packfile.NewEncoder(&b, s.storage, false).Encode(ids, 10)
+		}
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-result")
+		_, _ = w.Write(b.Bytes())
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,149 @@
+package git
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/storage/memory"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// Sizes in object headers and deltas are checked against these limits before memory is allocated.
+const (
+	maxObjectSize  = 16 << 20  // size of an object, or of the result of a delta
+	maxObjectsSize = 256 << 20 // total size of the objects of a pack, deltas resolved
+)
+
+var (
+	ErrInvalidPack    = gperr.New("invalid pack")
+	ErrObjectTooLarge = gperr.New("object too large")
+	ErrPackTooLarge   = gperr.New("pack too large")
+)
+
+// objectBuffer fails writes beyond the size in the object header.
+type objectBuffer struct {
+	bytes.Buffer
+	size int64
+}
+
+func (b *objectBuffer) Write(p []byte) (int, error) {
+	if int64(b.Len()+len(p)) > b.size {
+		return 0, ErrInvalidPack.Subject("object larger than its header")
+	}
+	return b.Buffer.Write(p)
+}
+
+// readPack reads the objects of a pack into memory, with deltas resolved, see gitformat-pack(5).
+//
+// Bases of ofs deltas precede them, bases of ref deltas must also precede them as thin packs are not requested.
+func readPack(r io.Reader) (*memory.Storage, error) {
+	scanner := packfile.NewScanner(r)
+	_, count, err := scanner.Header()
+	if err != nil {
+		return nil, ErrInvalidPack.With(err)
+	}
+
+	storage := memory.NewStorage()
+	offsets := make(map[int64]plumbing.Hash)
+	var total int64
+	for range count {
+		h, err := scanner.NextObjectHeader()
+		if err != nil {
+			return nil, ErrInvalidPack.With(err)
+		}
+		if h.Length > maxObjectSize {
+			return nil, ErrObjectTooLarge.Subjectf("%d bytes", h.Length)
+		}
+		if total += h.Length; total > maxObjectsSize {
+			return nil, ErrPackTooLarge
+		}
+
+		buf := &objectBuffer{size: h.Length}
+		buf.Grow(int(h.Length))
+		if _, _, err := scanner.NextObject(buf); err != nil {
+			return nil, ErrInvalidPack.With(err)
+		}
+		if int64(buf.Len()) != h.Length {
+			return nil, ErrInvalidPack.Subject("object smaller than its header")
+		}
+
+		typ, data := h.Type, buf.Bytes()
+		switch h.Type {
+		case plumbing.OFSDeltaObject, plumbing.REFDeltaObject:
+			baseID := h.Reference
+			if h.Type == plumbing.OFSDeltaObject {
+				baseID = offsets[h.OffsetReference]
+			}
+			base, err := storage.EncodedObject(plumbing.AnyObject, baseID)
+			if err != nil {
+				return nil, ErrInvalidPack.Subjectf("missing delta base at offset %d", h.Offset)
+			}
+			typ = base.Type()
+			if data, err = applyDelta(base, data); err != nil {
+				return nil, err
+			}
+			if total += int64(len(data)); total > maxObjectsSize {
+				return nil, ErrPackTooLarge
+			}
+		case plumbing.CommitObject, plumbing.TreeObject, plumbing.BlobObject, plumbing.TagObject:
+		default:
+			return nil, ErrInvalidPack.Subjectf("unknown object type %d", h.Type)
+		}
+
+		obj := &plumbing.MemoryObject{}
+		obj.SetType(typ)
+		_, _ = obj.Write(data)
+		id, err := storage.SetEncodedObject(obj)
+		if err != nil {
+			return nil, ErrInvalidPack.With(err)
+		}
+		offsets[h.Offset] = id
+	}
+	if _, err := scanner.Checksum(); err != nil {
+		return nil, ErrInvalidPack.With(err)
+	}
+	return storage, nil
+}
+
+// deltaSize reads a size of the delta header.
+func deltaSize(delta []byte) (size int64, rest []byte) {
+	for shift := 0; len(delta) > 0 && shift < 63; shift += 7 {
+		c := delta[0]
+		delta = delta[1:]
+		size |= int64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return size, delta
+		}
+	}
+	return -1, nil
+}
+
+// applyDelta applies a delta to its base, the size of the result is checked first.
+func applyDelta(base plumbing.EncodedObject, delta []byte) ([]byte, error) {
+	// the delta starts with the size of the base and the size of the result
+	_, rest := deltaSize(delta)
+	size, _ := deltaSize(rest)
+	if size < 0 {
+		return nil, ErrInvalidPack.With(packfile.ErrInvalidDelta)
+	}
+	if size > maxObjectSize {
+		return nil, ErrObjectTooLarge.Subjectf("%d bytes", size)
+	}
+
+	r, err := base.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data, err := packfile.PatchDelta(src, delta)
+	if err != nil {
+		return nil, ErrInvalidPack.With(err)
+	}
+	return data, nil
+}
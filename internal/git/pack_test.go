@@ -0,0 +1,119 @@
+package git
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1" //nolint:gosec // pack checksum
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	expect "github.com/yusing/goutils/testing"
+)
+
+type testEntry struct {
+	typ  plumbing.ObjectType
+	size int    // size in the object header
+	base []byte // ofs delta base offset, or ref delta base id
+	data []byte
+}
+
+// testPack writes a pack, sizes in object headers are taken from the entries and not checked.
+func testPack(entries ...testEntry) []byte {
+	var b bytes.Buffer
+	b.WriteString("PACK")
+	_ = binary.Write(&b, binary.BigEndian, uint32(2))
+	_ = binary.Write(&b, binary.BigEndian, uint32(len(entries)))
+	for _, e := range entries {
+		size := e.size
+		c := byte(e.typ)<<4 | byte(size&0x0f)
+		for size >>= 4; size > 0; size >>= 7 {
+			b.WriteByte(c | 0x80)
+			c = byte(size & 0x7f)
+		}
+		b.WriteByte(c)
+		b.Write(e.base)
+		zw := zlib.NewWriter(&b)
+		_, _ = zw.Write(e.data)
+		_ = zw.Close()
+	}
+	sum := sha1.Sum(b.Bytes()) //nolint:gosec // pack checksum
+	b.Write(sum[:])
+	return b.Bytes()
+}
+
+func blobEntry(data string) testEntry {
+	return testEntry{typ: plumbing.BlobObject, size: len(data), data: []byte(data)}
+}
+
+// deltaSizes encodes the size of the base and of the result of a delta.
+func deltaSizes(sizes ...int) []byte {
+	var b []byte
+	for _, size := range sizes {
+		for ; size >= 0x80; size >>= 7 {
+			b = append(b, byte(size)|0x80)
+		}
+		b = append(b, byte(size))
+	}
+	return b
+}
+
+func TestReadPack(t *testing.T) {
+	base := blobEntry("hello world")
+	baseID := plumbing.ComputeHash(plumbing.BlobObject, base.data)
+	// copy "world" at offset 6, insert " ", copy "hello"
+	delta := append(deltaSizes(11, 11), 0x91, 6, 5, 1, ' ', 0x90, 5)
+	pack := testPack(base, testEntry{typ: plumbing.REFDeltaObject, size: len(delta), base: baseID[:], data: delta})
+
+	objects, err := readPack(bytes.NewReader(pack))
+	expect.NoError(t, err)
+	obj, err := objects.EncodedObject(plumbing.BlobObject, plumbing.ComputeHash(plumbing.BlobObject, []byte("world hello")))
+	expect.NoError(t, err)
+	r, _ := obj.Reader()
+	data, _ := io.ReadAll(r)
+	expect.Equal(t, string(data), "world hello")
+}
+
+func TestReadPackInvalid(t *testing.T) {
+	large := strings.Repeat("a", 1024)
+	largeDelta := append(deltaSizes(1024, maxObjectSize+1), 0x90, 0)
+	largeOfs := byte(len(testPack(blobEntry(large))) - 32) // offset of the delta from the base
+	tests := []struct {
+		name string
+		pack []byte
+		err  error
+	}{
+		{"object larger than header", testPack(testEntry{typ: plumbing.BlobObject, size: 10, data: []byte(large)}), ErrInvalidPack},
+		{"object smaller than header", testPack(testEntry{typ: plumbing.BlobObject, size: 2048, data: []byte(large)}), ErrInvalidPack},
+		{"object too large", testPack(testEntry{typ: plumbing.BlobObject, size: maxObjectSize + 1, data: []byte(large)}), ErrObjectTooLarge},
+		{"delta result too large", testPack(
+			blobEntry(large),
+			testEntry{typ: plumbing.OFSDeltaObject, size: len(largeDelta), base: []byte{largeOfs}, data: largeDelta},
+		), ErrObjectTooLarge},
+		{"missing delta base", testPack(testEntry{typ: plumbing.REFDeltaObject, size: 4, base: make([]byte, 20), data: []byte{1, 1, 1, 'a'}}), ErrInvalidPack},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readPack(bytes.NewReader(tt.pack))
+			expect.ErrorIs(t, tt.err, err)
+		})
+	}
+
+	pack := testPack(blobEntry("hello"))
+	pack[len(pack)-1] ^= 0xff
+	_, err := readPack(bytes.NewReader(pack))
+	expect.ErrorIs(t, ErrInvalidPack, err)
+}
+
+func TestLimitReader(t *testing.T) {
+	r := &limitReader{ReadCloser: io.NopCloser(strings.NewReader("12345")), n: 5}
+	data, err := io.ReadAll(r)
+	expect.NoError(t, err)
+	expect.Equal(t, string(data), "12345")
+
+	r = &limitReader{ReadCloser: io.NopCloser(strings.NewReader("123456")), n: 5}
+	_, err = io.ReadAll(r)
+	expect.ErrorIs(t, ErrResponseTooLarge, err)
+}
@@ -0,0 +1,216 @@
+package git
+
+import (
+	"context"
+	"io"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/sideband"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage/memory"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// Remote is a client of the Git smart HTTP protocol, see gitprotocol-http(5).
+//
+// It only resolves refs and shallow fetches single commits.
+// The protocol is implemented by go-git, the remote is not trusted:
+// responses, objects and deltas are size limited before they are read into memory.
+type Remote struct {
+	endpoint *transport.Endpoint
+	auth     transport.AuthMethod // nil without credentials
+	client   transport.Transport
+}
+
+// Ref is a ref advertised by the remote.
+type Ref struct {
+	Name   string
+	ID     string
+	Peeled string // id of the commit of annotated tags
+}
+
+// maxResponseSize limits the size of responses, i.e. the ref advertisement and fetched packs.
+const maxResponseSize = 64 << 20
+
+var (
+	ErrRefNotFound      = gperr.New("ref not found")
+	ErrResponseTooLarge = gperr.New("response too large")
+)
+
+var commitIDRegex = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+func newRemote(rawURL string, client *http.Client) (*Remote, error) {
+	ep, err := transport.NewEndpoint(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	client.Transport = limitTransport{client.Transport}
+	return &Remote{
+		endpoint: ep,
+		client:   githttp.NewClient(client),
+	}, nil
+}
+
+// limitTransport fails reading response bodies larger than maxResponseSize.
+type limitTransport struct {
+	http.RoundTripper
+}
+
+func (t limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &limitReader{ReadCloser: resp.Body, n: maxResponseSize}
+	return resp, nil
+}
+
+type limitReader struct {
+	io.ReadCloser
+	n int64 // bytes left
+}
+
+func (r *limitReader) Read(p []byte) (int, error) {
+	// read one more byte than allowed to tell a body of exactly n bytes from a larger one
+	if int64(len(p)) > r.n+1 {
+		p = p[:r.n+1]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.n -= int64(n)
+	if r.n < 0 {
+		return 0, ErrResponseTooLarge
+	}
+	return n, err
+}
+
+// advertisedRefs opens an upload-pack session and returns the ref advertisement.
+func (r *Remote) advertisedRefs(ctx context.Context) (transport.UploadPackSession, *packp.AdvRefs, error) {
+	sess, err := r.client.NewUploadPackSession(r.endpoint, r.auth)
+	if err != nil {
+		return nil, nil, err
+	}
+	adv, err := sess.AdvertisedReferencesContext(ctx)
+	if err != nil {
+		sess.Close()
+		return nil, nil, gperr.Wrap(err).Subject(r.endpoint.String())
+	}
+	return sess, adv, nil
+}
+
+// LsRefs returns the refs matching the prefixes, all refs if empty, with annotated tags peeled.
+func (r *Remote) LsRefs(ctx context.Context, prefixes ...string) ([]Ref, error) {
+	sess, adv, err := r.advertisedRefs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer sess.Close()
+
+	match := func(name string) bool {
+		return len(prefixes) == 0 || slices.ContainsFunc(prefixes, func(p string) bool {
+			return strings.HasPrefix(name, p)
+		})
+	}
+
+	var refs []Ref
+	if adv.Head != nil && match("HEAD") {
+		refs = append(refs, Ref{Name: "HEAD", ID: adv.Head.String()})
+	}
+	for _, name := range slices.Sorted(maps.Keys(adv.References)) {
+		if !match(name) {
+			continue
+		}
+		ref := Ref{Name: name, ID: adv.References[name].String()}
+		if peeled, ok := adv.Peeled[name]; ok {
+			ref.Peeled = peeled.String()
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// ResolveRef returns the commit id of a branch, tag or commit id, empty ref is the default branch.
+func (r *Remote) ResolveRef(ctx context.Context, ref string) (string, error) {
+	if commitIDRegex.MatchString(ref) {
+		return ref, nil
+	}
+	var candidates []string
+	switch {
+	case ref == "" || ref == "HEAD":
+		candidates = []string{"HEAD"}
+	case strings.HasPrefix(ref, "refs/"):
+		candidates = []string{ref}
+	default:
+		candidates = []string{"refs/heads/" + ref, "refs/tags/" + ref}
+	}
+	refs, err := r.LsRefs(ctx, candidates...)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range candidates {
+		for _, adv := range refs {
+			if adv.Name == name {
+				if adv.Peeled != "" {
+					return adv.Peeled, nil
+				}
+				return adv.ID, nil
+			}
+		}
+	}
+	return "", ErrRefNotFound.Subject(ref)
+}
+
+// fetch shallow fetches a commit and returns its objects.
+func (r *Remote) fetch(ctx context.Context, commit plumbing.Hash) (*memory.Storage, error) {
+	sess, adv, err := r.advertisedRefs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer sess.Close()
+
+	req := packp.NewUploadPackRequestFromCapabilities(adv.Capabilities)
+	req.Wants = []plumbing.Hash{commit}
+	// without haves thin packs are not useful, all delta bases must be in the pack
+	req.Capabilities.Delete(capability.ThinPack)
+	if adv.Capabilities.Supports(capability.Shallow) {
+		_ = req.Capabilities.Set(capability.Shallow)
+		req.Depth = packp.DepthCommits(1)
+	}
+	if adv.Capabilities.Supports(capability.NoProgress) {
+		_ = req.Capabilities.Set(capability.NoProgress)
+	}
+
+	resp, err := sess.UploadPack(ctx, req)
+	if err != nil {
+		return nil, gperr.Wrap(err).Subject(r.endpoint.String())
+	}
+	defer resp.Close()
+
+	var pack io.Reader = resp
+	switch {
+	case req.Capabilities.Supports(capability.Sideband64k):
+		pack = sideband.NewDemuxer(sideband.Sideband64k, resp)
+	case req.Capabilities.Supports(capability.Sideband):
+		pack = sideband.NewDemuxer(sideband.Sideband, resp)
+	}
+	return readPack(pack)
+}
+
+// Files shallow fetches a commit and returns the regular files in dir by name, not recursive.
+func (r *Remote) Files(ctx context.Context, commit, dir string) (map[string][]byte, error) {
+	if !commitIDRegex.MatchString(commit) {
+		return nil, ErrRefNotFound.Subject(commit)
+	}
+	objects, err := r.fetch(ctx, plumbing.NewHash(commit))
+	if err != nil {
+		return nil, err
+	}
+	return files(objects, plumbing.NewHash(commit), dir)
+}
@@ -0,0 +1,60 @@
+package git
+
+import (
+	"errors"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+var ErrPathNotFound = gperr.New("path not found")
+
+// files returns the regular files in dir of a commit by name, not recursive.
+func files(objects storer.EncodedObjectStorer, commitID plumbing.Hash, dir string) (map[string][]byte, error) {
+	commit, err := object.GetCommit(objects, commitID)
+	if err != nil {
+		return nil, ErrInvalidPack.With(err).Subject(commitID.String())
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, ErrInvalidPack.With(err).Subject(commitID.String())
+	}
+	dir = strings.Trim(path.Clean("/"+dir), "/")
+	if dir != "" {
+		tree, err = tree.Tree(dir)
+		if errors.Is(err, object.ErrDirectoryNotFound) {
+			return nil, ErrPathNotFound.Subject(dir)
+		}
+		if err != nil {
+			return nil, ErrInvalidPack.With(err).Subject(dir)
+		}
+	}
+
+	files := make(map[string][]byte)
+	for _, e := range tree.Entries {
+		if e.Mode != filemode.Regular && e.Mode != filemode.Executable {
+			continue
+		}
+		blob, err := object.GetBlob(objects, e.Hash)
+		if err != nil {
+			return nil, ErrInvalidPack.With(err).Subject(e.Name)
+		}
+		r, err := blob.Reader()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		files[e.Name] = data
+	}
+	return files, nil
+}
@@ -0,0 +1,55 @@
+package git
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	gperr "github.com/yusing/goutils/errs"
+)
+
+var ErrInvalidWebhookSignature = gperr.New("invalid webhook signature")
+
+// VerifyWebhook verifies a push webhook with the secret.
+//
+// Supported are HMAC-SHA256 signatures of GitHub, Gitea, Forgejo and Gogs, and the secret token of GitLab.
+func VerifyWebhook(secret string, header http.Header, body []byte) error {
+	if secret == "" {
+		return ErrInvalidWebhookSignature.Subject("webhook secret is not set")
+	}
+	if sig := header.Get("X-Hub-Signature-256"); sig != "" {
+		hexSig, ok := strings.CutPrefix(sig, "sha256=")
+		if !ok {
+			return ErrInvalidWebhookSignature
+		}
+		return verifyHMAC(secret, hexSig, body)
+	}
+	for _, key := range []string{"X-Gitea-Signature", "X-Forgejo-Signature", "X-Gogs-Signature"} {
+		if sig := header.Get(key); sig != "" {
+			return verifyHMAC(secret, sig, body)
+		}
+	}
+	if token := header.Get("X-Gitlab-Token"); token != "" {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			return ErrInvalidWebhookSignature
+		}
+		return nil
+	}
+	return ErrInvalidWebhookSignature.Subject("missing signature")
+}
+
+func verifyHMAC(secret, hexSig string, body []byte) error {
+	sig, err := hex.DecodeString(hexSig)
+	if err != nil {
+		return ErrInvalidWebhookSignature
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return ErrInvalidWebhookSignature
+	}
+	return nil
+}
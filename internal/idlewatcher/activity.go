@@ -0,0 +1,151 @@
+package idlewatcher
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	idlewatcher "github.com/yusing/godoxy/internal/idlewatcher/types"
+	"github.com/yusing/godoxy/internal/net/gphttp"
+	"github.com/yusing/godoxy/internal/types"
+	gperr "github.com/yusing/goutils/errs"
+	strutils "github.com/yusing/goutils/strings"
+)
+
+// networkSample is the network counter of the previous activity check, used to compute the network rate.
+type networkSample struct {
+	at    time.Time
+	bytes uint64
+}
+
+var ErrInvalidActivityResponse = gperr.New("invalid activity endpoint response, expected \"busy\" or \"idle\"")
+
+// activityInterval returns the interval of periodic activity checks, neverTick if nothing needs to be polled.
+func activityInterval(cfg *types.IdlewatcherConfig) time.Duration {
+	if a := cfg.Activity; a != nil && a.Polled() {
+		return a.Interval
+	}
+	return neverTick
+}
+
+// connStarted marks a proxied connection as open, connDone must be called when it closes.
+func (w *Watcher) connStarted() {
+	w.openConns.Add(1)
+}
+
+func (w *Watcher) connDone() {
+	w.openConns.Add(-1)
+	w.resetIdleTimer()
+}
+
+// checkActivity returns why the container is busy, or an empty string if all activity sources report idle.
+//
+// Sources that fail to report are logged and treated as idle.
+func (w *Watcher) checkActivity() string {
+	a := w.cfg.Activity
+	if a == nil {
+		return ""
+	}
+	if a.Connections {
+		if n := w.openConns.Load(); n > 0 {
+			return strconv.FormatInt(n, 10) + " open connections"
+		}
+	}
+	if !a.Polled() {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(w.task.Context(), reqTimeout)
+	defer cancel()
+
+	if a.Endpoint != "" {
+		busy, err := w.endpointBusy(ctx, a.Endpoint)
+		if err != nil {
+			w.l.Warn().Err(err).Msg("failed to check activity endpoint")
+		} else if busy {
+			return "endpoint reported busy"
+		}
+	}
+	if a.CPU > 0 || a.Network > 0 {
+		reason, err := w.statsBusy(ctx, a)
+		if err != nil {
+			w.l.Warn().Err(err).Msg("failed to get container stats")
+		}
+		return reason
+	}
+	return ""
+}
+
+func (w *Watcher) endpointBusy(ctx context.Context, endpoint string) (bool, error) {
+	ref, err := url.Parse(endpoint)
+	if err != nil {
+		return false, err
+	}
+	if !ref.IsAbs() {
+		targetURL := w.route.TargetURL()
+		if targetURL == nil {
+			return false, gperr.New("target URL is not set")
+		}
+		base := targetURL.URL
+		if base.Scheme != "https" {
+			base.Scheme = "http"
+		}
+		ref = base.ResolveReference(ref)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ref.String(), nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := gphttp.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, gperr.Errorf("activity endpoint returned %s", resp.Status)
+	}
+	switch strings.ToLower(strings.TrimSpace(string(body))) {
+	case "busy":
+		return true, nil
+	case "idle":
+		return false, nil
+	}
+	return false, ErrInvalidActivityResponse.Subject(string(body))
+}
+
+func (w *Watcher) statsBusy(ctx context.Context, a *types.IdlewatcherActivityConfig) (string, error) {
+	p, ok := w.provider.Load().(idlewatcher.StatsProvider)
+	if !ok {
+		return "", gperr.New("provider does not report resource usage")
+	}
+	stats, err := p.ContainerStats(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	prev := w.lastNetwork
+	w.lastNetwork = networkSample{at: now, bytes: stats.NetworkBytes}
+
+	if a.CPU > 0 && stats.CPUPercent > a.CPU {
+		return "cpu usage " + strconv.FormatFloat(stats.CPUPercent, 'f', 1, 64) + "%", nil
+	}
+	// counters are reset when the container restarts
+	if a.Network > 0 && !prev.at.IsZero() && stats.NetworkBytes >= prev.bytes {
+		rate := float64(stats.NetworkBytes-prev.bytes) / now.Sub(prev.at).Seconds()
+		if rate > float64(a.Network) {
+			return "network " + strutils.FormatByteSize(int64(rate)) + "/s", nil
+		}
+	}
+	return "", nil
+}
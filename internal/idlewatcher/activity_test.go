@@ -0,0 +1,205 @@
+package idlewatcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	idlewatcher "github.com/yusing/godoxy/internal/idlewatcher/types"
+	nettypes "github.com/yusing/godoxy/internal/net/types"
+	"github.com/yusing/godoxy/internal/types"
+	"github.com/yusing/goutils/task"
+	expect "github.com/yusing/goutils/testing"
+)
+
+// testStatsProvider reports fixed resource usage.
+type testStatsProvider struct {
+	idlewatcher.Provider
+
+	stats idlewatcher.ContainerStats
+	err   error
+}
+
+func (p *testStatsProvider) ContainerStats(context.Context) (idlewatcher.ContainerStats, error) {
+	return p.stats, p.err
+}
+
+// testRoute is a route with only a target URL and a started channel.
+type testRoute struct {
+	types.Route
+
+	target  *nettypes.URL
+	started chan struct{}
+}
+
+func (r testRoute) TargetURL() *nettypes.URL {
+	return r.target
+}
+
+func newTestActivityWatcher(t *testing.T, activity *types.IdlewatcherActivityConfig, p idlewatcher.Provider) *Watcher {
+	t.Helper()
+	tk := task.RootTask("test", false)
+	t.Cleanup(func() { tk.Finish(nil) })
+	w := &Watcher{
+		l:    zerolog.Nop(),
+		cfg:  &types.IdlewatcherConfig{IdlewatcherConfigBase: types.IdlewatcherConfigBase{Activity: activity}},
+		task: tk,
+	}
+	if p != nil {
+		w.provider.Store(p)
+	}
+	return w
+}
+
+func newTestActivityEndpoint(t *testing.T, status int, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestEndpointBusy(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		busy    bool
+		wantErr error
+	}{
+		{"busy", http.StatusOK, "busy", true, nil},
+		{"idle", http.StatusOK, "idle", false, nil},
+		{"case and space insensitive", http.StatusOK, " BUSY\n", true, nil},
+		{"invalid response", http.StatusOK, "maybe", false, ErrInvalidActivityResponse},
+		{"error status", http.StatusServiceUnavailable, "busy", false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestActivityEndpoint(t, tt.status, tt.body)
+			w := newTestActivityWatcher(t, nil, nil)
+			busy, err := w.endpointBusy(t.Context(), srv.URL+"/busy")
+			expect.Equal(t, busy, tt.busy)
+			switch {
+			case tt.wantErr != nil:
+				expect.ErrorIs(t, tt.wantErr, err)
+			case tt.status != http.StatusOK:
+				expect.HasError(t, err)
+			default:
+				expect.NoError(t, err)
+			}
+		})
+	}
+
+	t.Run("relative to target", func(t *testing.T) {
+		var path string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			_, _ = w.Write([]byte("busy"))
+		}))
+		t.Cleanup(srv.Close)
+
+		w := newTestActivityWatcher(t, nil, nil)
+		w.route = testRoute{target: nettypes.MustParseURL(srv.URL + "/app/")}
+		busy, err := w.endpointBusy(t.Context(), "api/busy")
+		expect.NoError(t, err)
+		expect.True(t, busy)
+		expect.Equal(t, path, "/app/api/busy")
+	})
+}
+
+func TestStatsBusy(t *testing.T) {
+	t.Run("cpu", func(t *testing.T) {
+		p := &testStatsProvider{stats: idlewatcher.ContainerStats{CPUPercent: 25}}
+		w := newTestActivityWatcher(t, nil, p)
+
+		reason, err := w.statsBusy(t.Context(), &types.IdlewatcherActivityConfig{CPU: 20})
+		expect.NoError(t, err)
+		expect.Equal(t, reason, "cpu usage 25.0%")
+
+		reason, err = w.statsBusy(t.Context(), &types.IdlewatcherActivityConfig{CPU: 30})
+		expect.NoError(t, err)
+		expect.Equal(t, reason, "")
+	})
+
+	t.Run("network", func(t *testing.T) {
+		p := &testStatsProvider{stats: idlewatcher.ContainerStats{NetworkBytes: 10_000}}
+		w := newTestActivityWatcher(t, nil, p)
+		a := &types.IdlewatcherActivityConfig{Network: 1000}
+
+		// the first sample has nothing to compare with
+		reason, err := w.statsBusy(t.Context(), a)
+		expect.NoError(t, err)
+		expect.Equal(t, reason, "")
+
+		w.lastNetwork = networkSample{at: time.Now().Add(-2 * time.Second), bytes: 0}
+		reason, err = w.statsBusy(t.Context(), a)
+		expect.NoError(t, err)
+		expect.True(t, reason != "")
+
+		w.lastNetwork = networkSample{at: time.Now().Add(-20 * time.Second), bytes: 0}
+		reason, err = w.statsBusy(t.Context(), a)
+		expect.NoError(t, err)
+		expect.Equal(t, reason, "")
+
+		// counters are reset when the container restarts
+		w.lastNetwork = networkSample{at: time.Now().Add(-time.Second), bytes: 1_000_000}
+		reason, err = w.statsBusy(t.Context(), a)
+		expect.NoError(t, err)
+		expect.Equal(t, reason, "")
+		expect.Equal(t, w.lastNetwork.bytes, 10_000)
+	})
+
+	t.Run("provider error", func(t *testing.T) {
+		errStats := errors.New("stats unavailable")
+		w := newTestActivityWatcher(t, nil, &testStatsProvider{err: errStats})
+		_, err := w.statsBusy(t.Context(), &types.IdlewatcherActivityConfig{CPU: 20})
+		expect.ErrorIs(t, errStats, err)
+	})
+
+	t.Run("provider without stats", func(t *testing.T) {
+		w := newTestActivityWatcher(t, nil, struct{ idlewatcher.Provider }{})
+		_, err := w.statsBusy(t.Context(), &types.IdlewatcherActivityConfig{CPU: 20})
+		expect.HasError(t, err)
+	})
+}
+
+func TestCheckActivity(t *testing.T) {
+	t.Run("not configured", func(t *testing.T) {
+		w := newTestActivityWatcher(t, nil, nil)
+		w.openConns.Add(1)
+		expect.Equal(t, w.checkActivity(), "")
+	})
+
+	t.Run("connections", func(t *testing.T) {
+		w := newTestActivityWatcher(t, &types.IdlewatcherActivityConfig{Connections: true}, nil)
+		expect.Equal(t, w.checkActivity(), "")
+		w.openConns.Add(2)
+		expect.Equal(t, w.checkActivity(), "2 open connections")
+	})
+
+	t.Run("endpoint", func(t *testing.T) {
+		srv := newTestActivityEndpoint(t, http.StatusOK, "busy")
+		w := newTestActivityWatcher(t, &types.IdlewatcherActivityConfig{Endpoint: srv.URL}, nil)
+		expect.Equal(t, w.checkActivity(), "endpoint reported busy")
+	})
+
+	t.Run("failing sources are idle", func(t *testing.T) {
+		srv := newTestActivityEndpoint(t, http.StatusInternalServerError, "")
+		p := &testStatsProvider{err: errors.New("stats unavailable")}
+		w := newTestActivityWatcher(t, &types.IdlewatcherActivityConfig{Endpoint: srv.URL, CPU: 20}, p)
+		expect.Equal(t, w.checkActivity(), "")
+	})
+
+	t.Run("idle endpoint, busy cpu", func(t *testing.T) {
+		srv := newTestActivityEndpoint(t, http.StatusOK, "idle")
+		p := &testStatsProvider{stats: idlewatcher.ContainerStats{CPUPercent: 50}}
+		w := newTestActivityWatcher(t, &types.IdlewatcherActivityConfig{Endpoint: srv.URL, CPU: 20}, p)
+		expect.Equal(t, w.checkActivity(), "cpu usage 50.0%")
+	})
+}
@@ -41,6 +41,8 @@ func (w *Watcher) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	case <-r.Context().Done():
 		return
 	default:
+		w.connStarted()
+		defer w.connDone()
 		f := &ForceCacheControl{expires: w.expires().Format(http.TimeFormat), ResponseWriter: rw}
 		w.rp.ServeHTTP(f, r)
 	}
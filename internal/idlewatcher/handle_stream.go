@@ -5,11 +5,20 @@ import (
 	"net"
 
 	nettypes "github.com/yusing/godoxy/internal/net/types"
+	gperr "github.com/yusing/goutils/errs"
 )
 
 var _ nettypes.Stream = (*Watcher)(nil)
 
+var (
+	ErrTooManyPendingConns = gperr.New("too many connections waiting for the container to wake")
+	ErrNotReady            = gperr.New("container did not become ready")
+)
+
 // ListenAndServe implements nettypes.Stream.
+//
+// Connections (TCP) and datagrams (UDP) that arrive while the container wakes are held
+// until it is ready, up to pending_conns connections and pending_packets datagrams per source.
 func (w *Watcher) ListenAndServe(ctx context.Context, predial, onRead nettypes.HookFunc) {
 	w.stream.ListenAndServe(ctx, func(ctx context.Context) error { //nolint:contextcheck
 		return w.preDial(ctx, predial)
@@ -35,7 +44,13 @@ func (w *Watcher) preDial(ctx context.Context, predial nettypes.HookFunc) error
 		}
 	}
 
-	return w.wakeFromStream(ctx)
+	if err := w.wakeFromStream(ctx); err != nil {
+		return err
+	}
+	// the pre-dial context is canceled when the connection closes
+	w.connStarted()
+	context.AfterFunc(ctx, w.connDone)
+	return nil
 }
 
 func (w *Watcher) onRead(ctx context.Context, onRead nettypes.HookFunc) error {
@@ -56,20 +71,25 @@ func (w *Watcher) wakeFromStream(ctx context.Context) error {
 		return nil
 	}
 
+	// hold the connection until the container is ready
+	if n := w.pendingConns.Add(1); n > int64(w.cfg.PendingConns) {
+		w.pendingConns.Add(-1)
+		return ErrTooManyPendingConns.Subjectf("%d/%d", n-1, w.cfg.PendingConns)
+	}
+	defer w.pendingConns.Add(-1)
+
+	ctx, cancel := context.WithTimeout(ctx, w.cfg.WakeTimeout)
+	defer cancel()
+
 	w.l.Debug().Msg("wake signal received")
 	err := w.Wake(ctx)
 	if err != nil {
 		return err
 	}
 
-	// Wait for route to be started
-	if !w.waitStarted(ctx) {
-		return nil
-	}
-
-	// Wait for container to become ready
-	if !w.waitForReady(ctx) {
-		return nil // canceled or failed
+	// Wait for route to be started and container to become ready
+	if !w.waitStarted(ctx) || !w.waitForReady(ctx) {
+		return w.newWatcherError(ErrNotReady.With(context.Cause(ctx)))
 	}
 
 	// Container is ready
@@ -0,0 +1,113 @@
+package idlewatcher
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/rs/zerolog"
+	"github.com/yusing/godoxy/internal/types"
+	expect "github.com/yusing/goutils/testing"
+)
+
+func (r testRoute) Started() <-chan struct{} {
+	return r.started
+}
+
+// testHealthChecker is a health checker with only a URL.
+type testHealthChecker struct {
+	types.HealthChecker
+}
+
+func (testHealthChecker) URL() *url.URL {
+	return &url.URL{Scheme: "udp", Host: "127.0.0.1:53"}
+}
+
+// newTestStreamWatcher returns a watcher of a container that is starting but not ready yet.
+func newTestStreamWatcher(t *testing.T, pendingConns int, wakeTimeout time.Duration) *Watcher {
+	t.Helper()
+	started := make(chan struct{})
+	close(started)
+	w := &Watcher{
+		routeHelper: routeHelper{
+			route: testRoute{started: started},
+			hc:    testHealthChecker{},
+		},
+		l: zerolog.Nop(),
+		cfg: &types.IdlewatcherConfig{
+			IdlewatcherProviderConfig: types.IdlewatcherProviderConfig{
+				Docker: &types.DockerConfig{ContainerName: "app"},
+			},
+			IdlewatcherConfigBase: types.IdlewatcherConfigBase{
+				IdleTimeout: time.Hour,
+				WakeTimeout: wakeTimeout,
+			},
+			PendingConns: pendingConns,
+		},
+		idleTicker:    time.NewTicker(time.Hour),
+		readyNotifyCh: make(chan struct{}, 1),
+		eventChs:      xsync.NewMap[chan *WakeEvent, struct{}](),
+	}
+	t.Cleanup(w.idleTicker.Stop)
+	w.setStarting()
+	return w
+}
+
+func TestWakeFromStreamReady(t *testing.T) {
+	w := newTestStreamWatcher(t, 1, time.Second)
+	w.setReady()
+	expect.NoError(t, w.wakeFromStream(t.Context()))
+	expect.Equal(t, w.pendingConns.Load(), 0)
+}
+
+func TestWakeFromStreamWaitsUntilReady(t *testing.T) {
+	w := newTestStreamWatcher(t, 1, 5*time.Second)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- w.wakeFromStream(t.Context())
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	expect.Equal(t, w.pendingConns.Load(), 1)
+	w.setReady()
+
+	select {
+	case err := <-errCh:
+		expect.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("connection was not released when the container became ready")
+	}
+	expect.Equal(t, w.pendingConns.Load(), 0)
+}
+
+func TestWakeFromStreamTimeout(t *testing.T) {
+	w := newTestStreamWatcher(t, 1, 50*time.Millisecond)
+	start := time.Now()
+	err := w.wakeFromStream(t.Context())
+	expect.ErrorContains(t, err, "timeout")
+	expect.True(t, time.Since(start) < time.Second)
+	expect.Equal(t, w.pendingConns.Load(), 0)
+}
+
+func TestWakeFromStreamPendingLimit(t *testing.T) {
+	w := newTestStreamWatcher(t, 2, time.Second)
+	errCh := make(chan error, 2)
+	for range 2 {
+		go func() {
+			errCh <- w.wakeFromStream(t.Context())
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	expect.Equal(t, w.pendingConns.Load(), 2)
+
+	// connections beyond the limit are rejected immediately
+	expect.ErrorIs(t, ErrTooManyPendingConns, w.wakeFromStream(t.Context()))
+	expect.Equal(t, w.pendingConns.Load(), 2)
+
+	w.setReady()
+	for range 2 {
+		expect.NoError(t, <-errCh)
+	}
+	expect.Equal(t, w.pendingConns.Load(), 0)
+}
@@ -96,8 +96,9 @@ func (w *Watcher) MarshalJSON() ([]byte, error) {
 			Interval: idleWakerCheckInterval,
 			Timeout:  idleWakerCheckTimeout,
 		},
-		URL:    url,
-		Detail: detail,
+		URL:      url,
+		Detail:   detail,
+		Schedule: w.scheduleJSON(),
 	}).MarshalJSON()
 }
 
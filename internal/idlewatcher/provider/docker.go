@@ -3,6 +3,7 @@ package provider
 import (
 	"context"
 
+	"github.com/bytedance/sonic"
 	"github.com/moby/moby/api/types/container"
 	"github.com/moby/moby/client"
 	"github.com/yusing/godoxy/internal/docker"
@@ -78,6 +79,38 @@ func (p *DockerProvider) ContainerStatus(ctx context.Context) (idlewatcher.Conta
 	return idlewatcher.ContainerStatusError, idlewatcher.ErrUnexpectedContainerStatus.Subject(string(status.Container.State.Status))
 }
 
+// ContainerStats collects two samples one second apart to compute the CPU usage.
+func (p *DockerProvider) ContainerStats(ctx context.Context) (idlewatcher.ContainerStats, error) {
+	res, err := p.client.ContainerStats(ctx, p.containerID, client.ContainerStatsOptions{IncludePreviousSample: true})
+	if err != nil {
+		return idlewatcher.ContainerStats{}, err
+	}
+	defer res.Body.Close()
+
+	var stats container.StatsResponse
+	if err := sonic.ConfigDefault.NewDecoder(res.Body).Decode(&stats); err != nil {
+		return idlewatcher.ContainerStats{}, err
+	}
+	return dockerContainerStats(&stats), nil
+}
+
+func dockerContainerStats(stats *container.StatsResponse) idlewatcher.ContainerStats {
+	var result idlewatcher.ContainerStats
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	onlineCPUs := float64(stats.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 { // older daemons
+		onlineCPUs = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		result.CPUPercent = cpuDelta / systemDelta * onlineCPUs * 100
+	}
+	for _, n := range stats.Networks {
+		result.NetworkBytes += n.RxBytes + n.TxBytes
+	}
+	return result
+}
+
 func (p *DockerProvider) Watch(ctx context.Context) (eventCh <-chan watcher.Event, errCh <-chan gperr.Error) {
 	return p.watcher.EventsWithOptions(ctx, watcher.DockerListOptions{
 		Filters: watcher.NewDockerFilters(
@@ -0,0 +1,58 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/moby/moby/api/types/container"
+	expect "github.com/yusing/goutils/testing"
+)
+
+func testStats(total, pretotal, system, presystem uint64, onlineCPUs uint32) *container.StatsResponse {
+	return &container.StatsResponse{
+		CPUStats: container.CPUStats{
+			CPUUsage:    container.CPUUsage{TotalUsage: total},
+			SystemUsage: system,
+			OnlineCPUs:  onlineCPUs,
+		},
+		PreCPUStats: container.CPUStats{
+			CPUUsage:    container.CPUUsage{TotalUsage: pretotal},
+			SystemUsage: presystem,
+		},
+	}
+}
+
+func TestDockerContainerStatsCPU(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats *container.StatsResponse
+		want  float64
+	}{
+		// the system delta covers all cores, 4 cores for 1s = 4e9ns
+		{"one core busy", testStats(2e9, 1e9, 8e9, 4e9, 4), 100},
+		{"half a core busy", testStats(1.5e9, 1e9, 8e9, 4e9, 4), 50},
+		{"all cores busy", testStats(5e9, 1e9, 8e9, 4e9, 4), 400},
+		{"idle", testStats(1e9, 1e9, 8e9, 4e9, 4), 0},
+		{"no previous sample", testStats(2e9, 0, 8e9, 0, 4), 100},
+		{"counter reset", testStats(1e9, 2e9, 8e9, 4e9, 4), 0},
+		{"no system delta", testStats(2e9, 1e9, 4e9, 4e9, 4), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expect.Equal(t, dockerContainerStats(tt.stats).CPUPercent, tt.want)
+		})
+	}
+
+	t.Run("online cpus from per-cpu usage", func(t *testing.T) {
+		stats := testStats(2e9, 1e9, 8e9, 4e9, 0)
+		stats.CPUStats.CPUUsage.PercpuUsage = []uint64{1, 1, 1, 1}
+		expect.Equal(t, dockerContainerStats(stats).CPUPercent, 100)
+	})
+}
+
+func TestDockerContainerStatsNetwork(t *testing.T) {
+	stats := &container.StatsResponse{Networks: map[string]container.NetworkStats{
+		"eth0": {RxBytes: 1000, TxBytes: 500},
+		"eth1": {RxBytes: 10, TxBytes: 5},
+	}}
+	expect.Equal(t, dockerContainerStats(stats).NetworkBytes, 1515)
+}
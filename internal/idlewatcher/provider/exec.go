@@ -0,0 +1,184 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	idlewatcher "github.com/yusing/godoxy/internal/idlewatcher/types"
+	"github.com/yusing/godoxy/internal/types"
+	"github.com/yusing/godoxy/internal/watcher"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// ExecProvider manages a service with user supplied shell commands.
+type ExecProvider struct {
+	cfg *types.ExecConfig
+	env []string
+}
+
+const (
+	execOutputLimit = 4096
+	// execWaitDelay bounds how long a command may keep its output open after exiting,
+	// e.g. when it started a background process without redirecting its output.
+	execWaitDelay = time.Second
+)
+
+var ErrExecCommandFailed = gperr.New("command failed")
+
+// execInheritedEnv are the only variables passed from the environment of GoDoxy to the commands.
+var execInheritedEnv = []string{"PATH", "HOME"}
+
+func NewExecProvider(cfg *types.ExecConfig) (idlewatcher.Provider, error) {
+	if cfg.Start == "" || cfg.Stop == "" || cfg.Status == "" {
+		return nil, gperr.New("start, stop and status commands are required")
+	}
+	// commands do not inherit the environment of GoDoxy, which holds secrets like API_JWT_SECRET
+	var env []string
+	for _, k := range execInheritedEnv {
+		if v, ok := os.LookupEnv(k); ok {
+			env = append(env, k+"="+v)
+		}
+	}
+	for k, v := range cfg.Env {
+		env = append(env, k+"="+v)
+	}
+	return &ExecProvider{cfg: cfg, env: env}, nil
+}
+
+// run runs command with sh -c and returns its trimmed stdout.
+func (p *ExecProvider) run(ctx context.Context, command string, extraEnv ...string) (string, error) {
+	out, errOut, err := p.runRaw(ctx, command, extraEnv...)
+	if err != nil {
+		if errOut == "" {
+			errOut = out
+		}
+		if errOut != "" {
+			return out, ErrExecCommandFailed.Subject(command).Withf("%s: %s", errOut, err)
+		}
+		return out, ErrExecCommandFailed.Subject(command).With(err)
+	}
+	return out, nil
+}
+
+func (p *ExecProvider) runRaw(ctx context.Context, command string, extraEnv ...string) (stdout, stderr string, err error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = p.cfg.Dir
+	cmd.Env = slices.Concat(p.env, extraEnv)
+	cmd.WaitDelay = execWaitDelay
+	var outBuf, errBuf bytes.Buffer
+	cmd.Stdout = &limitedWriter{&outBuf, execOutputLimit}
+	cmd.Stderr = &limitedWriter{&errBuf, execOutputLimit}
+	err = cmd.Run()
+	if errors.Is(err, exec.ErrWaitDelay) {
+		err = nil
+	}
+	return strings.TrimSpace(outBuf.String()), strings.TrimSpace(errBuf.String()), err
+}
+
+func (p *ExecProvider) ContainerPause(ctx context.Context) error {
+	if p.cfg.Pause == "" {
+		return gperr.New("pause command is not configured")
+	}
+	_, err := p.run(ctx, p.cfg.Pause)
+	return err
+}
+
+func (p *ExecProvider) ContainerUnpause(ctx context.Context) error {
+	if p.cfg.Unpause == "" {
+		return gperr.New("unpause command is not configured")
+	}
+	_, err := p.run(ctx, p.cfg.Unpause)
+	return err
+}
+
+func (p *ExecProvider) ContainerStart(ctx context.Context) error {
+	_, err := p.run(ctx, p.cfg.Start)
+	return err
+}
+
+// ContainerStop runs the stop command with GODOXY_STOP_SIGNAL and GODOXY_STOP_TIMEOUT (seconds) set.
+func (p *ExecProvider) ContainerStop(ctx context.Context, signal types.ContainerSignal, timeout int) error {
+	_, err := p.run(ctx, p.cfg.Stop, stopEnv(signal, timeout)...)
+	return err
+}
+
+func (p *ExecProvider) ContainerKill(ctx context.Context, signal types.ContainerSignal) error {
+	command := p.cfg.Kill
+	if command == "" {
+		command = p.cfg.Stop
+	}
+	_, err := p.run(ctx, command, stopEnv(signal, 0)...)
+	return err
+}
+
+// ContainerStatus runs the status command. If it prints "running", "paused" or "stopped" the output is used,
+// otherwise exit code 0 means running and any other exit code means stopped.
+func (p *ExecProvider) ContainerStatus(ctx context.Context) (idlewatcher.ContainerStatus, error) {
+	out, errOut, err := p.runRaw(ctx, p.cfg.Status)
+	switch idlewatcher.ContainerStatus(strings.ToLower(lastLine(out))) {
+	case idlewatcher.ContainerStatusRunning:
+		return idlewatcher.ContainerStatusRunning, nil
+	case idlewatcher.ContainerStatusPaused:
+		return idlewatcher.ContainerStatusPaused, nil
+	case idlewatcher.ContainerStatusStopped:
+		return idlewatcher.ContainerStatusStopped, nil
+	}
+	if err == nil {
+		return idlewatcher.ContainerStatusRunning, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		return idlewatcher.ContainerStatusStopped, nil
+	}
+	if errOut != "" {
+		return idlewatcher.ContainerStatusError, ErrExecCommandFailed.Subject(p.cfg.Status).Withf("%s: %s", errOut, err)
+	}
+	return idlewatcher.ContainerStatusError, ErrExecCommandFailed.Subject(p.cfg.Status).With(err)
+}
+
+func (p *ExecProvider) Watch(ctx context.Context) (<-chan watcher.Event, <-chan gperr.Error) {
+	name := p.cfg.Name
+	if name == "" {
+		name = "exec"
+	}
+	return pollStatus(ctx, p, name, name)
+}
+
+func (p *ExecProvider) Close() {
+	// noop
+}
+
+func stopEnv(signal types.ContainerSignal, timeout int) []string {
+	env := []string{"GODOXY_STOP_TIMEOUT=" + strconv.Itoa(timeout)}
+	if signal != "" {
+		env = append(env, "GODOXY_STOP_SIGNAL="+string(signal))
+	}
+	return env
+}
+
+func lastLine(s string) string {
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return strings.TrimSpace(s[i+1:])
+	}
+	return s
+}
+
+// limitedWriter discards writes beyond n bytes without failing the command.
+type limitedWriter struct {
+	buf *bytes.Buffer
+	n   int
+}
+
+func (w *limitedWriter) Write(b []byte) (int, error) {
+	if remaining := w.n - w.buf.Len(); remaining > 0 {
+		w.buf.Write(b[:min(len(b), remaining)])
+	}
+	return len(b), nil
+}
@@ -0,0 +1,150 @@
+package provider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	idlewatcher "github.com/yusing/godoxy/internal/idlewatcher/types"
+	"github.com/yusing/godoxy/internal/types"
+	"github.com/yusing/godoxy/internal/watcher/events"
+	expect "github.com/yusing/goutils/testing"
+)
+
+// newTestExecProvider manages a fake service whose state is the content of a file.
+func newTestExecProvider(t *testing.T) (*ExecProvider, string) {
+	t.Helper()
+	dir := t.TempDir()
+	state := filepath.Join(dir, "state")
+	p, err := NewExecProvider(&types.ExecConfig{
+		Name:    "app",
+		Dir:     dir,
+		Env:     map[string]string{"STATE_FILE": state},
+		Start:   `echo running > "$STATE_FILE"`,
+		Stop:    `echo "$GODOXY_STOP_SIGNAL $GODOXY_STOP_TIMEOUT" > stop.log && rm -f "$STATE_FILE"`,
+		Status:  `cat "$STATE_FILE"`,
+		Pause:   `echo paused > "$STATE_FILE"`,
+		Unpause: `echo running > "$STATE_FILE"`,
+	})
+	expect.NoError(t, err)
+	return p.(*ExecProvider), dir
+}
+
+func TestExecProvider(t *testing.T) {
+	p, dir := newTestExecProvider(t)
+	ctx := t.Context()
+
+	expect.Equal(t, expect.Must(p.ContainerStatus(ctx)), idlewatcher.ContainerStatusStopped)
+
+	expect.NoError(t, p.ContainerStart(ctx))
+	expect.Equal(t, expect.Must(p.ContainerStatus(ctx)), idlewatcher.ContainerStatusRunning)
+
+	expect.NoError(t, p.ContainerPause(ctx))
+	expect.Equal(t, expect.Must(p.ContainerStatus(ctx)), idlewatcher.ContainerStatusPaused)
+	expect.NoError(t, p.ContainerUnpause(ctx))
+	expect.Equal(t, expect.Must(p.ContainerStatus(ctx)), idlewatcher.ContainerStatusRunning)
+
+	expect.NoError(t, p.ContainerStop(ctx, "SIGTERM", 10))
+	expect.Equal(t, expect.Must(p.ContainerStatus(ctx)), idlewatcher.ContainerStatusStopped)
+	expect.Equal(t, string(expect.Must(os.ReadFile(filepath.Join(dir, "stop.log")))), "SIGTERM 10\n")
+
+	// kill falls back to stop
+	expect.NoError(t, p.ContainerStart(ctx))
+	expect.NoError(t, p.ContainerKill(ctx, "SIGKILL"))
+	expect.Equal(t, expect.Must(p.ContainerStatus(ctx)), idlewatcher.ContainerStatusStopped)
+}
+
+func TestExecProviderExitCode(t *testing.T) {
+	p := expect.Must(NewExecProvider(&types.ExecConfig{
+		Start:  "true",
+		Stop:   "true",
+		Status: "exit 3",
+	}))
+	expect.Equal(t, expect.Must(p.ContainerStatus(t.Context())), idlewatcher.ContainerStatusStopped)
+
+	p = expect.Must(NewExecProvider(&types.ExecConfig{
+		Start:  "echo starting; echo boom >&2; exit 1",
+		Stop:   "true",
+		Status: "echo some output",
+	}))
+	expect.Equal(t, expect.Must(p.ContainerStatus(t.Context())), idlewatcher.ContainerStatusRunning)
+	err := p.ContainerStart(t.Context())
+	expect.ErrorIs(t, ErrExecCommandFailed, err)
+	expect.True(t, err != nil && strings.Contains(err.Error(), "boom"))
+
+	_, err = NewExecProvider(&types.ExecConfig{Start: "true"})
+	expect.HasError(t, err)
+}
+
+func TestExecProviderEnv(t *testing.T) {
+	t.Setenv("API_JWT_SECRET", "secret")
+	p := expect.Must(NewExecProvider(&types.ExecConfig{
+		Env:    map[string]string{"APP": "app"},
+		Start:  "true",
+		Stop:   "true",
+		Status: "true",
+	}))
+	out, _, err := p.(*ExecProvider).runRaw(t.Context(), "env")
+	expect.NoError(t, err)
+	expect.False(t, strings.Contains(out, "API_JWT_SECRET"))
+	expect.True(t, strings.Contains(out, "APP=app"))
+	expect.True(t, strings.Contains(out, "PATH="+os.Getenv("PATH")))
+}
+
+func TestExecProviderBackgroundProcess(t *testing.T) {
+	p := expect.Must(NewExecProvider(&types.ExecConfig{
+		Start:  "sleep 30 &",
+		Stop:   "true",
+		Status: "true",
+	}))
+	start := time.Now()
+	expect.NoError(t, p.ContainerStart(t.Context()))
+	expect.True(t, time.Since(start) < 10*time.Second)
+}
+
+func TestPollStatus(t *testing.T) {
+	p, _ := newTestExecProvider(t)
+	expect.NoError(t, p.ContainerStart(t.Context()))
+	polled := make(chan struct{}, 1)
+	eventCh, errCh := pollStatusEvery(t.Context(), notifyingStatusGetter{p, polled}, "app", "app", 10*time.Millisecond)
+	<-polled // initial status
+
+	next := func() events.Action {
+		t.Helper()
+		select {
+		case e := <-eventCh:
+			expect.Equal(t, e.ActorName, "app")
+			return e.Action
+		case err := <-errCh:
+			t.Fatal(err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for event")
+		}
+		return 0
+	}
+
+	expect.NoError(t, p.ContainerPause(t.Context()))
+	expect.Equal(t, next(), events.ActionContainerPause)
+	expect.NoError(t, p.ContainerUnpause(t.Context()))
+	expect.Equal(t, next(), events.ActionContainerStart)
+	expect.NoError(t, p.ContainerStop(t.Context(), "", 0))
+	expect.Equal(t, next(), events.ActionContainerStop)
+}
+
+type notifyingStatusGetter struct {
+	statusGetter
+	polled chan struct{}
+}
+
+func (g notifyingStatusGetter) ContainerStatus(ctx context.Context) (idlewatcher.ContainerStatus, error) {
+	defer func() {
+		select {
+		case g.polled <- struct{}{}:
+		default:
+		}
+	}()
+	return g.statusGetter.ContainerStatus(ctx)
+}
@@ -0,0 +1,197 @@
+package provider
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	idlewatcher "github.com/yusing/godoxy/internal/idlewatcher/types"
+	"github.com/yusing/godoxy/internal/libvirt"
+	"github.com/yusing/godoxy/internal/types"
+	"github.com/yusing/godoxy/internal/watcher"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// LibvirtProvider manages a libvirt domain (e.g. a QEMU/KVM virtual machine) through the local libvirtd socket.
+type LibvirtProvider struct {
+	cfg *types.LibvirtConfig
+
+	mu   sync.Mutex
+	conn *libvirt.Conn
+	dom  libvirt.Domain
+}
+
+const (
+	libvirtShutdownCheckInterval = 500 * time.Millisecond
+	// libvirtDestroyTimeout is reserved from the stop timeout to destroy a domain that ignored the shutdown request.
+	libvirtDestroyTimeout = 2 * time.Second
+)
+
+var ErrDomainNotFound = gperr.New("libvirt domain not found")
+
+func NewLibvirtProvider(ctx context.Context, cfg *types.LibvirtConfig) (idlewatcher.Provider, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	p := &LibvirtProvider{cfg: cfg}
+	if _, _, err := p.connect(ctx); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// connect returns the current connection, reconnecting if it was closed after an error.
+func (p *LibvirtProvider) connect(ctx context.Context) (*libvirt.Conn, libvirt.Domain, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn != nil && !p.conn.Closed() {
+		return p.conn, p.dom, nil
+	}
+
+	conn, err := libvirt.Dial(ctx, p.cfg.Socket, p.cfg.URI)
+	if err != nil {
+		return nil, libvirt.Domain{}, gperr.Wrap(err, "failed to connect to libvirt")
+	}
+	dom, err := conn.LookupDomain(ctx, p.cfg.Domain)
+	if err != nil {
+		conn.Close()
+		if libvirt.IsErrorCode(err, libvirt.ErrCodeNoDomain) {
+			return nil, libvirt.Domain{}, ErrDomainNotFound.Subject(p.cfg.Domain)
+		}
+		return nil, libvirt.Domain{}, err
+	}
+	p.conn, p.dom = conn, dom
+	return conn, dom, nil
+}
+
+func (p *LibvirtProvider) do(ctx context.Context, fn func(*libvirt.Conn, libvirt.Domain) error) error {
+	conn, dom, err := p.connect(ctx)
+	if err != nil {
+		return err
+	}
+	return fn(conn, dom)
+}
+
+func (p *LibvirtProvider) state(ctx context.Context) (libvirt.DomainState, error) {
+	var state libvirt.DomainState
+	err := p.do(ctx, func(conn *libvirt.Conn, dom libvirt.Domain) (err error) {
+		state, _, err = conn.DomainGetState(ctx, dom)
+		return err
+	})
+	return state, err
+}
+
+// ContainerPause suspends the domain or saves it to disk, depending on pause_mode.
+func (p *LibvirtProvider) ContainerPause(ctx context.Context) error {
+	return p.do(ctx, func(conn *libvirt.Conn, dom libvirt.Domain) error {
+		if p.cfg.PauseMode == types.LibvirtPauseModeManagedSave {
+			return conn.DomainManagedSave(ctx, dom)
+		}
+		return conn.DomainSuspend(ctx, dom)
+	})
+}
+
+// ContainerUnpause resumes a suspended domain or restores a saved one.
+func (p *LibvirtProvider) ContainerUnpause(ctx context.Context) error {
+	state, err := p.state(ctx)
+	if err != nil {
+		return err
+	}
+	if state == libvirt.DomainPaused {
+		return p.do(ctx, func(conn *libvirt.Conn, dom libvirt.Domain) error {
+			return conn.DomainResume(ctx, dom)
+		})
+	}
+	return p.ContainerStart(ctx)
+}
+
+func (p *LibvirtProvider) ContainerStart(ctx context.Context) error {
+	return p.do(ctx, func(conn *libvirt.Conn, dom libvirt.Domain) error {
+		return conn.DomainCreate(ctx, dom)
+	})
+}
+
+// ContainerStop requests an ACPI shutdown and destroys the domain if it is still running after timeout seconds.
+func (p *LibvirtProvider) ContainerStop(ctx context.Context, _ types.ContainerSignal, timeout int) error {
+	err := p.do(ctx, func(conn *libvirt.Conn, dom libvirt.Domain) error {
+		return conn.DomainShutdown(ctx, dom)
+	})
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Add(-libvirtDestroyTimeout).Before(deadline) {
+		deadline = ctxDeadline.Add(-libvirtDestroyTimeout)
+	}
+	ticker := time.NewTicker(libvirtShutdownCheckInterval)
+	defer ticker.Stop()
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		state, err := p.state(ctx)
+		if err != nil {
+			return err
+		}
+		if state == libvirt.DomainShutoff {
+			return nil
+		}
+	}
+	return p.ContainerKill(ctx, "")
+}
+
+// ContainerKill forcefully stops the domain, like pulling the power cord.
+func (p *LibvirtProvider) ContainerKill(ctx context.Context, _ types.ContainerSignal) error {
+	err := p.do(ctx, func(conn *libvirt.Conn, dom libvirt.Domain) error {
+		return conn.DomainDestroy(ctx, dom)
+	})
+	if libvirt.IsErrorCode(err, libvirt.ErrCodeOperationInvalid) { // already shut off
+		return nil
+	}
+	return err
+}
+
+func (p *LibvirtProvider) ContainerStatus(ctx context.Context) (idlewatcher.ContainerStatus, error) {
+	state, err := p.state(ctx)
+	if err != nil {
+		return idlewatcher.ContainerStatusError, err
+	}
+	switch state {
+	case libvirt.DomainRunning, libvirt.DomainBlocked:
+		return idlewatcher.ContainerStatusRunning, nil
+	case libvirt.DomainPaused:
+		return idlewatcher.ContainerStatusPaused, nil
+	case libvirt.DomainShutoff:
+		// a domain with a managed save image resumes where it left off on start
+		var saved bool
+		err := p.do(ctx, func(conn *libvirt.Conn, dom libvirt.Domain) (err error) {
+			saved, err = conn.DomainHasManagedSaveImage(ctx, dom)
+			return err
+		})
+		if err != nil {
+			return idlewatcher.ContainerStatusError, err
+		}
+		if saved {
+			return idlewatcher.ContainerStatusPaused, nil
+		}
+		return idlewatcher.ContainerStatusStopped, nil
+	case libvirt.DomainShutdown, libvirt.DomainCrashed:
+		return idlewatcher.ContainerStatusStopped, nil
+	}
+	return idlewatcher.ContainerStatusError, idlewatcher.ErrUnexpectedContainerStatus.Subject(state.String())
+}
+
+func (p *LibvirtProvider) Watch(ctx context.Context) (<-chan watcher.Event, <-chan gperr.Error) {
+	return pollStatus(ctx, p, p.cfg.Domain, p.cfg.Domain)
+}
+
+func (p *LibvirtProvider) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn != nil {
+		p.conn.Close()
+	}
+}
@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	idlewatcher "github.com/yusing/godoxy/internal/idlewatcher/types"
+	"github.com/yusing/godoxy/internal/libvirt"
+	"github.com/yusing/godoxy/internal/libvirt/libvirttest"
+	"github.com/yusing/godoxy/internal/types"
+	expect "github.com/yusing/goutils/testing"
+)
+
+func newTestLibvirtProvider(t *testing.T, pauseMode types.LibvirtPauseMode) (*LibvirtProvider, *libvirttest.Server) {
+	t.Helper()
+	srv := libvirttest.NewServer(t, libvirttest.Domain{Name: "win11", State: libvirt.DomainShutoff})
+	p, err := NewLibvirtProvider(t.Context(), &types.LibvirtConfig{
+		Domain:    "win11",
+		Socket:    srv.Socket,
+		PauseMode: pauseMode,
+	})
+	expect.NoError(t, err)
+	t.Cleanup(p.Close)
+	return p.(*LibvirtProvider), srv
+}
+
+func TestLibvirtProviderSuspend(t *testing.T) {
+	p, srv := newTestLibvirtProvider(t, types.LibvirtPauseModeSuspend)
+	ctx := t.Context()
+
+	expect.Equal(t, expect.Must(p.ContainerStatus(ctx)), idlewatcher.ContainerStatusStopped)
+	expect.NoError(t, p.ContainerStart(ctx))
+	expect.Equal(t, expect.Must(p.ContainerStatus(ctx)), idlewatcher.ContainerStatusRunning)
+
+	expect.NoError(t, p.ContainerPause(ctx))
+	expect.Equal(t, srv.State("win11").State, libvirt.DomainPaused)
+	expect.Equal(t, expect.Must(p.ContainerStatus(ctx)), idlewatcher.ContainerStatusPaused)
+	expect.NoError(t, p.ContainerUnpause(ctx))
+	expect.Equal(t, expect.Must(p.ContainerStatus(ctx)), idlewatcher.ContainerStatusRunning)
+
+	expect.NoError(t, p.ContainerStop(ctx, "", 10))
+	expect.Equal(t, expect.Must(p.ContainerStatus(ctx)), idlewatcher.ContainerStatusStopped)
+}
+
+func TestLibvirtProviderManagedSave(t *testing.T) {
+	p, srv := newTestLibvirtProvider(t, types.LibvirtPauseModeManagedSave)
+	ctx := t.Context()
+
+	expect.NoError(t, p.ContainerStart(ctx))
+	expect.NoError(t, p.ContainerPause(ctx))
+	expect.Equal(t, srv.State("win11"), libvirttest.Domain{Name: "win11", State: libvirt.DomainShutoff, ManagedSave: true})
+	expect.Equal(t, expect.Must(p.ContainerStatus(ctx)), idlewatcher.ContainerStatusPaused)
+
+	expect.NoError(t, p.ContainerUnpause(ctx))
+	expect.Equal(t, srv.State("win11"), libvirttest.Domain{Name: "win11", State: libvirt.DomainRunning})
+}
+
+func TestLibvirtProviderStopTimeout(t *testing.T) {
+	p, srv := newTestLibvirtProvider(t, "")
+	ctx := t.Context()
+	srv.IgnoreShutdown(true)
+
+	expect.NoError(t, p.ContainerStart(ctx))
+	start := time.Now()
+	expect.NoError(t, p.ContainerStop(ctx, "", 1))
+	expect.True(t, time.Since(start) >= time.Second)
+	expect.Equal(t, srv.State("win11").State, libvirt.DomainShutoff)
+	expect.Equal(t, srv.Calls()[len(srv.Calls())-1], libvirt.ProcDomainDestroy)
+
+	// killing a stopped domain is a no-op
+	expect.NoError(t, p.ContainerKill(ctx, ""))
+}
+
+func TestLibvirtProviderReconnect(t *testing.T) {
+	p, _ := newTestLibvirtProvider(t, "")
+	p.conn.Close()
+	expect.Equal(t, expect.Must(p.ContainerStatus(t.Context())), idlewatcher.ContainerStatusStopped)
+}
+
+func TestLibvirtProviderDomainNotFound(t *testing.T) {
+	srv := libvirttest.NewServer(t)
+	_, err := NewLibvirtProvider(t.Context(), &types.LibvirtConfig{Domain: "missing", Socket: srv.Socket})
+	expect.ErrorIs(t, ErrDomainNotFound, err)
+}
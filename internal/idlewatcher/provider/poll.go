@@ -0,0 +1,85 @@
+package provider
+
+import (
+	"context"
+	"time"
+
+	idlewatcher "github.com/yusing/godoxy/internal/idlewatcher/types"
+	"github.com/yusing/godoxy/internal/watcher"
+	"github.com/yusing/godoxy/internal/watcher/events"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+const statusPollInterval = 1 * time.Second
+
+type statusGetter interface {
+	ContainerStatus(ctx context.Context) (idlewatcher.ContainerStatus, error)
+}
+
+// pollStatus emits container events for backends without an event stream
+// by polling ContainerStatus and reporting state transitions.
+func pollStatus(ctx context.Context, p statusGetter, actorID, actorName string) (<-chan watcher.Event, <-chan gperr.Error) {
+	return pollStatusEvery(ctx, p, actorID, actorName, statusPollInterval)
+}
+
+func pollStatusEvery(ctx context.Context, p statusGetter, actorID, actorName string, interval time.Duration) (<-chan watcher.Event, <-chan gperr.Error) {
+	eventCh := make(chan watcher.Event)
+	errCh := make(chan gperr.Error)
+
+	go func() {
+		defer close(eventCh)
+		defer close(errCh)
+
+		last, err := p.ContainerStatus(ctx)
+		if err != nil {
+			select {
+			case errCh <- gperr.Wrap(err):
+			case <-ctx.Done():
+			}
+			return
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		event := watcher.Event{
+			Type:      events.EventTypeDocker,
+			ActorID:   actorID,
+			ActorName: actorName,
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				status, err := p.ContainerStatus(ctx)
+				if err != nil {
+					select {
+					case errCh <- gperr.Wrap(err):
+					case <-ctx.Done():
+					}
+					return
+				}
+				if status == last {
+					continue
+				}
+				last = status
+				switch status {
+				case idlewatcher.ContainerStatusRunning:
+					event.Action = events.ActionContainerStart
+				case idlewatcher.ContainerStatusPaused:
+					event.Action = events.ActionContainerPause
+				default:
+					event.Action = events.ActionContainerStop
+				}
+				select {
+				case eventCh <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return eventCh, errCh
+}
@@ -80,6 +80,17 @@ func (p *ProxmoxProvider) ContainerStatus(ctx context.Context) (idlewatcher.Cont
 	return idlewatcher.ContainerStatusError, idlewatcher.ErrUnexpectedContainerStatus.Subject(string(status))
 }
 
+func (p *ProxmoxProvider) ContainerStats(ctx context.Context) (idlewatcher.ContainerStats, error) {
+	usage, err := p.LXCUsage(ctx, p.vmid)
+	if err != nil {
+		return idlewatcher.ContainerStats{}, err
+	}
+	return idlewatcher.ContainerStats{
+		CPUPercent:   usage.CPU * usage.CPUs * 100,
+		NetworkBytes: usage.NetIn + usage.NetOut,
+	}, nil
+}
+
 func (p *ProxmoxProvider) Watch(ctx context.Context) (<-chan watcher.Event, <-chan gperr.Error) {
 	eventCh := make(chan watcher.Event)
 	errCh := make(chan gperr.Error)
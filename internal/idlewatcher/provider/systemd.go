@@ -0,0 +1,154 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"syscall"
+
+	"github.com/yusing/godoxy/internal/dbus"
+	idlewatcher "github.com/yusing/godoxy/internal/idlewatcher/types"
+	"github.com/yusing/godoxy/internal/types"
+	"github.com/yusing/godoxy/internal/watcher"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// SystemdProvider manages a systemd unit through the service manager's D-Bus API.
+type SystemdProvider struct {
+	conn *dbus.Conn
+	unit string
+}
+
+const (
+	systemdDest      = "org.freedesktop.systemd1"
+	systemdPath      = dbus.ObjectPath("/org/freedesktop/systemd1")
+	systemdManager   = "org.freedesktop.systemd1.Manager"
+	systemdUnitIface = "org.freedesktop.systemd1.Unit"
+
+	errNoSuchUnit = "org.freedesktop.systemd1.NoSuchUnit"
+)
+
+var ErrUnitNotFound = gperr.New("systemd unit not found")
+
+func NewSystemdProvider(ctx context.Context, cfg *types.SystemdConfig) (idlewatcher.Provider, error) {
+	var conn *dbus.Conn
+	var err error
+	if cfg.User {
+		conn, err = dbus.SessionBus(ctx)
+	} else {
+		conn, err = dbus.SystemBus(ctx)
+	}
+	if err != nil {
+		return nil, gperr.Wrap(err, "failed to connect to systemd")
+	}
+	return newSystemdProvider(ctx, conn, cfg.Unit)
+}
+
+func newSystemdProvider(ctx context.Context, conn *dbus.Conn, unit string) (*SystemdProvider, error) {
+	p := &SystemdProvider{conn: conn, unit: unit}
+	// LoadUnit fails if the unit file does not exist.
+	if _, err := p.unitPath(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *SystemdProvider) call(ctx context.Context, method string, sig dbus.Signature, args ...any) ([]any, error) {
+	reply, err := p.conn.Call(ctx, systemdDest, systemdPath, systemdManager, method, sig, args...)
+	if dbusErr, ok := err.(*dbus.Error); ok && dbusErr.Name == errNoSuchUnit {
+		return nil, ErrUnitNotFound.Subject(p.unit)
+	}
+	return reply, err
+}
+
+func (p *SystemdProvider) unitPath(ctx context.Context) (dbus.ObjectPath, error) {
+	reply, err := p.call(ctx, "LoadUnit", "s", p.unit)
+	if err != nil {
+		return "", err
+	}
+	if len(reply) != 1 {
+		return "", dbus.ErrInvalidMessage
+	}
+	path, ok := reply[0].(dbus.ObjectPath)
+	if !ok {
+		return "", dbus.ErrInvalidMessage
+	}
+	return path, nil
+}
+
+// ContainerPause freezes the unit's cgroup (systemd 246+).
+func (p *SystemdProvider) ContainerPause(ctx context.Context) error {
+	_, err := p.call(ctx, "FreezeUnit", "s", p.unit)
+	return err
+}
+
+func (p *SystemdProvider) ContainerUnpause(ctx context.Context) error {
+	_, err := p.call(ctx, "ThawUnit", "s", p.unit)
+	return err
+}
+
+func (p *SystemdProvider) ContainerStart(ctx context.Context) error {
+	_, err := p.call(ctx, "StartUnit", "ss", p.unit, "replace")
+	return err
+}
+
+// ContainerStop stops the unit, signal and timeout are taken from the unit's KillSignal= and TimeoutStopSec=.
+func (p *SystemdProvider) ContainerStop(ctx context.Context, _ types.ContainerSignal, _ int) error {
+	_, err := p.call(ctx, "StopUnit", "ss", p.unit, "replace")
+	return err
+}
+
+func (p *SystemdProvider) ContainerKill(ctx context.Context, signal types.ContainerSignal) error {
+	_, err := p.call(ctx, "KillUnit", "ssi", p.unit, "all", int32(signalNumber(signal, syscall.SIGKILL)))
+	return err
+}
+
+func (p *SystemdProvider) ContainerStatus(ctx context.Context) (idlewatcher.ContainerStatus, error) {
+	path, err := p.unitPath(ctx)
+	if err != nil {
+		return idlewatcher.ContainerStatusError, err
+	}
+	state, err := p.conn.GetProperty(ctx, systemdDest, path, systemdUnitIface, "ActiveState")
+	if err != nil {
+		return idlewatcher.ContainerStatusError, err
+	}
+	activeState, _ := state.(string)
+	switch activeState {
+	case "active", "reloading", "activating", "refreshing":
+		// FreezerState is not available before systemd 246
+		if freezer, err := p.conn.GetProperty(ctx, systemdDest, path, systemdUnitIface, "FreezerState"); err == nil {
+			if s, _ := freezer.(string); s == "frozen" || s == "freezing" {
+				return idlewatcher.ContainerStatusPaused, nil
+			}
+		}
+		return idlewatcher.ContainerStatusRunning, nil
+	case "inactive", "failed", "deactivating", "maintenance":
+		return idlewatcher.ContainerStatusStopped, nil
+	}
+	return idlewatcher.ContainerStatusError, idlewatcher.ErrUnexpectedContainerStatus.Subject(activeState)
+}
+
+func (p *SystemdProvider) Watch(ctx context.Context) (<-chan watcher.Event, <-chan gperr.Error) {
+	return pollStatus(ctx, p, p.unit, p.unit)
+}
+
+func (p *SystemdProvider) Close() {
+	p.conn.Close()
+}
+
+// signalNumber converts a signal name such as "SIGTERM" or "TERM" to its number.
+func signalNumber(signal types.ContainerSignal, def syscall.Signal) syscall.Signal {
+	switch strings.TrimPrefix(strings.ToUpper(string(signal)), "SIG") {
+	case "INT":
+		return syscall.SIGINT
+	case "TERM":
+		return syscall.SIGTERM
+	case "QUIT":
+		return syscall.SIGQUIT
+	case "HUP":
+		return syscall.SIGHUP
+	case "KILL":
+		return syscall.SIGKILL
+	}
+	return def
+}
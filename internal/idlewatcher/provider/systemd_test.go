@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/yusing/godoxy/internal/dbus"
+	"github.com/yusing/godoxy/internal/dbus/dbustest"
+	idlewatcher "github.com/yusing/godoxy/internal/idlewatcher/types"
+	expect "github.com/yusing/goutils/testing"
+)
+
+const testUnitPath = dbus.ObjectPath("/org/freedesktop/systemd1/unit/app_2eservice")
+
+// fakeSystemd implements the subset of the systemd manager API used by SystemdProvider.
+type fakeSystemd struct {
+	mu      sync.Mutex
+	active  string
+	freezer string
+	killed  int32
+}
+
+func (f *fakeSystemd) handle(call *dbus.Message) (dbus.Signature, []any, *dbus.Error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if call.Member != "Get" && call.Body[0] != "app.service" {
+		return "", nil, &dbus.Error{Name: errNoSuchUnit, Message: "Unit " + call.Body[0].(string) + " not found."}
+	}
+	switch call.Member {
+	case "LoadUnit":
+		return "o", []any{testUnitPath}, nil
+	case "StartUnit", "ThawUnit":
+		f.active, f.freezer = "active", "running"
+	case "StopUnit":
+		f.active = "inactive"
+	case "FreezeUnit":
+		f.freezer = "frozen"
+	case "KillUnit":
+		f.active, f.killed = "failed", call.Body[2].(int32)
+	case "Get":
+		if call.Path != testUnitPath {
+			return "", nil, &dbus.Error{Name: "org.freedesktop.DBus.Error.UnknownObject"}
+		}
+		value := f.active
+		if call.Body[1] == "FreezerState" {
+			value = f.freezer
+		}
+		return "v", []any{dbus.Variant{Sig: "s", Value: value}}, nil
+	default:
+		return "", nil, &dbus.Error{Name: "org.freedesktop.DBus.Error.UnknownMethod"}
+	}
+	return "o", []any{dbus.ObjectPath("/org/freedesktop/systemd1/job/1")}, nil
+}
+
+func TestSystemdProvider(t *testing.T) {
+	fake := &fakeSystemd{active: "inactive", freezer: "running"}
+	srv := dbustest.NewServer(t, fake.handle)
+	ctx := t.Context()
+
+	p, err := newSystemdProvider(ctx, expect.Must(dbus.Dial(ctx, srv.Address)), "app.service")
+	expect.NoError(t, err)
+	defer p.Close()
+
+	expect.Equal(t, expect.Must(p.ContainerStatus(ctx)), idlewatcher.ContainerStatusStopped)
+
+	expect.NoError(t, p.ContainerStart(ctx))
+	expect.Equal(t, expect.Must(p.ContainerStatus(ctx)), idlewatcher.ContainerStatusRunning)
+
+	expect.NoError(t, p.ContainerPause(ctx))
+	expect.Equal(t, expect.Must(p.ContainerStatus(ctx)), idlewatcher.ContainerStatusPaused)
+	expect.NoError(t, p.ContainerUnpause(ctx))
+	expect.Equal(t, expect.Must(p.ContainerStatus(ctx)), idlewatcher.ContainerStatusRunning)
+
+	expect.NoError(t, p.ContainerStop(ctx, "SIGTERM", 10))
+	expect.Equal(t, expect.Must(p.ContainerStatus(ctx)), idlewatcher.ContainerStatusStopped)
+
+	expect.NoError(t, p.ContainerStart(ctx))
+	expect.NoError(t, p.ContainerKill(ctx, ""))
+	fake.mu.Lock()
+	expect.Equal(t, fake.killed, int32(9))
+	fake.mu.Unlock()
+	expect.Equal(t, expect.Must(p.ContainerStatus(ctx)), idlewatcher.ContainerStatusStopped)
+}
+
+func TestSystemdProviderUnitNotFound(t *testing.T) {
+	srv := dbustest.NewServer(t, (&fakeSystemd{}).handle)
+	_, err := newSystemdProvider(t.Context(), expect.Must(dbus.Dial(t.Context(), srv.Address)), "missing.service")
+	expect.ErrorIs(t, ErrUnitNotFound, err)
+}
@@ -0,0 +1,104 @@
+package idlewatcher
+
+import (
+	"context"
+	"time"
+
+	"github.com/yusing/godoxy/internal/types"
+)
+
+// scheduleWindow identifies a window of a schedule, wake and sleep actions run once per window.
+type scheduleWindow struct {
+	name  string
+	start int64 // unix timestamp
+}
+
+// idleTimeout returns the idle timeout in effect now, neverTick if the container should not be stopped.
+func idleTimeout(cfg *types.IdlewatcherConfig) time.Duration {
+	if timeout := cfg.IdleTimeoutAt(time.Now()); timeout > 0 {
+		return timeout
+	}
+	return neverTick
+}
+
+func currentWindow(cfg *types.IdlewatcherConfig, t time.Time) (*types.IdlewatcherSchedule, scheduleWindow) {
+	s, _ := cfg.ActiveSchedule(t)
+	if s == nil {
+		return nil, scheduleWindow{}
+	}
+	start, _, _ := s.Window(t)
+	return s, scheduleWindow{name: s.Name, start: start.Unix()}
+}
+
+func (w *Watcher) resetScheduleTimer() {
+	next := w.cfg.NextScheduleTransition(time.Now())
+	if next.IsZero() {
+		w.scheduleTimer.Stop()
+		return
+	}
+	w.scheduleTimer.Reset(max(time.Until(next), time.Millisecond))
+}
+
+// onScheduleTransition applies the schedule whose window just started or ended.
+//
+// Wake and sleep only run when a window starts while the watcher is running,
+// not when the watcher starts in the middle of a window.
+func (w *Watcher) onScheduleTransition() {
+	defer w.resetScheduleTimer()
+
+	s, window := currentWindow(w.cfg, time.Now())
+	if window == w.lastWindow {
+		return
+	}
+	w.lastWindow = window
+
+	if s == nil {
+		w.l.Info().Msg("schedule ended")
+	} else {
+		w.l.Info().Str("schedule", s.Name).Msg("schedule started")
+	}
+
+	switch {
+	case s != nil && s.Wake:
+		go func() {
+			ctx, cancel := context.WithTimeout(w.task.Context(), w.cfg.WakeTimeout)
+			defer cancel()
+			if err := w.Wake(ctx); err != nil {
+				w.l.Err(err).Str("schedule", s.Name).Msg("scheduled wake failed")
+			}
+		}()
+	case s != nil && s.Sleep:
+		if w.running() {
+			if err := w.stopByMethod(); err != nil {
+				w.l.Err(err).Str("schedule", s.Name).Msg("scheduled sleep failed")
+			}
+			return
+		}
+	}
+
+	if w.running() {
+		w.resetIdleTimer()
+	}
+}
+
+func (w *Watcher) scheduleJSON() *types.IdleScheduleJSON {
+	cfg := w.cfg
+	if len(cfg.Schedules) == 0 {
+		return nil
+	}
+	now := time.Now()
+	j := &types.IdleScheduleJSON{
+		IdleTimeout: cfg.IdleTimeoutAt(now).Seconds(),
+	}
+	if s, _ := cfg.ActiveSchedule(now); s != nil {
+		j.Active = s.Name
+		j.KeepAwake = s.KeepAwake
+	}
+	if next := cfg.NextScheduleTransition(now); !next.IsZero() {
+		j.NextTransition = next.Unix()
+		if s, _ := cfg.ActiveSchedule(next); s != nil {
+			j.Next = s.Name
+		}
+	}
+	return j
+}
@@ -72,12 +72,22 @@ func (w *Watcher) waitForReady(ctx context.Context) bool {
 		return true
 	}
 
+	// the notification wakes only one waiter, others poll the state
+	ticker := time.NewTicker(idleWakerCheckInterval)
+	defer ticker.Stop()
+
 	// Wait for ready notification or context cancellation
-	select {
-	case <-w.readyNotifyCh:
-		return true
-	case <-ctx.Done():
-		return false
+	for {
+		select {
+		case <-w.readyNotifyCh:
+			return true
+		case <-ticker.C:
+			if w.ready() {
+				return true
+			}
+		case <-ctx.Done():
+			return false
+		}
 	}
 }
 
@@ -18,3 +18,14 @@ type Provider interface {
 	Watch(ctx context.Context) (eventCh <-chan events.Event, errCh <-chan gperr.Error)
 	Close()
 }
+
+// ContainerStats is a resource usage sample of a container.
+type ContainerStats struct {
+	CPUPercent   float64 // CPU usage, 100 per fully used core
+	NetworkBytes uint64  // bytes received and sent since the container started
+}
+
+// StatsProvider is implemented by providers that can report resource usage.
+type StatsProvider interface {
+	ContainerStats(ctx context.Context) (ContainerStats, error)
+}
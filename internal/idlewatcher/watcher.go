@@ -6,6 +6,7 @@ import (
 	"math"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/puzpuzpuz/xsync/v4"
@@ -58,10 +59,16 @@ type (
 		state     synk.Value[*containerState]
 		lastReset synk.Value[time.Time]
 
-		idleTicker    *time.Ticker
-		healthTicker  *time.Ticker
-		readyNotifyCh chan struct{} // notifies when container becomes ready
-		task          *task.Task
+		idleTicker     *time.Ticker
+		healthTicker   *time.Ticker
+		activityTicker *time.Ticker
+		scheduleTimer  *time.Timer
+		lastWindow     scheduleWindow // last seen schedule window, accessed by watchUntilDestroy only
+		lastNetwork    networkSample  // accessed by watchUntilDestroy only
+		openConns      atomic.Int64   // open proxied connections
+		pendingConns   atomic.Int64   // stream connections waiting for the container to wake
+		readyNotifyCh  chan struct{}  // notifies when container becomes ready
+		task           *task.Task
 
 		// SSE event broadcasting, HTTP routes only
 		eventChs       *xsync.Map[chan *WakeEvent, struct{}]
@@ -123,22 +130,28 @@ func NewWatcher(parent task.Parent, r types.Route, cfg *types.IdlewatcherConfig)
 		}
 		cfg = w.cfg
 		w.resetIdleTimer()
+		w.resetScheduleTimer()
+		w.activityTicker.Reset(activityInterval(cfg))
 		// Update health monitor URL with current route info on reload
 		if targetURL := r.TargetURL(); targetURL != nil {
 			w.hc.UpdateURL(&targetURL.URL)
 		}
 	} else {
 		w = &Watcher{
-			idleTicker:    time.NewTicker(cfg.IdleTimeout),
-			healthTicker:  time.NewTicker(idleWakerCheckInterval),
-			readyNotifyCh: make(chan struct{}, 1), // buffered to avoid blocking
-			eventChs:      xsync.NewMap[chan *WakeEvent, struct{}](),
-			cfg:           cfg,
+			idleTicker:     time.NewTicker(idleTimeout(cfg)),
+			healthTicker:   time.NewTicker(idleWakerCheckInterval),
+			activityTicker: time.NewTicker(activityInterval(cfg)),
+			scheduleTimer:  time.NewTimer(neverTick),
+			readyNotifyCh:  make(chan struct{}, 1), // buffered to avoid blocking
+			eventChs:       xsync.NewMap[chan *WakeEvent, struct{}](),
+			cfg:            cfg,
 			routeHelper: routeHelper{
 				hc: monitor.NewMonitor(r),
 			},
 			dependsOn: make([]*dependency, 0, len(cfg.DependsOn)),
 		}
+		_, w.lastWindow = currentWindow(cfg, time.Now())
+		w.resetScheduleTimer()
 	}
 
 	var depErrors gperr.Builder
@@ -198,12 +211,14 @@ func NewWatcher(parent task.Parent, r types.Route, cfg *types.IdlewatcherConfig)
 			depCfg = new(types.IdlewatcherConfig)
 			depCfg.IdlewatcherConfigBase = cfg.IdlewatcherConfigBase
 			depCfg.IdleTimeout = neverTick // disable auto sleep for dependencies
+			depCfg.Schedules = nil         // dependencies follow the schedules of their dependents
+			depCfg.Activity = nil          // and their activity
 		} else if depCfg.IdleTimeout > 0 && depCfg.IdleTimeout != neverTick {
 			depErrors.Addf("dependency %q has positive idle timeout %s", dep, depCfg.IdleTimeout)
 			continue
 		}
 
-		if depCfg.Docker == nil && depCfg.Proxmox == nil {
+		if !depCfg.HasProvider() {
 			depCont := depRoute.ContainerInfo()
 			if depCont != nil {
 				depCfg.Docker = &types.DockerConfig{
@@ -256,6 +271,15 @@ func NewWatcher(parent task.Parent, r types.Route, cfg *types.IdlewatcherConfig)
 	case cfg.Docker != nil:
 		p, err = provider.NewDockerProvider(cfg.Docker.DockerCfg, cfg.Docker.ContainerID)
 		kind = "docker"
+	case cfg.Systemd != nil:
+		p, err = provider.NewSystemdProvider(parent.Context(), cfg.Systemd)
+		kind = "systemd"
+	case cfg.Exec != nil:
+		p, err = provider.NewExecProvider(cfg.Exec)
+		kind = "exec"
+	case cfg.Libvirt != nil:
+		p, err = provider.NewLibvirtProvider(parent.Context(), cfg.Libvirt)
+		kind = "libvirt"
 	default:
 		p, err = provider.NewProxmoxProvider(parent.Context(), cfg.Proxmox.Node, cfg.Proxmox.VMID)
 		kind = "proxmox"
@@ -330,6 +354,8 @@ func NewWatcher(parent task.Parent, r types.Route, cfg *types.IdlewatcherConfig)
 
 			w.idleTicker.Stop()
 			w.healthTicker.Stop()
+			w.activityTicker.Stop()
+			w.scheduleTimer.Stop()
 			w.setReady()
 			close(w.readyNotifyCh)
 			w.task.Finish(cause)
@@ -539,15 +565,16 @@ func (w *Watcher) stopByMethod() error {
 }
 
 func (w *Watcher) resetIdleTimer() {
-	w.idleTicker.Reset(w.cfg.IdleTimeout)
+	w.idleTicker.Reset(idleTimeout(w.cfg))
 	w.lastReset.Store(time.Now())
 }
 
 func (w *Watcher) expires() time.Time {
-	if !w.running() || w.cfg.IdleTimeout <= 0 {
+	timeout := idleTimeout(w.cfg)
+	if !w.running() || timeout == neverTick {
 		return time.Time{}
 	}
-	return w.lastReset.Load().Add(w.cfg.IdleTimeout)
+	return w.lastReset.Load().Add(timeout)
 }
 
 // watchUntilDestroy waits for the container to be created, started, or unpaused,
@@ -616,9 +643,23 @@ func (w *Watcher) watchUntilDestroy() (returnCause error) {
 				}
 				// If not ready yet, keep checking on next tick
 			}
+		case <-w.scheduleTimer.C:
+			w.onScheduleTransition()
+		case <-w.activityTicker.C:
+			if w.ready() {
+				if reason := w.checkActivity(); reason != "" {
+					w.l.Debug().Str("reason", reason).Msg("activity detected")
+					w.resetIdleTimer()
+				}
+			}
 		case <-w.idleTicker.C:
 			w.idleTicker.Stop()
 			if w.running() {
+				if reason := w.checkActivity(); reason != "" {
+					w.l.Debug().Str("reason", reason).Msg("idle timeout reached but container is busy")
+					w.resetIdleTimer()
+					continue
+				}
 				err := w.stopByMethod()
 				switch {
 				case errors.Is(err, context.Canceled):
@@ -0,0 +1,821 @@
+package importer
+
+import (
+	"cmp"
+	"encoding/base64"
+	"maps"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/yusing/godoxy/internal/types"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// caddyDirective is a line of a Caddyfile with its block, see https://caddyserver.com/docs/caddyfile/concepts.
+type caddyDirective struct {
+	args  []string // the directive name and its arguments
+	block []*caddyDirective
+	line  int
+}
+
+var (
+	ErrInvalidCaddyfile = gperr.New("invalid Caddyfile")
+
+	caddyEnvRegex = regexp.MustCompile(`\{\$([A-Za-z_][A-Za-z0-9_]*)(:[^}]*)?\}`)
+)
+
+func (d *caddyDirective) name() string {
+	return d.args[0]
+}
+
+// tokenizeCaddyfile splits a Caddyfile into lines of tokens, with their line numbers.
+func tokenizeCaddyfile(data string) (lines [][]string, lineNos []int, err error) {
+	var line []string
+	var tok strings.Builder
+	inTok := false
+	lineNo, startLine := 1, 1
+	endTok := func() {
+		if inTok {
+			if len(line) == 0 {
+				startLine = lineNo
+			}
+			line = append(line, tok.String())
+			tok.Reset()
+			inTok = false
+		}
+	}
+	endLine := func() {
+		endTok()
+		if len(line) > 0 {
+			lines = append(lines, line)
+			lineNos = append(lineNos, startLine)
+			line = nil
+		}
+	}
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '\n':
+			endLine()
+			lineNo++
+		case c == ' ' || c == '\t' || c == '\r':
+			endTok()
+		case c == '\\' && i+1 < len(data) && (data[i+1] == '\n' || (data[i+1] == '\r' && i+2 < len(data) && data[i+2] == '\n')):
+			// line continuation
+			endTok()
+			for data[i] != '\n' {
+				i++
+			}
+			lineNo++
+		case c == '#' && !inTok:
+			for i+1 < len(data) && data[i+1] != '\n' {
+				i++
+			}
+		case (c == '"' || c == '`') && !inTok:
+			inTok = true
+			for i++; ; i++ {
+				if i >= len(data) {
+					return nil, nil, ErrInvalidCaddyfile.Subjectf("line %d: unterminated quote", lineNo)
+				}
+				if data[i] == c {
+					break
+				}
+				if data[i] == '\\' && c == '"' && i+1 < len(data) && data[i+1] == '"' {
+					i++
+				}
+				if data[i] == '\n' {
+					lineNo++
+				}
+				tok.WriteByte(data[i])
+			}
+		default:
+			inTok = true
+			tok.WriteByte(c)
+		}
+	}
+	endLine()
+	return lines, lineNos, nil
+}
+
+// parseCaddyfile parses a Caddyfile into directives with blocks.
+func parseCaddyfile(data []byte) ([]*caddyDirective, error) {
+	lines, lineNos, err := tokenizeCaddyfile(string(data))
+	if err != nil {
+		return nil, err
+	}
+	pos := 0
+	var parse func(depth int) ([]*caddyDirective, error)
+	parse = func(depth int) ([]*caddyDirective, error) {
+		var directives []*caddyDirective
+		for pos < len(lines) {
+			line, lineNo := lines[pos], lineNos[pos]
+			pos++
+			if line[0] == "}" {
+				if depth == 0 {
+					return nil, ErrInvalidCaddyfile.Subjectf("line %d: unexpected }", lineNo)
+				}
+				return directives, nil
+			}
+			d := &caddyDirective{args: line, line: lineNo}
+			if line[len(line)-1] == "{" {
+				d.args = line[:len(line)-1]
+				block, err := parse(depth + 1)
+				if err != nil {
+					return nil, err
+				}
+				d.block = block
+				if d.args == nil { // global options
+					d.args = []string{}
+				}
+			}
+			directives = append(directives, d)
+		}
+		if depth > 0 {
+			return nil, ErrInvalidCaddyfile.Subject("missing }")
+		}
+		return directives, nil
+	}
+	return parse(0)
+}
+
+// caddySite collects the translation of a site block.
+type caddySite struct {
+	b        *builder
+	source   string
+	matchers map[string][]string // named matcher -> rule matcher lines
+	snippets map[string][]*caddyDirective
+
+	up           *upstream
+	root         string
+	fileServer   bool
+	noTLSVerify  bool
+	entry        types.LabelMap // middlewares
+	redirRules   []any
+	prefixRules  []any
+	authRules    []any
+	handleRules  []pathRule
+	respondRules []any
+	proxyRules   []pathRule
+	fallback     bool // a handle block without matcher
+}
+
+func importCaddyfile(b *builder, data []byte) error {
+	// env placeholders are substituted by GoDoxy too
+	data = caddyEnvRegex.ReplaceAllFunc(data, func(m []byte) []byte {
+		sub := caddyEnvRegex.FindSubmatch(m)
+		if len(sub[2]) > 0 {
+			b.report("env "+string(sub[1]), "the default value %s is not translated", sub[2][1:])
+		}
+		return []byte("${" + string(sub[1]) + "}")
+	})
+
+	directives, err := parseCaddyfile(data)
+	if err != nil {
+		return err
+	}
+
+	snippets := make(map[string][]*caddyDirective)
+	var sites []*caddyDirective
+loop:
+	for i, d := range directives {
+		switch {
+		case len(d.args) == 0: // global options
+			if i != 0 {
+				return ErrInvalidCaddyfile.Subjectf("line %d: a block without addresses", d.line)
+			}
+			b.report("global options", "not translated")
+		case strings.HasPrefix(d.name(), "(") && strings.HasSuffix(d.name(), ")"):
+			snippets[strings.Trim(d.name(), "()")] = d.block
+		case d.block != nil:
+			sites = append(sites, d)
+		case len(sites) == 0:
+			// a single site without braces, the first line has the addresses
+			sites = append(sites, &caddyDirective{args: d.args, block: directives[i+1:], line: d.line})
+			break loop
+		default:
+			return ErrInvalidCaddyfile.Subjectf("line %d: %s outside of a site block", d.line, d.name())
+		}
+	}
+
+	for _, site := range sites {
+		importCaddySite(b, site, snippets)
+	}
+	return nil
+}
+
+func importCaddySite(b *builder, site *caddyDirective, snippets map[string][]*caddyDirective) {
+	var hosts []string
+	source := "site " + strings.Join(site.args, " ")
+	for _, addr := range site.args {
+		for addr := range strings.SplitSeq(addr, ",") {
+			if addr == "" {
+				continue
+			}
+			host := addr
+			if _, rest, ok := strings.Cut(host, "://"); ok {
+				host = rest
+			}
+			host, _, _ = strings.Cut(host, "/")
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			if host == "" {
+				b.report(source, "address %s: sites without a host are not supported", addr)
+				continue
+			}
+			hosts = append(hosts, strings.ToLower(host))
+		}
+	}
+	if len(hosts) == 0 {
+		return
+	}
+
+	s := &caddySite{
+		b:        b,
+		source:   source,
+		matchers: make(map[string][]string),
+		snippets: snippets,
+		entry:    make(types.LabelMap),
+	}
+	block := s.expandImports(site.block, 0)
+	// matchers may be defined after their use
+	for _, d := range block {
+		if strings.HasPrefix(d.name(), "@") {
+			s.defineMatcher(d)
+		}
+	}
+	for _, d := range block {
+		if !strings.HasPrefix(d.name(), "@") {
+			s.directive(d)
+		}
+	}
+
+	entry := s.entry
+	switch {
+	case s.up != nil:
+		maps.Copy(entry, s.up.entry())
+		if s.noTLSVerify {
+			entry["no_tls_verify"] = true
+		}
+	case s.fileServer && s.root != "":
+		entry["scheme"] = "fileserver"
+		entry["root"] = s.root
+	default:
+		// routed by rules only, the upstream of the first rule is the route upstream
+		up := firstProxyUpstream(slices.Concat(s.handleRules, s.proxyRules))
+		if up == nil {
+			b.report(source, "no reverse_proxy or file_server to route to, e.g. a redirect only site")
+			return
+		}
+		maps.Copy(entry, up.entry())
+	}
+
+	appendRules(entry, s.redirRules...)
+	appendRules(entry, s.prefixRules...)
+	appendRules(entry, s.authRules...)
+	if len(s.handleRules) > 0 || len(s.respondRules) > 0 || len(s.proxyRules) > 0 {
+		appendRules(entry, pathRules(s.handleRules, true)...)
+		appendRules(entry, s.respondRules...)
+		catchAll := s.up != nil || (s.fileServer && s.root != "") || s.fallback
+		appendRules(entry, pathRules(s.proxyRules, catchAll)...)
+	}
+	for _, host := range hosts {
+		b.add(source, host, maps.Clone(entry))
+	}
+}
+
+func firstProxyUpstream(rules []pathRule) *upstream {
+	for _, r := range rules {
+		for _, cmd := range r.do {
+			if target, ok := strings.CutPrefix(cmd, "proxy "); ok {
+				if up, err := parseUpstream(target, "http"); err == nil {
+					return &up
+				}
+			}
+		}
+	}
+	return nil
+}
+
+const caddyMaxImportDepth = 10
+
+// expandImports replaces imports of snippets with their directives.
+func (s *caddySite) expandImports(block []*caddyDirective, depth int) []*caddyDirective {
+	out := make([]*caddyDirective, 0, len(block))
+	for _, d := range block {
+		if d.name() != "import" {
+			out = append(out, d)
+			continue
+		}
+		if len(d.args) < 2 || depth >= caddyMaxImportDepth {
+			s.b.report(s.source, "line %d: invalid import", d.line)
+			continue
+		}
+		snippet, ok := s.snippets[d.args[1]]
+		if !ok {
+			s.b.report(s.source, "line %d: import of %s is not supported, only snippets are", d.line, d.args[1])
+			continue
+		}
+		if len(d.args) > 2 {
+			s.b.report(s.source, "line %d: import arguments are not substituted", d.line)
+		}
+		out = append(out, s.expandImports(snippet, depth+1)...)
+	}
+	return out
+}
+
+// defineMatcher translates a named matcher, e.g. "@api path /api/*" or a block of matchers.
+func (s *caddySite) defineMatcher(d *caddyDirective) {
+	name := d.name()
+	var lines []string
+	specs := [][]string{d.args[1:]}
+	if d.block != nil {
+		specs = nil
+		for _, m := range d.block {
+			specs = append(specs, m.args)
+		}
+	}
+	for _, spec := range specs {
+		on, err := caddyMatcher(spec)
+		if err != nil {
+			s.b.report(s.source, "line %d: matcher %s: %s", d.line, name, err)
+			s.matchers[name] = nil
+			return
+		}
+		lines = append(lines, on...)
+	}
+	s.matchers[name] = lines
+}
+
+var caddyPrivateRanges = []string{"192.168.0.0/16", "172.16.0.0/12", "10.0.0.0/8", "127.0.0.1/8", "fd00::/8", "::1"}
+
+// caddyMatcher translates a matcher spec to rule matcher lines.
+func caddyMatcher(spec []string) ([]string, error) {
+	if len(spec) < 2 {
+		return nil, gperr.New("missing arguments")
+	}
+	typ, args := spec[0], spec[1:]
+	alt := func(format func(string) string) []string {
+		parts := make([]string, len(args))
+		for i, arg := range args {
+			parts[i] = format(arg)
+		}
+		return []string{strings.Join(parts, " | ")}
+	}
+	switch typ {
+	case "path":
+		return alt(caddyPath), nil
+	case "path_regexp":
+		return []string{"path regex(" + quoteArg(args[len(args)-1]) + ")"}, nil
+	case "method":
+		return alt(func(m string) string { return "method " + strings.ToUpper(m) }), nil
+	case "host":
+		return alt(func(h string) string { return "host " + quoteArg(h) }), nil
+	case "remote_ip", "client_ip":
+		var ranges []string
+		for _, arg := range args {
+			if arg == "forwarded" {
+				continue
+			}
+			if arg == "private_ranges" {
+				ranges = append(ranges, caddyPrivateRanges...)
+				continue
+			}
+			ranges = append(ranges, arg)
+		}
+		args = ranges
+		return alt(func(r string) string { return "remote " + r }), nil
+	case "header":
+		if len(args) == 1 {
+			return []string{"header " + quoteArg(args[0])}, nil
+		}
+		return []string{"header " + quoteArg(args[0]) + " " + quoteArg(args[1])}, nil
+	case "header_regexp":
+		return []string{"header " + quoteArg(args[len(args)-2]) + " regex(" + quoteArg(args[len(args)-1]) + ")"}, nil
+	case "query":
+		return alt(func(q string) string {
+			k, v, _ := strings.Cut(q, "=")
+			return "query " + quoteArg(k) + " " + quoteArg(v)
+		}), nil
+	case "protocol":
+		return []string{"proto " + args[0]}, nil
+	case "not":
+		on, err := caddyMatcher(args)
+		if err != nil {
+			return nil, err
+		}
+		// De Morgan: negated alternatives are separate lines
+		if len(on) != 1 {
+			return nil, gperr.New("not of multiple matchers is not supported")
+		}
+		alts := strings.Split(on[0], " | ")
+		for i, alt := range alts {
+			alts[i] = "!" + alt
+		}
+		return alts, nil
+	default:
+		return nil, gperr.Errorf("%s is not supported", typ)
+	}
+}
+
+// caddyPath translates a Caddy path matcher, "*" is a wildcard.
+func caddyPath(p string) string {
+	if strings.Contains(p, "*") {
+		return `path glob("` + p + `")`
+	}
+	return "path " + quoteArg(p)
+}
+
+// matcher returns the matcher lines of a directive and its remaining arguments,
+// ok is false if the matcher is not translated.
+func (s *caddySite) matcher(d *caddyDirective) (on []string, args []string, ok bool) {
+	args = d.args[1:]
+	if len(args) == 0 {
+		return nil, args, true
+	}
+	switch arg := args[0]; {
+	case arg == "*":
+		return nil, args[1:], true
+	case strings.HasPrefix(arg, "/"):
+		return []string{caddyPath(arg)}, args[1:], true
+	case strings.HasPrefix(arg, "@"):
+		lines, defined := s.matchers[arg]
+		if !defined {
+			s.b.report(s.source, "line %d: matcher %s not found", d.line, arg)
+			return nil, nil, false
+		}
+		if lines == nil {
+			return nil, nil, false
+		}
+		return lines, args[1:], true
+	}
+	return nil, args, true
+}
+
+func (s *caddySite) directive(d *caddyDirective) {
+	on, args, ok := s.matcher(d)
+	if !ok {
+		s.b.report(s.source, "line %d: %s is not translated", d.line, d.name())
+		return
+	}
+	onStr := strings.Join(on, "\n")
+	switch d.name() {
+	case "reverse_proxy":
+		up, cmds, noTLSVerify, ok := s.reverseProxy(d, args, on == nil)
+		if !ok {
+			return
+		}
+		if on == nil {
+			if s.up != nil {
+				s.b.report(s.source, "line %d: only the first reverse_proxy without matcher is used", d.line)
+				return
+			}
+			s.up, s.noTLSVerify = &up, noTLSVerify
+			return
+		}
+		if noTLSVerify {
+			s.b.report(s.source, "line %d: tls_insecure_skip_verify is only translated for reverse_proxy without matcher", d.line)
+		}
+		s.proxyRules = append(s.proxyRules, pathRule{
+			name:     "reverse_proxy " + strings.Join(d.args[1:2], ""),
+			on:       onStr,
+			do:       append(cmds, "proxy "+up.url()),
+			priority: len(onStr),
+		})
+	case "root":
+		if len(args) != 1 {
+			s.b.report(s.source, "line %d: invalid root", d.line)
+			return
+		}
+		if on != nil {
+			s.b.report(s.source, "line %d: root with a matcher is not supported", d.line)
+			return
+		}
+		s.root = args[0]
+	case "file_server":
+		if slices.Contains(args, "browse") {
+			s.b.report(s.source, "line %d: directory browsing is not supported", d.line)
+		}
+		if on != nil {
+			s.b.report(s.source, "line %d: file_server with a matcher is not supported", d.line)
+			return
+		}
+		s.fileServer = true
+	case "redir":
+		do, ok := s.redir(d, args)
+		if !ok {
+			return
+		}
+		s.redirRules = append(s.redirRules, ruleEntry("redir", cmp.Or(onStr, onAll), do))
+	case "respond":
+		do, ok := s.respond(d, args)
+		if !ok {
+			return
+		}
+		s.respondRules = append(s.respondRules, ruleEntry("respond", cmp.Or(onStr, onAll), do))
+	case "basic_auth", "basicauth":
+		if users, realm, ok := s.basicAuth(d, args); ok {
+			s.authRules = append(s.authRules, basicAuthRule(realm, users, onStr))
+		}
+	case "header", "request_header":
+		if on != nil {
+			s.b.report(s.source, "line %d: %s with a matcher is not supported", d.line, d.name())
+			return
+		}
+		s.headers(d, args)
+	case "uri":
+		if len(args) == 2 && args[0] == "strip_prefix" && on == nil {
+			s.prefixRules = append(s.prefixRules, stripPrefixRules(args[1])...)
+			return
+		}
+		s.b.report(s.source, "line %d: only uri strip_prefix without matcher is supported", d.line)
+	case "handle", "handle_path":
+		s.handle(d, on, onStr)
+	case "route":
+		s.b.report(s.source, "line %d: route blocks are not translated, use handle", d.line)
+	case "tls":
+		s.b.report(s.source, "line %d: tls is not translated, certificates are managed by autocert", d.line)
+	case "encode", "log":
+		s.b.report(s.source, "line %d: %s is not translated", d.line, d.name())
+	default:
+		s.b.report(s.source, "line %d: directive %s is not supported", d.line, d.name())
+	}
+}
+
+// reverseProxy translates a reverse_proxy directive, header_up subdirectives to commands,
+// or to the request middleware if route is true.
+func (s *caddySite) reverseProxy(d *caddyDirective, args []string, route bool) (up upstream, cmds []string, noTLSVerify, ok bool) {
+	upstreams := slices.Clone(args)
+	tls := false
+	set := make(map[string]string)
+	var hide []string
+	for _, sub := range d.block {
+		switch sub.name() {
+		case "to":
+			upstreams = append(upstreams, sub.args[1:]...)
+		case "transport":
+			if len(sub.args) < 2 || sub.args[1] != "http" {
+				s.b.report(s.source, "line %d: only the http transport is supported", sub.line)
+				continue
+			}
+			for _, t := range sub.block {
+				switch t.name() {
+				case "tls":
+					tls = true
+				case "tls_insecure_skip_verify":
+					tls, noTLSVerify = true, true
+				default:
+					s.b.report(s.source, "line %d: transport option %s is not supported", t.line, t.name())
+				}
+			}
+		case "header_up":
+			if len(sub.args) < 2 {
+				continue
+			}
+			field := sub.args[1]
+			switch {
+			case strings.HasPrefix(field, "-"):
+				hide = append(hide, field[1:])
+			case len(sub.args) == 3 && !strings.Contains(sub.args[2], "{"):
+				set[strings.TrimPrefix(field, "+")] = sub.args[2]
+			default:
+				s.b.report(s.source, "line %d: header_up with placeholders or replacements is not supported", sub.line)
+			}
+		default:
+			s.b.report(s.source, "line %d: reverse_proxy option %s is not supported", sub.line, sub.name())
+		}
+	}
+	if len(upstreams) == 0 {
+		s.b.report(s.source, "line %d: reverse_proxy without upstreams", d.line)
+		return up, nil, false, false
+	}
+	if len(upstreams) > 1 {
+		s.b.report(s.source, "line %d: only the first of %d upstreams is used, add a route per upstream with load_balance", d.line, len(upstreams))
+	}
+
+	addr := upstreams[0]
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	scheme := "http"
+	if tls {
+		scheme = "https"
+	}
+	up, err := parseUpstream(addr, scheme)
+	if err != nil {
+		s.b.report(s.source, "line %d: %s", d.line, err)
+		return up, nil, false, false
+	}
+
+	if route {
+		if len(set) > 0 || len(hide) > 0 {
+			addMiddleware(s.entry, "request", headerModifier(set, hide))
+		}
+		return up, nil, noTLSVerify, true
+	}
+	for _, k := range slices.Sorted(maps.Keys(set)) {
+		cmds = append(cmds, "set header "+quoteArg(k)+" "+quoteArg(set[k]))
+	}
+	for _, k := range hide {
+		cmds = append(cmds, "remove header "+quoteArg(k))
+	}
+	return up, cmds, noTLSVerify, true
+}
+
+func (s *caddySite) redir(d *caddyDirective, args []string) (string, bool) {
+	if len(args) == 0 {
+		s.b.report(s.source, "line %d: redir without a target", d.line)
+		return "", false
+	}
+	to := args[0]
+	for _, placeholder := range []string{"{uri}", "{path}", "{query}", "{http.request.uri}", "{http.request.uri.path}"} {
+		if strings.Contains(to, placeholder) {
+			to = strings.ReplaceAll(to, placeholder, "")
+			s.b.report(s.source, "line %d: %s is not appended to the redirect target", d.line, placeholder)
+		}
+	}
+	if strings.Contains(to, "{") {
+		s.b.report(s.source, "line %d: redir with placeholders is not supported", d.line)
+		return "", false
+	}
+	if len(args) > 1 {
+		s.b.report(s.source, "line %d: the status code %s of redir is not preserved", d.line, args[1])
+	}
+	return "redirect " + quoteArg(cmp.Or(to, "/")), true
+}
+
+func (s *caddySite) respond(d *caddyDirective, args []string) (string, bool) {
+	status, body := "200", ""
+	switch len(args) {
+	case 0:
+	case 1:
+		if isStatusCode(args[0]) {
+			status = args[0]
+		} else {
+			body = args[0]
+		}
+	default:
+		body, status = args[0], args[1]
+	}
+	if strings.Contains(body, "{") || d.block != nil {
+		s.b.report(s.source, "line %d: respond with placeholders or options is not supported", d.line)
+		return "", false
+	}
+	return "error " + status + " " + quoteArg(body), true
+}
+
+func isStatusCode(s string) bool {
+	return len(s) == 3 && strings.Trim(s, "0123456789") == ""
+}
+
+func (s *caddySite) basicAuth(d *caddyDirective, args []string) (users []credential, realm string, ok bool) {
+	if len(args) > 0 && args[0] != "bcrypt" {
+		s.b.report(s.source, "line %d: hash algorithm %s is not supported", d.line, args[0])
+		return nil, "", false
+	}
+	if len(args) > 1 {
+		realm = args[1]
+	}
+	for _, u := range d.block {
+		if len(u.args) < 2 {
+			continue
+		}
+		hash := u.args[1]
+		// base64 encoded before Caddy 2.8
+		if !isBcrypt(hash) {
+			if decoded, err := base64.StdEncoding.DecodeString(hash); err == nil {
+				hash = string(decoded)
+			}
+		}
+		if !isBcrypt(hash) {
+			s.b.report(s.source, "line %d: user %s: only bcrypt hashes are supported", u.line, u.name())
+			continue
+		}
+		users = append(users, credential{u.name(), hash})
+	}
+	return users, realm, len(users) > 0
+}
+
+// headers translates header and request_header to the response and request middlewares.
+func (s *caddySite) headers(d *caddyDirective, args []string) {
+	fields := [][]string{args}
+	if d.block != nil {
+		fields = nil
+		for _, f := range d.block {
+			fields = append(fields, f.args)
+		}
+	}
+	set := make(map[string]string)
+	add := make(map[string]string)
+	var hide []string
+	for _, f := range fields {
+		if len(f) == 0 {
+			continue
+		}
+		field := f[0]
+		switch {
+		case strings.HasPrefix(field, "-"):
+			hide = append(hide, field[1:])
+		case len(f) != 2 || strings.Contains(f[1], "{"):
+			s.b.report(s.source, "line %d: %s %s: replacements and placeholders are not supported", d.line, d.name(), field)
+		case strings.HasPrefix(field, "+"):
+			add[field[1:]] = f[1]
+		case strings.HasPrefix(field, ">"), strings.HasPrefix(field, "?"):
+			set[field[1:]] = f[1]
+		default:
+			set[field] = f[1]
+		}
+	}
+	mw := "response"
+	if d.name() == "request_header" {
+		mw = "request"
+	}
+	opts := headerModifier(set, hide)
+	if len(add) > 0 {
+		opts["add_headers"] = add
+	}
+	if len(opts) > 0 {
+		addMiddleware(s.entry, mw, opts)
+	}
+}
+
+// handle translates a handle or handle_path block to a rule of the requests matching on.
+func (s *caddySite) handle(d *caddyDirective, on []string, onStr string) {
+	var cmds []string
+	if d.name() == "handle_path" {
+		if len(d.args) < 2 || !strings.HasPrefix(d.args[1], "/") {
+			s.b.report(s.source, "line %d: handle_path requires a path", d.line)
+			return
+		}
+		prefix := strings.TrimSuffix(strings.TrimSuffix(d.args[1], "*"), "/")
+		if prefix != "" {
+			cmds = append(cmds, "rewrite "+prefix+"/ /")
+		}
+	}
+
+	var terminal string
+	for _, sub := range s.expandImports(d.block, 0) {
+		subOn, args, ok := s.matcher(sub)
+		if !ok || subOn != nil {
+			s.b.report(s.source, "line %d: %s with a matcher in %s is not supported", sub.line, sub.name(), d.name())
+			continue
+		}
+		if terminal != "" {
+			s.b.report(s.source, "line %d: %s after %s in %s is not translated", sub.line, sub.name(), strings.Fields(terminal)[0], d.name())
+			continue
+		}
+		switch sub.name() {
+		case "reverse_proxy":
+			up, c, noTLSVerify, ok := s.reverseProxy(sub, args, false)
+			if !ok {
+				continue
+			}
+			if noTLSVerify {
+				s.b.report(s.source, "line %d: tls_insecure_skip_verify is only translated for reverse_proxy without matcher", sub.line)
+			}
+			cmds = append(cmds, c...)
+			terminal = "proxy " + up.url()
+		case "redir":
+			if do, ok := s.redir(sub, args); ok {
+				terminal = do
+			}
+		case "respond":
+			if do, ok := s.respond(sub, args); ok {
+				terminal = do
+			}
+		case "root":
+			if len(args) == 1 {
+				terminal = "serve " + quoteArg(args[0])
+			}
+		case "file_server":
+			// served by root
+		case "uri":
+			if len(args) == 2 && args[0] == "strip_prefix" {
+				cmds = append(cmds, "rewrite "+strings.TrimSuffix(args[1], "/")+"/ /")
+				continue
+			}
+			s.b.report(s.source, "line %d: only uri strip_prefix is supported", sub.line)
+		case "encode", "log":
+			s.b.report(s.source, "line %d: %s is not translated", sub.line, sub.name())
+		default:
+			s.b.report(s.source, "line %d: directive %s in %s is not supported", sub.line, sub.name(), d.name())
+		}
+	}
+	if terminal == "" {
+		s.b.report(s.source, "line %d: %s without reverse_proxy, redir, respond or root is not translated", d.line, d.name())
+		return
+	}
+
+	if on == nil {
+		onStr = "default"
+		s.fallback = true
+	}
+	s.handleRules = append(s.handleRules, pathRule{
+		name:     d.name() + " " + strings.Join(d.args[1:], " "),
+		on:       onStr,
+		do:       append(cmds, terminal),
+		priority: len(onStr),
+	})
+}
@@ -0,0 +1,198 @@
+package importer
+
+import (
+	"cmp"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yusing/godoxy/internal/types"
+	gperr "github.com/yusing/goutils/errs"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrInvalidUpstream = gperr.New("invalid upstream")
+
+// upstream is a backend of a route.
+type upstream struct {
+	scheme string
+	host   string
+	port   string
+}
+
+// parseUpstream parses an upstream URL, or a host:port with the default scheme.
+//
+// The host is not validated, it may be an env placeholder like "${APP_HOST}".
+func parseUpstream(s, defaultScheme string) (upstream, error) {
+	up := upstream{scheme: defaultScheme}
+	hostPort := s
+	if scheme, rest, ok := strings.Cut(s, "://"); ok {
+		up.scheme, hostPort = strings.ToLower(scheme), rest
+	}
+	hostPort, _, _ = strings.Cut(hostPort, "/")
+	if host, port, err := net.SplitHostPort(hostPort); err == nil {
+		up.host, up.port = host, port
+	} else {
+		up.host = strings.Trim(hostPort, "[]")
+	}
+	if up.host == "" {
+		return upstream{}, ErrInvalidUpstream.Subject(s)
+	}
+	switch up.scheme {
+	case "http", "https", "h2c", "tcp", "udp":
+	default:
+		return upstream{}, ErrInvalidUpstream.Subjectf("scheme %s", up.scheme)
+	}
+	if up.port == "" {
+		switch up.scheme {
+		case "http", "h2c":
+			up.port = "80"
+		case "https":
+			up.port = "443"
+		default:
+			return upstream{}, ErrInvalidUpstream.Subjectf("missing port in %s", s)
+		}
+	}
+	if _, err := strconv.Atoi(up.port); err != nil && !strings.HasPrefix(up.port, "${") {
+		return upstream{}, ErrInvalidUpstream.Subjectf("port %s", up.port)
+	}
+	return up, nil
+}
+
+func (u upstream) url() string {
+	return u.scheme + "://" + net.JoinHostPort(u.host, u.port)
+}
+
+func (u upstream) entry() types.LabelMap {
+	return types.LabelMap{
+		"scheme": u.scheme,
+		"host":   u.host,
+		"port":   u.port,
+	}
+}
+
+// quoteArg quotes a rule argument if it has spaces or quotes.
+func quoteArg(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n\"'`\\") {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+// onAll is a rule matcher of all requests.
+const onAll = `path glob("/*")`
+
+// prefixMatcher is a rule matcher of paths starting with prefix, like PathPrefix of Traefik.
+//
+// It is empty for "/", which matches all paths.
+func prefixMatcher(prefix string) string {
+	if prefix == "" || prefix == "/" {
+		return ""
+	}
+	return `path glob("` + prefix + `*")`
+}
+
+// stripPrefixRules strips prefix from request paths, "/api" turns "/api/foo" into "/foo" and "/api" into "/".
+func stripPrefixRules(prefix string) []any {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return nil
+	}
+	return []any{
+		ruleEntry("strip prefix "+prefix, "path "+prefix, "rewrite "+prefix+" /"),
+		ruleEntry("strip prefix "+prefix+"/", `path glob("`+prefix+`/*")`, "rewrite "+prefix+"/ /"),
+	}
+}
+
+// credential is a basic auth user, hash is a bcrypt hash.
+type credential struct {
+	user string
+	hash string
+}
+
+// isBcrypt reports whether hash is a bcrypt hash, other htpasswd formats are not supported by basic_auth.
+func isBcrypt(hash string) bool {
+	_, err := bcrypt.Cost([]byte(hash))
+	return err == nil
+}
+
+// basicAuthRule requires one of the users, on is the condition of the protected requests, empty for all.
+func basicAuthRule(realm string, users []credential, on string) map[string]any {
+	lines := make([]string, 0, len(users)+1)
+	if on != "" {
+		lines = append(lines, on)
+	}
+	for _, u := range users {
+		lines = append(lines, "!basic_auth "+quoteArg(u.user)+" "+quoteArg(u.hash))
+	}
+	return ruleEntry("basic auth", strings.Join(lines, "\n"), "require_basic_auth "+quoteArg(cmp.Or(realm, "Restricted")))
+}
+
+// headerModifier is the options of the request and response middlewares.
+func headerModifier(set map[string]string, hide []string) map[string]any {
+	opts := make(map[string]any)
+	if len(set) > 0 {
+		opts["set_headers"] = set
+	}
+	if len(hide) > 0 {
+		slices.Sort(hide)
+		opts["hide_headers"] = hide
+	}
+	return opts
+}
+
+// pathRule is a rule proxying the requests matching on to another upstream.
+type pathRule struct {
+	name     string
+	on       string
+	do       []string
+	priority int
+}
+
+// pathRules sorts rules by priority, highest first, and adds a not found rule if there is no catch-all.
+func pathRules(rules []pathRule, catchAll bool) []any {
+	slices.SortStableFunc(rules, func(a, b pathRule) int {
+		return b.priority - a.priority
+	})
+	out := make([]any, 0, len(rules)+1)
+	for _, r := range rules {
+		out = append(out, ruleEntry(r.name, r.on, strings.Join(r.do, "\n")))
+	}
+	if !catchAll {
+		out = append(out, ruleEntry("not found", "default", `error 404 "not found"`))
+	}
+	return out
+}
+
+func appendRules(entry types.LabelMap, rules ...any) {
+	if len(rules) == 0 {
+		return
+	}
+	existing, _ := entry["rules"].([]any)
+	entry["rules"] = append(existing, rules...)
+}
+
+func addMiddleware(entry types.LabelMap, name string, opts map[string]any) {
+	mws, _ := entry["middlewares"].(map[string]any)
+	if mws == nil {
+		mws = make(map[string]any)
+		entry["middlewares"] = mws
+	}
+	if existing, ok := mws[name].(map[string]any); ok {
+		// e.g. headers of multiple Traefik middlewares
+		for k, v := range opts {
+			if m, ok := v.(map[string]string); ok {
+				if em, ok := existing[k].(map[string]string); ok {
+					for hk, hv := range m {
+						em[hk] = hv
+					}
+					continue
+				}
+			}
+			existing[k] = v
+		}
+		return
+	}
+	mws[name] = opts
+}
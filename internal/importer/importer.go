@@ -0,0 +1,193 @@
+// Package importer converts routes of other reverse proxies to GoDoxy route files.
+package importer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/yusing/godoxy/internal/types"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+type Format string
+
+const (
+	FormatTraefik       Format = "traefik"        // Traefik dynamic configuration file in YAML
+	FormatTraefikLabels Format = "traefik-labels" // docker compose file with Traefik labels
+	FormatCaddy         Format = "caddy"          // Caddyfile
+	FormatNPM           Format = "npm"            // Nginx Proxy Manager SQLite database
+)
+
+var Formats = []Format{FormatTraefik, FormatTraefikLabels, FormatCaddy, FormatNPM}
+
+// Issue is a part of the source configuration that was not translated, or only approximately.
+type Issue struct {
+	Source  string `json:"source"` // e.g. "router web", "proxy_host 3"
+	Message string `json:"message"`
+} // @name ImportIssue
+
+type Result struct {
+	Routes map[string]types.LabelMap `json:"routes"`
+	Report []Issue                   `json:"report"`
+} // @name ImportResult
+
+var (
+	ErrUnknownFormat = gperr.New("unknown import format")
+	ErrNoRoutes      = gperr.New("no routes found")
+	ErrSQLiteWAL     = gperr.New("the database has changes in its WAL file, stop Nginx Proxy Manager or checkpoint the database before importing it")
+)
+
+// Import converts a configuration file of the format to routes.
+//
+// Only unreadable input fails the import, untranslated parts are listed in the report.
+//
+// Nginx Proxy Manager databases in WAL mode are refused since the WAL file cannot be checked, see ImportFile.
+func Import(format Format, data []byte) (*Result, gperr.Error) {
+	return importData(newBuilder(), format, data)
+}
+
+// ImportFile converts the configuration file at path of the format to routes, see Import.
+//
+// Nginx Proxy Manager databases are refused while a non-empty WAL file (<path>-wal) exists,
+// otherwise databases in WAL mode are complete and imported.
+func ImportFile(format Format, path string) (*Result, gperr.Error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, gperr.Wrap(err)
+	}
+	b := newBuilder()
+	if format == FormatNPM {
+		stat, err := os.Stat(path + "-wal")
+		switch {
+		case err == nil && stat.Size() > 0:
+			return nil, ErrSQLiteWAL.Subject(path + "-wal")
+		case err != nil && !errors.Is(err, fs.ErrNotExist):
+			return nil, gperr.Wrap(err)
+		}
+		b.walChecked = true
+	}
+	return importData(b, format, data)
+}
+
+func importData(b *builder, format Format, data []byte) (*Result, gperr.Error) {
+	var err error
+	switch format {
+	case FormatTraefik:
+		err = importTraefikFile(b, data)
+	case FormatTraefikLabels:
+		err = importTraefikLabels(b, data)
+	case FormatCaddy:
+		err = importCaddyfile(b, data)
+	case FormatNPM:
+		err = importNPM(b, data)
+	default:
+		return nil, ErrUnknownFormat.Subject(string(format))
+	}
+	if err != nil {
+		return nil, gperr.Wrap(err).Subject(string(format))
+	}
+	if len(b.result.Routes) == 0 && len(b.result.Report) == 0 {
+		return nil, ErrNoRoutes.Subject(string(format))
+	}
+	return b.result, nil
+}
+
+// builder collects the routes and the report of an import.
+type builder struct {
+	result     *Result
+	sources    map[string]string // alias -> source of the route
+	walChecked bool              // the WAL file of the database is known to be empty
+}
+
+func newBuilder() *builder {
+	return &builder{
+		result:  &Result{Routes: make(map[string]types.LabelMap)},
+		sources: make(map[string]string),
+	}
+}
+
+func (b *builder) report(source, format string, args ...any) {
+	b.result.Report = append(b.result.Report, Issue{Source: source, Message: fmt.Sprintf(format, args...)})
+}
+
+// add adds a route, the first source defining an alias wins.
+func (b *builder) add(source, alias string, entry types.LabelMap) {
+	if strings.HasPrefix(alias, "*") {
+		b.report(source, "wildcard host %s is not supported", alias)
+		return
+	}
+	if conflict, ok := b.sources[alias]; ok {
+		b.report(source, "route %s is already defined by %s", alias, conflict)
+		return
+	}
+	b.sources[alias] = source
+	b.result.Routes[alias] = entry
+}
+
+func ruleEntry(name, on, do string) map[string]any {
+	return map[string]any{"name": name, "on": on, "do": do}
+}
+
+// entryKeyOrder is the order of known route fields in the generated YAML, other fields follow sorted.
+var entryKeyOrder = []string{"scheme", "host", "port", "root", "spa", "index", "no_tls_verify", "path_patterns", "middlewares", "rules"}
+
+// YAML returns the routes as a route file, with the report as a comment on top.
+func (r *Result) YAML() ([]byte, error) {
+	var buf bytes.Buffer
+	if len(r.Report) > 0 {
+		buf.WriteString("# Not translated or approximated:\n")
+		for _, issue := range r.Report {
+			fmt.Fprintf(&buf, "#   %s: %s\n", issue.Source, strings.ReplaceAll(issue.Message, "\n", " "))
+		}
+		buf.WriteString("\n")
+	}
+	if len(r.Routes) == 0 {
+		return buf.Bytes(), nil
+	}
+
+	routes := make(yaml.MapSlice, 0, len(r.Routes))
+	for _, alias := range slices.Sorted(maps.Keys(r.Routes)) {
+		routes = append(routes, yaml.MapItem{Key: alias, Value: orderedEntry(r.Routes[alias])})
+	}
+	out, err := yaml.MarshalWithOptions(routes, yaml.UseLiteralStyleIfMultiline(true), yaml.IndentSequence(true))
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(out)
+	return buf.Bytes(), nil
+}
+
+func orderedEntry(entry types.LabelMap) yaml.MapSlice {
+	ordered := make(yaml.MapSlice, 0, len(entry))
+	for _, k := range entryKeyOrder {
+		v, ok := entry[k]
+		if !ok {
+			continue
+		}
+		if rules, ok := v.([]any); ok && k == "rules" {
+			// name, on, do as in the documentation
+			orderedRules := make([]any, len(rules))
+			for i, rule := range rules {
+				orderedRules[i] = rule
+				if rule, ok := rule.(map[string]any); ok {
+					orderedRules[i] = yaml.MapSlice{{Key: "name", Value: rule["name"]}, {Key: "on", Value: rule["on"]}, {Key: "do", Value: rule["do"]}}
+				}
+			}
+			v = orderedRules
+		}
+		ordered = append(ordered, yaml.MapItem{Key: k, Value: v})
+	}
+	for _, k := range slices.Sorted(maps.Keys(entry)) {
+		if !slices.Contains(entryKeyOrder, k) {
+			ordered = append(ordered, yaml.MapItem{Key: k, Value: entry[k]})
+		}
+	}
+	return ordered
+}
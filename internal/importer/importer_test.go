@@ -0,0 +1,354 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+	"github.com/yusing/godoxy/internal/route/provider"
+	"github.com/yusing/godoxy/internal/route/rules"
+	"github.com/yusing/godoxy/internal/types"
+	expect "github.com/yusing/goutils/testing"
+)
+
+func hasIssue(result *Result, source, msg string) bool {
+	for _, issue := range result.Report {
+		if strings.HasPrefix(issue.Source, source) && strings.Contains(issue.Message, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTraefikRule(t *testing.T) {
+	tests := []struct {
+		rule  string
+		terms []traefikTerm
+	}{
+		{"Host(`a.com`)", []traefikTerm{{hosts: []string{"a.com"}}}},
+		{"Host(`a.com`, `B.com`) && PathPrefix(`/`)", []traefikTerm{{hosts: []string{"a.com", "b.com"}}}},
+		{
+			"Host(`a.com`) && (PathPrefix(`/api`) || Path(`/health`)) && !Method(`DELETE`)",
+			[]traefikTerm{
+				{hosts: []string{"a.com"}, on: []string{`path glob("/api*")`, "!method DELETE"}},
+				{hosts: []string{"a.com"}, on: []string{"path /health", "!method DELETE"}},
+			},
+		},
+		{
+			"Host(\"a.com\") && !(ClientIP(`10.0.0.0/8`) || Header(`X-Key`, `a b`))",
+			[]traefikTerm{{hosts: []string{"a.com"}, on: []string{"!remote 10.0.0.0/8", `!header X-Key "a b"`}}},
+		},
+		{"Host(`a.com`) && Query(`page=2`)", []traefikTerm{{hosts: []string{"a.com"}, on: []string{"query page 2"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			expr, err := parseTraefikRule(tt.rule)
+			expect.NoError(t, err)
+			lits, err := expr.dnf(false)
+			expect.NoError(t, err)
+			var terms []traefikTerm
+			for _, l := range lits {
+				term, err := translateTraefikTerm(l)
+				expect.NoError(t, err)
+				terms = append(terms, term)
+			}
+			expect.Equal(t, terms, tt.terms)
+		})
+	}
+
+	for _, rule := range []string{"Host(`a.com`", "Host(`a.com`) & Path(`/`)", "Host(a.com)", "&& Host(`a`)"} {
+		_, err := parseTraefikRule(rule)
+		expect.ErrorIs(t, ErrInvalidTraefikRule, err)
+	}
+}
+
+const traefikDynamic = `
+http:
+  routers:
+    app:
+      rule: Host(` + "`app.example.com`" + `)
+      service: app
+      middlewares: [auth, secure@file]
+    app-http:
+      rule: Host(` + "`app.example.com`" + `)
+      service: app
+      middlewares: [https]
+    app-api:
+      rule: Host(` + "`app.example.com`" + `) && PathPrefix(` + "`/api`" + `)
+      service: api
+      middlewares: [strip-api]
+    sni:
+      rule: HostRegexp(` + "`.+`" + `)
+      service: app
+  services:
+    app:
+      loadBalancer:
+        servers:
+          - url: http://10.0.0.5:8080
+    api:
+      loadBalancer:
+        servers:
+          - url: https://10.0.0.6
+          - url: https://10.0.0.7
+  middlewares:
+    auth:
+      basicAuth:
+        users:
+          - "alice:$2y$05$WFwJ4WF2HF.2gNTm3l9/QOx6z5kXJjJ6Ckm4tnQvPKfLXxcsyPAZK"
+          - "bob:$apr1$H6uskkkW$IgXLP6ewTrSuBkTrqE8wj/"
+    secure:
+      headers:
+        customRequestHeaders:
+          X-Forwarded-Proto: https
+          X-Remove: ""
+        stsSeconds: 31536000
+        frameDeny: true
+        accessControlAllowOriginList: ["*"]
+    https:
+      redirectScheme:
+        scheme: https
+    strip-api:
+      stripPrefix:
+        prefixes: [/api]
+tcp:
+  routers:
+    db:
+      rule: HostSNI(` + "`*`" + `)
+      entryPoints: [postgres]
+      service: db
+  services:
+    db:
+      loadBalancer:
+        servers:
+          - address: 10.0.0.8:5432
+`
+
+func TestImportTraefik(t *testing.T) {
+	result, err := Import(FormatTraefik, []byte(traefikDynamic))
+	expect.NoError(t, err)
+
+	app := result.Routes["app.example.com"]
+	expect.Equal(t, app["host"], any("10.0.0.5"))
+	expect.Equal(t, app["port"], any("8080"))
+	expect.Equal(t, app["middlewares"], any(map[string]any{
+		"redirect_http": map[string]any{},
+		"request": map[string]any{
+			"set_headers":  map[string]string{"X-Forwarded-Proto": "https"},
+			"hide_headers": []string{"X-Remove"},
+		},
+		"response": map[string]any{
+			"set_headers": map[string]string{"Strict-Transport-Security": "max-age=31536000", "X-Frame-Options": "DENY"},
+		},
+	}))
+	expect.Equal(t, app["rules"], any([]any{
+		ruleEntry("router app-api", `path glob("/api*")`, "rewrite /api/ /\nproxy https://10.0.0.6:443"),
+		basicAuthRule("", []credential{{"alice", "$2y$05$WFwJ4WF2HF.2gNTm3l9/QOx6z5kXJjJ6Ckm4tnQvPKfLXxcsyPAZK"}}, ""),
+	}))
+
+	db := result.Routes["db"]
+	expect.Equal(t, db["scheme"], any("tcp"))
+	expect.Equal(t, db["port"], any("5432:5432"))
+
+	expect.True(t, hasIssue(result, "middleware auth", "user bob: only bcrypt"))
+	expect.True(t, hasIssue(result, "middleware secure", "accessControlAllowOriginList"))
+	expect.True(t, hasIssue(result, "router sni", "HostRegexp is not supported"))
+	expect.True(t, hasIssue(result, "service api", "only the first of 2 servers"))
+	expect.True(t, hasIssue(result, "tcp router db", "postgres"))
+}
+
+const traefikCompose = `
+services:
+  whoami:
+    image: traefik/whoami
+    labels:
+      - traefik.enable=true
+      - traefik.http.routers.whoami.rule=Host(` + "`whoami.example.com`" + `)
+      - traefik.http.routers.whoami.middlewares=office
+      - traefik.http.middlewares.office.ipallowlist.sourcerange=10.0.0.0/8, 192.168.0.0/16
+      - traefik.http.services.whoami.loadbalancer.server.port=8080
+  web:
+    image: nginx
+    container_name: nginx
+    expose: ["80"]
+    labels:
+      traefik.http.routers.web.rule: Host(` + "`web.example.com`" + `) || Host(` + "`www.example.com`" + `)
+      traefik.http.middlewares.limit.ratelimit.average: "100"
+  plain:
+    image: plain
+    ports: ["8081:80"]
+    labels:
+      traefik.enable: "true"
+  disabled:
+    image: disabled
+    labels:
+      traefik.enable: "false"
+      traefik.http.routers.disabled.rule: Host(` + "`disabled.example.com`" + `)
+  untraefiked:
+    image: postgres
+`
+
+func TestImportTraefikLabels(t *testing.T) {
+	result, err := Import(FormatTraefikLabels, []byte(traefikCompose))
+	expect.NoError(t, err)
+
+	expect.Equal(t, result.Routes["whoami.example.com"], types.LabelMap{
+		"scheme":      "http",
+		"host":        "whoami",
+		"port":        "8080",
+		"middlewares": map[string]any{"cidr_whitelist": map[string]any{"allow": []string{"10.0.0.0/8", "192.168.0.0/16"}}},
+	})
+	expect.Equal(t, result.Routes["web.example.com"], types.LabelMap{"scheme": "http", "host": "nginx", "port": "80"})
+	expect.Equal(t, result.Routes["www.example.com"], types.LabelMap{"scheme": "http", "host": "nginx", "port": "80"})
+	expect.Equal(t, result.Routes["plain"], types.LabelMap{"scheme": "http", "host": "plain", "port": "80"})
+	expect.Equal(t, len(result.Routes), 4)
+	expect.True(t, hasIssue(result, "service plain", "default rule"))
+}
+
+const caddyfile = `
+{
+	email admin@example.com
+}
+
+(secure) {
+	header {
+		Strict-Transport-Security "max-age=31536000"
+		-Server
+	}
+}
+
+app.example.com, www.example.com {
+	import secure
+	@admin {
+		path /admin/*
+		not remote_ip private_ranges
+	}
+	respond @admin "Forbidden" 403
+	basic_auth /private/* {
+		alice $2a$14$Zkx19XLiW6VYouLHR5NmfOFU0z2GTNmpkT/5qqR7hx4IjWJPDhjvG
+	}
+	handle_path /api/* {
+		reverse_proxy api:9000 {
+			header_up X-Api "1"
+		}
+	}
+	reverse_proxy {$APP_HOST}:8080 {
+		transport http {
+			tls_insecure_skip_verify
+		}
+	}
+	encode gzip
+}
+
+static.example.com {
+	root * /srv/www
+	file_server browse
+}
+
+http://old.example.com {
+	redir https://app.example.com{uri} permanent
+}
+`
+
+func TestImportCaddy(t *testing.T) {
+	result, err := Import(FormatCaddy, []byte(caddyfile))
+	expect.NoError(t, err)
+
+	app := result.Routes["app.example.com"]
+	expect.Equal(t, app["scheme"], any("https"))
+	expect.Equal(t, app["host"], any("${APP_HOST}"))
+	expect.Equal(t, app["port"], any("8080"))
+	expect.Equal(t, app["no_tls_verify"], any(true))
+	expect.Equal(t, app["middlewares"], any(map[string]any{
+		"response": map[string]any{
+			"set_headers":  map[string]string{"Strict-Transport-Security": "max-age=31536000"},
+			"hide_headers": []string{"Server"},
+		},
+	}))
+	expect.Equal(t, app["rules"], any([]any{
+		basicAuthRule("", []credential{{"alice", "$2a$14$Zkx19XLiW6VYouLHR5NmfOFU0z2GTNmpkT/5qqR7hx4IjWJPDhjvG"}}, `path glob("/private/*")`),
+		ruleEntry("handle_path /api/*", `path glob("/api/*")`, "rewrite /api/ /\nset header X-Api 1\nproxy http://api:9000"),
+		ruleEntry("respond", `path glob("/admin/*")
+!remote 192.168.0.0/16
+!remote 172.16.0.0/12
+!remote 10.0.0.0/8
+!remote 127.0.0.1/8
+!remote fd00::/8
+!remote ::1`, "error 403 Forbidden"),
+	}))
+	expect.Equal(t, result.Routes["www.example.com"]["host"], any("${APP_HOST}"))
+
+	expect.Equal(t, result.Routes["static.example.com"], types.LabelMap{"scheme": "fileserver", "root": "/srv/www"})
+	expect.Equal(t, result.Routes["old.example.com"], nil)
+
+	expect.True(t, hasIssue(result, "global options", "not translated"))
+	expect.True(t, hasIssue(result, "site static.example.com", "browsing"))
+	expect.True(t, hasIssue(result, "site http://old.example.com", "redirect only"))
+	expect.True(t, hasIssue(result, "site app.example.com", "encode"))
+}
+
+func TestImportErrors(t *testing.T) {
+	_, err := Import("haproxy", nil)
+	expect.ErrorIs(t, ErrUnknownFormat, err)
+	_, err = Import(FormatCaddy, []byte("example.com {\n"))
+	expect.ErrorIs(t, ErrInvalidCaddyfile, err)
+	_, err = Import(FormatTraefik, []byte("http: {}"))
+	expect.ErrorIs(t, ErrNoRoutes, err)
+}
+
+func TestResultYAML(t *testing.T) {
+	result, err := Import(FormatTraefik, []byte(traefikDynamic))
+	expect.NoError(t, err)
+	out, err := result.YAML()
+	expect.NoError(t, err)
+	expect.True(t, strings.HasPrefix(string(out), "# Not translated or approximated:\n"))
+	expect.True(t, strings.Contains(string(out), "\n#   router sni: HostRegexp"))
+
+	var routes map[string]types.LabelMap
+	expect.NoError(t, yaml.Unmarshal(out, &routes))
+	expect.Equal(t, len(routes), len(result.Routes))
+	rule := routes["app.example.com"]["rules"].([]any)[0].(map[string]any)
+	expect.Equal(t, rule["do"], any("rewrite /api/ /\nproxy https://10.0.0.6:443"))
+	// fields in the documented order
+	expect.True(t, strings.Index(string(out), "scheme: http") < strings.Index(string(out), "middlewares:"))
+	expect.True(t, strings.Index(string(out), "- name: router app-api\n      \"on\": ") > 0)
+}
+
+// TestResultYAMLRoundTrip checks that the route files of every format are accepted like route files of the file provider.
+func TestResultYAMLRoundTrip(t *testing.T) {
+	t.Setenv("APP_HOST", "10.0.0.9")
+	tests := []struct {
+		format Format
+		data   []byte
+	}{
+		{FormatTraefik, []byte(traefikDynamic)},
+		{FormatTraefikLabels, []byte(traefikCompose)},
+		{FormatCaddy, []byte(caddyfile)},
+		{FormatNPM, readNPMTestDB(t)},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			result, err := Import(tt.format, tt.data)
+			expect.NoError(t, err)
+			out, err := result.YAML()
+			expect.NoError(t, err)
+			expect.NoError(t, provider.Validate(out))
+
+			var routes map[string]types.LabelMap
+			expect.NoError(t, yaml.Unmarshal(out, &routes))
+			for alias, entry := range routes {
+				entryRules, _ := entry["rules"].([]any)
+				for _, rule := range entryRules {
+					rule := rule.(map[string]any)
+					var on rules.RuleOn
+					var do rules.Command
+					if err := on.Parse(rule["on"].(string)); err != nil {
+						t.Errorf("%s: rule %s: on: %v", alias, rule["name"], err)
+					}
+					if err := do.Parse(rule["do"].(string)); err != nil {
+						t.Errorf("%s: rule %s: do: %v", alias, rule["name"], err)
+					}
+				}
+			}
+		})
+	}
+}
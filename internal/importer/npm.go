@@ -0,0 +1,345 @@
+package importer
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+
+	"github.com/yusing/godoxy/internal/types"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Nginx Proxy Manager database, see https://github.com/NginxProxyManager/nginx-proxy-manager/tree/develop/backend/migrations.
+
+type npmLocation struct {
+	Path           string `json:"path"`
+	ForwardScheme  string `json:"forward_scheme"`
+	ForwardHost    string `json:"forward_host"`
+	ForwardPort    any    `json:"forward_port"`
+	AdvancedConfig string `json:"advanced_config"`
+}
+
+type npmAccessList struct {
+	name    string
+	allow   []string
+	deny    []string
+	users   []credential
+	anyOf   bool // satisfy any instead of all
+	invalid bool
+}
+
+func importNPM(b *builder, data []byte) error {
+	db, err := openSQLite(data)
+	if err != nil {
+		return err
+	}
+	if db.walMode && !b.walChecked {
+		return ErrSQLiteWAL
+	}
+
+	accessLists := npmAccessLists(b, db)
+
+	hosts, err := db.Rows("proxy_host")
+	if err != nil {
+		return err
+	}
+	for _, row := range hosts {
+		if npmInt(row, "is_deleted") != 0 {
+			continue
+		}
+		npmProxyHost(b, row, accessLists)
+	}
+
+	for _, table := range []string{"redirection_host", "dead_host"} {
+		rows, err := db.Rows(table)
+		if err != nil {
+			continue // missing in old versions
+		}
+		for _, row := range rows {
+			if npmInt(row, "is_deleted") != 0 {
+				continue
+			}
+			source := fmt.Sprintf("%s %d", table, npmInt(row, "id"))
+			domains := strings.Join(npmDomains(row), ", ")
+			if table == "redirection_host" {
+				b.report(source, "redirection of %s to %s is not translated, add a redirect rule", domains, npmString(row, "forward_domain_name"))
+			} else {
+				b.report(source, "404 host %s is not translated", domains)
+			}
+		}
+	}
+
+	streams, err := db.Rows("stream")
+	if err != nil {
+		return nil // missing in old versions
+	}
+	for _, row := range streams {
+		if npmInt(row, "is_deleted") != 0 {
+			continue
+		}
+		npmStream(b, row)
+	}
+	return nil
+}
+
+func npmString(row sqliteRow, col string) string {
+	switch v := row[col].(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	}
+	return ""
+}
+
+func npmInt(row sqliteRow, col string) int64 {
+	switch v := row[col].(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	case string:
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	}
+	return 0
+}
+
+// npmEnabled reports whether a host is enabled, the column is missing in old versions.
+func npmEnabled(row sqliteRow) bool {
+	v, ok := row["enabled"]
+	return !ok || v == nil || npmInt(row, "enabled") != 0
+}
+
+func npmDomains(row sqliteRow) []string {
+	var domains []string
+	_ = json.Unmarshal([]byte(npmString(row, "domain_names")), &domains)
+	for i, d := range domains {
+		domains[i] = strings.ToLower(d)
+	}
+	return domains
+}
+
+func npmAccessLists(b *builder, db *sqliteDB) map[int64]*npmAccessList {
+	lists := make(map[int64]*npmAccessList)
+	rows, err := db.Rows("access_list")
+	if err != nil { // missing in old versions
+		return lists
+	}
+	for _, row := range rows {
+		if npmInt(row, "is_deleted") != 0 {
+			continue
+		}
+		lists[npmInt(row, "id")] = &npmAccessList{
+			name:  npmString(row, "name"),
+			anyOf: npmInt(row, "satisfy_any") != 0,
+		}
+	}
+
+	if rows, err = db.Rows("access_list_client"); err == nil {
+		for _, row := range rows {
+			list, ok := lists[npmInt(row, "access_list_id")]
+			if !ok {
+				continue
+			}
+			address := npmString(row, "address")
+			if npmString(row, "directive") == "allow" {
+				list.allow = append(list.allow, address)
+			} else {
+				list.deny = append(list.deny, address)
+			}
+		}
+	}
+
+	if rows, err = db.Rows("access_list_auth"); err == nil {
+		for _, row := range rows {
+			list, ok := lists[npmInt(row, "access_list_id")]
+			if !ok {
+				continue
+			}
+			user := npmString(row, "username")
+			// stored in plain text by Nginx Proxy Manager
+			hash, err := bcrypt.GenerateFromPassword([]byte(npmString(row, "password")), bcrypt.DefaultCost)
+			if err != nil {
+				b.report("access list "+list.name, "user %s: %s", user, err)
+				list.invalid = true
+				continue
+			}
+			list.users = append(list.users, credential{user, string(hash)})
+		}
+	}
+	return lists
+}
+
+func npmProxyHost(b *builder, row sqliteRow, accessLists map[int64]*npmAccessList) {
+	source := fmt.Sprintf("proxy_host %d", npmInt(row, "id"))
+	domains := npmDomains(row)
+	if len(domains) == 0 {
+		b.report(source, "no domain names")
+		return
+	}
+	source += " (" + domains[0] + ")"
+	if !npmEnabled(row) {
+		b.report(source, "disabled, not translated")
+		return
+	}
+
+	// forward_host is forward_ip before 2.0
+	host := cmp.Or(npmString(row, "forward_host"), npmString(row, "forward_ip"))
+	up, err := parseUpstream(host+":"+npmString(row, "forward_port"), cmp.Or(npmString(row, "forward_scheme"), "http"))
+	if err != nil {
+		b.report(source, "%s", err)
+		return
+	}
+
+	var locations []npmLocation
+	_ = json.Unmarshal([]byte(npmString(row, "locations")), &locations)
+	var rules []pathRule
+	var addPrefix string
+	for _, loc := range locations {
+		if loc.Path == "" {
+			continue
+		}
+		// forward_host may have a path, e.g. "backend/api"
+		locHost, locPath, _ := strings.Cut(loc.ForwardHost, "/")
+		locUp, err := parseUpstream(locHost+":"+asString(loc.ForwardPort), cmp.Or(loc.ForwardScheme, "http"))
+		if err != nil {
+			b.report(source, "location %s: %s", loc.Path, err)
+			continue
+		}
+		if strings.TrimSpace(loc.AdvancedConfig) != "" {
+			b.report(source, "location %s: the custom Nginx configuration is not translated", loc.Path)
+		}
+		on := prefixMatcher(loc.Path)
+		if on == "" { // location / overrides the upstream
+			up, addPrefix = locUp, locPath
+			continue
+		}
+		target := locUp.url()
+		if locPath != "" {
+			target += "/" + locPath
+		}
+		rules = append(rules, pathRule{
+			name:     "location " + loc.Path,
+			on:       on,
+			do:       []string{"proxy " + target},
+			priority: len(loc.Path),
+		})
+	}
+
+	entry := up.entry()
+	if addPrefix != "" {
+		addMiddleware(entry, "request", map[string]any{"add_prefix": "/" + addPrefix})
+	}
+	if npmInt(row, "ssl_forced") != 0 {
+		addMiddleware(entry, "redirect_http", map[string]any{})
+	}
+	if npmInt(row, "hsts_enabled") != 0 {
+		sts := "max-age=63072000"
+		if npmInt(row, "hsts_subdomains") != 0 {
+			sts += "; includeSubDomains"
+		}
+		addMiddleware(entry, "response", headerModifier(map[string]string{"Strict-Transport-Security": sts}, nil))
+	}
+	if npmInt(row, "caching_enabled") != 0 {
+		b.report(source, "asset caching is not translated")
+	}
+	if npmInt(row, "block_exploits") != 0 {
+		b.report(source, "blocking common exploits is not translated")
+	}
+	if strings.TrimSpace(npmString(row, "advanced_config")) != "" {
+		b.report(source, "the custom Nginx configuration is not translated")
+	}
+
+	if id := npmInt(row, "access_list_id"); id != 0 {
+		list, ok := accessLists[id]
+		if !ok {
+			b.report(source, "access list %d not found", id)
+		} else {
+			npmAccessListRules(b, source, list, entry)
+		}
+	}
+	if len(rules) > 0 {
+		appendRules(entry, pathRules(rules, true)...)
+	}
+
+	for _, domain := range domains {
+		b.add(source, domain, maps.Clone(entry))
+	}
+}
+
+// npmAccessListRules adds the client and basic auth checks of an access list to a route.
+func npmAccessListRules(b *builder, source string, list *npmAccessList, entry types.LabelMap) {
+	if list.invalid {
+		b.report(source, "access list %s is not applied", list.name)
+		return
+	}
+
+	// clients are followed by "deny all"
+	var allow []string
+	for _, a := range list.allow {
+		if a != "all" {
+			allow = append(allow, a)
+		}
+	}
+	if len(allow) > 0 {
+		addMiddleware(entry, "cidr_whitelist", map[string]any{"allow": allow})
+	}
+	var deny []string
+	for _, d := range list.deny {
+		if d != "all" {
+			deny = append(deny, d)
+		}
+	}
+	if len(deny) > 0 {
+		lines := make([]string, len(deny))
+		for i, d := range deny {
+			lines[i] = "remote " + d
+		}
+		appendRules(entry, ruleEntry("deny", strings.Join(lines, " | "), "error 403 Forbidden"))
+	}
+
+	if len(list.users) > 0 {
+		if list.anyOf && len(allow) > 0 {
+			b.report(source, "access list %s: satisfy any is translated as satisfy all", list.name)
+		}
+		appendRules(entry, basicAuthRule("Authorization required", list.users, ""))
+	}
+}
+
+func npmStream(b *builder, row sqliteRow) {
+	source := fmt.Sprintf("stream %d", npmInt(row, "id"))
+	if !npmEnabled(row) {
+		b.report(source, "disabled, not translated")
+		return
+	}
+	listen := npmString(row, "incoming_port")
+	host := cmp.Or(npmString(row, "forwarding_host"), npmString(row, "forward_ip"))
+	port := npmString(row, "forwarding_port")
+	var protos []string
+	if npmInt(row, "tcp_forwarding") != 0 {
+		protos = append(protos, "tcp")
+	}
+	if npmInt(row, "udp_forwarding") != 0 {
+		protos = append(protos, "udp")
+	}
+	for _, proto := range protos {
+		up, err := parseUpstream(host+":"+port, proto)
+		if err != nil {
+			b.report(source, "%s", err)
+			return
+		}
+		entry := up.entry()
+		entry["port"] = listen + ":" + up.port
+		alias := "stream-" + listen
+		if len(protos) > 1 {
+			alias += "-" + proto
+		}
+		b.add(source, alias, entry)
+	}
+}
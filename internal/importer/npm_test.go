@@ -0,0 +1,132 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	expect "github.com/yusing/goutils/testing"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func readNPMTestDB(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile("test_data/npm.sqlite")
+	expect.NoError(t, err)
+	return data
+}
+
+func TestSQLite(t *testing.T) {
+	db, err := openSQLite(readNPMTestDB(t))
+	expect.NoError(t, err)
+	expect.False(t, db.walMode)
+
+	// spans interior pages
+	streams, err := db.Rows("stream")
+	expect.NoError(t, err)
+	expect.Equal(t, len(streams), 100)
+	for i, row := range streams {
+		expect.Equal(t, row["id"], any(int64(i+1)))
+		expect.Equal(t, row["incoming_port"], any(int64(20001+i)))
+	}
+
+	hosts, err := db.Rows("proxy_host")
+	expect.NoError(t, err)
+	expect.Equal(t, len(hosts), 5)
+	// written before the columns were added
+	expect.Equal(t, hosts[0]["forward_host"], any("10.0.0.1"))
+	expect.Equal(t, hosts[0]["hsts_enabled"], any(nil))
+	// overflow pages
+	expect.Equal(t, len(npmString(hosts[2], "advanced_config")), 3000+len("location /x {\n\n}"))
+
+	_, err = db.Rows("certificate")
+	expect.ErrorIs(t, ErrTableNotFound, err)
+
+	_, err = openSQLite([]byte("not a database"))
+	expect.ErrorIs(t, ErrNotSQLite, err)
+}
+
+func TestParseCreateTable(t *testing.T) {
+	columns, rowidCol := parseCreateTable("CREATE TABLE \"t\" (\"id\" INTEGER PRIMARY KEY, [name] text, `price` decimal(10, 2), CONSTRAINT pk UNIQUE (name))")
+	expect.Equal(t, columns, []string{"id", "name", "price"})
+	expect.Equal(t, rowidCol, 0)
+
+	columns, rowidCol = parseCreateTable("CREATE TABLE t(a, b integer)")
+	expect.Equal(t, columns, []string{"a", "b"})
+	expect.Equal(t, rowidCol, -1)
+}
+
+func TestImportNPMWAL(t *testing.T) {
+	data := readNPMTestDB(t)
+	data[18], data[19] = 2, 2 // WAL mode
+	path := filepath.Join(t.TempDir(), "database.sqlite")
+	expect.NoError(t, os.WriteFile(path, data, 0o644))
+
+	// the WAL file cannot be checked
+	_, err := Import(FormatNPM, data)
+	expect.ErrorIs(t, ErrSQLiteWAL, err)
+
+	_, err = ImportFile(FormatNPM, path)
+	expect.NoError(t, err)
+	expect.NoError(t, os.WriteFile(path+"-wal", nil, 0o644))
+	_, err = ImportFile(FormatNPM, path)
+	expect.NoError(t, err)
+
+	expect.NoError(t, os.WriteFile(path+"-wal", []byte("changes"), 0o644))
+	_, err = ImportFile(FormatNPM, path)
+	expect.ErrorIs(t, ErrSQLiteWAL, err)
+}
+
+func TestImportNPM(t *testing.T) {
+	result, err := Import(FormatNPM, readNPMTestDB(t))
+	expect.NoError(t, err)
+
+	old := result.Routes["old.example.com"]
+	expect.Equal(t, old["host"], any("10.0.0.1"))
+	expect.Equal(t, old["port"], any("8000"))
+
+	app := result.Routes["app.example.com"]
+	expect.Equal(t, app["scheme"], any("http"))
+	expect.Equal(t, app["host"], any("app"))
+	expect.Equal(t, app["port"], any("3000"))
+	mws := app["middlewares"].(map[string]any)
+	expect.Equal(t, mws["redirect_http"], any(map[string]any{}))
+	expect.Equal(t, mws["cidr_whitelist"], any(map[string]any{"allow": []string{"192.168.1.0/24"}}))
+	expect.Equal(t, mws["response"], any(map[string]any{
+		"set_headers": map[string]string{"Strict-Transport-Security": "max-age=63072000; includeSubDomains"},
+	}))
+
+	rules := app["rules"].([]any)
+	expect.Equal(t, len(rules), 3)
+	expect.Equal(t, rules[0], any(ruleEntry("deny", "remote 10.1.2.3", "error 403 Forbidden")))
+	auth := rules[1].(map[string]any)
+	user, hash, _ := strings.Cut(strings.TrimPrefix(auth["on"].(string), "!basic_auth "), " ")
+	expect.Equal(t, user, "alice")
+	expect.NoError(t, bcrypt.CompareHashAndPassword([]byte(hash), []byte("secret")))
+	expect.Equal(t, rules[2], any(ruleEntry("location /api", `path glob("/api*")`, "proxy https://api:8443/v1")))
+
+	expect.Equal(t, result.Routes["www.example.com"]["host"], any("app"))
+	expect.Equal(t, result.Routes["nginx.example.com"]["host"], any("nginx"))
+	expect.Equal(t, result.Routes["disabled.example.com"], nil)
+	expect.Equal(t, result.Routes["deleted.example.com"], nil)
+
+	expect.Equal(t, result.Routes["stream-20001-tcp"]["port"], any("20001:30001"))
+	expect.Equal(t, result.Routes["stream-20001-udp"]["scheme"], any("udp"))
+	expect.Equal(t, result.Routes["stream-20100"]["scheme"], any("tcp"))
+	expect.Equal(t, result.Routes["stream-20100"]["host"], any("game"))
+
+	reported := func(source, msg string) bool {
+		for _, issue := range result.Report {
+			if strings.HasPrefix(issue.Source, source) && strings.Contains(issue.Message, msg) {
+				return true
+			}
+		}
+		return false
+	}
+	expect.True(t, reported("proxy_host 3", "custom Nginx configuration"))
+	expect.True(t, reported("proxy_host 4", "disabled"))
+	expect.True(t, reported("redirection_host 1", "example.org"))
+	expect.True(t, reported("dead_host 1", "dead.example.com"))
+	expect.False(t, reported("proxy_host 5", ""))
+}
@@ -0,0 +1,392 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strconv"
+	"strings"
+
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// sqliteDB is a read-only reader of SQLite 3 database files, see https://www.sqlite.org/fileformat.html.
+//
+// It only scans tables, indexes and the WAL file are not read, databases with a non-empty WAL file are refused by the callers.
+type sqliteDB struct {
+	data       []byte
+	pageSize   int
+	usableSize int
+	walMode    bool
+	tables     map[string]sqliteTable
+}
+
+type sqliteTable struct {
+	rootPage int
+	columns  []string
+	rowidCol int // index of the INTEGER PRIMARY KEY column, -1 if none
+}
+
+// sqliteRow is a row of a table by column name.
+//
+// Values are int64, float64, string, []byte or nil.
+type sqliteRow map[string]any
+
+const (
+	sqliteHeaderSize = 100
+	sqliteMagic      = "SQLite format 3\x00"
+
+	sqlitePageTableInterior = 0x05
+	sqlitePageTableLeaf     = 0x0d
+)
+
+var (
+	ErrNotSQLite     = gperr.New("not a SQLite 3 database")
+	ErrInvalidSQLite = gperr.New("invalid SQLite database")
+	ErrTableNotFound = gperr.New("table not found")
+)
+
+func openSQLite(data []byte) (*sqliteDB, error) {
+	if len(data) < sqliteHeaderSize || string(data[:16]) != sqliteMagic {
+		return nil, ErrNotSQLite
+	}
+	pageSize := int(binary.BigEndian.Uint16(data[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, ErrInvalidSQLite.Subjectf("page size %d", pageSize)
+	}
+	if enc := binary.BigEndian.Uint32(data[56:60]); enc != 0 && enc != 1 {
+		return nil, ErrInvalidSQLite.Subject("only UTF-8 databases are supported")
+	}
+	db := &sqliteDB{
+		data:       data,
+		pageSize:   pageSize,
+		usableSize: pageSize - int(data[20]),
+		walMode:    data[18] == 2 || data[19] == 2,
+		tables:     make(map[string]sqliteTable),
+	}
+	if db.usableSize < 480 {
+		return nil, ErrInvalidSQLite.Subject("bad reserved space")
+	}
+
+	// the schema table is rooted at page 1
+	schema := sqliteTable{rootPage: 1, columns: []string{"type", "name", "tbl_name", "rootpage", "sql"}, rowidCol: -1}
+	err := db.scan(schema, func(row sqliteRow) error {
+		if row["type"] != "table" {
+			return nil
+		}
+		name, _ := row["name"].(string)
+		rootPage, _ := row["rootpage"].(int64)
+		sql, _ := row["sql"].(string)
+		if name == "" || rootPage < 1 {
+			return nil
+		}
+		columns, rowidCol := parseCreateTable(sql)
+		db.tables[name] = sqliteTable{rootPage: int(rootPage), columns: columns, rowidCol: rowidCol}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Rows returns all rows of a table.
+func (db *sqliteDB) Rows(table string) ([]sqliteRow, error) {
+	t, ok := db.tables[table]
+	if !ok {
+		return nil, ErrTableNotFound.Subject(table)
+	}
+	var rows []sqliteRow
+	err := db.scan(t, func(row sqliteRow) error {
+		rows = append(rows, row)
+		return nil
+	})
+	return rows, err
+}
+
+func (db *sqliteDB) page(n int) ([]byte, error) {
+	start := (n - 1) * db.pageSize
+	if n < 1 || start+db.pageSize > len(db.data) {
+		return nil, ErrInvalidSQLite.Subjectf("page %d out of range", n)
+	}
+	return db.data[start : start+db.pageSize], nil
+}
+
+// scan walks the table b-tree in rowid order.
+func (db *sqliteDB) scan(t sqliteTable, fn func(sqliteRow) error) error {
+	visited := make(map[int]bool)
+	var walk func(pageNo int) error
+	walk = func(pageNo int) error {
+		if visited[pageNo] {
+			return ErrInvalidSQLite.Subjectf("b-tree loop at page %d", pageNo)
+		}
+		visited[pageNo] = true
+
+		page, err := db.page(pageNo)
+		if err != nil {
+			return err
+		}
+		hdr := 0
+		if pageNo == 1 {
+			hdr = sqliteHeaderSize
+		}
+		if hdr+8 > len(page) {
+			return ErrInvalidSQLite.Subjectf("page %d", pageNo)
+		}
+		pageType := page[hdr]
+		numCells := int(binary.BigEndian.Uint16(page[hdr+3:]))
+		cellPtrs := hdr + 8
+		if pageType == sqlitePageTableInterior {
+			cellPtrs = hdr + 12
+		}
+		if cellPtrs+numCells*2 > len(page) {
+			return ErrInvalidSQLite.Subjectf("page %d", pageNo)
+		}
+
+		for i := range numCells {
+			off := int(binary.BigEndian.Uint16(page[cellPtrs+i*2:]))
+			if off >= len(page) {
+				return ErrInvalidSQLite.Subjectf("page %d cell %d", pageNo, i)
+			}
+			switch pageType {
+			case sqlitePageTableInterior:
+				if off+4 > len(page) {
+					return ErrInvalidSQLite.Subjectf("page %d cell %d", pageNo, i)
+				}
+				if err := walk(int(binary.BigEndian.Uint32(page[off:]))); err != nil {
+					return err
+				}
+			case sqlitePageTableLeaf:
+				row, err := db.leafCell(t, page, off)
+				if err != nil {
+					return gperr.PrependSubject("page "+strconv.Itoa(pageNo), err)
+				}
+				if err := fn(row); err != nil {
+					return err
+				}
+			default:
+				return ErrInvalidSQLite.Subjectf("page %d: unexpected page type %#x", pageNo, pageType)
+			}
+		}
+		if pageType == sqlitePageTableInterior {
+			return walk(int(binary.BigEndian.Uint32(page[hdr+8:])))
+		}
+		return nil
+	}
+	return walk(t.rootPage)
+}
+
+func (db *sqliteDB) leafCell(t sqliteTable, page []byte, off int) (sqliteRow, error) {
+	payloadSize, n := readVarint(page[off:])
+	if n == 0 {
+		return nil, ErrInvalidSQLite.Subject("bad cell")
+	}
+	off += n
+	rowid, n := readVarint(page[off:])
+	if n == 0 {
+		return nil, ErrInvalidSQLite.Subject("bad cell")
+	}
+	off += n
+
+	payload, err := db.payload(page, off, int(payloadSize))
+	if err != nil {
+		return nil, err
+	}
+	values, err := decodeRecord(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	row := make(sqliteRow, len(t.columns))
+	for i, col := range t.columns {
+		switch {
+		case i == t.rowidCol:
+			row[col] = int64(rowid)
+		case i < len(values):
+			row[col] = values[i]
+		default: // added by ALTER TABLE after the row was written
+			row[col] = nil
+		}
+	}
+	return row, nil
+}
+
+// payload returns the payload of a table leaf cell, following overflow pages.
+func (db *sqliteDB) payload(page []byte, off, size int) ([]byte, error) {
+	u := db.usableSize
+	maxLocal := u - 35
+	local := size
+	if size > maxLocal {
+		minLocal := (u-12)*32/255 - 23
+		local = minLocal + (size-minLocal)%(u-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+	if off+local > len(page) {
+		return nil, ErrInvalidSQLite.Subject("bad payload")
+	}
+	if local == size {
+		return page[off : off+size], nil
+	}
+
+	if off+local+4 > len(page) {
+		return nil, ErrInvalidSQLite.Subject("bad payload")
+	}
+	payload := make([]byte, 0, size)
+	payload = append(payload, page[off:off+local]...)
+	next := int(binary.BigEndian.Uint32(page[off+local:]))
+	for len(payload) < size {
+		if next == 0 {
+			return nil, ErrInvalidSQLite.Subject("truncated overflow chain")
+		}
+		ovf, err := db.page(next)
+		if err != nil {
+			return nil, err
+		}
+		next = int(binary.BigEndian.Uint32(ovf))
+		n := min(size-len(payload), u-4)
+		payload = append(payload, ovf[4:4+n]...)
+	}
+	return payload, nil
+}
+
+// readVarint reads a SQLite varint, n is 0 if b is too short.
+func readVarint(b []byte) (v uint64, n int) {
+	for i := range min(len(b), 9) {
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+func decodeRecord(payload []byte) ([]any, error) {
+	hdrSize, n := readVarint(payload)
+	if n == 0 || hdrSize > uint64(len(payload)) {
+		return nil, ErrInvalidSQLite.Subject("bad record header")
+	}
+	var types []uint64
+	for pos := n; pos < int(hdrSize); {
+		t, n := readVarint(payload[pos:hdrSize])
+		if n == 0 {
+			return nil, ErrInvalidSQLite.Subject("bad record header")
+		}
+		types = append(types, t)
+		pos += n
+	}
+
+	values := make([]any, len(types))
+	body := payload[hdrSize:]
+	for i, t := range types {
+		var size int
+		switch {
+		case t == 0, t == 8, t == 9:
+			size = 0
+		case t <= 4:
+			size = int(t)
+		case t == 5:
+			size = 6
+		case t == 6, t == 7:
+			size = 8
+		case t >= 12:
+			size = int(t-12) / 2
+		default:
+			return nil, ErrInvalidSQLite.Subjectf("bad serial type %d", t)
+		}
+		if size > len(body) {
+			return nil, ErrInvalidSQLite.Subject("bad record")
+		}
+		v := body[:size]
+		body = body[size:]
+
+		switch {
+		case t == 0:
+			values[i] = nil
+		case t == 8:
+			values[i] = int64(0)
+		case t == 9:
+			values[i] = int64(1)
+		case t <= 6:
+			// big-endian two's complement
+			var x int64
+			if v[0]&0x80 != 0 {
+				x = -1
+			}
+			for _, c := range v {
+				x = x<<8 | int64(c)
+			}
+			values[i] = x
+		case t == 7:
+			values[i] = math.Float64frombits(binary.BigEndian.Uint64(v))
+		case t%2 == 0:
+			values[i] = bytes.Clone(v)
+		default:
+			values[i] = string(v)
+		}
+	}
+	return values, nil
+}
+
+// parseCreateTable returns the column names of a CREATE TABLE statement,
+// and the index of the INTEGER PRIMARY KEY column which is an alias of the rowid, or -1.
+func parseCreateTable(sql string) (columns []string, rowidCol int) {
+	rowidCol = -1
+	start := strings.IndexByte(sql, '(')
+	end := strings.LastIndexByte(sql, ')')
+	if start < 0 || end < start {
+		return nil, -1
+	}
+
+	// split the definitions at top level commas
+	var defs []string
+	depth, last := 0, start+1
+	var quote byte
+	for i := start + 1; i < end; i++ {
+		c := sql[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '[':
+			quote = ']'
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			defs = append(defs, sql[last:i])
+			last = i + 1
+		}
+	}
+	defs = append(defs, sql[last:end])
+
+	for _, def := range defs {
+		def = strings.TrimSpace(def)
+		fields := strings.Fields(def)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "CONSTRAINT", "PRIMARY", "UNIQUE", "CHECK", "FOREIGN":
+			continue
+		}
+		name := strings.Trim(fields[0], "`\"[]'")
+		upper := strings.ToUpper(def)
+		if len(fields) > 1 && strings.ToUpper(fields[1]) == "INTEGER" && strings.Contains(upper, "PRIMARY KEY") {
+			rowidCol = len(columns)
+		}
+		columns = append(columns, name)
+	}
+	return columns, rowidCol
+}
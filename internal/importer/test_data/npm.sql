@@ -0,0 +1,52 @@
+-- Nginx Proxy Manager database for tests, generate npm.sqlite with:
+--   sqlite3 npm.sqlite < npm.sql
+-- Small pages exercise overflow pages and interior b-tree pages.
+PRAGMA page_size = 1024;
+
+CREATE TABLE `access_list` (`id` integer not null primary key autoincrement, `created_on` datetime not null, `modified_on` datetime not null, `owner_user_id` integer not null, `is_deleted` integer not null default '0', `name` varchar(255) not null, `meta` json not null, `satisfy_any` integer not null default '0', `pass_auth` integer not null default '1');
+CREATE TABLE `access_list_auth` (`id` integer not null primary key autoincrement, `created_on` datetime not null, `modified_on` datetime not null, `access_list_id` integer not null, `username` varchar(255) not null, `password` varchar(255) not null, `meta` json not null);
+CREATE TABLE `access_list_client` (`id` integer not null primary key autoincrement, `created_on` datetime not null, `modified_on` datetime not null, `access_list_id` integer not null, `address` varchar(255) not null, `directive` varchar(255) not null, `meta` json not null);
+
+-- the columns of version 1.0, later columns are added by migrations
+CREATE TABLE `proxy_host` (`id` integer not null primary key autoincrement, `created_on` datetime not null, `modified_on` datetime not null, `owner_user_id` integer not null, `is_deleted` integer not null default '0', `domain_names` json not null, `forward_ip` varchar(255) not null, `forward_port` integer not null, `access_list_id` integer not null default '0', `certificate_id` integer not null default '0', `ssl_forced` integer not null default '0', `caching_enabled` integer not null default '0', `block_exploits` integer not null default '0', `advanced_config` text not null default '', `meta` json not null);
+INSERT INTO proxy_host (created_on, modified_on, owner_user_id, domain_names, forward_ip, forward_port, meta)
+VALUES ('2019-01-01', '2019-01-01', 1, '["old.example.com"]', '10.0.0.1', 8000, '{}');
+ALTER TABLE `proxy_host` RENAME COLUMN `forward_ip` TO `forward_host`;
+ALTER TABLE `proxy_host` ADD COLUMN `allow_websocket_upgrade` integer not null default '0';
+ALTER TABLE `proxy_host` ADD COLUMN `http2_support` integer not null default '0';
+ALTER TABLE `proxy_host` ADD COLUMN `forward_scheme` varchar(255) not null default 'http';
+ALTER TABLE `proxy_host` ADD COLUMN `enabled` integer not null default '1';
+ALTER TABLE `proxy_host` ADD COLUMN `locations` json;
+ALTER TABLE `proxy_host` ADD COLUMN `hsts_enabled` integer not null default '0';
+ALTER TABLE `proxy_host` ADD COLUMN `hsts_subdomains` integer not null default '0';
+
+CREATE TABLE `redirection_host` (`id` integer not null primary key autoincrement, `created_on` datetime not null, `modified_on` datetime not null, `owner_user_id` integer not null, `is_deleted` integer not null default '0', `domain_names` json not null, `forward_domain_name` varchar(255) not null, `preserve_path` integer not null default '0', `certificate_id` integer not null default '0', `ssl_forced` integer not null default '0', `block_exploits` integer not null default '0', `advanced_config` text not null default '', `meta` json not null, `forward_http_code` integer not null default '302', `forward_scheme` varchar(255) not null default '$scheme', `enabled` integer not null default '1');
+CREATE TABLE `dead_host` (`id` integer not null primary key autoincrement, `created_on` datetime not null, `modified_on` datetime not null, `owner_user_id` integer not null, `is_deleted` integer not null default '0', `domain_names` json not null, `certificate_id` integer not null default '0', `ssl_forced` integer not null default '0', `advanced_config` text not null default '', `meta` json not null, `enabled` integer not null default '1');
+CREATE TABLE `stream` (`id` integer not null primary key autoincrement, `created_on` datetime not null, `modified_on` datetime not null, `owner_user_id` integer not null, `is_deleted` integer not null default '0', `incoming_port` integer not null, `forwarding_host` varchar(255) not null, `forwarding_port` integer not null, `tcp_forwarding` integer not null default '0', `udp_forwarding` integer not null default '0', `meta` json not null, `enabled` integer not null default '1');
+
+INSERT INTO access_list (id, created_on, modified_on, owner_user_id, name, meta) VALUES (1, '2024-01-01', '2024-01-01', 1, 'office', '{}');
+INSERT INTO access_list_client (created_on, modified_on, access_list_id, address, directive, meta) VALUES
+  ('2024-01-01', '2024-01-01', 1, '192.168.1.0/24', 'allow', '{}'),
+  ('2024-01-01', '2024-01-01', 1, '10.1.2.3', 'deny', '{}'),
+  ('2024-01-01', '2024-01-01', 1, 'all', 'deny', '{}');
+INSERT INTO access_list_auth (created_on, modified_on, access_list_id, username, password, meta) VALUES
+  ('2024-01-01', '2024-01-01', 1, 'alice', 'secret', '{}');
+
+INSERT INTO proxy_host (created_on, modified_on, owner_user_id, domain_names, forward_host, forward_port, forward_scheme, ssl_forced, hsts_enabled, hsts_subdomains, access_list_id, meta, locations) VALUES
+  ('2024-01-01', '2024-01-01', 1, '["App.example.com","www.example.com"]', 'app', 3000, 'http', 1, 1, 1, 1, '{}',
+   '[{"path":"/api","forward_scheme":"https","forward_host":"api/v1","forward_port":8443,"advanced_config":""}]');
+INSERT INTO proxy_host (created_on, modified_on, owner_user_id, domain_names, forward_host, forward_port, forward_scheme, advanced_config, meta) VALUES
+  ('2024-01-01', '2024-01-01', 1, '["nginx.example.com"]', 'nginx', 80, 'http', 'location /x {' || char(10) || replace(hex(zeroblob(1500)), '00', 'ab') || char(10) || '}', '{}');
+INSERT INTO proxy_host (created_on, modified_on, owner_user_id, domain_names, forward_host, forward_port, enabled, meta) VALUES
+  ('2024-01-01', '2024-01-01', 1, '["disabled.example.com"]', 'off', 80, 0, '{}');
+INSERT INTO proxy_host (created_on, modified_on, owner_user_id, is_deleted, domain_names, forward_host, forward_port, meta) VALUES
+  ('2024-01-01', '2024-01-01', 1, 1, '["deleted.example.com"]', 'gone', 80, '{}');
+
+INSERT INTO redirection_host (created_on, modified_on, owner_user_id, domain_names, forward_domain_name, meta) VALUES
+  ('2024-01-01', '2024-01-01', 1, '["old.example.org"]', 'example.org', '{}');
+INSERT INTO dead_host (created_on, modified_on, owner_user_id, domain_names, meta) VALUES
+  ('2024-01-01', '2024-01-01', 1, '["dead.example.com"]', '{}');
+
+WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 100)
+INSERT INTO stream (created_on, modified_on, owner_user_id, incoming_port, forwarding_host, forwarding_port, tcp_forwarding, udp_forwarding, meta)
+SELECT '2024-01-01', '2024-01-01', 1, 20000 + i, 'game', 30000 + i, 1, CASE WHEN i = 1 THEN 1 ELSE 0 END, '{}' FROM n;
@@ -0,0 +1,467 @@
+package importer
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/yusing/godoxy/internal/types"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// traefikImport translates a Traefik dynamic configuration, see https://doc.traefik.io/traefik/routing/overview/.
+type traefikImport struct {
+	b           *builder
+	middlewares map[string]any // name -> type -> options
+	services    map[string]any
+}
+
+// traefikMatch is a conjunction of a router rule for a host.
+type traefikMatch struct {
+	router   string
+	on       []string
+	priority int
+	up       upstream
+	mws      []string
+}
+
+const traefikMaxChainDepth = 10
+
+func importTraefikFile(b *builder, data []byte) error {
+	var cfg map[string]any
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+	importTraefik(b, cfg)
+	return nil
+}
+
+func importTraefik(b *builder, cfg map[string]any) {
+	t := &traefikImport{
+		b:           b,
+		middlewares: getMap(cfg, "http", "middlewares"),
+		services:    getMap(cfg, "http", "services"),
+	}
+
+	hostMatches := make(map[string][]traefikMatch)
+	routers := getMap(cfg, "http", "routers")
+	for _, name := range slices.Sorted(maps.Keys(routers)) {
+		router, _ := routers[name].(map[string]any)
+		if router == nil {
+			continue
+		}
+		t.router(name, router, hostMatches)
+	}
+	for _, host := range slices.Sorted(maps.Keys(hostMatches)) {
+		t.host(host, hostMatches[host])
+	}
+
+	for _, proto := range []string{"tcp", "udp"} {
+		routers := getMap(cfg, proto, "routers")
+		services := getMap(cfg, proto, "services")
+		for _, name := range slices.Sorted(maps.Keys(routers)) {
+			router, _ := routers[name].(map[string]any)
+			if router == nil {
+				continue
+			}
+			t.streamRouter(proto, name, router, services)
+		}
+	}
+
+	for _, key := range []string{"tls", "serversTransports"} {
+		if get(getMap(cfg, "http"), key) != nil || get(cfg, key) != nil {
+			b.report(key, "not translated, certificates are managed by autocert")
+		}
+	}
+}
+
+func (t *traefikImport) router(name string, router map[string]any, hostMatches map[string][]traefikMatch) {
+	source := "router " + name
+	rule := getString(router, "rule")
+	expr, err := parseTraefikRule(rule)
+	if err != nil {
+		t.b.report(source, "%s: %s", rule, err)
+		return
+	}
+	terms, err := expr.dnf(false)
+	if err != nil {
+		t.b.report(source, "%s: %s", rule, err)
+		return
+	}
+
+	service := traefikName(getString(router, "service"))
+	up, err := t.httpService(service)
+	if err != nil {
+		t.b.report(source, "service %s: %s", service, err)
+		return
+	}
+
+	priority := getInt(router, "priority")
+	if priority == 0 {
+		priority = len(rule) // default of Traefik
+	}
+	for _, lits := range terms {
+		term, err := translateTraefikTerm(lits)
+		if err != nil {
+			t.b.report(source, "%s: %s", rule, err)
+			return
+		}
+		if len(term.hosts) == 0 {
+			t.b.report(source, "%s: rules without Host are not supported", rule)
+			return
+		}
+		for _, host := range term.hosts {
+			hostMatches[host] = append(hostMatches[host], traefikMatch{
+				router:   name,
+				on:       term.on,
+				priority: priority,
+				up:       up,
+				mws:      getStrings(router, "middlewares"),
+			})
+		}
+	}
+}
+
+// host translates the matches of a host to a route, the catch-all match is the route upstream,
+// and the other matches are proxy rules in priority order.
+func (t *traefikImport) host(host string, matches []traefikMatch) {
+	slices.SortStableFunc(matches, func(a, b traefikMatch) int {
+		return b.priority - a.priority
+	})
+
+	var catchAll *traefikMatch
+	redirects := false
+	var rules []pathRule
+	var preRules []any
+	for i, m := range matches {
+		if len(m.on) > 0 {
+			source := "router " + m.router
+			on := strings.Join(m.on, "\n")
+			mwRules, cmds := t.middlewaresFor(source, m.mws, nil, on, 0)
+			preRules = append(preRules, mwRules...)
+			rules = append(rules, pathRule{
+				name:     source,
+				on:       on,
+				do:       append(cmds, "proxy "+m.up.url()),
+				priority: m.priority,
+			})
+			continue
+		}
+		switch {
+		case catchAll == nil:
+			catchAll = &matches[i]
+		case t.onlyRedirects(m.mws):
+			// the plain HTTP router of a host redirecting to HTTPS
+			redirects = true
+		case t.onlyRedirects(catchAll.mws):
+			redirects = true
+			catchAll = &matches[i]
+		default:
+			t.b.report("router "+m.router, "host %s is already routed by router %s", host, catchAll.router)
+		}
+	}
+	target := matches[0].up
+	if catchAll != nil {
+		target = catchAll.up
+	}
+	entry := target.entry()
+	if len(rules) > 0 || len(preRules) > 0 {
+		appendRules(entry, preRules...)
+		appendRules(entry, pathRules(rules, catchAll != nil)...)
+	}
+	if catchAll != nil {
+		source := "router " + catchAll.router
+		if len(rules) > 0 && len(catchAll.mws) > 0 {
+			t.b.report(source, "middlewares of the router also apply to the other routers of %s", host)
+		}
+		mwRules, _ := t.middlewaresFor(source, catchAll.mws, entry, "", 0)
+		appendRules(entry, mwRules...)
+	}
+	if redirects {
+		addMiddleware(entry, "redirect_http", map[string]any{})
+	}
+
+	source := "router " + matches[0].router
+	if catchAll != nil {
+		source = "router " + catchAll.router
+	}
+	t.b.add(source, host, entry)
+}
+
+// onlyRedirects reports whether the middlewares only redirect to HTTPS.
+func (t *traefikImport) onlyRedirects(names []string) bool {
+	if len(names) == 0 {
+		return false
+	}
+	for _, name := range names {
+		mw := getMap(t.middlewares, traefikName(name))
+		if len(mw) != 1 || getMap(mw, "redirectScheme") == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// middlewaresFor translates middlewares of a router.
+//
+// With a nil entry, they are translated to rules applying to requests matching on,
+// and commands running before the proxy command of the router.
+// Otherwise they are added to the middlewares of entry, and the returned rules apply to the whole route.
+func (t *traefikImport) middlewaresFor(source string, names []string, entry types.LabelMap, on string, depth int) (rules []any, cmds []string) {
+	scoped := entry == nil
+	for _, ref := range names {
+		name := traefikName(ref)
+		mwSource := "middleware " + name
+		mw := getMap(t.middlewares, name)
+		if mw == nil {
+			t.b.report(source, "middleware %s not found", ref)
+			continue
+		}
+		for _, typ := range slices.Sorted(maps.Keys(mw)) {
+			opts, _ := mw[typ].(map[string]any)
+			if opts == nil {
+				opts = make(map[string]any)
+			}
+			switch strings.ToLower(typ) {
+			case "chain":
+				if depth >= traefikMaxChainDepth {
+					t.b.report(mwSource, "chain is too deep")
+					continue
+				}
+				r, c := t.middlewaresFor(source, getStrings(opts, "middlewares"), entry, on, depth+1)
+				rules = append(rules, r...)
+				cmds = append(cmds, c...)
+			case "basicauth":
+				if getString(opts, "usersFile") != "" {
+					t.b.report(mwSource, "usersFile is not supported, add its users to the basic_auth rule")
+				}
+				var users []credential
+				for _, u := range getStrings(opts, "users") {
+					user, hash, _ := strings.Cut(u, ":")
+					if !isBcrypt(hash) {
+						t.b.report(mwSource, "user %s: only bcrypt hashes are supported", user)
+						continue
+					}
+					users = append(users, credential{user, hash})
+				}
+				if len(users) > 0 {
+					rules = append(rules, basicAuthRule(getString(opts, "realm"), users, on))
+				}
+			case "ipallowlist", "ipwhitelist":
+				if get(opts, "ipStrategy") != nil {
+					t.b.report(mwSource, "ipStrategy is not translated, use the real_ip middleware")
+				}
+				ranges := getStrings(opts, "sourceRange")
+				if len(ranges) == 0 {
+					continue
+				}
+				if scoped {
+					lines := []string{on}
+					for _, r := range ranges {
+						lines = append(lines, "!remote "+r)
+					}
+					rules = append(rules, ruleEntry("ip allow list", strings.Join(lines, "\n"), "error 403 Forbidden"))
+				} else {
+					addMiddleware(entry, "cidr_whitelist", map[string]any{"allow": ranges})
+				}
+			case "headers":
+				c := t.headers(source, mwSource, opts, entry)
+				cmds = append(cmds, c...)
+			case "redirectscheme":
+				if !strings.EqualFold(cmp.Or(getString(opts, "scheme"), "https"), "https") {
+					t.b.report(mwSource, "only redirects to https are supported")
+					continue
+				}
+				if scoped {
+					t.b.report(source, "redirectScheme is only translated for routers without path rules")
+					continue
+				}
+				addMiddleware(entry, "redirect_http", map[string]any{})
+			case "stripprefix":
+				for _, prefix := range getStrings(opts, "prefixes") {
+					if scoped {
+						cmds = append(cmds, "rewrite "+strings.TrimSuffix(prefix, "/")+"/ /")
+					} else {
+						rules = append(rules, stripPrefixRules(prefix)...)
+					}
+				}
+			case "addprefix":
+				prefix := strings.TrimSuffix(getString(opts, "prefix"), "/")
+				if prefix == "" {
+					continue
+				}
+				if scoped {
+					cmds = append(cmds, "rewrite / "+prefix+"/")
+				} else {
+					addMiddleware(entry, "request", map[string]any{"add_prefix": prefix})
+				}
+			case "ratelimit":
+				if scoped {
+					t.b.report(source, "rateLimit is only translated for routers without path rules")
+					continue
+				}
+				average := getInt(opts, "average")
+				if average <= 0 {
+					continue
+				}
+				addMiddleware(entry, "ratelimit", map[string]any{
+					"average": average,
+					"burst":   max(getInt(opts, "burst"), 1),
+					"period":  cmp.Or(getString(opts, "period"), "1s"),
+				})
+			case "forwardauth":
+				t.b.report(mwSource, "forwardAuth to %s: add a route of the auth server and a forwardauth middleware", getString(opts, "address"))
+			default:
+				t.b.report(mwSource, "middleware type %s is not supported", typ)
+			}
+		}
+	}
+	return rules, cmds
+}
+
+// headers translates a headers middleware, with a nil entry to commands.
+func (t *traefikImport) headers(source, mwSource string, opts map[string]any, entry types.LabelMap) (cmds []string) {
+	reqSet, reqHide := splitHeaders(getStringMap(opts, "customRequestHeaders"))
+	respSet, respHide := splitHeaders(getStringMap(opts, "customResponseHeaders"))
+
+	if n := getInt(opts, "stsSeconds"); n > 0 {
+		sts := "max-age=" + strconv.Itoa(n)
+		if getBool(opts, "stsIncludeSubdomains") {
+			sts += "; includeSubDomains"
+		}
+		if getBool(opts, "stsPreload") {
+			sts += "; preload"
+		}
+		respSet["Strict-Transport-Security"] = sts
+	}
+	if getBool(opts, "frameDeny") {
+		respSet["X-Frame-Options"] = "DENY"
+	}
+	if v := getString(opts, "customFrameOptionsValue"); v != "" {
+		respSet["X-Frame-Options"] = v
+	}
+	if getBool(opts, "contentTypeNosniff") {
+		respSet["X-Content-Type-Options"] = "nosniff"
+	}
+	if getBool(opts, "browserXssFilter") {
+		respSet["X-XSS-Protection"] = "1; mode=block"
+	}
+	for key, header := range map[string]string{
+		"contentSecurityPolicy": "Content-Security-Policy",
+		"referrerPolicy":        "Referrer-Policy",
+		"permissionsPolicy":     "Permissions-Policy",
+	} {
+		if v := getString(opts, key); v != "" {
+			respSet[header] = v
+		}
+	}
+
+	known := []string{
+		"customRequestHeaders", "customResponseHeaders", "stsSeconds", "stsIncludeSubdomains", "stsPreload",
+		"frameDeny", "customFrameOptionsValue", "contentTypeNosniff", "browserXssFilter",
+		"contentSecurityPolicy", "referrerPolicy", "permissionsPolicy",
+	}
+	for _, key := range slices.Sorted(maps.Keys(opts)) {
+		if !slices.ContainsFunc(known, func(k string) bool { return strings.EqualFold(k, key) }) {
+			t.b.report(mwSource, "headers option %s is not supported", key)
+		}
+	}
+
+	if entry != nil {
+		if len(reqSet) > 0 || len(reqHide) > 0 {
+			addMiddleware(entry, "request", headerModifier(reqSet, reqHide))
+		}
+		if len(respSet) > 0 || len(respHide) > 0 {
+			addMiddleware(entry, "response", headerModifier(respSet, respHide))
+		}
+		return nil
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(reqSet)) {
+		cmds = append(cmds, "set header "+quoteArg(k)+" "+quoteArg(reqSet[k]))
+	}
+	for _, k := range reqHide {
+		cmds = append(cmds, "remove header "+quoteArg(k))
+	}
+	if len(respSet) > 0 || len(respHide) > 0 {
+		t.b.report(source, "response headers are only translated for routers without path rules")
+	}
+	return cmds
+}
+
+// splitHeaders splits Traefik custom headers into headers to set, and headers to remove which have empty values.
+func splitHeaders(headers map[string]string) (set map[string]string, hide []string) {
+	set = make(map[string]string)
+	for k, v := range headers {
+		if v == "" {
+			hide = append(hide, k)
+		} else {
+			set[k] = v
+		}
+	}
+	slices.Sort(hide)
+	return set, hide
+}
+
+// httpService returns the first server of a load balancer service.
+func (t *traefikImport) httpService(name string) (upstream, error) {
+	svc := getMap(t.services, name)
+	if svc == nil {
+		return upstream{}, ErrServiceNotFound
+	}
+	lb := getMap(svc, "loadBalancer")
+	if lb == nil {
+		return upstream{}, ErrUnsupportedService
+	}
+	servers := getList(lb, "servers")
+	if len(servers) == 0 {
+		return upstream{}, ErrNoServers
+	}
+	if len(servers) > 1 {
+		t.b.report("service "+name, "only the first of %d servers is used, add a route per server with load_balance", len(servers))
+	}
+	server, _ := servers[0].(map[string]any)
+	return parseUpstream(getString(server, "url"), "http")
+}
+
+// streamRouter translates a TCP or UDP router, the listening port is defined by its entry point.
+func (t *traefikImport) streamRouter(proto, name string, router map[string]any, services map[string]any) {
+	source := proto + " router " + name
+	if proto == "tcp" {
+		if rule := getString(router, "rule"); rule != "" && !strings.EqualFold(strings.ReplaceAll(rule, " ", ""), "HostSNI(`*`)") {
+			t.b.report(source, "%s: only HostSNI(`*`) is supported", rule)
+			return
+		}
+	}
+	service := traefikName(getString(router, "service"))
+	servers := getList(getMap(services, service, "loadBalancer"), "servers")
+	if len(servers) == 0 {
+		t.b.report(source, "service %s: %s", service, ErrNoServers)
+		return
+	}
+	server, _ := servers[0].(map[string]any)
+	up, err := parseUpstream(getString(server, "address"), proto)
+	if err != nil {
+		t.b.report(source, "service %s: %s", service, err)
+		return
+	}
+	entry := up.entry()
+	entry["port"] = up.port + ":" + up.port
+	t.b.report(source, "listening port %s is assumed, set it to the port of entry points %s", up.port, strings.Join(getStrings(router, "entryPoints"), ", "))
+	t.b.add(source, name, entry)
+}
+
+// traefikName removes the provider suffix of a name, e.g. "auth@docker".
+func traefikName(name string) string {
+	name, _, _ = strings.Cut(name, "@")
+	return name
+}
+
+var (
+	ErrServiceNotFound    = gperr.New("service not found")
+	ErrUnsupportedService = gperr.New("only loadBalancer services are supported")
+	ErrNoServers          = gperr.New("no servers")
+)
@@ -0,0 +1,185 @@
+package importer
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// importTraefikLabels translates the Traefik labels of the services of a docker compose file,
+// with the defaults of the Traefik docker provider.
+//
+// Services are reached by their compose service names, i.e. GoDoxy must be on the same network.
+func importTraefikLabels(b *builder, data []byte) error {
+	var compose struct {
+		Services map[string]map[string]any `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &compose); err != nil {
+		return err
+	}
+
+	cfg := make(map[string]any)
+	for _, name := range slices.Sorted(maps.Keys(compose.Services)) {
+		svc := compose.Services[name]
+		labels := composeLabels(svc["labels"])
+		enabled, ok := labels["traefik.enable"]
+		if ok && !strings.EqualFold(enabled, "true") {
+			continue
+		}
+		if !ok && !slices.ContainsFunc(slices.Collect(maps.Keys(labels)), func(k string) bool {
+			return strings.HasPrefix(k, "traefik.")
+		}) {
+			continue
+		}
+		mergeMaps(cfg, traefikLabelConfig(b, name, svc, labels))
+	}
+	importTraefik(b, cfg)
+	return nil
+}
+
+// composeLabels returns the labels of a compose service, as a map or as a list of "key=value".
+func composeLabels(v any) map[string]string {
+	labels := make(map[string]string)
+	switch v := v.(type) {
+	case map[string]any:
+		for k, v := range v {
+			labels[k] = asString(v)
+		}
+	case []any:
+		for _, e := range v {
+			k, v, _ := strings.Cut(asString(e), "=")
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// traefikLabelConfig returns the dynamic configuration of the labels of a compose service.
+func traefikLabelConfig(b *builder, name string, svc map[string]any, labels map[string]string) map[string]any {
+	cfg := make(map[string]any)
+	for k, v := range labels {
+		k, ok := strings.CutPrefix(k, "traefik.")
+		if !ok {
+			continue
+		}
+		var path []string
+		for part := range strings.SplitSeq(k, ".") {
+			// e.g. "servers[0]"
+			if key, index, ok := strings.Cut(part, "["); ok {
+				path = append(path, key, strings.TrimSuffix(index, "]"))
+				continue
+			}
+			path = append(path, part)
+		}
+		setPath(cfg, path, v)
+	}
+
+	if getMap(cfg, "http") == nil && getMap(cfg, "tcp") == nil && getMap(cfg, "udp") == nil {
+		cfg["http"] = make(map[string]any)
+	}
+
+	host := name
+	if containerName := asString(svc["container_name"]); containerName != "" {
+		host = containerName
+	}
+	source := "service " + name
+	for _, proto := range []string{"http", "tcp", "udp"} {
+		section := getMap(cfg, proto)
+		if section == nil {
+			continue
+		}
+		services := getMap(section, "services")
+		routers := getMap(section, "routers")
+		// a container without a service has one named after it
+		if len(services) == 0 && (proto == "http" || len(routers) > 0) {
+			services = map[string]any{name: map[string]any{}}
+			section["services"] = services
+		}
+		for svcName, v := range services {
+			svcCfg, _ := v.(map[string]any)
+			if svcCfg == nil {
+				continue
+			}
+			lb := getMap(svcCfg, "loadBalancer")
+			if lb == nil {
+				lb = make(map[string]any)
+				svcCfg["loadbalancer"] = lb
+			}
+			if getList(lb, "servers") != nil {
+				continue
+			}
+			server := getMap(lb, "server")
+			port := getString(server, "port")
+			if port == "" {
+				port = composePort(svc)
+			}
+			if port == "" {
+				b.report(source, "%s service %s: no port label and no single exposed port", proto, svcName)
+				delete(services, svcName)
+				continue
+			}
+			if proto == "http" {
+				scheme := getString(server, "scheme")
+				if scheme == "" {
+					scheme = "http"
+				}
+				lb["servers"] = []any{map[string]any{"url": scheme + "://" + host + ":" + port}}
+			} else {
+				lb["servers"] = []any{map[string]any{"address": host + ":" + port}}
+			}
+		}
+		// routers without a service use the only service of the container
+		for routerName, v := range routers {
+			router, _ := v.(map[string]any)
+			if router == nil || getString(router, "service") != "" {
+				continue
+			}
+			if len(services) != 1 {
+				b.report(source, "%s router %s: the service must be set for containers with multiple services", proto, routerName)
+				delete(routers, routerName)
+				continue
+			}
+			for svcName := range services {
+				router["service"] = svcName
+			}
+		}
+	}
+
+	// the default router of the container, GoDoxy routes it by the alias as a subdomain
+	if http := getMap(cfg, "http"); len(getMap(http, "routers")) == 0 && len(getMap(http, "services")) == 1 {
+		for svcName := range getMap(http, "services") {
+			setPath(cfg, []string{"http", "routers", name, "rule"}, "Host(`"+name+"`)")
+			setPath(cfg, []string{"http", "routers", name, "service"}, svcName)
+		}
+		b.report(source, "no router, the default rule of Traefik is translated to the alias %s", name)
+	}
+	return cfg
+}
+
+// composePort returns the container port of a compose service with a single exposed or published port.
+func composePort(svc map[string]any) string {
+	var ports []string
+	for _, key := range []string{"expose", "ports"} {
+		list, _ := svc[key].([]any)
+		for _, p := range list {
+			var port string
+			if m, ok := p.(map[string]any); ok { // long syntax
+				port = asString(m["target"])
+			} else {
+				// [[ip:]published:]target[/protocol]
+				s, _, _ := strings.Cut(asString(p), "/")
+				port = s[strings.LastIndexByte(s, ':')+1:]
+			}
+			if _, err := strconv.Atoi(port); err == nil && !slices.Contains(ports, port) {
+				ports = append(ports, port)
+			}
+		}
+	}
+	if len(ports) == 1 {
+		return ports[0]
+	}
+	return ""
+}
@@ -0,0 +1,296 @@
+package importer
+
+import (
+	"strings"
+	"unicode"
+
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// traefikExpr is a parsed Traefik router rule, e.g. "Host(`a.com`) && (PathPrefix(`/api`) || Method(`POST`))".
+type traefikExpr struct {
+	op   string // "&&", "||", "!", or "" for a matcher
+	name string
+	args []string
+	x, y *traefikExpr
+}
+
+// traefikLiteral is a possibly negated matcher.
+type traefikLiteral struct {
+	neg  bool
+	name string
+	args []string
+}
+
+// maxTraefikTerms limits the number of conjunctions a rule expands to.
+const maxTraefikTerms = 64
+
+var ErrInvalidTraefikRule = gperr.New("invalid rule")
+
+type traefikRuleParser struct {
+	tokens []string
+	pos    int
+}
+
+func tokenizeTraefikRule(rule string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(rule); {
+		c := rule[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == ',' || c == '!':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '&' || c == '|':
+			if i+1 >= len(rule) || rule[i+1] != c {
+				return nil, ErrInvalidTraefikRule.Subjectf("unexpected %q", c)
+			}
+			tokens = append(tokens, rule[i:i+2])
+			i += 2
+		case c == '`' || c == '"':
+			end := strings.IndexByte(rule[i+1:], c)
+			if end < 0 {
+				return nil, ErrInvalidTraefikRule.Subject("unterminated string")
+			}
+			// strings keep the quote to tell them from identifiers
+			tokens = append(tokens, rule[i:i+end+2])
+			i += end + 2
+		case unicode.IsLetter(rune(c)):
+			start := i
+			for i < len(rule) && (unicode.IsLetter(rune(rule[i])) || unicode.IsDigit(rune(rule[i]))) {
+				i++
+			}
+			tokens = append(tokens, rule[start:i])
+		default:
+			return nil, ErrInvalidTraefikRule.Subjectf("unexpected %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+func parseTraefikRule(rule string) (*traefikExpr, error) {
+	tokens, err := tokenizeTraefikRule(rule)
+	if err != nil {
+		return nil, err
+	}
+	p := &traefikRuleParser{tokens: tokens}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, ErrInvalidTraefikRule.Subjectf("unexpected %s", p.tokens[p.pos])
+	}
+	return e, nil
+}
+
+func (p *traefikRuleParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *traefikRuleParser) expect(tok string) error {
+	if p.peek() != tok {
+		return ErrInvalidTraefikRule.Subjectf("expected %s", tok)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *traefikRuleParser) or() (*traefikExpr, error) {
+	x, err := p.and()
+	for err == nil && p.peek() == "||" {
+		p.pos++
+		var y *traefikExpr
+		if y, err = p.and(); err == nil {
+			x = &traefikExpr{op: "||", x: x, y: y}
+		}
+	}
+	return x, err
+}
+
+func (p *traefikRuleParser) and() (*traefikExpr, error) {
+	x, err := p.unary()
+	for err == nil && p.peek() == "&&" {
+		p.pos++
+		var y *traefikExpr
+		if y, err = p.unary(); err == nil {
+			x = &traefikExpr{op: "&&", x: x, y: y}
+		}
+	}
+	return x, err
+}
+
+func (p *traefikRuleParser) unary() (*traefikExpr, error) {
+	switch tok := p.peek(); {
+	case tok == "!":
+		p.pos++
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &traefikExpr{op: "!", x: x}, nil
+	case tok == "(":
+		p.pos++
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return x, p.expect(")")
+	case tok != "" && unicode.IsLetter(rune(tok[0])):
+		p.pos++
+		e := &traefikExpr{name: tok}
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		for p.peek() != ")" {
+			if len(e.args) > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			arg := p.peek()
+			if arg == "" || (arg[0] != '`' && arg[0] != '"') {
+				return nil, ErrInvalidTraefikRule.Subjectf("%s: expected a string", e.name)
+			}
+			e.args = append(e.args, arg[1:len(arg)-1])
+			p.pos++
+		}
+		p.pos++
+		return e, nil
+	case tok == "":
+		return nil, ErrInvalidTraefikRule.Subject("unexpected end")
+	default:
+		return nil, ErrInvalidTraefikRule.Subjectf("unexpected %s", tok)
+	}
+}
+
+// dnf returns the rule as a disjunction of conjunctions of literals.
+func (e *traefikExpr) dnf(neg bool) ([][]traefikLiteral, error) {
+	switch e.op {
+	case "":
+		return [][]traefikLiteral{{{neg: neg, name: e.name, args: e.args}}}, nil
+	case "!":
+		return e.x.dnf(!neg)
+	}
+	x, err := e.x.dnf(neg)
+	if err != nil {
+		return nil, err
+	}
+	y, err := e.y.dnf(neg)
+	if err != nil {
+		return nil, err
+	}
+	// De Morgan: a negated and is an or
+	if (e.op == "||") != neg {
+		if len(x)+len(y) > maxTraefikTerms {
+			return nil, ErrInvalidTraefikRule.Subject("too complex")
+		}
+		return append(x, y...), nil
+	}
+	if len(x)*len(y) > maxTraefikTerms {
+		return nil, ErrInvalidTraefikRule.Subject("too complex")
+	}
+	terms := make([][]traefikLiteral, 0, len(x)*len(y))
+	for _, a := range x {
+		for _, b := range y {
+			terms = append(terms, append(append([]traefikLiteral(nil), a...), b...))
+		}
+	}
+	return terms, nil
+}
+
+// traefikTerm is a conjunction of a rule translated to GoDoxy.
+type traefikTerm struct {
+	hosts []string // any of the hosts
+	on    []string // rule matcher lines, all must match
+}
+
+// translateTraefikTerm translates a conjunction, unsupported matchers are returned as errors.
+func translateTraefikTerm(lits []traefikLiteral) (traefikTerm, error) {
+	var t traefikTerm
+	hostSet := false
+	for _, l := range lits {
+		not := ""
+		if l.neg {
+			not = "!"
+		}
+		// matchers with alternatives are ORed on a line, negated ones are ANDed on separate lines
+		alt := func(format func(arg string) string) {
+			if l.neg {
+				for _, arg := range l.args {
+					t.on = append(t.on, not+format(arg))
+				}
+				return
+			}
+			parts := make([]string, len(l.args))
+			for i, arg := range l.args {
+				parts[i] = format(arg)
+			}
+			t.on = append(t.on, strings.Join(parts, " | "))
+		}
+
+		if len(l.args) == 0 {
+			return t, ErrInvalidTraefikRule.Subjectf("%s: missing arguments", l.name)
+		}
+		switch strings.ToLower(l.name) {
+		case "host":
+			if l.neg || hostSet {
+				return t, gperr.Errorf("%s%s is not supported", not, l.name)
+			}
+			hostSet = true
+			for _, h := range l.args {
+				t.hosts = append(t.hosts, strings.ToLower(h))
+			}
+		case "hostsni":
+			// TCP routers, routed by port
+		case "path":
+			alt(func(arg string) string { return "path " + quoteArg(arg) })
+		case "pathprefix":
+			if !l.neg && prefixMatcher(l.args[0]) == "" && len(l.args) == 1 {
+				continue
+			}
+			alt(func(arg string) string {
+				if m := prefixMatcher(arg); m != "" {
+					return m
+				}
+				return `path glob("/*")`
+			})
+		case "pathregexp":
+			alt(func(arg string) string { return "path regex(" + quoteArg(arg) + ")" })
+		case "method", "methods":
+			alt(func(arg string) string { return "method " + strings.ToUpper(arg) })
+		case "clientip":
+			alt(func(arg string) string { return "remote " + arg })
+		case "header", "headers", "headerregexp", "headersregexp":
+			if len(l.args) != 2 {
+				return t, ErrInvalidTraefikRule.Subjectf("%s: expected 2 arguments", l.name)
+			}
+			value := quoteArg(l.args[1])
+			if strings.HasSuffix(strings.ToLower(l.name), "regexp") {
+				value = "regex(" + quoteArg(l.args[1]) + ")"
+			}
+			t.on = append(t.on, not+"header "+quoteArg(l.args[0])+" "+value)
+		case "query", "queryregexp":
+			// v3 Query(`key`, `value`), v2 Query(`key=value`)
+			key, value := l.args[0], ""
+			if len(l.args) > 1 {
+				value = l.args[1]
+			} else {
+				key, value, _ = strings.Cut(key, "=")
+			}
+			if strings.EqualFold(l.name, "queryregexp") {
+				value = "regex(" + quoteArg(value) + ")"
+			} else {
+				value = quoteArg(value)
+			}
+			t.on = append(t.on, not+"query "+quoteArg(key)+" "+value)
+		default:
+			return t, gperr.Errorf("%s is not supported", l.name)
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,149 @@
+package importer
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Helpers of decoded YAML values, Traefik keys are case insensitive and label values are strings.
+
+// get returns the value of the first key matching case insensitively.
+func get(m map[string]any, key string) any {
+	if v, ok := m[key]; ok {
+		return v
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return nil
+}
+
+func getMap(m map[string]any, keys ...string) map[string]any {
+	for _, key := range keys {
+		m, _ = get(m, key).(map[string]any)
+		if m == nil {
+			return nil
+		}
+	}
+	return m
+}
+
+func getString(m map[string]any, key string) string {
+	return asString(get(m, key))
+}
+
+func asString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func getBool(m map[string]any, key string) bool {
+	b, _ := strconv.ParseBool(getString(m, key))
+	return b
+}
+
+func getInt(m map[string]any, key string) int {
+	n, _ := strconv.Atoi(getString(m, key))
+	return n
+}
+
+// getStrings returns a list, or a comma separated string as a list.
+func getStrings(m map[string]any, key string) []string {
+	var list []string
+	switch v := get(m, key).(type) {
+	case nil:
+	case []any:
+		for _, e := range v {
+			list = append(list, asString(e))
+		}
+	case map[string]any: // indexed labels, e.g. "prefixes[0]"
+		for _, e := range asList(v) {
+			list = append(list, asString(e))
+		}
+	default:
+		for s := range strings.SplitSeq(asString(v), ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+	}
+	return list
+}
+
+// getList returns a list, or a map with numeric keys from labels as a list.
+func getList(m map[string]any, key string) []any {
+	switch v := get(m, key).(type) {
+	case []any:
+		return v
+	case map[string]any:
+		return asList(v)
+	}
+	return nil
+}
+
+func asList(m map[string]any) []any {
+	keys := slices.Collect(maps.Keys(m))
+	slices.SortFunc(keys, func(a, b string) int {
+		x, _ := strconv.Atoi(a)
+		y, _ := strconv.Atoi(b)
+		return x - y
+	})
+	list := make([]any, 0, len(keys))
+	for _, k := range keys {
+		list = append(list, m[k])
+	}
+	return list
+}
+
+// getStringMap returns a map of string values, e.g. headers.
+func getStringMap(m map[string]any, key string) map[string]string {
+	src := getMap(m, key)
+	if len(src) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(src))
+	for k, v := range src {
+		out[k] = asString(v)
+	}
+	return out
+}
+
+// setPath sets a value in nested maps, creating them as needed.
+func setPath(m map[string]any, path []string, value any) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := m[key].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			m[key] = next
+		}
+		m = next
+	}
+	m[path[len(path)-1]] = value
+}
+
+// mergeMaps merges src into dst recursively, values of dst win.
+func mergeMaps(dst, src map[string]any) {
+	for k, v := range src {
+		dv, ok := dst[k]
+		if !ok {
+			dst[k] = v
+			continue
+		}
+		dm, ok1 := dv.(map[string]any)
+		sm, ok2 := v.(map[string]any)
+		if ok1 && ok2 {
+			mergeMaps(dm, sm)
+		}
+	}
+}
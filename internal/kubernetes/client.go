@@ -0,0 +1,198 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/bytedance/sonic"
+	gperr "github.com/yusing/goutils/errs"
+	strutils "github.com/yusing/goutils/strings"
+)
+
+// Client is a minimal Kubernetes API client supporting list, watch and ingress status updates.
+type Client struct {
+	url       string
+	http      *http.Client
+	token     strutils.Redacted
+	tokenFile string
+}
+
+type (
+	WatchEventType string
+	WatchEvent     struct {
+		Type   WatchEventType `json:"type"`
+		Object struct {
+			Metadata ObjectMeta `json:"metadata"`
+			// set on ERROR events
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"object"`
+	}
+)
+
+const (
+	WatchEventAdded    WatchEventType = "ADDED"
+	WatchEventModified WatchEventType = "MODIFIED"
+	WatchEventDeleted  WatchEventType = "DELETED"
+	WatchEventBookmark WatchEventType = "BOOKMARK"
+	WatchEventError    WatchEventType = "ERROR"
+)
+
+// watchTimeoutSeconds makes the API server close watches periodically, they are resumed from the last resource version.
+const watchTimeoutSeconds = "300"
+
+var (
+	ErrNotFound = gperr.New("not found")
+	// ErrGone is returned when watching from a resource version that is no longer available, the resource must be listed again.
+	ErrGone = gperr.New("resource version too old")
+)
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body []byte, contentType string) (*http.Response, error) {
+	u := c.url + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	token := c.token.String()
+	if c.tokenFile != "" {
+		data, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return nil, gperr.Wrap(err, "failed to read service account token")
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, statusError(resp, path)
+	}
+	return resp, nil
+}
+
+func statusError(resp *http.Response, path string) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var status Status
+	if err := sonic.Unmarshal(body, &status); err != nil || status.Message == "" {
+		status.Message = strings.TrimSpace(string(body))
+	}
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return ErrNotFound.Subject(path)
+	case http.StatusGone:
+		return ErrGone.Subject(path)
+	}
+	return gperr.Errorf("%s: %s", resp.Status, status.Message).Subject(path)
+}
+
+// List lists objects of resource r in namespace, or in all namespaces if namespace is empty.
+//
+// It returns the objects and the resource version to start watching from.
+func List[T any](ctx context.Context, c *Client, r Resource, namespace string) ([]T, string, error) {
+	resp, err := c.do(ctx, http.MethodGet, r.Path(namespace), nil, nil, "")
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	var list struct {
+		Metadata ListMeta `json:"metadata"`
+		Items    []T      `json:"items"`
+	}
+	if err := sonic.ConfigDefault.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, "", gperr.Wrap(err, "failed to decode "+r.Plural)
+	}
+	return list.Items, list.Metadata.ResourceVersion, nil
+}
+
+// ListAll lists objects of resource r in all given namespaces, an empty namespace meaning all namespaces.
+func ListAll[T any](ctx context.Context, c *Client, r Resource, namespaces []string) ([]T, error) {
+	var all []T
+	for _, ns := range namespaces {
+		items, _, err := List[T](ctx, c, r, ns)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+	}
+	return all, nil
+}
+
+// Watch watches resource r from resourceVersion and calls fn for each event until the API server closes the stream.
+//
+// It returns the last seen resource version, and ErrGone if resourceVersion is too old.
+func (c *Client) Watch(ctx context.Context, r Resource, namespace, resourceVersion string, fn func(WatchEvent)) (string, error) {
+	query := url.Values{
+		"watch":               {"1"},
+		"allowWatchBookmarks": {"true"},
+		"timeoutSeconds":      {watchTimeoutSeconds},
+	}
+	if resourceVersion != "" {
+		query.Set("resourceVersion", resourceVersion)
+	}
+	resp, err := c.do(ctx, http.MethodGet, r.Path(namespace), query, nil, "")
+	if err != nil {
+		return resourceVersion, err
+	}
+	defer resp.Body.Close()
+
+	dec := sonic.ConfigDefault.NewDecoder(resp.Body)
+	for {
+		var event WatchEvent
+		if err := dec.Decode(&event); err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return resourceVersion, nil
+			}
+			return resourceVersion, gperr.Wrap(err, "failed to decode watch event")
+		}
+		if event.Type == WatchEventError {
+			if event.Object.Code == http.StatusGone {
+				return resourceVersion, ErrGone.Subject(r.Path(namespace))
+			}
+			return resourceVersion, gperr.Errorf("watch error %d: %s", event.Object.Code, event.Object.Message).Subject(r.Path(namespace))
+		}
+		if rv := event.Object.Metadata.ResourceVersion; rv != "" {
+			resourceVersion = rv
+		}
+		if event.Type != WatchEventBookmark {
+			fn(event)
+		}
+	}
+}
+
+// UpdateIngressStatus replaces the load balancer status of an ingress.
+func (c *Client) UpdateIngressStatus(ctx context.Context, namespace, name string, status IngressStatus) error {
+	patch, err := sonic.Marshal(map[string]any{"status": status})
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, http.MethodPatch, ResourceIngress.Path(namespace)+"/"+name+"/status", nil, patch, "application/merge-patch+json")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
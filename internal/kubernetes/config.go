@@ -0,0 +1,135 @@
+package kubernetes
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/yusing/godoxy/internal/net/gphttp"
+	gperr "github.com/yusing/goutils/errs"
+	strutils "github.com/yusing/goutils/strings"
+)
+
+type Config struct {
+	// URL of the API server, not needed when running in the cluster or with a kubeconfig.
+	URL        string `json:"url,omitempty" validate:"omitempty,url"`
+	Kubeconfig string `json:"kubeconfig,omitempty" validate:"omitempty,file"`
+	Context    string `json:"context,omitempty"` // kubeconfig context, default is current-context
+
+	Token       strutils.Redacted `json:"token,omitempty"`
+	CAFile      string            `json:"ca_file,omitempty" validate:"omitempty,file"`
+	NoTLSVerify bool              `json:"no_tls_verify,omitempty" yaml:"no_tls_verify,omitempty"`
+
+	// Namespaces to watch, default is all namespaces.
+	Namespaces   []string `json:"namespaces,omitempty"`
+	IngressClass string   `json:"ingress_class,omitempty"` // default is "godoxy"
+	GatewayClass string   `json:"gateway_class,omitempty"` // default is "godoxy"
+	// StatusAddress is the IP or hostname published in the status of ingresses, status is not updated if empty.
+	StatusAddress string `json:"status_address,omitempty"`
+
+	client *Client
+}
+
+const (
+	ClassDefault = "godoxy"
+
+	inClusterTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	inClusterCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+var ErrNotInCluster = gperr.New("not running in a kubernetes cluster, url or kubeconfig is required")
+
+func (c *Config) Client() *Client {
+	if c.client == nil {
+		panic("kubernetes client accessed before init")
+	}
+	return c.client
+}
+
+// Init sets defaults and creates the API client.
+//
+// Credentials are taken from the kubeconfig if set, then from the config,
+// then from the service account when running in a pod.
+func (c *Config) Init() gperr.Error {
+	if c.IngressClass == "" {
+		c.IngressClass = ClassDefault
+	}
+	if c.GatewayClass == "" {
+		c.GatewayClass = ClassDefault
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: c.NoTLSVerify, //nolint:gosec // user specified
+	}
+	client := &Client{url: c.URL, token: c.Token}
+
+	switch {
+	case c.Kubeconfig != "":
+		kc, err := loadKubeconfig(c.Kubeconfig, c.Context)
+		if err != nil {
+			return gperr.PrependSubject(c.Kubeconfig, err)
+		}
+		if client.url == "" {
+			client.url = kc.server
+		}
+		if client.token == "" {
+			client.token = kc.token
+		}
+		if kc.insecure {
+			tlsConfig.InsecureSkipVerify = true
+		}
+		if len(kc.caData) > 0 {
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(kc.caData) {
+				return gperr.New("invalid certificate authority").Subject(c.Kubeconfig)
+			}
+		}
+		if len(kc.certData) > 0 {
+			cert, err := tls.X509KeyPair(kc.certData, kc.keyData)
+			if err != nil {
+				return gperr.Wrap(err, "invalid client certificate").Subject(c.Kubeconfig)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+	case c.URL == "":
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return ErrNotInCluster
+		}
+		client.url = "https://" + net.JoinHostPort(host, port)
+		if client.token == "" {
+			// service account tokens are rotated, re-read on each request
+			client.tokenFile = inClusterTokenFile
+		}
+		if c.CAFile == "" {
+			c.CAFile = inClusterCAFile
+		}
+	}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return gperr.Wrap(err, "failed to read certificate authority")
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return gperr.New("invalid certificate authority").Subject(c.CAFile)
+		}
+	}
+
+	client.url = strings.TrimSuffix(client.url, "/")
+	client.http = &http.Client{Transport: gphttp.NewTransportWithTLSConfig(tlsConfig)}
+	c.client = client
+	return nil
+}
+
+// ListNamespaces returns the namespaces to list, an empty string meaning all namespaces.
+func (c *Config) ListNamespaces() []string {
+	if len(c.Namespaces) == 0 {
+		return []string{""}
+	}
+	return c.Namespaces
+}
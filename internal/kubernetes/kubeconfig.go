@@ -0,0 +1,150 @@
+package kubernetes
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	gperr "github.com/yusing/goutils/errs"
+	strutils "github.com/yusing/goutils/strings"
+)
+
+// kubeconfigFile is the subset of the kubeconfig format used to connect to a cluster.
+type kubeconfigFile struct {
+	CurrentContext string `yaml:"current-context"`
+	Contexts       []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Clusters []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string `yaml:"token"`
+			TokenFile             string `yaml:"tokenFile"`
+			ClientCertificate     string `yaml:"client-certificate"`
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKey             string `yaml:"client-key"`
+			ClientKeyData         string `yaml:"client-key-data"`
+			Exec                  any    `yaml:"exec"`
+			AuthProvider          any    `yaml:"auth-provider"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// kubeconfig is a resolved kubeconfig context.
+type kubeconfig struct {
+	server   string
+	token    strutils.Redacted
+	insecure bool
+	caData   []byte
+	certData []byte
+	keyData  []byte
+}
+
+var (
+	ErrContextNotFound         = gperr.New("context not found")
+	ErrUnsupportedKubeconfig   = gperr.New("exec and auth-provider credentials are not supported, use a token or client certificate")
+	ErrInvalidKubeconfigServer = gperr.New("cluster has no server")
+)
+
+// loadKubeconfig reads the given context from a kubeconfig file, or the current context if contextName is empty.
+//
+// Relative file paths in the kubeconfig are resolved against its directory.
+func loadKubeconfig(path, contextName string) (*kubeconfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseKubeconfig(data, filepath.Dir(path), contextName)
+}
+
+func parseKubeconfig(data []byte, dir, contextName string) (*kubeconfig, error) {
+	var f kubeconfigFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	if contextName == "" {
+		contextName = f.CurrentContext
+	}
+
+	var clusterName, userName string
+	found := false
+	for _, c := range f.Contexts {
+		if c.Name == contextName {
+			clusterName, userName = c.Context.Cluster, c.Context.User
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, ErrContextNotFound.Subject(contextName)
+	}
+
+	kc := new(kubeconfig)
+	b := gperr.NewBuilder("invalid kubeconfig")
+	for _, c := range f.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		kc.server = c.Cluster.Server
+		kc.insecure = c.Cluster.InsecureSkipTLSVerify
+		kc.caData = readData(&b, c.Cluster.CertificateAuthorityData, c.Cluster.CertificateAuthority, dir)
+	}
+	if kc.server == "" {
+		b.Add(ErrInvalidKubeconfigServer.Subject(clusterName))
+	}
+	for _, u := range f.Users {
+		if u.Name != userName {
+			continue
+		}
+		if u.User.Exec != nil || u.User.AuthProvider != nil {
+			b.Add(ErrUnsupportedKubeconfig.Subject(userName))
+		}
+		kc.token = strutils.Redacted(u.User.Token)
+		if tokenFile := u.User.TokenFile; kc.token == "" && tokenFile != "" {
+			kc.token = strutils.Redacted(strings.TrimSpace(string(readData(&b, "", tokenFile, dir))))
+		}
+		kc.certData = readData(&b, u.User.ClientCertificateData, u.User.ClientCertificate, dir)
+		kc.keyData = readData(&b, u.User.ClientKeyData, u.User.ClientKey, dir)
+	}
+	if err := b.Error(); err != nil {
+		return nil, err
+	}
+	return kc, nil
+}
+
+// readData returns base64 decoded data, or the content of file if data is empty.
+func readData(b *gperr.Builder, data, file, dir string) []byte {
+	if data != "" {
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			b.Add(gperr.Wrap(err, "invalid base64 data"))
+		}
+		return decoded
+	}
+	if file == "" {
+		return nil
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		b.Add(err)
+	}
+	return content
+}
@@ -0,0 +1,164 @@
+package kubernetes_test
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yusing/godoxy/internal/kubernetes"
+	"github.com/yusing/godoxy/internal/kubernetes/kubernetestest"
+	expect "github.com/yusing/goutils/testing"
+)
+
+func newTestClient(t *testing.T) (*kubernetes.Client, *kubernetestest.Server) {
+	t.Helper()
+	srv := kubernetestest.NewServer(t)
+	cfg := srv.Config()
+	expect.NoError(t, cfg.Init())
+	return cfg.Client(), srv
+}
+
+func service(ns, name string) *kubernetes.Service {
+	return &kubernetes.Service{
+		Metadata: kubernetes.ObjectMeta{Namespace: ns, Name: name},
+		Spec:     kubernetes.ServiceSpec{ClusterIP: "10.43.0.10", Ports: []kubernetes.ServicePort{{Port: 80}}},
+	}
+}
+
+func TestList(t *testing.T) {
+	client, srv := newTestClient(t)
+	srv.Apply(kubernetes.ResourceService, service("default", "whoami"))
+	srv.Apply(kubernetes.ResourceService, service("apps", "nginx"))
+
+	all, rv, err := kubernetes.List[kubernetes.Service](t.Context(), client, kubernetes.ResourceService, "")
+	expect.NoError(t, err)
+	expect.Equal(t, len(all), 2)
+	expect.Equal(t, rv, "2")
+
+	apps, err := kubernetes.ListAll[kubernetes.Service](t.Context(), client, kubernetes.ResourceService, []string{"apps"})
+	expect.NoError(t, err)
+	expect.Equal(t, len(apps), 1)
+	expect.Equal(t, apps[0].Metadata.Name, "nginx")
+	expect.Equal(t, apps[0].Spec.ClusterIP, "10.43.0.10")
+}
+
+func TestListNotFound(t *testing.T) {
+	client, srv := newTestClient(t)
+	srv.DisableGroup(kubernetes.ResourceHTTPRoute.Group)
+	_, _, err := kubernetes.List[kubernetes.HTTPRoute](t.Context(), client, kubernetes.ResourceHTTPRoute, "")
+	expect.ErrorIs(t, kubernetes.ErrNotFound, err)
+}
+
+func TestWatch(t *testing.T) {
+	client, srv := newTestClient(t)
+	srv.Apply(kubernetes.ResourceService, service("default", "whoami"))
+	_, rv, err := kubernetes.List[kubernetes.Service](t.Context(), client, kubernetes.ResourceService, "")
+	expect.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	var events []kubernetes.WatchEvent
+	go func() {
+		srv.Apply(kubernetes.ResourceService, service("default", "whoami"))
+		srv.Delete(kubernetes.ResourceService, "default", "whoami")
+	}()
+	rv, err = client.Watch(ctx, kubernetes.ResourceService, "", rv, func(e kubernetes.WatchEvent) {
+		events = append(events, e)
+		if len(events) == 2 {
+			cancel()
+		}
+	})
+	expect.NoError(t, err)
+	expect.Equal(t, rv, "3")
+	expect.Equal(t, len(events), 2)
+	expect.Equal(t, events[0].Type, kubernetes.WatchEventModified)
+	expect.Equal(t, events[1].Type, kubernetes.WatchEventDeleted)
+	expect.Equal(t, events[1].Object.Metadata.Name, "whoami")
+
+	srv.Compact()
+	_, err = client.Watch(t.Context(), kubernetes.ResourceService, "", "1", func(kubernetes.WatchEvent) {})
+	expect.ErrorIs(t, kubernetes.ErrGone, err)
+}
+
+func TestUpdateIngressStatus(t *testing.T) {
+	client, srv := newTestClient(t)
+	srv.Apply(kubernetes.ResourceIngress, &kubernetes.Ingress{Metadata: kubernetes.ObjectMeta{Namespace: "default", Name: "whoami"}})
+
+	status := kubernetes.IngressStatus{LoadBalancer: kubernetes.LoadBalancerStatus{
+		Ingress: []kubernetes.LoadBalancerIngress{{IP: "10.0.0.2"}},
+	}}
+	expect.NoError(t, client.UpdateIngressStatus(t.Context(), "default", "whoami", status))
+
+	var ing kubernetes.Ingress
+	expect.True(t, srv.Get(kubernetes.ResourceIngress, "default", "whoami", &ing))
+	expect.Equal(t, ing.Status, status)
+
+	err := client.UpdateIngressStatus(t.Context(), "default", "missing", status)
+	expect.ErrorIs(t, kubernetes.ErrNotFound, err)
+}
+
+const testKubeconfig = `
+apiVersion: v1
+kind: Config
+current-context: k3s
+contexts:
+  - name: k3s
+    context: {cluster: k3s, user: admin}
+  - name: other
+    context: {cluster: other, user: exec}
+clusters:
+  - name: k3s
+    cluster:
+      server: https://127.0.0.1:6443
+      insecure-skip-tls-verify: true
+  - name: other
+    cluster:
+      server: https://10.0.0.1:6443
+users:
+  - name: admin
+    user:
+      tokenFile: token
+  - name: exec
+    user:
+      exec:
+        command: aws
+`
+
+func TestKubeconfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "kubeconfig.yaml")
+	expect.NoError(t, os.WriteFile(path, []byte(testKubeconfig), 0o600))
+	expect.NoError(t, os.WriteFile(filepath.Join(dir, "token"), []byte("secret\n"), 0o600))
+
+	cfg := &kubernetes.Config{Kubeconfig: path}
+	expect.NoError(t, cfg.Init())
+	expect.Equal(t, cfg.IngressClass, kubernetes.ClassDefault)
+
+	cfg = &kubernetes.Config{Kubeconfig: path, Context: "other"}
+	expect.ErrorIs(t, kubernetes.ErrUnsupportedKubeconfig, cfg.Init())
+
+	cfg = &kubernetes.Config{Kubeconfig: path, Context: "missing"}
+	expect.ErrorIs(t, kubernetes.ErrContextNotFound, cfg.Init())
+}
+
+func TestKubeconfigInvalidCA(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kubeconfig.yaml")
+	data := `
+current-context: c
+contexts: [{name: c, context: {cluster: c, user: u}}]
+clusters: [{name: c, cluster: {server: "https://127.0.0.1:6443", certificate-authority-data: ` + base64.StdEncoding.EncodeToString([]byte("not a pem")) + `}}]
+users: [{name: u, user: {token: abc}}]
+`
+	expect.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+	cfg := &kubernetes.Config{Kubeconfig: path}
+	expect.ErrorContains(t, cfg.Init(), "invalid certificate authority")
+}
+
+func TestNotInCluster(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	cfg := &kubernetes.Config{}
+	expect.ErrorIs(t, kubernetes.ErrNotInCluster, cfg.Init())
+}
@@ -0,0 +1,328 @@
+// Package kubernetestest provides an in-process fake Kubernetes API server for tests.
+//
+// It supports list, watch and status patches of the resources in kubernetes.Resources.
+package kubernetestest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/yusing/godoxy/internal/kubernetes"
+)
+
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	rv       int64
+	objects  map[string]map[string]map[string]any // plural -> namespace/name -> object
+	history  []event
+	minRV    int64 // watches from an older resource version get 410 Gone
+	changed  chan struct{}
+	disabled map[string]bool // API groups that are not installed
+}
+
+type event struct {
+	rv        int64
+	plural    string
+	namespace string
+	Type      kubernetes.WatchEventType `json:"type"`
+	Object    map[string]any            `json:"object"`
+}
+
+// NewServer starts a fake API server, objects are added with Apply.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	s := &Server{
+		objects:  make(map[string]map[string]map[string]any),
+		changed:  make(chan struct{}),
+		disabled: make(map[string]bool),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Config returns a provider config connecting to the server.
+func (s *Server) Config() *kubernetes.Config {
+	return &kubernetes.Config{URL: s.URL}
+}
+
+// Apply creates or replaces an object, e.g. a *kubernetes.Ingress.
+func (s *Server) Apply(r kubernetes.Resource, obj any) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		panic(err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		panic(err)
+	}
+	ns, name := objectKey(m)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	objects := s.objects[r.Plural]
+	if objects == nil {
+		objects = make(map[string]map[string]any)
+		s.objects[r.Plural] = objects
+	}
+	eventType := kubernetes.WatchEventAdded
+	if _, ok := objects[ns+"/"+name]; ok {
+		eventType = kubernetes.WatchEventModified
+	}
+	objects[ns+"/"+name] = m
+	s.notifyLocked(r.Plural, eventType, m)
+}
+
+// Delete deletes an object.
+func (s *Server) Delete(r kubernetes.Resource, namespace, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.objects[r.Plural][namespace+"/"+name]
+	if !ok {
+		return
+	}
+	delete(s.objects[r.Plural], namespace+"/"+name)
+	s.notifyLocked(r.Plural, kubernetes.WatchEventDeleted, m)
+}
+
+// Get decodes an object into out and reports whether it exists.
+func (s *Server) Get(r kubernetes.Resource, namespace, name string, out any) bool {
+	s.mu.Lock()
+	m, ok := s.objects[r.Plural][namespace+"/"+name]
+	var data []byte
+	if ok {
+		data, _ = json.Marshal(m)
+	}
+	s.mu.Unlock()
+	if !ok {
+		return false
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		panic(err)
+	}
+	return true
+}
+
+// ResourceVersion returns the current resource version, it increases on every change.
+func (s *Server) ResourceVersion() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rv
+}
+
+// DisableGroup makes all resources of an API group return 404, like missing CRDs.
+func (s *Server) DisableGroup(group string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.disabled[group] = true
+}
+
+// Compact drops the event history, watches resuming from an older resource version get 410 Gone.
+func (s *Server) Compact() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history = nil
+	s.minRV = s.rv + 1
+	// wake up watchers so they see the compaction
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *Server) notifyLocked(plural string, eventType kubernetes.WatchEventType, m map[string]any) {
+	s.rv++
+	metadata, _ := m["metadata"].(map[string]any)
+	if metadata == nil {
+		metadata = make(map[string]any)
+		m["metadata"] = metadata
+	}
+	metadata["resourceVersion"] = strconv.FormatInt(s.rv, 10)
+	ns, _ := objectKey(m)
+	s.history = append(s.history, event{rv: s.rv, plural: plural, namespace: ns, Type: eventType, Object: m})
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func objectKey(m map[string]any) (namespace, name string) {
+	metadata, _ := m["metadata"].(map[string]any)
+	namespace, _ = metadata["namespace"].(string)
+	name, _ = metadata["name"].(string)
+	return namespace, name
+}
+
+type request struct {
+	resource  kubernetes.Resource
+	namespace string
+	name      string
+	status    bool
+}
+
+// parsePath parses /api/v1[/namespaces/{ns}]/{plural}[/{name}[/status]] and the /apis/{group}/{version} equivalent.
+func parsePath(path string) (req request, ok bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	var group, version string
+	switch {
+	case len(parts) >= 3 && parts[0] == "api":
+		version, parts = parts[1], parts[2:]
+	case len(parts) >= 4 && parts[0] == "apis":
+		group, version, parts = parts[1], parts[2], parts[3:]
+	default:
+		return req, false
+	}
+	if len(parts) >= 3 && parts[0] == "namespaces" {
+		req.namespace, parts = parts[1], parts[2:]
+	}
+	for _, r := range kubernetes.Resources {
+		if r.Group == group && r.Version == version && r.Plural == parts[0] {
+			req.resource = r
+			ok = true
+		}
+	}
+	if len(parts) >= 2 {
+		req.name = parts[1]
+	}
+	req.status = len(parts) == 3 && parts[2] == "status"
+	return req, ok && len(parts) <= 3
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	req, ok := parsePath(r.URL.Path)
+	s.mu.Lock()
+	disabled := s.disabled[req.resource.Group]
+	s.mu.Unlock()
+	if !ok || disabled {
+		writeStatus(w, http.StatusNotFound, "the server could not find the requested resource")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && req.name == "" && r.URL.Query().Get("watch") != "":
+		s.watch(w, r, req)
+	case r.Method == http.MethodGet && req.name == "":
+		s.list(w, req)
+	case r.Method == http.MethodPatch && req.status:
+		s.patchStatus(w, r, req)
+	default:
+		writeStatus(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func writeStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(kubernetes.Status{Kind: "Status", Status: "Failure", Message: message, Code: code})
+}
+
+func (s *Server) list(w http.ResponseWriter, req request) {
+	s.mu.Lock()
+	items := make([]map[string]any, 0)
+	for _, m := range s.objects[req.resource.Plural] {
+		if ns, _ := objectKey(m); req.namespace == "" || ns == req.namespace {
+			items = append(items, m)
+		}
+	}
+	data, err := json.Marshal(map[string]any{
+		"kind":     req.resource.Kind + "List",
+		"metadata": kubernetes.ListMeta{ResourceVersion: strconv.FormatInt(s.rv, 10)},
+		"items":    items,
+	})
+	s.mu.Unlock()
+	if err != nil {
+		writeStatus(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+func (s *Server) watch(w http.ResponseWriter, r *http.Request, req request) {
+	since, _ := strconv.ParseInt(r.URL.Query().Get("resourceVersion"), 10, 64)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+
+	for {
+		s.mu.Lock()
+		if since < s.minRV-1 {
+			s.mu.Unlock()
+			_ = enc.Encode(map[string]any{
+				"type":   kubernetes.WatchEventError,
+				"object": kubernetes.Status{Kind: "Status", Status: "Failure", Reason: "Expired", Message: "too old resource version", Code: http.StatusGone},
+			})
+			return
+		}
+		var pending []event
+		for _, e := range s.history {
+			if e.rv > since && e.plural == req.resource.Plural && (req.namespace == "" || e.namespace == req.namespace) {
+				pending = append(pending, e)
+			}
+		}
+		since = s.rv
+		changed := s.changed
+		// encode while locked, objects may be modified afterwards
+		for _, e := range pending {
+			_ = enc.Encode(e)
+		}
+		s.mu.Unlock()
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changed:
+		}
+	}
+}
+
+func (s *Server) patchStatus(w http.ResponseWriter, r *http.Request, req request) {
+	if r.Header.Get("Content-Type") != "application/merge-patch+json" {
+		writeStatus(w, http.StatusUnsupportedMediaType, "unsupported patch type")
+		return
+	}
+	var patch map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeStatus(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.objects[req.resource.Plural][req.namespace+"/"+req.name]
+	if !ok {
+		writeStatus(w, http.StatusNotFound, req.resource.Plural+" \""+req.name+"\" not found")
+		return
+	}
+	m["status"] = mergePatch(m["status"], patch["status"])
+	s.notifyLocked(req.resource.Plural, kubernetes.WatchEventModified, m)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(m)
+}
+
+// mergePatch applies a JSON merge patch (RFC 7386).
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any)
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
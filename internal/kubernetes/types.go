@@ -0,0 +1,253 @@
+package kubernetes
+
+// Only the fields used by the route provider are declared.
+// See https://kubernetes.io/docs/reference/kubernetes-api/ and https://gateway-api.sigs.k8s.io/reference/spec/.
+
+type (
+	ObjectMeta struct {
+		Name            string            `json:"name"`
+		Namespace       string            `json:"namespace,omitempty"`
+		UID             string            `json:"uid,omitempty"`
+		ResourceVersion string            `json:"resourceVersion,omitempty"`
+		Labels          map[string]string `json:"labels,omitempty"`
+		Annotations     map[string]string `json:"annotations,omitempty"`
+	}
+	ListMeta struct {
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	}
+	// Object is any object, with only its metadata decoded.
+	Object struct {
+		Metadata ObjectMeta `json:"metadata"`
+	}
+	// Status is returned by the API server on errors.
+	Status struct {
+		Kind    string `json:"kind"`
+		Status  string `json:"status"`
+		Message string `json:"message"`
+		Reason  string `json:"reason"`
+		Code    int    `json:"code"`
+	}
+)
+
+type (
+	Service struct {
+		Metadata ObjectMeta  `json:"metadata"`
+		Spec     ServiceSpec `json:"spec"`
+	}
+	ServiceSpec struct {
+		Type         string        `json:"type,omitempty"`
+		ClusterIP    string        `json:"clusterIP,omitempty"`
+		ExternalName string        `json:"externalName,omitempty"`
+		Ports        []ServicePort `json:"ports,omitempty"`
+	}
+	ServicePort struct {
+		Name     string `json:"name,omitempty"`
+		Protocol string `json:"protocol,omitempty"`
+		Port     int32  `json:"port"`
+	}
+)
+
+const (
+	ServiceTypeExternalName = "ExternalName"
+	ClusterIPNone           = "None"
+)
+
+type (
+	Ingress struct {
+		Metadata ObjectMeta    `json:"metadata"`
+		Spec     IngressSpec   `json:"spec"`
+		Status   IngressStatus `json:"status"`
+	}
+	IngressSpec struct {
+		IngressClassName *string         `json:"ingressClassName,omitempty"`
+		DefaultBackend   *IngressBackend `json:"defaultBackend,omitempty"`
+		Rules            []IngressRule   `json:"rules,omitempty"`
+	}
+	IngressRule struct {
+		Host string                `json:"host,omitempty"`
+		HTTP *HTTPIngressRuleValue `json:"http,omitempty"`
+	}
+	HTTPIngressRuleValue struct {
+		Paths []HTTPIngressPath `json:"paths"`
+	}
+	HTTPIngressPath struct {
+		Path     string         `json:"path,omitempty"`
+		PathType string         `json:"pathType"`
+		Backend  IngressBackend `json:"backend"`
+	}
+	IngressBackend struct {
+		Service *IngressServiceBackend `json:"service,omitempty"`
+	}
+	IngressServiceBackend struct {
+		Name string             `json:"name"`
+		Port ServiceBackendPort `json:"port"`
+	}
+	ServiceBackendPort struct {
+		Name   string `json:"name,omitempty"`
+		Number int32  `json:"number,omitempty"`
+	}
+	IngressStatus struct {
+		LoadBalancer LoadBalancerStatus `json:"loadBalancer"`
+	}
+	LoadBalancerStatus struct {
+		Ingress []LoadBalancerIngress `json:"ingress,omitempty"`
+	}
+	LoadBalancerIngress struct {
+		IP       string `json:"ip,omitempty"`
+		Hostname string `json:"hostname,omitempty"`
+	}
+)
+
+const (
+	PathTypeExact                  = "Exact"
+	PathTypePrefix                 = "Prefix"
+	PathTypeImplementationSpecific = "ImplementationSpecific"
+
+	// AnnotationIngressClass is the deprecated way to select an ingress class, still widely used.
+	AnnotationIngressClass = "kubernetes.io/ingress.class"
+)
+
+type (
+	Gateway struct {
+		Metadata ObjectMeta  `json:"metadata"`
+		Spec     GatewaySpec `json:"spec"`
+	}
+	GatewaySpec struct {
+		GatewayClassName string     `json:"gatewayClassName"`
+		Listeners        []Listener `json:"listeners"`
+	}
+	Listener struct {
+		Name          string         `json:"name"`
+		Hostname      string         `json:"hostname,omitempty"`
+		Port          int32          `json:"port"`
+		Protocol      string         `json:"protocol"`
+		AllowedRoutes *AllowedRoutes `json:"allowedRoutes,omitempty"`
+	}
+	AllowedRoutes struct {
+		Namespaces *RouteNamespaces `json:"namespaces,omitempty"`
+	}
+	RouteNamespaces struct {
+		From string `json:"from,omitempty"` // NamespacesFrom*, default is Same
+	}
+	ParentReference struct {
+		Group       string `json:"group,omitempty"`
+		Kind        string `json:"kind,omitempty"`
+		Namespace   string `json:"namespace,omitempty"`
+		Name        string `json:"name"`
+		SectionName string `json:"sectionName,omitempty"`
+		Port        int32  `json:"port,omitempty"`
+	}
+	BackendRef struct {
+		Group     string `json:"group,omitempty"`
+		Kind      string `json:"kind,omitempty"`
+		Namespace string `json:"namespace,omitempty"`
+		Name      string `json:"name"`
+		Port      int32  `json:"port,omitempty"`
+		Weight    *int32 `json:"weight,omitempty"`
+	}
+
+	HTTPRoute struct {
+		Metadata ObjectMeta    `json:"metadata"`
+		Spec     HTTPRouteSpec `json:"spec"`
+	}
+	HTTPRouteSpec struct {
+		ParentRefs []ParentReference `json:"parentRefs,omitempty"`
+		Hostnames  []string          `json:"hostnames,omitempty"`
+		Rules      []HTTPRouteRule   `json:"rules,omitempty"`
+	}
+	HTTPRouteRule struct {
+		Matches     []HTTPRouteMatch `json:"matches,omitempty"`
+		BackendRefs []BackendRef     `json:"backendRefs,omitempty"`
+	}
+	HTTPRouteMatch struct {
+		Path *HTTPPathMatch `json:"path,omitempty"`
+	}
+	HTTPPathMatch struct {
+		Type  string `json:"type,omitempty"`
+		Value string `json:"value,omitempty"`
+	}
+
+	TCPRoute struct {
+		Metadata ObjectMeta   `json:"metadata"`
+		Spec     TCPRouteSpec `json:"spec"`
+	}
+	TCPRouteSpec struct {
+		ParentRefs []ParentReference `json:"parentRefs,omitempty"`
+		Rules      []TCPRouteRule    `json:"rules,omitempty"`
+	}
+	TCPRouteRule struct {
+		BackendRefs []BackendRef `json:"backendRefs,omitempty"`
+	}
+
+	// ReferenceGrant allows routes in other namespaces to reference objects in its namespace.
+	ReferenceGrant struct {
+		Metadata ObjectMeta         `json:"metadata"`
+		Spec     ReferenceGrantSpec `json:"spec"`
+	}
+	ReferenceGrantSpec struct {
+		From []ReferenceGrantFrom `json:"from"`
+		To   []ReferenceGrantTo   `json:"to"`
+	}
+	ReferenceGrantFrom struct {
+		Group     string `json:"group"`
+		Kind      string `json:"kind"`
+		Namespace string `json:"namespace"`
+	}
+	ReferenceGrantTo struct {
+		Group string  `json:"group"`
+		Kind  string  `json:"kind"`
+		Name  *string `json:"name,omitempty"` // all objects of the kind if nil
+	}
+)
+
+const (
+	PathMatchExact             = "Exact"
+	PathMatchPathPrefix        = "PathPrefix"
+	PathMatchRegularExpression = "RegularExpression"
+
+	ProtocolTCP = "TCP"
+
+	NamespacesFromAll      = "All"
+	NamespacesFromSame     = "Same"
+	NamespacesFromSelector = "Selector"
+)
+
+// Resource identifies an API resource.
+type Resource struct {
+	Group   string
+	Version string
+	Kind    string
+	Plural  string
+}
+
+var (
+	ResourceService   = Resource{Version: "v1", Kind: "Service", Plural: "services"}
+	ResourceIngress   = Resource{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress", Plural: "ingresses"}
+	ResourceGateway   = Resource{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "Gateway", Plural: "gateways"}
+	ResourceHTTPRoute = Resource{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "HTTPRoute", Plural: "httproutes"}
+	ResourceTCPRoute  = Resource{Group: "gateway.networking.k8s.io", Version: "v1alpha2", Kind: "TCPRoute", Plural: "tcproutes"}
+
+	ResourceReferenceGrant = Resource{Group: "gateway.networking.k8s.io", Version: "v1beta1", Kind: "ReferenceGrant", Plural: "referencegrants"}
+
+	// Resources are all resources watched by the route provider.
+	Resources = []Resource{ResourceService, ResourceIngress, ResourceGateway, ResourceHTTPRoute, ResourceTCPRoute, ResourceReferenceGrant}
+)
+
+// Path returns the API path of the resource in namespace, or in all namespaces if namespace is empty.
+func (r Resource) Path(namespace string) string {
+	var p string
+	if r.Group == "" {
+		p = "/api/" + r.Version
+	} else {
+		p = "/apis/" + r.Group + "/" + r.Version
+	}
+	if namespace != "" {
+		p += "/namespaces/" + namespace
+	}
+	return p + "/" + r.Plural
+}
+
+// Key returns the key of an object of this resource, e.g. "Ingress/default/whoami".
+func (r Resource) Key(namespace, name string) string {
+	return r.Kind + "/" + namespace + "/" + name
+}
@@ -0,0 +1,236 @@
+// Package libvirt implements a minimal client for the libvirt remote protocol over a unix socket.
+//
+// Only the procedures needed to manage the lifecycle of a domain are implemented.
+package libvirt
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const callTimeout = 30 * time.Second
+
+// Conn is an open connection to a hypervisor through libvirtd.
+//
+// Calls are serialized, events and keepalive messages are discarded.
+// A connection that hit an I/O error is closed and all further calls return net.ErrClosed.
+type Conn struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	br     *bufio.Reader
+	serial uint32
+	closed bool
+}
+
+// Dial connects to the daemon socket (DefaultSocket if empty) and opens the hypervisor uri (DefaultURI if empty).
+func Dial(ctx context.Context, socket, uri string) (*Conn, error) {
+	if socket == "" {
+		socket = DefaultSocket
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewConn(ctx, conn, uri)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewConn opens the hypervisor uri over an established connection.
+func NewConn(ctx context.Context, conn net.Conn, uri string) (*Conn, error) {
+	if uri == "" {
+		uri = DefaultURI
+	}
+	c := &Conn{conn: conn, br: bufio.NewReader(conn)}
+	var args Encoder
+	args.OptStr(&uri)
+	args.Uint32(0) // flags
+	if _, err := c.Call(ctx, ProcConnectOpen, args.Bytes()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Call sends a call and returns the reply body, error replies are returned as *Error.
+func (c *Conn) Call(ctx context.Context, proc Procedure, args []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, net.ErrClosed
+	}
+
+	c.serial++
+	call := &Packet{
+		Header: Header{
+			Program:   Program,
+			Version:   ProgramVersion,
+			Procedure: proc,
+			Type:      TypeCall,
+			Serial:    c.serial,
+			Status:    StatusOK,
+		},
+		Body: args,
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(callTimeout)
+	}
+	_ = c.conn.SetDeadline(deadline)
+	defer c.conn.SetDeadline(time.Time{})
+
+	if _, err := c.conn.Write(call.Encode()); err != nil {
+		c.closeLocked()
+		return nil, err
+	}
+	for {
+		reply, err := ReadPacket(c.br)
+		if err != nil {
+			c.closeLocked()
+			return nil, err
+		}
+		if reply.Program != Program || reply.Type != TypeReply || reply.Serial != call.Serial {
+			continue
+		}
+		switch reply.Status {
+		case StatusOK:
+			return reply.Body, nil
+		case StatusError:
+			return nil, decodeError(reply.Body)
+		default:
+			c.closeLocked()
+			return nil, fmt.Errorf("%w: unexpected reply status %d", ErrInvalidMessage, reply.Status)
+		}
+	}
+}
+
+// LookupDomain returns the domain with the given name.
+func (c *Conn) LookupDomain(ctx context.Context, name string) (Domain, error) {
+	var args Encoder
+	args.Str(name)
+	reply, err := c.Call(ctx, ProcDomainLookupByName, args.Bytes())
+	if err != nil {
+		return Domain{}, err
+	}
+	d := NewDecoder(reply)
+	dom := d.Domain()
+	return dom, d.Err()
+}
+
+// DomainCreate starts a defined domain, restoring it from its managed save image if there is one.
+func (c *Conn) DomainCreate(ctx context.Context, dom Domain) error {
+	return c.domainCall(ctx, ProcDomainCreate, dom)
+}
+
+// DomainShutdown asks the guest to shut down, it returns before the guest has stopped.
+func (c *Conn) DomainShutdown(ctx context.Context, dom Domain) error {
+	return c.domainCall(ctx, ProcDomainShutdown, dom)
+}
+
+// DomainDestroy forcefully stops the domain.
+func (c *Conn) DomainDestroy(ctx context.Context, dom Domain) error {
+	return c.domainCall(ctx, ProcDomainDestroy, dom)
+}
+
+// DomainSuspend pauses the domain's vCPUs, its memory stays allocated.
+func (c *Conn) DomainSuspend(ctx context.Context, dom Domain) error {
+	return c.domainCall(ctx, ProcDomainSuspend, dom)
+}
+
+// DomainResume resumes a suspended domain.
+func (c *Conn) DomainResume(ctx context.Context, dom Domain) error {
+	return c.domainCall(ctx, ProcDomainResume, dom)
+}
+
+// DomainManagedSave saves the domain's memory to disk and stops it, the next DomainCreate restores it.
+func (c *Conn) DomainManagedSave(ctx context.Context, dom Domain) error {
+	var args Encoder
+	args.Domain(dom)
+	args.Uint32(0) // flags
+	_, err := c.Call(ctx, ProcDomainManagedSave, args.Bytes())
+	return err
+}
+
+// DomainHasManagedSaveImage reports whether the domain has a managed save image.
+func (c *Conn) DomainHasManagedSaveImage(ctx context.Context, dom Domain) (bool, error) {
+	var args Encoder
+	args.Domain(dom)
+	args.Uint32(0) // flags
+	reply, err := c.Call(ctx, ProcDomainHasManagedSaveImage, args.Bytes())
+	if err != nil {
+		return false, err
+	}
+	d := NewDecoder(reply)
+	result := d.Int32()
+	return result != 0, d.Err()
+}
+
+// DomainGetState returns the domain's state and the reason for it.
+func (c *Conn) DomainGetState(ctx context.Context, dom Domain) (state DomainState, reason int32, err error) {
+	var args Encoder
+	args.Domain(dom)
+	args.Uint32(0) // flags
+	reply, err := c.Call(ctx, ProcDomainGetState, args.Bytes())
+	if err != nil {
+		return DomainNoState, 0, err
+	}
+	d := NewDecoder(reply)
+	state = DomainState(d.Int32())
+	reason = d.Int32()
+	return state, reason, d.Err()
+}
+
+func (c *Conn) domainCall(ctx context.Context, proc Procedure, dom Domain) error {
+	var args Encoder
+	args.Domain(dom)
+	_, err := c.Call(ctx, proc, args.Bytes())
+	return err
+}
+
+// IsErrorCode reports whether err is an *Error with the given code.
+func IsErrorCode(err error, code int32) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Code == code
+}
+
+// Closed reports whether the connection has been closed, e.g. after an I/O error.
+func (c *Conn) Closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// Close closes the hypervisor connection and the socket.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, _ = c.Call(ctx, ProcConnectClose, nil)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeLocked()
+}
+
+func (c *Conn) closeLocked() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.conn.Close()
+}
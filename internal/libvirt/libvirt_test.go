@@ -0,0 +1,93 @@
+package libvirt_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/yusing/godoxy/internal/libvirt"
+	"github.com/yusing/godoxy/internal/libvirt/libvirttest"
+	expect "github.com/yusing/goutils/testing"
+)
+
+func TestPacketRoundTrip(t *testing.T) {
+	var body libvirt.Encoder
+	body.Domain(libvirt.Domain{Name: "win11", UUID: [16]byte{1, 2, 3}, ID: -1})
+	uri := "qemu:///system"
+	body.OptStr(&uri)
+	body.OptStr(nil)
+	body.Uint32(7)
+
+	p := &libvirt.Packet{
+		Header: libvirt.Header{
+			Program:   libvirt.Program,
+			Version:   libvirt.ProgramVersion,
+			Procedure: libvirt.ProcDomainGetState,
+			Type:      libvirt.TypeCall,
+			Serial:    3,
+		},
+		Body: body.Bytes(),
+	}
+	got := expect.Must(libvirt.ReadPacket(bytes.NewReader(p.Encode())))
+	expect.Equal(t, got.Header, p.Header)
+
+	d := libvirt.NewDecoder(got.Body)
+	expect.Equal(t, d.Domain(), libvirt.Domain{Name: "win11", UUID: [16]byte{1, 2, 3}, ID: -1})
+	expect.Equal(t, *d.OptStr(), uri)
+	expect.True(t, d.OptStr() == nil)
+	expect.Equal(t, d.Uint32(), uint32(7))
+	expect.NoError(t, d.Err())
+
+	d.Uint32()
+	expect.ErrorIs(t, libvirt.ErrInvalidMessage, d.Err())
+}
+
+func TestReadPacketInvalidLength(t *testing.T) {
+	_, err := libvirt.ReadPacket(bytes.NewReader([]byte{0, 0, 0, 8, 0, 0, 0, 0}))
+	expect.ErrorIs(t, libvirt.ErrInvalidMessage, err)
+}
+
+func TestConn(t *testing.T) {
+	srv := libvirttest.NewServer(t, libvirttest.Domain{Name: "win11", State: libvirt.DomainShutoff})
+	ctx := t.Context()
+
+	conn := expect.Must(libvirt.Dial(ctx, srv.Socket, ""))
+	defer conn.Close()
+
+	dom, err := conn.LookupDomain(ctx, "win11")
+	expect.NoError(t, err)
+	expect.Equal(t, dom.Name, "win11")
+	expect.Equal(t, dom.ID, int32(-1))
+
+	_, err = conn.LookupDomain(ctx, "missing")
+	expect.True(t, libvirt.IsErrorCode(err, libvirt.ErrCodeNoDomain))
+
+	expect.NoError(t, conn.DomainCreate(ctx, dom))
+	state, _, err := conn.DomainGetState(ctx, dom)
+	expect.NoError(t, err)
+	expect.Equal(t, state, libvirt.DomainRunning)
+
+	err = conn.DomainCreate(ctx, dom)
+	expect.True(t, libvirt.IsErrorCode(err, libvirt.ErrCodeOperationInvalid))
+	expect.Equal(t, err.Error(), "libvirt: Requested operation is not valid: domain is already running")
+
+	expect.NoError(t, conn.DomainManagedSave(ctx, dom))
+	expect.True(t, expect.Must(conn.DomainHasManagedSaveImage(ctx, dom)))
+	state, _, _ = conn.DomainGetState(ctx, dom)
+	expect.Equal(t, state, libvirt.DomainShutoff)
+
+	expect.Equal(t, srv.Calls(), []libvirt.Procedure{
+		libvirt.ProcDomainLookupByName,
+		libvirt.ProcDomainLookupByName,
+		libvirt.ProcDomainCreate,
+		libvirt.ProcDomainGetState,
+		libvirt.ProcDomainCreate,
+		libvirt.ProcDomainManagedSave,
+		libvirt.ProcDomainHasManagedSaveImage,
+		libvirt.ProcDomainGetState,
+	})
+
+	expect.NoError(t, conn.Close())
+	expect.True(t, conn.Closed())
+	_, _, err = conn.DomainGetState(ctx, dom)
+	expect.HasError(t, err)
+}
@@ -0,0 +1,219 @@
+// Package libvirttest provides an in-process fake libvirt daemon for tests.
+package libvirttest
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/yusing/godoxy/internal/libvirt"
+)
+
+// Domain is the initial state of a fake domain.
+type Domain struct {
+	Name        string
+	State       libvirt.DomainState
+	ManagedSave bool // has a managed save image
+}
+
+type Server struct {
+	// Socket is the socket path to pass to libvirt.Dial.
+	Socket string
+
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu             sync.Mutex
+	domains        map[string]*Domain
+	ids            map[string]int32
+	calls          []libvirt.Procedure
+	ignoreShutdown bool
+}
+
+// NewServer starts a fake daemon on a unix socket in a temporary directory.
+func NewServer(t testing.TB, domains ...Domain) *Server {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "libvirt-sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Socket: path, ln: ln, domains: make(map[string]*Domain), ids: make(map[string]int32)}
+	for i := range domains {
+		s.domains[domains[i].Name] = &domains[i]
+		s.ids[domains[i].Name] = int32(i + 1)
+	}
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// State returns the current state of a domain.
+func (s *Server) State(name string) Domain {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.domains[name]
+}
+
+// SetState changes the state of a domain, e.g. to simulate a guest shutting itself down.
+func (s *Server) SetState(name string, state libvirt.DomainState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.domains[name].State = state
+}
+
+// IgnoreShutdown makes DomainShutdown succeed without stopping the domain, like a guest without ACPI support.
+func (s *Server) IgnoreShutdown(ignore bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ignoreShutdown = ignore
+}
+
+// Calls returns the called procedures in order, excluding ConnectOpen and ConnectClose.
+func (s *Server) Calls() []libvirt.Procedure {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]libvirt.Procedure(nil), s.calls...)
+}
+
+func (s *Server) Close() {
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	opened := false
+	for {
+		call, err := libvirt.ReadPacket(br)
+		if err != nil {
+			return
+		}
+		reply := &libvirt.Packet{Header: call.Header}
+		reply.Type = libvirt.TypeReply
+
+		var body []byte
+		var rErr *libvirt.Error
+		switch {
+		case call.Program != libvirt.Program || call.Type != libvirt.TypeCall:
+			rErr = &libvirt.Error{Code: 1, Message: "unexpected message"}
+		case call.Procedure == libvirt.ProcConnectOpen:
+			opened = true
+		case call.Procedure == libvirt.ProcConnectClose:
+			opened = false
+		case !opened:
+			rErr = &libvirt.Error{Code: 1, Message: "connection not open"}
+		default:
+			body, rErr = s.call(call.Procedure, libvirt.NewDecoder(call.Body))
+		}
+		if rErr != nil {
+			reply.Status = libvirt.StatusError
+			body = libvirt.EncodeError(rErr)
+		}
+		reply.Body = body
+		// send an event first, the client must skip it
+		if call.Procedure == libvirt.ProcDomainCreate {
+			event := &libvirt.Packet{Header: libvirt.Header{
+				Program: libvirt.Program, Version: libvirt.ProgramVersion,
+				Procedure: 318, Type: libvirt.TypeMessage,
+			}}
+			if _, err := conn.Write(event.Encode()); err != nil {
+				return
+			}
+		}
+		if _, err := conn.Write(reply.Encode()); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) call(proc libvirt.Procedure, d *libvirt.Decoder) ([]byte, *libvirt.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, proc)
+
+	var name string
+	if proc == libvirt.ProcDomainLookupByName {
+		name = d.Str()
+	} else {
+		name = d.Domain().Name
+	}
+	if d.Err() != nil {
+		return nil, &libvirt.Error{Code: 1, Message: d.Err().Error()}
+	}
+	dom, ok := s.domains[name]
+	if !ok {
+		return nil, &libvirt.Error{Code: libvirt.ErrCodeNoDomain, Domain: 10, Message: "Domain not found: no domain with matching name '" + name + "'"}
+	}
+	notRunning := &libvirt.Error{Code: libvirt.ErrCodeOperationInvalid, Domain: 10, Message: "Requested operation is not valid: domain is not running"}
+
+	var out libvirt.Encoder
+	switch proc {
+	case libvirt.ProcDomainLookupByName:
+		ref := libvirt.Domain{Name: name, ID: -1}
+		copy(ref.UUID[:], name)
+		if dom.State != libvirt.DomainShutoff {
+			ref.ID = s.ids[name]
+		}
+		out.Domain(ref)
+	case libvirt.ProcDomainGetState:
+		out.Int32(int32(dom.State))
+		out.Int32(0)
+	case libvirt.ProcDomainHasManagedSaveImage:
+		if dom.ManagedSave {
+			out.Int32(1)
+		} else {
+			out.Int32(0)
+		}
+	case libvirt.ProcDomainCreate:
+		if dom.State != libvirt.DomainShutoff {
+			return nil, &libvirt.Error{Code: libvirt.ErrCodeOperationInvalid, Domain: 10, Message: "Requested operation is not valid: domain is already running"}
+		}
+		dom.State, dom.ManagedSave = libvirt.DomainRunning, false
+	case libvirt.ProcDomainShutdown:
+		if dom.State != libvirt.DomainRunning {
+			return nil, notRunning
+		}
+		if !s.ignoreShutdown {
+			dom.State = libvirt.DomainShutoff
+		}
+	case libvirt.ProcDomainDestroy:
+		if dom.State == libvirt.DomainShutoff {
+			return nil, notRunning
+		}
+		dom.State = libvirt.DomainShutoff
+	case libvirt.ProcDomainSuspend:
+		if dom.State != libvirt.DomainRunning {
+			return nil, notRunning
+		}
+		dom.State = libvirt.DomainPaused
+	case libvirt.ProcDomainResume:
+		if dom.State != libvirt.DomainPaused {
+			return nil, &libvirt.Error{Code: libvirt.ErrCodeOperationInvalid, Domain: 10, Message: "Requested operation is not valid: domain is not paused"}
+		}
+		dom.State = libvirt.DomainRunning
+	case libvirt.ProcDomainManagedSave:
+		if dom.State != libvirt.DomainRunning && dom.State != libvirt.DomainPaused {
+			return nil, notRunning
+		}
+		dom.State, dom.ManagedSave = libvirt.DomainShutoff, true
+	default:
+		return nil, &libvirt.Error{Code: 1, Message: "unsupported procedure " + proc.String()}
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,147 @@
+package libvirt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidMessage is returned when a message cannot be decoded.
+var ErrInvalidMessage = errors.New("libvirt: invalid message")
+
+// maxStringLength bounds decoded strings (REMOTE_STRING_MAX).
+const maxStringLength = 4 << 20
+
+// Encoder writes XDR (RFC 4506) values.
+type Encoder struct {
+	buf []byte
+}
+
+// Bytes returns the encoded data.
+func (e *Encoder) Bytes() []byte {
+	return e.buf
+}
+
+func (e *Encoder) Uint32(v uint32) {
+	e.buf = binary.BigEndian.AppendUint32(e.buf, v)
+}
+
+func (e *Encoder) Int32(v int32) {
+	e.Uint32(uint32(v))
+}
+
+func (e *Encoder) Fixed(b []byte) {
+	e.buf = append(e.buf, b...)
+	e.pad(len(b))
+}
+
+func (e *Encoder) Str(s string) {
+	e.Uint32(uint32(len(s)))
+	e.buf = append(e.buf, s...)
+	e.pad(len(s))
+}
+
+// OptStr writes a remote_string, a pointer to a string that may be NULL.
+func (e *Encoder) OptStr(s *string) {
+	if s == nil {
+		e.Uint32(0)
+		return
+	}
+	e.Uint32(1)
+	e.Str(*s)
+}
+
+func (e *Encoder) Domain(d Domain) {
+	e.Str(d.Name)
+	e.Fixed(d.UUID[:])
+	e.Int32(d.ID)
+}
+
+func (e *Encoder) pad(n int) {
+	for n%4 != 0 {
+		e.buf = append(e.buf, 0)
+		n++
+	}
+}
+
+// Decoder reads XDR values, the first error is kept and later reads return zero values.
+type Decoder struct {
+	buf []byte
+	err error
+}
+
+func NewDecoder(b []byte) *Decoder {
+	return &Decoder{buf: b}
+}
+
+// Err returns the first decoding error.
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+func (d *Decoder) fail(what string) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: short %s", ErrInvalidMessage, what)
+	}
+}
+
+func (d *Decoder) next(n int, what string) []byte {
+	if d.err != nil {
+		return nil
+	}
+	padded := (n + 3) &^ 3
+	if n < 0 || padded > len(d.buf) {
+		d.fail(what)
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[padded:]
+	return b
+}
+
+func (d *Decoder) Uint32() uint32 {
+	b := d.next(4, "uint32")
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (d *Decoder) Int32() int32 {
+	return int32(d.Uint32())
+}
+
+func (d *Decoder) Fixed(dst []byte) {
+	copy(dst, d.next(len(dst), "opaque"))
+}
+
+func (d *Decoder) Str() string {
+	n := d.Uint32()
+	if n > maxStringLength {
+		d.fail("string")
+		return ""
+	}
+	return string(d.next(int(n), "string"))
+}
+
+func (d *Decoder) OptStr() *string {
+	switch d.Uint32() {
+	case 0:
+		return nil
+	case 1:
+		s := d.Str()
+		return &s
+	}
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: invalid optional flag", ErrInvalidMessage)
+	}
+	return nil
+}
+
+func (d *Decoder) Domain() Domain {
+	var dom Domain
+	dom.Name = d.Str()
+	d.Fixed(dom.UUID[:])
+	dom.ID = d.Int32()
+	return dom
+}
@@ -0,0 +1,108 @@
+package accesslog
+
+import (
+	"bytes"
+	"context"
+	"iter"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+type annotationsKey struct{}
+
+// annotations holds the per request state of the middlewares,
+// installed once by WithAnnotations before the request is passed to the access loggers and handlers.
+type annotations struct {
+	mu     sync.Mutex
+	fields map[string]string // logged
+	shared map[any]any       // not logged, e.g. the CSP nonce
+}
+
+// WithAnnotations returns the request with an annotation holder, r itself if it already has one.
+//
+// It is called once per request by the entrypoint, so the fields annotated
+// later by the middlewares are logged by every logger holding the request.
+func WithAnnotations(r *http.Request) *http.Request {
+	if getAnnotations(r) != nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), annotationsKey{}, &annotations{}))
+}
+
+func getAnnotations(r *http.Request) *annotations {
+	a, _ := r.Context().Value(annotationsKey{}).(*annotations)
+	return a
+}
+
+// Annotate adds a field to the request log, e.g. the WAF rules matched by the request.
+// It does nothing if the request has no annotation holder.
+func Annotate(r *http.Request, key, value string) {
+	a := getAnnotations(r)
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.fields == nil {
+		a.fields = make(map[string]string)
+	}
+	a.fields[key] = value
+}
+
+// Annotations returns the annotated fields of the request sorted by key.
+func Annotations(r *http.Request) iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		a := getAnnotations(r)
+		if a == nil {
+			return
+		}
+		a.mu.Lock()
+		fields := maps.Clone(a.fields)
+		a.mu.Unlock()
+		for _, key := range slices.Sorted(maps.Keys(fields)) {
+			if !yield(key, fields[key]) {
+				return
+			}
+		}
+	}
+}
+
+// SetShared sets a value shared by the middlewares handling the request, it is not logged.
+// It returns false if the request has no annotation holder.
+func SetShared(r *http.Request, key, value any) bool {
+	a := getAnnotations(r)
+	if a == nil {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.shared == nil {
+		a.shared = make(map[any]any)
+	}
+	a.shared[key] = value
+	return true
+}
+
+// Shared returns a value set by SetShared, nil if not set.
+func Shared(r *http.Request, key any) any {
+	a := getAnnotations(r)
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.shared[key]
+}
+
+// appendAnnotations appends the annotated fields as key="value" pairs.
+func appendAnnotations(line *bytes.Buffer, req *http.Request) {
+	for key, value := range Annotations(req) {
+		line.WriteByte(' ')
+		line.WriteString(key)
+		line.WriteByte('=')
+		line.WriteString(strconv.Quote(value))
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -97,6 +98,34 @@ func TestAccessLoggerRedactQuery(t *testing.T) {
 	)
 }
 
+func TestAccessLoggerAnnotations(t *testing.T) {
+	Annotate(req, "waf_action", "ignored") // no annotation holder
+
+	annotated := WithAnnotations(req.Clone(t.Context()))
+	expect.Equal(t, WithAnnotations(annotated), annotated)
+	Annotate(annotated, "waf_rules", "942100,949110")
+	Annotate(annotated, "waf_action", "block")
+	expect.True(t, SetShared(annotated, "nonce", "abc"))
+	expect.Equal(t, Shared(annotated, "nonce"), any("abc"))
+
+	config := DefaultRequestLoggerConfig()
+	config.Format = FormatCombined
+	logger := NewMockAccessLogger(testTask, config)
+	var buf bytes.Buffer
+	logger.(RequestFormatter).AppendRequestLog(&buf, annotated, resp)
+	expect.True(t, strings.HasSuffix(buf.String(), fmt.Sprintf(`"%s" "%s" waf_action="block" waf_rules="942100,949110"`, referer, ua)))
+
+	config = DefaultRequestLoggerConfig()
+	config.Format = FormatJSON
+	logger = NewMockAccessLogger(testTask, config)
+	buf.Reset()
+	logger.(RequestFormatter).AppendRequestLog(&buf, annotated, resp)
+	var entry map[string]any
+	expect.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	expect.Equal(t, entry["waf_rules"], any("942100,949110"))
+	expect.Equal(t, entry["waf_action"], any("block"))
+}
+
 type JSONLogEntry struct {
 	Time        string              `json:"time"`
 	IP          string              `json:"ip"`
@@ -63,6 +63,11 @@ func clientIP(req *http.Request) string {
 }
 
 func (f CommonFormatter) AppendRequestLog(line *bytes.Buffer, req *http.Request, res *http.Response) {
+	f.appendCommonLog(line, req, res)
+	appendAnnotations(line, req)
+}
+
+func (f CommonFormatter) appendCommonLog(line *bytes.Buffer, req *http.Request, res *http.Response) {
 	query := f.cfg.Query.IterQuery(req.URL.Query())
 
 	line.WriteString(req.Host)
@@ -88,12 +93,13 @@ func (f CommonFormatter) AppendRequestLog(line *bytes.Buffer, req *http.Request,
 }
 
 func (f CombinedFormatter) AppendRequestLog(line *bytes.Buffer, req *http.Request, res *http.Response) {
-	f.CommonFormatter.AppendRequestLog(line, req, res)
+	f.appendCommonLog(line, req, res)
 	line.WriteString(" \"")
 	line.WriteString(req.Referer())
 	line.WriteString("\" \"")
 	line.WriteString(req.UserAgent())
 	line.WriteByte('"')
+	appendAnnotations(line, req)
 }
 
 func (f JSONFormatter) AppendRequestLog(line *bytes.Buffer, req *http.Request, res *http.Response) {
@@ -123,6 +129,9 @@ func (f JSONFormatter) LogRequestZeroLog(logger *zerolog.Logger, req *http.Reque
 		Object("query", query).
 		Object("headers", headers).
 		Object("cookies", cookies)
+	for key, value := range Annotations(req) {
+		event.Str(key, value)
+	}
 
 	// NOTE: zerolog will append a newline to the buffer
 	event.Send()
@@ -140,6 +149,9 @@ func (f ConsoleFormatter) LogRequestZeroLog(logger *zerolog.Logger, req *http.Re
 		Str("type", contentType).
 		Int64("size", res.ContentLength).
 		Str("useragent", req.UserAgent())
+	for key, value := range Annotations(req) {
+		event.Str(key, value)
+	}
 
 	// NOTE: zerolog will append a newline to the buffer
 	event.Msgf("[%d] %s %s://%s from %s", res.StatusCode, req.Method, scheme(req), req.Host, clientIP(req))
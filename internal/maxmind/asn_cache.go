@@ -0,0 +1,36 @@
+package maxmind
+
+import (
+	"github.com/puzpuzpuz/xsync/v4"
+)
+
+var asnCache = xsync.NewMap[string, *ASN]()
+
+func (cfg *MaxMind) lookupASN(ip *IPInfo) (*ASN, bool) {
+	if ip.ASN != nil {
+		return ip.ASN, true
+	}
+
+	if cfg.db.Reader == nil {
+		return nil, false
+	}
+
+	asn, ok := asnCache.Load(ip.Str)
+	if ok {
+		ip.ASN = asn
+		return asn, true
+	}
+
+	cfg.db.RLock()
+	defer cfg.db.RUnlock()
+
+	asn = new(ASN)
+	err := cfg.db.Lookup(ip.IP, asn)
+	if err != nil {
+		return nil, false
+	}
+
+	asnCache.Store(ip.Str, asn)
+	ip.ASN = asn
+	return asn, true
+}
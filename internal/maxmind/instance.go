@@ -5,12 +5,16 @@ import (
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	maxmind "github.com/yusing/godoxy/internal/maxmind/types"
 	"github.com/yusing/godoxy/internal/notif"
 	gperr "github.com/yusing/goutils/errs"
 	"github.com/yusing/goutils/task"
 )
 
-var instance *MaxMind
+var (
+	instance    *MaxMind
+	asnInstance *MaxMind
+)
 
 var warnOnce sync.Once
 
@@ -30,6 +34,17 @@ func SetInstance(parent task.Parent, cfg *Config) gperr.Error {
 		return err
 	}
 	instance = newInstance
+
+	asnInstance = nil
+	if cfg.ASN {
+		asnCfg := *cfg
+		asnCfg.Database = maxmind.MaxMindGeoLiteASN
+		newASNInstance := &MaxMind{Config: &asnCfg}
+		if err := newASNInstance.LoadMaxMindDB(parent); err != nil {
+			return err
+		}
+		asnInstance = newASNInstance
+	}
 	return nil
 }
 
@@ -44,3 +59,12 @@ func LookupCity(ip *IPInfo) (*City, bool) {
 	}
 	return instance.lookupCity(ip)
 }
+
+// LookupASN returns the autonomous system of an IP, it needs `asn: true` in the config.
+func LookupASN(ip *IPInfo) (*ASN, bool) {
+	if asnInstance == nil {
+		warnOnce.Do(warnNotConfigured)
+		return nil, false
+	}
+	return asnInstance.lookupASN(ip)
+}
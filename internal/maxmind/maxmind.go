@@ -23,6 +23,8 @@ import (
 /*
 refactor(maxmind): switch to Country database
 
+The City database is opt-in with `city: true`.
+
 - In compliance with [Title 28 of the Code of Federal Regulations of the United States of America Part 202](https://www.ecfr.gov/current/title-28/chapter-I/part-202), non US IPs are blocked from downloading the City database
 */
 
@@ -40,6 +42,7 @@ type (
 	Config = maxmind.Config
 	IPInfo = maxmind.IPInfo
 	City   = maxmind.City
+	ASN    = maxmind.ASN
 )
 
 const (
@@ -60,18 +63,27 @@ func (cfg *MaxMind) dbPath() string {
 	return filepath.Join(dataDir, cfg.dbFilename())
 }
 
-func (cfg *MaxMind) dbURL() string {
+// edition returns the MaxMind edition ID of the database, e.g. GeoLite2-Country.
+func (cfg *MaxMind) edition() string {
+	if cfg.Database == maxmind.MaxMindGeoLiteASN {
+		return "GeoLite2-ASN"
+	}
+	product := "GeoIP2"
 	if cfg.Database == maxmind.MaxMindGeoLite {
-		return "https://download.maxmind.com/geoip/databases/GeoLite2-Country/download?suffix=tar.gz"
+		product = "GeoLite2"
 	}
-	return "https://download.maxmind.com/geoip/databases/GeoIP2-Country/download?suffix=tar.gz"
+	if cfg.City {
+		return product + "-City"
+	}
+	return product + "-Country"
+}
+
+func (cfg *MaxMind) dbURL() string {
+	return "https://download.maxmind.com/geoip/databases/" + cfg.edition() + "/download?suffix=tar.gz"
 }
 
 func (cfg *MaxMind) dbFilename() string {
-	if cfg.Database == maxmind.MaxMindGeoLite {
-		return "GeoLite2-Country.mmdb"
-	}
-	return "GeoIP2-Country.mmdb"
+	return cfg.edition() + ".mmdb"
 }
 
 func (cfg *MaxMind) LoadMaxMindDB(parent task.Parent) gperr.Error {
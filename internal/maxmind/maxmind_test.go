@@ -124,3 +124,26 @@ func Test_MaxMindConfig_loadMaxMindDB(t *testing.T) {
 		t.Error("expected db instance")
 	}
 }
+
+func Test_MaxMindConfig_edition(t *testing.T) {
+	tests := []struct {
+		database maxmind.DatabaseType
+		city     bool
+		want     string
+	}{
+		{maxmind.MaxMindGeoLite, false, "GeoLite2-Country"},
+		{maxmind.MaxMindGeoLite, true, "GeoLite2-City"},
+		{maxmind.MaxMindGeoIP2, false, "GeoIP2-Country"},
+		{maxmind.MaxMindGeoIP2, true, "GeoIP2-City"},
+		{maxmind.MaxMindGeoLiteASN, true, "GeoLite2-ASN"},
+	}
+	for _, tt := range tests {
+		cfg := &MaxMind{Config: &Config{Database: tt.database, City: tt.city}}
+		if got := cfg.dbFilename(); got != tt.want+".mmdb" {
+			t.Errorf("dbFilename() = %s, want %s.mmdb", got, tt.want)
+		}
+		if got := cfg.dbURL(); got != "https://download.maxmind.com/geoip/databases/"+tt.want+"/download?suffix=tar.gz" {
+			t.Errorf("dbURL() = %s", got)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package maxmind
 
 type City struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"` // City database only
 	Location struct {
 		TimeZone string `maxminddb:"time_zone"`
 	} `maxminddb:"location"`
@@ -8,3 +11,8 @@ type City struct {
 		IsoCode string `maxminddb:"iso_code"`
 	} `maxminddb:"country"`
 }
+
+// Name returns the English name of the city, empty with the Country database.
+func (c *City) Name() string {
+	return c.City.Names["en"]
+}
@@ -13,12 +13,17 @@ type (
 		AccountID  string            `json:"account_id" validate:"required"`
 		LicenseKey strutils.Redacted `json:"license_key" validate:"required"`
 		Database   DatabaseType      `json:"database" validate:"omitempty,oneof=geolite geoip2"`
+		City       bool              `json:"city"` // use the City database instead of the Country database, it has city names
+		ASN        bool              `json:"asn"`  // also load the GeoLite2 ASN database
 	}
 )
 
 const (
 	MaxMindGeoLite DatabaseType = "geolite"
 	MaxMindGeoIP2  DatabaseType = "geoip2"
+
+	// MaxMindGeoLiteASN is the database of the ASN instance, it is not a valid config value.
+	MaxMindGeoLiteASN DatabaseType = "geolite_asn"
 )
 
 func (cfg *Config) Validate() gperr.Error {
@@ -77,9 +77,13 @@ func getEnforcedPathPrefixes(modReq RequestModifier, modRes ResponseModifier) []
 	if modReq == nil && modRes == nil {
 		return nil
 	}
-	switch modReq.(type) {
+	switch m := modReq.(type) {
 	case *oidcMiddleware:
 		return []string{auth.OIDCAuthBasePath}
+	case *secureHeaders:
+		if m.Report {
+			return []string{SecurityReportPath}
+		}
 	}
 	return nil
 }
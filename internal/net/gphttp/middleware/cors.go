@@ -0,0 +1,320 @@
+package middleware
+
+import (
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	gperr "github.com/yusing/goutils/errs"
+)
+
+type (
+	corsMiddleware struct {
+		CORSOpts
+
+		allowAllOrigins bool
+		origins         []string // exact origins, lower case
+		wildcards       []string // wildcard origins, e.g. "https://*.example.com"
+		regexes         []*regexp.Regexp
+
+		allowAllMethods bool
+		allowAllHeaders bool
+		allowedHeaders  []string // canonical header keys
+
+		methods       string
+		headers       string
+		exposeHeaders string
+		maxAge        string
+	}
+
+	CORSOpts struct {
+		// exact origin "https://app.example.com", wildcard subdomain "https://*.example.com",
+		// regex "regex(^https://app-[0-9]+\.example\.com$)" or "*"; origins without scheme match any scheme.
+		// Regexes must be anchored with ^ and $, otherwise e.g. "https://app.example.com.evil.com" would match.
+		// "*" and origins without scheme cannot be used with AllowCredentials.
+		AllowOrigins     []string      `json:"allow_origins" validate:"min=1"`
+		AllowMethods     []string      `json:"allow_methods"`     // default: GET, HEAD, POST
+		AllowHeaders     []string      `json:"allow_headers"`     // default: the requested headers
+		ExposeHeaders    []string      `json:"expose_headers"`    // default: none
+		AllowCredentials bool          `json:"allow_credentials"` // default: false
+		MaxAge           time.Duration `json:"max_age"`           // preflight cache duration, default: not set
+	}
+)
+
+var (
+	CORS = NewMiddleware[corsMiddleware]()
+	// a plain http origin could be a network attacker, credentialed responses must only be readable by the exact scheme.
+	errCORSOriginScheme = gperr.New("origin must have a scheme with allow_credentials, e.g. https://app.example.com")
+	corsOptsDefault     = CORSOpts{
+		AllowMethods: []string{http.MethodGet, http.MethodHead, http.MethodPost},
+	}
+)
+
+const (
+	headerOrigin                        = "Origin"
+	headerAccessControlRequestMethod    = "Access-Control-Request-Method"
+	headerAccessControlRequestHeaders   = "Access-Control-Request-Headers"
+	headerAccessControlAllowOrigin      = "Access-Control-Allow-Origin"
+	headerAccessControlAllowMethods     = "Access-Control-Allow-Methods"
+	headerAccessControlAllowHeaders     = "Access-Control-Allow-Headers"
+	headerAccessControlAllowCredentials = "Access-Control-Allow-Credentials"
+	headerAccessControlExposeHeaders    = "Access-Control-Expose-Headers"
+	headerAccessControlMaxAge           = "Access-Control-Max-Age"
+)
+
+// corsResponseHeaders are the CORS headers of non-preflight responses.
+var corsResponseHeaders = []string{
+	headerAccessControlAllowOrigin,
+	headerAccessControlAllowMethods,
+	headerAccessControlAllowHeaders,
+	headerAccessControlAllowCredentials,
+	headerAccessControlExposeHeaders,
+}
+
+// setup implements MiddlewareWithSetup.
+func (m *corsMiddleware) setup() {
+	m.CORSOpts = corsOptsDefault
+	m.AllowMethods = slices.Clone(corsOptsDefault.AllowMethods)
+}
+
+// finalize implements MiddlewareFinalizerWithError.
+func (m *corsMiddleware) finalize() error {
+	if len(m.AllowOrigins) == 0 {
+		return gperr.New("allow_origins is required")
+	}
+	var errs gperr.Builder
+	for _, origin := range m.AllowOrigins {
+		origin = strings.TrimSpace(origin)
+		switch {
+		case origin == "*":
+			m.allowAllOrigins = true
+		case strings.HasPrefix(origin, "regex(") && strings.HasSuffix(origin, ")"):
+			expr := origin[len("regex(") : len(origin)-1]
+			if !strings.HasPrefix(expr, "^") || !strings.HasSuffix(expr, "$") {
+				errs.Add(gperr.New("regex must be anchored with ^ and $").Subject(origin))
+				continue
+			}
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				errs.Add(gperr.PrependSubject(origin, err))
+				continue
+			}
+			m.regexes = append(m.regexes, re)
+		case strings.Contains(origin, "*"):
+			scheme, host := splitOrigin(strings.ToLower(origin))
+			suffix, ok := strings.CutPrefix(host, "*")
+			if !ok || !strings.HasPrefix(suffix, ".") || strings.Contains(suffix, "*") {
+				errs.Add(gperr.New("wildcard must be the leftmost label, e.g. https://*.example.com").Subject(origin))
+				continue
+			}
+			if scheme == "" && m.AllowCredentials {
+				errs.Add(errCORSOriginScheme.Subject(origin))
+				continue
+			}
+			m.wildcards = append(m.wildcards, scheme+"*"+suffix)
+		default:
+			if !strings.Contains(origin, "://") && m.AllowCredentials {
+				errs.Add(errCORSOriginScheme.Subject(origin))
+				continue
+			}
+			m.origins = append(m.origins, strings.ToLower(strings.TrimSuffix(origin, "/")))
+		}
+	}
+	if m.allowAllOrigins && m.AllowCredentials {
+		// any site could make credentialed requests and read the responses
+		errs.Add(gperr.New(`allow_origins "*" cannot be used with allow_credentials, list the origins instead`))
+	}
+	if m.MaxAge < 0 {
+		errs.Add(gperr.New("max_age must not be negative"))
+	}
+	if errs.HasError() {
+		return errs.Error()
+	}
+
+	for i, method := range m.AllowMethods {
+		if method == "*" {
+			m.allowAllMethods = true
+		}
+		m.AllowMethods[i] = strings.ToUpper(strings.TrimSpace(method))
+	}
+	for _, header := range m.AllowHeaders {
+		if header == "*" {
+			m.allowAllHeaders = true
+		}
+		m.allowedHeaders = append(m.allowedHeaders, http.CanonicalHeaderKey(strings.TrimSpace(header)))
+	}
+	m.methods = strings.Join(m.AllowMethods, ", ")
+	m.headers = strings.Join(m.allowedHeaders, ", ")
+	m.exposeHeaders = strings.Join(m.ExposeHeaders, ", ")
+	if m.MaxAge > 0 {
+		m.maxAge = strconv.Itoa(int(m.MaxAge.Seconds()))
+	}
+	return nil
+}
+
+// before implements RequestModifier, it answers preflight requests without calling the upstream.
+func (m *corsMiddleware) before(w http.ResponseWriter, r *http.Request) (proceed bool) {
+	if r.Method != http.MethodOptions || r.Header.Get(headerOrigin) == "" || r.Header.Get(headerAccessControlRequestMethod) == "" {
+		return true
+	}
+	m.handlePreflight(w, r)
+	return false
+}
+
+// modifyResponse implements ResponseModifier.
+func (m *corsMiddleware) modifyResponse(resp *http.Response) error {
+	if m.dependsOnOrigin() {
+		addVary(resp.Header, headerOrigin)
+	}
+	origin := resp.Request.Header.Get(headerOrigin)
+	if origin == "" || !m.isOriginAllowed(origin) {
+		// the upstream must not grant access to origins the middleware does not allow
+		for _, key := range corsResponseHeaders {
+			resp.Header.Del(key)
+		}
+		return nil
+	}
+	// override the upstream CORS headers
+	resp.Header.Set(headerAccessControlAllowOrigin, m.allowOriginValue(origin))
+	if m.AllowCredentials {
+		resp.Header.Set(headerAccessControlAllowCredentials, "true")
+	} else {
+		resp.Header.Del(headerAccessControlAllowCredentials)
+	}
+	if m.exposeHeaders != "" {
+		resp.Header.Set(headerAccessControlExposeHeaders, m.exposeHeaders)
+	}
+	return nil
+}
+
+// handlePreflight writes 204 No Content, with CORS headers only if the origin, method and headers are allowed.
+func (m *corsMiddleware) handlePreflight(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+	addVary(header, headerOrigin, headerAccessControlRequestMethod, headerAccessControlRequestHeaders)
+	defer w.WriteHeader(http.StatusNoContent)
+
+	origin := r.Header.Get(headerOrigin)
+	if !m.isOriginAllowed(origin) {
+		return
+	}
+
+	method := strings.ToUpper(r.Header.Get(headerAccessControlRequestMethod))
+	if !m.allowAllMethods && !slices.Contains(m.AllowMethods, method) {
+		return
+	}
+
+	var requestedHeaders []string
+	for _, v := range r.Header.Values(headerAccessControlRequestHeaders) {
+		for h := range strings.SplitSeq(v, ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				requestedHeaders = append(requestedHeaders, http.CanonicalHeaderKey(h))
+			}
+		}
+	}
+	if len(m.allowedHeaders) > 0 && !m.allowAllHeaders {
+		for _, h := range requestedHeaders {
+			if !slices.Contains(m.allowedHeaders, h) {
+				return
+			}
+		}
+	}
+
+	header.Set(headerAccessControlAllowOrigin, m.allowOriginValue(origin))
+	if m.AllowCredentials {
+		header.Set(headerAccessControlAllowCredentials, "true")
+	}
+	// "*" is not a wildcard for credentialed requests, so the requested values are returned instead
+	switch {
+	case !m.allowAllMethods:
+		header.Set(headerAccessControlAllowMethods, m.methods)
+	case m.AllowCredentials:
+		header.Set(headerAccessControlAllowMethods, method)
+	default:
+		header.Set(headerAccessControlAllowMethods, "*")
+	}
+	switch {
+	case len(requestedHeaders) == 0:
+	case len(m.allowedHeaders) == 0, m.allowAllHeaders && m.AllowCredentials:
+		header.Set(headerAccessControlAllowHeaders, strings.Join(requestedHeaders, ", "))
+	case m.allowAllHeaders:
+		header.Set(headerAccessControlAllowHeaders, "*")
+	default:
+		header.Set(headerAccessControlAllowHeaders, m.headers)
+	}
+	if m.maxAge != "" {
+		header.Set(headerAccessControlMaxAge, m.maxAge)
+	}
+}
+
+// dependsOnOrigin returns whether the response headers vary by the Origin request header.
+func (m *corsMiddleware) dependsOnOrigin() bool {
+	return !m.allowAllOrigins
+}
+
+// allowOriginValue returns "*" if all origins are allowed, which is never with credentials.
+func (m *corsMiddleware) allowOriginValue(origin string) string {
+	if m.allowAllOrigins {
+		return "*"
+	}
+	return origin
+}
+
+func (m *corsMiddleware) isOriginAllowed(origin string) bool {
+	if m.allowAllOrigins {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	scheme, host := splitOrigin(origin)
+	for _, allowed := range m.origins {
+		if allowed == origin || (!strings.Contains(allowed, "://") && allowed == host) {
+			return true
+		}
+	}
+	for _, wildcard := range m.wildcards {
+		wildcardScheme, suffix, _ := strings.Cut(wildcard, "*")
+		if wildcardScheme != "" && wildcardScheme != scheme {
+			continue
+		}
+		// at least one label before the suffix, without port or path
+		if sub, ok := strings.CutSuffix(host, suffix); ok && sub != "" && !strings.ContainsAny(sub, ":/@") {
+			return true
+		}
+	}
+	for _, re := range m.regexes {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitOrigin splits an origin into the scheme with "://" and the host, the scheme is empty if not present.
+func splitOrigin(origin string) (scheme, host string) {
+	if i := strings.Index(origin, "://"); i != -1 {
+		return origin[:i+3], origin[i+3:]
+	}
+	return "", origin
+}
+
+// addVary adds values to the Vary header if not already present.
+func addVary(header http.Header, values ...string) {
+	existing := header.Values("Vary")
+	for _, value := range values {
+		found := false
+		for _, v := range existing {
+			for token := range strings.SplitSeq(v, ",") {
+				token = strings.TrimSpace(token)
+				if token == "*" || strings.EqualFold(token, value) {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			header.Add("Vary", value)
+		}
+	}
+}
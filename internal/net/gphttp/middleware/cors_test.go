@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+
+	expect "github.com/yusing/goutils/testing"
+)
+
+var corsTestOpts = OptionsRaw{
+	"allow_origins":     []string{"https://app.example.com", "https://*.example.org", `regex(^https://app-[0-9]+\.example\.net$)`},
+	"allow_methods":     []string{"GET", "POST", "PUT"},
+	"allow_headers":     []string{"Content-Type", "Authorization"},
+	"expose_headers":    []string{"X-Total-Count"},
+	"allow_credentials": true,
+	"max_age":           "10m",
+}
+
+func TestCORSValidation(t *testing.T) {
+	_, err := CORS.New(OptionsRaw{})
+	expect.HasError(t, err)
+	_, err = CORS.New(OptionsRaw{"allow_origins": []string{}})
+	expect.HasError(t, err)
+	_, err = CORS.New(OptionsRaw{"allow_origins": []string{"https://app.*.example.com"}})
+	expect.HasError(t, err)
+	_, err = CORS.New(OptionsRaw{"allow_origins": []string{"regex(^()$)"}})
+	expect.HasError(t, err)
+	_, err = CORS.New(OptionsRaw{"allow_origins": []string{"*"}, "allow_credentials": true})
+	expect.ErrorContains(t, err, "allow_credentials")
+	// an origin without scheme would allow http
+	for _, origin := range []string{"app.example.com", "*.example.com"} {
+		_, err = CORS.New(OptionsRaw{"allow_origins": []string{origin}, "allow_credentials": true})
+		expect.ErrorIs(t, errCORSOriginScheme, err)
+		_, err = CORS.New(OptionsRaw{"allow_origins": []string{origin}})
+		expect.NoError(t, err)
+	}
+	for _, re := range []string{`regex(https://app\.example\.com)`, `regex(^https://app\.example\.com)`, `regex(https://app\.example\.com$)`} {
+		_, err = CORS.New(OptionsRaw{"allow_origins": []string{re}})
+		expect.ErrorContains(t, err, "anchored")
+	}
+}
+
+func TestCORSOrigins(t *testing.T) {
+	mid, err := CORS.New(corsTestOpts)
+	expect.NoError(t, err)
+	cors := mid.impl.(*corsMiddleware)
+
+	tests := map[string]bool{
+		"https://app.example.com":       true,
+		"https://APP.example.com":       true,
+		"http://app.example.com":        false,
+		"https://api.example.org":       true,
+		"https://a.b.example.org":       true,
+		"https://example.org":           false,
+		"http://api.example.org":        false,
+		"https://evil.com/.example.org": false,
+		"https://app-12.example.net":    true,
+		"https://app-x.example.net":     false,
+	}
+	for origin, allowed := range tests {
+		t.Run(origin, func(t *testing.T) {
+			expect.Equal(t, cors.isOriginAllowed(origin), allowed)
+		})
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	mid, err := CORS.New(corsTestOpts)
+	expect.NoError(t, err)
+
+	t.Run("allowed", func(t *testing.T) {
+		result, err := newMiddlewareTest(mid, &testArgs{
+			reqMethod: http.MethodOptions,
+			headers: http.Header{
+				"Origin":                         {"https://api.example.org"},
+				"Access-Control-Request-Method":  {"PUT"},
+				"Access-Control-Request-Headers": {"content-type, authorization"},
+			},
+		})
+		expect.NoError(t, err)
+		expect.Equal(t, result.ResponseStatus, http.StatusNoContent)
+		expect.Equal(t, result.RequestHeaders, nil) // upstream not called
+		expect.Equal(t, result.ResponseHeaders.Get("Access-Control-Allow-Origin"), "https://api.example.org")
+		expect.Equal(t, result.ResponseHeaders.Get("Access-Control-Allow-Methods"), "GET, POST, PUT")
+		expect.Equal(t, result.ResponseHeaders.Get("Access-Control-Allow-Headers"), "Content-Type, Authorization")
+		expect.Equal(t, result.ResponseHeaders.Get("Access-Control-Allow-Credentials"), "true")
+		expect.Equal(t, result.ResponseHeaders.Get("Access-Control-Max-Age"), "600")
+		expect.Equal(t, result.ResponseHeaders.Values("Vary"), []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"})
+	})
+	t.Run("method not allowed", func(t *testing.T) {
+		result, err := newMiddlewareTest(mid, &testArgs{
+			reqMethod: http.MethodOptions,
+			headers: http.Header{
+				"Origin":                        {"https://app.example.com"},
+				"Access-Control-Request-Method": {"DELETE"},
+			},
+		})
+		expect.NoError(t, err)
+		expect.Equal(t, result.ResponseStatus, http.StatusNoContent)
+		expect.Equal(t, result.ResponseHeaders.Get("Access-Control-Allow-Origin"), "")
+	})
+	t.Run("header not allowed", func(t *testing.T) {
+		result, err := newMiddlewareTest(mid, &testArgs{
+			reqMethod: http.MethodOptions,
+			headers: http.Header{
+				"Origin":                         {"https://app.example.com"},
+				"Access-Control-Request-Method":  {"POST"},
+				"Access-Control-Request-Headers": {"X-Custom"},
+			},
+		})
+		expect.NoError(t, err)
+		expect.Equal(t, result.ResponseHeaders.Get("Access-Control-Allow-Origin"), "")
+	})
+	t.Run("not a preflight", func(t *testing.T) {
+		result, err := newMiddlewareTest(mid, &testArgs{
+			reqMethod: http.MethodOptions,
+		})
+		expect.NoError(t, err)
+		expect.Equal(t, result.ResponseStatus, http.StatusOK)
+		expect.NotNil(t, result.RequestHeaders)
+	})
+}
+
+func TestCORSResponse(t *testing.T) {
+	mid, err := CORS.New(corsTestOpts)
+	expect.NoError(t, err)
+
+	t.Run("allowed", func(t *testing.T) {
+		result, err := newMiddlewareTest(mid, &testArgs{
+			headers: http.Header{"Origin": {"https://app.example.com"}},
+			respHeaders: http.Header{
+				"Access-Control-Allow-Origin": {"*"},
+				"Vary":                        {"Accept-Encoding"},
+			},
+		})
+		expect.NoError(t, err)
+		expect.Equal(t, result.ResponseHeaders.Values("Access-Control-Allow-Origin"), []string{"https://app.example.com"})
+		expect.Equal(t, result.ResponseHeaders.Get("Access-Control-Allow-Credentials"), "true")
+		expect.Equal(t, result.ResponseHeaders.Get("Access-Control-Expose-Headers"), "X-Total-Count")
+		expect.Equal(t, result.ResponseHeaders.Values("Vary"), []string{"Accept-Encoding", "Origin"})
+	})
+	t.Run("not allowed", func(t *testing.T) {
+		result, err := newMiddlewareTest(mid, &testArgs{
+			headers: http.Header{"Origin": {"https://evil.com"}},
+			respHeaders: http.Header{
+				"Access-Control-Allow-Origin":      {"https://evil.com"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Access-Control-Allow-Methods":     {"DELETE"},
+				"Access-Control-Expose-Headers":    {"X-Secret"},
+			},
+		})
+		expect.NoError(t, err)
+		expect.Equal(t, result.ResponseStatus, http.StatusOK)
+		// the upstream CORS headers are removed
+		for _, key := range corsResponseHeaders {
+			expect.Equal(t, result.ResponseHeaders.Get(key), "")
+		}
+		expect.Equal(t, result.ResponseHeaders.Get("Vary"), "Origin")
+	})
+	t.Run("any origin", func(t *testing.T) {
+		mid, err := CORS.New(OptionsRaw{"allow_origins": []string{"*"}})
+		expect.NoError(t, err)
+		result, err := newMiddlewareTest(mid, &testArgs{
+			headers: http.Header{"Origin": {"https://evil.com"}},
+		})
+		expect.NoError(t, err)
+		expect.Equal(t, result.ResponseHeaders.Get("Access-Control-Allow-Origin"), "*")
+		expect.Equal(t, result.ResponseHeaders.Get("Vary"), "")
+	})
+}
@@ -20,6 +20,7 @@ var allMiddlewares = map[string]*Middleware{
 	"oidc":        OIDC,
 	"forwardauth": ForwardAuth,
 	"crowdsec":    Crowdsec,
+	"waf":         WAF,
 
 	"request":        ModifyRequest,
 	"modifyrequest":  ModifyRequest,
@@ -40,6 +41,9 @@ var allMiddlewares = map[string]*Middleware{
 	"cidrwhitelist": CIDRWhiteList,
 	"ratelimit":     RateLimiter,
 
+	"cors":          CORS,
+	"secureheaders": SecureHeaders,
+
 	"hcaptcha": HCaptcha,
 }
 
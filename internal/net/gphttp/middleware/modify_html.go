@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"io"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/rs/zerolog/log"
@@ -12,6 +14,7 @@ import (
 	ioutils "github.com/yusing/goutils/io"
 	"github.com/yusing/goutils/synk"
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 type modifyHTML struct {
@@ -86,12 +89,17 @@ func (m *modifyHTML) modifyResponse(resp *http.Response) error {
 		return nil
 	}
 
+	injected := m.HTML
+	if nonce := cspNonce(resp.Request); nonce != "" {
+		injected = withCSPNonce(injected, nonce)
+	}
+
 	if m.Replace {
 		// replace all matching elements
-		ele.ReplaceWithHtml(m.HTML)
+		ele.ReplaceWithHtml(injected)
 	} else {
 		// append to the first matching element
-		ele.First().AppendHtml(m.HTML)
+		ele.First().AppendHtml(injected)
 	}
 
 	pool := synk.GetUnsizedBytesPool()
@@ -119,6 +127,34 @@ func (m *modifyHTML) modifyResponse(resp *http.Response) error {
 	return nil
 }
 
+// withCSPNonce adds the nonce attribute to the script and style elements of the html fragment,
+// so they are allowed by the CSP of the secureheaders middleware.
+func withCSPNonce(fragment, nonce string) string {
+	context := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), context)
+	if err != nil {
+		return fragment
+	}
+	var setNonce func(n *html.Node)
+	setNonce = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.DataAtom == atom.Script || n.DataAtom == atom.Style) {
+			n.Attr = slices.DeleteFunc(n.Attr, func(attr html.Attribute) bool { return attr.Key == "nonce" })
+			n.Attr = append(n.Attr, html.Attribute{Key: "nonce", Val: nonce})
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			setNonce(c)
+		}
+	}
+	var buf strings.Builder
+	for _, n := range nodes {
+		setNonce(n)
+		if err := html.Render(&buf, n); err != nil {
+			return fragment
+		}
+	}
+	return buf.String()
+}
+
 // copied and modified from	(*goquery.Selection).Html()
 func buildHTML(s *goquery.Document, buf *bytes.Buffer) error {
 	// Merge all head nodes into one
@@ -0,0 +1,252 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yusing/godoxy/internal/logging/accesslog"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+type (
+	secureHeaders struct {
+		SecureHeadersOpts
+
+		hsts              string
+		permissionsPolicy string
+		csp               string
+		cspHeader         string
+		cspUsesNonce      bool
+	}
+
+	SecureHeadersOpts struct {
+		HSTS HSTSOpts `json:"hsts"`
+		// X-Content-Type-Options: nosniff
+		NoSniff bool `json:"nosniff"`
+		// X-Frame-Options
+		FrameOptions string `json:"frame_options" validate:"omitempty,oneof=DENY SAMEORIGIN"`
+		// Referrer-Policy
+		ReferrerPolicy string `json:"referrer_policy" validate:"omitempty,oneof=no-referrer no-referrer-when-downgrade origin origin-when-cross-origin same-origin strict-origin strict-origin-when-cross-origin unsafe-url"`
+		// Permissions-Policy, feature: allowlist, e.g. camera: [], geolocation: [self]
+		PermissionsPolicy map[string][]string `json:"permissions_policy"`
+		// Cross-Origin-Opener-Policy
+		CrossOriginOpenerPolicy string `json:"cross_origin_opener_policy" aliases:"coop" validate:"omitempty,oneof=unsafe-none same-origin-allow-popups same-origin noopener-allow-popups"`
+		// Cross-Origin-Embedder-Policy
+		CrossOriginEmbedderPolicy string `json:"cross_origin_embedder_policy" aliases:"coep" validate:"omitempty,oneof=unsafe-none require-corp credentialless"`
+		// Content-Security-Policy
+		CSP *CSPOpts `json:"csp"`
+		// collect CSP violation reports at SecurityReportPath
+		Report bool `json:"report"`
+	}
+
+	HSTSOpts struct {
+		MaxAge            time.Duration `json:"max_age"` // 0 to disable
+		IncludeSubdomains bool          `json:"include_subdomains"`
+		Preload           bool          `json:"preload"`
+	}
+
+	CSPOpts struct {
+		// directive: sources, e.g. script-src: [self, nonce, https://cdn.example.com];
+		// keywords like self and none are quoted, nonce is replaced by a per-request nonce
+		Directives map[string][]string `json:"directives" validate:"required"`
+		ReportOnly bool                `json:"report_only"`
+	}
+)
+
+var (
+	SecureHeaders            = NewMiddleware[secureHeaders]()
+	secureHeadersOptsDefault = SecureHeadersOpts{
+		HSTS: HSTSOpts{
+			MaxAge: 365 * 24 * time.Hour,
+		},
+		NoSniff:        true,
+		FrameOptions:   "SAMEORIGIN",
+		ReferrerPolicy: "strict-origin-when-cross-origin",
+	}
+)
+
+const (
+	cspNonceSource      = "nonce"
+	cspNoncePlaceholder = "'nonce-{nonce}'"
+	hstsPreloadMinAge   = 365 * 24 * time.Hour
+)
+
+var (
+	cspDirectiveRegex = regexp.MustCompile(`^[a-z]+(-[a-z]+)*$`)
+	cspKeywords       = []string{"self", "none", "unsafe-inline", "unsafe-eval", "unsafe-hashes", "strict-dynamic", "report-sample", "wasm-unsafe-eval", "inline-speculation-rules"}
+	cspHashPrefixes   = []string{"sha256-", "sha384-", "sha512-"}
+)
+
+type cspNonceKey struct{}
+
+// cspNonce returns the CSP nonce of the request, empty if the CSP does not use nonces.
+func cspNonce(r *http.Request) string {
+	nonce, _ := accesslog.Shared(r, cspNonceKey{}).(string)
+	return nonce
+}
+
+// setup implements MiddlewareWithSetup.
+func (m *secureHeaders) setup() {
+	m.SecureHeadersOpts = secureHeadersOptsDefault
+}
+
+// finalize implements MiddlewareFinalizerWithError.
+func (m *secureHeaders) finalize() error {
+	var errs gperr.Builder
+
+	if m.HSTS.MaxAge < 0 {
+		errs.Add(gperr.New("hsts.max_age must not be negative"))
+	} else if m.HSTS.MaxAge > 0 {
+		if m.HSTS.Preload && (!m.HSTS.IncludeSubdomains || m.HSTS.MaxAge < hstsPreloadMinAge) {
+			errs.Add(gperr.New("hsts.preload requires include_subdomains and max_age of at least 1 year"))
+		}
+		m.hsts = "max-age=" + strconv.Itoa(int(m.HSTS.MaxAge.Seconds()))
+		if m.HSTS.IncludeSubdomains {
+			m.hsts += "; includeSubDomains"
+		}
+		if m.HSTS.Preload {
+			m.hsts += "; preload"
+		}
+	}
+
+	if len(m.PermissionsPolicy) > 0 {
+		policies := make([]string, 0, len(m.PermissionsPolicy))
+		for _, feature := range slices.Sorted(maps.Keys(m.PermissionsPolicy)) {
+			allowlist := make([]string, len(m.PermissionsPolicy[feature]))
+			for i, origin := range m.PermissionsPolicy[feature] {
+				switch origin {
+				case "self", "*", "src":
+					allowlist[i] = origin
+				default:
+					allowlist[i] = strconv.Quote(origin)
+				}
+			}
+			policies = append(policies, feature+"=("+strings.Join(allowlist, " ")+")")
+		}
+		m.permissionsPolicy = strings.Join(policies, ", ")
+	}
+
+	if m.CSP != nil {
+		if err := m.buildCSP(); err != nil {
+			errs.Add(gperr.PrependSubject("csp", err))
+		}
+	}
+
+	if errs.HasError() {
+		return errs.Error()
+	}
+	return nil
+}
+
+// buildCSP builds the policy with a placeholder for the per-request nonce.
+func (m *secureHeaders) buildCSP() error {
+	var errs gperr.Builder
+	directives := make([]string, 0, len(m.CSP.Directives)+2)
+	for _, name := range slices.Sorted(maps.Keys(m.CSP.Directives)) {
+		if !cspDirectiveRegex.MatchString(name) {
+			errs.Add(gperr.New("invalid directive").Subject(name))
+			continue
+		}
+		if m.Report && (name == "report-uri" || name == "report-to") {
+			errs.Add(gperr.New("directive is set by report").Subject(name))
+			continue
+		}
+		directive := name
+		for _, source := range m.CSP.Directives[name] {
+			switch {
+			case source == cspNonceSource:
+				m.cspUsesNonce = true
+				source = cspNoncePlaceholder
+			case slices.Contains(cspKeywords, source), slices.ContainsFunc(cspHashPrefixes, func(prefix string) bool {
+				return strings.HasPrefix(source, prefix)
+			}):
+				source = "'" + source + "'"
+			case strings.ContainsAny(source, ";,"):
+				errs.Add(gperr.Errorf("invalid source %q", source).Subject(name))
+				continue
+			}
+			directive += " " + source
+		}
+		directives = append(directives, directive)
+	}
+	if m.Report {
+		directives = append(directives, "report-uri "+SecurityReportPath, "report-to "+securityReportEndpoint)
+	}
+	if errs.HasError() {
+		return errs.Error()
+	}
+	m.csp = strings.Join(directives, "; ")
+	if m.CSP.ReportOnly {
+		m.cspHeader = "Content-Security-Policy-Report-Only"
+	} else {
+		m.cspHeader = "Content-Security-Policy"
+	}
+	return nil
+}
+
+// before implements RequestModifier.
+func (m *secureHeaders) before(w http.ResponseWriter, r *http.Request) (proceed bool) {
+	if m.Report && r.URL.Path == SecurityReportPath {
+		handleSecurityReport(w, r)
+		return false
+	}
+	if m.cspUsesNonce {
+		// share the nonce with modifyResponse of this and the modifyhtml middleware
+		accesslog.SetShared(r, cspNonceKey{}, newCSPNonce())
+	}
+	return true
+}
+
+// modifyResponse implements ResponseModifier.
+func (m *secureHeaders) modifyResponse(resp *http.Response) error {
+	h := resp.Header
+	if m.hsts != "" {
+		h.Set("Strict-Transport-Security", m.hsts)
+	}
+	if m.NoSniff {
+		h.Set("X-Content-Type-Options", "nosniff")
+	}
+	if m.FrameOptions != "" {
+		h.Set("X-Frame-Options", m.FrameOptions)
+	}
+	if m.ReferrerPolicy != "" {
+		h.Set("Referrer-Policy", m.ReferrerPolicy)
+	}
+	if m.permissionsPolicy != "" {
+		h.Set("Permissions-Policy", m.permissionsPolicy)
+	}
+	if m.CrossOriginOpenerPolicy != "" {
+		h.Set("Cross-Origin-Opener-Policy", m.CrossOriginOpenerPolicy)
+	}
+	if m.CrossOriginEmbedderPolicy != "" {
+		h.Set("Cross-Origin-Embedder-Policy", m.CrossOriginEmbedderPolicy)
+	}
+	if m.csp != "" {
+		csp := m.csp
+		if m.cspUsesNonce {
+			nonce := cspNonce(resp.Request)
+			if nonce == "" { // before was skipped or the request has no annotation holder
+				nonce = newCSPNonce()
+			}
+			csp = strings.ReplaceAll(csp, cspNoncePlaceholder, "'nonce-"+nonce+"'")
+		}
+		h.Set(m.cspHeader, csp)
+	}
+	if m.Report {
+		h.Set("Reporting-Endpoints", securityReportEndpoint+`="`+SecurityReportPath+`"`)
+	}
+	return nil
+}
+
+func newCSPNonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
@@ -0,0 +1,250 @@
+package middleware
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	nettypes "github.com/yusing/godoxy/internal/net/types"
+	expect "github.com/yusing/goutils/testing"
+)
+
+func TestSecureHeadersDefaults(t *testing.T) {
+	result, err := newMiddlewareTest(SecureHeaders, &testArgs{
+		respHeaders: http.Header{"X-Frame-Options": {"ALLOWALL"}},
+	})
+	expect.NoError(t, err)
+	expect.Equal(t, result.ResponseHeaders.Get("Strict-Transport-Security"), "max-age=31536000")
+	expect.Equal(t, result.ResponseHeaders.Get("X-Content-Type-Options"), "nosniff")
+	expect.Equal(t, result.ResponseHeaders.Values("X-Frame-Options"), []string{"SAMEORIGIN"})
+	expect.Equal(t, result.ResponseHeaders.Get("Referrer-Policy"), "strict-origin-when-cross-origin")
+	expect.Equal(t, result.ResponseHeaders.Get("Content-Security-Policy"), "")
+	expect.Equal(t, result.ResponseHeaders.Get("Reporting-Endpoints"), "")
+}
+
+func TestSecureHeadersOptions(t *testing.T) {
+	result, err := newMiddlewareTest(SecureHeaders, &testArgs{
+		middlewareOpt: OptionsRaw{
+			"hsts": map[string]any{
+				"max_age":            "8760h",
+				"include_subdomains": true,
+				"preload":            true,
+			},
+			"nosniff":         false,
+			"frame_options":   "DENY",
+			"referrer_policy": "no-referrer",
+			"permissions_policy": map[string]any{
+				"geolocation": []string{"self", "https://maps.example.com"},
+				"camera":      []string{},
+			},
+			"coop": "same-origin",
+			"coep": "require-corp",
+			"csp": map[string]any{
+				"directives": map[string]any{
+					"default-src": []string{"self"},
+					"script-src":  []string{"self", "sha256-abc=", "https://cdn.example.com"},
+					"object-src":  []string{"none"},
+				},
+				"report_only": true,
+			},
+		},
+	})
+	expect.NoError(t, err)
+	expect.Equal(t, result.ResponseHeaders.Get("Strict-Transport-Security"), "max-age=31536000; includeSubDomains; preload")
+	expect.Equal(t, result.ResponseHeaders.Get("X-Content-Type-Options"), "")
+	expect.Equal(t, result.ResponseHeaders.Get("X-Frame-Options"), "DENY")
+	expect.Equal(t, result.ResponseHeaders.Get("Referrer-Policy"), "no-referrer")
+	expect.Equal(t, result.ResponseHeaders.Get("Permissions-Policy"), `camera=(), geolocation=(self "https://maps.example.com")`)
+	expect.Equal(t, result.ResponseHeaders.Get("Cross-Origin-Opener-Policy"), "same-origin")
+	expect.Equal(t, result.ResponseHeaders.Get("Cross-Origin-Embedder-Policy"), "require-corp")
+	expect.Equal(t, result.ResponseHeaders.Get("Content-Security-Policy"), "")
+	expect.Equal(t, result.ResponseHeaders.Get("Content-Security-Policy-Report-Only"),
+		"default-src 'self'; object-src 'none'; script-src 'self' 'sha256-abc=' https://cdn.example.com")
+}
+
+func TestSecureHeadersValidation(t *testing.T) {
+	tests := map[string]OptionsRaw{
+		"preload without include_subdomains": {"hsts": map[string]any{"max_age": "8760h", "preload": true}},
+		"preload with short max_age":         {"hsts": map[string]any{"max_age": "24h", "include_subdomains": true, "preload": true}},
+		"invalid frame_options":              {"frame_options": "ALLOWALL"},
+		"csp without directives":             {"csp": map[string]any{"report_only": true}},
+		"invalid csp directive":              {"csp": map[string]any{"directives": map[string]any{"script src": []string{"self"}}}},
+		"invalid csp source":                 {"csp": map[string]any{"directives": map[string]any{"script-src": []string{"self; object-src *"}}}},
+		"report directive with report":       {"report": true, "csp": map[string]any{"directives": map[string]any{"report-uri": []string{"/csp"}}}},
+	}
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := SecureHeaders.New(opts)
+			expect.HasError(t, err)
+		})
+	}
+}
+
+var cspNonceRegex = regexp.MustCompile(`'nonce-([^']+)'`)
+
+func TestSecureHeadersNonce(t *testing.T) {
+	secureHeaders, err := SecureHeaders.New(OptionsRaw{
+		"csp": map[string]any{
+			"directives": map[string]any{
+				"script-src": []string{"self", "nonce"},
+				"style-src":  []string{"self", "nonce"},
+			},
+		},
+	})
+	expect.NoError(t, err)
+	modifyHTML, err := ModifyHTML.New(OptionsRaw{
+		"target": "body",
+		"html":   `<script>console.log("injected")</script><style>body { color: red; }</style><p>text</p>`,
+	})
+	expect.NoError(t, err)
+
+	args := &testArgs{
+		respHeaders: http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+		respBody:    []byte(`<html><head></head><body><script>console.log("upstream")</script></body></html>`),
+	}
+	result, err := newMiddlewaresTest([]*Middleware{secureHeaders, modifyHTML}, args)
+	expect.NoError(t, err)
+
+	csp := result.ResponseHeaders.Get("Content-Security-Policy")
+	matches := cspNonceRegex.FindAllStringSubmatch(csp, -1)
+	expect.Equal(t, len(matches), 2)
+	nonce := matches[0][1]
+	expect.Equal(t, matches[1][1], nonce)
+	expect.Equal(t, csp, "script-src 'self' 'nonce-"+nonce+"'; style-src 'self' 'nonce-"+nonce+"'")
+
+	body := string(result.Data)
+	expect.True(t, strings.Contains(body, `<script nonce="`+nonce+`">console.log("injected")</script>`))
+	expect.True(t, strings.Contains(body, `<style nonce="`+nonce+`">body { color: red; }</style>`))
+	expect.True(t, strings.Contains(body, `<script>console.log("upstream")</script>`), "upstream scripts should not be modified")
+
+	// a new nonce for each request
+	result, err = newMiddlewaresTest([]*Middleware{secureHeaders, modifyHTML}, args)
+	expect.NoError(t, err)
+	expect.NotEqual(t, result.ResponseHeaders.Get("Content-Security-Policy"), csp)
+}
+
+func TestSecureHeadersReports(t *testing.T) {
+	mid, err := SecureHeaders.New(OptionsRaw{
+		"report": true,
+		"csp": map[string]any{
+			"directives": map[string]any{
+				"default-src": []string{"self"},
+			},
+		},
+	})
+	expect.NoError(t, err)
+
+	t.Run("headers", func(t *testing.T) {
+		result, err := newMiddlewareTest(mid, nil)
+		expect.NoError(t, err)
+		expect.Equal(t, result.ResponseHeaders.Get("Content-Security-Policy"), "default-src 'self'; report-uri /.godoxy/reports; report-to godoxy")
+		expect.Equal(t, result.ResponseHeaders.Get("Reporting-Endpoints"), `godoxy="/.godoxy/reports"`)
+	})
+
+	reportURL := nettypes.MustParseURL("https://example.com" + SecurityReportPath)
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		added       int
+	}{
+		{
+			name:        "csp report",
+			contentType: "application/csp-report",
+			body:        `{"csp-report":{"document-uri":"https://example.com/page","violated-directive":"default-src"}}`,
+			status:      http.StatusNoContent,
+			added:       1,
+		},
+		{
+			name:        "reporting api",
+			contentType: "application/reports+json",
+			body:        `[{"type":"csp-violation","url":"https://example.com/a","user_agent":"test","body":{"effectiveDirective":"script-src-elem"}},{"type":"deprecation","url":"https://example.com/b","body":{}}]`,
+			status:      http.StatusNoContent,
+			added:       2,
+		},
+		{
+			name:        "invalid report",
+			contentType: "application/csp-report",
+			body:        `{"foo":"bar"}`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "unsupported content type",
+			contentType: "text/plain",
+			body:        `report`,
+			status:      http.StatusUnsupportedMediaType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(SecurityReports(""))
+			result, err := newMiddlewareTest(mid, &testArgs{
+				reqURL:    reportURL,
+				reqMethod: http.MethodPost,
+				headers:   http.Header{"Content-Type": {tt.contentType}},
+				body:      []byte(tt.body),
+			})
+			expect.NoError(t, err)
+			expect.Equal(t, result.ResponseStatus, tt.status)
+			expect.Equal(t, result.RequestHeaders, nil) // upstream not called
+			expect.Equal(t, len(SecurityReports("")), before+tt.added)
+		})
+	}
+
+	reports := SecurityReports("")
+	expect.Equal(t, reports[0].Type, "deprecation")
+	expect.Equal(t, reports[1].Type, "csp-violation")
+	expect.Equal(t, reports[1].UserAgent, "test")
+	expect.Equal(t, reports[2].URL, "https://example.com/page")
+	expect.Equal(t, reports[2].Body["violated-directive"], any("default-src"))
+
+	t.Run("method not allowed", func(t *testing.T) {
+		result, err := newMiddlewareTest(mid, &testArgs{reqURL: reportURL})
+		expect.NoError(t, err)
+		expect.Equal(t, result.ResponseStatus, http.StatusMethodNotAllowed)
+	})
+}
+
+func TestSecurityReportsLimits(t *testing.T) {
+	t.Run("client rate", func(t *testing.T) {
+		rr := newRouteSecurityReports()
+		for range securityReportClientBurst {
+			expect.True(t, rr.allowClient("192.0.2.1"))
+		}
+		expect.False(t, rr.allowClient("192.0.2.1"))
+		expect.True(t, rr.allowClient("192.0.2.2"))
+	})
+	t.Run("route rate", func(t *testing.T) {
+		rr := newRouteSecurityReports()
+		for range securityReportRouteBurst + 1 {
+			rr.add(SecurityReport{Type: "csp-violation"})
+		}
+		expect.Equal(t, len(rr.reports), maxSecurityReportsPerRoute)
+		expect.Equal(t, rr.next, 0) // the last report was dropped
+	})
+	t.Run("size", func(t *testing.T) {
+		long := strings.Repeat("a", maxSecurityReportStringLen+1)
+		report := limitSecurityReport(SecurityReport{
+			URL:  "https://example.com",
+			Body: map[string]any{"script-sample": long, "nested": []any{long}},
+		})
+		expect.True(t, report.Truncated)
+		expect.Equal(t, report.URL, "https://example.com")
+		expect.Equal(t, report.Body["script-sample"], any(long[:maxSecurityReportStringLen]))
+		expect.Equal(t, report.Body["nested"].([]any)[0], any(long[:maxSecurityReportStringLen]))
+
+		body := make(map[string]any)
+		for i := range maxSecurityReportSize / 8 {
+			body[strconv.Itoa(i)] = "value"
+		}
+		report = limitSecurityReport(SecurityReport{Body: body})
+		expect.True(t, report.Truncated)
+		expect.Equal(t, report.Body, nil)
+
+		report = limitSecurityReport(SecurityReport{Body: map[string]any{"a": "b"}})
+		expect.False(t, report.Truncated)
+	})
+}
@@ -0,0 +1,258 @@
+package middleware
+
+import (
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/yusing/godoxy/internal/route/routes"
+	"golang.org/x/time/rate"
+)
+
+// SecurityReport is a CSP violation or another report sent by browsers to SecurityReportPath.
+type SecurityReport struct {
+	Time      time.Time      `json:"time"`
+	Route     string         `json:"route"`
+	Host      string         `json:"host"`
+	Type      string         `json:"type"` // e.g. "csp-violation"
+	URL       string         `json:"url"`  // the document url
+	UserAgent string         `json:"user_agent"`
+	Body      map[string]any `json:"body"`
+	Truncated bool           `json:"truncated"` // long strings of the body were truncated, or the body dropped
+} // @name SecurityReport
+
+const (
+	// SecurityReportPath receives reports of routes with secureheaders reporting enabled.
+	SecurityReportPath = "/.godoxy/reports"
+
+	securityReportEndpoint = "godoxy"
+
+	maxSecurityReportsPerRoute = 100
+	maxSecurityReportBodySize  = 64 * 1024 // of the request
+	maxSecurityReportSize      = 4 * 1024  // of the stored body, marshalled
+	maxSecurityReportStringLen = 256       // of strings of the stored report
+
+	// reports stored per route, and requests accepted per client of a route.
+	securityReportRouteRate   = rate.Limit(10)
+	securityReportRouteBurst  = 100
+	securityReportClientRate  = rate.Limit(1)
+	securityReportClientBurst = 10
+	maxSecurityReportClients  = 1000 // clients tracked per route
+)
+
+// routeSecurityReports holds the reports of a route.
+type routeSecurityReports struct {
+	mu      sync.Mutex
+	reports []SecurityReport // ring buffer
+	next    int
+	limiter *rate.Limiter
+	clients map[string]*rate.Limiter
+}
+
+var securityReports = xsync.NewMap[string, *routeSecurityReports]() // by route name
+
+func newRouteSecurityReports() *routeSecurityReports {
+	return &routeSecurityReports{
+		limiter: rate.NewLimiter(securityReportRouteRate, securityReportRouteBurst),
+		clients: make(map[string]*rate.Limiter),
+	}
+}
+
+// SecurityReports returns the collected reports of a route, of all routes if empty, newest first.
+func SecurityReports(route string) []SecurityReport {
+	var reports []SecurityReport
+	for name, rr := range securityReports.All() {
+		if route != "" && name != route {
+			continue
+		}
+		rr.mu.Lock()
+		n := len(reports)
+		reports = append(reports, rr.reports[rr.next:]...)
+		reports = append(reports, rr.reports[:rr.next]...)
+		rr.mu.Unlock()
+		slices.Reverse(reports[n:])
+	}
+	slices.SortStableFunc(reports, func(a, b SecurityReport) int {
+		return b.Time.Compare(a.Time)
+	})
+	return reports
+}
+
+// allowClient reports whether a request of the client is accepted.
+// Clients are tracked up to maxSecurityReportClients, idle ones are evicted when full.
+func (rr *routeSecurityReports) allowClient(client string) bool {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	lim, ok := rr.clients[client]
+	if !ok {
+		if len(rr.clients) >= maxSecurityReportClients {
+			for c, l := range rr.clients {
+				if l.Tokens() >= securityReportClientBurst {
+					delete(rr.clients, c)
+				}
+			}
+			if len(rr.clients) >= maxSecurityReportClients {
+				return false
+			}
+		}
+		lim = rate.NewLimiter(securityReportClientRate, securityReportClientBurst)
+		rr.clients[client] = lim
+	}
+	return lim.Allow()
+}
+
+// add stores the report, reports beyond the rate limit of the route are dropped.
+func (rr *routeSecurityReports) add(report SecurityReport) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	if !rr.limiter.Allow() {
+		return
+	}
+	if len(rr.reports) < maxSecurityReportsPerRoute {
+		rr.reports = append(rr.reports, report)
+		return
+	}
+	rr.reports[rr.next] = report
+	rr.next = (rr.next + 1) % maxSecurityReportsPerRoute
+}
+
+// truncateString truncates s to maxSecurityReportStringLen bytes.
+func truncateString(s string) (string, bool) {
+	if len(s) <= maxSecurityReportStringLen {
+		return s, false
+	}
+	return strings.ToValidUTF8(s[:maxSecurityReportStringLen], ""), true
+}
+
+// truncateStrings truncates the strings of a decoded json value in place.
+func truncateStrings(v any) (any, bool) {
+	truncated := false
+	switch v := v.(type) {
+	case string:
+		return truncateString(v)
+	case map[string]any:
+		for k, e := range v {
+			var t bool
+			v[k], t = truncateStrings(e)
+			truncated = truncated || t
+		}
+	case []any:
+		for i, e := range v {
+			var t bool
+			v[i], t = truncateStrings(e)
+			truncated = truncated || t
+		}
+	}
+	return v, truncated
+}
+
+// limitSecurityReport caps the size of the report before it is stored:
+// long strings are truncated, and the body is dropped if it is still larger than maxSecurityReportSize.
+func limitSecurityReport(report SecurityReport) SecurityReport {
+	var t bool
+	report.Host, t = truncateString(report.Host)
+	report.Truncated = report.Truncated || t
+	report.Type, t = truncateString(report.Type)
+	report.Truncated = report.Truncated || t
+	report.URL, t = truncateString(report.URL)
+	report.Truncated = report.Truncated || t
+	report.UserAgent, t = truncateString(report.UserAgent)
+	report.Truncated = report.Truncated || t
+
+	_, t = truncateStrings(report.Body)
+	report.Truncated = report.Truncated || t
+	if b, err := sonic.Marshal(report.Body); err != nil || len(b) > maxSecurityReportSize {
+		report.Body = nil
+		report.Truncated = true
+	}
+	return report
+}
+
+// handleSecurityReport collects reports sent with report-uri (application/csp-report)
+// or the Reporting API (application/reports+json).
+//
+// Reports are kept per route, rate limited per client and per route.
+func handleSecurityReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	route := routes.TryGetUpstreamName(r)
+	rr, _ := securityReports.LoadOrCompute(route, func() (*routeSecurityReports, bool) {
+		return newRouteSecurityReports(), false
+	})
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		client = r.RemoteAddr
+	}
+	if !rr.allowClient(client) {
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSecurityReportBodySize))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	now := time.Now()
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch contentType {
+	case "application/csp-report", "application/json":
+		var legacy struct {
+			Report map[string]any `json:"csp-report"`
+		}
+		if err := sonic.Unmarshal(body, &legacy); err != nil || legacy.Report == nil {
+			http.Error(w, "invalid report", http.StatusBadRequest)
+			return
+		}
+		documentURL, _ := legacy.Report["document-uri"].(string)
+		rr.add(limitSecurityReport(SecurityReport{
+			Time:      now,
+			Route:     route,
+			Host:      r.Host,
+			Type:      "csp-violation",
+			URL:       documentURL,
+			UserAgent: r.UserAgent(),
+			Body:      legacy.Report,
+		}))
+	case "application/reports+json":
+		var reports []struct {
+			Type      string         `json:"type"`
+			URL       string         `json:"url"`
+			UserAgent string         `json:"user_agent"`
+			Body      map[string]any `json:"body"`
+		}
+		if err := sonic.Unmarshal(body, &reports); err != nil {
+			http.Error(w, "invalid report", http.StatusBadRequest)
+			return
+		}
+		for _, report := range reports {
+			if report.UserAgent == "" {
+				report.UserAgent = r.UserAgent()
+			}
+			rr.add(limitSecurityReport(SecurityReport{
+				Time:      now,
+				Route:     route,
+				Host:      r.Host,
+				Type:      report.Type,
+				URL:       report.URL,
+				UserAgent: report.UserAgent,
+				Body:      report.Body,
+			}))
+		}
+	default:
+		http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
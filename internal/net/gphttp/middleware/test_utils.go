@@ -10,6 +10,7 @@ import (
 
 	"github.com/bytedance/sonic"
 	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/logging/accesslog"
 	nettypes "github.com/yusing/godoxy/internal/net/types"
 	gperr "github.com/yusing/goutils/errs"
 	"github.com/yusing/goutils/http/reverseproxy"
@@ -55,7 +56,7 @@ func (rt *requestRecorder) RoundTrip(req *http.Request) (resp *http.Response, er
 		resp = &http.Response{
 			Status:        http.StatusText(rt.args.respStatus),
 			StatusCode:    rt.args.respStatus,
-			Header:        testHeaders,
+			Header:        testHeaders.Clone(),
 			Body:          io.NopCloser(bytes.NewReader(rt.args.respBody)),
 			ContentLength: int64(len(rt.args.respBody)),
 			Request:       req,
@@ -141,7 +142,8 @@ func newMiddlewaresTest(middlewares []*Middleware, args *testArgs) (*TestResult,
 	}
 	args.setDefaults()
 
-	req := httptest.NewRequest(args.reqMethod, args.reqURL.String(), args.bodyReader())
+	// installed by the entrypoint in production
+	req := accesslog.WithAnnotations(httptest.NewRequest(args.reqMethod, args.reqURL.String(), args.bodyReader()))
 	maps.Copy(req.Header, args.headers)
 
 	w := httptest.NewRecorder()
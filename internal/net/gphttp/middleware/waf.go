@@ -0,0 +1,436 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"weak"
+
+	coreruleset "github.com/corazawaf/coraza-coreruleset"
+	"github.com/corazawaf/coraza/v3"
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	corazatypes "github.com/corazawaf/coraza/v3/types"
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/logging/accesslog"
+	"github.com/yusing/godoxy/internal/route/routes"
+	gperr "github.com/yusing/goutils/errs"
+	strutils "github.com/yusing/goutils/strings"
+)
+
+type (
+	wafMiddleware struct {
+		WAFOpts
+
+		waf             *wafInstance
+		routeExclusions map[string]string // route name: value of the route exclusion variable
+	}
+
+	// wafInstance is a WAF shared by the middlewares with the same directives.
+	wafInstance struct {
+		coraza.WAF
+	}
+
+	WAFOpts struct {
+		Mode             string              `json:"mode" validate:"oneof=block detect"`             // default: block
+		CRS              bool                `json:"crs"`                                            // load the bundled OWASP Core Rule Set
+		ParanoiaLevel    int                 `json:"paranoia_level" validate:"min=1,max=4"`          // CRS paranoia level, default: 1
+		AnomalyThreshold int                 `json:"anomaly_threshold" validate:"min=1"`             // CRS inbound anomaly score threshold, default: 5
+		Rules            string              `json:"rules"`                                          // SecLang directives, only allowed in route files
+		RuleFiles        []string            `json:"rule_files"`                                     // SecLang rule files in config/waf or @owasp_crs/, globs are allowed, only allowed in route files
+		RequestBodyLimit int                 `json:"request_body_limit" validate:"min=0"`            // bytes of the body to inspect, 0 to skip bodies, default: 128 KiB
+		ExcludeRules     []string            `json:"exclude_rules"`                                  // rule IDs or ranges, e.g. 920350, 942100-942199
+		RouteExclusions  map[string][]string `json:"route_exclusions" aliases:"route_exclude_rules"` // route name: rule IDs or ranges
+	}
+)
+
+var (
+	WAF            = NewMiddleware[wafMiddleware]()
+	wafOptsDefault = WAFOpts{
+		Mode:             wafModeBlock,
+		ParanoiaLevel:    1,
+		AnomalyThreshold: 5,
+		RequestBodyLimit: 128 << 10,
+	}
+)
+
+const (
+	wafModeBlock  = "block"
+	wafModeDetect = "detect"
+
+	wafAnnotationRules  = "waf_rules"
+	wafAnnotationAction = "waf_action"
+
+	// route exclusions are rules removing rules at runtime when TX:godoxy_route_exclusion matches,
+	// with ids from wafRouteExclusionRuleID.
+	wafRouteExclusionVar    = "godoxy_route_exclusion"
+	wafRouteExclusionRuleID = 9_990_000
+)
+
+var (
+	// wafRulesDir is the directory of rule files, paths of rule_files are relative to it.
+	// Include directives only read the bundled CRS, e.g. "@owasp_crs/*.conf".
+	wafRulesDir = common.WAFRulesBasePath
+
+	wafRuleIDRegex      = regexp.MustCompile(`^[0-9]+(-[0-9]+)?$`)
+	ErrInvalidWAFRuleID = gperr.New("invalid rule id or range")
+	ErrWAFDirective     = gperr.New("directive is not allowed in rules")
+	ErrWAFRuleFile      = gperr.New("invalid rule file")
+
+	// wafDeniedDirectives read or write files of the host, by lower case name or prefix ending with "*".
+	wafDeniedDirectives = []string{"include", "secauditlog*", "secdebuglog*", "secdatadir", "sectmpdir", "secuploaddir"}
+
+	// WAF instances by directives, loading the CRS takes time and memory,
+	// so instances are shared by middlewares with the same rules.
+	// The cache holds weak pointers, an instance is evicted once no middleware refers to it, i.e. after a reload.
+	wafInstances = xsync.NewMap[string, weak.Pointer[wafInstance]]()
+)
+
+// setup implements MiddlewareWithSetup.
+func (m *wafMiddleware) setup() {
+	m.WAFOpts = wafOptsDefault
+}
+
+// finalize implements MiddlewareFinalizerWithError.
+func (m *wafMiddleware) finalize() error {
+	if !m.CRS && m.Rules == "" && len(m.RuleFiles) == 0 {
+		return gperr.New("crs, rules or rule_files is required")
+	}
+
+	var errs gperr.Builder
+	for _, id := range m.ExcludeRules {
+		if !wafRuleIDRegex.MatchString(id) {
+			errs.Add(gperr.PrependSubject("exclude_rules", ErrInvalidWAFRuleID.Subject(id)))
+		}
+	}
+	for route, ids := range m.RouteExclusions {
+		for _, id := range ids {
+			if !wafRuleIDRegex.MatchString(id) {
+				errs.Add(gperr.PrependSubject(route, ErrInvalidWAFRuleID.Subject(id)))
+			}
+		}
+	}
+	if err := validateWAFRules(m.Rules); err != nil {
+		errs.Add(gperr.PrependSubject("rules", err))
+	}
+	ruleFiles, err := loadWAFRuleFiles(m.RuleFiles)
+	if err != nil {
+		errs.Add(gperr.PrependSubject("rule_files", err))
+	}
+	if errs.HasError() {
+		return errs.Error()
+	}
+
+	m.routeExclusions = make(map[string]string, len(m.RouteExclusions))
+	for i, route := range slices.Sorted(maps.Keys(m.RouteExclusions)) {
+		m.routeExclusions[route] = strconv.Itoa(i)
+	}
+
+	waf, err := newWAF(m.directives(ruleFiles))
+	if err != nil {
+		return err
+	}
+	m.waf = waf
+	return nil
+}
+
+// ValidateUntrustedWAF rejects the WAF rules and rule files of route middlewares not defined in route files,
+// labels, annotations and remote catalogs must not be able to load rules from the host.
+func ValidateUntrustedWAF(middlewares map[string]OptionsRaw) gperr.Error {
+	var errs gperr.Builder
+	for name, opts := range middlewares {
+		if strutils.ToLowerNoSnake(name) != "waf" {
+			continue
+		}
+		for key := range opts {
+			switch strutils.ToLowerNoSnake(key) {
+			case "rules", "rulefiles":
+				errs.Add(gperr.Errorf("waf %s are only allowed in route files", key).Subject("middlewares." + name))
+			}
+		}
+	}
+	return errs.Error()
+}
+
+// validateWAFRules rejects the directives reading or writing files of the host.
+func validateWAFRules(rules string) gperr.Error {
+	var errs gperr.Builder
+	// a line ending with a backslash continues on the next line
+	for l := range strings.Lines(strings.ReplaceAll(rules, "\\\n", " ")) {
+		fields := strings.Fields(l)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		directive := strings.ToLower(fields[0])
+		for _, denied := range wafDeniedDirectives {
+			if prefix, ok := strings.CutSuffix(denied, "*"); ok && strings.HasPrefix(directive, prefix) || directive == denied {
+				errs.Add(ErrWAFDirective.Subject(fields[0]))
+				break
+			}
+		}
+	}
+	return errs.Error()
+}
+
+// loadWAFRuleFiles returns the directives of the rule files, in the order of the patterns.
+//
+// Patterns with the "@" prefix refer to the bundled CRS and are returned as Include directives,
+// others are matched in wafRulesDir and the files are read with os.OpenInRoot, so they cannot escape it.
+func loadWAFRuleFiles(patterns []string) ([]string, gperr.Error) {
+	var errs gperr.Builder
+	var ruleFiles []string
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "@") {
+			ruleFiles = append(ruleFiles, "Include "+pattern)
+			continue
+		}
+		if !filepath.IsLocal(pattern) {
+			errs.Add(ErrWAFRuleFile.Withf("must be a relative path in %s", wafRulesDir).Subject(pattern))
+			continue
+		}
+		files, err := fs.Glob(os.DirFS(wafRulesDir), filepath.ToSlash(pattern))
+		if err != nil {
+			errs.Add(ErrWAFRuleFile.With(err).Subject(pattern))
+			continue
+		}
+		if len(files) == 0 {
+			errs.Add(ErrWAFRuleFile.Withf("no files match in %s", wafRulesDir).Subject(pattern))
+			continue
+		}
+		for _, file := range files {
+			content, err := readWAFRuleFile(file)
+			if err != nil {
+				errs.Add(ErrWAFRuleFile.With(err).Subject(file))
+				continue
+			}
+			ruleFiles = append(ruleFiles, content)
+		}
+	}
+	return ruleFiles, errs.Error()
+}
+
+func readWAFRuleFile(name string) (string, error) {
+	f, err := os.OpenInRoot(wafRulesDir, name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// directives returns the SecLang config of the options, with the directives of the rule files.
+func (m *wafMiddleware) directives(ruleFiles []string) string {
+	var b strings.Builder
+	line := func(format string, args ...any) {
+		fmt.Fprintf(&b, format, args...)
+		b.WriteByte('\n')
+	}
+
+	if m.CRS {
+		line("Include @coraza.conf-recommended")
+	}
+	if m.Mode == wafModeDetect {
+		line("SecRuleEngine DetectionOnly")
+	} else {
+		line("SecRuleEngine On")
+	}
+	if m.RequestBodyLimit > 0 {
+		line("SecRequestBodyAccess On")
+		line("SecRequestBodyLimit %d", m.RequestBodyLimit)
+		line("SecRequestBodyInMemoryLimit %d", m.RequestBodyLimit)
+		line("SecRequestBodyLimitAction ProcessPartial")
+	} else {
+		line("SecRequestBodyAccess Off")
+	}
+	// responses are not inspected
+	line("SecResponseBodyAccess Off")
+	line("SecAuditEngine Off")
+
+	if m.CRS {
+		line("Include @crs-setup.conf.example")
+		line(`SecAction "id:900000,phase:1,pass,t:none,nolog,setvar:tx.blocking_paranoia_level=%d"`, m.ParanoiaLevel)
+		line(`SecAction "id:900110,phase:1,pass,t:none,nolog,setvar:tx.inbound_anomaly_score_threshold=%d"`, m.AnomalyThreshold)
+	}
+	// route exclusions go before the rules they remove, the variable is set by before
+	for i, route := range slices.Sorted(maps.Keys(m.RouteExclusions)) {
+		var ctl strings.Builder
+		for _, id := range m.RouteExclusions[route] {
+			ctl.WriteString(",ctl:ruleRemoveById=" + id)
+		}
+		line(`SecRule TX:%s "@streq %d" "id:%d,phase:1,pass,t:none,nolog%s"`, wafRouteExclusionVar, i, wafRouteExclusionRuleID+i, ctl.String())
+	}
+	// user rules go before the CRS, so they can configure it or exclude rules at runtime with ctl actions
+	if m.Rules != "" {
+		line("%s", m.Rules)
+	}
+	for _, ruleFile := range ruleFiles {
+		line("%s", ruleFile)
+	}
+	if m.CRS {
+		line("Include @owasp_crs/*.conf")
+	}
+	if len(m.ExcludeRules) > 0 {
+		line("SecRuleRemoveById %s", strings.Join(m.ExcludeRules, " "))
+	}
+	return b.String()
+}
+
+// newWAF returns the WAF of the directives, reusing the instance with the same directives.
+//
+// Rule files are part of the directives, so modified rule files are loaded on the next reload.
+func newWAF(directives string) (*wafInstance, error) {
+	key := directives
+	if wp, ok := wafInstances.Load(key); ok {
+		if waf := wp.Value(); waf != nil {
+			return waf, nil
+		}
+	}
+	corazaWAF, err := coraza.NewWAF(coraza.NewWAFConfig().WithRootFS(coreruleset.FS).WithDirectives(directives))
+	if err != nil {
+		return nil, err
+	}
+	waf := &wafInstance{corazaWAF}
+
+	actual, _ := wafInstances.Compute(key, func(old weak.Pointer[wafInstance], loaded bool) (weak.Pointer[wafInstance], xsync.ComputeOp) {
+		if loaded && old.Value() != nil {
+			return old, xsync.CancelOp
+		}
+		return weak.Make(waf), xsync.UpdateOp
+	})
+	if shared := actual.Value(); shared != nil && shared != waf {
+		return shared, nil
+	}
+	runtime.AddCleanup(waf, func(key string) {
+		wafInstances.Compute(key, func(old weak.Pointer[wafInstance], loaded bool) (weak.Pointer[wafInstance], xsync.ComputeOp) {
+			if loaded && old.Value() == nil {
+				return old, xsync.DeleteOp
+			}
+			return old, xsync.CancelOp
+		})
+	}, key)
+	return waf, nil
+}
+
+// before implements RequestModifier.
+func (m *wafMiddleware) before(w http.ResponseWriter, r *http.Request) (proceed bool) {
+	tx := m.waf.NewTransaction()
+	defer func() {
+		tx.ProcessLogging()
+		if err := tx.Close(); err != nil {
+			WAF.LogError(r).Err(err).Msg("failed to close WAF transaction")
+		}
+	}()
+
+	if tx.IsRuleEngineOff() {
+		return true
+	}
+	if value, ok := m.routeExclusions[routes.TryGetUpstreamName(r)]; ok {
+		if state, ok := tx.(plugintypes.TransactionState); ok {
+			state.Variables().TX().Set(wafRouteExclusionVar, []string{value})
+		}
+	}
+
+	it, err := m.processRequest(tx, r)
+	if err != nil {
+		WAF.LogError(r).Err(err).Msg("failed to inspect request")
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+
+	if ruleIDs := matchedRuleIDs(tx, it); ruleIDs != "" {
+		accesslog.Annotate(r, wafAnnotationRules, ruleIDs)
+	}
+	if it == nil {
+		return true
+	}
+
+	accesslog.Annotate(r, wafAnnotationAction, it.Action)
+	status := it.Status
+	if it.Action == "redirect" {
+		if status == 0 {
+			status = http.StatusFound
+		}
+		http.Redirect(w, r, it.Data, status)
+		return false
+	}
+	if status == 0 {
+		status = http.StatusForbidden
+	}
+	w.WriteHeader(status)
+	return false
+}
+
+// processRequest feeds the connection, URI, headers and the body up to the limit to the transaction,
+// it stops at the first interruption.
+func (m *wafMiddleware) processRequest(tx corazatypes.Transaction, r *http.Request) (*corazatypes.Interruption, error) {
+	clientIP, clientPort, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+	port, _ := strconv.Atoi(clientPort)
+	tx.ProcessConnection(clientIP, port, "", 0)
+	tx.ProcessURI(r.URL.String(), r.Method, r.Proto)
+	for k, values := range r.Header {
+		for _, v := range values {
+			tx.AddRequestHeader(k, v)
+		}
+	}
+	// Host and Transfer-Encoding are removed from the header by net/http
+	if r.Host != "" {
+		tx.AddRequestHeader("Host", r.Host)
+		tx.SetServerName(r.Host)
+	}
+	if len(r.TransferEncoding) > 0 {
+		tx.AddRequestHeader("Transfer-Encoding", r.TransferEncoding[0])
+	}
+
+	if it := tx.ProcessRequestHeaders(); it != nil {
+		return it, nil
+	}
+
+	if tx.IsRequestBodyAccessible() && r.Body != nil && r.Body != http.NoBody {
+		body, err := io.ReadAll(io.LimitReader(r.Body, int64(m.RequestBodyLimit)))
+		if err != nil {
+			return nil, err
+		}
+		// replay the inspected part before the rest of the body
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+
+		it, _, err := tx.WriteRequestBody(body)
+		if it != nil || err != nil {
+			return it, err
+		}
+	}
+	return tx.ProcessRequestBody()
+}
+
+// matchedRuleIDs returns the comma separated IDs of matched rules and the interrupting rule,
+// without rules with the nolog action like the CRS initialization.
+func matchedRuleIDs(tx corazatypes.Transaction, it *corazatypes.Interruption) string {
+	var ids []string
+	for _, rule := range tx.MatchedRules() {
+		if logged, ok := rule.(interface{ Log() bool }); ok && !logged.Log() && (it == nil || rule.Rule().ID() != it.RuleID) {
+			continue
+		}
+		ids = append(ids, strconv.Itoa(rule.Rule().ID()))
+	}
+	return strings.Join(ids, ",")
+}
@@ -0,0 +1,243 @@
+package middleware
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/logging/accesslog"
+	nettypes "github.com/yusing/godoxy/internal/net/types"
+	"github.com/yusing/godoxy/internal/route/routes"
+	"github.com/yusing/godoxy/internal/types"
+	expect "github.com/yusing/goutils/testing"
+)
+
+const wafTestRule = `SecRule ARGS:id "@streq 1337" "id:10001,phase:1,deny,status:418,log"`
+
+func TestWAFValidation(t *testing.T) {
+	tests := map[string]OptionsRaw{
+		"no rules":                 {},
+		"invalid mode":             {"rules": wafTestRule, "mode": "log"},
+		"invalid exclude_rules":    {"rules": wafTestRule, "exclude_rules": []string{"942100-"}},
+		"invalid route_exclusions": {"rules": wafTestRule, "route_exclusions": map[string]any{"app": []string{"all"}}},
+		"invalid rules":            {"rules": `SecRule ARGS "@unknown x" "id:1,deny"`},
+		"include":                  {"rules": "Include /etc/passwd"},
+		"audit log":                {"rules": wafTestRule + "\n  secauditlog /tmp/audit.log"},
+		"debug log":                {"rules": "SecDebugLogLevel 9\nSecDebugLog /tmp/debug.log"},
+		"continued line":           {"rules": "SecDataDir \\\n  /tmp"},
+		"upload dir":               {"rules": "SecUploadDir /tmp"},
+		"absolute rule file":       {"rule_files": []string{"/etc/passwd"}},
+		"rule file outside":        {"rule_files": []string{"../secret.conf"}},
+		"rule file not found":      {"rule_files": []string{"missing.conf"}},
+	}
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := WAF.New(opts)
+			expect.HasError(t, err)
+		})
+	}
+}
+
+func TestWAFRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   string
+		query  string
+		status int
+		passed bool
+	}{
+		{name: "clean request", query: "id=1", status: http.StatusOK, passed: true},
+		{name: "blocked", query: "id=1337", status: http.StatusTeapot},
+		{name: "detect only", mode: wafModeDetect, query: "id=1337", status: http.StatusOK, passed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := OptionsRaw{"rules": wafTestRule}
+			if tt.mode != "" {
+				opts["mode"] = tt.mode
+			}
+			result, err := newMiddlewareTest(WAF, &testArgs{
+				middlewareOpt: opts,
+				reqURL:        nettypes.MustParseURL("https://example.com/?" + tt.query),
+			})
+			expect.NoError(t, err)
+			expect.Equal(t, result.ResponseStatus, tt.status)
+			expect.Equal(t, result.RequestHeaders != nil, tt.passed)
+		})
+	}
+}
+
+func TestValidateWAFRules(t *testing.T) {
+	for _, rules := range []string{
+		"Include /etc/passwd",
+		"  SecAuditLogStorageDir /tmp",
+		"# comment\nSECDEBUGLOG /tmp/debug.log",
+		"SecTmpDir /tmp",
+	} {
+		expect.HasError(t, validateWAFRules(rules), rules)
+	}
+	for _, rules := range []string{
+		wafTestRule,
+		"# Include /etc/passwd",
+		"SecRule ARGS \"@rx x\" \\\n  \"id:1,deny\"",
+	} {
+		expect.NoError(t, validateWAFRules(rules), rules)
+	}
+}
+
+func TestWAFRuleFiles(t *testing.T) {
+	wafRulesDir = t.TempDir()
+	t.Cleanup(func() { wafRulesDir = common.WAFRulesBasePath })
+	expect.NoError(t, os.WriteFile(filepath.Join(wafRulesDir, "test.conf"), []byte(wafTestRule), 0o644))
+
+	result, err := newMiddlewareTest(WAF, &testArgs{
+		middlewareOpt: OptionsRaw{"rule_files": []string{"*.conf"}},
+		reqURL:        nettypes.MustParseURL("https://example.com/?id=1337"),
+	})
+	expect.NoError(t, err)
+	expect.Equal(t, result.ResponseStatus, http.StatusTeapot)
+
+	// includes in rule files only read the bundled CRS
+	expect.NoError(t, os.WriteFile(filepath.Join(wafRulesDir, "include.conf"), []byte("Include /etc/passwd"), 0o644))
+	_, err = WAF.New(OptionsRaw{"rule_files": []string{"include.conf"}})
+	expect.HasError(t, err)
+}
+
+func TestWAFRuleFilesSymlink(t *testing.T) {
+	wafRulesDir = t.TempDir()
+	t.Cleanup(func() { wafRulesDir = common.WAFRulesBasePath })
+	outside := filepath.Join(t.TempDir(), "outside.conf")
+	expect.NoError(t, os.WriteFile(outside, []byte(wafTestRule), 0o644))
+	expect.NoError(t, os.Symlink(outside, filepath.Join(wafRulesDir, "link.conf")))
+
+	_, err := WAF.New(OptionsRaw{"rule_files": []string{"link.conf"}})
+	expect.HasError(t, err)
+}
+
+func TestWAFCRS(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		query  string
+		body   string
+		status int
+	}{
+		{name: "clean request", query: "q=hello", status: http.StatusOK},
+		{name: "sql injection", query: "id=" + url.QueryEscape("1' OR '1'='1"), status: http.StatusForbidden},
+		{name: "xss in body", method: http.MethodPost, body: "comment=" + url.QueryEscape("<script>alert(1)</script>"), status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := &testArgs{
+				middlewareOpt: OptionsRaw{"crs": true},
+				reqURL:        nettypes.MustParseURL("https://example.com/?" + tt.query),
+				reqMethod:     tt.method,
+			}
+			if tt.body != "" {
+				args.headers = http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}
+				args.body = []byte(tt.body)
+			}
+			result, err := newMiddlewareTest(WAF, args)
+			expect.NoError(t, err)
+			expect.Equal(t, result.ResponseStatus, tt.status)
+		})
+	}
+}
+
+func TestWAFAnnotations(t *testing.T) {
+	mid, err := WAF.New(OptionsRaw{"crs": true})
+	expect.NoError(t, err)
+	waf := mid.impl.(*wafMiddleware)
+
+	req := accesslog.WithAnnotations(httptest.NewRequest(http.MethodGet, "/?id="+url.QueryEscape("1' OR '1'='1"), nil))
+	w := httptest.NewRecorder()
+	expect.False(t, waf.before(w, req))
+	expect.Equal(t, w.Code, http.StatusForbidden)
+
+	annotations := maps.Collect(accesslog.Annotations(req))
+	expect.Equal(t, annotations[wafAnnotationAction], "deny")
+	expect.True(t, strings.Contains(annotations[wafAnnotationRules], "942100"))
+	expect.True(t, strings.HasSuffix(annotations[wafAnnotationRules], "949110"), "the anomaly score rule should interrupt")
+
+	t.Run("excluded rules", func(t *testing.T) {
+		mid, err := WAF.New(OptionsRaw{"crs": true, "exclude_rules": []string{"942000-942999"}})
+		expect.NoError(t, err)
+		req := httptest.NewRequest(http.MethodGet, "/?id="+url.QueryEscape("1' OR '1'='1"), nil)
+		expect.True(t, mid.impl.(*wafMiddleware).before(httptest.NewRecorder(), req))
+	})
+}
+
+type wafTestRoute struct {
+	types.HTTPRoute
+	name string
+}
+
+func (r wafTestRoute) Name() string {
+	return r.name
+}
+
+func TestWAFRouteExclusions(t *testing.T) {
+	mid, err := WAF.New(OptionsRaw{
+		"crs":   true,
+		"rules": wafTestRule,
+		"route_exclusions": map[string]any{
+			"app":  []string{"942000-942999"},
+			"test": []string{"10001"},
+		},
+	})
+	expect.NoError(t, err)
+	waf := mid.impl.(*wafMiddleware)
+
+	tests := []struct {
+		route   string
+		query   string
+		proceed bool
+	}{
+		{route: "", query: "id=" + url.QueryEscape("1' OR '1'='1")},
+		{route: "other", query: "id=" + url.QueryEscape("1' OR '1'='1")},
+		{route: "app", query: "id=" + url.QueryEscape("1' OR '1'='1"), proceed: true},
+		{route: "app", query: "id=1337"},
+		{route: "test", query: "id=1337", proceed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.route+"?"+tt.query, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+			if tt.route != "" {
+				req = routes.WithRouteContext(req, wafTestRoute{name: tt.route})
+			}
+			expect.Equal(t, waf.before(httptest.NewRecorder(), req), tt.proceed)
+		})
+	}
+}
+
+func TestWAFInstances(t *testing.T) {
+	key := func() string {
+		opts := OptionsRaw{"rules": `SecRule ARGS:id "@streq 1338" "id:10002,phase:1,deny,log"`}
+		mid, err := WAF.New(opts)
+		expect.NoError(t, err)
+		other, err := WAF.New(opts)
+		expect.NoError(t, err)
+		waf := mid.impl.(*wafMiddleware)
+		expect.True(t, waf.waf == other.impl.(*wafMiddleware).waf, "the instance should be shared")
+		return waf.directives(nil)
+	}()
+	_, ok := wafInstances.Load(key)
+	expect.True(t, ok)
+
+	// evicted once no middleware refers to it, e.g. after a reload
+	deadline := time.Now().Add(5 * time.Second)
+	for ok && time.Now().Before(deadline) {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+		_, ok = wafInstances.Load(key)
+	}
+	expect.False(t, ok)
+}
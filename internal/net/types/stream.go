@@ -6,6 +6,9 @@ import (
 )
 
 type Stream interface {
+	// ListenAndServe serves until ctx is canceled.
+	// preDial is called before dialing the destination of each connection with a context
+	// that is canceled when the connection is closed, onRead is called on each read.
 	ListenAndServe(ctx context.Context, preDial, onRead HookFunc)
 	LocalAddr() net.Addr
 	Close() error
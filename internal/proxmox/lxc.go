@@ -20,6 +20,13 @@ type (
 	nameOnly struct {
 		Name string `json:"name"`
 	}
+	// LXCUsage is the resource usage of a container from its current status.
+	LXCUsage struct {
+		CPU    float64 `json:"cpu"`  // fraction of the allocated cores, 0-1
+		CPUs   float64 `json:"cpus"` // number of allocated cores
+		NetIn  uint64  `json:"netin"`
+		NetOut uint64  `json:"netout"`
+	}
 )
 
 const (
@@ -98,6 +105,15 @@ func (n *Node) LXCStatus(ctx context.Context, vmid int) (LXCStatus, error) {
 	return status.Status, nil
 }
 
+// LXCUsage returns the CPU usage and cumulative network counters from the container's current status.
+func (n *Node) LXCUsage(ctx context.Context, vmid int) (*LXCUsage, error) {
+	var usage LXCUsage
+	if err := n.client.Get(ctx, fmt.Sprintf("/nodes/%s/lxc/%d/status/current", n.name, vmid), &usage); err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
 func (n *Node) LXCIsRunning(ctx context.Context, vmid int) (bool, error) {
 	status, err := n.LXCStatus(ctx, vmid)
 	return status == LXCStatusRunning, err
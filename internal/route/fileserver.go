@@ -143,6 +143,7 @@ func (s *FileServer) RootPath() string {
 
 // ServeHTTP implements http.Handler.
 func (s *FileServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	req = accesslog.WithAnnotations(req)
 	if s.accessLogger != nil {
 		rec := accesslog.GetResponseRecorder(w)
 		w = rec
@@ -0,0 +1,125 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/yusing/godoxy/internal/discovery"
+	"github.com/yusing/godoxy/internal/route"
+	"github.com/yusing/godoxy/internal/serialization"
+	"github.com/yusing/godoxy/internal/watcher"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// DiscoveryProvider loads routes from a service discovery source, e.g. Consul.
+type DiscoveryProvider struct {
+	name   string
+	source discovery.Source
+	l      zerolog.Logger
+
+	entriesMu sync.RWMutex
+	entries   map[string]string // alias -> serialized entry
+	changed   map[string]bool   // aliases changed by the last load
+}
+
+const discoveryLoadTimeout = 10 * time.Second
+
+func DiscoveryProviderImpl(name string, source discovery.Source) (ProviderImpl, error) {
+	if name == "" {
+		return nil, ErrEmptyProviderName
+	}
+	if err := source.Init(); err != nil {
+		return nil, err
+	}
+	return &DiscoveryProvider{
+		name:   name,
+		source: source,
+		l:      log.With().Str("type", source.String()).Str("name", name).Logger(),
+	}, nil
+}
+
+func (p *DiscoveryProvider) String() string {
+	return p.source.String() + "@" + p.name
+}
+
+func (p *DiscoveryProvider) ShortName() string {
+	return p.name
+}
+
+func (p *DiscoveryProvider) IsExplicitOnly() bool {
+	return false
+}
+
+func (p *DiscoveryProvider) Logger() *zerolog.Logger {
+	return &p.l
+}
+
+func (p *DiscoveryProvider) NewWatcher() watcher.Watcher {
+	return watcher.NewDiscoveryWatcher(p.String(), p.source)
+}
+
+// isChanged reports whether the route with alias was added or modified by the last load.
+func (p *DiscoveryProvider) isChanged(alias string) bool {
+	p.entriesMu.RLock()
+	defer p.entriesMu.RUnlock()
+	return p.changed[alias]
+}
+
+// loadRoutesImpl loads the routes from the source.
+//
+// Entries are not env substituted, remote sources must not read the environment of GoDoxy,
+// and may only set the fields in remoteRouteFields.
+func (p *DiscoveryProvider) loadRoutesImpl() (route.Routes, gperr.Error) {
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryLoadTimeout)
+	defer cancel()
+
+	entries, err := p.source.Load(ctx)
+	if err != nil && len(entries) == 0 {
+		return nil, err
+	}
+
+	errs := gperr.NewBuilder("")
+	errs.Add(err)
+
+	routes := make(route.Routes, len(entries))
+	serialized := make(map[string]string, len(entries))
+	for alias, entry := range entries {
+		if strings.HasPrefix(alias, "x-") {
+			continue
+		}
+		// map keys are sorted, equal entries are serialized equally
+		data, err := sonic.ConfigStd.Marshal(entry)
+		if err != nil {
+			errs.Add(gperr.Wrap(err).Subject(alias))
+			continue
+		}
+		if err := validateRemoteRoute(entry); err != nil {
+			errs.Add(err.Subject(alias))
+			continue
+		}
+		r := &route.Route{Alias: alias}
+		if err := serialization.MapUnmarshalValidate(entry, r); err != nil {
+			errs.Add(err.Subject(alias))
+			continue
+		}
+		routes[alias] = r
+		serialized[alias] = string(data)
+	}
+
+	p.entriesMu.Lock()
+	changed := make(map[string]bool)
+	for alias, data := range serialized {
+		if old, ok := p.entries[alias]; !ok || old != data {
+			changed[alias] = true
+		}
+	}
+	p.entries, p.changed = serialized, changed
+	p.entriesMu.Unlock()
+
+	return routes, errs.Error()
+}
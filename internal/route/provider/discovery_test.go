@@ -0,0 +1,87 @@
+package provider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/yusing/godoxy/internal/discovery"
+	routeTypes "github.com/yusing/godoxy/internal/route/types"
+	expect "github.com/yusing/goutils/testing"
+)
+
+func newTestDiscoveryProvider(t *testing.T, body *atomic.Value) *DiscoveryProvider {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body.Load().(string)))
+	}))
+	t.Cleanup(srv.Close)
+	p, err := DiscoveryProviderImpl("cmdb", &discovery.HTTPConfig{URL: srv.URL})
+	expect.NoError(t, err)
+	return p.(*DiscoveryProvider)
+}
+
+func TestDiscoveryProvider(t *testing.T) {
+	var body atomic.Value
+	body.Store(`{
+		"app": {"host": "10.0.0.5", "port": "8080", "healthcheck": {"path": "/ping"}},
+		"db": {"scheme": "tcp", "host": "10.0.0.6", "port": "5432:5432"}
+	}`)
+	p := newTestDiscoveryProvider(t, &body)
+	expect.Equal(t, p.String(), "http@cmdb")
+
+	routes, err := p.loadRoutesImpl()
+	expect.NoError(t, err)
+	expect.Equal(t, len(routes), 2)
+	expect.Equal(t, routes["app"].Host, "10.0.0.5")
+	expect.Equal(t, routes["app"].Port.Proxy, 8080)
+	expect.Equal(t, routes["app"].HealthCheck.Path, "/ping")
+	expect.Equal(t, routes["db"].Scheme, routeTypes.SchemeTCP)
+	expect.True(t, p.isChanged("app"))
+	expect.True(t, p.isChanged("db"))
+
+	// unchanged routes are not restarted
+	_, err = p.loadRoutesImpl()
+	expect.NoError(t, err)
+	expect.False(t, p.isChanged("app"))
+	expect.False(t, p.isChanged("db"))
+
+	body.Store(`{
+		"db": {"port": "5432:5432", "host": "10.0.0.6", "scheme": "tcp"},
+		"app": {"host": "10.0.0.7", "port": "8080", "healthcheck": {"path": "/ping"}}
+	}`)
+	_, err = p.loadRoutesImpl()
+	expect.NoError(t, err)
+	expect.True(t, p.isChanged("app"))
+	expect.False(t, p.isChanged("db"))
+}
+
+func TestDiscoveryProviderNoEnvSubstitution(t *testing.T) {
+	t.Setenv("GODOXY_TEST_SECRET", "secret")
+	var body atomic.Value
+	body.Store(`{"app": {"host": "10.0.0.5", "homepage": {"name": "${GODOXY_TEST_SECRET}"}}}`)
+	p := newTestDiscoveryProvider(t, &body)
+
+	routes, err := p.loadRoutesImpl()
+	expect.NoError(t, err)
+	expect.Equal(t, routes["app"].Homepage.Name, "${GODOXY_TEST_SECRET}")
+}
+
+func TestDiscoveryProviderRemoteFields(t *testing.T) {
+	var body atomic.Value
+	body.Store(`{
+		"app": {"host": "10.0.0.5", "port": "8080"},
+		"files": {"scheme": "fileserver", "root": "/"},
+		"cmd": {"host": "10.0.0.6", "idlewatcher": {"exec": {"start": "touch /tmp/x"}}},
+		"log": {"host": "10.0.0.7", "access_log": {"path": "/etc/cron.d/x"}},
+		"rules": {"host": "10.0.0.8", "rule_file": "/etc/passwd"}
+	}`)
+	p := newTestDiscoveryProvider(t, &body)
+
+	routes, err := p.loadRoutesImpl()
+	expect.ErrorIs(t, ErrRemoteRouteField, err)
+	expect.ErrorIs(t, ErrRemoteRouteScheme, err)
+	expect.Equal(t, len(routes), 1)
+	expect.NotNil(t, routes["app"])
+}
@@ -3,10 +3,12 @@ package provider
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strconv"
 	"time"
 
 	"github.com/goccy/go-yaml"
+	"github.com/moby/moby/api/types/swarm"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/yusing/godoxy/internal/docker"
@@ -73,6 +75,11 @@ func (p *DockerProvider) loadRoutesImpl() (route.Routes, gperr.Error) {
 	for _, c := range containers {
 		container := docker.FromDocker(&c, p.dockerCfg)
 
+		// tasks are discovered from their services in swarm mode
+		if p.dockerCfg.Swarm && docker.IsSwarmTask(container) {
+			continue
+		}
+
 		if container.Errors != nil {
 			errs.Add(gperr.PrependSubject(container.ContainerName, container.Errors))
 			continue
@@ -90,26 +97,111 @@ func (p *DockerProvider) loadRoutesImpl() (route.Routes, gperr.Error) {
 		if err != nil {
 			errs.Add(err.Subject(container.ContainerName))
 		}
-		for k, v := range newEntries {
-			if conflict, ok := routes[k]; ok {
-				err := gperr.Multiline().
-					Addf("route with alias %s already exists", k).
-					Addf("container %s", container.ContainerName).
-					Addf("conflicting container %s", conflict.Container.ContainerName)
-				if conflict.ShouldExclude() || v.ShouldExclude() {
-					gperr.LogWarn("skipping conflicting route", err)
-				} else {
-					errs.Add(err)
-				}
+		addDockerRoutes(routes, newEntries, container.ContainerName, &errs)
+	}
+
+	if p.dockerCfg.Swarm {
+		services, err := docker.ListSwarmServices(ctx, p.dockerCfg)
+		if err != nil {
+			errs.Add(gperr.Wrap(err, "failed to list swarm services"))
+		}
+		for i := range services {
+			svc := &services[i]
+			newEntries, err := p.routesFromSwarmService(svc)
+			if err != nil {
+				errs.Add(err.Subject(svc.Spec.Name))
+			}
+			addDockerRoutes(routes, newEntries, svc.Spec.Name, &errs)
+		}
+	}
+
+	return routes, errs.Error()
+}
+
+func addDockerRoutes(routes, newEntries route.Routes, containerName string, errs *gperr.Builder) {
+	for k, v := range newEntries {
+		if conflict, ok := routes[k]; ok {
+			err := gperr.Multiline().
+				Addf("route with alias %s already exists", k).
+				Addf("container %s", containerName).
+				Addf("conflicting container %s", conflict.Container.ContainerName)
+			if conflict.ShouldExclude() || v.ShouldExclude() {
+				gperr.LogWarn("skipping conflicting route", err)
 			} else {
-				routes[k] = v
+				errs.Add(err)
 			}
+		} else {
+			routes[k] = v
 		}
 	}
+}
+
+// routesFromSwarmService returns the routes for the running tasks of a swarm service.
+//
+// When a service has multiple tasks all reachable by their IPs, a route is created for each task
+// with alias "<alias>.<slot>", load balanced under the original alias.
+// Otherwise a single route is created for the service.
+func (p *DockerProvider) routesFromSwarmService(svc *docker.SwarmService) (route.Routes, gperr.Error) {
+	errs := gperr.NewBuilder("")
 
+	tasks := make([]*swarm.Task, 0, len(svc.Tasks))
+	containers := make([]*types.Container, 0, len(svc.Tasks))
+	for i := range svc.Tasks {
+		task := &svc.Tasks[i]
+		container := docker.FromSwarmTask(&svc.Service, task, p.dockerCfg)
+		if container.Errors != nil {
+			errs.Add(gperr.PrependSubject(swarmTaskName(svc, task), container.Errors))
+			continue
+		}
+		tasks = append(tasks, task)
+		containers = append(containers, container)
+	}
+	if len(containers) == 0 {
+		return make(route.Routes), errs.Error()
+	}
+
+	// without task IPs, the service is reached through the routing mesh
+	noIP := slices.IndexFunc(containers, func(c *types.Container) bool {
+		return c.PrivateHostname == ""
+	})
+	if len(containers) == 1 || noIP != -1 {
+		routes, err := p.routesFromContainerLabels(containers[max(noIP, 0)])
+		errs.Add(err)
+		return routes, errs.Error()
+	}
+
+	routes := make(route.Routes)
+	for i, container := range containers {
+		taskRoutes, err := p.routesFromContainerLabels(container)
+		if i == 0 {
+			// labels are the same for all tasks, report once
+			errs.Add(err)
+		}
+		for alias, r := range taskRoutes {
+			if r.LoadBalance == nil {
+				r.LoadBalance = new(types.LoadBalancerConfig)
+			}
+			if r.LoadBalance.Link == "" {
+				r.LoadBalance.Link = alias
+			}
+			routes[alias+"."+swarmTaskSuffix(tasks[i])] = r
+		}
+	}
 	return routes, errs.Error()
 }
 
+func swarmTaskName(svc *docker.SwarmService, task *swarm.Task) string {
+	return svc.Spec.Name + "." + swarmTaskSuffix(task)
+}
+
+// swarmTaskSuffix returns the slot of replicated service tasks, or the node ID of global service tasks.
+func swarmTaskSuffix(task *swarm.Task) string {
+	if task.Slot > 0 {
+		return strconv.Itoa(task.Slot)
+	}
+	return task.NodeID
+}
+
 // Returns a list of proxy entries for a container.
 // Always non-nil.
 func (p *DockerProvider) routesFromContainerLabels(container *types.Container) (route.Routes, gperr.Error) {
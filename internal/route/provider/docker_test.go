@@ -2,11 +2,13 @@ package provider
 
 import (
 	"net/netip"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/moby/moby/api/types/container"
 	"github.com/moby/moby/api/types/network"
+	"github.com/moby/moby/api/types/swarm"
 	"github.com/moby/moby/client"
 	D "github.com/yusing/godoxy/internal/docker"
 	"github.com/yusing/godoxy/internal/route"
@@ -381,3 +383,80 @@ func TestImplicitExcludeDatabase(t *testing.T) {
 		expect.True(t, r.ShouldExclude())
 	})
 }
+
+func swarmService(tasks ...string) *D.SwarmService {
+	svc := &D.SwarmService{
+		Service: swarm.Service{
+			ID: "svc1",
+			Spec: swarm.ServiceSpec{
+				Annotations: swarm.Annotations{
+					Name: "web",
+					Labels: map[string]string{
+						"proxy.web.port":              "8080",
+						"proxy.web.load_balance.mode": "leastconn",
+					},
+				},
+				TaskTemplate: swarm.TaskSpec{ContainerSpec: &swarm.ContainerSpec{Image: "nginx"}},
+			},
+		},
+	}
+	for i, ip := range tasks {
+		task := swarm.Task{
+			ID:        "task" + strconv.Itoa(i+1) + "abcdefghijklmnopqrstu",
+			ServiceID: svc.ID,
+			Slot:      i + 1,
+		}
+		if ip != "" {
+			task.NetworksAttachments = []swarm.NetworkAttachment{{
+				Network:   swarm.Network{ID: "net1", Spec: swarm.NetworkSpec{Annotations: swarm.Annotations{Name: "overlay"}}},
+				Addresses: []netip.Prefix{netip.MustParsePrefix(ip + "/24")},
+			}}
+		}
+		svc.Tasks = append(svc.Tasks, task)
+	}
+	return svc
+}
+
+func TestSwarmServiceLoadBalance(t *testing.T) {
+	p := &DockerProvider{name: "test", dockerCfg: types.DockerProviderConfig{URL: client.DefaultDockerHost, Swarm: true}}
+
+	routes := expect.Must(p.routesFromSwarmService(swarmService("10.0.1.5", "10.0.1.6")))
+	expect.Equal(t, len(routes), 2)
+	for i, ip := range []string{"10.0.1.5", "10.0.1.6"} {
+		r, ok := routes["web."+strconv.Itoa(i+1)]
+		expect.True(t, ok)
+		r.Finalize()
+		expect.Equal(t, r.Host, ip)
+		expect.Equal(t, r.Port.Proxy, 8080)
+		expect.Equal(t, r.LoadBalance.Link, "web")
+		expect.Equal(t, r.LoadBalance.Mode, types.LoadbalanceModeLeastConn)
+		expect.Equal(t, r.Container.SwarmService.TaskSlot, i+1)
+		expect.False(t, r.IsDocker())
+	}
+
+	t.Run("single task", func(t *testing.T) {
+		routes := expect.Must(p.routesFromSwarmService(swarmService("10.0.1.5")))
+		r, ok := routes["web"]
+		expect.True(t, ok)
+		expect.Equal(t, r.LoadBalance.Link, "")
+	})
+
+	t.Run("routing mesh", func(t *testing.T) {
+		routes := expect.Must(p.routesFromSwarmService(swarmService("", "")))
+		expect.Equal(t, len(routes), 1)
+		r, ok := routes["web"]
+		expect.True(t, ok)
+		r.Finalize()
+		expect.Equal(t, r.Host, "127.0.0.1")
+	})
+
+	t.Run("task without ip", func(t *testing.T) {
+		routes := expect.Must(p.routesFromSwarmService(swarmService("10.0.1.5", "")))
+		expect.Equal(t, len(routes), 1)
+		r, ok := routes["web"]
+		expect.True(t, ok)
+		r.Finalize()
+		expect.Equal(t, r.Host, "127.0.0.1")
+		expect.Equal(t, r.LoadBalance.Link, "")
+	})
+}
@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"github.com/yusing/godoxy/internal/docker"
 	"github.com/yusing/godoxy/internal/route"
 	provider "github.com/yusing/godoxy/internal/route/provider/types"
 	"github.com/yusing/godoxy/internal/watcher"
@@ -69,10 +70,21 @@ func (handler *EventHandler) matchAny(events []watcher.Event, route *route.Route
 func (handler *EventHandler) match(event watcher.Event, route *route.Route) bool {
 	switch handler.provider.GetType() {
 	case provider.ProviderTypeDocker, provider.ProviderTypeAgent:
+		if svc := route.Container.SwarmService; svc != nil {
+			// service events, task changes, or containers of the service on this node
+			return svc.ID == event.ActorID || svc.ID == event.ActorAttributes[docker.LabelSwarmServiceID]
+		}
 		return route.Container.ContainerID == event.ActorID ||
 			route.Container.ContainerName == event.ActorName
 	case provider.ProviderTypeFile:
 		return true
+	case provider.ProviderTypeKubernetes:
+		return event.Action == eventsPkg.ActionForceReload ||
+			handler.provider.ProviderImpl.(*KubernetesProvider).dependsOn(route.Alias, event.ActorName)
+	case provider.ProviderTypeConsul, provider.ProviderTypeEtcd, provider.ProviderTypeHTTP:
+		return handler.provider.ProviderImpl.(*DiscoveryProvider).isChanged(route.Alias)
+	case provider.ProviderTypeGit:
+		return handler.provider.ProviderImpl.(*GitProvider).isChanged(route.Alias)
 	}
 	// should never happen
 	return false
@@ -0,0 +1,244 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"maps"
+	"net/http"
+	"path"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/yusing/godoxy/internal/git"
+	"github.com/yusing/godoxy/internal/route"
+	"github.com/yusing/godoxy/internal/serialization"
+	"github.com/yusing/godoxy/internal/types"
+	"github.com/yusing/godoxy/internal/watcher"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// GitProvider loads route files from a directory of a Git repository.
+//
+// Route files are validated before a commit is applied, a commit failing validation is rejected and the applied commit is kept.
+// Route files are not env substituted, and may only set the fields in remoteRouteFields.
+type GitProvider struct {
+	name    string
+	cfg     *git.Config
+	l       zerolog.Logger
+	webhook chan struct{}
+
+	mu        sync.RWMutex
+	revision  string            // applied commit
+	rejected  string            // last commit failing validation
+	files     map[string][]byte // route files of the applied commit by name
+	aliasFile map[string]string // alias -> route file name
+	changed   map[string]bool   // route files changed by the last load
+}
+
+const gitLoadTimeout = time.Minute
+
+var (
+	ErrGitValidationFailed = gperr.New("validation failed")
+	ErrGitWebhookDisabled  = gperr.New("webhook is disabled")
+)
+
+func GitProviderImpl(name string, cfg *git.Config) (ProviderImpl, error) {
+	if name == "" {
+		return nil, ErrEmptyProviderName
+	}
+	if err := cfg.Init(); err != nil {
+		return nil, err
+	}
+	return &GitProvider{
+		name:    name,
+		cfg:     cfg,
+		l:       log.With().Str("type", "git").Str("name", name).Logger(),
+		webhook: make(chan struct{}, 1),
+	}, nil
+}
+
+// GitProviderOf returns the Git provider implementation of p.
+func GitProviderOf(p types.RouteProvider) (*GitProvider, bool) {
+	if p, ok := p.(*Provider); ok {
+		gp, ok := p.ProviderImpl.(*GitProvider)
+		return gp, ok
+	}
+	return nil, false
+}
+
+func (p *GitProvider) String() string {
+	return "git@" + p.name
+}
+
+func (p *GitProvider) ShortName() string {
+	return p.name
+}
+
+func (p *GitProvider) IsExplicitOnly() bool {
+	return false
+}
+
+func (p *GitProvider) Logger() *zerolog.Logger {
+	return &p.l
+}
+
+func (p *GitProvider) NewWatcher() watcher.Watcher {
+	return watcher.NewGitWatcher(p.cfg, p.webhook, p.isUpToDate)
+}
+
+// Revision returns the applied commit id, or empty if no commit is applied.
+func (p *GitProvider) Revision() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.revision
+}
+
+// Webhook verifies a push webhook and triggers a pull.
+func (p *GitProvider) Webhook(header http.Header, body []byte) gperr.Error {
+	if p.cfg.WebhookSecret == "" {
+		return ErrGitWebhookDisabled
+	}
+	if err := git.VerifyWebhook(p.cfg.WebhookSecret.String(), header, body); err != nil {
+		return gperr.Wrap(err)
+	}
+	select {
+	case p.webhook <- struct{}{}:
+	default: // a pull is already pending
+	}
+	return nil
+}
+
+func (p *GitProvider) isUpToDate(commit string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return commit == p.revision || commit == p.rejected
+}
+
+// isChanged reports whether the route file of the route with alias was changed by the last load.
+func (p *GitProvider) isChanged(alias string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.changed[p.aliasFile[alias]]
+}
+
+func isRouteFile(name string) bool {
+	switch path.Ext(name) {
+	case ".yml", ".yaml":
+		return true
+	}
+	return false
+}
+
+// loadRoutesImpl applies the commit of the ref if it is new and valid, then loads the routes of the applied commit.
+//
+// If the ref cannot be resolved or the commit is rejected, the routes of the applied commit are returned with the error.
+func (p *GitProvider) loadRoutesImpl() (route.Routes, gperr.Error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitLoadTimeout)
+	defer cancel()
+
+	p.mu.Lock()
+	p.changed = nil
+	p.mu.Unlock()
+
+	var err gperr.Error
+	commit, resolveErr := p.cfg.Remote().ResolveRef(ctx, p.cfg.Ref)
+	switch {
+	case resolveErr != nil:
+		err = gperr.Wrap(resolveErr, "failed to resolve ref")
+	case !p.isUpToDate(commit):
+		err = p.apply(ctx, commit)
+	}
+
+	p.mu.RLock()
+	files := p.files
+	p.mu.RUnlock()
+
+	routes := make(route.Routes)
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		fileRoutes, _ := validateRemote(files[name])
+		maps.Copy(routes, fileRoutes)
+	}
+	if err != nil && len(routes) > 0 {
+		p.l.Warn().Str("revision", p.Revision()).Msg("keeping the applied revision")
+	}
+	return routes, err
+}
+
+// validateRemote validates a route file like validate, without env substitution
+// and with the fields of routes restricted to remoteRouteFields.
+func validateRemote(data []byte) (routes route.Routes, err gperr.Error) {
+	m := make(map[string]any)
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, gperr.Wrap(err)
+	}
+	_ = removeXPrefix(m)
+
+	errs := gperr.NewBuilder("")
+	for _, alias := range slices.Sorted(maps.Keys(m)) {
+		// entries of other types are rejected by MapUnmarshalValidate
+		entry, ok := m[alias].(map[string]any)
+		if !ok {
+			continue
+		}
+		if err := validateRemoteRoute(entry); err != nil {
+			errs.Add(err.Subject(alias))
+		}
+	}
+	if errs.HasError() {
+		return nil, errs.Error()
+	}
+	err = serialization.MapUnmarshalValidate(m, &routes)
+	return routes, err
+}
+
+// apply fetches and validates the route files of a commit, then applies it if valid.
+func (p *GitProvider) apply(ctx context.Context, commit string) gperr.Error {
+	files, err := p.cfg.Remote().Files(ctx, commit, p.cfg.Path)
+	if err != nil {
+		return gperr.Wrap(err, "failed to fetch "+commit)
+	}
+
+	errs := gperr.NewBuilder("")
+	routeFiles := make(map[string][]byte, len(files))
+	aliasFile := make(map[string]string)
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		if !isRouteFile(name) {
+			continue
+		}
+		data := files[name]
+		routes, err := validateRemote(data)
+		if err != nil {
+			errs.Add(err.Subject(name))
+			continue
+		}
+		for alias := range routes {
+			if other, ok := aliasFile[alias]; ok {
+				errs.Add(gperr.Errorf("duplicate alias, first defined in %s", other).Subject(alias).Subject(name))
+				continue
+			}
+			aliasFile[alias] = name
+		}
+		routeFiles[name] = data
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if errs.HasError() {
+		p.rejected = commit
+		return ErrGitValidationFailed.Subject(commit).With(errs.Error())
+	}
+	changed := make(map[string]bool)
+	for name, data := range routeFiles {
+		if old, ok := p.files[name]; !ok || !bytes.Equal(old, data) {
+			changed[name] = true
+		}
+	}
+	p.revision, p.rejected = commit, ""
+	p.files, p.aliasFile, p.changed = routeFiles, aliasFile, changed
+	p.l.Info().Str("revision", commit).Int("files", len(routeFiles)).Msg("applied revision")
+	return nil
+}
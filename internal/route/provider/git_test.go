@@ -0,0 +1,141 @@
+package provider
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+
+	"github.com/yusing/godoxy/internal/git"
+	"github.com/yusing/godoxy/internal/git/gittest"
+	expect "github.com/yusing/goutils/testing"
+)
+
+func newTestGitProvider(t *testing.T, cfg func(*git.Config)) (*GitProvider, *gittest.Server) {
+	t.Helper()
+	srv := gittest.NewServer(t)
+	c := srv.Config()
+	c.Path = "routes"
+	if cfg != nil {
+		cfg(c)
+	}
+	p, err := GitProviderImpl("infra", c)
+	expect.NoError(t, err)
+	return p.(*GitProvider), srv
+}
+
+func TestGitProvider(t *testing.T) {
+	p, srv := newTestGitProvider(t, nil)
+	expect.Equal(t, p.String(), "git@infra")
+
+	c1 := srv.Commit(map[string]string{
+		"README.md":      "# routes",
+		"routes/app.yml": "app:\n  host: 10.0.0.5\n  port: 8080\n",
+		"routes/db.yaml": "db:\n  scheme: tcp\n  host: 10.0.0.6\n  port: 5432:5432\n",
+		"other/x.yml":    "x:\n  host: 10.0.0.7\n",
+	})
+	routes, err := p.loadRoutesImpl()
+	expect.NoError(t, err)
+	expect.Equal(t, len(routes), 2)
+	expect.Equal(t, routes["app"].Host, "10.0.0.5")
+	expect.Equal(t, routes["db"].Host, "10.0.0.6")
+	expect.Equal(t, p.Revision(), c1)
+	expect.True(t, p.isChanged("app"))
+	expect.True(t, p.isChanged("db"))
+
+	// the applied commit is not fetched again
+	routes, err = p.loadRoutesImpl()
+	expect.NoError(t, err)
+	expect.Equal(t, len(routes), 2)
+	expect.Equal(t, srv.Fetches(), 1)
+	expect.False(t, p.isChanged("app"))
+
+	// only routes of changed files are restarted
+	c2 := srv.Commit(map[string]string{
+		"routes/app.yml": "app:\n  host: 10.0.0.8\n  port: 8080\n",
+		"routes/db.yaml": "db:\n  scheme: tcp\n  host: 10.0.0.6\n  port: 5432:5432\n",
+	})
+	routes, err = p.loadRoutesImpl()
+	expect.NoError(t, err)
+	expect.Equal(t, routes["app"].Host, "10.0.0.8")
+	expect.Equal(t, p.Revision(), c2)
+	expect.True(t, p.isChanged("app"))
+	expect.False(t, p.isChanged("db"))
+}
+
+func TestGitProviderKeepsLastGoodRevision(t *testing.T) {
+	p, srv := newTestGitProvider(t, nil)
+
+	c1 := srv.Commit(map[string]string{"routes/app.yml": "app:\n  host: 10.0.0.5\n"})
+	_, err := p.loadRoutesImpl()
+	expect.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{"invalid yaml", map[string]string{"routes/app.yml": "app: [\n"}},
+		{"invalid route", map[string]string{"routes/app.yml": "app:\n  host: 10.0.0.5\n  port: abc\n"}},
+		{"duplicate alias", map[string]string{
+			"routes/app.yml":  "app:\n  host: 10.0.0.5\n",
+			"routes/app2.yml": "app:\n  host: 10.0.0.6\n",
+		}},
+		{"forbidden field", map[string]string{"routes/app.yml": "app:\n  host: 10.0.0.5\n  access_log:\n    path: /etc/passwd\n"}},
+		{"fileserver", map[string]string{"routes/app.yml": "app:\n  scheme: fileserver\n  root: /\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rejected := srv.Commit(tt.files)
+			routes, err := p.loadRoutesImpl()
+			expect.ErrorIs(t, ErrGitValidationFailed, err)
+			expect.Equal(t, len(routes), 1)
+			expect.Equal(t, routes["app"].Host, "10.0.0.5")
+			expect.Equal(t, p.Revision(), c1)
+			expect.False(t, p.isChanged("app"))
+			expect.True(t, p.isUpToDate(rejected))
+
+			// the rejected commit is not fetched again
+			fetches := srv.Fetches()
+			_, err = p.loadRoutesImpl()
+			expect.NoError(t, err)
+			expect.Equal(t, srv.Fetches(), fetches)
+		})
+	}
+}
+
+func TestGitProviderNoEnvSubstitution(t *testing.T) {
+	t.Setenv("GODOXY_TEST_SECRET", "s3cret")
+	p, srv := newTestGitProvider(t, nil)
+	srv.Commit(map[string]string{"routes/app.yml": "app:\n  host: 10.0.0.5\n  homepage:\n    name: ${GODOXY_TEST_SECRET}\n"})
+	routes, err := p.loadRoutesImpl()
+	expect.NoError(t, err)
+	expect.Equal(t, routes["app"].Homepage.Name, "${GODOXY_TEST_SECRET}")
+}
+
+func TestGitProviderFirstRevisionInvalid(t *testing.T) {
+	p, srv := newTestGitProvider(t, nil)
+	srv.Commit(map[string]string{"routes/app.yml": "app: [\n"})
+	routes, err := p.loadRoutesImpl()
+	expect.ErrorIs(t, ErrGitValidationFailed, err)
+	expect.Equal(t, len(routes), 0)
+	expect.Equal(t, p.Revision(), "")
+}
+
+func TestGitProviderWebhook(t *testing.T) {
+	body := []byte(`{"ref":"refs/heads/main"}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	header := http.Header{"X-Hub-Signature-256": {"sha256=" + hex.EncodeToString(mac.Sum(nil))}}
+
+	p, _ := newTestGitProvider(t, nil)
+	expect.ErrorIs(t, ErrGitWebhookDisabled, p.Webhook(header, body))
+
+	p, _ = newTestGitProvider(t, func(c *git.Config) { c.WebhookSecret = "s3cret" })
+	expect.ErrorIs(t, git.ErrInvalidWebhookSignature, p.Webhook(http.Header{}, body))
+	expect.Equal(t, len(p.webhook), 0)
+
+	expect.NoError(t, p.Webhook(header, body))
+	expect.NoError(t, p.Webhook(header, body)) // a pull is already pending
+	expect.Equal(t, len(p.webhook), 1)
+}
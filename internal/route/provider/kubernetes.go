@@ -0,0 +1,160 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/yusing/godoxy/internal/kubernetes"
+	"github.com/yusing/godoxy/internal/route"
+	"github.com/yusing/godoxy/internal/watcher"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+type KubernetesProvider struct {
+	name string
+	cfg  *kubernetes.Config
+	l    zerolog.Logger
+
+	sourcesMu sync.RWMutex
+	sources   map[string][]string // alias -> keys of the objects the route is built from
+}
+
+const kubernetesListTimeout = 10 * time.Second
+
+func KubernetesProviderImpl(name string, cfg *kubernetes.Config) (ProviderImpl, error) {
+	if name == "" {
+		return nil, ErrEmptyProviderName
+	}
+	if err := cfg.Init(); err != nil {
+		return nil, err
+	}
+	return &KubernetesProvider{
+		name: name,
+		cfg:  cfg,
+		l:    log.With().Str("type", "kubernetes").Str("name", name).Logger(),
+	}, nil
+}
+
+func (p *KubernetesProvider) String() string {
+	return "kubernetes@" + p.name
+}
+
+func (p *KubernetesProvider) ShortName() string {
+	return p.name
+}
+
+func (p *KubernetesProvider) IsExplicitOnly() bool {
+	return false
+}
+
+func (p *KubernetesProvider) Logger() *zerolog.Logger {
+	return &p.l
+}
+
+func (p *KubernetesProvider) NewWatcher() watcher.Watcher {
+	return watcher.NewKubernetesWatcher(p.cfg)
+}
+
+// dependsOn reports whether the route with alias is built from the object with key, e.g. "Service/default/whoami".
+func (p *KubernetesProvider) dependsOn(alias, key string) bool {
+	p.sourcesMu.RLock()
+	defer p.sourcesMu.RUnlock()
+	return slices.Contains(p.sources[alias], key)
+}
+
+func (p *KubernetesProvider) loadRoutesImpl() (route.Routes, gperr.Error) {
+	ctx, cancel := context.WithTimeout(context.Background(), kubernetesListTimeout)
+	defer cancel()
+
+	client := p.cfg.Client()
+	namespaces := p.cfg.ListNamespaces()
+
+	services, err := kubernetes.ListAll[kubernetes.Service](ctx, client, kubernetes.ResourceService, namespaces)
+	if err != nil {
+		return nil, gperr.Wrap(err)
+	}
+	ingresses, err := kubernetes.ListAll[kubernetes.Ingress](ctx, client, kubernetes.ResourceIngress, namespaces)
+	if err != nil {
+		return nil, gperr.Wrap(err)
+	}
+	// Gateway API CRDs are optional
+	gateways, err := listOptional[kubernetes.Gateway](ctx, client, kubernetes.ResourceGateway, namespaces)
+	if err != nil {
+		return nil, gperr.Wrap(err)
+	}
+	httpRoutes, err := listOptional[kubernetes.HTTPRoute](ctx, client, kubernetes.ResourceHTTPRoute, namespaces)
+	if err != nil {
+		return nil, gperr.Wrap(err)
+	}
+	tcpRoutes, err := listOptional[kubernetes.TCPRoute](ctx, client, kubernetes.ResourceTCPRoute, namespaces)
+	if err != nil {
+		return nil, gperr.Wrap(err)
+	}
+	grants, err := listOptional[kubernetes.ReferenceGrant](ctx, client, kubernetes.ResourceReferenceGrant, namespaces)
+	if err != nil {
+		return nil, gperr.Wrap(err)
+	}
+
+	k := newKubernetesRoutes(p.cfg, services, gateways, grants)
+	var routedIngresses []*kubernetes.Ingress
+	for i := range ingresses {
+		if k.addIngress(&ingresses[i]) {
+			routedIngresses = append(routedIngresses, &ingresses[i])
+		}
+	}
+	for i := range httpRoutes {
+		k.addHTTPRoute(&httpRoutes[i])
+	}
+	for i := range tcpRoutes {
+		k.addTCPRoute(&tcpRoutes[i])
+	}
+	for i := range services {
+		k.addService(&services[i])
+	}
+
+	p.sourcesMu.Lock()
+	p.sources = k.sources
+	p.sourcesMu.Unlock()
+
+	if p.cfg.StatusAddress != "" {
+		p.updateIngressStatus(ctx, routedIngresses)
+	}
+	return k.routes, k.errs.Error()
+}
+
+func listOptional[T any](ctx context.Context, client *kubernetes.Client, r kubernetes.Resource, namespaces []string) ([]T, error) {
+	items, err := kubernetes.ListAll[T](ctx, client, r, namespaces)
+	if errors.Is(err, kubernetes.ErrNotFound) {
+		return nil, nil
+	}
+	return items, err
+}
+
+// updateIngressStatus publishes the status address in the status of ingresses served by GoDoxy.
+//
+// Ingresses already having the address are not updated, since each update triggers another reload.
+func (p *KubernetesProvider) updateIngressStatus(ctx context.Context, ingresses []*kubernetes.Ingress) {
+	var lb kubernetes.LoadBalancerIngress
+	if net.ParseIP(p.cfg.StatusAddress) != nil {
+		lb.IP = p.cfg.StatusAddress
+	} else {
+		lb.Hostname = p.cfg.StatusAddress
+	}
+	status := kubernetes.IngressStatus{LoadBalancer: kubernetes.LoadBalancerStatus{Ingress: []kubernetes.LoadBalancerIngress{lb}}}
+
+	for _, ing := range ingresses {
+		if slices.Equal(ing.Status.LoadBalancer.Ingress, status.LoadBalancer.Ingress) {
+			continue
+		}
+		meta := ing.Metadata
+		if err := p.cfg.Client().UpdateIngressStatus(ctx, meta.Namespace, meta.Name, status); err != nil {
+			p.l.Err(err).Str("ingress", meta.Namespace+"/"+meta.Name).Msg("failed to update ingress status")
+		}
+	}
+}
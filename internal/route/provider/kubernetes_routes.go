@@ -0,0 +1,542 @@
+package provider
+
+import (
+	"cmp"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/yusing/godoxy/internal/docker"
+	"github.com/yusing/godoxy/internal/kubernetes"
+	"github.com/yusing/godoxy/internal/route"
+	"github.com/yusing/godoxy/internal/route/rules"
+	"github.com/yusing/godoxy/internal/serialization"
+	"github.com/yusing/godoxy/internal/types"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// KubernetesAnnotationPrefix is the prefix of annotations holding route config,
+// e.g. "godoxy/middlewares.redirectHTTP.bypass" is the label "proxy.<alias>.middlewares.redirectHTTP.bypass".
+const KubernetesAnnotationPrefix = "godoxy/"
+
+// kubernetesAnnotationAliases lists the aliases of a service route, comma separated.
+const kubernetesAnnotationAliases = KubernetesAnnotationPrefix + "aliases"
+
+var (
+	ErrServiceNotFound         = gperr.New("service not found")
+	ErrServicePortNotFound     = gperr.New("service port not found")
+	ErrUnsupportedBackend      = gperr.New("unsupported backend, only services are supported")
+	ErrWildcardHostUnsupported = gperr.New("wildcard hosts are not supported")
+	ErrReferenceNotPermitted   = gperr.New("cross namespace reference is not permitted by a ReferenceGrant")
+)
+
+// kubernetesRoutes converts Kubernetes objects to routes.
+type kubernetesRoutes struct {
+	cfg      *kubernetes.Config
+	services map[string]*kubernetes.Service          // namespace/name -> service
+	gateways map[string]*kubernetes.Gateway          // namespace/name -> gateway
+	grants   map[string][]*kubernetes.ReferenceGrant // namespace -> reference grants
+
+	routes  route.Routes
+	owners  map[string]string   // alias -> key of the object defining the route
+	sources map[string][]string // alias -> keys of the objects the route is built from
+	errs    gperr.Builder
+}
+
+type kubernetesBackend struct {
+	scheme string
+	host   string
+	port   int32
+	source string // key of the service
+	grant  string // key of the ReferenceGrant allowing a cross namespace reference to the service
+}
+
+// kubernetesPath is a path of a host routed to a backend.
+type kubernetesPath struct {
+	match   string // kubernetes.PathMatch*
+	path    string
+	backend kubernetesBackend
+}
+
+func newKubernetesRoutes(cfg *kubernetes.Config, services []kubernetes.Service, gateways []kubernetes.Gateway, grants []kubernetes.ReferenceGrant) *kubernetesRoutes {
+	k := &kubernetesRoutes{
+		cfg:      cfg,
+		services: make(map[string]*kubernetes.Service, len(services)),
+		gateways: make(map[string]*kubernetes.Gateway, len(gateways)),
+		grants:   make(map[string][]*kubernetes.ReferenceGrant),
+		routes:   make(route.Routes),
+		owners:   make(map[string]string),
+		sources:  make(map[string][]string),
+		errs:     gperr.NewBuilder(""),
+	}
+	for i := range services {
+		k.services[services[i].Metadata.Namespace+"/"+services[i].Metadata.Name] = &services[i]
+	}
+	for i := range gateways {
+		k.gateways[gateways[i].Metadata.Namespace+"/"+gateways[i].Metadata.Name] = &gateways[i]
+	}
+	for i := range grants {
+		k.grants[grants[i].Metadata.Namespace] = append(k.grants[grants[i].Metadata.Namespace], &grants[i])
+	}
+	return k
+}
+
+func (b kubernetesBackend) url() string {
+	return b.scheme + "://" + net.JoinHostPort(b.host, strconv.Itoa(int(b.port)))
+}
+
+func (b kubernetesBackend) entry() types.LabelMap {
+	entry := types.LabelMap{
+		"scheme": b.scheme,
+		"host":   b.host,
+	}
+	if b.port != 0 {
+		entry["port"] = strconv.Itoa(int(b.port))
+	}
+	return entry
+}
+
+// backend resolves a port of a service by number or by name, or its first port if both are empty.
+//
+// The port is zero if the service has no ports, e.g. an ExternalName service.
+func (k *kubernetesRoutes) backend(namespace, name string, port int32, portName string) (kubernetesBackend, gperr.Error) {
+	svcKey := kubernetes.ResourceService.Key(namespace, name)
+	svc, ok := k.services[namespace+"/"+name]
+	if !ok {
+		return kubernetesBackend{}, ErrServiceNotFound.Subject(namespace + "/" + name)
+	}
+
+	var sp *kubernetes.ServicePort
+	for i, p := range svc.Spec.Ports {
+		if (portName != "" && p.Name == portName) || (port != 0 && p.Port == port) {
+			sp = &svc.Spec.Ports[i]
+			break
+		}
+	}
+	switch {
+	case sp != nil:
+	case port != 0: // ExternalName services may have no ports
+		sp = &kubernetes.ServicePort{Port: port}
+	case portName == "" && len(svc.Spec.Ports) > 0:
+		sp = &svc.Spec.Ports[0]
+	case portName == "":
+		sp = &kubernetes.ServicePort{}
+	default:
+		return kubernetesBackend{}, ErrServicePortNotFound.Subject(namespace + "/" + name + ":" + portName)
+	}
+
+	b := kubernetesBackend{scheme: "http", port: sp.Port, source: svcKey}
+	if sp.Name == "https" || sp.Port == 443 {
+		b.scheme = "https"
+	}
+	switch {
+	case svc.Spec.Type == kubernetes.ServiceTypeExternalName:
+		b.host = svc.Spec.ExternalName
+	case svc.Spec.ClusterIP == "" || svc.Spec.ClusterIP == kubernetes.ClusterIPNone:
+		// headless service, resolved by the cluster DNS
+		b.host = name + "." + namespace + ".svc"
+	default:
+		b.host = svc.Spec.ClusterIP
+	}
+	return b, nil
+}
+
+func (k *kubernetesRoutes) ingressBackend(namespace string, b *kubernetes.IngressBackend) (kubernetesBackend, gperr.Error) {
+	if b.Service == nil {
+		return kubernetesBackend{}, ErrUnsupportedBackend
+	}
+	return k.backend(namespace, b.Service.Name, b.Service.Port.Number, b.Service.Port.Name)
+}
+
+// backendRef resolves the first backend of a route of resource from in namespace.
+//
+// A backend in another namespace must be allowed by a ReferenceGrant in that namespace.
+func (k *kubernetesRoutes) backendRef(from kubernetes.Resource, namespace string, refs []kubernetes.BackendRef) (kubernetesBackend, gperr.Error) {
+	for _, ref := range refs {
+		if ref.Weight != nil && *ref.Weight == 0 {
+			continue
+		}
+		if (ref.Group != "" && ref.Group != "core") || (ref.Kind != "" && ref.Kind != kubernetes.ResourceService.Kind) {
+			return kubernetesBackend{}, ErrUnsupportedBackend.Subject(ref.Kind)
+		}
+		ns := cmp.Or(ref.Namespace, namespace)
+		var grant string
+		if ns != namespace {
+			grant = k.referenceGrant(from, namespace, ns, ref.Name)
+			if grant == "" {
+				return kubernetesBackend{}, ErrReferenceNotPermitted.Subject(ns + "/" + ref.Name)
+			}
+		}
+		b, err := k.backend(ns, ref.Name, ref.Port, "")
+		b.grant = grant
+		return b, err
+	}
+	return kubernetesBackend{}, ErrServiceNotFound.Subject("no backendRefs")
+}
+
+// referenceGrant returns the key of a ReferenceGrant in namespace to allowing routes of resource from
+// in fromNamespace to reference the service name, or empty if there is none.
+func (k *kubernetesRoutes) referenceGrant(from kubernetes.Resource, fromNamespace, to, name string) string {
+	for _, grant := range k.grants[to] {
+		fromOK := slices.ContainsFunc(grant.Spec.From, func(f kubernetes.ReferenceGrantFrom) bool {
+			return f.Group == from.Group && f.Kind == from.Kind && f.Namespace == fromNamespace
+		})
+		toOK := slices.ContainsFunc(grant.Spec.To, func(t kubernetes.ReferenceGrantTo) bool {
+			return (t.Group == "" || t.Group == "core") && t.Kind == kubernetes.ResourceService.Kind && (t.Name == nil || *t.Name == name)
+		})
+		if fromOK && toOK {
+			return kubernetes.ResourceReferenceGrant.Key(to, grant.Metadata.Name)
+		}
+	}
+	return ""
+}
+
+// addIngress adds a route for each host of an ingress of the configured ingress class,
+// and reports whether any route was added.
+func (k *kubernetesRoutes) addIngress(ing *kubernetes.Ingress) bool {
+	meta := ing.Metadata
+	className := meta.Annotations[kubernetes.AnnotationIngressClass]
+	if ing.Spec.IngressClassName != nil {
+		className = *ing.Spec.IngressClassName
+	}
+	if className != k.cfg.IngressClass {
+		return false
+	}
+	key := kubernetes.ResourceIngress.Key(meta.Namespace, meta.Name)
+
+	var defaultBackend *kubernetesBackend
+	if ing.Spec.DefaultBackend != nil {
+		b, err := k.ingressBackend(meta.Namespace, ing.Spec.DefaultBackend)
+		if err != nil {
+			k.errs.Add(err.Subject("defaultBackend").Subject(key))
+			return false
+		}
+		defaultBackend = &b
+	}
+
+	// the same host may appear in multiple rules
+	var hosts []string
+	hostPaths := make(map[string][]kubernetesPath)
+	invalid := make(map[string]bool)
+	for _, rule := range ing.Spec.Rules {
+		host := cmp.Or(rule.Host, meta.Name)
+		if _, ok := hostPaths[host]; !ok {
+			hosts = append(hosts, host)
+			hostPaths[host] = nil
+		}
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, p := range rule.HTTP.Paths {
+			b, err := k.ingressBackend(meta.Namespace, &p.Backend)
+			if err != nil {
+				k.errs.Add(err.Subject(host).Subject(key))
+				invalid[host] = true
+				continue
+			}
+			match := kubernetes.PathMatchPathPrefix
+			if p.PathType == kubernetes.PathTypeExact {
+				match = kubernetes.PathMatchExact
+			}
+			hostPaths[host] = append(hostPaths[host], kubernetesPath{match: match, path: cmp.Or(p.Path, "/"), backend: b})
+		}
+	}
+	if len(hosts) == 0 && defaultBackend != nil {
+		hosts = append(hosts, meta.Name)
+	}
+
+	added := false
+	for _, host := range hosts {
+		paths := hostPaths[host]
+		if invalid[host] || (len(paths) == 0 && defaultBackend == nil) {
+			continue
+		}
+		added = k.addPaths(key, host, paths, defaultBackend, meta.Annotations) || added
+	}
+	return added
+}
+
+func (k *kubernetesRoutes) addHTTPRoute(hr *kubernetes.HTTPRoute) {
+	meta := hr.Metadata
+	key := kubernetes.ResourceHTTPRoute.Key(meta.Namespace, meta.Name)
+	listeners, gateways := k.listeners(meta.Namespace, hr.Spec.ParentRefs, "HTTP", "HTTPS")
+	if len(listeners) == 0 {
+		return
+	}
+
+	hostnames := hr.Spec.Hostnames
+	if len(hostnames) == 0 {
+		for _, l := range listeners {
+			if l.Hostname != "" && !slices.Contains(hostnames, l.Hostname) {
+				hostnames = append(hostnames, l.Hostname)
+			}
+		}
+	}
+	if len(hostnames) == 0 {
+		hostnames = []string{meta.Name}
+	}
+
+	var paths []kubernetesPath
+	for _, rule := range hr.Spec.Rules {
+		b, err := k.backendRef(kubernetes.ResourceHTTPRoute, meta.Namespace, rule.BackendRefs)
+		if err != nil {
+			k.errs.Add(err.Subject(key))
+			return
+		}
+		if len(rule.Matches) == 0 {
+			paths = append(paths, kubernetesPath{match: kubernetes.PathMatchPathPrefix, path: "/", backend: b})
+		}
+		for _, m := range rule.Matches {
+			p := kubernetesPath{match: kubernetes.PathMatchPathPrefix, path: "/", backend: b}
+			if m.Path != nil {
+				p.match = cmp.Or(m.Path.Type, p.match)
+				p.path = cmp.Or(m.Path.Value, p.path)
+			}
+			paths = append(paths, p)
+		}
+	}
+	if len(paths) == 0 {
+		return
+	}
+
+	for _, host := range hostnames {
+		k.addPaths(key, host, paths, nil, meta.Annotations, gateways...)
+	}
+}
+
+func (k *kubernetesRoutes) addTCPRoute(tr *kubernetes.TCPRoute) {
+	meta := tr.Metadata
+	key := kubernetes.ResourceTCPRoute.Key(meta.Namespace, meta.Name)
+	listeners, gateways := k.listeners(meta.Namespace, tr.Spec.ParentRefs, kubernetes.ProtocolTCP)
+	if len(listeners) == 0 || len(tr.Spec.Rules) == 0 {
+		return
+	}
+	b, err := k.backendRef(kubernetes.ResourceTCPRoute, meta.Namespace, tr.Spec.Rules[0].BackendRefs)
+	if err != nil {
+		k.errs.Add(err.Subject(key))
+		return
+	}
+	entry := b.entry()
+	entry["scheme"] = "tcp"
+	entry["port"] = strconv.Itoa(int(listeners[0].Port)) + ":" + strconv.Itoa(int(b.port))
+	sources := append(gateways, b.source)
+	if b.grant != "" {
+		sources = append(sources, b.grant)
+	}
+	k.add(key, meta.Name, entry, meta.Annotations, sources...)
+}
+
+// addService adds routes for a service with route config annotations.
+func (k *kubernetesRoutes) addService(svc *kubernetes.Service) {
+	meta := svc.Metadata
+	annotations := maps.Clone(meta.Annotations)
+	if !hasRouteAnnotations(annotations) {
+		return
+	}
+	key := kubernetes.ResourceService.Key(meta.Namespace, meta.Name)
+
+	aliases := []string{meta.Name}
+	if s, ok := annotations[kubernetesAnnotationAliases]; ok {
+		delete(annotations, kubernetesAnnotationAliases)
+		aliases = strings.Split(s, ",")
+	}
+	b, err := k.backend(meta.Namespace, meta.Name, 0, "")
+	if err != nil {
+		k.errs.Add(err.Subject(key))
+		return
+	}
+	for _, alias := range aliases {
+		k.add(key, strings.TrimSpace(alias), b.entry(), annotations)
+	}
+}
+
+// listeners returns the listeners with the given protocols of the parent gateways of the configured gateway class
+// allowing routes from namespace, and the keys of these gateways.
+func (k *kubernetesRoutes) listeners(namespace string, refs []kubernetes.ParentReference, protocols ...string) (listeners []kubernetes.Listener, gateways []string) {
+	for _, ref := range refs {
+		if (ref.Group != "" && ref.Group != kubernetes.ResourceGateway.Group) || (ref.Kind != "" && ref.Kind != kubernetes.ResourceGateway.Kind) {
+			continue
+		}
+		ns := cmp.Or(ref.Namespace, namespace)
+		gw, ok := k.gateways[ns+"/"+ref.Name]
+		if !ok || gw.Spec.GatewayClassName != k.cfg.GatewayClass {
+			continue
+		}
+		gateways = append(gateways, kubernetes.ResourceGateway.Key(ns, ref.Name))
+		for _, l := range gw.Spec.Listeners {
+			if (ref.SectionName != "" && l.Name != ref.SectionName) || (ref.Port != 0 && l.Port != ref.Port) {
+				continue
+			}
+			if slices.Contains(protocols, l.Protocol) && listenerAllowsNamespace(&l, ns, namespace) {
+				listeners = append(listeners, l)
+			}
+		}
+	}
+	return listeners, gateways
+}
+
+// listenerAllowsNamespace reports whether a listener of a gateway in gatewayNamespace accepts routes from namespace.
+//
+// Namespace selectors are not supported, such listeners accept no routes.
+func listenerAllowsNamespace(l *kubernetes.Listener, gatewayNamespace, namespace string) bool {
+	from := kubernetes.NamespacesFromSame
+	if l.AllowedRoutes != nil && l.AllowedRoutes.Namespaces != nil {
+		from = cmp.Or(l.AllowedRoutes.Namespaces.From, from)
+	}
+	switch from {
+	case kubernetes.NamespacesFromAll:
+		return true
+	case kubernetes.NamespacesFromSame:
+		return gatewayNamespace == namespace
+	default:
+		return false
+	}
+}
+
+// addPaths adds a route for host.
+//
+// The upstream is the backend of path "/" or defaultBackend.
+// Other paths are routed by rules, longest first. Requests matching no path get 404 if there is no upstream.
+func (k *kubernetesRoutes) addPaths(owner, host string, paths []kubernetesPath, defaultBackend *kubernetesBackend, annotations map[string]string, sources ...string) bool {
+	if strings.HasPrefix(host, "*") {
+		k.errs.Add(ErrWildcardHostUnsupported.Subject(host).Subject(owner))
+		return false
+	}
+
+	catchAll := defaultBackend
+	for i, p := range paths {
+		if p.match == kubernetes.PathMatchPathPrefix && p.path == "/" {
+			catchAll = &paths[i].backend
+			break
+		}
+	}
+	for _, p := range paths {
+		if !slices.Contains(sources, p.backend.source) {
+			sources = append(sources, p.backend.source)
+		}
+		if p.backend.grant != "" && !slices.Contains(sources, p.backend.grant) {
+			sources = append(sources, p.backend.grant)
+		}
+	}
+	if catchAll != nil && !slices.Contains(sources, catchAll.source) {
+		sources = append(sources, catchAll.source)
+	}
+
+	target := catchAll
+	if target == nil {
+		target = &paths[0].backend
+	}
+	entry := target.entry()
+
+	// a single backend for all paths needs no rules
+	if catchAll != nil && !slices.ContainsFunc(paths, func(p kubernetesPath) bool { return p.backend != *catchAll }) {
+		return k.add(owner, host, entry, annotations, sources...)
+	}
+
+	sorted := slices.Clone(paths)
+	slices.SortStableFunc(sorted, func(a, b kubernetesPath) int {
+		return len(b.path) - len(a.path)
+	})
+	pathRules := make([]any, 0, len(sorted)+1)
+	for _, p := range sorted {
+		if p.match == kubernetes.PathMatchPathPrefix && p.path == "/" {
+			continue
+		}
+		pathRules = append(pathRules, map[string]any{
+			"name": "path " + p.path,
+			"on":   kubernetesPathMatcher(p),
+			"do":   "proxy " + rules.QuoteArg(p.backend.url()),
+		})
+	}
+	if catchAll == nil {
+		pathRules = append(pathRules, map[string]any{
+			"name": "not found",
+			"on":   "default",
+			"do":   `error 404 "not found"`,
+		})
+	}
+	entry["rules"] = pathRules
+	return k.add(owner, host, entry, annotations, sources...)
+}
+
+// kubernetesPathMatcher returns the rule.on of a path, an expression with the path quoted as a string literal.
+func kubernetesPathMatcher(p kubernetesPath) string {
+	switch p.match {
+	case kubernetes.PathMatchExact:
+		return "expr req_path == " + rules.QuoteExprString(p.path)
+	case kubernetes.PathMatchRegularExpression:
+		return "expr req_path.matches(" + rules.QuoteExprString(p.path) + ")"
+	default:
+		// "/foo" and "/foo/" both match "/foo" and "/foo/bar" but not "/foobar"
+		prefix := strings.TrimSuffix(p.path, "/")
+		return "expr req_path == " + rules.QuoteExprString(prefix) + " || req_path.starts_with(" + rules.QuoteExprString(prefix+"/") + ")"
+	}
+}
+
+func hasRouteAnnotations(annotations map[string]string) bool {
+	for k := range annotations {
+		if strings.HasPrefix(k, KubernetesAnnotationPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// add adds a route from a generated entry overridden by route config annotations.
+//
+// Rules from annotations run before generated rules.
+func (k *kubernetesRoutes) add(owner, alias string, entry types.LabelMap, annotations map[string]string, sources ...string) bool {
+	if conflict, ok := k.owners[alias]; ok {
+		k.errs.Add(gperr.Multiline().
+			Addf("route with alias %s already exists", alias).
+			Addf("object %s", owner).
+			Addf("conflicting object %s", conflict))
+		return false
+	}
+
+	labels := make(map[string]string)
+	for key, value := range annotations {
+		if field, ok := strings.CutPrefix(key, KubernetesAnnotationPrefix); ok && field != "" {
+			labels[docker.NSProxy+"."+field] = value
+		}
+	}
+	m, err := docker.ParseLabels(labels)
+	if err != nil {
+		k.errs.Add(err.Subject(owner))
+		return false
+	}
+	if err := validateRemoteRoute(m); err != nil {
+		k.errs.Add(err.Subject(alias).Subject(owner))
+		return false
+	}
+
+	generatedRules, _ := entry["rules"].([]any)
+	for key, value := range entry {
+		if _, ok := m[key]; !ok {
+			m[key] = value
+		}
+	}
+	if len(generatedRules) > 0 {
+		if rulesYAML, ok := m["rules"].(string); ok {
+			var annotationRules []any
+			if err := yaml.Unmarshal([]byte(rulesYAML), &annotationRules); err != nil {
+				k.errs.Add(gperr.Wrap(err, "invalid rules annotation").Subject(owner))
+				return false
+			}
+			m["rules"] = append(annotationRules, generatedRules...)
+		}
+	}
+
+	r := &route.Route{Alias: alias}
+	if err := serialization.MapUnmarshalValidate(m, r); err != nil {
+		k.errs.Add(err.Subject(alias).Subject(owner))
+		return false
+	}
+	k.routes[alias] = r
+	k.owners[alias] = owner
+	k.sources[alias] = append([]string{owner}, sources...)
+	return true
+}
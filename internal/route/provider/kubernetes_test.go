@@ -0,0 +1,350 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/yusing/godoxy/internal/kubernetes"
+	"github.com/yusing/godoxy/internal/kubernetes/kubernetestest"
+	"github.com/yusing/godoxy/internal/route"
+	routeTypes "github.com/yusing/godoxy/internal/route/types"
+	expect "github.com/yusing/goutils/testing"
+)
+
+func newTestKubernetesProvider(t *testing.T, cfg func(*kubernetes.Config)) (*KubernetesProvider, *kubernetestest.Server) {
+	t.Helper()
+	srv := kubernetestest.NewServer(t)
+	c := srv.Config()
+	if cfg != nil {
+		cfg(c)
+	}
+	p, err := KubernetesProviderImpl("k3s", c)
+	expect.NoError(t, err)
+	return p.(*KubernetesProvider), srv
+}
+
+func testService(name, clusterIP string, ports ...kubernetes.ServicePort) *kubernetes.Service {
+	return &kubernetes.Service{
+		Metadata: kubernetes.ObjectMeta{Namespace: "default", Name: name},
+		Spec:     kubernetes.ServiceSpec{ClusterIP: clusterIP, Ports: ports},
+	}
+}
+
+func testIngressPath(path, service string, port int32) kubernetes.HTTPIngressPath {
+	return kubernetes.HTTPIngressPath{
+		Path:     path,
+		PathType: kubernetes.PathTypePrefix,
+		Backend: kubernetes.IngressBackend{Service: &kubernetes.IngressServiceBackend{
+			Name: service,
+			Port: kubernetes.ServiceBackendPort{Number: port},
+		}},
+	}
+}
+
+func testIngress(name, host string, annotations map[string]string, paths ...kubernetes.HTTPIngressPath) *kubernetes.Ingress {
+	class := kubernetes.ClassDefault
+	return &kubernetes.Ingress{
+		Metadata: kubernetes.ObjectMeta{Namespace: "default", Name: name, Annotations: annotations},
+		Spec: kubernetes.IngressSpec{
+			IngressClassName: &class,
+			Rules:            []kubernetes.IngressRule{{Host: host, HTTP: &kubernetes.HTTPIngressRuleValue{Paths: paths}}},
+		},
+	}
+}
+
+func loadKubernetesRoutes(t *testing.T, p *KubernetesProvider) route.Routes {
+	t.Helper()
+	routes, err := p.loadRoutesImpl()
+	expect.NoError(t, err)
+	return routes
+}
+
+func TestKubernetesIngress(t *testing.T) {
+	p, srv := newTestKubernetesProvider(t, nil)
+	srv.Apply(kubernetes.ResourceService, testService("app", "10.43.0.10", kubernetes.ServicePort{Name: "http", Port: 8080}))
+	srv.Apply(kubernetes.ResourceIngress, testIngress("app", "app.example.com", map[string]string{
+		"godoxy/healthcheck.path":                 "/ping",
+		"godoxy/homepage.name":                    "App",
+		"godoxy/middlewares.cidr_whitelist.allow": "10.0.0.0/8",
+		"unrelated/annotation":                    "ignored",
+	}, testIngressPath("/", "app", 8080)))
+
+	routes := loadKubernetesRoutes(t, p)
+	expect.Equal(t, len(routes), 1)
+	r := routes["app.example.com"]
+	expect.NotNil(t, r)
+	expect.Equal(t, r.Scheme, routeTypes.SchemeHTTP)
+	expect.Equal(t, r.Host, "10.43.0.10")
+	expect.Equal(t, r.Port.Proxy, 8080)
+	expect.Equal(t, len(r.Rules), 0)
+	expect.Equal(t, r.HealthCheck.Path, "/ping")
+	expect.Equal(t, r.Homepage.Name, "App")
+	expect.Equal(t, r.Middlewares["cidr_whitelist"]["allow"], any("10.0.0.0/8"))
+
+	expect.True(t, p.dependsOn("app.example.com", "Ingress/default/app"))
+	expect.True(t, p.dependsOn("app.example.com", "Service/default/app"))
+	expect.False(t, p.dependsOn("app.example.com", "Service/default/other"))
+}
+
+func TestKubernetesIngressPaths(t *testing.T) {
+	p, srv := newTestKubernetesProvider(t, nil)
+	srv.Apply(kubernetes.ResourceService, testService("web", "10.43.0.11", kubernetes.ServicePort{Port: 80}))
+	srv.Apply(kubernetes.ResourceService, testService("api", "10.43.0.12", kubernetes.ServicePort{Name: "https", Port: 8443}))
+	srv.Apply(kubernetes.ResourceIngress, testIngress("site", "site.example.com", map[string]string{
+		"godoxy/rules": "- name: block admin\n  on: path /admin\n  do: error 403 forbidden\n",
+	}, testIngressPath("/", "web", 80), testIngressPath("/api/", "api", 8443)))
+
+	routes := loadKubernetesRoutes(t, p)
+	r := routes["site.example.com"]
+	expect.NotNil(t, r)
+	expect.Equal(t, r.Host, "10.43.0.11")
+	expect.Equal(t, r.Port.Proxy, 80)
+	expect.Equal(t, len(r.Rules), 2)
+	expect.Equal(t, r.Rules[0].Name, "block admin")
+	expect.Equal(t, r.Rules[1].On.String(), `expr req_path == "/api" || req_path.starts_with("/api/")`)
+	expect.Equal(t, r.Rules[1].Do.String(), `proxy "https://10.43.0.12:8443"`)
+}
+
+func TestKubernetesIngressNoCatchAll(t *testing.T) {
+	p, srv := newTestKubernetesProvider(t, nil)
+	srv.Apply(kubernetes.ResourceService, testService("docs", "10.43.0.13", kubernetes.ServicePort{Port: 80}))
+	srv.Apply(kubernetes.ResourceIngress, testIngress("docs", "example.com", nil, testIngressPath("/docs", "docs", 80)))
+
+	r := loadKubernetesRoutes(t, p)["example.com"]
+	expect.NotNil(t, r)
+	expect.Equal(t, len(r.Rules), 2)
+	expect.Equal(t, r.Rules[0].Do.String(), `proxy "http://10.43.0.13:80"`)
+	expect.Equal(t, r.Rules[1].On.String(), "default")
+}
+
+func TestKubernetesIngressClass(t *testing.T) {
+	p, srv := newTestKubernetesProvider(t, nil)
+	srv.Apply(kubernetes.ResourceService, testService("app", "10.43.0.10", kubernetes.ServicePort{Port: 80}))
+	ing := testIngress("app", "app.example.com", nil, testIngressPath("/", "app", 80))
+	ing.Spec.IngressClassName = nil
+	srv.Apply(kubernetes.ResourceIngress, ing)
+	expect.Equal(t, len(loadKubernetesRoutes(t, p)), 0)
+
+	ing.Metadata.Annotations = map[string]string{kubernetes.AnnotationIngressClass: kubernetes.ClassDefault}
+	srv.Apply(kubernetes.ResourceIngress, ing)
+	expect.Equal(t, len(loadKubernetesRoutes(t, p)), 1)
+}
+
+func TestKubernetesIngressStatus(t *testing.T) {
+	p, srv := newTestKubernetesProvider(t, func(cfg *kubernetes.Config) {
+		cfg.StatusAddress = "10.0.0.2"
+	})
+	srv.Apply(kubernetes.ResourceService, testService("app", "10.43.0.10", kubernetes.ServicePort{Port: 80}))
+	srv.Apply(kubernetes.ResourceIngress, testIngress("app", "app.example.com", nil, testIngressPath("/", "app", 80)))
+
+	loadKubernetesRoutes(t, p)
+	var ing kubernetes.Ingress
+	expect.True(t, srv.Get(kubernetes.ResourceIngress, "default", "app", &ing))
+	expect.Equal(t, ing.Status.LoadBalancer.Ingress, []kubernetes.LoadBalancerIngress{{IP: "10.0.0.2"}})
+
+	// status is not updated again, that would trigger another reload
+	rv := srv.ResourceVersion()
+	loadKubernetesRoutes(t, p)
+	expect.Equal(t, srv.ResourceVersion(), rv)
+}
+
+func TestKubernetesServiceNotFound(t *testing.T) {
+	p, srv := newTestKubernetesProvider(t, nil)
+	srv.Apply(kubernetes.ResourceIngress, testIngress("app", "app.example.com", nil, testIngressPath("/", "missing", 80)))
+	routes, err := p.loadRoutesImpl()
+	expect.ErrorIs(t, ErrServiceNotFound, err)
+	expect.Equal(t, len(routes), 0)
+}
+
+func TestKubernetesAnnotatedService(t *testing.T) {
+	p, srv := newTestKubernetesProvider(t, nil)
+	svc := testService("db", "10.43.0.14", kubernetes.ServicePort{Port: 5432})
+	srv.Apply(kubernetes.ResourceService, testService("plain", "10.43.0.15", kubernetes.ServicePort{Port: 80}))
+	svc.Metadata.Annotations = map[string]string{
+		"godoxy/aliases": "db,postgres",
+		"godoxy/scheme":  "tcp",
+		"godoxy/port":    "15432:5432",
+	}
+	srv.Apply(kubernetes.ResourceService, svc)
+
+	routes := loadKubernetesRoutes(t, p)
+	expect.Equal(t, len(routes), 2)
+	r := routes["postgres"]
+	expect.NotNil(t, r)
+	expect.Equal(t, r.Scheme, routeTypes.SchemeTCP)
+	expect.Equal(t, r.Host, "10.43.0.14")
+	expect.Equal(t, r.Port, routeTypes.Port{Listening: 15432, Proxy: 5432})
+}
+
+func TestKubernetesGatewayRoutes(t *testing.T) {
+	p, srv := newTestKubernetesProvider(t, nil)
+	srv.Apply(kubernetes.ResourceService, testService("app", "10.43.0.10", kubernetes.ServicePort{Port: 80}))
+	srv.Apply(kubernetes.ResourceService, testService("redis", "10.43.0.16", kubernetes.ServicePort{Port: 6379}))
+	srv.Apply(kubernetes.ResourceGateway, &kubernetes.Gateway{
+		Metadata: kubernetes.ObjectMeta{Namespace: "infra", Name: "gw"},
+		Spec: kubernetes.GatewaySpec{
+			GatewayClassName: kubernetes.ClassDefault,
+			Listeners: []kubernetes.Listener{
+				{Name: "web", Port: 80, Protocol: "HTTP", Hostname: "gw.example.com", AllowedRoutes: allowedFrom(kubernetes.NamespacesFromAll)},
+				{Name: "redis", Port: 16379, Protocol: kubernetes.ProtocolTCP, AllowedRoutes: allowedFrom(kubernetes.NamespacesFromAll)},
+			},
+		},
+	})
+	parent := []kubernetes.ParentReference{{Namespace: "infra", Name: "gw"}}
+	srv.Apply(kubernetes.ResourceHTTPRoute, &kubernetes.HTTPRoute{
+		Metadata: kubernetes.ObjectMeta{Namespace: "default", Name: "app"},
+		Spec: kubernetes.HTTPRouteSpec{
+			ParentRefs: parent,
+			Rules:      []kubernetes.HTTPRouteRule{{BackendRefs: []kubernetes.BackendRef{{Name: "app", Port: 80}}}},
+		},
+	})
+	srv.Apply(kubernetes.ResourceTCPRoute, &kubernetes.TCPRoute{
+		Metadata: kubernetes.ObjectMeta{Namespace: "default", Name: "redis"},
+		Spec: kubernetes.TCPRouteSpec{
+			ParentRefs: parent,
+			Rules:      []kubernetes.TCPRouteRule{{BackendRefs: []kubernetes.BackendRef{{Name: "redis", Port: 6379}}}},
+		},
+	})
+	// not attached to a gateway of our class
+	srv.Apply(kubernetes.ResourceHTTPRoute, &kubernetes.HTTPRoute{
+		Metadata: kubernetes.ObjectMeta{Namespace: "default", Name: "other"},
+		Spec: kubernetes.HTTPRouteSpec{
+			ParentRefs: []kubernetes.ParentReference{{Name: "other-gw"}},
+			Hostnames:  []string{"other.example.com"},
+			Rules:      []kubernetes.HTTPRouteRule{{BackendRefs: []kubernetes.BackendRef{{Name: "app", Port: 80}}}},
+		},
+	})
+
+	routes := loadKubernetesRoutes(t, p)
+	expect.Equal(t, len(routes), 2)
+	http := routes["gw.example.com"]
+	expect.NotNil(t, http)
+	expect.Equal(t, http.Port.Proxy, 80)
+	expect.True(t, p.dependsOn("gw.example.com", "Gateway/infra/gw"))
+
+	tcp := routes["redis"]
+	expect.NotNil(t, tcp)
+	expect.Equal(t, tcp.Scheme, routeTypes.SchemeTCP)
+	expect.Equal(t, tcp.Port, routeTypes.Port{Listening: 16379, Proxy: 6379})
+}
+
+func TestKubernetesWithoutGatewayAPI(t *testing.T) {
+	p, srv := newTestKubernetesProvider(t, nil)
+	srv.DisableGroup(kubernetes.ResourceGateway.Group)
+	srv.Apply(kubernetes.ResourceService, testService("app", "10.43.0.10", kubernetes.ServicePort{Port: 80}))
+	srv.Apply(kubernetes.ResourceIngress, testIngress("app", "app.example.com", nil, testIngressPath("/", "app", 80)))
+	expect.Equal(t, len(loadKubernetesRoutes(t, p)), 1)
+}
+
+func allowedFrom(from string) *kubernetes.AllowedRoutes {
+	return &kubernetes.AllowedRoutes{Namespaces: &kubernetes.RouteNamespaces{From: from}}
+}
+
+func testGatewayRoute(namespace, name, gatewayNamespace string, backend kubernetes.BackendRef) *kubernetes.HTTPRoute {
+	return &kubernetes.HTTPRoute{
+		Metadata: kubernetes.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: kubernetes.HTTPRouteSpec{
+			ParentRefs: []kubernetes.ParentReference{{Namespace: gatewayNamespace, Name: "gw"}},
+			Hostnames:  []string{name + ".example.com"},
+			Rules:      []kubernetes.HTTPRouteRule{{BackendRefs: []kubernetes.BackendRef{backend}}},
+		},
+	}
+}
+
+func TestKubernetesGatewayAllowedRoutes(t *testing.T) {
+	p, srv := newTestKubernetesProvider(t, nil)
+	srv.Apply(kubernetes.ResourceService, testService("app", "10.43.0.10", kubernetes.ServicePort{Port: 80}))
+	srv.Apply(kubernetes.ResourceGateway, &kubernetes.Gateway{
+		Metadata: kubernetes.ObjectMeta{Namespace: "default", Name: "gw"},
+		Spec: kubernetes.GatewaySpec{
+			GatewayClassName: kubernetes.ClassDefault,
+			Listeners:        []kubernetes.Listener{{Name: "web", Port: 80, Protocol: "HTTP"}},
+		},
+	})
+	srv.Apply(kubernetes.ResourceHTTPRoute, testGatewayRoute("default", "same", "default", kubernetes.BackendRef{Name: "app", Port: 80}))
+	// routes from other namespaces are not accepted by default
+	srv.Apply(kubernetes.ResourceHTTPRoute, testGatewayRoute("tenant", "other", "default", kubernetes.BackendRef{Namespace: "default", Name: "app", Port: 80}))
+
+	routes := loadKubernetesRoutes(t, p)
+	expect.NotNil(t, routes["same.example.com"])
+	expect.Nil(t, routes["other.example.com"])
+
+	srv.Apply(kubernetes.ResourceGateway, &kubernetes.Gateway{
+		Metadata: kubernetes.ObjectMeta{Namespace: "default", Name: "gw"},
+		Spec: kubernetes.GatewaySpec{
+			GatewayClassName: kubernetes.ClassDefault,
+			Listeners:        []kubernetes.Listener{{Name: "web", Port: 80, Protocol: "HTTP", AllowedRoutes: allowedFrom(kubernetes.NamespacesFromSelector)}},
+		},
+	})
+	expect.Equal(t, len(loadKubernetesRoutes(t, p)), 0)
+}
+
+func TestKubernetesReferenceGrant(t *testing.T) {
+	p, srv := newTestKubernetesProvider(t, nil)
+	db := testService("db", "10.43.0.20", kubernetes.ServicePort{Port: 80})
+	db.Metadata.Namespace = "shared"
+	srv.Apply(kubernetes.ResourceService, db)
+	srv.Apply(kubernetes.ResourceGateway, &kubernetes.Gateway{
+		Metadata: kubernetes.ObjectMeta{Namespace: "tenant", Name: "gw"},
+		Spec: kubernetes.GatewaySpec{
+			GatewayClassName: kubernetes.ClassDefault,
+			Listeners:        []kubernetes.Listener{{Name: "web", Port: 80, Protocol: "HTTP"}},
+		},
+	})
+	srv.Apply(kubernetes.ResourceHTTPRoute, testGatewayRoute("tenant", "app", "tenant", kubernetes.BackendRef{Namespace: "shared", Name: "db", Port: 80}))
+
+	routes, err := p.loadRoutesImpl()
+	expect.ErrorIs(t, ErrReferenceNotPermitted, err)
+	expect.Equal(t, len(routes), 0)
+
+	name := "db"
+	srv.Apply(kubernetes.ResourceReferenceGrant, &kubernetes.ReferenceGrant{
+		Metadata: kubernetes.ObjectMeta{Namespace: "shared", Name: "tenant"},
+		Spec: kubernetes.ReferenceGrantSpec{
+			From: []kubernetes.ReferenceGrantFrom{{Group: kubernetes.ResourceHTTPRoute.Group, Kind: kubernetes.ResourceHTTPRoute.Kind, Namespace: "tenant"}},
+			To:   []kubernetes.ReferenceGrantTo{{Kind: kubernetes.ResourceService.Kind, Name: &name}},
+		},
+	})
+	routes = loadKubernetesRoutes(t, p)
+	expect.NotNil(t, routes["app.example.com"])
+	expect.True(t, p.dependsOn("app.example.com", "ReferenceGrant/shared/tenant"))
+}
+
+func TestKubernetesPathQuoting(t *testing.T) {
+	p, srv := newTestKubernetesProvider(t, nil)
+	srv.Apply(kubernetes.ResourceService, testService("web", "10.43.0.11", kubernetes.ServicePort{Port: 80}))
+	srv.Apply(kubernetes.ResourceService, testService("api", "10.43.0.12", kubernetes.ServicePort{Port: 8080}))
+	ing := testIngress("site", "site.example.com", nil,
+		testIngressPath("/", "web", 80),
+		testIngressPath(`/a") | default & "${GODOXY_API_JWT_SECRET}`, "api", 8080),
+	)
+	srv.Apply(kubernetes.ResourceIngress, ing)
+
+	r := loadKubernetesRoutes(t, p)["site.example.com"]
+	expect.NotNil(t, r)
+	expect.Equal(t, len(r.Rules), 1)
+	expect.Equal(t, r.Rules[0].On.String(), `expr req_path == "/a\") | default & \"${GODOXY_API_JWT_SECRET}" || req_path.starts_with("/a\") | default & \"${GODOXY_API_JWT_SECRET}/")`)
+}
+
+func TestKubernetesAnnotationFields(t *testing.T) {
+	p, srv := newTestKubernetesProvider(t, nil)
+	srv.Apply(kubernetes.ResourceService, testService("app", "10.43.0.10", kubernetes.ServicePort{Port: 80}))
+	for _, tt := range []struct {
+		annotation, value string
+		err               error
+	}{
+		{"godoxy/root", "/etc", ErrRemoteRouteField},
+		{"godoxy/scheme", "fileserver", ErrRemoteRouteScheme},
+		{"godoxy/rule_file", "/etc/passwd", ErrRemoteRouteField},
+		{"godoxy/idlewatcher.start_endpoint", "/start", ErrRemoteRouteField},
+		{"godoxy/access_log.path", "/etc/cron.d/x", ErrRemoteRouteField},
+		{"godoxy/ssl_certificate_key", "/app/certs/key.pem", ErrRemoteRouteField},
+		{"godoxy/bind", "0.0.0.0", ErrRemoteRouteField},
+	} {
+		t.Run(tt.annotation, func(t *testing.T) {
+			srv.Apply(kubernetes.ResourceIngress, testIngress("app", "app.example.com", map[string]string{tt.annotation: tt.value}, testIngressPath("/", "app", 80)))
+			routes, err := p.loadRoutesImpl()
+			expect.ErrorIs(t, tt.err, err)
+			expect.Equal(t, len(routes), 0)
+		})
+	}
+}
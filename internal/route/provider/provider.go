@@ -10,7 +10,10 @@ import (
 
 	"github.com/rs/zerolog"
 	"github.com/yusing/godoxy/agent/pkg/agent"
+	"github.com/yusing/godoxy/internal/discovery"
 	"github.com/yusing/godoxy/internal/docker"
+	"github.com/yusing/godoxy/internal/git"
+	"github.com/yusing/godoxy/internal/kubernetes"
 	"github.com/yusing/godoxy/internal/route"
 	provider "github.com/yusing/godoxy/internal/route/provider/types"
 	"github.com/yusing/godoxy/internal/types"
@@ -25,6 +28,7 @@ type (
 		ProviderImpl
 
 		t        provider.Type
+		trusted  bool // routes come from local route files
 		routes   route.Routes
 		routesMu sync.RWMutex
 
@@ -49,7 +53,7 @@ var ErrEmptyProviderName = errors.New("empty provider name")
 var _ types.RouteProvider = (*Provider)(nil)
 
 func newProvider(t provider.Type) *Provider {
-	return &Provider{t: t}
+	return &Provider{t: t, trusted: t == provider.ProviderTypeFile}
 }
 
 func NewFileProvider(filename string) (p *Provider, err error) {
@@ -86,10 +90,56 @@ func NewAgentProvider(cfg *agent.AgentConfig) *Provider {
 	return p
 }
 
+func NewKubernetesProvider(name string, cfg *kubernetes.Config) (p *Provider, err error) {
+	p = newProvider(provider.ProviderTypeKubernetes)
+	p.ProviderImpl, err = KubernetesProviderImpl(name, cfg)
+	if err != nil {
+		return nil, err
+	}
+	p.watcher = p.NewWatcher()
+	return p, nil
+}
+
+// NewDiscoveryProvider creates a provider of the type of the source, e.g. "consul".
+func NewDiscoveryProvider(name string, source discovery.Source) (p *Provider, err error) {
+	p = newProvider(provider.Type(source.String()))
+	p.ProviderImpl, err = DiscoveryProviderImpl(name, source)
+	if err != nil {
+		return nil, err
+	}
+	p.watcher = p.NewWatcher()
+	return p, nil
+}
+
+func NewGitProvider(name string, cfg *git.Config) (p *Provider, err error) {
+	p = newProvider(provider.ProviderTypeGit)
+	p.ProviderImpl, err = GitProviderImpl(name, cfg)
+	if err != nil {
+		return nil, err
+	}
+	p.watcher = p.NewWatcher()
+	return p, nil
+}
+
 func (p *Provider) GetType() provider.Type {
 	return p.t
 }
 
+// IsTrusted reports whether the routes come from local route files.
+//
+// Routes from labels, annotations and remote sources are not trusted.
+func (p *Provider) IsTrusted() bool {
+	return p.trusted
+}
+
+// Revision returns the applied revision of the routes, e.g. the commit id of a Git provider, or empty.
+func (p *Provider) Revision() string {
+	if r, ok := p.ProviderImpl.(interface{ Revision() string }); ok {
+		return r.Revision()
+	}
+	return ""
+}
+
 // to work with json marshaller.
 func (p *Provider) MarshalText() ([]byte, error) {
 	return []byte(p.String()), nil
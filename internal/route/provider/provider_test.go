@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/yusing/godoxy/internal/route"
+	provider "github.com/yusing/godoxy/internal/route/provider/types"
+	routeTypes "github.com/yusing/godoxy/internal/route/types"
+	"github.com/yusing/godoxy/internal/types"
+	expect "github.com/yusing/goutils/testing"
+)
+
+type testProviderImpl struct {
+	ProviderImpl
+}
+
+func (testProviderImpl) ShortName() string {
+	return "test"
+}
+
+func TestIdlewatcherHostProviders(t *testing.T) {
+	configs := map[string]func() *types.IdlewatcherConfig{
+		"exec": func() *types.IdlewatcherConfig {
+			return &types.IdlewatcherConfig{Exec: &types.ExecConfig{Start: "touch /tmp/pwned", Stop: "true", Status: "true"}}
+		},
+		"systemd": func() *types.IdlewatcherConfig {
+			return &types.IdlewatcherConfig{Systemd: &types.SystemdConfig{Unit: "app.service"}}
+		},
+	}
+	providerTypes := []provider.Type{
+		provider.ProviderTypeFile,
+		provider.ProviderTypeDocker,
+		provider.ProviderTypeAgent,
+		provider.ProviderTypeKubernetes,
+		provider.ProviderTypeConsul,
+		provider.ProviderTypeEtcd,
+		provider.ProviderTypeHTTP,
+		provider.ProviderTypeGit,
+	}
+	for _, typ := range providerTypes {
+		for name, cfg := range configs {
+			t.Run(string(typ)+"/"+name, func(t *testing.T) {
+				p := newProvider(typ)
+				p.ProviderImpl = testProviderImpl{}
+				r := &route.Route{
+					Alias:       "app",
+					Scheme:      routeTypes.SchemeHTTP,
+					Host:        "example.com",
+					Port:        routeTypes.Port{Proxy: 80},
+					Idlewatcher: cfg(),
+				}
+				r.SetProvider(p)
+				err := r.Validate()
+				if typ == provider.ProviderTypeFile {
+					expect.NoError(t, err)
+				} else {
+					expect.ErrorContains(t, err, "only allowed in route files")
+				}
+			})
+		}
+	}
+}
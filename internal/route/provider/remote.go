@@ -0,0 +1,61 @@
+package provider
+
+import (
+	"maps"
+	"slices"
+	"strings"
+
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// remoteRouteFields are the route fields allowed in routes defined by remote sources,
+// i.e. Kubernetes annotations, service discovery entries and Git repositories.
+//
+// Fields reading or writing files of the host, binding host addresses or running commands are not allowed.
+// Keys are normalized like field names are matched by the serializer: lower case without underscores.
+var remoteRouteFields = map[string]struct{}{
+	"alias":                 {},
+	"scheme":                {},
+	"host":                  {},
+	"port":                  {},
+	"pathpatterns":          {},
+	"rules":                 {},
+	"healthcheck":           {},
+	"loadbalance":           {},
+	"middlewares":           {},
+	"homepage":              {},
+	"notlsverify":           {},
+	"responseheadertimeout": {},
+	"disablecompression":    {},
+	"sslservername":         {},
+	"sslprotocols":          {},
+	"sslverifyname":         {},
+}
+
+var (
+	ErrRemoteRouteField  = gperr.New("field is not allowed for remote routes")
+	ErrRemoteRouteScheme = gperr.New("scheme is not allowed for remote routes")
+)
+
+func normalizeRouteField(key string) string {
+	return strings.ToLower(strings.ReplaceAll(key, "_", ""))
+}
+
+// validateRemoteRoute checks that a route entry from a remote source only sets fields in remoteRouteFields
+// and does not serve files of the host.
+func validateRemoteRoute(entry map[string]any) gperr.Error {
+	var errs gperr.Builder
+	for _, key := range slices.Sorted(maps.Keys(entry)) {
+		field := normalizeRouteField(key)
+		if _, ok := remoteRouteFields[field]; !ok {
+			errs.Add(ErrRemoteRouteField.Subject(key))
+			continue
+		}
+		if field == "scheme" {
+			if scheme, ok := entry[key].(string); ok && strings.EqualFold(scheme, "fileserver") {
+				errs.Add(ErrRemoteRouteScheme.Subject(scheme))
+			}
+		}
+	}
+	return errs.Error()
+}
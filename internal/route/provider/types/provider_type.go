@@ -6,4 +6,10 @@ const (
 	ProviderTypeDocker Type = "docker"
 	ProviderTypeFile   Type = "file"
 	ProviderTypeAgent  Type = "agent"
+
+	ProviderTypeKubernetes Type = "kubernetes"
+	ProviderTypeConsul     Type = "consul"
+	ProviderTypeEtcd       Type = "etcd"
+	ProviderTypeHTTP       Type = "http"
+	ProviderTypeGit        Type = "git"
 )
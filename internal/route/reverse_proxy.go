@@ -182,7 +182,7 @@ func (r *ReveseProxyRoute) Start(parent task.Parent) gperr.Error {
 
 func (r *ReveseProxyRoute) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	// req.Header.Set("Accept-Encoding", "identity")
-	r.handler.ServeHTTP(w, req)
+	r.handler.ServeHTTP(w, accesslog.WithAnnotations(req))
 }
 
 var lbLock sync.Mutex
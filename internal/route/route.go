@@ -23,6 +23,7 @@ import (
 	iconlist "github.com/yusing/godoxy/internal/homepage/icons/list"
 	homepagecfg "github.com/yusing/godoxy/internal/homepage/types"
 	netutils "github.com/yusing/godoxy/internal/net"
+	"github.com/yusing/godoxy/internal/net/gphttp/middleware"
 	nettypes "github.com/yusing/godoxy/internal/net/types"
 	"github.com/yusing/godoxy/internal/proxmox"
 	"github.com/yusing/godoxy/internal/serialization"
@@ -249,6 +250,7 @@ func (r *Route) validate() gperr.Error {
 		r.validateProxmox()
 	}
 
+	// container level idlewatcher labels (e.g. proxy.idle_timeout, proxy.activity) apply to every route of the container
 	if r.Container != nil && r.Container.IdlewatcherConfig != nil {
 		r.Idlewatcher = r.Container.IdlewatcherConfig
 	}
@@ -271,6 +273,16 @@ func (r *Route) validate() gperr.Error {
 		errs.Add(err)
 	}
 
+	// labels, annotations and remote catalogs must not be able to run commands or manage units on the host
+	if r.Idlewatcher != nil && (r.Idlewatcher.Exec != nil || r.Idlewatcher.Systemd != nil) && !r.isTrusted() {
+		errs.Adds("idlewatcher exec and systemd providers are only allowed in route files")
+	}
+	if !r.isTrusted() {
+		if err := middleware.ValidateUntrustedWAF(r.Middlewares); err != nil {
+			errs.Add(err)
+		}
+	}
+
 	var impl types.Route
 	var err gperr.Error
 
@@ -560,6 +572,11 @@ func (r *Route) SetProvider(p types.RouteProvider) {
 	r.Provider = p.ShortName()
 }
 
+// isTrusted reports whether the route is defined by the host administrator, see types.RouteProvider.
+func (r *Route) isTrusted() bool {
+	return r.provider != nil && r.provider.IsTrusted()
+}
+
 func (r *Route) ProviderName() string {
 	return r.Provider
 }
@@ -725,7 +742,8 @@ func (r *Route) IsDocker() bool {
 	if r.Container == nil {
 		return false
 	}
-	return r.Container.ContainerID != ""
+	// tasks of swarm services may run on other nodes and cannot be inspected as containers
+	return r.Container.ContainerID != "" && r.Container.SwarmService == nil
 }
 
 func (r *Route) IsZeroPort() bool {
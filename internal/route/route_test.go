@@ -23,6 +23,21 @@ func TestRouteValidate(t *testing.T) {
 		expect.ErrorContains(t, err, "reserved for godoxy")
 	})
 
+	t.Run("UntrustedWAFRules", func(t *testing.T) {
+		r := &Route{
+			Alias:  "test",
+			Scheme: route.SchemeHTTP,
+			Host:   "example.com",
+			Port:   route.Port{Proxy: 80},
+			Middlewares: map[string]types.LabelMap{
+				"waf": {"crs": true, "rule_files": []string{"*.conf"}},
+			},
+		}
+		err := r.Validate()
+		expect.HasError(t, err, "Validate should return error for waf rule files not from a route file")
+		expect.ErrorContains(t, err, "only allowed in route files")
+	})
+
 	t.Run("ListeningPortWithHTTP", func(t *testing.T) {
 		r := &Route{
 			Alias:  "test",
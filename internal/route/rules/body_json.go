@@ -0,0 +1,372 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// JSON documents are decoded into any with json.Number for numbers,
+// so numbers are re-encoded as they were. Object keys are re-encoded in sorted order.
+
+// jsonPatchOp is an operation of a JSON patch (RFC 6902).
+type jsonPatchOp struct {
+	Op    string   `json:"op"`
+	Path  string   `json:"path"`
+	From  string   `json:"from,omitempty"`
+	Value any      `json:"value"`
+	path  []string // parsed Path
+	from  []string // parsed From
+}
+
+var (
+	errJSONPathNotFound  = errors.New("path not found")
+	jsonPointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+func decodeJSON(b []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after JSON value")
+	}
+	return v, nil
+}
+
+func encodeJSON(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// parseJSONPath parses a JSONPath with only child and index selectors,
+// e.g. "$.user.name", "items[0].id" or "$['key.with.dots']", into path tokens.
+func parseJSONPath(s string) ([]string, error) {
+	orig := s
+	s = strings.TrimPrefix(s, "$")
+	var tokens []string
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated [ in %q", orig)
+			}
+			inner := s[i+1 : i+end]
+			i += end + 1
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				tokens = append(tokens, inner[1:len(inner)-1])
+				continue
+			}
+			if n, err := strconv.Atoi(inner); err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid index [%s] in %q", inner, orig)
+			}
+			tokens = append(tokens, inner)
+		case s[i] == '.' || i == 0:
+			if s[i] == '.' {
+				i++
+			}
+			end := strings.IndexAny(s[i:], ".[")
+			if end == -1 {
+				end = len(s) - i
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty key in %q", orig)
+			}
+			tokens = append(tokens, s[i:i+end])
+			i += end
+		default:
+			return nil, fmt.Errorf("unexpected %q in %q", s[i], orig)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("path %q selects the whole document", orig)
+	}
+	return tokens, nil
+}
+
+// parseJSONPointer parses a JSON pointer (RFC 6901), e.g. "/user/name", "" is the whole document.
+func parseJSONPointer(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if s[0] != '/' {
+		return nil, fmt.Errorf("JSON pointer %q must start with /", s)
+	}
+	tokens := strings.Split(s[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = jsonPointerUnescaper.Replace(token)
+	}
+	return tokens, nil
+}
+
+// jsonArrayIndex returns the index of token in an array of length n, allowAppend allows "-" and n.
+func jsonArrayIndex(token string, n int, allowAppend bool) (int, error) {
+	if token == "-" && allowAppend {
+		return n, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if i > n || (i == n && !allowAppend) {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+func jsonGet(node any, tokens []string) (any, error) {
+	for _, token := range tokens {
+		switch v := node.(type) {
+		case map[string]any:
+			child, ok := v[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", errJSONPathNotFound, token)
+			}
+			node = child
+		case []any:
+			i, err := jsonArrayIndex(token, len(v), false)
+			if err != nil {
+				return nil, err
+			}
+			node = v[i]
+		default:
+			return nil, fmt.Errorf("%w: %s", errJSONPathNotFound, token)
+		}
+	}
+	return node, nil
+}
+
+// jsonUpdate calls f with the parent of the last token and returns node with the updated parent.
+// If create is true, missing objects on the way are created.
+func jsonUpdate(node any, tokens []string, create bool, f func(parent any, last string) (any, error)) (any, error) {
+	if len(tokens) == 1 {
+		return f(node, tokens[0])
+	}
+	token := tokens[0]
+	switch v := node.(type) {
+	case map[string]any:
+		child, ok := v[token]
+		if !ok {
+			if !create {
+				return nil, fmt.Errorf("%w: %s", errJSONPathNotFound, token)
+			}
+			child = map[string]any{}
+		}
+		child, err := jsonUpdate(child, tokens[1:], create, f)
+		if err != nil {
+			return nil, err
+		}
+		v[token] = child
+		return v, nil
+	case []any:
+		i, err := jsonArrayIndex(token, len(v), false)
+		if err != nil {
+			return nil, err
+		}
+		child, err := jsonUpdate(v[i], tokens[1:], create, f)
+		if err != nil {
+			return nil, err
+		}
+		v[i] = child
+		return v, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", errJSONPathNotFound, token)
+	}
+}
+
+// jsonSet sets the value at tokens, replacing an existing value,
+// missing objects are created and an array index equal to the length appends.
+func jsonSet(doc any, tokens []string, value any) (any, error) {
+	return jsonUpdate(doc, tokens, true, func(parent any, last string) (any, error) {
+		switch p := parent.(type) {
+		case map[string]any:
+			p[last] = value
+			return p, nil
+		case []any:
+			i, err := jsonArrayIndex(last, len(p), true)
+			if err != nil {
+				return nil, err
+			}
+			if i == len(p) {
+				return append(p, value), nil
+			}
+			p[i] = value
+			return p, nil
+		default:
+			return nil, fmt.Errorf("cannot set %s of a non-container value", last)
+		}
+	})
+}
+
+// jsonAdd adds the value at tokens like the "add" operation of JSON patch,
+// it inserts into arrays instead of replacing.
+func jsonAdd(doc any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return jsonUpdate(doc, tokens, false, func(parent any, last string) (any, error) {
+		switch p := parent.(type) {
+		case map[string]any:
+			p[last] = value
+			return p, nil
+		case []any:
+			i, err := jsonArrayIndex(last, len(p), true)
+			if err != nil {
+				return nil, err
+			}
+			p = append(p, nil)
+			copy(p[i+1:], p[i:])
+			p[i] = value
+			return p, nil
+		default:
+			return nil, fmt.Errorf("cannot add %s to a non-container value", last)
+		}
+	})
+}
+
+// jsonRemove removes the value at tokens, it fails if the value does not exist.
+func jsonRemove(doc any, tokens []string) (any, error) {
+	if len(tokens) == 0 {
+		return nil, errors.New("cannot remove the whole document")
+	}
+	return jsonUpdate(doc, tokens, false, func(parent any, last string) (any, error) {
+		switch p := parent.(type) {
+		case map[string]any:
+			if _, ok := p[last]; !ok {
+				return nil, fmt.Errorf("%w: %s", errJSONPathNotFound, last)
+			}
+			delete(p, last)
+			return p, nil
+		case []any:
+			i, err := jsonArrayIndex(last, len(p), false)
+			if err != nil {
+				return nil, err
+			}
+			return append(p[:i], p[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("%w: %s", errJSONPathNotFound, last)
+		}
+	})
+}
+
+// jsonMergePatch applies a JSON merge patch (RFC 7386), patch is copied.
+func jsonMergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return jsonDeepCopy(patch)
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any, len(p))
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = jsonMergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+// parseJSONPatch parses and validates a JSON patch (RFC 6902).
+func parseJSONPatch(b []byte) ([]jsonPatchOp, error) {
+	var ops []jsonPatchOp
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&ops); err != nil {
+		return nil, err
+	}
+	for i := range ops {
+		op := &ops[i]
+		var err error
+		if op.path, err = parseJSONPointer(op.Path); err != nil {
+			return nil, fmt.Errorf("op %d: %w", i, err)
+		}
+		switch op.Op {
+		case "add", "replace", "test", "remove":
+		case "move", "copy":
+			if op.from, err = parseJSONPointer(op.From); err != nil {
+				return nil, fmt.Errorf("op %d: %w", i, err)
+			}
+		default:
+			return nil, fmt.Errorf("op %d: unknown op %q", i, op.Op)
+		}
+	}
+	return ops, nil
+}
+
+// applyJSONPatch applies the operations in order, doc is modified in place.
+func applyJSONPatch(doc any, ops []jsonPatchOp) (any, error) {
+	var err error
+	for i, op := range ops {
+		switch op.Op {
+		case "add":
+			doc, err = jsonAdd(doc, op.path, jsonDeepCopy(op.Value))
+		case "remove":
+			doc, err = jsonRemove(doc, op.path)
+		case "replace":
+			if _, err = jsonGet(doc, op.path); err == nil {
+				if len(op.path) == 0 {
+					doc = jsonDeepCopy(op.Value)
+				} else {
+					doc, err = jsonSet(doc, op.path, jsonDeepCopy(op.Value))
+				}
+			}
+		case "move":
+			var v any
+			if v, err = jsonGet(doc, op.from); err == nil {
+				if doc, err = jsonRemove(doc, op.from); err == nil {
+					doc, err = jsonAdd(doc, op.path, v)
+				}
+			}
+		case "copy":
+			var v any
+			if v, err = jsonGet(doc, op.from); err == nil {
+				doc, err = jsonAdd(doc, op.path, jsonDeepCopy(v))
+			}
+		case "test":
+			var v any
+			if v, err = jsonGet(doc, op.path); err == nil && !reflect.DeepEqual(v, op.Value) {
+				err = fmt.Errorf("test failed at %q", op.Path)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("op %d (%s): %w", i, op.Op, err)
+		}
+	}
+	return doc, nil
+}
+
+// jsonDeepCopy copies a decoded JSON value, so values parsed once can be inserted into many documents.
+func jsonDeepCopy(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, child := range v {
+			m[k] = jsonDeepCopy(child)
+		}
+		return m
+	case []any:
+		l := make([]any, len(v))
+		for i, child := range v {
+			l[i] = jsonDeepCopy(child)
+		}
+		return l
+	default:
+		return v
+	}
+}
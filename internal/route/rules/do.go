@@ -38,6 +38,7 @@ const (
 	CommandRewrite          = "rewrite"
 	CommandServe            = "serve"
 	CommandProxy            = "proxy"
+	CommandProxyTo          = "proxy_to"
 	CommandRedirect         = "redirect"
 	CommandRoute            = "route"
 	CommandError            = "error"
@@ -47,6 +48,16 @@ const (
 	CommandRemove           = "remove"
 	CommandLog              = "log"
 	CommandNotify           = "notify"
+	CommandSetKV            = "set_kv"
+	CommandDelKV            = "del_kv"
+	CommandIncr             = "incr"
+	CommandReplace          = "replace"
+	CommandJSONSet          = "json_set"
+	CommandJSONDel          = "json_del"
+	CommandJSONMerge        = "json_merge"
+	CommandJSONPatch        = "json_patch"
+	CommandFormSet          = "form_set"
+	CommandFormDel          = "form_del"
 	CommandPass             = "pass"
 	CommandPassAlt          = "bypass"
 )
@@ -219,6 +230,7 @@ var commands = map[string]struct {
 			description: makeLines(
 				"Send an HTTP error response and terminate processing, e.g.:",
 				helpExample(CommandError, "400", "bad request"),
+				"The text is not sent for statuses without a body, i.e. 1xx, 204 and 304.",
 			),
 			args: map[string]string{
 				"code": "the http status code to return",
@@ -249,6 +261,9 @@ var commands = map[string]struct {
 				// error command should overwrite the response body
 				httputils.GetInitResponseModifier(w).ResetBody()
 				w.WriteHeader(code)
+				if !bodyAllowedForStatus(code) {
+					return nil
+				}
 				err := textTmpl.ExpandVars(w, r, w)
 				return err
 			})
@@ -319,6 +334,24 @@ var commands = map[string]struct {
 			})
 		},
 	},
+	CommandProxyTo: {
+		help: Help{
+			command: CommandProxyTo,
+			description: makeLines(
+				"Proxy the request to an URL built from variables, restricted to the allowed destinations, e.g.:",
+				helpExample(CommandProxyTo, "http://$header(X-Backend):8080", "*.internal", "10.0.0.0/8"),
+				"Or to the URL of the key in a lookup table, e.g.:",
+				helpExample(CommandProxyTo, "$path_segment(0)", "users=http://users:8080", "orders=http://orders:8080"),
+			),
+			args: map[string]string{
+				"target":  "the URL template, or the lookup key template",
+				"allowed": "the allowed host names (globs), IPs and CIDRs, host names not allowed are checked by their resolved IPs",
+				"key=url": "the entries of the lookup table, unknown keys are responded with 404",
+			},
+		},
+		validate: validateProxyTo,
+		build:    buildProxyTo,
+	},
 	CommandSet: {
 		help: Help{
 			command: CommandSet,
@@ -507,6 +540,221 @@ var commands = map[string]struct {
 			})
 		},
 	},
+	CommandSetKV: {
+		help: Help{
+			command: CommandSetKV,
+			description: makeLines(
+				"Set a value in the key-value store of the route, e.g.:",
+				helpExample(CommandSetKV, "token:$arg(token)", "valid", "24h"),
+				helpExample(CommandSetKV, "global:maintenance", "on", "0", kvPersist),
+				"Keys starting with global: are shared by all routes.",
+				"The value never expires if ttl is omitted or 0, keys with variables require a ttl.",
+				"Add persist to keep the value across restarts.",
+			),
+			args: map[string]string{
+				"key":     "the key, supports variables",
+				"value":   "the value, supports variables",
+				"ttl":     "optional, the time to live, e.g. 10m",
+				"persist": "optional, persist the value",
+			},
+		},
+		validate: validateSetKV,
+		build: func(args any) CommandHandler {
+			kv := args.(*setKVArgs)
+			return NonTerminatingCommand(func(w http.ResponseWriter, r *http.Request) error {
+				key, err := kv.key.ExpandVarsToString(w, r)
+				if err != nil {
+					return err
+				}
+				value, err := kv.value.ExpandVarsToString(w, r)
+				if err != nil {
+					return err
+				}
+				kvSet(kvKey(r, key), value, kv.ttl, kv.persist)
+				return nil
+			})
+		},
+	},
+	CommandDelKV: {
+		help: Help{
+			command: CommandDelKV,
+			description: makeLines(
+				"Delete a value from the key-value store, e.g.:",
+				helpExample(CommandDelKV, "token:$arg(token)"),
+			),
+			args: map[string]string{
+				"key": "the key, supports variables",
+			},
+		},
+		validate: func(args []string) (any, gperr.Error) {
+			if len(args) != 1 {
+				return nil, ErrExpectOneArg
+			}
+			return validateTemplate(args[0], false)
+		},
+		build: func(args any) CommandHandler {
+			keyTmpl := args.(templateString)
+			return NonTerminatingCommand(func(w http.ResponseWriter, r *http.Request) error {
+				key, err := keyTmpl.ExpandVarsToString(w, r)
+				if err != nil {
+					return err
+				}
+				kvDelete(kvKey(r, key))
+				return nil
+			})
+		},
+	},
+	CommandIncr: {
+		help: Help{
+			command: CommandIncr,
+			description: makeLines(
+				"Increment a counter in the key-value store, e.g.:",
+				helpExample(CommandIncr, "auth_fail:$remote_host", "10m"),
+				"The counter starts at 1 and resets after window since then,",
+				"it never resets if window is omitted or 0, keys with variables require a window.",
+				"Match it with e.g. `kv auth_fail:$remote_host >=5`.",
+			),
+			args: map[string]string{
+				"key":     "the key, supports variables",
+				"window":  "optional, the counter window, e.g. 10m",
+				"persist": "optional, persist the counter",
+			},
+		},
+		validate: validateIncr,
+		build: func(args any) CommandHandler {
+			kv := args.(*setKVArgs)
+			return NonTerminatingCommand(func(w http.ResponseWriter, r *http.Request) error {
+				key, err := kv.key.ExpandVarsToString(w, r)
+				if err != nil {
+					return err
+				}
+				kvIncr(kvKey(r, key), kv.ttl, kv.persist)
+				return nil
+			})
+		},
+	},
+	CommandReplace: {
+		help: Help{
+			command: CommandReplace,
+			description: makeLines(
+				"Find and replace in a text request or response body, e.g.:",
+				helpExample(CommandReplace, FieldResponseBody, "http://internal.lan", "https://example.com"),
+				helpExample(CommandReplace, FieldBody, helpFuncCall("regex", `v1/(\w+)`), "v2/$1"),
+				"The body is left unchanged if it is not text, compressed or larger than 4 MiB,",
+				"or for responses, if it has no Content-Length.",
+			),
+			args: map[string]string{
+				"target":      fmt.Sprintf("%s or %s", FieldBody, FieldResponseBody),
+				"find":        "the string or regex to find",
+				"replacement": "the replacement, $1 refers to the first submatch of the regex",
+			},
+		},
+		validate: validateReplace,
+		build:    buildReplace,
+	},
+	CommandJSONSet: {
+		help: Help{
+			command: CommandJSONSet,
+			description: makeLines(
+				"Set a field of a JSON request or response body, e.g.:",
+				helpExample(CommandJSONSet, FieldBody, "$.client.version", "2"),
+				helpExample(CommandJSONSet, FieldResponseBody, "items[0].url", "$req_url"),
+				"The value is JSON if valid, otherwise a string. Missing objects on the path are created.",
+			),
+			args: map[string]string{
+				"target": fmt.Sprintf("%s or %s", FieldBody, FieldResponseBody),
+				"path":   "the JSONPath of the field, e.g. $.a.b[0]",
+				"value":  "the value template",
+			},
+		},
+		validate: validateJSONSet,
+		build:    buildJSONSet,
+	},
+	CommandJSONDel: {
+		help: Help{
+			command: CommandJSONDel,
+			description: makeLines(
+				"Delete a field of a JSON request or response body, e.g.:",
+				helpExample(CommandJSONDel, FieldResponseBody, "$.user.password_hash"),
+			),
+			args: map[string]string{
+				"target": fmt.Sprintf("%s or %s", FieldBody, FieldResponseBody),
+				"path":   "the JSONPath of the field, e.g. $.a.b[0]",
+			},
+		},
+		validate: validateJSONDel,
+		build:    buildJSONDel,
+	},
+	CommandJSONMerge: {
+		help: Help{
+			command: CommandJSONMerge,
+			description: makeLines(
+				"Apply a JSON merge patch (RFC 7386) to a JSON request or response body, e.g.:",
+				helpExample(CommandJSONMerge, FieldBody, `'{"legacy": true, "debug": null}'`),
+			),
+			args: map[string]string{
+				"target": fmt.Sprintf("%s or %s", FieldBody, FieldResponseBody),
+				"patch":  "the merge patch, null removes a field",
+			},
+		},
+		validate: validateJSONMerge,
+		build:    buildJSONMerge,
+	},
+	CommandJSONPatch: {
+		help: Help{
+			command: CommandJSONPatch,
+			description: makeLines(
+				"Apply a JSON patch (RFC 6902) to a JSON request or response body, e.g.:",
+				helpExample(CommandJSONPatch, FieldResponseBody, `'[{"op": "move", "from": "/name", "path": "/full_name"}]'`),
+				"The body is left unchanged if any operation fails.",
+			),
+			args: map[string]string{
+				"target": fmt.Sprintf("%s or %s", FieldBody, FieldResponseBody),
+				"patch":  "the array of operations",
+			},
+		},
+		validate: validateJSONPatch,
+		build:    buildJSONPatch,
+	},
+	CommandFormSet: {
+		help: Help{
+			command: CommandFormSet,
+			description: makeLines(
+				"Set a field of an urlencoded form request body, e.g.:",
+				helpExample(CommandFormSet, "client", "legacy"),
+			),
+			args: map[string]string{
+				"field": "the form field",
+				"value": "the value template",
+			},
+		},
+		validate: toKeyValueTemplate,
+		build: func(args any) CommandHandler {
+			field, tmpl := args.(*keyValueTemplate).Unpack()
+			return buildFormEdit(field, &tmpl)
+		},
+	},
+	CommandFormDel: {
+		help: Help{
+			command: CommandFormDel,
+			description: makeLines(
+				"Delete a field of an urlencoded form request body, e.g.:",
+				helpExample(CommandFormDel, "debug"),
+			),
+			args: map[string]string{
+				"field": "the form field",
+			},
+		},
+		validate: func(args []string) (any, gperr.Error) {
+			if len(args) != 1 {
+				return nil, ErrExpectOneArg
+			}
+			return args[0], nil
+		},
+		build: func(args any) CommandHandler {
+			return buildFormEdit(args.(string), nil)
+		},
+	},
 }
 
 type onLogArgs = Tuple3[zerolog.Level, io.WriteCloser, templateString]
@@ -608,6 +856,17 @@ func buildCmd(executors []CommandHandler) (cmd CommandHandler, err error) {
 	return Commands(executors), nil
 }
 
+// bodyAllowedForStatus reports whether a response with the status may have a body, see RFC 9110 section 6.4.1.
+func bodyAllowedForStatus(code int) bool {
+	switch {
+	case code >= 100 && code <= 199:
+		return false
+	case code == http.StatusNoContent, code == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
 // Command is purely "bypass" or empty.
 func (cmd *Command) isBypass() bool {
 	if cmd == nil {
@@ -0,0 +1,360 @@
+package rules
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	gperr "github.com/yusing/goutils/errs"
+	httputils "github.com/yusing/goutils/http"
+)
+
+// maxTransformBodySize is the maximum size of a body to transform,
+// larger bodies are passed through unchanged.
+const maxTransformBodySize = 4 << 20 // 4 MiB
+
+// bodyTransform returns the transformed body, or nil to leave it unchanged,
+// e.g. when it is not valid JSON. The error is only for failures unrelated to the body.
+type bodyTransform func(w http.ResponseWriter, r *http.Request, body []byte) ([]byte, error)
+
+type (
+	replaceArgs struct {
+		target      string
+		find        []byte
+		re          *regexp.Regexp
+		replacement []byte
+	}
+	jsonPathArgs struct {
+		target string
+		path   []string
+		value  templateString
+	}
+	jsonDocArgs struct {
+		target string
+		doc    any
+		ops    []jsonPatchOp
+	}
+)
+
+// validateBodyTarget returns the target, body or resp_body.
+func validateBodyTarget(target string) (string, gperr.Error) {
+	switch target {
+	case FieldBody, FieldResponseBody:
+		return target, nil
+	default:
+		return "", ErrInvalidArguments.Withf("target must be %s or %s, got %q", FieldBody, FieldResponseBody, target)
+	}
+}
+
+// validateReplace returns *replaceArgs from "target find replacement",
+// find is a literal string or regex(...), the replacement may refer to submatches like $1.
+func validateReplace(args []string) (any, gperr.Error) {
+	if len(args) != 3 {
+		return nil, ErrExpectThreeArgs
+	}
+	target, err := validateBodyTarget(args[0])
+	if err != nil {
+		return nil, err
+	}
+	replace := &replaceArgs{target: target, replacement: []byte(args[2])}
+	if strings.HasPrefix(args[1], "regex(") {
+		_, expr, err := ExtractExpr(args[1])
+		if err != nil {
+			return nil, err
+		}
+		re, rErr := regexp.Compile(expr)
+		if rErr != nil {
+			return nil, ErrInvalidArguments.With(rErr)
+		}
+		replace.re = re
+		return replace, nil
+	}
+	if args[1] == "" {
+		return nil, ErrInvalidArguments.Withf("empty string to find")
+	}
+	replace.find = []byte(args[1])
+	return replace, nil
+}
+
+// validateJSONSet returns *jsonPathArgs from "target path value".
+func validateJSONSet(args []string) (any, gperr.Error) {
+	if len(args) != 3 {
+		return nil, ErrExpectThreeArgs
+	}
+	jp, err := validateJSONPathArgs(args[:2])
+	if err != nil {
+		return nil, err
+	}
+	jp.value, err = validateTemplate(args[2], false)
+	if err != nil {
+		return nil, err
+	}
+	return jp, nil
+}
+
+// validateJSONDel returns *jsonPathArgs from "target path".
+func validateJSONDel(args []string) (any, gperr.Error) {
+	if len(args) != 2 {
+		return nil, ErrExpectTwoArgs
+	}
+	return validateJSONPathArgs(args)
+}
+
+func validateJSONPathArgs(args []string) (*jsonPathArgs, gperr.Error) {
+	target, err := validateBodyTarget(args[0])
+	if err != nil {
+		return nil, err
+	}
+	path, pErr := parseJSONPath(args[1])
+	if pErr != nil {
+		return nil, ErrInvalidArguments.With(pErr)
+	}
+	return &jsonPathArgs{target: target, path: path}, nil
+}
+
+// validateJSONMerge returns *jsonDocArgs from "target merge_patch".
+func validateJSONMerge(args []string) (any, gperr.Error) {
+	if len(args) != 2 {
+		return nil, ErrExpectTwoArgs
+	}
+	target, err := validateBodyTarget(args[0])
+	if err != nil {
+		return nil, err
+	}
+	doc, dErr := decodeJSON([]byte(args[1]))
+	if dErr != nil {
+		return nil, ErrInvalidArguments.With(dErr)
+	}
+	return &jsonDocArgs{target: target, doc: doc}, nil
+}
+
+// validateJSONPatch returns *jsonDocArgs from "target json_patch".
+func validateJSONPatch(args []string) (any, gperr.Error) {
+	if len(args) != 2 {
+		return nil, ErrExpectTwoArgs
+	}
+	target, err := validateBodyTarget(args[0])
+	if err != nil {
+		return nil, err
+	}
+	ops, pErr := parseJSONPatch([]byte(args[1]))
+	if pErr != nil {
+		return nil, ErrInvalidArguments.With(pErr)
+	}
+	return &jsonDocArgs{target: target, ops: ops}, nil
+}
+
+func buildReplace(args any) CommandHandler {
+	replace := args.(*replaceArgs)
+	return transformBody(replace.target, isTextMediaType, func(_ http.ResponseWriter, _ *http.Request, body []byte) ([]byte, error) {
+		if replace.re != nil {
+			if !replace.re.Match(body) {
+				return nil, nil
+			}
+			return replace.re.ReplaceAll(body, replace.replacement), nil
+		}
+		if !bytes.Contains(body, replace.find) {
+			return nil, nil
+		}
+		return bytes.ReplaceAll(body, replace.find, replace.replacement), nil
+	})
+}
+
+func buildJSONSet(args any) CommandHandler {
+	jp := args.(*jsonPathArgs)
+	return transformJSON(jp.target, func(w http.ResponseWriter, r *http.Request, doc any) (any, error) {
+		s, err := jp.value.ExpandVarsToString(w, r)
+		if err != nil {
+			return nil, err
+		}
+		// the value is JSON if valid, otherwise a string
+		value, jErr := decodeJSON([]byte(s))
+		if jErr != nil {
+			value = s
+		}
+		doc, jErr = jsonSet(doc, jp.path, value)
+		if jErr != nil {
+			return nil, nil
+		}
+		return doc, nil
+	})
+}
+
+func buildJSONDel(args any) CommandHandler {
+	jp := args.(*jsonPathArgs)
+	return transformJSON(jp.target, func(_ http.ResponseWriter, _ *http.Request, doc any) (any, error) {
+		doc, err := jsonRemove(doc, jp.path)
+		if err != nil {
+			return nil, nil
+		}
+		return doc, nil
+	})
+}
+
+func buildJSONMerge(args any) CommandHandler {
+	patch := args.(*jsonDocArgs)
+	return transformJSON(patch.target, func(_ http.ResponseWriter, _ *http.Request, doc any) (any, error) {
+		return jsonMergePatch(doc, patch.doc), nil
+	})
+}
+
+func buildJSONPatch(args any) CommandHandler {
+	patch := args.(*jsonDocArgs)
+	return transformJSON(patch.target, func(_ http.ResponseWriter, _ *http.Request, doc any) (any, error) {
+		doc, err := applyJSONPatch(doc, patch.ops)
+		if err != nil {
+			return nil, nil
+		}
+		return doc, nil
+	})
+}
+
+// buildFormEdit returns a command that edits the urlencoded request body,
+// value is nil to delete the field.
+func buildFormEdit(field string, value *templateString) CommandHandler {
+	return transformBody(FieldBody, isFormMediaType, func(w http.ResponseWriter, r *http.Request, body []byte) ([]byte, error) {
+		form := r.PostForm // already parsed, e.g. by the postform matcher
+		if form == nil {
+			var err error
+			form, err = url.ParseQuery(string(body))
+			if err != nil {
+				return nil, nil
+			}
+		}
+		if value == nil {
+			form.Del(field)
+		} else {
+			v, err := value.ExpandVarsToString(w, r)
+			if err != nil {
+				return nil, err
+			}
+			form.Set(field, v)
+		}
+		r.PostForm = form
+		r.Form = nil // merged with the query again on the next ParseForm
+		return []byte(form.Encode()), nil
+	})
+}
+
+// transformJSON returns a command that transforms a JSON body,
+// transform returns nil to leave the body unchanged.
+func transformJSON(target string, transform func(w http.ResponseWriter, r *http.Request, doc any) (any, error)) CommandHandler {
+	return transformBody(target, isJSONMediaType, func(w http.ResponseWriter, r *http.Request, body []byte) ([]byte, error) {
+		doc, err := decodeJSON(body)
+		if err != nil {
+			return nil, nil
+		}
+		doc, err = transform(w, r, doc)
+		if err != nil || doc == nil {
+			return nil, err
+		}
+		return encodeJSON(doc)
+	})
+}
+
+// transformBody returns a command that transforms the request or response body
+// if its content type is accepted, it is not encoded (e.g. gzip) and it is within maxTransformBodySize.
+//
+// Responses are transformed only if their Content-Length is known and within the limit,
+// i.e. streamed responses are passed through. Requests of unknown length are read up to the limit.
+func transformBody(target string, accept func(mediaType string) bool, transform bodyTransform) CommandHandler {
+	if target == FieldResponseBody {
+		return OnResponseCommand(func(w http.ResponseWriter, r *http.Request) error {
+			rm := httputils.GetInitResponseModifier(w)
+			if !canTransformBody(rm.Header(), accept) {
+				return nil
+			}
+			size, err := strconv.ParseInt(rm.Header().Get("Content-Length"), 10, 64)
+			if err != nil || size < 0 || size > maxTransformBodySize {
+				return nil
+			}
+			body := rm.Content()
+			if len(body) > maxTransformBodySize {
+				return nil
+			}
+			newBody, err := transform(w, r, body)
+			if err != nil || newBody == nil {
+				return err
+			}
+			rm.ResetBody()
+			rm.Header().Set("Content-Length", strconv.Itoa(len(newBody)))
+			_, err = rm.Write(newBody)
+			return err
+		})
+	}
+	return NonTerminatingCommand(func(w http.ResponseWriter, r *http.Request) error {
+		if r.Body == nil || r.Body == http.NoBody || r.ContentLength > maxTransformBodySize || !canTransformBody(r.Header, accept) {
+			return nil
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxTransformBodySize+1))
+		if err != nil {
+			return err
+		}
+		if len(body) > maxTransformBodySize {
+			// pass through the read part and the rest unchanged
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			return nil
+		}
+		r.Body.Close()
+		newBody, err := transform(w, r, body)
+		if err != nil {
+			setRequestBody(r, body)
+			return err
+		}
+		if newBody == nil {
+			newBody = body
+		}
+		setRequestBody(r, newBody)
+		return nil
+	})
+}
+
+func setRequestBody(r *http.Request, body []byte) {
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	r.ContentLength = int64(len(body))
+	if r.Header.Get("Content-Length") != "" {
+		r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+}
+
+func canTransformBody(h http.Header, accept func(mediaType string) bool) bool {
+	if enc := h.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	return err == nil && accept(mediaType)
+}
+
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func isFormMediaType(mediaType string) bool {
+	return mediaType == "application/x-www-form-urlencoded"
+}
+
+func isTextMediaType(mediaType string) bool {
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		isJSONMediaType(mediaType),
+		isFormMediaType(mediaType),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/xml", "application/javascript", "application/x-javascript":
+		return true
+	}
+	return false
+}
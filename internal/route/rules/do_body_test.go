@@ -0,0 +1,208 @@
+package rules
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	httputils "github.com/yusing/goutils/http"
+	expect "github.com/yusing/goutils/testing"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"$.a.b", []string{"a", "b"}},
+		{"a.b[0].c", []string{"a", "b", "0", "c"}},
+		{"$['a.b'][1]", []string{"a.b", "1"}},
+		{`$["x"].y`, []string{"x", "y"}},
+	}
+	for _, tt := range tests {
+		got, err := parseJSONPath(tt.path)
+		expect.NoError(t, err)
+		expect.Equal(t, got, tt.want)
+	}
+	for _, path := range []string{"$", "", "$.", "a..b", "a[x]", "a[-1]", "a[0", "a[0]b"} {
+		_, err := parseJSONPath(path)
+		expect.HasError(t, err, path)
+	}
+}
+
+func TestJSONOps(t *testing.T) {
+	doc := func() any {
+		return expect.Must(decodeJSON([]byte(`{"user":{"name":"a","tags":["x","y"]},"n":1.50}`)))
+	}
+	encode := func(v any) string {
+		return string(expect.Must(encodeJSON(v)))
+	}
+
+	v, err := jsonSet(doc(), []string{"user", "address", "city"}, "Tokyo")
+	expect.NoError(t, err)
+	expect.Equal(t, encode(v), `{"n":1.50,"user":{"address":{"city":"Tokyo"},"name":"a","tags":["x","y"]}}`)
+
+	v, err = jsonSet(doc(), []string{"user", "tags", "2"}, "z")
+	expect.NoError(t, err)
+	expect.Equal(t, encode(v), `{"n":1.50,"user":{"name":"a","tags":["x","y","z"]}}`)
+
+	_, err = jsonSet(doc(), []string{"user", "tags", "5"}, "z")
+	expect.HasError(t, err)
+
+	v, err = jsonRemove(doc(), []string{"user", "tags", "0"})
+	expect.NoError(t, err)
+	expect.Equal(t, encode(v), `{"n":1.50,"user":{"name":"a","tags":["y"]}}`)
+
+	_, err = jsonRemove(doc(), []string{"user", "missing"})
+	expect.ErrorIs(t, errJSONPathNotFound, err)
+
+	patch := expect.Must(decodeJSON([]byte(`{"user":{"name":null,"role":"admin"},"n":2}`)))
+	expect.Equal(t, encode(jsonMergePatch(doc(), patch)), `{"n":2,"user":{"role":"admin","tags":["x","y"]}}`)
+
+	ops := expect.Must(parseJSONPatch([]byte(`[
+		{"op":"test","path":"/user/name","value":"a"},
+		{"op":"add","path":"/user/tags/1","value":"inserted"},
+		{"op":"move","from":"/user/name","path":"/name"},
+		{"op":"copy","from":"/n","path":"/user/n"},
+		{"op":"replace","path":"/n","value":{"a/b":true}},
+		{"op":"remove","path":"/n/a~1b"}
+	]`)))
+	v, err = applyJSONPatch(doc(), ops)
+	expect.NoError(t, err)
+	expect.Equal(t, encode(v), `{"n":{},"name":"a","user":{"n":1.50,"tags":["x","inserted","y"]}}`)
+
+	ops = expect.Must(parseJSONPatch([]byte(`[{"op":"test","path":"/user/name","value":"b"}]`)))
+	_, err = applyJSONPatch(doc(), ops)
+	expect.HasError(t, err)
+
+	for _, patch := range []string{`{}`, `[{"op":"unknown","path":"/a"}]`, `[{"op":"move","from":"a","path":"/b"}]`} {
+		_, err = parseJSONPatch([]byte(patch))
+		expect.HasError(t, err, patch)
+	}
+}
+
+func TestBodyTransformRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		cmd         string
+		contentType string
+		body        string
+		want        string
+	}{
+		{"replace", `replace body foo bar`, "text/plain", "foo foo", "bar bar"},
+		{"replace_regex", `replace body regex("v1/(\w+)") v2/$1`, "application/json", `{"u":"/v1/users"}`, `{"u":"/v2/users"}`},
+		{"replace_not_text", `replace body foo bar`, "application/octet-stream", "foo", "foo"},
+		{"json_set", `json_set body $.client.version 2`, "application/json; charset=utf-8", `{"a":1}`, `{"a":1,"client":{"version":2}}`},
+		{"json_set_string", `json_set body name $req_method`, "application/vnd.api+json", `{}`, `{"name":"POST"}`},
+		{"json_del", `json_del body $.secret`, "application/json", `{"a":1,"secret":"x"}`, `{"a":1}`},
+		{"json_del_missing", `json_del body $.secret`, "application/json", `{"a": 1}`, `{"a": 1}`},
+		{"json_invalid", `json_set body $.a 1`, "application/json", `{invalid`, `{invalid`},
+		{"json_merge", `json_merge body '{"legacy":true,"debug":null}'`, "application/json", `{"debug":true}`, `{"legacy":true}`},
+		{"json_patch", `json_patch body '[{"op":"add","path":"/items/-","value":3}]'`, "application/json", `{"items":[1,2]}`, `{"items":[1,2,3]}`},
+		{"json_not_json", `json_set body $.a 1`, "text/plain", `{}`, `{}`},
+		{"form_set", `form_set client legacy`, "application/x-www-form-urlencoded", "a=1&client=new", "a=1&client=legacy"},
+		{"form_del", `form_del debug`, "application/x-www-form-urlencoded", "a=1&debug=true", "a=1"},
+		{"form_not_form", `form_del debug`, "application/json", `{"debug":true}`, `{"debug":true}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cmd Command
+			expect.NoError(t, cmd.Parse(tt.cmd))
+			expect.False(t, cmd.IsResponseHandler())
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			expect.NoError(t, cmd.exec.Handle(httptest.NewRecorder(), req))
+
+			body := expect.Must(io.ReadAll(req.Body))
+			expect.Equal(t, string(body), tt.want)
+			expect.Equal(t, req.ContentLength, int64(len(tt.want)))
+		})
+	}
+}
+
+func TestBodyTransformRequestLimits(t *testing.T) {
+	var cmd Command
+	expect.NoError(t, cmd.Parse("replace body a b"))
+
+	large := strings.Repeat("a", maxTransformBodySize+1)
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(large))
+	req.Header.Set("Content-Type", "text/plain")
+	expect.NoError(t, cmd.exec.Handle(httptest.NewRecorder(), req))
+	expect.Equal(t, string(expect.Must(io.ReadAll(req.Body))), large)
+
+	// a known oversized length is passed through without reading
+	body := &readCounter{Reader: strings.NewReader(large)}
+	req = httptest.NewRequest(http.MethodPost, "/", body)
+	req.ContentLength = int64(len(large))
+	req.Header.Set("Content-Type", "text/plain")
+	expect.NoError(t, cmd.exec.Handle(httptest.NewRecorder(), req))
+	expect.Equal(t, body.n, 0)
+
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("a"))
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Content-Encoding", "gzip")
+	expect.NoError(t, cmd.exec.Handle(httptest.NewRecorder(), req))
+	expect.Equal(t, string(expect.Must(io.ReadAll(req.Body))), "a")
+}
+
+type readCounter struct {
+	io.Reader
+	n int
+}
+
+func (r *readCounter) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += n
+	return n, err
+}
+
+func TestBodyTransformResponse(t *testing.T) {
+	var cmd Command
+	expect.NoError(t, cmd.Parse(`json_del resp_body $.user.password_hash`))
+	expect.True(t, cmd.IsResponseHandler())
+
+	body := `{"user":{"name":"a","password_hash":"x"}}`
+	newResponse := func(contentLength string) *httputils.ResponseModifier {
+		rm := httputils.NewResponseModifier(httptest.NewRecorder())
+		rm.Header().Set("Content-Type", "application/json")
+		if contentLength != "" {
+			rm.Header().Set("Content-Length", contentLength)
+		}
+		_, _ = rm.Write([]byte(body))
+		return rm
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rm := newResponse(strconv.Itoa(len(body)))
+	expect.NoError(t, cmd.exec.Handle(rm, req))
+	expect.Equal(t, string(rm.Content()), `{"user":{"name":"a"}}`)
+	expect.Equal(t, rm.Header().Get("Content-Length"), strconv.Itoa(len(`{"user":{"name":"a"}}`)))
+
+	// unknown or oversized lengths are passed through
+	for _, contentLength := range []string{"", "-1", strconv.Itoa(maxTransformBodySize + 1)} {
+		rm := newResponse(contentLength)
+		expect.NoError(t, cmd.exec.Handle(rm, req))
+		expect.Equal(t, string(rm.Content()), body, contentLength)
+	}
+}
+
+func TestBodyTransformValidate(t *testing.T) {
+	for _, input := range []string{
+		"replace header a b",
+		"replace body a",
+		`replace body regex("(") b`,
+		"json_set body $ 1",
+		"json_del resp_body a[x]",
+		"json_merge body {invalid",
+		`json_patch body '{"op":"add"}'`,
+		"form_set a",
+		"form_del",
+	} {
+		var cmd Command
+		expect.HasError(t, cmd.Parse(input), input)
+	}
+}
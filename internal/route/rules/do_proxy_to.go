@@ -0,0 +1,243 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"github.com/gobwas/glob"
+	"github.com/puzpuzpuz/xsync/v4"
+	gphttp "github.com/yusing/godoxy/internal/net/gphttp"
+	gperr "github.com/yusing/goutils/errs"
+	"github.com/yusing/goutils/http/reverseproxy"
+)
+
+// maxProxyToCachedTargets is the maximum number of reverse proxies cached by a proxy_to command,
+// requests to more targets still share the connection pool but build a reverse proxy each time.
+const maxProxyToCachedTargets = 256
+
+// proxyToArgs is a proxy_to command, the target is either an URL template
+// restricted by the allowed hosts and networks, or a key to look up in a table of URLs.
+type proxyToArgs struct {
+	target templateString
+	lookup map[string]*url.URL
+	hosts  []glob.Glob
+	nets   []netip.Prefix
+
+	transport *http.Transport
+	proxies   *xsync.Map[string, *reverseproxy.ReverseProxy]
+}
+
+var errProxyToNotAllowed = errors.New("destination not allowed")
+
+// validateProxyTo returns *proxyToArgs from "target allowed..." or "key_template key=url...".
+//
+// allowed is a host name (glob), an IP or a CIDR.
+func validateProxyTo(args []string) (any, gperr.Error) {
+	if len(args) < 2 {
+		return nil, ErrInvalidArguments.Withf("expect target and allowed destinations, or lookup key and table")
+	}
+	target, err := validateTemplate(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	p := &proxyToArgs{target: target}
+	for _, arg := range args[1:] {
+		if key, value, ok := strings.Cut(arg, "="); ok {
+			if err := p.addLookup(key, value); err != nil {
+				return nil, err.Subject(arg)
+			}
+			continue
+		}
+		if err := p.addAllowed(arg); err != nil {
+			return nil, err.Subject(arg)
+		}
+	}
+	if p.lookup != nil && (len(p.hosts) > 0 || len(p.nets) > 0) {
+		return nil, ErrInvalidArguments.Withf("lookup table and allowed destinations cannot be mixed")
+	}
+	return p, nil
+}
+
+func (p *proxyToArgs) addLookup(key, value string) gperr.Error {
+	if key == "" {
+		return ErrInvalidArguments.Withf("empty lookup key")
+	}
+	if _, ok := p.lookup[key]; ok {
+		return ErrInvalidArguments.Withf("duplicate lookup key %q", key)
+	}
+	u, err := parseProxyToURL(value)
+	if err != nil {
+		return ErrInvalidArguments.With(err)
+	}
+	if p.lookup == nil {
+		p.lookup = make(map[string]*url.URL)
+	}
+	p.lookup[key] = u
+	return nil
+}
+
+func (p *proxyToArgs) addAllowed(s string) gperr.Error {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return ErrInvalidArguments.With(err)
+		}
+		p.nets = append(p.nets, prefix.Masked())
+		return nil
+	}
+	if addr, err := netip.ParseAddr(s); err == nil {
+		addr = addr.Unmap()
+		p.nets = append(p.nets, netip.PrefixFrom(addr, addr.BitLen()))
+		return nil
+	}
+	// '*' does not match across dots, so *.internal does not allow a.b.internal
+	g, err := glob.Compile(strings.ToLower(s), '.')
+	if err != nil {
+		return ErrInvalidArguments.With(err)
+	}
+	p.hosts = append(p.hosts, g)
+	return nil
+}
+
+// parseProxyToURL parses an absolute http(s) URL.
+func parseProxyToURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Host == "" || u.User != nil {
+		return nil, fmt.Errorf("invalid URL %q", s)
+	}
+	return u, nil
+}
+
+func buildProxyTo(args any) CommandHandler {
+	p := args.(*proxyToArgs)
+	p.transport = gphttp.NewTransport()
+	// proxies from the environment would bypass the destination check on dial
+	p.transport.Proxy = nil
+	if p.lookup == nil {
+		p.transport.DialContext = p.dialContext
+	}
+	p.proxies = xsync.NewMap[string, *reverseproxy.ReverseProxy]()
+	return TerminatingCommand(func(w http.ResponseWriter, r *http.Request) error {
+		target, err := p.target.ExpandVarsToString(w, r)
+		if err != nil {
+			return err
+		}
+		u, status := p.resolve(target)
+		if u == nil {
+			http.Error(w, http.StatusText(status), status)
+			return nil
+		}
+		p.reverseProxy(u).ServeHTTP(w, r)
+		return nil
+	})
+}
+
+// resolve returns the upstream URL of an expanded target, or nil and the status code to respond with.
+func (p *proxyToArgs) resolve(target string) (*url.URL, int) {
+	if p.lookup != nil {
+		u, ok := p.lookup[target]
+		if !ok {
+			return nil, http.StatusNotFound
+		}
+		return u, 0
+	}
+	u, err := parseProxyToURL(target)
+	if err != nil {
+		return nil, http.StatusBadGateway
+	}
+	if !p.mayAllow(u.Hostname()) {
+		return nil, http.StatusForbidden
+	}
+	return u, 0
+}
+
+func (p *proxyToArgs) reverseProxy(u *url.URL) *reverseproxy.ReverseProxy {
+	key := u.String()
+	if rp, ok := p.proxies.Load(key); ok {
+		return rp
+	}
+	rp := reverseproxy.NewReverseProxy(u.Host, u, p.transport)
+	if p.proxies.Size() >= maxProxyToCachedTargets {
+		return rp
+	}
+	rp, _ = p.proxies.LoadOrStore(key, rp)
+	return rp
+}
+
+func (p *proxyToArgs) hostAllowed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, g := range p.hosts {
+		if g.Match(host) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *proxyToArgs) ipAllowed(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, prefix := range p.nets {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// mayAllow reports whether the host may be allowed before dialing,
+// host names outside the allowed hosts are checked by their resolved IPs on dial.
+func (p *proxyToArgs) mayAllow(host string) bool {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return p.ipAllowed(ip)
+	}
+	return p.hostAllowed(host) || len(p.nets) > 0
+}
+
+// dialContext dials allowed hosts directly, other hosts only if all their IPs are allowed.
+// It dials the checked IPs, so a DNS response changed after the check cannot redirect the request.
+func (p *proxyToArgs) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if p.hostAllowed(host) {
+		return gphttp.DefaultDialer.DialContext(ctx, network, addr)
+	}
+	var ips []netip.Addr
+	if ip, err := netip.ParseAddr(host); err == nil {
+		ips = []netip.Addr{ip}
+	} else {
+		ips, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no IP found for %s", host)
+	}
+	for _, ip := range ips {
+		if !p.ipAllowed(ip) {
+			return nil, fmt.Errorf("%w: %s (%s)", errProxyToNotAllowed, host, ip)
+		}
+	}
+	for _, ip := range ips {
+		var conn net.Conn
+		conn, err = gphttp.DefaultDialer.DialContext(ctx, network, net.JoinHostPort(ip.Unmap().String(), port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,92 @@
+package rules
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	expect "github.com/yusing/goutils/testing"
+)
+
+func TestGetPathSegment(t *testing.T) {
+	tests := []struct {
+		path  string
+		index int
+		want  string
+	}{
+		{"/users/1", 0, "users"},
+		{"/users/1", 1, "1"},
+		{"/users/1", 2, ""},
+		{"/", 0, ""},
+		{"/a//b", 2, "b"},
+	}
+	for _, tt := range tests {
+		expect.Equal(t, getPathSegment(tt.path, tt.index), tt.want, tt.path)
+	}
+}
+
+func TestProxyTo(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "upstream "+r.URL.Path)
+	}))
+	defer upstream.Close()
+
+	tests := []struct {
+		name    string
+		cmd     string
+		backend string
+		path    string
+		status  int
+	}{
+		{"allowed_ip", "proxy_to http://$header(X-Backend) 127.0.0.1", upstream.Listener.Addr().String(), "/a", http.StatusOK},
+		{"allowed_cidr", "proxy_to http://$header(X-Backend) 127.0.0.0/8", upstream.Listener.Addr().String(), "/a", http.StatusOK},
+		{"not_allowed_ip", "proxy_to http://$header(X-Backend) 10.0.0.0/8", upstream.Listener.Addr().String(), "/a", http.StatusForbidden},
+		{"not_allowed_host", "proxy_to http://$header(X-Backend) *.internal", "metadata.google:80", "/a", http.StatusForbidden},
+		{"resolved_not_allowed", "proxy_to http://$header(X-Backend) 10.0.0.0/8", "localhost:1", "/a", http.StatusBadGateway},
+		{"invalid_url", "proxy_to $header(X-Backend) 127.0.0.1", "file:///etc/passwd", "/a", http.StatusBadGateway},
+		{"lookup", "proxy_to $path_segment(0) users=" + upstream.URL, "", "/users/1", http.StatusOK},
+		{"lookup_unknown", "proxy_to $path_segment(0) users=" + upstream.URL, "", "/orders/1", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cmd Command
+			expect.NoError(t, cmd.Parse(tt.cmd))
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("X-Backend", tt.backend)
+			w := httptest.NewRecorder()
+			expect.ErrorIs(t, errTerminated, cmd.exec.Handle(w, req))
+			expect.Equal(t, w.Code, tt.status)
+			if tt.status == http.StatusOK {
+				expect.Equal(t, w.Body.String(), "upstream "+tt.path)
+			}
+		})
+	}
+}
+
+func TestProxyToValidate(t *testing.T) {
+	for _, tt := range []struct {
+		input string
+		valid bool
+	}{
+		{"proxy_to http://$header(X-Backend):8080 *.internal 10.0.0.0/8 fd00::1", true},
+		{"proxy_to $path_segment(0) a=http://a:8080 b=https://b", true},
+		{"proxy_to http://$header(X-Backend)", false},
+		{"proxy_to http://$header(X-Backend) 10.0.0.0/33", false},
+		{"proxy_to http://$header(X-Backend) [a", false},
+		{"proxy_to $path_segment(0) a=ftp://a", false},
+		{"proxy_to $path_segment(0) a=http://a a=http://b", false},
+		{"proxy_to $path_segment(0) a=http://a 10.0.0.0/8", false},
+	} {
+		t.Run(tt.input, func(t *testing.T) {
+			var cmd Command
+			err := cmd.Parse(tt.input)
+			if tt.valid {
+				expect.NoError(t, err)
+			} else {
+				expect.HasError(t, err)
+			}
+		})
+	}
+}
@@ -16,6 +16,9 @@ var (
 	ErrInvalidOnTarget         = gperr.New("invalid `rule.on` target")
 	ErrInvalidCommandSequence  = gperr.New("invalid command sequence")
 	ErrMultipleDefaultRules    = gperr.New("multiple default rules")
+	ErrInvalidExpr             = gperr.New("invalid expression")
+	ErrPresetNotFound          = gperr.New("rule preset not found")
+	ErrIPListNotAllowed        = gperr.New("ip list url not allowed")
 
 	// vars errors
 	ErrNoArgProvided   = gperr.New("no argument provided")
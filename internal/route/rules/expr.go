@@ -0,0 +1,727 @@
+package rules
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	gperr "github.com/yusing/goutils/errs"
+	httputils "github.com/yusing/goutils/http"
+)
+
+// Expressions are an alternative syntax of rule.on, they are type checked
+// and compiled to closures when the rule is parsed, e.g.
+//
+//	on: expr req_method == "POST" && (req_path.starts_with("/api/") || in_cidr(remote_host, "10.0.0.0/8"))
+//
+// Identifiers are the rule variables without "$", function calls x.f(a) are the same as f(x, a).
+
+const OnExpr = "expr"
+
+type exprType uint8
+
+const (
+	exprBool exprType = iota + 1
+	exprInt
+	exprFloat
+	exprString
+	exprList // list of strings
+)
+
+var exprTypeNames = [...]string{
+	exprBool:   "bool",
+	exprInt:    "int",
+	exprFloat:  "float",
+	exprString: "string",
+	exprList:   "list",
+}
+
+func (t exprType) String() string {
+	return exprTypeNames[t]
+}
+
+type exprFunc[T any] func(w http.ResponseWriter, r *http.Request) T
+
+// exprNode is a compiled expression, the eval function of its type is set.
+type exprNode struct {
+	typ        exprType
+	isResponse bool     // depends on the response
+	lit        *string  // value of a string literal
+	litList    []string // value of a list literal of string literals
+	isLitList  bool
+
+	evalBool   exprFunc[bool]
+	evalInt    exprFunc[int64]
+	evalFloat  exprFunc[float64]
+	evalString exprFunc[string]
+	evalList   exprFunc[[]string]
+}
+
+// cutExprPrefix returns the expression of a rule.on starting with "expr".
+func cutExprPrefix(v string) (string, bool) {
+	v = strings.TrimLeftFunc(v, unicode.IsSpace)
+	rest, ok := strings.CutPrefix(v, OnExpr)
+	if !ok || rest == "" {
+		return "", false
+	}
+	if r, _ := utf8.DecodeRuneInString(rest); !unicode.IsSpace(r) {
+		return "", false
+	}
+	return strings.TrimSpace(rest), true
+}
+
+// parseExpr compiles a boolean expression to a checker.
+func parseExpr(src string) (CheckFunc, bool, gperr.Error) {
+	toks, err := lexExpr(src)
+	if err != nil {
+		return nil, false, err
+	}
+	p := exprParser{toks: toks}
+	n, err := p.ternary()
+	if err != nil {
+		return nil, false, err
+	}
+	if tok := p.peek(); tok.kind != exprTokEOF {
+		return nil, false, exprError(tok, "unexpected %q", tok.text)
+	}
+	if n.typ != exprBool {
+		return nil, false, ErrInvalidExpr.Withf("expression must be bool, got %s", n.typ)
+	}
+	return CheckFunc(n.evalBool), n.isResponse, nil
+}
+
+type exprTokenKind uint8
+
+const (
+	exprTokEOF exprTokenKind = iota
+	exprTokIdent
+	exprTokInt
+	exprTokFloat
+	exprTokString
+	exprTokOp
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	text string // unquoted for strings
+	pos  int
+}
+
+func exprError(tok exprToken, format string, args ...any) gperr.Error {
+	return ErrInvalidExpr.Withf("%s at position %d", fmt.Sprintf(format, args...), tok.pos+1)
+}
+
+var exprOps2 = []string{"==", "!=", "<=", ">=", "&&", "||"}
+
+const exprOps1 = "()[],.!-+*/%<>?:"
+
+func lexExpr(src string) ([]exprToken, gperr.Error) {
+	var toks []exprToken
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case asciiSpace[c] != 0:
+			i++
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i + 1
+			for j < len(src) && (src[j] == '_' || validVarNameCharset[src[j]] || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			toks = append(toks, exprToken{exprTokIdent, src[i:j], i})
+			i = j
+		case c >= '0' && c <= '9':
+			j := i + 1
+			for j < len(src) && src[j] >= '0' && src[j] <= '9' {
+				j++
+			}
+			kind := exprTokInt
+			if j+1 < len(src) && src[j] == '.' && src[j+1] >= '0' && src[j+1] <= '9' {
+				kind = exprTokFloat
+				j += 2
+				for j < len(src) && src[j] >= '0' && src[j] <= '9' {
+					j++
+				}
+			}
+			toks = append(toks, exprToken{kind, src[i:j], i})
+			i = j
+		case quoteChars[c]:
+			s, n, errMsg := lexExprString(src[i:])
+			if errMsg != "" {
+				return nil, exprError(exprToken{pos: i}, "%s", errMsg)
+			}
+			toks = append(toks, exprToken{exprTokString, s, i})
+			i += n
+		default:
+			if i+1 < len(src) && slices.Contains(exprOps2, src[i:i+2]) {
+				toks = append(toks, exprToken{exprTokOp, src[i : i+2], i})
+				i += 2
+				continue
+			}
+			if strings.IndexByte(exprOps1, c) == -1 {
+				return nil, exprError(exprToken{pos: i}, "unexpected %q", c)
+			}
+			toks = append(toks, exprToken{exprTokOp, src[i : i+1], i})
+			i++
+		}
+	}
+	return append(toks, exprToken{exprTokEOF, "end of expression", len(src)}), nil
+}
+
+// QuoteExprString returns s as a double quoted string literal of an expression.
+func QuoteExprString(s string) string {
+	var sb strings.Builder
+	sb.Grow(len(s) + 2)
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '\\', '"':
+			sb.WriteByte('\\')
+		case '\n':
+			sb.WriteString(`\n`)
+			continue
+		case '\r':
+			sb.WriteString(`\r`)
+			continue
+		case '\t':
+			sb.WriteString(`\t`)
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// lexExprString returns the value and the length of a quoted string,
+// backquoted strings are raw strings.
+func lexExprString(src string) (string, int, string) {
+	quote := src[0]
+	var sb strings.Builder
+	for i := 1; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == quote:
+			return sb.String(), i + 1, ""
+		case c == '\\' && quote != '`':
+			i++
+			if i == len(src) {
+				return "", 0, "unterminated quotes"
+			}
+			ch, ok := escapedChars[rune(src[i])]
+			if !ok {
+				return "", 0, fmt.Sprintf("invalid escape \\%c, use a backquoted string for regex", src[i])
+			}
+			sb.WriteRune(ch)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", 0, "unterminated quotes"
+}
+
+type exprParser struct {
+	toks []exprToken
+	pos  int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.toks[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.toks[p.pos]
+	if tok.kind != exprTokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *exprParser) peekOp(ops ...string) bool {
+	tok := p.peek()
+	return tok.kind == exprTokOp && slices.Contains(ops, tok.text) ||
+		tok.kind == exprTokIdent && tok.text == "in" && slices.Contains(ops, "in")
+}
+
+func (p *exprParser) expect(op string) gperr.Error {
+	if !p.peekOp(op) {
+		tok := p.peek()
+		return exprError(tok, "expect %q, got %q", op, tok.text)
+	}
+	p.next()
+	return nil
+}
+
+// ternary parses "cond ? a : b".
+func (p *exprParser) ternary() (*exprNode, gperr.Error) {
+	cond, err := p.or()
+	if err != nil || !p.peekOp("?") {
+		return cond, err
+	}
+	tok := p.next()
+	if cond.typ != exprBool {
+		return nil, exprError(tok, "condition must be bool, got %s", cond.typ)
+	}
+	a, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	b, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	a, b = unifyNumbers(a, b)
+	if a.typ != b.typ {
+		return nil, exprError(tok, "branches must have the same type, got %s and %s", a.typ, b.typ)
+	}
+	c := cond.evalBool
+	n := &exprNode{typ: a.typ, isResponse: cond.isResponse || a.isResponse || b.isResponse}
+	switch a.typ {
+	case exprBool:
+		n.evalBool = choose(c, a.evalBool, b.evalBool)
+	case exprInt:
+		n.evalInt = choose(c, a.evalInt, b.evalInt)
+	case exprFloat:
+		n.evalFloat = choose(c, a.evalFloat, b.evalFloat)
+	case exprString:
+		n.evalString = choose(c, a.evalString, b.evalString)
+	case exprList:
+		n.evalList = choose(c, a.evalList, b.evalList)
+	}
+	return n, nil
+}
+
+func choose[T any](c exprFunc[bool], a, b exprFunc[T]) exprFunc[T] {
+	return func(w http.ResponseWriter, r *http.Request) T {
+		if c(w, r) {
+			return a(w, r)
+		}
+		return b(w, r)
+	}
+}
+
+func (p *exprParser) or() (*exprNode, gperr.Error) {
+	left, err := p.and()
+	for err == nil && p.peekOp("||") {
+		tok := p.next()
+		var right *exprNode
+		if right, err = p.and(); err != nil {
+			break
+		}
+		if err = expectTypes(tok, exprBool, left, right); err != nil {
+			break
+		}
+		a, b := left.evalBool, right.evalBool
+		left = &exprNode{typ: exprBool, isResponse: left.isResponse || right.isResponse, evalBool: func(w http.ResponseWriter, r *http.Request) bool {
+			return a(w, r) || b(w, r)
+		}}
+	}
+	return left, err
+}
+
+func (p *exprParser) and() (*exprNode, gperr.Error) {
+	left, err := p.rel()
+	for err == nil && p.peekOp("&&") {
+		tok := p.next()
+		var right *exprNode
+		if right, err = p.rel(); err != nil {
+			break
+		}
+		if err = expectTypes(tok, exprBool, left, right); err != nil {
+			break
+		}
+		a, b := left.evalBool, right.evalBool
+		left = &exprNode{typ: exprBool, isResponse: left.isResponse || right.isResponse, evalBool: func(w http.ResponseWriter, r *http.Request) bool {
+			return a(w, r) && b(w, r)
+		}}
+	}
+	return left, err
+}
+
+func expectTypes(tok exprToken, typ exprType, nodes ...*exprNode) gperr.Error {
+	for _, n := range nodes {
+		if n.typ != typ {
+			return exprError(tok, "%s expects %s, got %s", tok.text, typ, n.typ)
+		}
+	}
+	return nil
+}
+
+// rel parses a comparison or "in", they are not associative.
+func (p *exprParser) rel() (*exprNode, gperr.Error) {
+	left, err := p.add()
+	if err != nil || !p.peekOp("==", "!=", "<", "<=", ">", ">=", "in") {
+		return left, err
+	}
+	tok := p.next()
+	right, err := p.add()
+	if err != nil {
+		return nil, err
+	}
+	n := &exprNode{typ: exprBool, isResponse: left.isResponse || right.isResponse}
+	if tok.text == "in" {
+		if left.typ != exprString || right.typ != exprList {
+			return nil, exprError(tok, "in expects string in list, got %s in %s", left.typ, right.typ)
+		}
+		s := left.evalString
+		if right.isLitList {
+			set := make(map[string]struct{}, len(right.litList))
+			for _, v := range right.litList {
+				set[v] = struct{}{}
+			}
+			n.evalBool = func(w http.ResponseWriter, r *http.Request) bool {
+				_, ok := set[s(w, r)]
+				return ok
+			}
+		} else {
+			l := right.evalList
+			n.evalBool = func(w http.ResponseWriter, r *http.Request) bool {
+				return slices.Contains(l(w, r), s(w, r))
+			}
+		}
+		return n, nil
+	}
+
+	left, right = unifyNumbers(left, right)
+	if left.typ != right.typ {
+		return nil, exprError(tok, "cannot compare %s with %s", left.typ, right.typ)
+	}
+	switch left.typ {
+	case exprInt:
+		n.evalBool = compareFunc(tok.text, left.evalInt, right.evalInt)
+	case exprFloat:
+		n.evalBool = compareFunc(tok.text, left.evalFloat, right.evalFloat)
+	case exprString:
+		n.evalBool = compareFunc(tok.text, left.evalString, right.evalString)
+	case exprBool:
+		a, b := left.evalBool, right.evalBool
+		switch tok.text {
+		case "==":
+			n.evalBool = func(w http.ResponseWriter, r *http.Request) bool { return a(w, r) == b(w, r) }
+		case "!=":
+			n.evalBool = func(w http.ResponseWriter, r *http.Request) bool { return a(w, r) != b(w, r) }
+		}
+	}
+	if n.evalBool == nil {
+		return nil, exprError(tok, "%s is not supported for %s", tok.text, left.typ)
+	}
+	return n, nil
+}
+
+func compareFunc[T cmp.Ordered](op string, a, b exprFunc[T]) exprFunc[bool] {
+	switch op {
+	case "==":
+		return func(w http.ResponseWriter, r *http.Request) bool { return a(w, r) == b(w, r) }
+	case "!=":
+		return func(w http.ResponseWriter, r *http.Request) bool { return a(w, r) != b(w, r) }
+	case "<":
+		return func(w http.ResponseWriter, r *http.Request) bool { return a(w, r) < b(w, r) }
+	case "<=":
+		return func(w http.ResponseWriter, r *http.Request) bool { return a(w, r) <= b(w, r) }
+	case ">":
+		return func(w http.ResponseWriter, r *http.Request) bool { return a(w, r) > b(w, r) }
+	default: // >=
+		return func(w http.ResponseWriter, r *http.Request) bool { return a(w, r) >= b(w, r) }
+	}
+}
+
+// unifyNumbers converts an int to float when the other one is a float.
+func unifyNumbers(a, b *exprNode) (*exprNode, *exprNode) {
+	switch {
+	case a.typ == exprInt && b.typ == exprFloat:
+		return intToFloat(a), b
+	case a.typ == exprFloat && b.typ == exprInt:
+		return a, intToFloat(b)
+	}
+	return a, b
+}
+
+func intToFloat(n *exprNode) *exprNode {
+	i := n.evalInt
+	return &exprNode{typ: exprFloat, isResponse: n.isResponse, evalFloat: func(w http.ResponseWriter, r *http.Request) float64 {
+		return float64(i(w, r))
+	}}
+}
+
+func (p *exprParser) add() (*exprNode, gperr.Error) {
+	left, err := p.mul()
+	for err == nil && p.peekOp("+", "-") {
+		tok := p.next()
+		var right *exprNode
+		if right, err = p.mul(); err != nil {
+			break
+		}
+		left, err = arith(tok, left, right)
+	}
+	return left, err
+}
+
+func (p *exprParser) mul() (*exprNode, gperr.Error) {
+	left, err := p.unary()
+	for err == nil && p.peekOp("*", "/", "%") {
+		tok := p.next()
+		var right *exprNode
+		if right, err = p.unary(); err != nil {
+			break
+		}
+		left, err = arith(tok, left, right)
+	}
+	return left, err
+}
+
+// arith returns the result of a binary arithmetic operator, "+" also concatenates strings.
+func arith(tok exprToken, left, right *exprNode) (*exprNode, gperr.Error) {
+	left, right = unifyNumbers(left, right)
+	n := &exprNode{typ: left.typ, isResponse: left.isResponse || right.isResponse}
+	switch {
+	case left.typ != right.typ:
+	case left.typ == exprInt:
+		n.evalInt = arithFunc(tok.text, left.evalInt, right.evalInt)
+	case left.typ == exprFloat && tok.text != "%":
+		n.evalFloat = arithFunc(tok.text, left.evalFloat, right.evalFloat)
+	case left.typ == exprString && tok.text == "+":
+		a, b := left.evalString, right.evalString
+		n.evalString = func(w http.ResponseWriter, r *http.Request) string { return a(w, r) + b(w, r) }
+	}
+	if n.evalInt == nil && n.evalFloat == nil && n.evalString == nil {
+		return nil, exprError(tok, "%s is not supported for %s and %s", tok.text, left.typ, right.typ)
+	}
+	return n, nil
+}
+
+// arithFunc returns the function of an arithmetic operator, division by zero is zero.
+func arithFunc[T int64 | float64](op string, a, b exprFunc[T]) exprFunc[T] {
+	switch op {
+	case "+":
+		return func(w http.ResponseWriter, r *http.Request) T { return a(w, r) + b(w, r) }
+	case "-":
+		return func(w http.ResponseWriter, r *http.Request) T { return a(w, r) - b(w, r) }
+	case "*":
+		return func(w http.ResponseWriter, r *http.Request) T { return a(w, r) * b(w, r) }
+	case "/":
+		return func(w http.ResponseWriter, r *http.Request) T {
+			if y := b(w, r); y != 0 {
+				return a(w, r) / y
+			}
+			return 0
+		}
+	default: // %, int only
+		return func(w http.ResponseWriter, r *http.Request) T {
+			x, y := int64(a(w, r)), int64(b(w, r))
+			if y != 0 {
+				return T(x % y)
+			}
+			return 0
+		}
+	}
+}
+
+func (p *exprParser) unary() (*exprNode, gperr.Error) {
+	if !p.peekOp("!", "-") {
+		return p.postfix()
+	}
+	tok := p.next()
+	n, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case tok.text == "!" && n.typ == exprBool:
+		f := n.evalBool
+		return &exprNode{typ: exprBool, isResponse: n.isResponse, evalBool: func(w http.ResponseWriter, r *http.Request) bool { return !f(w, r) }}, nil
+	case tok.text == "-" && n.typ == exprInt:
+		f := n.evalInt
+		return &exprNode{typ: exprInt, isResponse: n.isResponse, evalInt: func(w http.ResponseWriter, r *http.Request) int64 { return -f(w, r) }}, nil
+	case tok.text == "-" && n.typ == exprFloat:
+		f := n.evalFloat
+		return &exprNode{typ: exprFloat, isResponse: n.isResponse, evalFloat: func(w http.ResponseWriter, r *http.Request) float64 { return -f(w, r) }}, nil
+	}
+	return nil, exprError(tok, "%s is not supported for %s", tok.text, n.typ)
+}
+
+// postfix parses method calls, x.f(a) is f(x, a).
+func (p *exprParser) postfix() (*exprNode, gperr.Error) {
+	n, err := p.primary()
+	for err == nil && p.peekOp(".") {
+		p.next()
+		tok := p.next()
+		if tok.kind != exprTokIdent {
+			return nil, exprError(tok, "expect function name, got %q", tok.text)
+		}
+		var args []*exprNode
+		if args, err = p.args(); err != nil {
+			break
+		}
+		n, err = exprCall(tok, append([]*exprNode{n}, args...))
+	}
+	return n, err
+}
+
+// args parses "(a, b, ...)".
+func (p *exprParser) args() ([]*exprNode, gperr.Error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var args []*exprNode
+	for !p.peekOp(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.ternary()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next()
+	return args, nil
+}
+
+func (p *exprParser) primary() (*exprNode, gperr.Error) {
+	tok := p.next()
+	switch tok.kind {
+	case exprTokInt:
+		v, err := strconv.ParseInt(tok.text, 10, 64)
+		if err != nil {
+			return nil, exprError(tok, "invalid int %s", tok.text)
+		}
+		return exprConst(v), nil
+	case exprTokFloat:
+		v, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, exprError(tok, "invalid float %s", tok.text)
+		}
+		return exprConst(v), nil
+	case exprTokString:
+		return exprConst(tok.text), nil
+	case exprTokIdent:
+		switch tok.text {
+		case "true", "false":
+			return exprConst(tok.text == "true"), nil
+		}
+		if p.peekOp("(") {
+			args, err := p.args()
+			if err != nil {
+				return nil, err
+			}
+			return exprCall(tok, args)
+		}
+		return exprVariable(tok)
+	case exprTokOp:
+		switch tok.text {
+		case "(":
+			n, err := p.ternary()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "[":
+			return p.list()
+		}
+	}
+	return nil, exprError(tok, "unexpected %q", tok.text)
+}
+
+// list parses a list of strings.
+func (p *exprParser) list() (*exprNode, gperr.Error) {
+	var elems []*exprNode
+	for !p.peekOp("]") {
+		if len(elems) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		tok := p.peek()
+		elem, err := p.ternary()
+		if err != nil {
+			return nil, err
+		}
+		if elem.typ != exprString {
+			return nil, exprError(tok, "list elements must be string, got %s", elem.typ)
+		}
+		elems = append(elems, elem)
+	}
+	p.next()
+
+	n := &exprNode{typ: exprList, isLitList: true}
+	for _, e := range elems {
+		if e.lit == nil {
+			n.isLitList = false
+		} else {
+			n.litList = append(n.litList, *e.lit)
+		}
+		n.isResponse = n.isResponse || e.isResponse
+	}
+	if n.isLitList {
+		l := n.litList
+		n.evalList = func(http.ResponseWriter, *http.Request) []string { return l }
+		return n, nil
+	}
+	n.litList = nil
+	n.evalList = func(w http.ResponseWriter, r *http.Request) []string {
+		l := make([]string, len(elems))
+		for i, e := range elems {
+			l[i] = e.evalString(w, r)
+		}
+		return l
+	}
+	return n, nil
+}
+
+func exprConst[T bool | int64 | float64 | string](v T) *exprNode {
+	switch v := any(v).(type) {
+	case bool:
+		return &exprNode{typ: exprBool, evalBool: func(http.ResponseWriter, *http.Request) bool { return v }}
+	case int64:
+		return &exprNode{typ: exprInt, evalInt: func(http.ResponseWriter, *http.Request) int64 { return v }}
+	case float64:
+		return &exprNode{typ: exprFloat, evalFloat: func(http.ResponseWriter, *http.Request) float64 { return v }}
+	default:
+		s := v.(string)
+		return &exprNode{typ: exprString, lit: &s, evalString: func(http.ResponseWriter, *http.Request) string { return s }}
+	}
+}
+
+// variables that are numbers
+var exprIntVars = map[string]bool{
+	VarRequestPort:       true,
+	VarRequestContentLen: true,
+	VarRemotePort:        true,
+	VarUpstreamPort:      true,
+	VarRespContentLen:    true,
+	VarRespStatusCode:    true,
+}
+
+func exprVariable(tok exprToken) (*exprNode, gperr.Error) {
+	var n *exprNode
+	if getter, ok := staticReqVarSubsMap[tok.text]; ok {
+		n = &exprNode{typ: exprString, evalString: func(_ http.ResponseWriter, r *http.Request) string {
+			return getter(r)
+		}}
+	} else if getter, ok := staticRespVarSubsMap[tok.text]; ok {
+		n = &exprNode{typ: exprString, isResponse: true, evalString: func(w http.ResponseWriter, _ *http.Request) string {
+			return getter(httputils.GetInitResponseModifier(w))
+		}}
+	} else {
+		return nil, exprError(tok, "unknown variable %s", tok.text)
+	}
+	if exprIntVars[tok.text] {
+		s := n.evalString
+		n.typ, n.evalString = exprInt, nil
+		n.evalInt = func(w http.ResponseWriter, r *http.Request) int64 {
+			v, _ := strconv.ParseInt(s(w, r), 10, 64)
+			return v
+		}
+	}
+	return n, nil
+}
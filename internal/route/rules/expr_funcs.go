@@ -0,0 +1,375 @@
+package rules
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobwas/glob"
+	gperr "github.com/yusing/goutils/errs"
+	httputils "github.com/yusing/goutils/http"
+)
+
+type exprBuiltin func(tok exprToken, args []*exprNode) (*exprNode, gperr.Error)
+
+var timeNow = time.Now
+
+var exprBuiltins = map[string]exprBuiltin{
+	"starts_with":  exprStringPredicate(strings.HasPrefix),
+	"ends_with":    exprStringPredicate(strings.HasSuffix),
+	"contains":     exprStringPredicate(strings.Contains),
+	"lower":        exprStringMap(strings.ToLower),
+	"upper":        exprStringMap(strings.ToUpper),
+	"trim":         exprStringMap(strings.TrimSpace),
+	"size":         exprSize,
+	"split":        exprSplit,
+	"matches":      exprMatches,
+	"glob":         exprGlob,
+	"in_cidr":      exprInCIDR,
+	"int":          exprToInt,
+	"float":        exprToFloat,
+	"string":       exprToString,
+	"hour":         exprClock(func(t time.Time) int { return t.Hour() }),
+	"minute":       exprClock(func(t time.Time) int { return t.Minute() }),
+	"weekday":      exprClock(func(t time.Time) int { return int(t.Weekday()) }),
+	"time_between": exprTimeBetween,
+	"kv":           exprKV,
+}
+
+func exprCall(tok exprToken, args []*exprNode) (*exprNode, gperr.Error) {
+	if _, ok := dynamicVarSubsMap[tok.text]; ok {
+		return exprDynamicVar(tok, args)
+	}
+	builtin, ok := exprBuiltins[tok.text]
+	if !ok {
+		return nil, exprError(tok, "unknown function %s", tok.text)
+	}
+	n, err := builtin(tok, args)
+	if err != nil {
+		return nil, err
+	}
+	for _, arg := range args {
+		n.isResponse = n.isResponse || arg.isResponse
+	}
+	return n, nil
+}
+
+// exprArgs checks the number and the types of the arguments of a function.
+func exprArgs(tok exprToken, args []*exprNode, types ...exprType) gperr.Error {
+	if len(args) != len(types) {
+		return exprError(tok, "%s expects %d args, got %d", tok.text, len(types), len(args))
+	}
+	for i, arg := range args {
+		if arg.typ != types[i] {
+			return exprError(tok, "arg %d of %s must be %s, got %s", i+1, tok.text, types[i], arg.typ)
+		}
+	}
+	return nil
+}
+
+// exprLiteral returns the value of an argument that must be known when the rule is parsed.
+func exprLiteral(tok exprToken, args []*exprNode, i int) (string, gperr.Error) {
+	if args[i].lit == nil {
+		return "", exprError(tok, "arg %d of %s must be a string literal", i+1, tok.text)
+	}
+	return *args[i].lit, nil
+}
+
+// exprDynamicVar returns a dynamic variable, e.g. header("X-Key") or header("X-Key", 1).
+func exprDynamicVar(tok exprToken, args []*exprNode) (*exprNode, gperr.Error) {
+	getter := dynamicVarSubsMap[tok.text]
+	var index exprFunc[int64]
+	switch len(args) {
+	case 1:
+		if err := exprArgs(tok, args, exprString); err != nil {
+			return nil, err
+		}
+	case 2:
+		if err := exprArgs(tok, args, exprString, exprInt); err != nil {
+			return nil, err
+		}
+		index = args[1].evalInt
+	default:
+		return nil, exprError(tok, "%s expects 1 or 2 args, got %d", tok.text, len(args))
+	}
+	key := args[0].evalString
+	return &exprNode{
+		typ:        exprString,
+		isResponse: tok.text == VarResponseHeader,
+		evalString: func(w http.ResponseWriter, r *http.Request) string {
+			vArgs := []string{key(w, r)}
+			if index != nil {
+				vArgs = append(vArgs, strconv.FormatInt(index(w, r), 10))
+			}
+			// unknown keys and invalid indexes are empty
+			v, _ := getter(vArgs, httputils.GetInitResponseModifier(w), r)
+			return v
+		},
+	}, nil
+}
+
+func exprStringPredicate(pred func(s, sub string) bool) exprBuiltin {
+	return func(tok exprToken, args []*exprNode) (*exprNode, gperr.Error) {
+		if err := exprArgs(tok, args, exprString, exprString); err != nil {
+			return nil, err
+		}
+		s := args[0].evalString
+		if lit := args[1].lit; lit != nil {
+			sub := *lit
+			return &exprNode{typ: exprBool, evalBool: func(w http.ResponseWriter, r *http.Request) bool {
+				return pred(s(w, r), sub)
+			}}, nil
+		}
+		sub := args[1].evalString
+		return &exprNode{typ: exprBool, evalBool: func(w http.ResponseWriter, r *http.Request) bool {
+			return pred(s(w, r), sub(w, r))
+		}}, nil
+	}
+}
+
+func exprStringMap(f func(string) string) exprBuiltin {
+	return func(tok exprToken, args []*exprNode) (*exprNode, gperr.Error) {
+		if err := exprArgs(tok, args, exprString); err != nil {
+			return nil, err
+		}
+		s := args[0].evalString
+		return &exprNode{typ: exprString, evalString: func(w http.ResponseWriter, r *http.Request) string {
+			return f(s(w, r))
+		}}, nil
+	}
+}
+
+// exprKV returns the value of a key of the key-value store of the route, see kvKey.
+func exprKV(tok exprToken, args []*exprNode) (*exprNode, gperr.Error) {
+	if err := exprArgs(tok, args, exprString); err != nil {
+		return nil, err
+	}
+	key := args[0].evalString
+	return &exprNode{typ: exprString, evalString: func(w http.ResponseWriter, r *http.Request) string {
+		return kvValue(kvKey(r, key(w, r)))
+	}}, nil
+}
+
+func exprSize(tok exprToken, args []*exprNode) (*exprNode, gperr.Error) {
+	if len(args) == 1 && args[0].typ == exprList {
+		l := args[0].evalList
+		return &exprNode{typ: exprInt, evalInt: func(w http.ResponseWriter, r *http.Request) int64 {
+			return int64(len(l(w, r)))
+		}}, nil
+	}
+	if err := exprArgs(tok, args, exprString); err != nil {
+		return nil, err
+	}
+	s := args[0].evalString
+	return &exprNode{typ: exprInt, evalInt: func(w http.ResponseWriter, r *http.Request) int64 {
+		return int64(len(s(w, r)))
+	}}, nil
+}
+
+func exprSplit(tok exprToken, args []*exprNode) (*exprNode, gperr.Error) {
+	if err := exprArgs(tok, args, exprString, exprString); err != nil {
+		return nil, err
+	}
+	s, sep := args[0].evalString, args[1].evalString
+	return &exprNode{typ: exprList, evalList: func(w http.ResponseWriter, r *http.Request) []string {
+		v := s(w, r)
+		if v == "" {
+			return nil
+		}
+		return strings.Split(v, sep(w, r))
+	}}, nil
+}
+
+func exprMatches(tok exprToken, args []*exprNode) (*exprNode, gperr.Error) {
+	if err := exprArgs(tok, args, exprString, exprString); err != nil {
+		return nil, err
+	}
+	pattern, err := exprLiteral(tok, args, 1)
+	if err != nil {
+		return nil, err
+	}
+	re, rerr := regexp.Compile(pattern)
+	if rerr != nil {
+		return nil, exprError(tok, "%s", rerr)
+	}
+	s := args[0].evalString
+	return &exprNode{typ: exprBool, evalBool: func(w http.ResponseWriter, r *http.Request) bool {
+		return re.MatchString(s(w, r))
+	}}, nil
+}
+
+func exprGlob(tok exprToken, args []*exprNode) (*exprNode, gperr.Error) {
+	if err := exprArgs(tok, args, exprString, exprString); err != nil {
+		return nil, err
+	}
+	pattern, err := exprLiteral(tok, args, 1)
+	if err != nil {
+		return nil, err
+	}
+	g, gerr := glob.Compile(pattern)
+	if gerr != nil {
+		return nil, exprError(tok, "%s", gerr)
+	}
+	s := args[0].evalString
+	return &exprNode{typ: exprBool, evalBool: func(w http.ResponseWriter, r *http.Request) bool {
+		return g.Match(s(w, r))
+	}}, nil
+}
+
+// exprInCIDR returns whether an IP is in one of the CIDRs, e.g. in_cidr(remote_host, "10.0.0.0/8", "fd00::/8").
+func exprInCIDR(tok exprToken, args []*exprNode) (*exprNode, gperr.Error) {
+	if len(args) < 2 {
+		return nil, exprError(tok, "%s expects an IP and at least 1 CIDR", tok.text)
+	}
+	nets := make([]*net.IPNet, 0, len(args)-1)
+	for i, arg := range args {
+		if arg.typ != exprString {
+			return nil, exprError(tok, "arg %d of %s must be string, got %s", i+1, tok.text, arg.typ)
+		}
+		if i == 0 {
+			continue
+		}
+		cidr, err := exprLiteral(tok, args, i)
+		if err != nil {
+			return nil, err
+		}
+		ipnet, err := validateCIDR([]string{cidr})
+		if err != nil {
+			return nil, exprError(tok, "%s", err)
+		}
+		nets = append(nets, ipnet.(*net.IPNet))
+	}
+	s := args[0].evalString
+	return &exprNode{typ: exprBool, evalBool: func(w http.ResponseWriter, r *http.Request) bool {
+		ip := net.ParseIP(s(w, r))
+		if ip == nil {
+			return false
+		}
+		for _, ipnet := range nets {
+			if ipnet.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}}, nil
+}
+
+// exprToInt converts to int, invalid strings are 0.
+func exprToInt(tok exprToken, args []*exprNode) (*exprNode, gperr.Error) {
+	if len(args) != 1 {
+		return nil, exprError(tok, "%s expects 1 arg, got %d", tok.text, len(args))
+	}
+	n := &exprNode{typ: exprInt}
+	switch arg := args[0]; arg.typ {
+	case exprInt:
+		return arg, nil
+	case exprFloat:
+		f := arg.evalFloat
+		n.evalInt = func(w http.ResponseWriter, r *http.Request) int64 { return int64(f(w, r)) }
+	case exprString:
+		s := arg.evalString
+		n.evalInt = func(w http.ResponseWriter, r *http.Request) int64 {
+			v := strings.TrimSpace(s(w, r))
+			if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return i
+			}
+			f, _ := strconv.ParseFloat(v, 64)
+			if math.IsNaN(f) || math.IsInf(f, 0) {
+				return 0
+			}
+			return int64(f)
+		}
+	default:
+		return nil, exprError(tok, "cannot convert %s to int", arg.typ)
+	}
+	return n, nil
+}
+
+// exprToFloat converts to float, invalid strings are 0.
+func exprToFloat(tok exprToken, args []*exprNode) (*exprNode, gperr.Error) {
+	if len(args) != 1 {
+		return nil, exprError(tok, "%s expects 1 arg, got %d", tok.text, len(args))
+	}
+	switch arg := args[0]; arg.typ {
+	case exprFloat:
+		return arg, nil
+	case exprInt:
+		return intToFloat(arg), nil
+	case exprString:
+		s := arg.evalString
+		return &exprNode{typ: exprFloat, evalFloat: func(w http.ResponseWriter, r *http.Request) float64 {
+			f, _ := strconv.ParseFloat(strings.TrimSpace(s(w, r)), 64)
+			return f
+		}}, nil
+	default:
+		return nil, exprError(tok, "cannot convert %s to float", arg.typ)
+	}
+}
+
+func exprToString(tok exprToken, args []*exprNode) (*exprNode, gperr.Error) {
+	if len(args) != 1 {
+		return nil, exprError(tok, "%s expects 1 arg, got %d", tok.text, len(args))
+	}
+	n := &exprNode{typ: exprString}
+	switch arg := args[0]; arg.typ {
+	case exprString:
+		return arg, nil
+	case exprBool:
+		b := arg.evalBool
+		n.evalString = func(w http.ResponseWriter, r *http.Request) string { return strconv.FormatBool(b(w, r)) }
+	case exprInt:
+		i := arg.evalInt
+		n.evalString = func(w http.ResponseWriter, r *http.Request) string { return strconv.FormatInt(i(w, r), 10) }
+	case exprFloat:
+		f := arg.evalFloat
+		n.evalString = func(w http.ResponseWriter, r *http.Request) string { return strconv.FormatFloat(f(w, r), 'g', -1, 64) }
+	default:
+		return nil, exprError(tok, "cannot convert %s to string", arg.typ)
+	}
+	return n, nil
+}
+
+// exprClock returns a part of the local time, the time zone is set by TZ.
+func exprClock(part func(time.Time) int) exprBuiltin {
+	return func(tok exprToken, args []*exprNode) (*exprNode, gperr.Error) {
+		if err := exprArgs(tok, args); err != nil {
+			return nil, err
+		}
+		return &exprNode{typ: exprInt, evalInt: func(http.ResponseWriter, *http.Request) int64 {
+			return int64(part(timeNow()))
+		}}, nil
+	}
+}
+
+// exprTimeBetween returns whether the local time of day is in [start, end), e.g. time_between("22:00", "06:00").
+func exprTimeBetween(tok exprToken, args []*exprNode) (*exprNode, gperr.Error) {
+	if err := exprArgs(tok, args, exprString, exprString); err != nil {
+		return nil, err
+	}
+	var minutes [2]int
+	for i := range minutes {
+		s, err := exprLiteral(tok, args, i)
+		if err != nil {
+			return nil, err
+		}
+		t, perr := time.Parse("15:04", s)
+		if perr != nil {
+			return nil, exprError(tok, "invalid time %q, expect HH:MM", s)
+		}
+		minutes[i] = t.Hour()*60 + t.Minute()
+	}
+	start, end := minutes[0], minutes[1]
+	return &exprNode{typ: exprBool, evalBool: func(http.ResponseWriter, *http.Request) bool {
+		now := timeNow()
+		m := now.Hour()*60 + now.Minute()
+		if start <= end {
+			return m >= start && m < end
+		}
+		// wraps around midnight
+		return m >= start || m < end
+	}}, nil
+}
@@ -0,0 +1,138 @@
+package rules
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	httputils "github.com/yusing/goutils/http"
+	expect "github.com/yusing/goutils/testing"
+)
+
+func TestExprCorrectness(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "http://example.com:8443/api/v1/users?page=2&tag=a&tag=b", nil)
+	req.RemoteAddr = "10.1.2.3:50000"
+	req.Header.Set("X-Role", "Admin")
+	req.Header.Set("X-Ratio", "0.75")
+	req.ContentLength = 2048
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`req_method == "POST"`, true},
+		{`req_method in ["GET", "HEAD"]`, false},
+		{`req_method in ["GET", lower("post").upper()]`, true},
+		{`req_path.starts_with("/api/") && !req_path.ends_with("/")`, true},
+		{`req_path.matches(` + "`^/api/v\\d+/`" + `)`, true},
+		{`glob(req_path, "/api/*/users")`, true},
+		{`req_host == "example.com" && req_port == 8443`, true},
+		{`req_content_length > 1024 && req_content_length / 1024 == 2`, true},
+		{`req_content_length % 1000 == 48 || false`, true},
+		{`float(header("X-Ratio")) >= 0.5`, true},
+		{`int(header("X-Ratio")) == 0`, true},
+		{`header("X-Role").lower() == "admin"`, true},
+		{`header("X-Missing") == "" && header("X-Role", 1) == ""`, true},
+		{`arg("page") == "2" && arg("tag", 1) == "b"`, true},
+		{`size(split(req_query, "&")) == 3`, true},
+		{`"tag=b" in split(req_query, "&")`, true},
+		{`in_cidr(remote_host, "192.168.0.0/16", "10.0.0.0/8")`, true},
+		{`in_cidr(remote_host, "192.168.0.0/16")`, false},
+		{`(req_method == "GET" || req_method == "POST") && (req_port > 9000 ? false : true)`, true},
+		{`!(1 + 2 * 3 == 7)`, false},
+		{`-1.5 < 0 && 3 > 2.5`, true},
+		{`"a" + "b" < "b" && contains(req_url, "page=2")`, true},
+		{`string(req_port) + "/" + string(true) == "8443/true"`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			var on RuleOn
+			expect.NoError(t, on.Parse("expr "+tt.expr))
+			expect.False(t, on.IsResponseChecker())
+			expect.Equal(t, on.Check(httptest.NewRecorder(), req), tt.want)
+		})
+	}
+}
+
+func TestExprResponse(t *testing.T) {
+	var on RuleOn
+	expect.NoError(t, on.Parse(`
+		expr
+		status_code >= 500 && status_code != 503
+		|| resp_header("X-Cache") == "miss"`))
+	expect.True(t, on.IsResponseChecker())
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, tt := range []struct {
+		status int
+		cache  string
+		want   bool
+	}{
+		{500, "", true},
+		{503, "", false},
+		{200, "miss", true},
+		{200, "hit", false},
+	} {
+		rm := httputils.NewResponseModifier(httptest.NewRecorder())
+		rm.Header().Set("X-Cache", tt.cache)
+		rm.WriteHeader(tt.status)
+		expect.Equal(t, on.Check(rm, req), tt.want)
+	}
+}
+
+func TestExprTimeOfDay(t *testing.T) {
+	defer func(now func() time.Time) { timeNow = now }(timeNow)
+
+	var office, night, weekend RuleOn
+	expect.NoError(t, office.Parse(`expr time_between("09:00", "17:30") && weekday() >= 1 && weekday() <= 5`))
+	expect.NoError(t, night.Parse(`expr time_between("22:00", "06:00")`))
+	expect.NoError(t, weekend.Parse(`expr weekday() == 0 || weekday() == 6`))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	check := func(on *RuleOn, at string) bool {
+		timeNow = func() time.Time {
+			return expect.Must(time.Parse(time.DateTime, at))
+		}
+		return on.Check(httptest.NewRecorder(), req)
+	}
+	// 2026-10-19 is a Monday
+	expect.True(t, check(&office, "2026-10-19 09:00:00"))
+	expect.True(t, check(&office, "2026-10-19 17:29:59"))
+	expect.False(t, check(&office, "2026-10-19 17:30:00"))
+	expect.False(t, check(&office, "2026-10-18 12:00:00"))
+	expect.True(t, check(&night, "2026-10-19 23:15:00"))
+	expect.True(t, check(&night, "2026-10-19 05:59:00"))
+	expect.False(t, check(&night, "2026-10-19 06:00:00"))
+	expect.True(t, check(&weekend, "2026-10-18 12:00:00"))
+	expect.False(t, check(&weekend, "2026-10-19 12:00:00"))
+}
+
+func TestExprErrors(t *testing.T) {
+	for _, expr := range []string{
+		`req_method`,                      // not bool
+		`req_method == 1`,                 // type mismatch
+		`req_port == "8443"`,              // int variable
+		`unknown_var == ""`,               // unknown variable
+		`unknown_func()`,                  // unknown function
+		`req_method == "GET" &&`,          // incomplete
+		`(req_method == "GET"`,            // unterminated parenthesis
+		`req_method == "GET`,              // unterminated quotes
+		`1 < 2 < 3`,                       // not associative
+		`req_path.matches(req_method)`,    // regex must be a literal
+		`req_path.matches("(")`,           // invalid regex
+		`in_cidr(remote_host, "10.0.0.")`, // invalid CIDR
+		`time_between("9am", "17:00")`,    // invalid time
+		`starts_with(req_path)`,           // arg count
+		`1.5 % 2 == 0`,                    // int only
+		`req_method in "GET"`,             // list expected
+		`[1, 2] == []`,                    // list of strings
+		`req_method == "GET" ; true`,      // unexpected character
+	} {
+		t.Run(expr, func(t *testing.T) {
+			var on RuleOn
+			err := on.Parse("expr " + expr)
+			expect.HasError(t, err)
+		})
+	}
+}
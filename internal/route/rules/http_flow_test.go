@@ -746,6 +746,52 @@ func TestHTTPFlow_RouteConditions(t *testing.T) {
 	assert.Equal(t, "frontend", w2.Header().Get("X-Route"))
 }
 
+func TestHTTPFlow_KVRouteScope(t *testing.T) {
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	var rules Rules
+	err := parseRules(`
+- name: set
+  on: path /set
+  do: |
+    set_kv flow_kv_scope $arg(v)
+    set_kv global:flow_kv_scope $arg(v)
+- name: route value
+  on: |
+    path /get
+    kv flow_kv_scope 1
+  do: set resp_header X-Route-Value 1
+- name: global value
+  on: |
+    path /get
+    kv global:flow_kv_scope 2
+  do: set resp_header X-Global-Value 2
+`, &rules)
+	require.NoError(t, err)
+	handler := rules.BuildHandler(upstream)
+
+	serve := func(route, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		req = routes.WithRouteContext(req, mockRoute(route))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	serve("backend", "/set?v=1")
+	serve("frontend", "/set?v=2")
+
+	// keys are scoped to the route unless they start with global:
+	w := serve("backend", "/get")
+	assert.Equal(t, "1", w.Header().Get("X-Route-Value"))
+	assert.Equal(t, "2", w.Header().Get("X-Global-Value"))
+	w = serve("frontend", "/get")
+	assert.Empty(t, w.Header().Get("X-Route-Value"))
+	assert.Equal(t, "2", w.Header().Get("X-Global-Value"))
+}
+
 func TestHTTPFlow_ResponseStatusConditions(t *testing.T) {
 	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(405)
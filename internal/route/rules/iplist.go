@@ -0,0 +1,282 @@
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+	"weak"
+
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/rs/zerolog/log"
+	"github.com/yusing/godoxy/internal/common"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// ipList is a list of IPs and CIDRs loaded from a file or URL, refreshed when used.
+//
+// Lists are shared by source, so rules referring to the same list load it only once.
+// The cache holds weak pointers, a list is evicted once no rule refers to it.
+type ipList struct {
+	source    string
+	isURL     bool
+	set       atomic.Pointer[ipSet]
+	modTime   time.Time    // last modification time of a file list
+	checked   atomic.Int64 // unix nano of the last reload
+	reloading atomic.Bool
+}
+
+type ipSet struct {
+	prefixes map[netip.Prefix]struct{}
+	bits     []int // distinct prefix lengths, longest first
+}
+
+const (
+	ipListFileRefreshInterval = time.Minute
+	ipListURLRefreshInterval  = time.Hour
+	ipListURLTimeout          = 30 * time.Second
+	ipListMaxSize             = 16 << 20 // 16 MiB
+)
+
+var (
+	ipLists      = xsync.NewMap[string, weak.Pointer[ipList]]()
+	ipListClient = &http.Client{Timeout: ipListURLTimeout}
+	// ipListsDir is the directory of file lists, paths of "file(<path>)" are relative to it.
+	ipListsDir = common.IPListsBasePath
+	ipListURLs atomic.Pointer[[]string]
+)
+
+// InitIPListURLs sets the URLs allowed in "url(<url>)", called on config load.
+func InitIPListURLs(urls []string) {
+	ipListURLs.Store(&urls)
+}
+
+// cutIPListSource returns the source of "file(<path>)" or "url(<url>)".
+func cutIPListSource(s string) (source string, isURL bool, ok bool) {
+	if !strings.HasSuffix(s, ")") {
+		return "", false, false
+	}
+	if source, ok = strings.CutPrefix(s, "file("); ok {
+		return source[:len(source)-1], false, true
+	}
+	if source, ok = strings.CutPrefix(s, "url("); ok {
+		return source[:len(source)-1], true, true
+	}
+	return "", false, false
+}
+
+// checkIPListSource returns an error if the source is a file outside ipListsDir
+// or a URL not listed in the config.
+func checkIPListSource(source string, isURL bool) gperr.Error {
+	if source == "" {
+		return ErrInvalidArguments.Withf("empty ip list source")
+	}
+	if isURL {
+		if urls := ipListURLs.Load(); urls == nil || !slices.Contains(*urls, source) {
+			return ErrIPListNotAllowed.Subject(source)
+		}
+		return nil
+	}
+	if !filepath.IsLocal(source) {
+		return ErrInvalidArguments.Withf("ip list file must be a relative path in %s", ipListsDir).Subject(source)
+	}
+	return nil
+}
+
+// loadIPList returns the shared list of the source, loading it on first use.
+func loadIPList(source string, isURL bool) (*ipList, gperr.Error) {
+	if err := checkIPListSource(source, isURL); err != nil {
+		return nil, err
+	}
+	key := source
+	if isURL {
+		key = "url:" + key
+	}
+	if wp, ok := ipLists.Load(key); ok {
+		if l := wp.Value(); l != nil {
+			return l, nil
+		}
+	}
+	l := &ipList{source: source, isURL: isURL}
+	if err := l.reload(); err != nil {
+		return nil, ErrInvalidArguments.With(err).Subject(source)
+	}
+	l.checked.Store(time.Now().UnixNano())
+
+	actual, _ := ipLists.Compute(key, func(old weak.Pointer[ipList], loaded bool) (weak.Pointer[ipList], xsync.ComputeOp) {
+		if loaded && old.Value() != nil {
+			return old, xsync.CancelOp
+		}
+		return weak.Make(l), xsync.UpdateOp
+	})
+	if shared := actual.Value(); shared != nil && shared != l {
+		return shared, nil
+	}
+	runtime.AddCleanup(l, func(key string) {
+		ipLists.Compute(key, func(old weak.Pointer[ipList], loaded bool) (weak.Pointer[ipList], xsync.ComputeOp) {
+			if loaded && old.Value() == nil {
+				return old, xsync.DeleteOp
+			}
+			return old, xsync.CancelOp
+		})
+	}, key)
+	return l, nil
+}
+
+func (l *ipList) Contains(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	l.refreshIfStale()
+	return l.set.Load().Contains(addr)
+}
+
+// refreshIfStale reloads the list in background when the refresh interval has passed,
+// requests keep using the current list meanwhile.
+func (l *ipList) refreshIfStale() {
+	interval := ipListFileRefreshInterval
+	if l.isURL {
+		interval = ipListURLRefreshInterval
+	}
+	if time.Since(time.Unix(0, l.checked.Load())) < interval {
+		return
+	}
+	if !l.reloading.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer l.reloading.Store(false)
+		if err := l.reload(); err != nil {
+			log.Err(err).Str("source", l.source).Msg("failed to refresh ip list, keeping the old one")
+		}
+		l.checked.Store(time.Now().UnixNano())
+	}()
+}
+
+func (l *ipList) reload() error {
+	if l.isURL {
+		return l.reloadURL()
+	}
+	return l.reloadFile()
+}
+
+func (l *ipList) reloadFile() error {
+	f, err := os.OpenInRoot(ipListsDir, l.source)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if l.set.Load() != nil && stat.ModTime().Equal(l.modTime) {
+		return nil
+	}
+
+	set, err := parseIPSet(f)
+	if err != nil {
+		return err
+	}
+	l.set.Store(set)
+	l.modTime = stat.ModTime()
+	return nil
+}
+
+func (l *ipList) reloadURL() error {
+	resp, err := ipListClient.Get(l.source)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	set, err := parseIPSet(io.LimitReader(resp.Body, ipListMaxSize))
+	if err != nil {
+		return err
+	}
+	l.set.Store(set)
+	return nil
+}
+
+// parseIPSet parses one IP or CIDR per line, comments start with "#" or ";".
+func parseIPSet(r io.Reader) (*ipSet, error) {
+	set := &ipSet{prefixes: make(map[netip.Prefix]struct{})}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		line, _, _ = strings.Cut(line, "#")
+		line, _, _ = strings.Cut(line, ";")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		prefix, err := parseIPOrCIDR(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid ip or cidr", lineNo)
+		}
+		set.add(prefix)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+func parseIPOrCIDR(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func (s *ipSet) add(prefix netip.Prefix) {
+	s.prefixes[prefix] = struct{}{}
+	if !slices.Contains(s.bits, prefix.Bits()) {
+		s.bits = append(s.bits, prefix.Bits())
+		slices.SortFunc(s.bits, func(a, b int) int { return b - a })
+	}
+}
+
+func (s *ipSet) Len() int {
+	return len(s.prefixes)
+}
+
+func (s *ipSet) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, bits := range s.bits {
+		prefix, err := addr.Prefix(bits)
+		if err != nil { // prefix length too long for IPv4
+			continue
+		}
+		if _, ok := s.prefixes[prefix]; ok {
+			return true
+		}
+	}
+	return false
+}
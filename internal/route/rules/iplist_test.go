@@ -0,0 +1,140 @@
+package rules
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yusing/godoxy/internal/common"
+	expect "github.com/yusing/goutils/testing"
+)
+
+const testIPList = `
+# comment
+10.0.0.0/8
+192.168.1.1 ; single ip
+2001:db8::/32   trailing fields are ignored
+`
+
+func TestParseIPSet(t *testing.T) {
+	set, err := parseIPSet(strings.NewReader(testIPList))
+	expect.NoError(t, err)
+	expect.Equal(t, set.Len(), 3)
+
+	for ip, want := range map[string]bool{
+		"10.1.2.3":           true,
+		"11.0.0.1":           false,
+		"192.168.1.1":        true,
+		"192.168.1.2":        false,
+		"::ffff:10.0.0.1":    true,
+		"2001:db8:1::1":      true,
+		"2001:db9::1":        false,
+		"::ffff:192.168.1.1": true,
+	} {
+		addr := net.ParseIP(ip)
+		list := &ipList{}
+		list.set.Store(set)
+		list.checked.Store(time.Now().UnixNano())
+		expect.Equal(t, list.Contains(addr), want, ip)
+	}
+
+	_, err = parseIPSet(strings.NewReader("10.0.0.1\nsecret-token\n"))
+	expect.ErrorContains(t, err, "line 2")
+	expect.False(t, strings.Contains(err.Error(), "secret-token"))
+}
+
+func TestIPListSources(t *testing.T) {
+	ipListsDir = t.TempDir()
+	t.Cleanup(func() { ipListsDir = common.IPListsBasePath })
+	expect.NoError(t, os.WriteFile(filepath.Join(ipListsDir, "list.txt"), []byte(testIPList), 0o644))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/list.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(testIPList))
+	}))
+	defer srv.Close()
+
+	InitIPListURLs([]string{srv.URL + "/list.txt", srv.URL + "/missing.txt"})
+	t.Cleanup(func() { InitIPListURLs(nil) })
+
+	for _, on := range []string{
+		"remote file(list.txt)",
+		"remote url(" + srv.URL + "/list.txt)",
+	} {
+		var rule RuleOn
+		expect.NoError(t, rule.Parse(on))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.2.3.4:1234"
+		expect.True(t, rule.Check(httptest.NewRecorder(), req), on)
+		req.RemoteAddr = "172.16.0.1:1234"
+		expect.False(t, rule.Check(httptest.NewRecorder(), req), on)
+	}
+
+	var rule RuleOn
+	expect.ErrorIs(t, ErrInvalidArguments, rule.Parse("remote url("+srv.URL+"/missing.txt)"))
+	expect.ErrorIs(t, ErrIPListNotAllowed, rule.Parse("remote url("+srv.URL+"/other.txt)"))
+
+	// symlinks cannot leave the directory
+	outside := filepath.Join(t.TempDir(), "outside.txt")
+	expect.NoError(t, os.WriteFile(outside, []byte(testIPList), 0o644))
+	expect.NoError(t, os.Symlink(outside, filepath.Join(ipListsDir, "link.txt")))
+	expect.ErrorIs(t, ErrInvalidArguments, rule.Parse("remote file(link.txt)"))
+}
+
+func TestIPListEviction(t *testing.T) {
+	ipListsDir = t.TempDir()
+	t.Cleanup(func() { ipListsDir = common.IPListsBasePath })
+	expect.NoError(t, os.WriteFile(filepath.Join(ipListsDir, "evict.txt"), []byte(testIPList), 0o644))
+
+	func() {
+		l, err := loadIPList("evict.txt", false)
+		expect.NoError(t, err)
+		shared, err := loadIPList("evict.txt", false)
+		expect.NoError(t, err)
+		expect.True(t, l == shared)
+	}()
+
+	for range 10 {
+		runtime.GC()
+		if _, ok := ipLists.Load("evict.txt"); !ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("unreferenced ip list is not evicted")
+}
+
+func TestIPListRefresh(t *testing.T) {
+	ipListsDir = t.TempDir()
+	t.Cleanup(func() { ipListsDir = common.IPListsBasePath })
+	file := filepath.Join(ipListsDir, "refresh.txt")
+	expect.NoError(t, os.WriteFile(file, []byte("10.0.0.1\n"), 0o644))
+
+	l, err := loadIPList("refresh.txt", false)
+	expect.NoError(t, err)
+	ip := net.ParseIP("10.0.0.2")
+	expect.False(t, l.Contains(ip))
+
+	expect.NoError(t, os.WriteFile(file, []byte("10.0.0.2\n"), 0o644))
+	expect.NoError(t, os.Chtimes(file, time.Now(), time.Now().Add(time.Second)))
+	l.checked.Store(time.Now().Add(-ipListFileRefreshInterval).UnixNano())
+
+	// reloaded in background
+	deadline := time.Now().Add(time.Second)
+	for !l.Contains(ip) || l.reloading.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("stale ip list is not refreshed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
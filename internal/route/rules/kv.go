@@ -0,0 +1,449 @@
+package rules
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/jsonstore"
+	"github.com/yusing/godoxy/internal/route/routes"
+	gperr "github.com/yusing/goutils/errs"
+	"github.com/yusing/goutils/task"
+)
+
+// kvEntry is a value of the key-value store.
+type kvEntry struct {
+	Value  string    `json:"value"`
+	Expiry time.Time `json:"expiry,omitzero"` // zero if it never expires
+}
+
+type setKVArgs struct {
+	key, value templateString
+	ttl        time.Duration
+	persist    bool
+}
+
+const (
+	kvCleanupInterval = time.Minute
+	kvPersist         = "persist"
+	// kvMaxEntries limits the number of entries of each store, new keys are refused when it is full.
+	kvMaxEntries = 100_000
+	// kvMaxRouteEntries limits the number of entries of each route, and of the global keys, in each store.
+	// When it is reached, the entries of the route expiring first are evicted,
+	// so that a route cannot evict the keys of another.
+	kvMaxRouteEntries = 10_000
+	kvEvictBatch      = kvMaxRouteEntries / 10
+	// kvGlobalPrefix marks keys shared by all routes, other keys are prefixed with the route name.
+	kvGlobalPrefix = "global:"
+)
+
+// kvMap is a store of the key-value store, it counts the entries of each route.
+type kvMap struct {
+	*xsync.Map[string, *kvEntry]
+	counts *xsync.Map[string, int] // by kvPrefix
+}
+
+var (
+	// a key is stored either in memory or in the persistent store, never both.
+	kvMemory        = newKVMap(xsync.NewMap[string, *kvEntry]())
+	kvPersistent    = jsonstore.Store[*kvEntry](common.NamespaceRulesKV)
+	kvPersistentMap = newKVMap(kvPersistent.Map)
+	kvCleanupOnce   sync.Once
+)
+
+func newKVMap(m *xsync.Map[string, *kvEntry]) *kvMap {
+	s := &kvMap{Map: m, counts: xsync.NewMap[string, int]()}
+	for key := range m.All() {
+		s.addCount(key, 1)
+	}
+	return s
+}
+
+func (e *kvEntry) expired(now time.Time) bool {
+	return !e.Expiry.IsZero() && !now.Before(e.Expiry)
+}
+
+func kvStore(persist bool) *kvMap {
+	if persist {
+		return kvPersistentMap
+	}
+	return kvMemory
+}
+
+// kvKey returns the key in the store of the key of a rule,
+// keys not starting with "global:" are scoped to the route of the request.
+func kvKey(r *http.Request, key string) string {
+	if strings.HasPrefix(key, kvGlobalPrefix) {
+		return key
+	}
+	return "route/" + url.PathEscape(routes.TryGetUpstreamName(r)) + "/" + key
+}
+
+// kvPrefix returns the prefix a key is counted by, "route/<name>/" or "global:".
+func kvPrefix(key string) string {
+	if strings.HasPrefix(key, kvGlobalPrefix) {
+		return kvGlobalPrefix
+	}
+	if rest, ok := strings.CutPrefix(key, "route/"); ok {
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			return key[:len("route/")+i+1]
+		}
+	}
+	return ""
+}
+
+func (s *kvMap) addCount(key string, delta int) {
+	s.counts.Compute(kvPrefix(key), func(n int, _ bool) (int, xsync.ComputeOp) {
+		n += delta
+		if n <= 0 {
+			return 0, xsync.DeleteOp
+		}
+		return n, xsync.UpdateOp
+	})
+}
+
+// count returns the number of entries with the prefix of key.
+func (s *kvMap) count(key string) int {
+	n, _ := s.counts.Load(kvPrefix(key))
+	return n
+}
+
+// compute sets the entry of key to the result of f.
+func (s *kvMap) compute(key string, f func(old *kvEntry, loaded bool) *kvEntry) {
+	s.Compute(key, func(old *kvEntry, loaded bool) (*kvEntry, xsync.ComputeOp) {
+		if !loaded {
+			s.addCount(key, 1)
+		}
+		return f(old, loaded), xsync.UpdateOp
+	})
+}
+
+func (s *kvMap) delete(key string) {
+	if _, ok := s.LoadAndDelete(key); ok {
+		s.addCount(key, -1)
+	}
+}
+
+// deleteMatching deletes the entries for which f returns true.
+func (s *kvMap) deleteMatching(f func(key string, e *kvEntry) bool) {
+	s.DeleteMatching(func(key string, e *kvEntry) (delete, stop bool) {
+		if f(key, e) {
+			s.addCount(key, -1)
+			return true, false
+		}
+		return false, false
+	})
+}
+
+// kvGet returns the value of a key, ok is false if it does not exist or has expired.
+func kvGet(key string) (value string, ok bool) {
+	now := timeNow()
+	for _, store := range []*kvMap{kvMemory, kvPersistentMap} {
+		if e, ok := store.Load(key); ok && !e.expired(now) {
+			return e.Value, true
+		}
+	}
+	return "", false
+}
+
+// kvValue returns the value of a key, empty if it does not exist or has expired.
+func kvValue(key string) string {
+	value, _ := kvGet(key)
+	return value
+}
+
+// kvSet sets the value of a key, it never expires if ttl is 0.
+// A new key is dropped if the store is full.
+func kvSet(key, value string, ttl time.Duration, persist bool) {
+	kvStartCleanup()
+	now := timeNow()
+	e := &kvEntry{Value: value}
+	if ttl > 0 {
+		e.Expiry = now.Add(ttl)
+	}
+	if !kvMakeRoom(kvStore(persist), key, now) {
+		return
+	}
+	kvStore(persist).compute(key, func(*kvEntry, bool) *kvEntry {
+		return e
+	})
+	kvStore(!persist).delete(key)
+}
+
+func kvDelete(key string) {
+	kvMemory.delete(key)
+	kvPersistentMap.delete(key)
+}
+
+// kvIncr increments the counter of a key and returns the new count.
+//
+// The counter starts at 1 and expires after window since then,
+// a non-numeric value is treated as an expired counter.
+// A new counter is not stored if the store is full, the count is 1.
+func kvIncr(key string, window time.Duration, persist bool) int64 {
+	kvStartCleanup()
+	now := timeNow()
+	if !kvMakeRoom(kvStore(persist), key, now) {
+		return 1
+	}
+	var count int64
+	kvStore(persist).compute(key, func(old *kvEntry, loaded bool) *kvEntry {
+		if loaded && !old.expired(now) {
+			if n, err := strconv.ParseInt(old.Value, 10, 64); err == nil {
+				count = n + 1
+				return &kvEntry{Value: strconv.FormatInt(count, 10), Expiry: old.Expiry}
+			}
+		}
+		count = 1
+		e := &kvEntry{Value: "1"}
+		if window > 0 {
+			e.Expiry = now.Add(window)
+		}
+		return e
+	})
+	kvStore(!persist).delete(key)
+	return count
+}
+
+// kvMakeRoom reports whether key can be stored.
+//
+// When the route of a new key has kvMaxRouteEntries entries, its expired entries and then the ones expiring first are evicted.
+// When the store is full, expired entries are removed and the key is refused if it is still full,
+// entries of other routes are never evicted.
+func kvMakeRoom(store *kvMap, key string, now time.Time) bool {
+	if _, ok := store.Load(key); ok {
+		return true
+	}
+	if store.count(key) >= kvMaxRouteEntries {
+		kvEvictRoute(store, kvPrefix(key), now)
+	}
+	if store.Size() < kvMaxEntries {
+		return true
+	}
+	store.deleteMatching(func(_ string, e *kvEntry) bool {
+		return e.expired(now)
+	})
+	return store.Size() < kvMaxEntries
+}
+
+// kvEvictRoute evicts the expired entries with the prefix, then the ones expiring first
+// until kvEvictBatch entries are freed, so that the next evictions are batched.
+func kvEvictRoute(store *kvMap, prefix string, now time.Time) {
+	type keyExpiry struct {
+		key    string
+		expiry time.Time
+	}
+	var entries []keyExpiry
+	for k, e := range store.All() {
+		if kvPrefix(k) == prefix {
+			entries = append(entries, keyExpiry{k, e.Expiry})
+		}
+	}
+	// expired entries go first, entries that never expire go last
+	slices.SortFunc(entries, func(a, b keyExpiry) int {
+		switch {
+		case a.expiry.IsZero() && b.expiry.IsZero():
+			return 0
+		case a.expiry.IsZero():
+			return 1
+		case b.expiry.IsZero():
+			return -1
+		}
+		return a.expiry.Compare(b.expiry)
+	})
+	evict := max(len(entries)-(kvMaxRouteEntries-kvEvictBatch), 0)
+	for i, e := range entries {
+		if i >= evict && (e.expiry.IsZero() || now.Before(e.expiry)) {
+			break
+		}
+		store.delete(e.key)
+	}
+}
+
+func kvStartCleanup() {
+	kvCleanupOnce.Do(func() {
+		go kvCleanup()
+	})
+}
+
+// kvCleanup removes expired entries periodically, lookups ignore them in the meantime.
+func kvCleanup() {
+	t := task.RootTask("rules_kv_cleanup", false)
+	ticker := time.NewTicker(kvCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.Context().Done():
+			return
+		case <-ticker.C:
+			now := timeNow()
+			for _, store := range []*kvMap{kvMemory, kvPersistentMap} {
+				store.deleteMatching(func(_ string, e *kvEntry) bool {
+					return e.expired(now)
+				})
+			}
+		}
+	}
+}
+
+// validateSetKV returns *setKVArgs from "key value [ttl] [persist]".
+func validateSetKV(args []string) (any, gperr.Error) {
+	args, persist := cutKVPersist(args)
+	if len(args) < 2 || len(args) > 3 {
+		return nil, ErrInvalidArguments.Withf("expect key, value, optional ttl and optional %s", kvPersist)
+	}
+	key, err := validateTemplate(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	value, err := validateTemplate(args[1], false)
+	if err != nil {
+		return nil, err
+	}
+	kv := &setKVArgs{key: key, value: value, persist: persist}
+	if len(args) == 3 {
+		if kv.ttl, err = validateKVDuration(args[2]); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateKVTemplateTTL(kv); err != nil {
+		return nil, err
+	}
+	return kv, nil
+}
+
+// validateIncr returns *setKVArgs from "key [window] [persist]", ttl is the window.
+func validateIncr(args []string) (any, gperr.Error) {
+	args, persist := cutKVPersist(args)
+	if len(args) < 1 || len(args) > 2 {
+		return nil, ErrInvalidArguments.Withf("expect key, optional window and optional %s", kvPersist)
+	}
+	key, err := validateTemplate(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	kv := &setKVArgs{key: key, persist: persist}
+	if len(args) == 2 {
+		if kv.ttl, err = validateKVDuration(args[1]); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateKVTemplateTTL(kv); err != nil {
+		return nil, err
+	}
+	return kv, nil
+}
+
+// validateKVTemplateTTL requires a ttl for keys with variables,
+// as they are set per request, e.g. per client, and would otherwise pile up.
+func validateKVTemplateTTL(kv *setKVArgs) gperr.Error {
+	if kv.key.isTemplate && kv.ttl == 0 {
+		return ErrInvalidArguments.Withf("key %q has variables, expect a ttl", kv.key.string)
+	}
+	return nil
+}
+
+func cutKVPersist(args []string) ([]string, bool) {
+	if len(args) > 1 && args[len(args)-1] == kvPersist {
+		return args[:len(args)-1], true
+	}
+	return args, false
+}
+
+func validateKVDuration(s string) (time.Duration, gperr.Error) {
+	if s == "0" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, ErrInvalidArguments.Withf("duration %q, expect e.g. 30s, 10m or 24h", s)
+	}
+	return d, nil
+}
+
+// kvMatcher matches the value of a templated key.
+type kvMatcher struct {
+	key   templateString
+	match func(value string) bool // nil to match if the key exists
+}
+
+// validateKVMatcher returns *kvMatcher from "key [value]",
+// value is a string, glob or regex matcher, or a number comparison like >=5.
+func validateKVMatcher(args []string) (any, gperr.Error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, ErrExpectKVOptionalV
+	}
+	key, err := validateTemplate(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	m := &kvMatcher{key: key}
+	if len(args) == 1 {
+		return m, nil
+	}
+	if cmp, ok := parseNumberComparison(args[1]); ok {
+		if cmp == nil {
+			return nil, ErrInvalidArguments.Withf("number comparison %q, expect e.g. >=5", args[1])
+		}
+		m.match = cmp
+		return m, nil
+	}
+	matcher, err := ParseMatcher(args[1])
+	if err != nil {
+		return nil, err
+	}
+	m.match = matcher
+	return m, nil
+}
+
+func (m *kvMatcher) Check(w http.ResponseWriter, r *http.Request) bool {
+	key, err := m.key.ExpandVarsToString(w, r)
+	if err != nil {
+		return false
+	}
+	value, ok := kvGet(kvKey(r, key))
+	if !ok {
+		return false
+	}
+	return m.match == nil || m.match(value)
+}
+
+var numberComparisons = []struct {
+	op  string
+	cmp func(a, b int64) bool
+}{
+	// longer operators first
+	{">=", func(a, b int64) bool { return a >= b }},
+	{"<=", func(a, b int64) bool { return a <= b }},
+	{"==", func(a, b int64) bool { return a == b }},
+	{"!=", func(a, b int64) bool { return a != b }},
+	{">", func(a, b int64) bool { return a > b }},
+	{"<", func(a, b int64) bool { return a < b }},
+}
+
+// parseNumberComparison parses e.g. ">=5", ok is false if s is not a comparison,
+// cmp is nil if the number is invalid. Non-numeric values never match.
+func parseNumberComparison(s string) (cmp func(string) bool, ok bool) {
+	for _, c := range numberComparisons {
+		numStr, found := strings.CutPrefix(s, c.op)
+		if !found {
+			continue
+		}
+		want, err := strconv.ParseInt(numStr, 10, 64)
+		if err != nil {
+			return nil, true
+		}
+		return func(value string) bool {
+			got, err := strconv.ParseInt(value, 10, 64)
+			return err == nil && c.cmp(got, want)
+		}, true
+	}
+	return nil, false
+}
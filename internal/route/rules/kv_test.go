@@ -0,0 +1,202 @@
+package rules
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/puzpuzpuz/xsync/v4"
+	expect "github.com/yusing/goutils/testing"
+)
+
+// setTestClock fixes timeNow to the returned time until the test ends.
+func setTestClock(t *testing.T, start time.Time) *time.Time {
+	t.Helper()
+	orig := timeNow
+	t.Cleanup(func() { timeNow = orig })
+	now := &start
+	timeNow = func() time.Time { return *now }
+	return now
+}
+
+func TestKVSetGet(t *testing.T) {
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	now := setTestClock(t, start)
+
+	kvSet("test_kv:a", "1", time.Minute, false)
+	kvSet("test_kv:b", "2", 0, true)
+
+	v, ok := kvGet("test_kv:a")
+	expect.True(t, ok)
+	expect.Equal(t, v, "1")
+	expect.Equal(t, kvValue("test_kv:b"), "2")
+
+	*now = start.Add(time.Minute)
+	_, ok = kvGet("test_kv:a")
+	expect.False(t, ok)
+	expect.Equal(t, kvValue("test_kv:b"), "2")
+
+	// a key lives in one store only
+	kvSet("test_kv:b", "3", 0, false)
+	_, persisted := kvPersistent.Load("test_kv:b")
+	expect.False(t, persisted)
+	expect.Equal(t, kvValue("test_kv:b"), "3")
+
+	kvDelete("test_kv:b")
+	_, ok = kvGet("test_kv:b")
+	expect.False(t, ok)
+}
+
+func TestKVIncr(t *testing.T) {
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	now := setTestClock(t, start)
+
+	for i := range 5 {
+		expect.Equal(t, kvIncr("test_kv:counter", 10*time.Minute, false), int64(i+1))
+		*now = now.Add(time.Minute)
+	}
+	// the window starts at the first increment
+	*now = start.Add(10 * time.Minute)
+	expect.Equal(t, kvIncr("test_kv:counter", 10*time.Minute, false), int64(1))
+
+	kvSet("test_kv:counter", "abc", 0, false)
+	expect.Equal(t, kvIncr("test_kv:counter", 0, false), int64(1))
+
+	expect.Equal(t, kvIncr("test_kv:persisted", 0, true), int64(1))
+	expect.Equal(t, kvIncr("test_kv:persisted", 0, true), int64(2))
+	_, persisted := kvPersistent.Load("test_kv:persisted")
+	expect.True(t, persisted)
+}
+
+func TestKVRules(t *testing.T) {
+	setTestClock(t, time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC))
+
+	var incr, del Command
+	expect.NoError(t, incr.Parse("incr test_kv_fail:$remote_host 10m"))
+	expect.NoError(t, del.Parse("del_kv test_kv_fail:$remote_host"))
+
+	var blocked, exists, expr RuleOn
+	expect.NoError(t, blocked.Parse("kv test_kv_fail:$remote_host >=3"))
+	expect.NoError(t, exists.Parse("kv test_kv_fail:$remote_host"))
+	expect.NoError(t, expr.Parse(`expr int(kv("test_kv_fail:" + remote_host)) == 2`))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	w := httptest.NewRecorder()
+
+	expect.False(t, exists.Check(w, req))
+	for range 2 {
+		expect.NoError(t, incr.exec.Handle(w, req))
+	}
+	expect.True(t, exists.Check(w, req))
+	expect.True(t, expr.Check(w, req))
+	expect.False(t, blocked.Check(w, req))
+
+	expect.NoError(t, incr.exec.Handle(w, req))
+	expect.True(t, blocked.Check(w, req))
+
+	expect.NoError(t, del.exec.Handle(w, req))
+	expect.False(t, exists.Check(w, req))
+}
+
+func TestKVKey(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	expect.Equal(t, kvKey(req, "global:maintenance"), "global:maintenance")
+	expect.Equal(t, kvKey(req, "maintenance"), "route//maintenance")
+}
+
+func TestKVPrefix(t *testing.T) {
+	expect.Equal(t, kvPrefix("global:maintenance"), kvGlobalPrefix)
+	expect.Equal(t, kvPrefix("route/app/hits:1.2.3.4"), "route/app/")
+	expect.Equal(t, kvPrefix("route//maintenance"), "route//")
+}
+
+func TestKVEviction(t *testing.T) {
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	store := newKVMap(xsync.NewMap[string, *kvEntry]())
+	for i := range kvMaxRouteEntries {
+		e := &kvEntry{Value: "1", Expiry: start.Add(time.Duration(i+1) * time.Second)}
+		if i%2 == 0 {
+			e.Expiry = time.Time{} // never expires
+		}
+		store.compute("route/a/"+strconv.Itoa(i), func(*kvEntry, bool) *kvEntry { return e })
+	}
+	store.compute("route/b/0", func(*kvEntry, bool) *kvEntry { return &kvEntry{Value: "1", Expiry: start} })
+	expect.Equal(t, store.count("route/a/"), kvMaxRouteEntries)
+
+	// existing keys are updated in place
+	expect.True(t, kvMakeRoom(store, "route/a/0", start))
+	expect.Equal(t, store.Size(), kvMaxRouteEntries+1)
+
+	// expired entries of the route go first, then the ones expiring first, entries that never expire are kept
+	expect.True(t, kvMakeRoom(store, "route/a/new", start.Add(11*time.Second)))
+	expect.Equal(t, store.count("route/a/"), kvMaxRouteEntries-kvEvictBatch)
+	_, ok := store.Load("route/a/1")
+	expect.False(t, ok)
+	_, ok = store.Load("route/a/0")
+	expect.True(t, ok)
+	// entries of other routes are kept, even if expired
+	_, ok = store.Load("route/b/0")
+	expect.True(t, ok)
+}
+
+func TestKVStoreFull(t *testing.T) {
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	store := newKVMap(xsync.NewMap[string, *kvEntry]())
+	const routes = 20
+	for i := range kvMaxEntries {
+		key := "route/" + strconv.Itoa(i%routes) + "/" + strconv.Itoa(i)
+		store.compute(key, func(*kvEntry, bool) *kvEntry { return &kvEntry{Value: "1"} })
+	}
+
+	// new keys are refused, entries of other routes are not evicted
+	expect.False(t, kvMakeRoom(store, "route/new/0", start))
+	expect.Equal(t, store.Size(), kvMaxEntries)
+	expect.True(t, kvMakeRoom(store, "route/0/0", start))
+
+	store.delete("route/1/1")
+	expect.Equal(t, store.count("route/1/"), kvMaxEntries/routes-1)
+	expect.True(t, kvMakeRoom(store, "route/new/0", start))
+}
+
+func TestKVValidate(t *testing.T) {
+	for _, tt := range []struct {
+		input string
+		valid bool
+	}{
+		{"set_kv key value", true},
+		{"set_kv key value 10m", true},
+		{"set_kv key value 0 persist", true},
+		{"set_kv key $req_path persist", true},
+		{"set_kv key", false},
+		{"set_kv key value ten", false},
+		{"set_kv key value 10m persist extra", false},
+		{"incr key", true},
+		{"incr key 1h persist", true},
+		{"incr key -1h", false},
+		{"set_kv token:$arg(token) valid", false},
+		{"set_kv token:$arg(token) valid 0", false},
+		{"set_kv token:$arg(token) valid 24h", true},
+		{"incr fail:$remote_host", false},
+		{"incr fail:$remote_host 10m", true},
+		{"del_kv key", true},
+		{"del_kv", false},
+	} {
+		t.Run(tt.input, func(t *testing.T) {
+			var cmd Command
+			err := cmd.Parse(tt.input)
+			if tt.valid {
+				expect.NoError(t, err)
+			} else {
+				expect.HasError(t, err)
+			}
+		})
+	}
+
+	for _, input := range []string{"kv key >=abc", "kv key regex(()"} {
+		var on RuleOn
+		expect.HasError(t, on.Parse(input))
+	}
+}
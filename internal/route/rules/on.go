@@ -37,6 +37,11 @@ const (
 	OnHost      = "host"
 	OnPath      = "path"
 	OnRemote    = "remote"
+	OnTime      = "time"
+	OnCountry   = "country"
+	OnASN       = "asn"
+	OnCity      = "city"
+	OnKV        = "kv"
 	OnBasicAuth = "basic_auth"
 	OnRoute     = "route"
 
@@ -345,12 +350,30 @@ var checkers = map[string]struct {
 	OnRemote: {
 		help: Help{
 			command: OnRemote,
+			description: makeLines(
+				"Supports ip, cidr, or an ip list loaded from a file or url, e.g.:",
+				helpExample(OnRemote, "192.168.1.1"),
+				helpExample(OnRemote, "10.0.0.0/8"),
+				helpExample(OnRemote, helpFuncCall("file", "blocklist.txt")),
+				helpExample(OnRemote, helpFuncCall("url", "https://example.com/ips.txt")),
+				"ip lists have one ip or cidr per line, files are refreshed every minute, urls every hour",
+				"files are relative to config/ip_lists, urls must be listed in entrypoint.rules.ip_list_urls",
+			),
 			args: map[string]string{
-				"ip|cidr": "the remote ip or cidr",
+				"ip|cidr|list": "the remote ip, cidr or ip list",
 			},
 		},
-		validate: validateCIDR,
+		validate: validateRemote,
 		builder: func(args any) CheckFunc {
+			if list, ok := args.(*ipList); ok {
+				return func(w http.ResponseWriter, r *http.Request) bool {
+					ip := httputils.GetSharedData(w).GetRemoteIP(r)
+					if ip == nil {
+						return false
+					}
+					return list.Contains(ip)
+				}
+			}
 			ipnet := args.(*net.IPNet)
 			// for /32 (IPv4) or /128 (IPv6), just compare the IP
 			if ones, bits := ipnet.Mask.Size(); ones == bits {
@@ -372,6 +395,110 @@ var checkers = map[string]struct {
 			}
 		},
 	},
+	OnTime: {
+		help: Help{
+			command: OnTime,
+			description: makeLines(
+				"Matches weekdays and/or time of day, optionally in a time zone (default: local), e.g.:",
+				helpExample(OnTime, "mon-fri", "09:00-18:00"),
+				helpExample(OnTime, "sat,sun"),
+				helpExample(OnTime, "22:00-06:00", "Europe/Berlin"),
+			),
+			args: map[string]string{
+				"days":      "the weekdays, e.g. mon-fri, sat,sun or *",
+				"time":      "the time range in HH:MM-HH:MM, the end is exclusive",
+				"time zone": "the IANA time zone, e.g. Asia/Tokyo",
+			},
+		},
+		validate: validateTimeRange,
+		builder: func(args any) CheckFunc {
+			tr := args.(*TimeRange)
+			return func(_ http.ResponseWriter, _ *http.Request) bool {
+				return tr.Match(timeNow())
+			}
+		},
+	},
+	OnCountry: {
+		help: Help{
+			command: OnCountry,
+			description: makeLines(
+				"Matches the country of the remote ip, requires maxmind to be configured, e.g.:",
+				helpExample(OnCountry, "US"),
+			),
+			args: map[string]string{
+				"code": "the ISO 3166-1 alpha-2 country code",
+			},
+		},
+		validate: validateCountry,
+		builder: func(args any) CheckFunc {
+			code := args.(string)
+			return func(w http.ResponseWriter, r *http.Request) bool {
+				return matchCountry(w, r, code)
+			}
+		},
+	},
+	OnASN: {
+		help: Help{
+			command: OnASN,
+			description: makeLines(
+				"Matches the autonomous system of the remote ip, requires maxmind with asn enabled, e.g.:",
+				helpExample(OnASN, "AS13335"),
+				helpExample(OnASN, "15169"),
+			),
+			args: map[string]string{
+				"asn": "the autonomous system number",
+			},
+		},
+		validate: validateASN,
+		builder: func(args any) CheckFunc {
+			asn := args.(uint)
+			return func(w http.ResponseWriter, r *http.Request) bool {
+				return matchASN(w, r, asn)
+			}
+		},
+	},
+	OnCity: {
+		help: Help{
+			command: OnCity,
+			description: makeLines(
+				"Matches the English city name of the remote ip, requires maxmind with city enabled.",
+				"Supports string, glob pattern, or regex pattern, e.g.:",
+				helpExample(OnCity, "Tokyo"),
+				helpExample(OnCity, helpFuncCall("glob", "San *")),
+				helpExample(OnCity, helpFuncCall("regex", "^(Berlin|Munich)$")),
+			),
+			args: map[string]string{
+				"city": "the city name",
+			},
+		},
+		validate: validateSingleMatcher,
+		builder: func(args any) CheckFunc {
+			matcher := args.(Matcher)
+			return func(w http.ResponseWriter, r *http.Request) bool {
+				return matchCity(w, r, matcher)
+			}
+		},
+	},
+	OnKV: {
+		help: Help{
+			command: OnKV,
+			description: makeLines(
+				"Matches a value in the key-value store set by set_kv or incr, e.g.:",
+				helpExample(OnKV, "token:$arg(token)"),
+				helpExample(OnKV, "global:maintenance", "on"),
+				helpExample(OnKV, "auth_fail:$remote_host", ">=5"),
+				"Supports string, glob pattern, regex pattern, or number comparison (>=, <=, ==, !=, >, <).",
+			),
+			args: map[string]string{
+				"key":     "the key, supports variables",
+				"[value]": "the value to match, matches if the key exists when omitted",
+			},
+		},
+		validate: validateKVMatcher,
+		builder: func(args any) CheckFunc {
+			return args.(*kvMatcher).Check
+		},
+	},
 	OnBasicAuth: {
 		help: Help{
 			command: OnBasicAuth,
@@ -570,6 +697,16 @@ func splitPipe(s string) []string {
 func (on *RuleOn) Parse(v string) error {
 	on.raw = v
 
+	if src, ok := cutExprPrefix(v); ok {
+		checker, isResponseChecker, err := parseExpr(src)
+		if err != nil {
+			return err.Subject(OnExpr)
+		}
+		on.checker = checker
+		on.isResponseChecker = isResponseChecker
+		return nil
+	}
+
 	rules := splitAnd(v)
 	checkAnd := make(CheckMatchAll, 0, len(rules))
 
@@ -0,0 +1,88 @@
+package rules
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yusing/godoxy/internal/maxmind"
+	gperr "github.com/yusing/goutils/errs"
+	httputils "github.com/yusing/goutils/http"
+)
+
+// remoteIPInfo returns the remote IP of the request for maxmind lookups, nil if unknown.
+func remoteIPInfo(w http.ResponseWriter, r *http.Request) *maxmind.IPInfo {
+	ip := httputils.GetSharedData(w).GetRemoteIP(r)
+	if ip == nil {
+		return nil
+	}
+	return &maxmind.IPInfo{IP: ip, Str: ip.String()}
+}
+
+// validateCountry returns the upper-cased ISO 3166-1 alpha-2 country code.
+func validateCountry(args []string) (any, gperr.Error) {
+	if len(args) != 1 {
+		return nil, ErrExpectOneArg
+	}
+	code := args[0]
+	if len(code) != 2 || !isASCIILetter(code[0]) || !isASCIILetter(code[1]) {
+		return nil, ErrInvalidArguments.Withf("country code %q, expect ISO 3166-1 alpha-2 code like US", code)
+	}
+	return strings.ToUpper(code), nil
+}
+
+// validateASN returns the autonomous system number from "13335" or "AS13335".
+func validateASN(args []string) (any, gperr.Error) {
+	if len(args) != 1 {
+		return nil, ErrExpectOneArg
+	}
+	s := args[0]
+	if len(s) > 2 && strings.EqualFold(s[:2], "AS") {
+		s = s[2:]
+	}
+	asn, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return nil, ErrInvalidArguments.Withf("asn %q, expect a number like 13335 or AS13335", args[0])
+	}
+	return uint(asn), nil
+}
+
+func matchCountry(w http.ResponseWriter, r *http.Request, code string) bool {
+	info := remoteIPInfo(w, r)
+	if info == nil {
+		return false
+	}
+	city, ok := maxmind.LookupCity(info)
+	if !ok {
+		return false
+	}
+	return city.Country.IsoCode == code
+}
+
+func matchASN(w http.ResponseWriter, r *http.Request, asn uint) bool {
+	info := remoteIPInfo(w, r)
+	if info == nil {
+		return false
+	}
+	as, ok := maxmind.LookupASN(info)
+	if !ok {
+		return false
+	}
+	return as.Number == asn
+}
+
+func matchCity(w http.ResponseWriter, r *http.Request, matcher Matcher) bool {
+	info := remoteIPInfo(w, r)
+	if info == nil {
+		return false
+	}
+	city, ok := maxmind.LookupCity(info)
+	if !ok || city.Name() == "" {
+		return false
+	}
+	return matcher(city.Name())
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -238,6 +238,88 @@ func TestParseOn(t *testing.T) {
 			input:   "remote",
 			wantErr: ErrExpectOneArg,
 		},
+		{
+			name:    "remote_list_missing_file",
+			input:   "remote file(non-existent-list.txt)",
+			wantErr: ErrInvalidArguments,
+		},
+		{
+			name:    "remote_list_absolute_file",
+			input:   "remote file(/etc/hosts)",
+			wantErr: ErrInvalidArguments,
+		},
+		{
+			name:    "remote_list_file_outside_dir",
+			input:   "remote file(../config.yml)",
+			wantErr: ErrInvalidArguments,
+		},
+		{
+			name:    "remote_list_url_not_allowed",
+			input:   "remote url(https://example.com/ips.txt)",
+			wantErr: ErrIPListNotAllowed,
+		},
+		// time
+		{
+			name:    "time_valid",
+			input:   "time mon-fri 09:00-18:00 Europe/Berlin",
+			wantErr: nil,
+		},
+		{
+			name:    "time_valid_any_order",
+			input:   "time UTC 22:00-06:00 sat,sun",
+			wantErr: nil,
+		},
+		{
+			name:    "time_invalid_time",
+			input:   "time 9am-5pm",
+			wantErr: ErrInvalidArguments,
+		},
+		{
+			name:    "time_invalid_zone",
+			input:   "time mon Mars/Olympus",
+			wantErr: ErrInvalidArguments,
+		},
+		{
+			name:    "time_duplicated_days",
+			input:   "time mon tue",
+			wantErr: ErrInvalidArguments,
+		},
+		{
+			name:    "time_missing_arg",
+			input:   "time",
+			wantErr: ErrInvalidArguments,
+		},
+		// geo
+		{
+			name:    "country_valid",
+			input:   "country us",
+			wantErr: nil,
+		},
+		{
+			name:    "country_invalid",
+			input:   "country USA",
+			wantErr: ErrInvalidArguments,
+		},
+		{
+			name:    "asn_valid",
+			input:   "asn AS13335",
+			wantErr: nil,
+		},
+		{
+			name:    "asn_invalid",
+			input:   "asn cloudflare",
+			wantErr: ErrInvalidArguments,
+		},
+		{
+			name:    "city_valid",
+			input:   "city glob(San*)",
+			wantErr: nil,
+		},
+		{
+			name:    "city_missing_arg",
+			input:   "city",
+			wantErr: ErrExpectOneArg,
+		},
 		{
 			name:    "unknown_target",
 			input:   "unknown",
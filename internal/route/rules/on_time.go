@@ -0,0 +1,153 @@
+package rules
+
+import (
+	"strings"
+	"time"
+
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// TimeRange matches the weekdays and the time of day of a time zone.
+type TimeRange struct {
+	days       [7]bool // indexed by time.Weekday
+	start, end int     // minutes of day, end is exclusive, start > end wraps around midnight
+	loc        *time.Location
+}
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// validateTimeRange returns *TimeRange from "[days] [HH:MM-HH:MM] [time zone]", in any order, e.g.
+//
+//	time mon-fri 09:00-18:00 Europe/Berlin
+//	time sat,sun
+//	time 22:00-06:00
+func validateTimeRange(args []string) (any, gperr.Error) {
+	if len(args) == 0 || len(args) > 3 {
+		return nil, ErrInvalidArguments.Withf("expect 1 to 3 args")
+	}
+	tr := &TimeRange{end: 24 * 60, loc: time.Local}
+	hasDays, hasTime, hasLoc := false, false, false
+	for _, arg := range args {
+		switch {
+		case strings.Contains(arg, ":"):
+			if hasTime {
+				return nil, ErrInvalidArguments.Withf("duplicated time range %q", arg)
+			}
+			start, end, err := parseTimeOfDayRange(arg)
+			if err != nil {
+				return nil, err
+			}
+			tr.start, tr.end, hasTime = start, end, true
+		case isWeekdays(arg):
+			if hasDays {
+				return nil, ErrInvalidArguments.Withf("duplicated weekdays %q", arg)
+			}
+			days, err := parseWeekdays(arg)
+			if err != nil {
+				return nil, err
+			}
+			tr.days, hasDays = days, true
+		default:
+			if hasLoc {
+				return nil, ErrInvalidArguments.Withf("duplicated time zone %q", arg)
+			}
+			loc, err := time.LoadLocation(arg)
+			if err != nil {
+				return nil, ErrInvalidArguments.With(err).Subject(arg)
+			}
+			tr.loc, hasLoc = loc, true
+		}
+	}
+	if !hasDays {
+		tr.days = [7]bool{true, true, true, true, true, true, true}
+	}
+	return tr, nil
+}
+
+func (tr *TimeRange) Match(t time.Time) bool {
+	t = t.In(tr.loc)
+	if !tr.days[t.Weekday()] {
+		return false
+	}
+	m := t.Hour()*60 + t.Minute()
+	if tr.start <= tr.end {
+		return m >= tr.start && m < tr.end
+	}
+	return m >= tr.start || m < tr.end
+}
+
+// parseTimeOfDayRange parses "HH:MM-HH:MM", the end may be 24:00.
+func parseTimeOfDayRange(s string) (start, end int, err gperr.Error) {
+	startStr, endStr, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, ErrInvalidArguments.Withf("time range %q, expect HH:MM-HH:MM", s)
+	}
+	if start, err = parseTimeOfDay(startStr); err != nil {
+		return 0, 0, err
+	}
+	if endStr == "24:00" {
+		return start, 24 * 60, nil
+	}
+	if end, err = parseTimeOfDay(endStr); err != nil {
+		return 0, 0, err
+	}
+	if start == end {
+		return 0, 0, ErrInvalidArguments.Withf("empty time range %q", s)
+	}
+	return start, end, nil
+}
+
+func parseTimeOfDay(s string) (int, gperr.Error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, ErrInvalidArguments.Withf("time %q, expect HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func isWeekdays(s string) bool {
+	if s == "*" {
+		return true
+	}
+	day, _, _ := strings.Cut(s, ",")
+	day, _, _ = strings.Cut(day, "-")
+	return weekdayIndex(day) != -1
+}
+
+// parseWeekdays parses "*" or a list of days and day ranges, e.g. "mon-fri", "sat,sun" or "fri-mon".
+func parseWeekdays(s string) (days [7]bool, err gperr.Error) {
+	if s == "*" {
+		return [7]bool{true, true, true, true, true, true, true}, nil
+	}
+	for part := range strings.SplitSeq(s, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		i, j := weekdayIndex(first), weekdayIndex(last)
+		if !isRange {
+			j = i
+		}
+		if i == -1 || j == -1 {
+			return days, ErrInvalidArguments.Withf("weekdays %q, expect e.g. mon-fri or sat,sun", s)
+		}
+		for d := i; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == j {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// weekdayIndex returns the time.Weekday of a day name like "mon" or "Monday", -1 if invalid.
+func weekdayIndex(s string) int {
+	s = strings.ToLower(s)
+	if len(s) < 3 {
+		return -1
+	}
+	for i, day := range weekdays {
+		if strings.HasPrefix(s, day) && strings.HasPrefix(strings.ToLower(time.Weekday(i).String()), s) {
+			return i
+		}
+	}
+	return -1
+}
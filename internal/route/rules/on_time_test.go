@@ -0,0 +1,61 @@
+package rules
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	expect "github.com/yusing/goutils/testing"
+)
+
+func TestOnTime(t *testing.T) {
+	defer func(now func() time.Time) { timeNow = now }(timeNow)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	// 2026-10-19 is a Monday
+	tests := []struct {
+		on   string
+		at   string
+		want bool
+	}{
+		{"time mon-fri 09:00-18:00 UTC", "2026-10-19T09:00:00Z", true},
+		{"time mon-fri 09:00-18:00 UTC", "2026-10-19T17:59:59Z", true},
+		{"time mon-fri 09:00-18:00 UTC", "2026-10-19T18:00:00Z", false},
+		{"time mon-fri 09:00-18:00 UTC", "2026-10-18T12:00:00Z", false},
+		{"time mon-fri 09:00-18:00 Asia/Tokyo", "2026-10-19T00:30:00Z", true},
+		{"time mon-fri 09:00-18:00 Asia/Tokyo", "2026-10-19T09:30:00Z", false},
+		{"time sat,sun UTC", "2026-10-18T23:59:00Z", true},
+		{"time sat,sun UTC", "2026-10-19T00:00:00Z", false},
+		{"time fri-mon UTC", "2026-10-19T12:00:00Z", true},
+		{"time fri-mon UTC", "2026-10-20T12:00:00Z", false},
+		{"time UTC 22:00-06:00", "2026-10-19T23:00:00Z", true},
+		{"time UTC 22:00-06:00", "2026-10-19T05:59:00Z", true},
+		{"time UTC 22:00-06:00", "2026-10-19T06:00:00Z", false},
+		{"time 18:00-24:00 UTC *", "2026-10-19T23:59:00Z", true},
+		{"!time Monday UTC", "2026-10-19T12:00:00Z", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.on+"@"+tt.at, func(t *testing.T) {
+			var on RuleOn
+			expect.NoError(t, on.Parse(tt.on))
+			timeNow = func() time.Time {
+				return expect.Must(time.Parse(time.RFC3339, tt.at))
+			}
+			expect.Equal(t, on.Check(httptest.NewRecorder(), req), tt.want)
+		})
+	}
+}
+
+func TestParseWeekdays(t *testing.T) {
+	days, err := parseWeekdays("mon-wed,fri")
+	expect.NoError(t, err)
+	expect.Equal(t, days, [7]bool{false, true, true, true, false, true, false})
+
+	days, err = parseWeekdays("sat-mon")
+	expect.NoError(t, err)
+	expect.Equal(t, days, [7]bool{true, true, false, false, false, false, true})
+
+	_, err = parseWeekdays("mon-xyz")
+	expect.ErrorIs(t, ErrInvalidArguments, err)
+}
@@ -3,6 +3,7 @@ package rules
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"unicode"
 
 	"github.com/yusing/goutils/env"
@@ -25,6 +26,27 @@ var quoteChars = [256]bool{
 	'`':  true,
 }
 
+// QuoteArg returns s as a double quoted argument of a rule command,
+// parsing it yields s without env substitution.
+//
+// Brackets are counted by the parser even in quotes, unbalanced brackets fail to parse.
+func QuoteArg(s string) string {
+	var sb strings.Builder
+	sb.Grow(len(s) + 2)
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '\\', '"':
+			sb.WriteByte('\\')
+		case '$':
+			sb.WriteByte('$') // $$ => $
+		}
+		sb.WriteRune(r)
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
 // parse expression to subject and args
 // with support for quotes, escaped chars, and env substitution, e.g.
 //
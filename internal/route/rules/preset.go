@@ -0,0 +1,44 @@
+package rules
+
+import (
+	"github.com/yusing/godoxy/internal/serialization"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// PresetLoader returns the rules of a preset with the params applied.
+type PresetLoader func(name string, params map[string]string) (Rules, gperr.Error)
+
+var presetLoader PresetLoader
+
+// InitPresetLoader sets the loader of preset references, called by the presets package.
+func InitPresetLoader(loader PresetLoader) {
+	presetLoader = loader
+}
+
+type presetRef struct {
+	Preset string            `json:"preset" validate:"required"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// UnmarshalMap implements serialization.MapUnmarshaller for a preset reference
+// in place of the rule list, e.g.
+//
+//	rules:
+//	  preset: wordpress-hardening
+//	  params:
+//	    admin_path: /wp-admin
+func (rules *Rules) UnmarshalMap(m map[string]any) gperr.Error {
+	var ref presetRef
+	if err := serialization.MapUnmarshalValidate(m, &ref); err != nil {
+		return err
+	}
+	if presetLoader == nil {
+		return ErrPresetNotFound.Subject(ref.Preset)
+	}
+	loaded, err := presetLoader(ref.Preset, ref.Params)
+	if err != nil {
+		return err
+	}
+	*rules = loaded
+	return nil
+}
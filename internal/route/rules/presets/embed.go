@@ -2,29 +2,45 @@ package rulepresets
 
 import (
 	"embed"
-	"reflect"
+	"path"
+	"strings"
 	"sync"
 
 	"github.com/rs/zerolog/log"
 	"github.com/yusing/godoxy/internal/route/rules"
-	"github.com/yusing/godoxy/internal/serialization"
 	gperr "github.com/yusing/goutils/errs"
 )
 
 //go:embed *.yml
 var fs embed.FS
 
-var rulePresets = make(map[string]rules.Rules)
+var builtinPresets = make(map[string]*Preset)
 
 var once sync.Once
 
+func init() {
+	rules.InitPresetLoader(Load)
+}
+
+// GetRulePreset returns the rules of a built-in preset with the default params,
+// name may have the .yml extension, e.g. "webui.yml".
+//
+// User presets are not looked up, it backs embed:// rule files and the default rules of routes.
 func GetRulePreset(name string) (rules.Rules, bool) {
 	once.Do(initPresets)
-	rules, ok := rulePresets[name]
-	return rules, ok
+	preset, ok := builtinPresets[strings.TrimSuffix(strings.TrimSuffix(name, ".yml"), ".yaml")]
+	if !ok {
+		return nil, false
+	}
+	list, err := preset.Render(nil)
+	if err != nil {
+		gperr.LogError("failed to load rule preset", err)
+		return nil, false
+	}
+	return list, true
 }
 
-// init all rule presetsl lazily
+// init all built-in rule presets lazily
 func initPresets() {
 	files, err := fs.ReadDir(".")
 	if err != nil {
@@ -32,18 +48,18 @@ func initPresets() {
 		return
 	}
 	for _, file := range files {
-		var rules rules.Rules
 		content, err := fs.ReadFile(file.Name())
 		if err != nil {
 			gperr.LogError("failed to read rule preset", err)
 			continue
 		}
-		_, err = serialization.ConvertString(string(content), reflect.ValueOf(&rules))
+		name := strings.TrimSuffix(file.Name(), path.Ext(file.Name()))
+		preset, err := parsePreset(name, SourceBuiltin, content)
 		if err != nil {
-			gperr.LogError("failed to unmarshal rule preset", err)
+			gperr.LogError("failed to parse rule preset", err)
 			continue
 		}
-		rulePresets[file.Name()] = rules
-		log.Debug().Str("name", file.Name()).Msg("loaded rule preset")
+		builtinPresets[name] = preset
+		log.Debug().Str("name", name).Msg("loaded rule preset")
 	}
 }
@@ -0,0 +1,239 @@
+package rulepresets
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/goccy/go-yaml"
+	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/route/rules"
+	"github.com/yusing/godoxy/internal/serialization"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+/*
+Preset is a named rule list, optionally with params, e.g.:
+
+	description: Harden WordPress
+	params:
+	  admin_path: /wp-admin # default value
+	  allowed_cidr: # no default, required
+	rules: |
+	  - name: protect admin
+	    on: |
+	      path glob({{admin_path}}/*)
+	      !remote {{allowed_cidr}}
+	    do: error 403 Forbidden
+
+A preset without params can also be a plain rule list.
+*/
+type Preset struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Params      map[string]*string `json:"params,omitempty"` // default values, null if required
+	Source      string             `json:"source"`           // "builtin" or the file path
+
+	rules string
+} // @name RulePreset
+
+type presetFile struct {
+	Description string             `json:"description"`
+	Params      map[string]*string `json:"params"`
+	Rules       any                `json:"rules"`
+}
+
+const SourceBuiltin = "builtin"
+
+var (
+	ErrInvalidParamValue = gperr.New("invalid param value")
+	ErrPresetNameTaken   = gperr.New("preset name is taken by a built-in preset")
+)
+
+var (
+	presetExts = []string{".yml", ".yaml"}
+	// e.g. {{admin_path}} or {{ admin_path }}
+	paramRegex = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+)
+
+// Load returns the rules of a preset with the params applied.
+func Load(name string, params map[string]string) (rules.Rules, gperr.Error) {
+	preset, err := Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return preset.Render(params)
+}
+
+// Get returns a preset by name, name may have the .yml or .yaml extension.
+//
+// Built-in presets are looked up first, user presets reusing a built-in name are ignored.
+func Get(name string) (*Preset, gperr.Error) {
+	once.Do(initPresets)
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".yml"), ".yaml")
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil, rules.ErrPresetNotFound.Subject(name)
+	}
+	if preset, ok := builtinPresets[name]; ok {
+		return preset, nil
+	}
+	for _, dir := range userPresetDirs() {
+		for _, ext := range presetExts {
+			file := filepath.Join(dir, name+ext)
+			content, err := os.ReadFile(file)
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				return nil, gperr.PrependSubject(file, err)
+			}
+			return parsePreset(name, file, content)
+		}
+	}
+	return nil, rules.ErrPresetNotFound.Subject(name)
+}
+
+// List returns all presets sorted by name, user presets reusing a built-in name are logged and skipped.
+func List() []*Preset {
+	once.Do(initPresets)
+	presets := maps.Clone(builtinPresets)
+	dirs := userPresetDirs()
+	// earlier directories take precedence
+	for _, dir := range slices.Backward(dirs) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				gperr.LogError("failed to read rule presets", err)
+			}
+			continue
+		}
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			if entry.IsDir() || !slices.Contains(presetExts, ext) {
+				continue
+			}
+			name := strings.TrimSuffix(entry.Name(), ext)
+			if _, ok := builtinPresets[name]; ok {
+				gperr.LogError("failed to load rule preset", ErrPresetNameTaken.Subject(filepath.Join(dir, entry.Name())))
+				continue
+			}
+			preset, err := Get(name)
+			if err != nil {
+				gperr.LogError("failed to load rule preset", err)
+				continue
+			}
+			presets[name] = preset
+		}
+	}
+	return slices.SortedFunc(maps.Values(presets), func(a, b *Preset) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+}
+
+func userPresetDirs() []string {
+	return append([]string{common.RulePresetsBasePath}, common.RulePresetDirs...)
+}
+
+func parsePreset(name, source string, content []byte) (*Preset, gperr.Error) {
+	preset := &Preset{Name: name, Source: source}
+
+	var raw any
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil, gperr.PrependSubject(name, err)
+	}
+	if _, ok := raw.([]any); ok {
+		preset.rules = string(content)
+	} else {
+		var f presetFile
+		if err := yaml.Unmarshal(content, &f); err != nil {
+			return nil, gperr.PrependSubject(name, err)
+		}
+		ruleList, ok := f.Rules.(string)
+		if !ok {
+			return nil, gperr.New("rules must be a block string, e.g. rules: |").Subject(name)
+		}
+		preset.Description = f.Description
+		preset.Params = f.Params
+		preset.rules = ruleList
+	}
+
+	for _, match := range paramRegex.FindAllStringSubmatch(preset.rules, -1) {
+		if _, ok := preset.Params[match[1]]; !ok {
+			return nil, gperr.Errorf("undeclared param %q", match[1]).Subject(name)
+		}
+	}
+	// the default params must produce valid rules
+	if !preset.hasRequiredParams() {
+		if _, err := preset.Render(nil); err != nil {
+			return nil, err
+		}
+	}
+	return preset, nil
+}
+
+func (p *Preset) hasRequiredParams() bool {
+	for _, v := range p.Params {
+		if v == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// validateParamValue rejects characters that could break out of a placeholder,
+// as values are substituted into the rules as is: control characters like newlines
+// would start a new YAML line or rule line, quotes and backslashes would end a quoted argument.
+// The value is not included in the error as it may be a secret.
+func validateParamValue(v string) gperr.Error {
+	for _, c := range v {
+		switch {
+		case unicode.IsControl(c):
+			return ErrInvalidParamValue.Withf("control characters are not allowed")
+		case c == '"' || c == '\'' || c == '`' || c == '\\':
+			return ErrInvalidParamValue.Withf("quotes and backslashes are not allowed")
+		}
+	}
+	return nil
+}
+
+// Render returns the rules with the params applied, missing params use the default values.
+func (p *Preset) Render(params map[string]string) (rules.Rules, gperr.Error) {
+	var errs gperr.Builder
+	for k := range params {
+		if _, ok := p.Params[k]; !ok {
+			errs.Addf("unknown param %q", k)
+		}
+	}
+	values := make(map[string]string, len(p.Params))
+	for k, def := range p.Params {
+		if v, ok := params[k]; ok {
+			values[k] = v
+		} else if def != nil {
+			values[k] = *def
+		} else {
+			errs.Addf("missing required param %q", k)
+			continue
+		}
+		if err := validateParamValue(values[k]); err != nil {
+			errs.Add(err.Subjectf("param %q", k))
+		}
+	}
+	if errs.HasError() {
+		return nil, errs.Error().Subject(p.Name)
+	}
+
+	content := paramRegex.ReplaceAllStringFunc(p.rules, func(m string) string {
+		return values[paramRegex.FindStringSubmatch(m)[1]]
+	})
+	var list rules.Rules
+	if _, err := serialization.ConvertString(content, reflect.ValueOf(&list)); err != nil {
+		return nil, err.Subject(p.Name)
+	}
+	return list, nil
+}
@@ -0,0 +1,209 @@
+package rulepresets
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/route/rules"
+	expect "github.com/yusing/goutils/testing"
+)
+
+var requiredParams = map[string]map[string]string{
+	"cors":         {"origin": "https://app.example.com"},
+	"api-key-gate": {"key": "secret"},
+}
+
+func TestBuiltinPresets(t *testing.T) {
+	once.Do(initPresets)
+	files, err := fs.ReadDir(".")
+	expect.NoError(t, err)
+	expect.Equal(t, len(builtinPresets), len(files))
+
+	for name, preset := range builtinPresets {
+		t.Run(name, func(t *testing.T) {
+			expect.Equal(t, preset.Source, SourceBuiltin)
+			list, err := preset.Render(requiredParams[name])
+			expect.NoError(t, err)
+			expect.True(t, len(list) > 0)
+		})
+	}
+}
+
+func TestParsePreset(t *testing.T) {
+	t.Run("plain list", func(t *testing.T) {
+		preset, err := parsePreset("plain", SourceBuiltin, []byte("- name: block\n  on: path /admin\n  do: error 403 Forbidden\n"))
+		expect.NoError(t, err)
+		expect.Equal(t, len(preset.Params), 0)
+	})
+	t.Run("undeclared param", func(t *testing.T) {
+		_, err := parsePreset("undeclared", SourceBuiltin, []byte(`
+rules: |
+  - on: path {{path}}
+    do: error 403 Forbidden
+`))
+		expect.ErrorContains(t, err, "undeclared param")
+	})
+	t.Run("rules not a string", func(t *testing.T) {
+		_, err := parsePreset("not_string", SourceBuiltin, []byte(`
+rules:
+  - on: path /admin
+    do: error 403 Forbidden
+`))
+		expect.ErrorContains(t, err, "block string")
+	})
+	t.Run("invalid default", func(t *testing.T) {
+		_, err := parsePreset("invalid_default", SourceBuiltin, []byte(`
+params:
+  status: abc
+rules: |
+  - on: path /admin
+    do: error {{status}} Forbidden
+`))
+		expect.HasError(t, err)
+	})
+}
+
+func TestRender(t *testing.T) {
+	preset, err := parsePreset("test", SourceBuiltin, []byte(`
+params:
+  path: /admin
+  status:
+rules: |
+  - name: block {{ path }}
+    on: path {{path}}
+    do: error {{status}} Forbidden
+`))
+	expect.NoError(t, err)
+
+	list, err := preset.Render(map[string]string{"status": "404"})
+	expect.NoError(t, err)
+	expect.Equal(t, list[0].Name, "block /admin")
+
+	list, err = preset.Render(map[string]string{"path": "/wp-admin", "status": "403"})
+	expect.NoError(t, err)
+	expect.Equal(t, list[0].Name, "block /wp-admin")
+
+	_, err = preset.Render(nil)
+	expect.ErrorContains(t, err, `missing required param "status"`)
+
+	_, err = preset.Render(map[string]string{"status": "403", "foo": "bar"})
+	expect.ErrorContains(t, err, `unknown param "foo"`)
+
+	for _, path := range []string{
+		"/admin\n    do: pass",
+		"/admin\" error 200 \"ok",
+		"/admin' error 200 'ok",
+		"/admin\\",
+		"/admin\x00",
+	} {
+		_, err = preset.Render(map[string]string{"path": path, "status": "403"})
+		expect.ErrorIs(t, ErrInvalidParamValue, err)
+		expect.False(t, strings.Contains(err.Error(), "/admin"))
+	}
+}
+
+func TestUserPresets(t *testing.T) {
+	dir := t.TempDir()
+	common.RulePresetDirs = []string{dir}
+	t.Cleanup(func() { common.RulePresetDirs = nil })
+
+	err := os.WriteFile(filepath.Join(dir, "custom.yml"), []byte(`
+description: custom maintenance
+params:
+  message: down
+rules: |
+  - name: custom maintenance
+    on: path /
+    do: error 503 "{{message}}"
+`), 0o644)
+	expect.NoError(t, err)
+
+	preset, err := Get("custom")
+	expect.NoError(t, err)
+	expect.Equal(t, preset.Source, filepath.Join(dir, "custom.yml"))
+
+	list, err := Load("custom.yml", nil)
+	expect.NoError(t, err)
+	expect.Equal(t, list[0].Name, "custom maintenance")
+
+	found := false
+	for _, p := range List() {
+		if p.Name == "custom" {
+			found = true
+			expect.Equal(t, p.Description, "custom maintenance")
+		}
+	}
+	expect.True(t, found)
+
+	// embed:// only loads built-in presets
+	_, ok := GetRulePreset("custom.yml")
+	expect.False(t, ok)
+
+	_, err = Load("not-exists", nil)
+	expect.ErrorIs(t, rules.ErrPresetNotFound, err)
+
+	_, err = Load("../maintenance", nil)
+	expect.ErrorIs(t, rules.ErrPresetNotFound, err)
+}
+
+func TestUserPresetBuiltinName(t *testing.T) {
+	dir := t.TempDir()
+	common.RulePresetDirs = []string{dir}
+	t.Cleanup(func() { common.RulePresetDirs = nil })
+
+	err := os.WriteFile(filepath.Join(dir, "webui.yml"), []byte(`
+- name: allow all
+  on: path /
+  do: pass
+`), 0o644)
+	expect.NoError(t, err)
+
+	preset, err := Get("webui")
+	expect.NoError(t, err)
+	expect.Equal(t, preset.Source, SourceBuiltin)
+
+	for _, p := range List() {
+		if p.Name == "webui" {
+			expect.Equal(t, p.Source, SourceBuiltin)
+		}
+	}
+
+	list, ok := GetRulePreset("webui.yml")
+	expect.True(t, ok)
+	expect.Equal(t, len(list), len(expect.Must(builtinPresets["webui"].Render(nil))))
+}
+
+func TestPresetReference(t *testing.T) {
+	var list rules.Rules
+	err := list.UnmarshalMap(map[string]any{
+		"preset": "api-key-gate",
+		"params": map[string]any{"key": "secret"},
+	})
+	expect.NoError(t, err)
+	expect.Equal(t, list[0].Name, "api key gate")
+
+	err = list.UnmarshalMap(map[string]any{"preset": "api-key-gate"})
+	expect.ErrorContains(t, err, `missing required param "key"`)
+}
+
+func TestCORSPreflight(t *testing.T) {
+	list, err := Load("cors", requiredParams["cors"])
+	expect.NoError(t, err)
+	handler := list.BuildHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodOptions, "/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+	handler(w, req)
+	expect.Equal(t, w.Code, http.StatusNoContent)
+	expect.Equal(t, w.Body.Len(), 0)
+	expect.Equal(t, w.Header().Get("Access-Control-Allow-Origin"), "https://app.example.com")
+}
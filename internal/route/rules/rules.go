@@ -1,6 +1,7 @@
 package rules
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -114,6 +115,7 @@ func (rules Rules) BuildHandler(up http.HandlerFunc) http.HandlerFunc {
 				}()
 				w = rm
 				up(w, r)
+				traceMatch(r, &defaultRule)
 				err := defaultRule.Do.exec.Handle(w, r)
 				if err != nil && !errors.Is(err, errTerminated) {
 					appendRuleError(rm, &defaultRule, err)
@@ -128,6 +130,7 @@ func (rules Rules) BuildHandler(up http.HandlerFunc) http.HandlerFunc {
 				}
 			}()
 			w = rm
+			traceMatch(r, &defaultRule)
 			err := defaultRule.Do.exec.Handle(w, r)
 			if err == nil {
 				up(w, r)
@@ -169,6 +172,7 @@ func (rules Rules) BuildHandler(up http.HandlerFunc) http.HandlerFunc {
 			if defaultRule.Do.isBypass() {
 				// continue to upstream
 			} else {
+				traceMatch(r, &defaultRule)
 				err := defaultRule.Handle(w, r)
 				if err != nil {
 					if !errors.Is(err, errTerminated) {
@@ -182,6 +186,7 @@ func (rules Rules) BuildHandler(up http.HandlerFunc) http.HandlerFunc {
 		if shouldCallUpstream {
 			for _, rule := range preRules {
 				if rule.Check(w, r) {
+					traceMatch(r, &rule)
 					preMatched = true
 					if rule.Do.isBypass() {
 						break // post rules should still execute
@@ -202,6 +207,7 @@ func (rules Rules) BuildHandler(up http.HandlerFunc) http.HandlerFunc {
 			if defaultRule.Do.isBypass() {
 				// continue to upstream
 			} else {
+				traceMatch(r, &defaultRule)
 				err := defaultRule.Handle(w, r)
 				if err != nil {
 					if !errors.Is(err, errTerminated) {
@@ -224,6 +230,7 @@ func (rules Rules) BuildHandler(up http.HandlerFunc) http.HandlerFunc {
 
 		for _, rule := range postRules {
 			if rule.Check(w, r) {
+				traceMatch(r, &rule)
 				err := rule.Handle(w, r)
 				if err != nil {
 					if !errors.Is(err, errTerminated) {
@@ -235,6 +242,7 @@ func (rules Rules) BuildHandler(up http.HandlerFunc) http.HandlerFunc {
 		}
 
 		if isDefaultRulePost {
+			traceMatch(r, &defaultRule)
 			err := defaultRule.Handle(w, r)
 			if err != nil && !errors.Is(err, errTerminated) {
 				appendRuleError(rm, &defaultRule, err)
@@ -243,6 +251,20 @@ func (rules Rules) BuildHandler(up http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+type matchTracerKey struct{}
+
+// WithMatchTracer returns a shallow copy of r that reports the names of
+// the rules matched while handling it to trace, e.g. for rule tests.
+func WithMatchTracer(r *http.Request, trace func(name string)) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), matchTracerKey{}, trace))
+}
+
+func traceMatch(r *http.Request, rule *Rule) {
+	if trace, ok := r.Context().Value(matchTracerKey{}).(func(string)); ok {
+		trace(rule.Name)
+	}
+}
+
 func appendRuleError(rm *httputils.ResponseModifier, rule *Rule, err error) {
 	// rm.AppendError("rule: %s, error: %w", rule.Name, err)
 }
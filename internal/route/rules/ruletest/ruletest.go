@@ -0,0 +1,265 @@
+// Package ruletest runs test cases of route rules against mock requests,
+// like the rule playground but from a YAML file, e.g. in CI before deployment.
+package ruletest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/yusing/godoxy/internal/route/rules"
+	rulepresets "github.com/yusing/godoxy/internal/route/rules/presets"
+	"github.com/yusing/godoxy/internal/serialization"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+type (
+	/*
+		File is a rule test file, e.g. rules.test.yml next to rules.yml:
+
+			rule_file: rules.yml
+			cases:
+				- name: block admin from outside
+					request:
+						path: /admin
+						remote_ip: 1.2.3.4
+					expect:
+						status: 403
+						matched: [block admin]
+						upstream_called: false
+	*/
+	File struct {
+		// RuleFile is the rule file to test, relative to the test file,
+		// or embed://<preset>. Default is the test file name without ".test".
+		RuleFile string      `json:"rule_file,omitempty"`
+		Rules    rules.Rules `json:"rules,omitempty"`
+		Cases    []Case      `json:"cases" validate:"required,min=1"`
+	}
+	Case struct {
+		Name     string   `json:"name" validate:"required"`
+		Request  Request  `json:"request"`
+		Upstream Response `json:"upstream"` // the response of the mock upstream
+		Expect   Expect   `json:"expect"`
+	}
+	Request struct {
+		Method   string            `json:"method,omitempty"`
+		Path     string            `json:"path,omitempty"`
+		Host     string            `json:"host,omitempty"`
+		Headers  map[string]string `json:"headers,omitempty"`
+		Query    map[string]string `json:"query,omitempty"`
+		Cookies  map[string]string `json:"cookies,omitempty"`
+		Body     string            `json:"body,omitempty"`
+		RemoteIP string            `json:"remote_ip,omitempty"`
+	}
+	Response struct {
+		Status  int               `json:"status,omitempty"`
+		Headers map[string]string `json:"headers,omitempty"`
+		Body    string            `json:"body,omitempty"`
+	}
+	// Expect is the expected result of a case, unset fields are not checked.
+	Expect struct {
+		Status int `json:"status,omitempty"`
+		// Headers are the expected response headers, an empty value expects the header to be absent.
+		Headers        map[string]string `json:"headers,omitempty"`
+		Body           *string           `json:"body,omitempty"`
+		Matched        *[]string         `json:"matched,omitempty"` // names of the matched rules in order
+		UpstreamCalled *bool             `json:"upstream_called,omitempty"`
+	}
+	Result struct {
+		Name     string   `json:"name"`
+		Failures []string `json:"failures,omitempty"`
+	}
+)
+
+const (
+	embedScheme = "embed://"
+	testSuffix  = ".test"
+)
+
+// Passed reports whether all expectations of the case are met.
+func (r *Result) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// Load loads a test file and its rules, a relative rule_file is resolved against the directory of the test file.
+func Load(path string) (*File, gperr.Error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, gperr.Wrap(err)
+	}
+	ext := filepath.Ext(path)
+	defaultRuleFile := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ext), testSuffix) + ext
+	return Parse(data, filepath.Dir(path), defaultRuleFile)
+}
+
+// Parse parses a test file, dir is the directory to resolve a relative rule_file against,
+// defaultRuleFile is used when neither rule_file nor rules are set, empty to require one of them.
+func Parse(data []byte, dir, defaultRuleFile string) (*File, gperr.Error) {
+	var f File
+	if err := serialization.UnmarshalValidate(data, &f, yaml.Unmarshal); err != nil {
+		return nil, err
+	}
+	if f.RuleFile != "" && len(f.Rules) > 0 {
+		return nil, gperr.New("`rule_file` and `rules` cannot be used together")
+	}
+	if f.RuleFile == "" && len(f.Rules) == 0 {
+		if defaultRuleFile == "" {
+			return nil, gperr.New("`rule_file` or `rules` is required")
+		}
+		f.RuleFile = defaultRuleFile
+	}
+	if f.RuleFile != "" {
+		list, err := loadRules(f.RuleFile, dir)
+		if err != nil {
+			return nil, gperr.PrependSubject(f.RuleFile, err)
+		}
+		f.Rules = list
+	}
+	return &f, nil
+}
+
+func loadRules(ruleFile, dir string) (rules.Rules, gperr.Error) {
+	if name, ok := strings.CutPrefix(ruleFile, embedScheme); ok {
+		preset, ok := rulepresets.GetRulePreset(name)
+		if !ok {
+			return nil, gperr.New("rule preset not found")
+		}
+		return preset, nil
+	}
+	if !filepath.IsAbs(ruleFile) {
+		ruleFile = filepath.Join(dir, ruleFile)
+	}
+	content, err := os.ReadFile(ruleFile)
+	if err != nil {
+		return nil, gperr.Wrap(err)
+	}
+	var list rules.Rules
+	if _, err := serialization.ConvertString(string(content), reflect.ValueOf(&list)); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Run runs all cases and returns the results in order.
+func (f *File) Run() []Result {
+	results := make([]Result, len(f.Cases))
+	for i, c := range f.Cases {
+		results[i] = f.runCase(&c)
+	}
+	return results
+}
+
+// Validate parses a test file and runs its cases, the failed cases are returned as errors.
+func Validate(data []byte, dir string) gperr.Error {
+	f, err := Parse(data, dir, "")
+	if err != nil {
+		return err
+	}
+	errs := gperr.NewBuilder("rule test failures")
+	for _, result := range f.Run() {
+		if !result.Passed() {
+			errs.Addf("%s: %s", result.Name, strings.Join(result.Failures, "; "))
+		}
+	}
+	return errs.Error()
+}
+
+func (f *File) runCase(c *Case) Result {
+	result := Result{Name: c.Name}
+
+	upstreamCalled := false
+	handler := f.Rules.BuildHandler(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalled = true
+		for k, v := range c.Upstream.Headers {
+			w.Header().Set(k, v)
+		}
+		if c.Upstream.Status != 0 {
+			w.WriteHeader(c.Upstream.Status)
+		}
+		_, _ = io.WriteString(w, c.Upstream.Body)
+	})
+
+	matched := []string{}
+	req := rules.WithMatchTracer(newRequest(&c.Request), func(name string) {
+		matched = append(matched, name)
+	})
+	w := httptest.NewRecorder()
+	func() {
+		defer func() {
+			if err := recover(); err != nil {
+				result.Failures = append(result.Failures, fmt.Sprintf("panic: %v", err))
+			}
+		}()
+		handler(w, req)
+	}()
+
+	fail := func(format string, args ...any) {
+		result.Failures = append(result.Failures, fmt.Sprintf(format, args...))
+	}
+	if c.Expect.Status != 0 && w.Code != c.Expect.Status {
+		fail("status: expected %d, got %d", c.Expect.Status, w.Code)
+	}
+	for k, want := range c.Expect.Headers {
+		if got := w.Header().Get(k); got != want {
+			fail("header %s: expected %q, got %q", k, want, got)
+		}
+	}
+	if c.Expect.Body != nil && w.Body.String() != *c.Expect.Body {
+		fail("body: expected %q, got %q", *c.Expect.Body, w.Body.String())
+	}
+	if c.Expect.Matched != nil && !slices.Equal(matched, *c.Expect.Matched) {
+		fail("matched rules: expected %v, got %v", *c.Expect.Matched, matched)
+	}
+	if c.Expect.UpstreamCalled != nil && upstreamCalled != *c.Expect.UpstreamCalled {
+		fail("upstream called: expected %t, got %t", *c.Expect.UpstreamCalled, upstreamCalled)
+	}
+	return result
+}
+
+func newRequest(mock *Request) *http.Request {
+	method := mock.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	target := mock.Path
+	if target == "" {
+		target = "/"
+	}
+	if len(mock.Query) > 0 {
+		query := make(url.Values, len(mock.Query))
+		for k, v := range mock.Query {
+			query.Set(k, v)
+		}
+		target += "?" + query.Encode()
+	}
+	var body io.Reader
+	if mock.Body != "" {
+		body = strings.NewReader(mock.Body)
+	}
+
+	req := httptest.NewRequest(method, target, body)
+	req.Host = mock.Host
+	if req.Host == "" {
+		req.Host = "localhost"
+	}
+	for k, v := range mock.Headers {
+		req.Header.Set(k, v)
+	}
+	for name, value := range mock.Cookies {
+		req.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+	if mock.RemoteIP != "" {
+		req.RemoteAddr = mock.RemoteIP + ":0"
+	} else {
+		req.RemoteAddr = "127.0.0.1:0"
+	}
+	return req
+}
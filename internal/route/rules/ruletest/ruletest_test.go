@@ -0,0 +1,95 @@
+package ruletest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	expect "github.com/yusing/goutils/testing"
+)
+
+const testRules = `
+- name: block admin
+  on: |
+    path glob(/admin/*)
+    !remote 10.0.0.0/8
+  do: error 403 Forbidden
+- name: add header
+  on: resp_header Content-Type application/json
+  do: set resp_header X-API true
+`
+
+const testCases = `
+cases:
+  - name: block admin from outside
+    request:
+      path: /admin/users
+      remote_ip: 1.2.3.4
+    expect:
+      status: 403
+      matched: [block admin]
+      upstream_called: false
+  - name: allow admin from inside
+    request:
+      path: /admin/users
+      remote_ip: 10.0.0.1
+    upstream:
+      body: ok
+    expect:
+      status: 200
+      body: ok
+      matched: []
+      upstream_called: true
+  - name: json response
+    upstream:
+      headers:
+        Content-Type: application/json
+    expect:
+      headers:
+        X-API: "true"
+      matched: [add header]
+`
+
+const failingCase = `
+  - name: wrong expectations
+    expect:
+      status: 404
+      headers:
+        X-API: "true"
+      upstream_called: false
+`
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	expect.NoError(t, os.WriteFile(filepath.Join(dir, "rules.yml"), []byte(testRules), 0o644))
+	expect.NoError(t, os.WriteFile(filepath.Join(dir, "rules.test.yml"), []byte(testCases+failingCase), 0o644))
+
+	f, err := Load(filepath.Join(dir, "rules.test.yml"))
+	expect.NoError(t, err)
+	expect.Equal(t, len(f.Rules), 2)
+
+	results := f.Run()
+	expect.Equal(t, len(results), 4)
+	for _, result := range results[:3] {
+		expect.True(t, result.Passed(), result.Name, result.Failures)
+	}
+	expect.False(t, results[3].Passed())
+	expect.Equal(t, results[3].Failures, []string{
+		"status: expected 404, got 200",
+		`header X-API: expected "true", got ""`,
+		"upstream called: expected false, got true",
+	})
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	expect.NoError(t, os.WriteFile(filepath.Join(dir, "rules.yml"), []byte(testRules), 0o644))
+
+	expect.NoError(t, Validate([]byte("rule_file: rules.yml\n"+testCases), dir))
+	expect.HasError(t, Validate([]byte("rule_file: rules.yml\n"+testCases+failingCase), dir))
+
+	// rule_file or rules is required without a default
+	expect.HasError(t, Validate([]byte(testCases), dir))
+	expect.HasError(t, Validate([]byte("rule_file: missing.yml\n"+testCases), dir))
+	expect.HasError(t, Validate([]byte("rule_file: rules.yml\ncases: []\n"), dir))
+}
@@ -115,6 +115,17 @@ func validateURL(args []string) (any, gperr.Error) {
 	return u, nil
 }
 
+// validateRemote returns *ipList for "file(<path>)" or "url(<url>)", otherwise *net.IPNet.
+func validateRemote(args []string) (any, gperr.Error) {
+	if len(args) != 1 {
+		return nil, ErrExpectOneArg
+	}
+	if source, isURL, ok := cutIPListSource(args[0]); ok {
+		return loadIPList(source, isURL)
+	}
+	return validateCIDR(args)
+}
+
 // validateCIDR returns types.CIDR with the CIDR validated.
 func validateCIDR(args []string) (any, gperr.Error) {
 	if len(args) != 1 {
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 
 	httputils "github.com/yusing/goutils/http"
 )
@@ -14,6 +15,7 @@ var (
 	VarQuery          = "arg"
 	VarForm           = "form"
 	VarPostForm       = "postform"
+	VarPathSegment    = "path_segment"
 )
 
 type dynamicVarGetter func(args []string, w *httputils.ResponseModifier, req *http.Request) (string, error)
@@ -64,6 +66,31 @@ var dynamicVarSubsMap = map[string]dynamicVarGetter{
 		}
 		return getValueByKeyAtIndex(req.PostForm, key, index)
 	},
+	VarPathSegment: func(args []string, w *httputils.ResponseModifier, req *http.Request) (string, error) {
+		if len(args) != 1 {
+			return "", ErrExpectOneArg
+		}
+		index, err := strconv.Atoi(args[0])
+		if err != nil || index < 0 {
+			return "", ErrInvalidArguments.Withf("invalid index %q", args[0])
+		}
+		return getPathSegment(req.URL.Path, index), nil
+	},
+}
+
+// getPathSegment returns the segment of the path at index, e.g. "users" at 0 for "/users/1",
+// empty if out of range.
+func getPathSegment(path string, index int) string {
+	path = strings.TrimPrefix(path, "/")
+	for i := 0; i < index; i++ {
+		_, rest, ok := strings.Cut(path, "/")
+		if !ok {
+			return ""
+		}
+		path = rest
+	}
+	segment, _, _ := strings.Cut(path, "/")
+	return segment
 }
 
 func getValueByKeyAtIndex[Values http.Header | url.Values](values Values, key string, index int) (string, error) {
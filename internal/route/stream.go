@@ -118,7 +118,11 @@ func (r *StreamRoute) initStream() (nettypes.Stream, error) {
 	case "tcp":
 		return stream.NewTCPTCPStream(lurl.Scheme, rurl.Scheme, laddr, rurl.Host, r.GetAgent())
 	case "udp":
-		return stream.NewUDPUDPStream(lurl.Scheme, rurl.Scheme, laddr, rurl.Host, r.GetAgent())
+		maxPending := 0
+		if r.UseIdleWatcher() {
+			maxPending = r.IdlewatcherConfig().PendingPackets
+		}
+		return stream.NewUDPUDPStream(lurl.Scheme, rurl.Scheme, laddr, rurl.Host, r.GetAgent(), maxPending)
 	}
 	return nil, fmt.Errorf("unknown scheme: %s", rurl.Scheme)
 }
@@ -122,6 +122,9 @@ func (s *TCPTCPStream) listen(ctx context.Context) {
 func (s *TCPTCPStream) handle(ctx context.Context, conn net.Conn) {
 	defer conn.Close()
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	if s.preDial != nil {
 		if err := s.preDial(ctx); err != nil {
 			if !s.closed.Load() {
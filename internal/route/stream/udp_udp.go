@@ -33,7 +33,11 @@ type UDPUDPStream struct {
 
 	cleanUpTicker *time.Ticker
 
-	conns  map[string]*udpUDPConn
+	conns map[string]*udpUDPConn
+	// datagrams of sources whose connection is being created, forwarded once it is created
+	pending    map[string][][]byte
+	maxPending int
+
 	closed atomic.Bool
 	mu     sync.Mutex
 }
@@ -52,11 +56,15 @@ const (
 	udpIdleTimeout     = 5 * time.Minute // Longer timeout for game sessions
 	udpCleanupInterval = 1 * time.Minute
 	udpReadTimeout     = 30 * time.Second
+	// udpMaxPendingPackets is the default number of datagrams buffered per source while its connection is being created
+	udpMaxPendingPackets = 16
 )
 
 var bufPool = synk.GetSizedBytesPool()
 
-func NewUDPUDPStream(network, dstNetwork, listenAddr, dstAddr string, agent *agentpool.Agent) (nettypes.Stream, error) {
+// NewUDPUDPStream creates a UDP stream that buffers up to maxPending datagrams per source
+// while preDial blocks, e.g. while a container wakes. Zero uses the default.
+func NewUDPUDPStream(network, dstNetwork, listenAddr, dstAddr string, agent *agentpool.Agent, maxPending int) (nettypes.Stream, error) {
 	dst, err := net.ResolveUDPAddr(dstNetwork, dstAddr)
 	if err != nil {
 		return nil, err
@@ -65,6 +73,9 @@ func NewUDPUDPStream(network, dstNetwork, listenAddr, dstAddr string, agent *age
 	if err != nil {
 		return nil, err
 	}
+	if maxPending <= 0 {
+		maxPending = udpMaxPendingPackets
+	}
 	return &UDPUDPStream{
 		network:    network,
 		dstNetwork: dstNetwork,
@@ -72,6 +83,8 @@ func NewUDPUDPStream(network, dstNetwork, listenAddr, dstAddr string, agent *age
 		dst:        dst,
 		agent:      agent,
 		conns:      make(map[string]*udpUDPConn),
+		pending:    make(map[string][][]byte),
+		maxPending: maxPending,
 	}, nil
 }
 
@@ -177,19 +190,49 @@ func (s *UDPUDPStream) getOrCreateConnection(ctx context.Context, srcAddr *net.U
 		go conn.forwardToDestination(initialData)
 		return
 	}
+	if pending, ok := s.pending[key]; ok {
+		// connection is being created, e.g. pre-dial is waiting for a container to wake
+		if len(pending) < s.maxPending {
+			s.pending[key] = append(pending, initialData)
+		} else {
+			logDebugf(s, "dropped datagram from %s, too many pending datagrams", key)
+		}
+		s.mu.Unlock()
+		return
+	}
+	s.pending[key] = nil
+	s.mu.Unlock()
 
-	defer s.mu.Unlock()
-	// Create new connection with initial data
+	// Create new connection with initial data, without holding the lock as pre-dial may block
 	conn, ok := s.createConnection(ctx, srcAddr, initialData)
-	if ok && !conn.closed.Load() {
-		s.conns[key] = conn
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := s.pending[key]
+	delete(s.pending, key)
+	if !ok || conn.closed.Load() {
+		return
+	}
+	if s.closed.Load() {
+		conn.Close()
+		return
+	}
+	s.conns[key] = conn
+	for _, data := range pending {
+		if !conn.forwardToDestination(data) {
+			return
+		}
 	}
 }
 
 func (s *UDPUDPStream) createConnection(ctx context.Context, srcAddr *net.UDPAddr, initialData []byte) (*udpUDPConn, bool) {
+	// canceled when the connection is closed
+	ctx, cancel := context.WithCancel(ctx)
+
 	// Apply pre-dial if configured
 	if s.preDial != nil {
 		if err := s.preDial(ctx); err != nil {
+			cancel()
 			logErr(s, err, "failed to pre-dial")
 			return nil, false
 		}
@@ -206,6 +249,7 @@ func (s *UDPUDPStream) createConnection(ctx context.Context, srcAddr *net.UDPAdd
 		dstConn, err = net.DialUDP(s.dst.Network(), nil, s.dst)
 	}
 	if err != nil {
+		cancel()
 		logErr(s, err, "failed to dial dst")
 		return nil, false
 	}
@@ -219,12 +263,16 @@ func (s *UDPUDPStream) createConnection(ctx context.Context, srcAddr *net.UDPAdd
 
 	// Send initial data before starting response handler
 	if !conn.forwardToDestination(initialData) {
+		cancel()
 		_ = dstConn.Close()
 		return nil, false
 	}
 
 	// Start response handler after initial data is sent
-	go conn.handleResponses(ctx)
+	go func() {
+		defer cancel()
+		conn.handleResponses(ctx)
+	}()
 
 	logDebugf(s, "created new connection from %s", srcAddr.String())
 	return conn, true
@@ -0,0 +1,148 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	expect "github.com/yusing/goutils/testing"
+)
+
+// newTestUDPServer returns the address of a UDP server and the datagrams it receives.
+func newTestUDPServer(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	expect.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	received := make(chan string, 64)
+	go func() {
+		buf := make([]byte, udpBufferSize)
+		for {
+			n, _, err := l.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			received <- string(buf[:n])
+		}
+	}()
+	return l.LocalAddr().String(), received
+}
+
+// startTestUDPStream starts a stream to dst whose pre-dial blocks until release is closed and then returns preDialErr.
+func startTestUDPStream(t *testing.T, dst string, maxPending int, preDial func(ctx context.Context) error) *net.UDPConn {
+	t.Helper()
+	s, err := NewUDPUDPStream("udp", "udp", "127.0.0.1:0", dst, nil, maxPending)
+	expect.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	s.ListenAndServe(ctx, preDial, nil)
+	t.Cleanup(func() {
+		cancel()
+		s.Close()
+	})
+
+	client, err := net.DialUDP("udp", nil, s.LocalAddr().(*net.UDPAddr))
+	expect.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func sendDatagrams(t *testing.T, client *net.UDPConn, datagrams ...string) {
+	t.Helper()
+	for _, d := range datagrams {
+		_, err := client.Write([]byte(d))
+		expect.NoError(t, err)
+		// each datagram is handled by its own goroutine, keep them ordered
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func receiveDatagrams(t *testing.T, received <-chan string) []string {
+	t.Helper()
+	var got []string
+	for {
+		select {
+		case d := <-received:
+			got = append(got, d)
+		case <-time.After(200 * time.Millisecond):
+			return got
+		}
+	}
+}
+
+// blockingPreDial blocks until release is closed, then returns the next error of errs, or nil.
+func blockingPreDial(release <-chan struct{}, called chan<- struct{}, errs ...error) func(ctx context.Context) error {
+	var n atomic.Int32
+	return func(ctx context.Context) error {
+		i := int(n.Add(1)) - 1
+		select {
+		case called <- struct{}{}:
+		default:
+		}
+		<-release
+		if i < len(errs) {
+			return errs[i]
+		}
+		return nil
+	}
+}
+
+func TestUDPStreamReplaysPendingDatagrams(t *testing.T) {
+	dst, received := newTestUDPServer(t)
+	release := make(chan struct{})
+	called := make(chan struct{}, 1)
+	client := startTestUDPStream(t, dst, 0, blockingPreDial(release, called))
+
+	sendDatagrams(t, client, "1")
+	<-called
+	sendDatagrams(t, client, "2", "3", "4")
+	expect.Equal(t, len(receiveDatagrams(t, received)), 0)
+
+	close(release)
+	expect.Equal(t, receiveDatagrams(t, received), []string{"1", "2", "3", "4"})
+
+	sendDatagrams(t, client, "5")
+	expect.Equal(t, receiveDatagrams(t, received), []string{"5"})
+}
+
+func TestUDPStreamPendingLimit(t *testing.T) {
+	dst, received := newTestUDPServer(t)
+	release := make(chan struct{})
+	called := make(chan struct{}, 1)
+	client := startTestUDPStream(t, dst, 2, blockingPreDial(release, called))
+
+	sendDatagrams(t, client, "1")
+	<-called
+	sendDatagrams(t, client, "2", "3", "4", "5")
+
+	close(release)
+	// the initial datagram and up to 2 pending ones, the rest are dropped
+	expect.Equal(t, receiveDatagrams(t, received), []string{"1", "2", "3"})
+
+	sendDatagrams(t, client, "6")
+	expect.Equal(t, receiveDatagrams(t, received), []string{"6"})
+}
+
+func TestUDPStreamPreDialError(t *testing.T) {
+	dst, received := newTestUDPServer(t)
+	release := make(chan struct{})
+	called := make(chan struct{}, 1)
+	errWakeTimeout := errors.New("wake timeout")
+	client := startTestUDPStream(t, dst, 0, blockingPreDial(release, called, errWakeTimeout))
+
+	sendDatagrams(t, client, "1")
+	<-called
+	sendDatagrams(t, client, "2", "3")
+
+	close(release)
+	// datagrams of a failed connection are dropped
+	expect.Equal(t, len(receiveDatagrams(t, received)), 0)
+
+	// the next datagram creates a new connection
+	sendDatagrams(t, client, "4")
+	expect.Equal(t, receiveDatagrams(t, received), []string{"4"})
+}
@@ -3,6 +3,7 @@ package route
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"net/url"
 	"os"
 	"strings"
@@ -22,6 +23,7 @@ type HTTPConfig struct {
 	SSLCertificate        string   `json:"ssl_certificate,omitempty"`         // Path to client certificate
 	SSLCertificateKey     string   `json:"ssl_certificate_key,omitempty"`     // Path to client certificate key
 	SSLProtocols          []string `json:"ssl_protocols,omitempty"`           // Allowed TLS protocols
+	SSLVerifyName         *bool    `json:"ssl_verify_name,omitempty"`         // Verify server certificate hostname, defaults to true
 }
 
 // BuildTLSConfig creates a TLS configuration based on the HTTP config options.
@@ -68,6 +70,9 @@ func (cfg *HTTPConfig) BuildTLSConfig(targetURL *url.URL) (*tls.Config, gperr.Er
 	}
 
 	// Handle ssl_certificate and ssl_certificate_key (client certificates)
+	if cfg.SSLCertificate == "" && cfg.SSLCertificateKey != "" {
+		return nil, gperr.New("ssl_certificate is required when ssl_certificate_key is specified")
+	}
 	if cfg.SSLCertificate != "" {
 		if cfg.SSLCertificateKey == "" {
 			return nil, gperr.New("ssl_certificate_key is required when ssl_certificate is specified")
@@ -114,5 +119,32 @@ func (cfg *HTTPConfig) BuildTLSConfig(targetURL *url.URL) (*tls.Config, gperr.Er
 		tlsConfig.MaxVersion = maxVersion
 	}
 
+	// Handle ssl_verify_name (verify certificate chain but not the hostname)
+	if cfg.SSLVerifyName != nil && !*cfg.SSLVerifyName && !tlsConfig.InsecureSkipVerify {
+		roots := tlsConfig.RootCAs
+		// chain verification is done in VerifyConnection below
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			return verifyChainWithoutName(cs, roots)
+		}
+	}
+
 	return tlsConfig, nil
 }
+
+// verifyChainWithoutName verifies the peer certificate chain against roots (system roots if nil)
+// without checking the certificate hostname.
+func verifyChainWithoutName(cs tls.ConnectionState, roots *x509.CertPool) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("no peer certificates")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
@@ -1,6 +1,13 @@
 package route_test
 
 import (
+	"crypto/tls"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -48,3 +55,73 @@ func TestHTTPConfigDeserialize(t *testing.T) {
 		})
 	}
 }
+
+func TestHTTPConfigBuildTLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	expect.NoError(t, os.WriteFile(caFile, caPEM, 0o600))
+
+	targetURL := expect.Must(url.Parse(srv.URL))
+	serverName := "mismatched.internal"
+
+	get := func(t *testing.T, cfg *route.HTTPConfig) error {
+		t.Helper()
+		tlsConfig, err := cfg.BuildTLSConfig(targetURL)
+		expect.NoError(t, err)
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		resp, reqErr := client.Get(srv.URL)
+		if reqErr != nil {
+			return reqErr
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	t.Run("trusted_certificate", func(t *testing.T) {
+		expect.NoError(t, get(t, &route.HTTPConfig{SSLTrustedCertificate: caFile}))
+	})
+	t.Run("untrusted", func(t *testing.T) {
+		expect.HasError(t, get(t, &route.HTTPConfig{}))
+	})
+	t.Run("hostname_mismatch", func(t *testing.T) {
+		expect.HasError(t, get(t, &route.HTTPConfig{
+			SSLTrustedCertificate: caFile,
+			SSLServerName:         &serverName,
+		}))
+	})
+	t.Run("verify_name_off", func(t *testing.T) {
+		verifyName := false
+		expect.NoError(t, get(t, &route.HTTPConfig{
+			SSLTrustedCertificate: caFile,
+			SSLServerName:         &serverName,
+			SSLVerifyName:         &verifyName,
+		}))
+	})
+	t.Run("verify_name_off_untrusted", func(t *testing.T) {
+		verifyName := false
+		expect.HasError(t, get(t, &route.HTTPConfig{
+			SSLServerName: &serverName,
+			SSLVerifyName: &verifyName,
+		}))
+	})
+	t.Run("no_tls_verify", func(t *testing.T) {
+		expect.NoError(t, get(t, &route.HTTPConfig{NoTLSVerify: true}))
+	})
+	t.Run("protocols", func(t *testing.T) {
+		cfg := &route.HTTPConfig{SSLProtocols: []string{"TLSv1.3", "TLSv1.2"}}
+		tlsConfig, err := cfg.BuildTLSConfig(targetURL)
+		expect.NoError(t, err)
+		expect.Equal(t, tlsConfig.MinVersion, uint16(tls.VersionTLS12))
+		expect.Equal(t, tlsConfig.MaxVersion, uint16(tls.VersionTLS13))
+	})
+	t.Run("key_without_certificate", func(t *testing.T) {
+		cfg := &route.HTTPConfig{SSLCertificateKey: caFile}
+		_, err := cfg.BuildTLSConfig(targetURL)
+		expect.HasError(t, err)
+	})
+}
@@ -580,6 +580,13 @@ func ConvertString(src string, dst reflect.Value) (convertible bool, convErr gpe
 	// yaml like
 	switch dst.Kind() {
 	case reflect.Slice:
+		// a slice implementing MapUnmarshaller may also be a map, e.g. rules with a preset reference
+		if dst.Addr().Type().Implements(mapUnmarshalerType) {
+			rawMap := SerializedObject{}
+			if err := yaml.Unmarshal(unsafe.Slice(unsafe.StringData(src), len(src)), &rawMap); err == nil {
+				return true, mapUnmarshalValidate(rawMap, dst.Addr(), true)
+			}
+		}
 		// one liner is comma separated list
 		isMultiline := strings.IndexByte(src, '\n') != -1
 		if !isMultiline && src[0] != '-' && src[0] != '[' {
@@ -8,6 +8,7 @@ import (
 
 	"github.com/goccy/go-yaml"
 	"github.com/stretchr/testify/require"
+	gperr "github.com/yusing/goutils/errs"
 	expect "github.com/yusing/goutils/testing"
 )
 
@@ -260,6 +261,32 @@ func TestStringToSlice(t *testing.T) {
 		expect.NoError(t, err)
 		expect.Equal(t, dst, []string{"a"})
 	})
+	t.Run("map_unmarshaller", func(t *testing.T) {
+		var dst testMapSlice
+		convertible, err := ConvertString("from: a,b", reflect.ValueOf(&dst))
+		expect.True(t, convertible)
+		expect.NoError(t, err)
+		expect.Equal(t, dst, testMapSlice{"a", "b"})
+
+		convertible, err = ConvertString("- c\n- d", reflect.ValueOf(&dst))
+		expect.True(t, convertible)
+		expect.NoError(t, err)
+		expect.Equal(t, dst, testMapSlice{"c", "d"})
+	})
+}
+
+// testMapSlice is a slice that can also be unmarshalled from {from: <comma separated list>}.
+type testMapSlice []string
+
+func (s *testMapSlice) UnmarshalMap(m map[string]any) gperr.Error {
+	var ref struct {
+		From []string `json:"from"`
+	}
+	if err := MapUnmarshalValidate(m, &ref); err != nil {
+		return err
+	}
+	*s = ref.From
+	return nil
 }
 
 func TestStringToMap(t *testing.T) {
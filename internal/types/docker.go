@@ -40,6 +40,8 @@ type (
 		IsHostNetworkMode bool     `json:"is_host_network_mode"`
 		Running           bool     `json:"running"`
 
+		SwarmService *SwarmService `json:"swarm_service,omitempty" extensions:"x-nullable"` // set for tasks of swarm services
+
 		Errors *ContainerError `json:"errors" swaggertype:"string"`
 	} // @name Container
 	ContainerImage struct {
@@ -50,6 +52,12 @@ type (
 		Version string `json:"version,omitempty"`
 	} // @name ContainerImage
 
+	SwarmService struct {
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		TaskSlot int    `json:"task_slot,omitempty"` // zero for global services
+	} // @name SwarmService
+
 	ContainerError struct {
 		errs gperr.Builder
 	}
@@ -6,6 +6,7 @@ import (
 	"net"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 
 	"github.com/yusing/godoxy/internal/common"
@@ -15,8 +16,9 @@ import (
 )
 
 type DockerProviderConfig struct {
-	URL string           `json:"url,omitempty"`
-	TLS *DockerTLSConfig `json:"tls,omitempty"`
+	URL   string           `json:"url,omitempty"`
+	TLS   *DockerTLSConfig `json:"tls,omitempty"`
+	Swarm bool             `json:"swarm,omitempty"` // discover swarm services, the docker host must be a swarm manager
 } // @name DockerProviderConfig
 
 type DockerProviderConfigDetailed struct {
@@ -24,6 +26,13 @@ type DockerProviderConfigDetailed struct {
 	Host   string           `json:"host,omitempty" validate:"required,hostname|ip"`
 	Port   int              `json:"port,omitempty" validate:"required,min=1,max=65535"`
 	TLS    *DockerTLSConfig `json:"tls" validate:"omitempty"`
+	Swarm  bool             `json:"swarm,omitempty"`
+}
+
+type DockerProviderConfigURL struct {
+	URL   string           `json:"url" validate:"required"`
+	TLS   *DockerTLSConfig `json:"tls" validate:"omitempty"`
+	Swarm bool             `json:"swarm,omitempty"`
 }
 
 type DockerTLSConfig struct {
@@ -37,9 +46,13 @@ func (cfg *DockerProviderConfig) MarshalJSON() ([]byte, error) {
 }
 
 func (cfg *DockerProviderConfig) Parse(value string) error {
-	if value == common.DockerHostFromEnv {
+	switch value {
+	case common.DockerHostFromEnv:
 		cfg.URL = env.GetEnvString("DOCKER_HOST", "unix:///var/run/docker.sock")
 		return nil
+	case common.PodmanHostFromEnv:
+		cfg.URL = env.GetEnvString("CONTAINER_HOST", podmanSocket())
+		return nil
 	}
 
 	u, err := url.Parse(value)
@@ -60,14 +73,26 @@ func (cfg *DockerProviderConfig) Parse(value string) error {
 }
 
 func (cfg *DockerProviderConfig) UnmarshalMap(m map[string]any) gperr.Error {
-	var tmp DockerProviderConfigDetailed
-	var err = serialization.MapUnmarshalValidate(m, &tmp)
-	if err != nil {
-		return err
+	if _, ok := m["url"]; ok {
+		var tmp DockerProviderConfigURL
+		if err := serialization.MapUnmarshalValidate(m, &tmp); err != nil {
+			return err
+		}
+		if err := cfg.Parse(tmp.URL); err != nil {
+			return gperr.Wrap(err).Subject("url")
+		}
+		cfg.TLS = tmp.TLS
+		cfg.Swarm = tmp.Swarm
+	} else {
+		var tmp DockerProviderConfigDetailed
+		if err := serialization.MapUnmarshalValidate(m, &tmp); err != nil {
+			return err
+		}
+		cfg.URL = fmt.Sprintf("%s://%s", tmp.Scheme, net.JoinHostPort(tmp.Host, strconv.Itoa(tmp.Port)))
+		cfg.TLS = tmp.TLS
+		cfg.Swarm = tmp.Swarm
 	}
 
-	cfg.URL = fmt.Sprintf("%s://%s", tmp.Scheme, net.JoinHostPort(tmp.Host, strconv.Itoa(tmp.Port)))
-	cfg.TLS = tmp.TLS
 	if cfg.TLS != nil {
 		if err := checkFilesOk(cfg.TLS.CAFile, cfg.TLS.CertFile, cfg.TLS.KeyFile); err != nil {
 			return gperr.Wrap(err)
@@ -76,6 +101,20 @@ func (cfg *DockerProviderConfig) UnmarshalMap(m map[string]any) gperr.Error {
 	return nil
 }
 
+// podmanSocket returns the rootless podman socket of the current user if exists,
+// otherwise the rootful one.
+func podmanSocket() string {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = "/run/user/" + strconv.Itoa(os.Getuid())
+	}
+	rootless := filepath.Join(runtimeDir, "podman", "podman.sock")
+	if _, err := os.Stat(rootless); err == nil {
+		return "unix://" + rootless
+	}
+	return "unix:///run/podman/podman.sock"
+}
+
 func checkFilesOk(files ...string) error {
 	if common.IsTest {
 		return nil
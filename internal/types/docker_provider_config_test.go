@@ -30,6 +30,24 @@ test:
 		assert.NoError(t, err)
 		assert.Equal(t, &DockerProviderConfig{URL: "http://localhost:2375", TLS: &DockerTLSConfig{CAFile: "/etc/ssl/ca.crt", CertFile: "/etc/ssl/cert.crt", KeyFile: "/etc/ssl/key.crt"}}, cfg["test"])
 	})
+
+	t.Run("swarm", func(t *testing.T) {
+		var cfg map[string]*DockerProviderConfig
+		err := serialization.UnmarshalValidate([]byte(`
+test:
+  url: unix:///var/run/docker.sock
+  swarm: true`), &cfg, yaml.Unmarshal)
+		assert.NoError(t, err)
+		assert.Equal(t, &DockerProviderConfig{URL: "unix:///var/run/docker.sock", Swarm: true}, cfg["test"])
+	})
+
+	t.Run("podman", func(t *testing.T) {
+		t.Setenv("CONTAINER_HOST", "unix:///run/user/1000/podman/podman.sock")
+		var cfg map[string]*DockerProviderConfig
+		err := serialization.UnmarshalValidate([]byte("test: $CONTAINER_HOST"), &cfg, yaml.Unmarshal)
+		assert.NoError(t, err)
+		assert.Equal(t, &DockerProviderConfig{URL: "unix:///run/user/1000/podman/podman.sock"}, cfg["test"])
+	})
 }
 
 func TestDockerProviderConfigValidation(t *testing.T) {
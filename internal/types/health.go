@@ -55,6 +55,7 @@ type (
 		Detail   string             `json:"detail"`
 		URL      string             `json:"url"`
 		Extra    *HealthExtra       `json:"extra,omitempty" extensions:"x-nullable"`
+		Schedule *IdleScheduleJSON  `json:"schedule,omitempty" extensions:"x-nullable"`
 	} // @name HealthJSON
 
 	HealthJSONRepr struct {
@@ -68,12 +69,22 @@ type (
 		Detail   string
 		URL      *url.URL
 		Extra    *HealthExtra
+		Schedule *IdleScheduleJSON
 	}
 
 	HealthExtra struct {
 		Config *LoadBalancerConfig `json:"config"`
 		Pool   map[string]any      `json:"pool"`
 	} // @name HealthExtra
+
+	// IdleScheduleJSON is the schedule state of an idlewatcher with schedules.
+	IdleScheduleJSON struct {
+		Active         string  `json:"active"`         // name of the active schedule, empty if none
+		KeepAwake      bool    `json:"keepAwake"`      // whether the active schedule keeps the container awake
+		IdleTimeout    float64 `json:"idleTimeout"`    // idle timeout in effect in seconds, 0 if kept awake
+		NextTransition int64   `json:"nextTransition"` // unix timestamp in seconds, 0 if none
+		Next           string  `json:"next"`           // name of the schedule active after the next transition, empty if none
+	} // @name IdleScheduleJSON
 )
 
 const (
@@ -189,5 +200,6 @@ func (jsonRepr *HealthJSONRepr) MarshalJSON() ([]byte, error) {
 		Detail:   jsonRepr.Detail,
 		URL:      url,
 		Extra:    jsonRepr.Extra,
+		Schedule: jsonRepr.Schedule,
 	})
 }
@@ -13,6 +13,9 @@ type (
 	IdlewatcherProviderConfig struct {
 		Proxmox *ProxmoxConfig `json:"proxmox,omitempty"`
 		Docker  *DockerConfig  `json:"docker,omitempty"`
+		Systemd *SystemdConfig `json:"systemd,omitempty"`
+		Exec    *ExecConfig    `json:"exec,omitempty"`
+		Libvirt *LibvirtConfig `json:"libvirt,omitempty"`
 	} // @name IdlewatcherProviderConfig
 	IdlewatcherConfigBase struct {
 		// 0: no idle watcher.
@@ -23,6 +26,10 @@ type (
 		StopTimeout time.Duration       `json:"stop_timeout"`
 		StopMethod  ContainerStopMethod `json:"stop_method"`
 		StopSignal  ContainerSignal     `json:"stop_signal,omitempty"`
+		// Schedules override the idle behavior during time windows, the first active one applies.
+		Schedules []*IdlewatcherSchedule `json:"schedules,omitempty"`
+		// Activity configures sources other than proxied traffic that keep the container awake.
+		Activity *IdlewatcherActivityConfig `json:"activity,omitempty"`
 	} // @name IdlewatcherConfigBase
 	IdlewatcherConfig struct {
 		IdlewatcherProviderConfig
@@ -32,6 +39,12 @@ type (
 		DependsOn     []string `json:"depends_on,omitempty"`
 		NoLoadingPage bool     `json:"no_loading_page,omitempty"`
 
+		// PendingConns is the maximum number of TCP connections or UDP sources
+		// a stream route holds while the container wakes, they are forwarded once it is ready.
+		PendingConns int `json:"pending_conns,omitempty"`
+		// PendingPackets is the maximum number of UDP datagrams buffered per source while the container wakes.
+		PendingPackets int `json:"pending_packets,omitempty"`
+
 		valErr gperr.Error
 	} // @name IdlewatcherConfig
 	ContainerStopMethod string // @name ContainerStopMethod
@@ -46,31 +59,121 @@ type (
 		Node string `json:"node" validate:"required"`
 		VMID int    `json:"vmid" validate:"required"`
 	} // @name IdlewatcherProxmoxNodeConfig
+	SystemdConfig struct {
+		Unit string `json:"unit" validate:"required"` // e.g. ollama.service
+		User bool   `json:"user,omitempty"`           // use the user service manager instead of the system one
+	} // @name IdlewatcherSystemdConfig
+	// ExecConfig runs shell commands (sh -c) to manage the service.
+	//
+	// Status must exit 0 when running and non-zero when stopped,
+	// or print one of "running", "paused" or "stopped".
+	ExecConfig struct {
+		Name    string            `json:"name,omitempty"` // display name, defaults to "exec"
+		Start   string            `json:"start" validate:"required"`
+		Stop    string            `json:"stop" validate:"required"`
+		Status  string            `json:"status" validate:"required"`
+		Pause   string            `json:"pause,omitempty"`   // required for stop_method "pause"
+		Unpause string            `json:"unpause,omitempty"` // required for stop_method "pause"
+		Kill    string            `json:"kill,omitempty"`    // defaults to stop
+		Dir     string            `json:"dir,omitempty"`
+		Env     map[string]string `json:"env,omitempty"`
+	} // @name IdlewatcherExecConfig
+	LibvirtConfig struct {
+		Domain string `json:"domain" validate:"required"`
+		URI    string `json:"uri,omitempty"`    // defaults to qemu:///system
+		Socket string `json:"socket,omitempty"` // defaults to /var/run/libvirt/libvirt-sock
+		// PauseMode is how stop_method "pause" pauses the domain:
+		// "suspend" keeps it in memory, "managedsave" saves its memory to disk and stops it.
+		PauseMode LibvirtPauseMode `json:"pause_mode,omitempty"`
+	} // @name IdlewatcherLibvirtConfig
+	LibvirtPauseMode string // @name LibvirtPauseMode
+
+	// IdlewatcherActivityConfig configures how activity is detected besides request arrival.
+	//
+	// The container is stopped only when the idle timeout is reached and every configured source reports idle.
+	// A busy source restarts the idle timer.
+	IdlewatcherActivityConfig struct {
+		// Connections keeps the container awake while proxied connections are open (websockets, downloads, TCP/UDP streams).
+		Connections bool `json:"connections,omitempty"`
+		// CPU is the CPU usage in percent above which the container is busy, 100 per fully used core.
+		CPU float64 `json:"cpu,omitempty"`
+		// Network is the received and sent bytes per second above which the container is busy.
+		Network uint64 `json:"network,omitempty"`
+		// Endpoint is a path on the app, or an absolute URL, that responds with "busy" or "idle".
+		Endpoint string `json:"endpoint,omitempty"`
+		// Interval is how often cpu, network and the endpoint are checked, defaults to 30s.
+		Interval time.Duration `json:"interval,omitempty"`
+	} // @name IdlewatcherActivityConfig
 )
 
 const (
 	ContainerWakeTimeoutDefault = 30 * time.Second
+	ActivityIntervalDefault     = 30 * time.Second
+	PendingConnsDefault         = 64
+	PendingPacketsDefault       = 16
 	ContainerStopTimeoutDefault = 1 * time.Minute
 
 	ContainerStopMethodPause ContainerStopMethod = "pause"
 	ContainerStopMethodStop  ContainerStopMethod = "stop"
 	ContainerStopMethodKill  ContainerStopMethod = "kill"
+
+	LibvirtPauseModeSuspend     LibvirtPauseMode = "suspend"
+	LibvirtPauseModeManagedSave LibvirtPauseMode = "managedsave"
 )
 
 func (c *IdlewatcherConfig) Key() string {
-	if c.Docker != nil {
+	switch {
+	case c.Docker != nil:
 		return c.Docker.ContainerID
+	case c.Systemd != nil:
+		return c.Systemd.key()
+	case c.Exec != nil:
+		return "exec:" + c.Exec.Dir + ":" + c.Exec.Start
+	case c.Libvirt != nil:
+		return "libvirt:" + c.Libvirt.URI + ":" + c.Libvirt.Domain
 	}
 	return c.Proxmox.Node + ":" + strconv.Itoa(c.Proxmox.VMID)
 }
 
 func (c *IdlewatcherConfig) ContainerName() string {
-	if c.Docker != nil {
+	switch {
+	case c.Docker != nil:
 		return c.Docker.ContainerName
+	case c.Systemd != nil:
+		return c.Systemd.Unit
+	case c.Exec != nil:
+		if c.Exec.Name != "" {
+			return c.Exec.Name
+		}
+		return "exec"
+	case c.Libvirt != nil:
+		return c.Libvirt.Domain
 	}
 	return "lxc-" + strconv.Itoa(c.Proxmox.VMID)
 }
 
+// HasProvider returns whether any provider config is set.
+func (c *IdlewatcherProviderConfig) HasProvider() bool {
+	return c.numProviders() > 0
+}
+
+func (c *IdlewatcherProviderConfig) numProviders() int {
+	n := 0
+	for _, set := range []bool{c.Docker != nil, c.Proxmox != nil, c.Systemd != nil, c.Exec != nil, c.Libvirt != nil} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+func (c *SystemdConfig) key() string {
+	if c.User {
+		return "systemd-user:" + c.Unit
+	}
+	return "systemd:" + c.Unit
+}
+
 func (c *IdlewatcherConfig) Validate() gperr.Error {
 	if c.IdleTimeout == 0 { // zero idle timeout means no idle watcher
 		c.valErr = nil
@@ -84,6 +187,9 @@ func (c *IdlewatcherConfig) Validate() gperr.Error {
 		c.validateStopMethod(),
 		c.validateStopSignal(),
 		c.validateStartEndpoint(),
+		c.validateSchedules(),
+		c.validateActivity(),
+		c.validatePendingLimits(),
 	)
 	c.valErr = errs.Error()
 	return c.valErr
@@ -94,8 +200,33 @@ func (c *IdlewatcherConfig) ValErr() gperr.Error {
 }
 
 func (c *IdlewatcherConfig) validateProvider() error {
-	if c.Docker == nil && c.Proxmox == nil {
+	switch c.numProviders() {
+	case 0:
 		return gperr.New("missing idlewatcher provider config")
+	case 1:
+	default:
+		// docker and proxmox may be filled in automatically from the route
+		if c.Systemd != nil || c.Exec != nil || c.Libvirt != nil {
+			return gperr.New("only one idlewatcher provider can be configured")
+		}
+	}
+	if c.Systemd != nil && !strings.Contains(c.Systemd.Unit, ".") {
+		c.Systemd.Unit += ".service"
+	}
+	if c.Exec != nil && c.StopMethod == ContainerStopMethodPause && (c.Exec.Pause == "" || c.Exec.Unpause == "") {
+		return gperr.New("exec provider requires pause and unpause commands for stop method pause")
+	}
+	if c.Libvirt != nil {
+		if c.Libvirt.URI == "" {
+			c.Libvirt.URI = "qemu:///system"
+		}
+		switch c.Libvirt.PauseMode {
+		case "":
+			c.Libvirt.PauseMode = LibvirtPauseModeSuspend
+		case LibvirtPauseModeSuspend, LibvirtPauseModeManagedSave:
+		default:
+			return gperr.New("invalid libvirt pause mode").Subject(string(c.Libvirt.PauseMode))
+		}
 	}
 	return nil
 }
@@ -110,6 +241,19 @@ func (c *IdlewatcherConfig) validateTimeouts() error { //nolint:unparam
 	return nil
 }
 
+func (c *IdlewatcherConfig) validatePendingLimits() error {
+	if c.PendingConns < 0 || c.PendingPackets < 0 {
+		return gperr.New("pending_conns and pending_packets must not be negative")
+	}
+	if c.PendingConns == 0 {
+		c.PendingConns = PendingConnsDefault
+	}
+	if c.PendingPackets == 0 {
+		c.PendingPackets = PendingPacketsDefault
+	}
+	return nil
+}
+
 func (c *IdlewatcherConfig) validateStopMethod() error {
 	switch c.StopMethod {
 	case "":
@@ -146,3 +290,30 @@ func (c *IdlewatcherConfig) validateStartEndpoint() error {
 	_, err := url.ParseRequestURI(c.StartEndpoint)
 	return err
 }
+
+func (c *IdlewatcherConfig) validateActivity() error {
+	a := c.Activity
+	if a == nil {
+		return nil
+	}
+	if a.CPU < 0 {
+		return gperr.New("activity cpu threshold must not be negative")
+	}
+	if (a.CPU > 0 || a.Network > 0) && c.Docker == nil && c.Proxmox == nil {
+		return gperr.New("activity cpu and network thresholds require the docker or proxmox provider")
+	}
+	if a.Endpoint != "" {
+		if _, err := url.Parse(a.Endpoint); err != nil {
+			return gperr.Wrap(err, "invalid activity endpoint")
+		}
+	}
+	if a.Interval <= 0 {
+		a.Interval = ActivityIntervalDefault
+	}
+	return nil
+}
+
+// Polled returns whether any source has to be checked periodically.
+func (a *IdlewatcherActivityConfig) Polled() bool {
+	return a.CPU > 0 || a.Network > 0 || a.Endpoint != ""
+}
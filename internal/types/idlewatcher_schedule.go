@@ -0,0 +1,119 @@
+package types
+
+import (
+	"time"
+
+	"github.com/yusing/godoxy/internal/cron"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// IdlewatcherSchedule overrides the idle behavior during a time window,
+// e.g. keep a container awake during business hours or prewarm it before known usage.
+type IdlewatcherSchedule struct {
+	Name string `json:"name,omitempty"` // defaults to start
+	// Cron expression (minute hour day-of-month month day-of-week) for when the window starts,
+	// e.g. "55 7 * * mon-fri". Prefix with "TZ=<zone> " to use a time zone other than the local one.
+	Start    string        `json:"start" validate:"required"`
+	Duration time.Duration `json:"duration" validate:"required"`
+	// Idle timeout during the window, defaults to idle_timeout.
+	IdleTimeout time.Duration `json:"idle_timeout,omitempty"`
+	// Never stop the container during the window.
+	KeepAwake bool `json:"keep_awake,omitempty"`
+	// Start the container when the window starts.
+	Wake bool `json:"wake,omitempty"`
+	// Stop the container when the window starts.
+	Sleep bool `json:"sleep,omitempty"`
+
+	cron *cron.Schedule
+} // @name IdlewatcherSchedule
+
+// Window returns the window containing t.
+func (s *IdlewatcherSchedule) Window(t time.Time) (start, end time.Time, ok bool) {
+	start = s.cron.Next(t.Add(-s.Duration))
+	if start.IsZero() || start.After(t) {
+		return time.Time{}, time.Time{}, false
+	}
+	end = start.Add(s.Duration)
+	// windows longer than the cron interval overlap, extend to the last start
+	for next := s.cron.Next(start); !next.IsZero() && !next.After(t); next = s.cron.Next(next) {
+		end = next.Add(s.Duration)
+	}
+	return start, end, true
+}
+
+// NextStart returns the next window start after t, or the zero time if there is none.
+func (s *IdlewatcherSchedule) NextStart(t time.Time) time.Time {
+	return s.cron.Next(t)
+}
+
+// ActiveSchedule returns the first schedule whose window contains t, and the end of that window.
+func (c *IdlewatcherConfigBase) ActiveSchedule(t time.Time) (*IdlewatcherSchedule, time.Time) {
+	for _, s := range c.Schedules {
+		if _, end, ok := s.Window(t); ok {
+			return s, end
+		}
+	}
+	return nil, time.Time{}
+}
+
+// NextScheduleTransition returns the next time after t a window starts or ends,
+// or the zero time if there are no schedules.
+func (c *IdlewatcherConfigBase) NextScheduleTransition(t time.Time) time.Time {
+	var next time.Time
+	earliest := func(candidate time.Time) {
+		if !candidate.IsZero() && candidate.After(t) && (next.IsZero() || candidate.Before(next)) {
+			next = candidate
+		}
+	}
+	for _, s := range c.Schedules {
+		earliest(s.NextStart(t))
+		if _, end, ok := s.Window(t); ok {
+			earliest(end)
+		}
+	}
+	return next
+}
+
+// IdleTimeoutAt returns the idle timeout in effect at t, 0 if the container is kept awake.
+func (c *IdlewatcherConfigBase) IdleTimeoutAt(t time.Time) time.Duration {
+	if s, _ := c.ActiveSchedule(t); s != nil {
+		if s.KeepAwake {
+			return 0
+		}
+		if s.IdleTimeout > 0 {
+			return s.IdleTimeout
+		}
+	}
+	return c.IdleTimeout
+}
+
+func (c *IdlewatcherConfigBase) validateSchedules() error {
+	var errs gperr.Builder
+	for i, s := range c.Schedules {
+		if s.Name == "" {
+			s.Name = s.Start
+		}
+		subject := func(err gperr.Error) {
+			errs.Add(err.Subjectf("schedules[%d]", i))
+		}
+		sched, err := cron.Parse(s.Start, time.Local)
+		if err != nil {
+			subject(gperr.Wrap(err))
+			continue
+		}
+		s.cron = sched
+		switch {
+		case s.Duration <= 0:
+			subject(gperr.New("duration must be positive"))
+		case s.IdleTimeout < 0:
+			subject(gperr.New("idle_timeout must not be negative"))
+		case s.KeepAwake && s.Sleep:
+			subject(gperr.New("keep_awake and sleep are mutually exclusive"))
+		case s.Wake && s.Sleep:
+			subject(gperr.New("wake and sleep are mutually exclusive"))
+		case s.KeepAwake && s.IdleTimeout > 0:
+			subject(gperr.New("idle_timeout has no effect with keep_awake"))
+		}
+	}
+	return errs.Error()
+}
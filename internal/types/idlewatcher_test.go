@@ -2,6 +2,7 @@ package types
 
 import (
 	"testing"
+	"time"
 
 	expect "github.com/yusing/goutils/testing"
 )
@@ -47,3 +48,100 @@ func TestValidateStartEndpoint(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateProvider(t *testing.T) {
+	cfg := new(IdlewatcherConfig)
+	expect.HasError(t, cfg.validateProvider())
+
+	cfg.Systemd = &SystemdConfig{Unit: "ollama"}
+	expect.NoError(t, cfg.validateProvider())
+	expect.Equal(t, cfg.Systemd.Unit, "ollama.service")
+	expect.Equal(t, cfg.Key(), "systemd:ollama.service")
+
+	cfg.Docker = &DockerConfig{ContainerID: "abc"}
+	expect.HasError(t, cfg.validateProvider())
+
+	cfg = new(IdlewatcherConfig)
+	cfg.Exec = &ExecConfig{Start: "start", Stop: "stop", Status: "status"}
+	cfg.StopMethod = ContainerStopMethodPause
+	expect.HasError(t, cfg.validateProvider())
+	cfg.Exec.Pause, cfg.Exec.Unpause = "pause", "unpause"
+	expect.NoError(t, cfg.validateProvider())
+}
+
+func TestValidateLibvirtProvider(t *testing.T) {
+	cfg := new(IdlewatcherConfig)
+	cfg.Libvirt = &LibvirtConfig{Domain: "win11"}
+	expect.NoError(t, cfg.validateProvider())
+	expect.Equal(t, cfg.Libvirt.URI, "qemu:///system")
+	expect.Equal(t, cfg.Libvirt.PauseMode, LibvirtPauseModeSuspend)
+	expect.Equal(t, cfg.Key(), "libvirt:qemu:///system:win11")
+
+	cfg.Libvirt.PauseMode = "hibernate"
+	expect.HasError(t, cfg.validateProvider())
+}
+
+func TestIdlewatcherSchedules(t *testing.T) {
+	cfg := new(IdlewatcherConfig)
+	cfg.IdleTimeout = 10 * time.Minute
+	cfg.Schedules = []*IdlewatcherSchedule{
+		{Name: "prewarm", Start: "TZ=UTC 55 7 * * mon-fri", Duration: 5 * time.Minute, Wake: true, KeepAwake: true},
+		{Name: "business hours", Start: "TZ=UTC 0 8 * * mon-fri", Duration: 10 * time.Hour, IdleTimeout: time.Hour},
+		{Start: "TZ=UTC 0 1 * * *", Duration: 5 * time.Hour, Sleep: true},
+	}
+	expect.NoError(t, cfg.validateSchedules())
+	expect.Equal(t, cfg.Schedules[2].Name, "TZ=UTC 0 1 * * *")
+
+	// 2026-10-19 is a monday
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, 10, 19, hour, minute, 0, 0, time.UTC)
+	}
+
+	s, end := cfg.ActiveSchedule(at(7, 56))
+	expect.Equal(t, s.Name, "prewarm")
+	expect.Equal(t, end, at(8, 0))
+	expect.Equal(t, cfg.IdleTimeoutAt(at(7, 56)), 0)
+	expect.Equal(t, cfg.NextScheduleTransition(at(7, 56)), at(8, 0))
+
+	s, end = cfg.ActiveSchedule(at(12, 0))
+	expect.Equal(t, s.Name, "business hours")
+	expect.Equal(t, end, at(18, 0))
+	expect.Equal(t, cfg.IdleTimeoutAt(at(12, 0)), time.Hour)
+	expect.Equal(t, cfg.NextScheduleTransition(at(12, 0)), at(18, 0))
+
+	s, _ = cfg.ActiveSchedule(at(19, 0))
+	expect.True(t, s == nil)
+	expect.Equal(t, cfg.IdleTimeoutAt(at(19, 0)), 10*time.Minute)
+	expect.Equal(t, cfg.NextScheduleTransition(at(19, 0)), at(25, 0))
+
+	cfg.Schedules = []*IdlewatcherSchedule{{Start: "0 1 * * *", Duration: time.Hour, KeepAwake: true, Sleep: true}}
+	expect.HasError(t, cfg.validateSchedules())
+	cfg.Schedules = []*IdlewatcherSchedule{{Start: "0 25 * * *", Duration: time.Hour}}
+	expect.HasError(t, cfg.validateSchedules())
+}
+
+func TestValidateActivity(t *testing.T) {
+	cfg := new(IdlewatcherConfig)
+	cfg.Systemd = &SystemdConfig{Unit: "jellyfin.service"}
+	cfg.Activity = &IdlewatcherActivityConfig{Connections: true, Endpoint: "/api/busy"}
+	expect.NoError(t, cfg.validateActivity())
+	expect.Equal(t, cfg.Activity.Interval, ActivityIntervalDefault)
+	expect.True(t, cfg.Activity.Polled())
+
+	cfg.Activity.CPU = 50
+	expect.HasError(t, cfg.validateActivity())
+
+	cfg.Systemd = nil
+	cfg.Docker = &DockerConfig{ContainerID: "abc"}
+	expect.NoError(t, cfg.validateActivity())
+}
+
+func TestValidatePendingLimits(t *testing.T) {
+	cfg := new(IdlewatcherConfig)
+	expect.NoError(t, cfg.validatePendingLimits())
+	expect.Equal(t, cfg.PendingConns, PendingConnsDefault)
+	expect.Equal(t, cfg.PendingPackets, PendingPacketsDefault)
+
+	cfg.PendingPackets = -1
+	expect.HasError(t, cfg.validatePendingLimits())
+}
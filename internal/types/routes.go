@@ -73,5 +73,10 @@ type (
 		GetType() provider.Type
 		ShortName() string
 		String() string
+		// Revision returns the applied revision of the routes, e.g. a commit id, or empty.
+		Revision() string
+		// IsTrusted reports whether the routes come from local route files.
+		// Only trusted routes may use host-level fields, e.g. idlewatcher exec and systemd.
+		IsTrusted() bool
 	}
 )
@@ -0,0 +1,75 @@
+package watcher
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/yusing/godoxy/internal/discovery"
+	"github.com/yusing/godoxy/internal/watcher/events"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+type DiscoveryWatcher struct {
+	name   string // provider name, e.g. "consul@fleet"
+	source discovery.Source
+}
+
+var (
+	discoveryWatcherRetryInterval    = 3 * time.Second
+	discoveryWatcherMaxRetryInterval = time.Minute
+)
+
+// NewDiscoveryWatcher watches a service discovery source, source must be initialized.
+func NewDiscoveryWatcher(name string, source discovery.Source) DiscoveryWatcher {
+	return DiscoveryWatcher{name: name, source: source}
+}
+
+// Events emits ActionResourceModified when the routes of the source may have changed.
+//
+// After a failed watch, a reload is triggered once the watch is established again since changes may have been missed.
+func (w DiscoveryWatcher) Events(ctx context.Context) (<-chan Event, <-chan gperr.Error) {
+	eventCh := make(chan Event)
+	errCh := make(chan gperr.Error)
+
+	go func() {
+		defer close(eventCh)
+		defer close(errCh)
+
+		// routes are loaded when the provider starts, the first established watch is not a change
+		var synced atomic.Bool
+		changed := func() {
+			if synced.CompareAndSwap(false, true) {
+				return
+			}
+			_ = send(ctx, eventCh, Event{
+				Type:      events.EventTypeDiscovery,
+				ActorName: w.name,
+				Action:    events.ActionResourceModified,
+			})
+		}
+
+		retryInterval := discoveryWatcherRetryInterval
+		for {
+			start := time.Now()
+			err := w.source.Watch(ctx, changed)
+			if ctx.Err() != nil {
+				return
+			}
+			if time.Since(start) > discoveryWatcherMaxRetryInterval {
+				retryInterval = discoveryWatcherRetryInterval
+			}
+			if err != nil && send(ctx, errCh, gperr.Wrap(err, w.source.String()+" watcher")) != nil {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryInterval):
+			}
+			retryInterval = min(retryInterval*2, discoveryWatcherMaxRetryInterval)
+		}
+	}()
+	return eventCh, errCh
+}
@@ -3,9 +3,13 @@ package watcher
 import (
 	"context"
 	"errors"
+	"maps"
+	"slices"
+	"strings"
 	"time"
 
 	dockerEvents "github.com/moby/moby/api/types/events"
+	"github.com/moby/moby/api/types/swarm"
 	"github.com/moby/moby/client"
 	"github.com/rs/zerolog/log"
 	"github.com/yusing/godoxy/internal/docker"
@@ -53,6 +57,11 @@ var (
 	DockerFilterPause     = NewDockerFilter("event", string(dockerEvents.ActionPause))
 	DockerFilterUnpause   = NewDockerFilter("event", string(dockerEvents.ActionUnPause))
 
+	DockerFilterService = NewDockerFilter("type", string(dockerEvents.ServiceEventType))
+	DockerFilterCreate  = NewDockerFilter("event", string(dockerEvents.ActionCreate))
+	DockerFilterUpdate  = NewDockerFilter("event", string(dockerEvents.ActionUpdate))
+	DockerFilterRemove  = NewDockerFilter("event", string(dockerEvents.ActionRemove))
+
 	optionsDefault = DockerListOptions{Filters: NewDockerFilters(
 		DockerFilterContainer,
 		DockerFilterStart,
@@ -61,8 +70,22 @@ var (
 		DockerFilterDestroy,
 	)}
 
+	optionsSwarm = DockerListOptions{Filters: NewDockerFilters(
+		DockerFilterContainer,
+		DockerFilterService,
+		DockerFilterStart,
+		DockerFilterDie,
+		DockerFilterDestroy,
+		DockerFilterCreate,
+		DockerFilterUpdate,
+		DockerFilterRemove,
+	)}
+
 	dockerWatcherRetryInterval = 3 * time.Second
 
+	// tasks rescheduled to other nodes do not generate events on the manager.
+	swarmTaskPollInterval = 10 * time.Second
+
 	reloadTrigger = Event{
 		Type:            events.EventTypeDocker,
 		Action:          events.ActionForceReload,
@@ -82,11 +105,19 @@ func NewDockerWatcher(dockerCfg types.DockerProviderConfig) DockerWatcher {
 	}
 }
 
+// Events returns container events, and swarm service events with task changes in swarm mode.
 func (w DockerWatcher) Events(ctx context.Context) (<-chan Event, <-chan gperr.Error) {
-	return w.EventsWithOptions(ctx, optionsDefault)
+	if w.cfg.Swarm {
+		return w.events(ctx, optionsSwarm, true)
+	}
+	return w.events(ctx, optionsDefault, false)
 }
 
 func (w DockerWatcher) EventsWithOptions(ctx context.Context, options DockerListOptions) (<-chan Event, <-chan gperr.Error) {
+	return w.events(ctx, options, false)
+}
+
+func (w DockerWatcher) events(ctx context.Context, options DockerListOptions, pollSwarmTasks bool) (<-chan Event, <-chan gperr.Error) {
 	eventCh := make(chan Event)
 	errCh := make(chan gperr.Error)
 
@@ -103,6 +134,14 @@ func (w DockerWatcher) EventsWithOptions(ctx context.Context, options DockerList
 			client.Close()
 		}()
 
+		var swarmTaskTicker <-chan time.Time
+		var tasks swarmTasks
+		if pollSwarmTasks {
+			ticker := time.NewTicker(swarmTaskPollInterval)
+			defer ticker.Stop()
+			swarmTaskTicker = ticker.C
+		}
+
 		chs := client.Events(ctx, options)
 		defer log.Debug().Str("host", client.DaemonHost()).Msg("docker watcher closed")
 		for {
@@ -111,6 +150,10 @@ func (w DockerWatcher) EventsWithOptions(ctx context.Context, options DockerList
 				return
 			case msg := <-chs.Messages:
 				w.handleEvent(msg, eventCh)
+			case <-swarmTaskTicker:
+				if err := tasks.update(ctx, client, eventCh); err != nil {
+					errCh <- err
+				}
 			case err := <-chs.Err:
 				if err == nil {
 					continue
@@ -159,7 +202,11 @@ func (w DockerWatcher) parseError(err error) gperr.Error {
 }
 
 func (w DockerWatcher) handleEvent(event dockerEvents.Message, ch chan<- Event) {
-	action, ok := events.DockerEventMap[event.Action]
+	eventMap := events.DockerEventMap
+	if event.Type == dockerEvents.ServiceEventType {
+		eventMap = events.DockerServiceEventMap
+	}
+	action, ok := eventMap[event.Action]
 	if !ok {
 		return
 	}
@@ -182,3 +229,77 @@ func checkConnection(ctx context.Context, client *docker.SharedClient) bool {
 	}
 	return true
 }
+
+// swarmTasks tracks the running tasks of swarm services.
+type swarmTasks struct {
+	tasks  map[string]string // service id => task ids and addresses
+	failed bool
+}
+
+// update lists the running tasks and emits a modified event for each service with changed tasks.
+//
+// Errors are returned once until listing succeeds again.
+func (t *swarmTasks) update(ctx context.Context, client *docker.SharedClient, ch chan<- Event) gperr.Error {
+	listCtx, cancel := context.WithTimeout(ctx, dockerWatcherRetryInterval)
+	defer cancel()
+
+	list, err := docker.ListSwarmTasks(listCtx, client)
+	if err != nil {
+		if t.failed {
+			return nil
+		}
+		t.failed = true
+		return gperr.Wrap(err, "docker watcher: failed to list swarm tasks")
+	}
+	t.failed = false
+
+	slices.SortFunc(list, func(a, b swarm.Task) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	tasks := make(map[string]string, len(t.tasks))
+	for _, task := range list {
+		var sb strings.Builder
+		sb.WriteString(tasks[task.ServiceID])
+		sb.WriteString(task.ID)
+		for _, attachment := range task.NetworksAttachments {
+			for _, addr := range attachment.Addresses {
+				sb.WriteByte(' ')
+				sb.WriteString(addr.String())
+			}
+		}
+		sb.WriteByte(';')
+		tasks[task.ServiceID] = sb.String()
+	}
+
+	// first run, routes are loaded with the current tasks
+	if t.tasks == nil {
+		t.tasks = tasks
+		return nil
+	}
+
+	for id := range maps.Keys(tasks) {
+		if t.tasks[id] != tasks[id] {
+			t.emit(ctx, id, ch)
+		}
+	}
+	for id := range maps.Keys(t.tasks) {
+		if _, ok := tasks[id]; !ok {
+			t.emit(ctx, id, ch)
+		}
+	}
+	t.tasks = tasks
+	return nil
+}
+
+func (t *swarmTasks) emit(ctx context.Context, serviceID string, ch chan<- Event) {
+	select {
+	case <-ctx.Done():
+	case ch <- Event{
+		Type:            events.EventTypeDocker,
+		Action:          events.ActionResourceModified,
+		ActorID:         serviceID,
+		ActorName:       serviceID,
+		ActorAttributes: map[string]string{},
+	}:
+	}
+}
@@ -9,9 +9,9 @@ import (
 type (
 	Event struct {
 		Type            EventType
-		ActorName       string            // docker: container name, file: relative file path
-		ActorID         string            // docker: container id, file: empty
-		ActorAttributes map[string]string // docker: container labels, file: empty
+		ActorName       string            // docker: container or swarm service name, file: relative file path, kubernetes: "Kind/namespace/name", discovery: provider name, git: commit id
+		ActorID         string            // docker: container or swarm service id, file: empty, kubernetes: object uid
+		ActorAttributes map[string]string // docker: container labels or swarm service attributes, file: empty, kubernetes: object annotations
 		Action          Action
 	}
 	Action    uint16
@@ -36,6 +36,10 @@ const (
 
 	ActionForceReload
 
+	ActionResourceAdded
+	ActionResourceModified
+	ActionResourceDeleted
+
 	actionContainerStartMask = ActionContainerCreate | ActionContainerStart | ActionContainerUnpause
 	actionContainerStopMask  = ActionContainerKill | ActionContainerStop | ActionContainerDie
 )
@@ -43,6 +47,10 @@ const (
 const (
 	EventTypeDocker EventType = "docker"
 	EventTypeFile   EventType = "file"
+
+	EventTypeKubernetes EventType = "kubernetes"
+	EventTypeDiscovery  EventType = "discovery"
+	EventTypeGit        EventType = "git"
 )
 
 var DockerEventMap = map[dockerEvents.Action]Action{
@@ -57,6 +65,13 @@ var DockerEventMap = map[dockerEvents.Action]Action{
 	dockerEvents.ActionDestroy: ActionContainerDestroy,
 }
 
+// DockerServiceEventMap maps swarm service events to resource actions.
+var DockerServiceEventMap = map[dockerEvents.Action]Action{
+	dockerEvents.ActionCreate: ActionResourceAdded,
+	dockerEvents.ActionUpdate: ActionResourceModified,
+	dockerEvents.ActionRemove: ActionResourceDeleted,
+}
+
 var fileActionNameMap = map[Action]string{
 	ActionFileWritten: "written",
 	ActionFileCreated: "created",
@@ -64,6 +79,12 @@ var fileActionNameMap = map[Action]string{
 	ActionFileRenamed: "renamed",
 }
 
+var resourceActionNameMap = map[Action]string{
+	ActionResourceAdded:    "added",
+	ActionResourceModified: "modified",
+	ActionResourceDeleted:  "deleted",
+}
+
 var actionNameMap = func() (m map[Action]string) {
 	m = make(map[Action]string, len(DockerEventMap))
 	for k, v := range DockerEventMap {
@@ -72,6 +93,9 @@ var actionNameMap = func() (m map[Action]string) {
 	for k, v := range fileActionNameMap {
 		m[k] = v
 	}
+	for k, v := range resourceActionNameMap {
+		m[k] = v
+	}
 	return m
 }()
 
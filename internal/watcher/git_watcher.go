@@ -0,0 +1,73 @@
+package watcher
+
+import (
+	"context"
+	"time"
+
+	"github.com/yusing/godoxy/internal/git"
+	"github.com/yusing/godoxy/internal/watcher/events"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+type GitWatcher struct {
+	cfg        *git.Config
+	trigger    <-chan struct{}
+	isUpToDate func(commit string) bool
+}
+
+const gitResolveTimeout = 30 * time.Second
+
+// NewGitWatcher watches the ref of a Git repository, cfg must be initialized.
+//
+// The ref is resolved at the poll interval and on trigger, e.g. by a webhook.
+// isUpToDate reports whether a commit is already loaded.
+func NewGitWatcher(cfg *git.Config, trigger <-chan struct{}, isUpToDate func(commit string) bool) GitWatcher {
+	return GitWatcher{cfg: cfg, trigger: trigger, isUpToDate: isUpToDate}
+}
+
+// Events emits ActionResourceModified with the commit id when the ref points to a commit not loaded.
+func (w GitWatcher) Events(ctx context.Context) (<-chan Event, <-chan gperr.Error) {
+	eventCh := make(chan Event)
+	errCh := make(chan gperr.Error)
+
+	go func() {
+		defer close(eventCh)
+		defer close(errCh)
+
+		ticker := time.NewTicker(w.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-w.trigger:
+			}
+
+			resolveCtx, cancel := context.WithTimeout(ctx, gitResolveTimeout)
+			commit, err := w.cfg.Remote().ResolveRef(resolveCtx, w.cfg.Ref)
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				if send(ctx, errCh, gperr.Wrap(err, "git watcher")) != nil {
+					return
+				}
+				continue
+			}
+			if w.isUpToDate(commit) {
+				continue
+			}
+			if send(ctx, eventCh, Event{
+				Type:      events.EventTypeGit,
+				ActorName: commit,
+				Action:    events.ActionResourceModified,
+			}) != nil {
+				return
+			}
+		}
+	}()
+	return eventCh, errCh
+}
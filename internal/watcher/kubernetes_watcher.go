@@ -0,0 +1,130 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/yusing/godoxy/internal/kubernetes"
+	"github.com/yusing/godoxy/internal/watcher/events"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+type KubernetesWatcher struct {
+	cfg *kubernetes.Config
+}
+
+var kubernetesEventMap = map[kubernetes.WatchEventType]events.Action{
+	kubernetes.WatchEventAdded:    events.ActionResourceAdded,
+	kubernetes.WatchEventModified: events.ActionResourceModified,
+	kubernetes.WatchEventDeleted:  events.ActionResourceDeleted,
+}
+
+var (
+	kubernetesWatcherRetryInterval = 3 * time.Second
+	// resources not installed in the cluster, e.g. Gateway API CRDs, are checked less often
+	kubernetesWatcherNotFoundInterval = time.Minute
+)
+
+// NewKubernetesWatcher watches the resources in kubernetes.Resources, cfg must be initialized.
+func NewKubernetesWatcher(cfg *kubernetes.Config) KubernetesWatcher {
+	return KubernetesWatcher{cfg: cfg}
+}
+
+func (w KubernetesWatcher) Events(ctx context.Context) (<-chan Event, <-chan gperr.Error) {
+	eventCh := make(chan Event)
+	errCh := make(chan gperr.Error)
+
+	var wg sync.WaitGroup
+	for _, r := range kubernetes.Resources {
+		for _, ns := range w.cfg.ListNamespaces() {
+			wg.Go(func() {
+				w.watch(ctx, r, ns, eventCh, errCh)
+			})
+		}
+	}
+	go func() {
+		wg.Wait()
+		close(eventCh)
+		close(errCh)
+	}()
+	return eventCh, errCh
+}
+
+// watch lists and watches a resource until ctx is done.
+//
+// When the resource has to be listed again, e.g. the resource version expired,
+// a reload is triggered since events may have been missed.
+func (w KubernetesWatcher) watch(ctx context.Context, r kubernetes.Resource, namespace string, eventCh chan<- Event, errCh chan<- gperr.Error) {
+	client := w.cfg.Client()
+	l := log.With().Str("resource", r.Plural).Str("namespace", namespace).Logger()
+
+	resourceVersion := ""
+	// routes are loaded when the provider starts, only lists after that trigger a reload
+	listed := false
+	for {
+		var err error
+		if resourceVersion == "" {
+			_, resourceVersion, err = kubernetes.List[kubernetes.Object](ctx, client, r, namespace)
+			if err == nil && listed {
+				err = send(ctx, eventCh, Event{Type: events.EventTypeKubernetes, Action: events.ActionForceReload})
+			}
+			listed = true
+		}
+		if err == nil {
+			resourceVersion, err = client.Watch(ctx, r, namespace, resourceVersion, func(e kubernetes.WatchEvent) {
+				action, ok := kubernetesEventMap[e.Type]
+				if !ok {
+					return
+				}
+				meta := e.Object.Metadata
+				_ = send(ctx, eventCh, Event{
+					Type:            events.EventTypeKubernetes,
+					ActorName:       r.Key(meta.Namespace, meta.Name),
+					ActorID:         meta.UID,
+					ActorAttributes: meta.Annotations,
+					Action:          action,
+				})
+			})
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		retryInterval := kubernetesWatcherRetryInterval
+		switch {
+		case err == nil:
+			// watch timed out, resume from the last resource version
+			continue
+		case errors.Is(err, kubernetes.ErrGone):
+			l.Debug().Msg("kubernetes watcher: resource version expired, listing again")
+			resourceVersion = ""
+			continue
+		case errors.Is(err, kubernetes.ErrNotFound):
+			l.Debug().Msg("kubernetes watcher: resource is not installed")
+			resourceVersion = ""
+			retryInterval = kubernetesWatcherNotFoundInterval
+		default:
+			if send(ctx, errCh, gperr.Wrap(err, "kubernetes watcher")) != nil {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+func send[T any](ctx context.Context, ch chan<- T, v T) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case ch <- v:
+		return nil
+	}
+}